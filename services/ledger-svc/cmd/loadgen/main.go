@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const usage = `loadgen posts synthetic statements to a running ledger-svc and reports the
+throughput and latency percentiles of the ingestion.
+
+Usage:
+  loadgen [flags]
+
+Flags:
+  -url http://localhost:8080     ledger-svc base URL, LEDGER_URL
+  -statements 1000               statements to post
+  -transactions 50               transactions per statement
+  -concurrency 8                 requests in flight
+  -reads 0                       reads of each statement after it is saved,
+                                 to measure the cached reads
+  -source LOADGEN                source name of the statements, one per run
+                                 keeps runs from replacing each other's
+  -token                         bearer token, LEDGER_TOKEN
+  -api-key                       API key, LEDGER_API_KEY
+  -seed 1                        seed of the synthetic data
+  -timeout 30s                   timeout of a request
+
+Statements are saved with their transactions ($expand=transactions), like
+the fetchers do. Exits 1 when a request failed.
+`
+
+func main() {
+	baseURL := flag.String("url", envOr("LEDGER_URL", "http://localhost:8080"), "ledger-svc base URL")
+	statements := flag.Int("statements", 1000, "statements to post")
+	transactions := flag.Int("transactions", 50, "transactions per statement")
+	concurrency := flag.Int("concurrency", 8, "requests in flight")
+	reads := flag.Int("reads", 0, "reads of each statement after it is saved")
+	source := flag.String("source", "LOADGEN", "source name of the statements")
+	token := flag.String("token", os.Getenv("LEDGER_TOKEN"), "bearer token")
+	apiKey := flag.String("api-key", os.Getenv("LEDGER_API_KEY"), "API key")
+	seed := flag.Uint64("seed", 1, "seed of the synthetic data")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of a request")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	if *statements <= 0 || *transactions < 0 || *concurrency <= 0 || *reads < 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	g := &generator{
+		client:  &http.Client{Timeout: *timeout, Transport: &http.Transport{MaxIdleConnsPerHost: *concurrency}},
+		baseURL: *baseURL,
+		token:   *token,
+		apiKey:  *apiKey,
+		source:  *source,
+		txs:     *transactions,
+		reads:   *reads,
+		seed:    *seed,
+	}
+	writes, readResults := g.run(*statements, *concurrency)
+
+	failed := report(os.Stdout, "write", writes, *transactions)
+	if *reads > 0 {
+		failed = report(os.Stdout, "read", readResults, 0) || failed
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+type generator struct {
+	client  *http.Client
+	baseURL string
+	token   string
+	apiKey  string
+	source  string
+	txs     int
+	reads   int
+	seed    uint64
+}
+
+// result is the outcome of a request, its status 0 when it did not complete.
+type result struct {
+	status  int
+	latency time.Duration
+	err     error
+}
+
+type results struct {
+	list    []result
+	elapsed time.Duration
+}
+
+// run posts the statements, then reads each of those saved reads times.
+func (g *generator) run(statements, concurrency int) (writes, reads results) {
+	ids := make([]string, statements)
+	writes = pool(statements, concurrency, func(i int) result {
+		r, id := g.post(i)
+		if r.err == nil {
+			ids[i] = id
+		}
+		return r
+	})
+	ids = slices.DeleteFunc(ids, func(id string) bool { return id == "" })
+	reads = pool(len(ids)*g.reads, concurrency, func(i int) result {
+		return g.get(ids[i%len(ids)])
+	})
+	return writes, reads
+}
+
+// pool makes the n requests of do from concurrency workers.
+func pool(n, concurrency int, do func(i int) result) results {
+	rs := results{list: make([]result, n)}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				rs.list[i] = do(i)
+			}
+		}()
+	}
+	for i := range n {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	rs.elapsed = time.Since(start)
+	return rs
+}
+
+// payload is a statement of the month i months before now, its transactions
+// spread over the month with amounts of a few merchants.
+func (g *generator) payload(i int) ([]byte, string) {
+	rng := rand.New(rand.NewPCG(g.seed, uint64(i)))
+	sourceID := fmt.Sprintf("%06d", i)
+	due := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, -i%120, 0)
+	txs := make([]map[string]any, g.txs)
+	total := 0.0
+	for j := range txs {
+		amount := float64(rng.IntN(500000)) / 100
+		if rng.IntN(20) == 0 {
+			amount = -amount
+		}
+		total += amount
+		txs[j] = map[string]any{
+			"id":          fmt.Sprintf("%s_%s_%05d", g.source, sourceID, j),
+			"description": merchants[rng.IntN(len(merchants))],
+			"amount":      amount,
+			"currency":    "TWD",
+			"date":        due.AddDate(0, 0, -rng.IntN(30)-15),
+		}
+	}
+	body, _ := json.Marshal(map[string]any{
+		"source_name":      g.source,
+		"source_id":        sourceID,
+		"currency":         "TWD",
+		"total_amount":     float64(int(total*100)) / 100,
+		"payment_due_date": due,
+		"transactions":     txs,
+	})
+	return body, g.source + "_" + sourceID
+}
+
+var merchants = []string{
+	"7-ELEVEN", "FAMILYMART", "PX MART", "CARREFOUR", "UBER EATS", "FOODPANDA", "TAIPEI MRT",
+	"CHUNGHWA TELECOM", "TAIPOWER", "NETFLIX.COM", "SPOTIFY", "APPLE.COM/BILL", "AMAZON", "IKEA",
+}
+
+func (g *generator) post(i int) (result, string) {
+	body, id := g.payload(i)
+	req, err := http.NewRequest(http.MethodPost, g.baseURL+"/api/statements?$expand=transactions", bytes.NewReader(body))
+	if err != nil {
+		return result{err: err}, ""
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Ingest-Schema-Version", "v1")
+	return g.do(req), id
+}
+
+func (g *generator) get(id string) result {
+	req, err := http.NewRequest(http.MethodGet, g.baseURL+"/api/statements/"+url.PathEscape(id)+"?$expand=transactions", nil)
+	if err != nil {
+		return result{err: err}
+	}
+	return g.do(req)
+}
+
+func (g *generator) do(req *http.Request) result {
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+	if g.apiKey != "" {
+		req.Header.Set("X-API-Key", g.apiKey)
+	}
+	start := time.Now()
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return result{latency: time.Since(start), err: err}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	latency := time.Since(start)
+	if err == nil && resp.StatusCode >= 300 {
+		err = fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return result{status: resp.StatusCode, latency: latency, err: err}
+}
+
+// report prints the throughput, the latency percentiles and the failures of
+// the requests, reporting whether some failed.
+func report(w io.Writer, name string, rs results, txsPerRequest int) bool {
+	if len(rs.list) == 0 {
+		return false
+	}
+	latencies := make([]time.Duration, 0, len(rs.list))
+	statuses := map[string]int{}
+	var firstErr error
+	for _, r := range rs.list {
+		latencies = append(latencies, r.latency)
+		statuses[statusText(r.status)]++
+		if r.err != nil && firstErr == nil {
+			firstErr = r.err
+		}
+	}
+	slices.Sort(latencies)
+	seconds := rs.elapsed.Seconds()
+
+	fmt.Fprintf(w, "%s: %d requests in %v, %.1f req/s", name, len(rs.list), rs.elapsed.Round(time.Millisecond), float64(len(rs.list))/seconds)
+	if txsPerRequest > 0 {
+		fmt.Fprintf(w, ", %.0f transactions/s", float64(len(rs.list)*txsPerRequest)/seconds)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "  latency p50 %v  p90 %v  p99 %v  max %v\n",
+		percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99), latencies[len(latencies)-1].Round(10*time.Microsecond))
+	keys := make([]string, 0, len(statuses))
+	for k := range statuses {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	fmt.Fprint(w, "  status")
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %s: %d", k, statuses[k])
+	}
+	fmt.Fprintln(w)
+	if firstErr != nil {
+		fmt.Fprintf(w, "  first error: %v\n", firstErr)
+	}
+	return firstErr != nil
+}
+
+// percentile returns the nearest-rank percentile of the sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p+99)/100 - 1
+	return sorted[max(i, 0)].Round(10 * time.Microsecond)
+}
+
+func statusText(status int) string {
+	if status == 0 {
+		return "error"
+	}
+	return strconv.Itoa(status)
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
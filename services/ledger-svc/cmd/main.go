@@ -1,39 +1,1285 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accounts"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/aggregator"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/analytics"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/anonymize"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apidocs"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apikeys"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/attachments"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/authn"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/authz"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/backup"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/budgets"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/categories"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/config"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/consistency"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/cors"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/debugcapture"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/dropzone"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/e2e"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/erasure"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/events"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/export"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/forecast"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/fx"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/graphql"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/health"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/homeassistant"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/households"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/httpcache"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/httpmetrics"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/importers"
+	_ "github.com/hsin19/Finchie/services/ledger-svc/internal/importers/camt"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/importers/csvimport"
+	_ "github.com/hsin19/Finchie/services/ledger-svc/internal/importers/mt940"
+	_ "github.com/hsin19/Finchie/services/ledger-svc/internal/importers/ofx"
+	_ "github.com/hsin19/Finchie/services/ledger-svc/internal/importers/qif"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/ingest"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/jobs"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/lease"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/live"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/mailbox"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/merchants"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/middleware"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/migrations"
+	_ "github.com/hsin19/Finchie/services/ledger-svc/internal/parsers"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/playground"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/queue"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/ratelimit"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/reminders"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/reports"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/secrets"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/serverless"
 	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/tax"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/telegram"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/trends"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/webhooks"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/widget"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+const usage = `finchie-ledger serves the ledger API.
+
+Usage:
+  finchie-ledger [command] [flags]
+
+Commands:
+  serve                          run the API server and the background work
+                                 (default); with --mode api or worker, one
+                                 of them so each scales on its own
+  migrate                        apply schema migrations and exit
+  backup --out <file.tar.gz>     dump all collections of MONGO_NAMESPACE
+  restore --in <file.tar.gz>     replace the collections with a backup
+  restore --object <name>        restore a scheduled backup from BACKUP_TARGET
+  reencrypt                      encrypt sensitive fields with the current key
+  mailpoll [--once]              import the e-statements mailed to MAILBOX_URL
+  consume                        save the statements published to INGEST_QUEUE_URL
+  telegram                       answer the chats of TELEGRAM_CHATS as a bot
+  assign-user <user> [tenant]    give the statements without a user to the user
+
+Flags:
+  --config <file.yaml>           settings, see internal/config, CONFIG_FILE
+  --mode all|api|worker          what serve runs, SERVE_MODE
+  --port, --admin-addr, --log-level, --local, --request-timeout,
+  --shutdown-timeout, --storage-driver
+                                 override the settings of the file and the
+                                 environment
+
+Scheduled backups are encrypted with BACKUP_ENCRYPTION_KEY; restore decrypts
+them with the same key, from --in after a manual download or with --object.
+`
+
 func main() {
-	initLogger()
-	statementsRepo := statements.NewRepoFromEnv()
+	migrateOnly := flag.Bool("migrate-only", false, "apply schema migrations and exit, same as the migrate command")
+	configFlags := config.RegisterFlags(flag.CommandLine)
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	cmd, args := "serve", []string(nil)
+	if flag.NArg() > 0 {
+		cmd, args = flag.Arg(0), flag.Args()[1:]
+	}
+	if *migrateOnly {
+		cmd = "migrate"
+	}
+
+	cfg, err := config.Load(configFlags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	initLogger(cfg)
+	// before anything reads the credentials from the environment
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if err := secrets.Resolve(ctx); err != nil {
+		slog.Error("Failed to resolve secrets", "error", err)
+		os.Exit(1)
+	}
+	cancel()
+	switch cmd {
+	case "serve":
+		serve(cfg)
+	case "migrate":
+		err = migrateCommand()
+	case "backup":
+		err = backupCommand(args)
+	case "restore":
+		err = restoreCommand(args)
+	case "reencrypt":
+		err = reencryptCommand()
+	case "mailpoll":
+		err = mailpollCommand(args)
+	case "consume":
+		err = consumeCommand()
+	case "telegram":
+		err = telegramCommand()
+	case "assign-user":
+		err = assignUserCommand(args)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		slog.Error("Command failed", "command", cmd, "error", err)
+		os.Exit(1)
+	}
+}
+
+func serve(cfg *config.Config) {
+	statementsRepo, err := statements.OpenFromEnv()
+	if err != nil {
+		slog.Error("Failed to open the statement repository", "error", err)
+		os.Exit(1)
+	}
+	if err := statements.CheckSideStores(statementsRepo); err != nil {
+		slog.Error("Unsupported storage driver", "error", err)
+		os.Exit(1)
+	}
+	if _, ok := statements.AsMongoRepo(statementsRepo); !ok && cfg.Mode != config.ModeAll {
+		slog.Warn("The api and worker modes share their work through MongoDB, run a single replica in all mode without it", "mode", cfg.Mode)
+	}
+	workers := newWorkers(cfg.RunsWorkers(), lease.NewStore(statementsRepo), time.Duration(envInt("LEASE_TTL_SECONDS", 30))*time.Second)
+	if err := migrate(statementsRepo, false); err != nil {
+		slog.Error("Migrations failed", "error", err)
+		os.Exit(1)
+	}
+
+	statementsService, err := newStatementsService(statementsRepo)
+	if err != nil {
+		slog.Error("Invalid statement service configuration", "error", err)
+		os.Exit(1)
+	}
 	statementsManager := statements.StatementManager{
-		Service: statements.NewService(statementsRepo),
+		Service: statementsService,
 		Repo:    statementsRepo,
 	}
 
-	http.HandleFunc("/api/statements", statementsManager.StatementsHandler)
-	slog.Info("Server running", "port", ":8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	categoryStore := categories.NewStore(statementsRepo)
+	if err := categories.Seed(context.Background(), categoryStore); err != nil {
+		slog.Warn("Failed to seed the category taxonomy", "error", err)
+	}
+	categoriesHandler := categories.Handler{Store: categoryStore}
+	fxConverter, err := fx.NewConverterFromEnv(statementsRepo)
+	if err != nil {
+		slog.Error("Invalid exchange rate configuration", "error", err)
+		os.Exit(1)
+	}
+	analyticsHandler := analytics.Handler{Repo: statementsRepo, FX: fxConverter}
+	attachmentStore := attachments.NewStore(statementsRepo)
+	attachmentSigner, err := attachments.URLSignerFromEnv()
+	if err != nil {
+		slog.Error("Invalid attachment URL configuration", "error", err)
+		os.Exit(1)
+	}
+	attachmentsHandler := attachments.Handler{
+		Store:   attachmentStore,
+		Repo:    statementsRepo,
+		MaxSize: int64(envInt("ATTACHMENT_MAX_MB", 25)) << 20,
+		Signer:  attachmentSigner,
+	}
+	exportManager := export.ExportManager{Repo: statementsRepo, Categories: categoryStore, Attachments: attachmentStore}
+	anonymizeSecret, err := anonymize.SecretFromEnv()
+	if err != nil {
+		slog.Error("Invalid anonymization configuration", "error", err)
+		os.Exit(1)
+	}
+	anonymizeHandler := anonymize.Handler{Repo: statementsRepo, Secret: anonymizeSecret}
+	healthHandler := &health.Handler{
+		Details:  map[string]map[string]string{},
+		Checkers: map[string]health.Checker{},
+	}
+	// /readyz tells whether the instance can serve the API now: 503 while
+	// the circuit of the repository is open, so the traffic goes elsewhere
+	readyHandler := &health.Handler{Checkers: map[string]health.Checker{}}
+	var breaker *statements.BreakerRepo
+	if d, ok := statementsRepo.(statements.Describer); ok {
+		healthHandler.Details["storage"] = d.Describe()
+	}
+	if mongoRepo, ok := statements.AsMongoRepo(statementsRepo); ok {
+		mongoHealth := statements.NewMongoHealth(mongoRepo.Database().Client(), 2*time.Second)
+		healthHandler.Checkers["database"] = mongoHealth
+		readyHandler.Checkers["database"] = mongoHealth
+		workers.Go(func(ctx context.Context) {
+			mongoHealth.Run(ctx, time.Duration(envInt("MONGO_HEALTH_INTERVAL_MS", 10000))*time.Millisecond)
+		})
+	}
+	for _, layer := range statements.Layers(statementsRepo) {
+		if cached, ok := layer.(*statements.CachedRepo); ok {
+			healthHandler.Checkers["cache"] = cached
+		}
+		if degradable, ok := layer.(*statements.DegradableRepo); ok {
+			healthHandler.Checkers["storage"] = degradable
+			workers.Go(func(ctx context.Context) { degradable.Run(ctx, 10*time.Second) })
+		}
+		if b, ok := layer.(*statements.BreakerRepo); ok {
+			breaker = b
+			readyHandler.Checkers["circuit"] = breaker
+		}
+	}
+	selfCheck(healthHandler)
+
+	eventSink, err := events.SinkFromEnv()
+	if err != nil {
+		slog.Error("Invalid change event sink", "error", err)
+		os.Exit(1)
+	}
+	jobRunner := jobs.NewRunner(jobs.NewStore(statementsRepo))
+	if policy, ok := statements.ArchivePolicyFromEnv(); ok {
+		if mongoRepo, isMongo := statements.AsMongoRepo(statementsRepo); isMongo {
+			jobRunner.Add(jobs.Job{
+				Name:        "archive",
+				Description: "Moves the statements due more than ARCHIVE_AFTER_YEARS ago to the archive",
+				Schedule:    jobSchedule("ARCHIVE_SCHEDULE", policy.Interval),
+				Run: func(ctx context.Context, now time.Time) error {
+					archived, err := mongoRepo.Archive(ctx, now.Add(-policy.After))
+					if archived > 0 {
+						slog.Info("Archived statements", "count", archived)
+					}
+					return err
+				},
+			})
+		} else {
+			slog.Warn("Archiving needs a MongoDB repository, ARCHIVE_AFTER_YEARS is ignored")
+		}
+	}
+	if mongoRepo, ok := statements.AsMongoRepo(statementsRepo); ok {
+		scheduler, err := backup.NewSchedulerFromEnv(context.Background(), mongoRepo.Database(), mongoRepo.Namespace())
+		if err != nil {
+			slog.Error("Invalid backup schedule", "error", err)
+			os.Exit(1)
+		}
+		if scheduler != nil {
+			healthHandler.Checkers["backup"] = scheduler
+			workers.Singleton("backup", scheduler.Run)
+		}
+	} else if os.Getenv("BACKUP_TARGET") != "" {
+		slog.Warn("Scheduled backups need a MongoDB repository, BACKUP_TARGET is ignored")
+	}
+
+	projector := trends.NewProjectorFromEnv(statementsRepo)
+	workers.Singleton("trends", func(ctx context.Context) {
+		projector.Run(ctx, time.Duration(envInt("TRENDS_REBUILD_HOURS", 24))*time.Hour)
+	})
+	trendsHandler := trends.Handler{Store: projector.Store, Categories: categoryStore}
+	merchantProjector := merchants.NewProjector(statementsRepo)
+	jobRunner.Add(jobs.Job{
+		Name:        "merchants",
+		Description: "Rebuilds the merchant spend the recurring charges are detected from",
+		Schedule:    jobSchedule("MERCHANTS_SCHEDULE", time.Duration(envInt("MERCHANTS_REBUILD_HOURS", 24))*time.Hour),
+		Run:         merchantProjector.Rebuild,
+	})
+	merchantsHandler := merchants.Handler{Store: merchantProjector.Store}
+	forecastHandler := forecast.Handler{Repo: statementsRepo, Merchants: merchantProjector.Store}
+	utilizationTracker := accounts.NewTrackerFromEnv(statementsRepo)
+	workers.Singleton("utilization", func(ctx context.Context) {
+		utilizationTracker.Run(ctx, time.Duration(envInt("UTILIZATION_INTERVAL_HOURS", 24))*time.Hour)
+	})
+	accountsHandler := accounts.Handler{Tracker: utilizationTracker}
+	graphqlHandler := &graphql.Handler{Schema: graphql.NewSchema(&graphql.Resolver{
+		Repo:      statementsRepo,
+		Service:   statementsService,
+		Accounts:  utilizationTracker.Store,
+		Merchants: merchantProjector.Store,
+	})}
+	budgetStore := budgets.NewStore(statementsRepo)
+	if err := budgets.SeedFromEnv(context.Background(), budgetStore); err != nil {
+		slog.Error("Invalid budget configuration", "error", err)
+		os.Exit(1)
+	}
+	budgetsHandler := budgets.Handler{
+		Store:   budgetStore,
+		Tracker: &budgets.Tracker{Repo: statementsRepo, Store: budgetStore, Categories: categoryStore},
+	}
+	webhookHub := webhooks.NewHubFromEnv(statementsRepo, budgetsHandler.Tracker)
+	workers.Singleton("webhooks", func(ctx context.Context) {
+		webhookHub.Run(ctx, time.Duration(envInt("WEBHOOKS_DELIVER_INTERVAL_SECONDS", 5))*time.Second)
+	})
+	webhooksHandler := webhooks.Handler{Hub: webhookHub}
+	roleStore := authz.NewRoleStore(statementsRepo)
+	sessionStore := authn.NewSessionStore(statementsRepo)
+	login, err := authn.LoginFromEnv(sessionStore)
+	if err != nil {
+		slog.Error("Invalid login configuration", "error", err)
+		os.Exit(1)
+	}
+	corsPolicy, err := cors.FromEnv()
+	if err != nil {
+		slog.Error("Invalid CORS configuration", "error", err)
+		os.Exit(1)
+	}
+	if login != nil && corsPolicy != nil {
+		login.AllowedOrigin = corsPolicy.Allowed
+	}
+	rolesHandler := authz.RolesHandler{Store: roleStore}
+	liveHub := live.NewHub(budgetsHandler.Tracker)
+	workers.Go(func(ctx context.Context) { liveHub.Run(ctx) })
+	statementsService.Notifier = liveHub
+	sinks := events.MultiSink{eventSink, projector, merchantProjector, utilizationTracker, webhookHub}
+	// the aggregations served from the response cache
+	cached := func(h http.HandlerFunc) http.Handler { return h }
+	if responseCache := httpcache.FromEnv(); responseCache != nil {
+		statementsService.Notifier = statements.Notifiers{liveHub, responseCache}
+		// last, once the projections it serves were updated
+		sinks = append(sinks, responseCache)
+		cached = func(h http.HandlerFunc) http.Handler { return responseCache.Middleware(h) }
+	}
+	if outbox, ok := statements.AsOutbox(statementsRepo); ok {
+		dispatcher := events.Dispatcher{Outbox: outbox, Sink: sinks}
+		workers.Singleton("events", func(ctx context.Context) {
+			dispatcher.Run(ctx, time.Duration(envInt("EVENTS_DISPATCH_INTERVAL_MS", 1000))*time.Millisecond)
+		})
+	}
+
+	e2eHandler := e2e.Handler{Store: e2e.NewStore(statementsRepo), Mode: statementsService.E2E}
+	csvImportHandler := csvimport.Handler{Store: csvimport.NewStore(statementsRepo), Service: statementsService}
+
+	widgetHandler := &widget.Handler{Repo: statementsRepo, Tracker: budgetsHandler.Tracker}
+
+	reportGenerator, err := reports.NewGeneratorFromEnv(statementsRepo, categoryStore, budgetStore)
+	if err != nil {
+		slog.Error("Invalid report configuration", "error", err)
+		os.Exit(1)
+	}
+	jobRunner.Add(jobs.Job{
+		Name:        "reports",
+		Description: "Snapshots the report of the last completed month and sends its digest",
+		Schedule:    jobSchedule("REPORTS_SCHEDULE", time.Duration(envInt("REPORTS_INTERVAL_HOURS", 6))*time.Hour),
+		Run:         reportGenerator.Snapshot,
+	})
+	reportsHandler := reports.Handler{Generator: reportGenerator}
+	erasureHandler := erasure.Handler{Eraser: &erasure.Eraser{
+		Repo:        statementsRepo,
+		Attachments: attachmentStore,
+		Jobs:        erasure.NewStore(statementsRepo),
+		Webhooks:    webhookHub.Store,
+		Derived:     []erasure.Rebuilder{projector, merchantProjector, reportGenerator},
+	}}
+	householdsHandler := households.Handler{Store: households.NewStore(statementsRepo), Repo: statementsRepo, Categories: categoryStore}
+	taxHandler := tax.Handler{Repo: statementsRepo, Store: tax.NewStore(statementsRepo), Categories: categoryStore}
+
+	consistencyChecker, err := consistency.NewCheckerFromEnv(statementsRepo)
+	if err != nil {
+		slog.Error("Invalid consistency check configuration", "error", err)
+		os.Exit(1)
+	}
+	workers.Singleton("consistency", func(ctx context.Context) {
+		consistencyChecker.Run(ctx, time.Duration(envInt("CONSISTENCY_INTERVAL_HOURS", 24))*time.Hour)
+	})
+	consistencyHandler := consistency.Handler{Checker: consistencyChecker}
+
+	escalator, err := reminders.NewEscalatorFromEnv(statementsRepo)
+	if err != nil {
+		slog.Error("Invalid reminder configuration", "error", err)
+		os.Exit(1)
+	}
+	jobRunner.Add(jobs.Job{
+		Name:        "reminders",
+		Description: "Sends the reminders of the statements falling due",
+		Schedule:    jobSchedule("REMINDERS_SCHEDULE", time.Duration(envInt("REMINDER_INTERVAL_MINUTES", 60))*time.Minute),
+		Run:         escalator.Tick,
+	})
+	remindersHandler := reminders.Handler{Escalator: escalator}
+	// on every worker replica, each run takes the lease of its job
+	workers.Background(jobRunner.Run)
+	jobsHandler := jobs.Handler{Runner: jobRunner}
+
+	if publisher := homeassistant.NewPublisherFromEnv(statementsRepo); publisher != nil {
+		workers.Singleton("homeassistant", publisher.Run)
+	}
+
+	ingestRuns := newIngestRunStore(statementsRepo)
+	dropzoneImporter, err := dropzone.NewImporterFromEnv(statementsService, ingestRuns)
+	if err != nil {
+		slog.Error("Invalid drop zone configuration", "error", err)
+		os.Exit(1)
+	}
+	if dropzoneImporter != nil {
+		workers.Singleton("dropzone", func(ctx context.Context) {
+			dropzoneImporter.Run(ingestContext(ctx), time.Duration(envInt("DROPZONE_INTERVAL_MINUTES", 15))*time.Minute)
+		})
+	}
+	aggregatorSyncer, err := aggregator.NewSyncerFromEnv(statementsService, ingestRuns)
+	if err != nil {
+		slog.Error("Invalid aggregator configuration", "error", err)
+		os.Exit(1)
+	}
+	if len(aggregatorSyncer.Providers) > 0 {
+		workers.Singleton("aggregator", func(ctx context.Context) {
+			aggregatorSyncer.Run(ctx, time.Duration(envInt("AGGREGATOR_SYNC_INTERVAL_HOURS", 6))*time.Hour)
+		})
+	}
+	aggregatorHandler := aggregator.Handler{Syncer: aggregatorSyncer}
+	if cfg.Mode == config.ModeWorker {
+		// only on the worker replicas, the API keeps away from the mailbox
+		// credentials as with the mailpoll command
+		poller, err := mailbox.NewPollerFromEnv(statementsService, ingestRuns)
+		if err != nil {
+			slog.Error("Invalid mailbox configuration", "error", err)
+			os.Exit(1)
+		}
+		if poller != nil {
+			workers.Singleton("mailbox", func(ctx context.Context) {
+				poller.Run(ingestContext(ctx), time.Duration(envInt("MAILBOX_INTERVAL_MINUTES", 30))*time.Minute)
+			})
+		}
+	}
+
+	http.Handle("/healthz", healthHandler)
+	http.Handle("/readyz", readyHandler)
+	// scraped with an admin API key as the bearer token, or on ADMIN_ADDR
+	http.Handle("GET /metrics", promhttp.Handler())
+	http.HandleFunc("GET /api/statements", statementsManager.LegacyGetHandler)
+	http.HandleFunc("POST /api/statements", statementsManager.SaveHandler)
+	http.HandleFunc("GET /api/statements/{id}", statementsManager.GetHandler)
+	http.HandleFunc("GET /api/statements/{id}/transactions", statementsManager.TransactionsOfStatementHandler)
+	http.HandleFunc("GET /api/statements/duplicates", statementsManager.DuplicatesHandler)
+	http.HandleFunc("POST /api/statements/merge", statementsManager.MergeHandler)
+	http.HandleFunc("GET /api/statements/{id}/reconciliation", statementsManager.ReconciliationHandler)
+	http.HandleFunc("GET /api/statements/{id}/anonymized", anonymizeHandler.AnonymizedStatementHandler)
+	http.HandleFunc("POST /api/statements/{id}/attachments", attachmentsHandler.UploadHandler)
+	http.HandleFunc("GET /api/statements/{id}/attachments", attachmentsHandler.ListHandler)
+	http.HandleFunc("GET /api/attachments/{id}", attachmentsHandler.DownloadHandler)
+	http.HandleFunc("GET /api/attachments/{id}/url", attachmentsHandler.SignedURLHandler)
+	http.HandleFunc("GET /api/attachments/{id}/content", attachmentsHandler.SignedDownloadHandler)
+	http.HandleFunc("POST /api/statements/{id}/payments", statementsManager.PaymentsHandler)
+	http.HandleFunc("POST /api/statements/{id}/payment/confirm", statementsManager.ConfirmPaymentHandler)
+	http.HandleFunc("PUT /api/statements/{id}/transactions/{txid}/external_refs", statementsManager.ExternalRefsHandler)
+	http.HandleFunc("PUT /api/statements/{id}/transactions/{txid}/attribution", statementsManager.AttributionHandler)
+	http.HandleFunc("GET /api/statements/{id}/transactions/{txid}/dispute", statementsManager.DisputeHandler)
+	http.HandleFunc("PUT /api/statements/{id}/transactions/{txid}/dispute", statementsManager.UpdateDisputeHandler)
+	http.HandleFunc("GET /api/disputes", statementsManager.DisputesHandler)
+	http.HandleFunc("POST /api/statements/{id}/reminders/ack", remindersHandler.AcknowledgeHandler)
+	http.HandleFunc("GET /api/consistency", consistencyHandler.ReportHandler)
+	http.HandleFunc("GET /api/jobs", jobsHandler.ListHandler)
+	http.HandleFunc("GET /api/jobs/{name}", jobsHandler.GetHandler)
+	http.HandleFunc("POST /api/jobs/{name}/run", jobsHandler.RunHandler)
+	http.HandleFunc("POST /api/consistency/check", consistencyHandler.CheckHandler)
+	http.HandleFunc("GET /api/reminders/preferences", remindersHandler.PreferencesHandler)
+	http.HandleFunc("PUT /api/reminders/preferences/{source}", remindersHandler.SavePreferenceHandler)
+	http.HandleFunc("DELETE /api/reminders/preferences/{source}", remindersHandler.DeletePreferenceHandler)
+	http.HandleFunc("GET /api/reminders", remindersHandler.RemindersHandler)
+	http.Handle("GET /api/rewards", cached(statementsManager.RewardsHandler))
+	http.HandleFunc("GET /api/transactions", statementsManager.TransactionsHandler)
+	http.Handle("GET /api/fees", cached(statementsManager.FeesHandler))
+	http.HandleFunc("GET /api/sources/health", statementsManager.SourceHealthHandler)
+	http.HandleFunc("GET /api/audit", statementsManager.AuditHandler)
+	http.Handle("GET /api/trends", cached(trendsHandler.TrendsHandler))
+	http.Handle("GET /api/merchants", cached(merchantsHandler.MerchantsHandler))
+	http.Handle("GET /api/merchants/recurring", cached(merchantsHandler.RecurringHandler))
+	http.Handle("GET /api/merchants/price_changes", cached(merchantsHandler.PriceChangesHandler))
+	http.HandleFunc("GET /api/reports", reportsHandler.ReportsHandler)
+	http.HandleFunc("GET /api/reports/{month}", reportsHandler.ReportHandler)
+	http.HandleFunc("GET /api/reports/monthly/{month}", reportsHandler.DigestHandler)
+	http.HandleFunc("GET /api/reports/tax", taxHandler.ExportHandler)
+	http.Handle("/graphql", graphqlHandler)
+	http.HandleFunc("GET /api/docs", apidocs.DocsHandler)
+	http.HandleFunc("GET /api/docs/openapi.json", apidocs.SpecHandler)
+	http.HandleFunc("GET /api/accounts", accountsHandler.ListHandler)
+	http.HandleFunc("PUT /api/accounts/{id}", accountsHandler.SaveHandler)
+	http.HandleFunc("DELETE /api/accounts/{id}", accountsHandler.DeleteHandler)
+	http.HandleFunc("GET /api/accounts/{id}/utilization", accountsHandler.UtilizationHandler)
+	http.HandleFunc("GET /api/events", (&live.Handler{Hub: liveHub}).StreamHandler)
+	http.HandleFunc("GET /api/webhooks", webhooksHandler.ListHandler)
+	http.HandleFunc("POST /api/webhooks", webhooksHandler.CreateHandler)
+	http.HandleFunc("GET /api/webhooks/{id}", webhooksHandler.GetHandler)
+	http.HandleFunc("PUT /api/webhooks/{id}", webhooksHandler.UpdateHandler)
+	http.HandleFunc("DELETE /api/webhooks/{id}", webhooksHandler.DeleteHandler)
+	http.HandleFunc("GET /api/webhooks/{id}/deliveries", webhooksHandler.DeliveriesHandler)
+	http.HandleFunc("POST /api/webhooks/{id}/deliveries/{delivery}/redeliver", webhooksHandler.RedeliverHandler)
+	if login != nil {
+		http.HandleFunc("GET /auth/login", login.LoginHandler)
+		http.HandleFunc("GET /auth/callback", login.CallbackHandler)
+		http.HandleFunc("POST /auth/logout", login.LogoutHandler)
+		http.HandleFunc("GET /auth/session", login.SessionHandler)
+	}
+	http.HandleFunc("GET /api/roles", rolesHandler.RolesListHandler)
+	http.HandleFunc("GET /api/roles/assignments", rolesHandler.ListHandler)
+	http.HandleFunc("PUT /api/roles/assignments/{subject}", rolesHandler.PutHandler)
+	http.HandleFunc("DELETE /api/roles/assignments/{subject}", rolesHandler.DeleteHandler)
+	http.HandleFunc("DELETE /api/users/{id}/data", erasureHandler.EraseHandler)
+	http.HandleFunc("GET /api/erasures/{id}", erasureHandler.JobHandler)
+	http.HandleFunc("GET /api/aggregator/providers", aggregatorHandler.ProvidersHandler)
+	http.HandleFunc("POST /api/aggregator/providers/{provider}/link_token", aggregatorHandler.LinkTokenHandler)
+	http.HandleFunc("POST /api/aggregator/providers/{provider}/connections", aggregatorHandler.ConnectHandler)
+	http.HandleFunc("POST /api/aggregator/providers/{provider}/webhooks", aggregatorHandler.WebhookHandler)
+	http.HandleFunc("GET /api/aggregator/connections", aggregatorHandler.ListHandler)
+	http.HandleFunc("GET /api/aggregator/connections/{id}", aggregatorHandler.GetHandler)
+	http.HandleFunc("DELETE /api/aggregator/connections/{id}", aggregatorHandler.DeleteHandler)
+	http.HandleFunc("POST /api/aggregator/connections/{id}/sync", aggregatorHandler.SyncHandler)
+	http.HandleFunc("GET /api/households", householdsHandler.ListHandler)
+	http.HandleFunc("POST /api/households", householdsHandler.CreateHandler)
+	http.HandleFunc("GET /api/households/{id}", householdsHandler.GetHandler)
+	http.HandleFunc("PUT /api/households/{id}", householdsHandler.UpdateHandler)
+	http.HandleFunc("DELETE /api/households/{id}", householdsHandler.DeleteHandler)
+	http.HandleFunc("GET /api/households/{id}/settlement", householdsHandler.SettlementHandler)
+	http.HandleFunc("GET /api/tax/mappings", taxHandler.MappingsHandler)
+	http.HandleFunc("PUT /api/tax/mappings/{category}", taxHandler.SaveMappingHandler)
+	http.HandleFunc("DELETE /api/tax/mappings/{category}", taxHandler.DeleteMappingHandler)
+	http.Handle("GET /api/analytics/spend", cached(analyticsHandler.SpendHandler))
+	http.Handle("GET /api/analytics/forecast", cached(forecastHandler.ForecastHandler))
+	http.HandleFunc("GET /api/e2e", e2eHandler.ConfigHandler)
+	http.HandleFunc("GET /api/e2e/keys", e2eHandler.ListHandler)
+	http.HandleFunc("GET /api/e2e/keys/{id}", e2eHandler.GetHandler)
+	http.HandleFunc("PUT /api/e2e/keys/{id}", e2eHandler.PutHandler)
+	http.HandleFunc("DELETE /api/e2e/keys/{id}", e2eHandler.DeleteHandler)
+	http.HandleFunc("GET /api/budgets", budgetsHandler.ListHandler)
+	http.HandleFunc("POST /api/budgets", budgetsHandler.CreateHandler)
+	http.HandleFunc("GET /api/budgets/status", budgetsHandler.StatusHandler)
+	http.HandleFunc("GET /api/widget/budget", widgetHandler.BudgetHandler)
+	http.HandleFunc("PUT /api/budgets/{id}", budgetsHandler.UpdateHandler)
+	http.HandleFunc("DELETE /api/budgets/{id}", budgetsHandler.DeleteHandler)
+	http.HandleFunc("GET /api/categories", categoriesHandler.CategoriesHandler)
+	http.HandleFunc("POST /api/categories", categoriesHandler.AddHandler)
+	http.HandleFunc("GET /api/categories/history", categoriesHandler.HistoryHandler)
+	http.HandleFunc("PUT /api/categories/{name}/parent", categoriesHandler.MoveHandler)
+	http.HandleFunc("GET /api/ingest/schema", ingest.SchemaHandler)
+	http.Handle("GET /api/ingest/runs", &ingest.RunsHandler{Store: ingestRuns})
+	http.HandleFunc("GET /api/export/rollup.csv", exportManager.CategoryRollupHandler)
+	http.HandleFunc("GET /api/export/transactions.csv", exportManager.TransactionsCSVHandler)
+	http.HandleFunc("GET /api/export/attachments", exportManager.AttachmentsZipHandler)
+	http.HandleFunc("POST /api/import/csv", csvImportHandler.ImportHandler)
+	http.HandleFunc("POST /api/import/{format}", (&importers.Handler{Service: statementsService}).ImportHandler)
+	http.HandleFunc("GET /api/import/profiles", csvImportHandler.ListHandler)
+	http.HandleFunc("POST /api/import/profiles", csvImportHandler.CreateHandler)
+	http.HandleFunc("GET /api/import/profiles/{id}", csvImportHandler.GetHandler)
+	http.HandleFunc("PUT /api/import/profiles/{id}", csvImportHandler.UpdateHandler)
+	http.HandleFunc("DELETE /api/import/profiles/{id}", csvImportHandler.DeleteHandler)
+	if cfg.Local || cfg.Features.Playground {
+		http.HandleFunc("GET /api/playground", playground.Handler)
+	}
+	adminMux := http.NewServeMux()
+	// the middlewares, the outermost first
+	chain := middleware.Chain{}
+	if cfg.Features.DebugCapture {
+		captureStore := debugcapture.NewStore(envInt("DEBUG_CAPTURE_SIZE", 50))
+		chain = chain.With(func(next http.Handler) http.Handler { return debugcapture.Middleware(captureStore, next) })
+		// replayed from the host of the service, on the port it listens on
+		(&debugcapture.Handler{Store: captureStore, BaseURL: "http://localhost" + cfg.Addr()}).Register(adminMux)
+		slog.Warn("Debug capture enabled, failing requests are kept in memory")
+	}
+	chain = chain.With(withRequestID, func(next http.Handler) http.Handler {
+		return httpmetrics.Middleware(http.DefaultServeMux, next)
+	})
+	if cfg.Features.AccessLog {
+		chain = chain.With(accesslog.Middleware)
+	}
+	// inside the log and the metrics, which see the 500
+	chain = chain.With(middleware.Recover)
+	if cfg.Features.Compression {
+		chain = chain.With(middleware.Compress)
+	}
+	if breaker != nil {
+		// inside the compression, which would encode the 500 it replaces
+		chain = chain.With(breaker.Middleware)
+	}
+	if corsPolicy != nil {
+		// outside authentication, preflights carry no credentials
+		chain = chain.With(corsPolicy.Middleware)
+	}
+
+	// requests with an API key skip the authentication of the others
+	authenticated := middleware.Chain{}
+	anonymous := middleware.Chain{}
+	if rateLimit := ratelimit.FromEnv(); rateLimit != nil {
+		// requests with an API key are limited once it is checked, the others
+		// by IP before authentication
+		authenticated = authenticated.With(rateLimit.Middleware)
+		anonymous = anonymous.With(rateLimit.Middleware)
+	}
+	authenticator, err := authn.FromEnv()
+	if err != nil {
+		slog.Error("Invalid authentication configuration", "error", err)
+		os.Exit(1)
+	}
+	if authenticator != nil {
+		authenticator.Sessions = sessionStore
+		// outside withRequestInfo, which reads the identity the token sets
+		anonymous = anonymous.With(authenticator.Middleware)
+	}
+
+	authorized := middleware.Chain{withRequestInfo}
+	if cfg.Local || cfg.Features.Playground {
+		// inside authentication, the sandbox of each user is their own
+		authorized = authorized.With(playground.Middleware)
+	}
+	rbac, err := authz.RBACFromEnv(http.DefaultServeMux, roleStore, authenticator != nil)
+	if err != nil {
+		slog.Error("Invalid role-based access control configuration", "error", err)
+		os.Exit(1)
+	}
+	if rbac != nil {
+		authorized = authorized.With(rbac.Middleware)
+	}
+	authzEngine, decisionLog, err := authz.FromEnv()
+	if err != nil {
+		slog.Error("Invalid authorization policy", "error", err)
+		os.Exit(1)
+	}
+	if authzEngine != nil {
+		authorized = authorized.With(func(next http.Handler) http.Handler {
+			return authz.Middleware(authzEngine, decisionLog, next)
+		})
+	}
+	if cfg.Features.APIValidation {
+		authorized = authorized.With(func(next http.Handler) http.Handler { return apidocs.Middleware(apidocs.Spec, next) })
+	}
+	api := authorized.Then(withRequestTimeout(http.DefaultServeMux, cfg.RequestTimeout))
+
+	apiKeyStore := apikeys.NewStore(statementsRepo)
+	(&apikeys.Handler{
+		Store:         apiKeyStore,
+		RequireUser:   authn.Enabled(),
+		RequireTenant: authn.Enabled() && os.Getenv("AUTH_TENANT_CLAIM") != "",
+	}).Register(adminMux)
+	handler := chain.Then(apikeys.Middleware(apiKeyStore, authenticated.Then(api), anonymous.Then(api)))
+	(&fx.Handler{Converter: fxConverter}).Register(adminMux)
+	adminMux.Handle("GET /metrics", promhttp.Handler())
+	adminServer := startAdminServer(cfg.AdminAddr, adminMux, cfg.Server)
+
+	if serverless.IsLambda() && cfg.ServesAPI() {
+		slog.Info("Running as an AWS Lambda function")
+		serverless.StartLambda(handler)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if !cfg.ServesAPI() {
+		// the probes of the platform
+		workerMux := http.NewServeMux()
+		workerMux.Handle("/healthz", healthHandler)
+		workerMux.Handle("/readyz", readyHandler)
+		handler = workerMux
+	}
+	server := newServer(cfg.Addr(), handler, cfg.Server)
+	server.RegisterOnShutdown(liveHub.Close)
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Server running", "port", server.Addr, "mode", cfg.Mode)
+		serverErr <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-serverErr:
 		slog.Error("Server failed", "error", err)
 		os.Exit(1)
+	case <-ctx.Done():
+	}
+	stop()
+	shutdown(server, adminServer, workers, statementsRepo, cfg.ShutdownTimeout)
+}
+
+// shutdown lets the requests in flight, e.g. ingestions, finish within the
+// timeout (25s by default, under the 30s grace period of Kubernetes and ECS),
+// then stops the workers, replays the queued writes and closes the database.
+func shutdown(server, adminServer *http.Server, workers *workers, repo statements.StatementRepository, timeout time.Duration) {
+	slog.Info("Shutting down, draining requests", "timeout", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Warn("Requests still in flight were cut off", "error", err)
+	}
+	if adminServer != nil {
+		_ = adminServer.Shutdown(ctx)
+	}
+	if !workers.Stop(ctx) {
+		slog.Warn("Background workers did not stop in time")
+	}
+	for _, layer := range statements.Layers(repo) {
+		if degradable, ok := layer.(*statements.DegradableRepo); ok {
+			if left := degradable.Flush(ctx); left > 0 {
+				slog.Warn("Queued writes kept in the outbox file for the next start, the database is unavailable", "writes", left)
+			}
+		}
+	}
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		if err := mongoRepo.Close(ctx); err != nil {
+			slog.Warn("Failed to disconnect from MongoDB", "error", err)
+		}
+	}
+	slog.Info("Server stopped")
+}
+
+// jobSchedule reads the schedule of a job, see jobs.ScheduleFromEnv.
+func jobSchedule(name string, fallback time.Duration) jobs.Schedule {
+	schedule, err := jobs.ScheduleFromEnv(name, fallback)
+	if err != nil {
+		slog.Error("Invalid job schedule", "error", err)
+		os.Exit(1)
+	}
+	return schedule
+}
+
+// workers runs the background workers of the server until it stops them.
+// The background work, left to the worker replicas in the api mode, runs
+// with Background or, when a single replica may run it, Singleton.
+type workers struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+	// background is whether this replica runs the background work
+	background bool
+	leases     lease.Store
+	leaseTTL   time.Duration
+}
+
+func newWorkers(background bool, leases lease.Store, leaseTTL time.Duration) *workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workers{ctx: ctx, cancel: cancel, background: background, leases: leases, leaseTTL: leaseTTL}
+}
+
+// Background runs the worker on every replica running the background work.
+func (w *workers) Background(run func(ctx context.Context)) {
+	if w.background {
+		w.Go(run)
+	}
+}
+
+// Singleton runs the worker on the one replica running the background work
+// that holds the lease of its name; another takes over within the lease TTL
+// when it stops.
+func (w *workers) Singleton(name string, run func(ctx context.Context)) {
+	if w.background {
+		leader := lease.NewLeader(w.leases, name, w.leaseTTL)
+		w.Go(func(ctx context.Context) { leader.Run(ctx, run) })
+	}
+}
+
+// Go runs the worker with a context done when the workers are stopped, on
+// every replica whatever its mode, e.g. the health probes.
+func (w *workers) Go(run func(ctx context.Context)) {
+	w.running.Add(1)
+	go func() {
+		defer w.running.Done()
+		run(w.ctx)
+	}()
+}
+
+// Stop cancels the workers and waits for them to return, reporting false
+// when ctx is done first.
+func (w *workers) Stop(ctx context.Context) bool {
+	w.cancel()
+	done := make(chan struct{})
+	go func() {
+		w.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// newStatementsService configures the statement service from the environment,
+// the same way for the API server and the workers.
+func newStatementsService(repo statements.StatementRepository) (*statements.StatementService, error) {
+	paymentConfig, err := statements.PaymentConfigFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("invalid payment auto-close configuration: %w", err)
+	}
+	idStrategies, err := statements.IDStrategiesFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("invalid statement ID strategy: %w", err)
+	}
+	refRules, err := statements.RefRulesFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("invalid external reference rules: %w", err)
+	}
+	enrichers, err := statements.EnrichersFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("invalid enrichers: %w", err)
+	}
+	e2eMode, err := statements.E2EModeFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("invalid end-to-end encryption mode: %w", err)
+	}
+	service := statements.NewService(repo)
+	service.Payments = paymentConfig
+	service.IDs = idStrategies
+	service.RefRules = refRules
+	service.Enrichers = enrichers
+	service.E2E = e2eMode
+	return service, nil
+}
+
+// ingestContext scopes the workers storing statements on no one's request to
+// INGEST_USER_ID and INGEST_TENANT_ID, who own them when the API
+// authenticates.
+func ingestContext(ctx context.Context) context.Context {
+	return statements.WithTenant(statements.WithUser(ctx, os.Getenv("INGEST_USER_ID")), os.Getenv("INGEST_TENANT_ID"))
+}
+
+func newIngestRunStore(repo statements.StatementRepository) ingest.RunStore {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return ingest.NewMongoRunStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return ingest.NewMemoryRunStore(100)
+}
+
+// migrateCommand applies the schema migrations of the configured repository.
+func migrateCommand() error {
+	repo, err := statements.NewRepoFromEnv()
+	if err != nil {
+		return err
+	}
+	return migrate(repo, true)
+}
+
+func migrate(repo statements.StatementRepository, required bool) error {
+	mongoRepo, ok := statements.AsMongoRepo(repo)
+	if !ok {
+		if required {
+			return errors.New("migrations require a MongoDB repository, check MONGO_URI and MONGO_DB")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	applied, err := migrations.Run(ctx, mongoRepo.Database(), mongoRepo.Namespace())
+	if err != nil {
+		return err
+	}
+	slog.Info("Schema migrations up to date", "applied", applied)
+	return nil
+}
+
+// reencryptCommand rewrites the sensitive fields stored in plaintext or under
+// an older key with the current FIELD_ENCRYPTION_KEYS key. Run it after
+// enabling encryption or rotating the key, before retiring the old key; it
+// also backfills the blind index of the source IDs.
+func reencryptCommand() error {
+	repo, err := statements.OpenFromEnv()
+	if err != nil {
+		return err
+	}
+	encrypted, ok := statements.AsEncryptedRepo(repo)
+	if !ok {
+		return errors.New("FIELD_ENCRYPTION_KEYS is not set")
+	}
+	stmts, txs, err := encrypted.Reencrypt(context.Background())
+	if err != nil {
+		return err
+	}
+	slog.Info("Sensitive fields reencrypted", "statements", stmts, "transactions", txs)
+	return nil
+}
+
+// assignUserCommand gives the statements and transactions stored without a
+// user, before authentication was enabled, to the user. Their IDs are kept,
+// so a statement of the same source posted again by the user is stored next
+// to the assigned one rather than replacing it.
+func assignUserCommand(args []string) error {
+	if len(args) < 1 || len(args) > 2 || args[0] == "" {
+		return errors.New("usage: assign-user <user> [tenant]")
+	}
+	user, tenant := args[0], ""
+	if len(args) == 2 {
+		tenant = args[1]
+	}
+	repo, err := statements.OpenFromEnv()
+	if err != nil {
+		return err
+	}
+	ctx := statements.WithAuditInfo(context.Background(), statements.AuditInfo{Actor: "assign-user"})
+
+	list, err := repo.ListStatements(ctx, statements.StatementFilter{})
+	if err != nil {
+		return err
+	}
+	var assigned int
+	for i := range list {
+		if list[i].UserID != "" {
+			continue
+		}
+		list[i].UserID, list[i].TenantID = user, tenant
+		if err := repo.UpsertStatement(ctx, &list[i]); err != nil {
+			return fmt.Errorf("statement %s: %w", list[i].ID, err)
+		}
+		assigned++
+	}
+
+	txs, err := repo.FindTransactions(ctx, statements.TransactionFilter{})
+	if err != nil {
+		return err
+	}
+	var unowned []statements.Transaction
+	for _, tx := range txs {
+		if tx.UserID == "" {
+			tx.UserID, tx.TenantID = user, tenant
+			unowned = append(unowned, tx)
+		}
+	}
+	for batch := range slices.Chunk(unowned, 500) {
+		if err := repo.BulkUpsertTransactions(ctx, batch); err != nil {
+			return err
+		}
+	}
+	slog.Info("Assigned the data without a user", "user", user, "tenant", tenant, "statements", assigned, "transactions", len(unowned))
+	return nil
+}
+
+// mailpollCommand runs the mailbox poller as its own worker, so the mailbox
+// credentials stay away from the API server. With --once it polls once, for
+// cron, and fails when the mailbox cannot be read. Its replicas and those of
+// serve --mode worker take turns: one of them polls at a time.
+func mailpollCommand(args []string) error {
+	fs := flag.NewFlagSet("mailpoll", flag.ExitOnError)
+	once := fs.Bool("once", false, "poll once and exit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	repo, err := statements.OpenFromEnv()
+	if err != nil {
+		return err
+	}
+	if err := statements.CheckSideStores(repo); err != nil {
+		return err
+	}
+	service, err := newStatementsService(repo)
+	if err != nil {
+		return err
+	}
+	poller, err := mailbox.NewPollerFromEnv(service, newIngestRunStore(repo))
+	if err != nil {
+		return err
+	}
+	if poller == nil {
+		return errors.New("MAILBOX_URL is not set")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = ingestContext(ctx)
+	leader := lease.NewLeader(lease.NewStore(repo), "mailbox", time.Duration(envInt("LEASE_TTL_SECONDS", 30))*time.Second)
+	if *once {
+		// held for the poll, released once it is done
+		acquired, err := leader.Store.Acquire(ctx, leader.Name, leader.Holder, time.Hour)
+		if err != nil {
+			return err
+		}
+		if !acquired {
+			slog.Info("Mailbox being polled by another instance")
+			return nil
+		}
+		defer leader.Store.Release(context.WithoutCancel(ctx), leader.Name, leader.Holder)
+		if run := poller.Poll(ctx, time.Now()); run.Error != "" {
+			return errors.New(run.Error)
+		}
+		return nil
+	}
+	leader.Run(ctx, func(ctx context.Context) {
+		poller.Run(ctx, time.Duration(envInt("MAILBOX_INTERVAL_MINUTES", 30))*time.Minute)
+	})
+	return nil
+}
+
+// consumeCommand saves the statements the fetcher publishes to
+// INGEST_QUEUE_URL until it is stopped; messages being saved then are left
+// unacknowledged and delivered again.
+func consumeCommand() error {
+	repo, err := statements.OpenFromEnv()
+	if err != nil {
+		return err
+	}
+	service, err := newStatementsService(repo)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	consumer, err := queue.NewConsumerFromEnv(ctx, service)
+	if err != nil {
+		return err
+	}
+	if consumer == nil {
+		return errors.New("INGEST_QUEUE_URL is not set")
+	}
+	defer consumer.Broker.Close()
+
+	slog.Info("Consuming queued statements")
+	consumer.Run(ingestContext(ctx))
+	return nil
+}
+
+// telegramCommand runs the Telegram bot until it is stopped.
+func telegramCommand() error {
+	repo, err := statements.OpenFromEnv()
+	if err != nil {
+		return err
+	}
+	service, err := newStatementsService(repo)
+	if err != nil {
+		return err
+	}
+	bot, err := telegram.NewBotFromEnv(service)
+	if err != nil {
+		return err
+	}
+	if bot == nil {
+		return errors.New("TELEGRAM_BOT_TOKEN is not set")
 	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	slog.Info("Telegram bot running", "chats", len(bot.Chats))
+	bot.Run(ctx)
+	return nil
 }
 
-func initLogger() {
-	isLocal := os.Getenv("IS_LOCAL") == "true"
+// backupCommand writes a point-in-time archive of every collection of the
+// namespace, see backup.Backup for the consistency guarantees.
+func backupCommand(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := fs.String("out", "", "archive to write, e.g. finchie-backup.tar.gz")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return errors.New("--out is required")
+	}
+	repo, err := statements.NewRepoFromEnv()
+	if err != nil {
+		return err
+	}
+	mongoRepo, ok := statements.AsMongoRepo(repo)
+	if !ok {
+		return errors.New("backups require a MongoDB repository, check MONGO_URI and MONGO_DB")
+	}
+
+	// write next to the target and rename, so a failed backup never replaces a good one
+	tmp, err := os.CreateTemp(filepath.Dir(*out), filepath.Base(*out)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
 
+	manifest, err := backup.Backup(context.Background(), mongoRepo.Database(), mongoRepo.Namespace(), tmp)
+	if err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), *out); err != nil {
+		return err
+	}
+	slog.Info("Backup written", "file", *out, "collections", len(manifest.Collections), "snapshot", manifest.Snapshot)
+	return nil
+}
+
+// restoreCommand replaces the collections of the namespace with an archive and
+// applies the migrations the archive predates. Encrypted archives, the ones the
+// scheduled backups write, are decrypted with BACKUP_ENCRYPTION_KEY.
+func restoreCommand(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := fs.String("in", "", "archive written by the backup command")
+	object := fs.String("object", "", "scheduled backup to fetch from BACKUP_TARGET")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" && *object == "" && fs.NArg() > 0 {
+		*in = fs.Arg(0)
+	}
+	if (*in == "") == (*object == "") {
+		return errors.New("one of --in or --object is required")
+	}
+	key, err := backup.KeyFromEnv()
+	if err != nil {
+		return err
+	}
+	repo, err := statements.NewRepoFromEnv()
+	if err != nil {
+		return err
+	}
+	mongoRepo, ok := statements.AsMongoRepo(repo)
+	if !ok {
+		return errors.New("restores require a MongoDB repository, check MONGO_URI and MONGO_DB")
+	}
+
+	ctx := context.Background()
+	var f io.ReadCloser
+	source := *in
+	if *object != "" {
+		target := os.Getenv("BACKUP_TARGET")
+		if target == "" {
+			return errors.New("--object needs BACKUP_TARGET")
+		}
+		store, err := backup.OpenObjectStore(ctx, target)
+		if err != nil {
+			return err
+		}
+		if f, err = store.Get(ctx, *object); err != nil {
+			return err
+		}
+		source = *object
+	} else if f, err = os.Open(*in); err != nil {
+		return err
+	}
+	defer f.Close()
+
+	archive, err := backup.OpenArchive(f, key)
+	if err != nil {
+		return err
+	}
+	manifest, err := backup.Restore(ctx, mongoRepo.Database(), mongoRepo.Namespace(), archive)
+	if err != nil {
+		return err
+	}
+	slog.Info("Backup restored", "file", source, "created_at", manifest.CreatedAt, "collections", len(manifest.Collections))
+	return migrate(repo, true)
+}
+
+func initLogger(cfg *config.Config) {
+	opts := &slog.HandlerOptions{Level: cfg.Level()}
 	var handler slog.Handler
-	if isLocal {
-		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
+	if cfg.Local {
+		handler = slog.NewTextHandler(os.Stdout, opts)
 	} else {
-		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})
+		handler = slog.NewJSONHandler(os.Stdout, opts)
 	}
 
 	slog.SetDefault(slog.New(handler))
-	slog.Debug("Logger initialized", "isLocal", isLocal)
+	slog.Debug("Logger initialized", "isLocal", cfg.Local, "level", cfg.LogLevel)
+}
+
+// withRequestTimeout bounds the context handed to handlers, so repository calls
+// made on behalf of a request never outlive it. The event stream is left open
+// until the client goes, and the streamed transactions export until it is
+// done; both extend their write deadline as they go.
+func withRequestTimeout(next http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/events" || r.URL.Path == "/api/export/transactions.csv" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// withRequestID gives every request an ID, taken from X-Request-ID or
+// generated, echoes it in the response and tags the logger of the request
+// with it. It is one of the outermost middlewares so the errors and logs of
+// the others carry it too.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = uuid.NewString()
+			r.Header.Set("X-Request-ID", requestID)
+		}
+		w.Header().Set("X-Request-ID", requestID)
+		ctx := accesslog.WithLogger(r.Context(), slog.Default().With("request_id", requestID))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// withRequestInfo tags every request with its ID and the actor named in
+// X-Actor for the audit log.
+func withRequestInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+
+		actor := r.Header.Get("X-Actor")
+		if actor == "" {
+			actor = "api"
+		}
+		ctx := statements.WithAuditInfo(r.Context(), statements.AuditInfo{Actor: actor, RequestID: requestID})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
+
+// startAdminServer serves operator-only endpoints on a separate listener
+// (ADMIN_ADDR, e.g. 127.0.0.1:8081) that should never be exposed publicly.
+// It returns nil without an address.
+func startAdminServer(addr string, mux *http.ServeMux, settings config.Server) *http.Server {
+	if addr == "" {
+		return nil
+	}
+	server := newServer(addr, mux, settings)
+	go func() {
+		slog.Info("Admin server running", "addr", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Admin server failed", "error", err)
+		}
+	}()
+	return server
+}
+
+// newServer is a server of handler on addr with the connection limits of
+// settings.
+func newServer(addr string, handler http.Handler, settings config.Server) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: settings.ReadHeaderTimeout,
+		ReadTimeout:       settings.ReadTimeout,
+		WriteTimeout:      settings.WriteTimeout,
+		IdleTimeout:       settings.IdleTimeout,
+		MaxHeaderBytes:    settings.MaxHeaderBytes,
+	}
+}
+
+func selfCheck(h *health.Handler) {
+	for name, details := range h.Details {
+		attrs := make([]any, 0, len(details)*2+2)
+		attrs = append(attrs, "component", name)
+		for k, v := range details {
+			attrs = append(attrs, k, v)
+		}
+		slog.Info("Startup self-check", attrs...)
+	}
 }
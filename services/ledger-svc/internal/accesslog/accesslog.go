@@ -0,0 +1,108 @@
+// Package accesslog logs a line per API request. Middlewares further in, like
+// authentication, add what they learn about the caller with Add. Handlers log
+// with the Logger of the request, which tags the lines with its request ID.
+package accesslog
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	entryKey  struct{}
+	loggerKey struct{}
+)
+
+// WithLogger stores the logger of the request, see Logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Logger returns the logger of the request, the default one outside a
+// request, e.g. in the workers.
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// entry collects the attributes added while the request is served.
+type entry struct {
+	mu    sync.Mutex
+	attrs []any
+}
+
+// Add logs the key/value pairs with the request, a no-op outside Middleware.
+func Add(ctx context.Context, args ...any) {
+	e, ok := ctx.Value(entryKey{}).(*entry)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.attrs = append(e.attrs, args...)
+}
+
+type recorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the writer, e.g. to flush.
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Middleware logs the method, path, status, size and duration of every
+// request but the health checks, with the caller address and the added
+// attributes, e.g. the user, on the logger of the request.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		e := &entry{}
+		rec := &recorder{ResponseWriter: w}
+		// the path before handlers rewrite it, e.g. to drop a token
+		method, path := r.Method, r.URL.Path
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), entryKey{}, e)))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		args := append([]any{
+			"method", method,
+			"path", path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", r.RemoteAddr,
+		}, e.attrs...)
+		Logger(r.Context()).Info("Request served", args...)
+	})
+}
@@ -0,0 +1,59 @@
+// Package accounts keeps what the statements do not say about a card account,
+// its credit limit, and tracks the credit utilization of every statement
+// cycle against it.
+package accounts
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+var (
+	ErrInvalidAccount = apierror.New(apierror.KindInvalid, "invalid_account", "invalid account")
+	ErrNotFound       = apierror.New(apierror.KindNotFound, "account_not_found", "account not found")
+)
+
+// Account is a credit card account, identified by the source name of its
+// statements.
+type Account struct {
+	ID          string  `bson:"_id" json:"id"`
+	CreditLimit float64 `bson:"credit_limit" json:"credit_limit"`
+	// Threshold overrides the utilization ratio cycles are flagged above,
+	// see Tracker.Threshold.
+	Threshold *float64  `bson:"threshold,omitempty" json:"threshold,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Normalize validates the account.
+func (a *Account) Normalize() error {
+	a.ID = strings.TrimSpace(a.ID)
+	switch {
+	case a.ID == "":
+		return fmt.Errorf("%w: no source name", ErrInvalidAccount)
+	case a.CreditLimit <= 0:
+		return fmt.Errorf("%w: credit_limit must be positive", ErrInvalidAccount)
+	case a.Threshold != nil && (*a.Threshold <= 0 || *a.Threshold > 1):
+		return fmt.Errorf("%w: threshold must be a ratio in (0, 1]", ErrInvalidAccount)
+	}
+	return nil
+}
+
+// Cycle is the utilization of one statement: its balance against the credit
+// limit the account had when the cycle was first recorded.
+type Cycle struct {
+	StatementID string    `bson:"_id" json:"statement_id"`
+	Account     string    `bson:"account" json:"account"`
+	DueDate     time.Time `bson:"due_date" json:"due_date"`
+	Currency    string    `bson:"currency" json:"currency"`
+	Balance     float64   `bson:"balance" json:"balance"`
+	CreditLimit float64   `bson:"credit_limit" json:"credit_limit"`
+	// Utilization is the balance over the limit, 0 for a credit balance.
+	Utilization float64 `bson:"utilization" json:"utilization"`
+	Threshold   float64 `bson:"threshold" json:"threshold"`
+	// Over flags a utilization above the threshold.
+	Over       bool      `bson:"over" json:"over"`
+	RecordedAt time.Time `bson:"recorded_at" json:"recorded_at"`
+}
@@ -0,0 +1,124 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/jsonbody"
+)
+
+type Handler struct {
+	Tracker *Tracker
+}
+
+// ListHandler serves GET /api/accounts.
+func (h *Handler) ListHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Tracker.Store.List(r.Context())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list accounts", "error", err)
+		apierror.Reply(w, "Failed to list accounts", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// SaveHandler serves PUT /api/accounts/{id} with {"credit_limit": ...,
+// "threshold": ...}, the ID being the source name of the card statements. The
+// utilization history is recorded right away.
+func (h *Handler) SaveHandler(w http.ResponseWriter, r *http.Request) {
+	var account Account
+	if err := jsonbody.Decode(w, r, &account); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	account.ID = r.PathValue("id")
+	if err := account.Normalize(); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	account.UpdatedAt = time.Now().UTC()
+	if err := h.Tracker.Store.Save(r.Context(), &account); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to save the account", "id", account.ID, "error", err)
+		apierror.Reply(w, "Failed to save the account", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Tracker.Record(r.Context(), &account); err != nil {
+		// the periodic pass records it later
+		accesslog.Logger(r.Context()).Warn("Failed to record the credit utilization", "account", account.ID, "error", err)
+	}
+	writeJSON(w, http.StatusOK, account)
+}
+
+// DeleteHandler serves DELETE /api/accounts/{id}.
+func (h *Handler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := h.Tracker.Store.Delete(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		apierror.Write(w, err)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to delete the account", "id", id, "error", err)
+		apierror.Reply(w, "Failed to delete the account", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UtilizationHandler serves GET /api/accounts/{id}/utilization, the recorded
+// cycles oldest first; over=true keeps the ones above the threshold.
+func (h *Handler) UtilizationHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	account, err := h.Tracker.Store.Get(r.Context(), id)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to read the account", "id", id, "error", err)
+		apierror.Reply(w, "Failed to read the account", http.StatusInternalServerError)
+		return
+	}
+	if account == nil {
+		apierror.Reply(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	overOnly := false
+	switch r.URL.Query().Get("over") {
+	case "", "false":
+	case "true":
+		overOnly = true
+	default:
+		apierror.Reply(w, "Invalid over parameter, expected true or false", http.StatusBadRequest)
+		return
+	}
+
+	cycles, err := h.Tracker.Store.Cycles(r.Context(), id)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to read the credit utilization", "id", id, "error", err)
+		apierror.Reply(w, "Failed to read the credit utilization", http.StatusInternalServerError)
+		return
+	}
+	if overOnly {
+		kept := cycles[:0]
+		for _, c := range cycles {
+			if c.Over {
+				kept = append(kept, c)
+			}
+		}
+		cycles = kept
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Account *Account `json:"account"`
+		Cycles  []Cycle  `json:"cycles"`
+	}{account, cycles})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
@@ -0,0 +1,100 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps the accounts in the <namespace>accounts collection and the
+// cycles in <namespace>credit_utilization, keyed by statement ID.
+type MongoStore struct {
+	accounts *mongo.Collection
+	cycles   *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database, namespace string) *MongoStore {
+	return &MongoStore{
+		accounts: db.Collection(namespace + "accounts"),
+		cycles:   db.Collection(namespace + "credit_utilization"),
+	}
+}
+
+func (s *MongoStore) List(ctx context.Context) ([]Account, error) {
+	cursor, err := s.accounts.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	list := []Account{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *MongoStore) Get(ctx context.Context, id string) (*Account, error) {
+	var account Account
+	err := s.accounts.FindOne(ctx, bson.M{"_id": id}).Decode(&account)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (s *MongoStore) Save(ctx context.Context, account *Account) error {
+	_, err := s.accounts.ReplaceOne(ctx, bson.M{"_id": account.ID}, account, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoStore) Delete(ctx context.Context, id string) error {
+	result, err := s.accounts.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	_, err = s.cycles.DeleteMany(ctx, bson.M{"account": id})
+	return err
+}
+
+func (s *MongoStore) Cycles(ctx context.Context, account string) ([]Cycle, error) {
+	cursor, err := s.cycles.Find(ctx, bson.M{"account": account},
+		options.Find().SetSort(bson.D{{Key: "due_date", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	cycles := []Cycle{}
+	if err := cursor.All(ctx, &cycles); err != nil {
+		return nil, err
+	}
+	return cycles, nil
+}
+
+// ReplaceCycles deletes before inserting, like the merchant rollup.
+func (s *MongoStore) ReplaceCycles(ctx context.Context, account string, cycles []Cycle) error {
+	_, err := s.cycles.DeleteMany(ctx, bson.M{"account": account})
+	if err != nil || len(cycles) == 0 {
+		return err
+	}
+
+	models := make([]mongo.WriteModel, len(cycles))
+	for i := range cycles {
+		models[i] = mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": cycles[i].StatementID}).
+			SetReplacement(cycles[i]).
+			SetUpsert(true)
+	}
+	_, err = s.cycles.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
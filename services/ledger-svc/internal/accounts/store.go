@@ -0,0 +1,114 @@
+package accounts
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Store keeps the accounts and their utilization history.
+type Store interface {
+	List(ctx context.Context) ([]Account, error)
+	// Get returns nil when the account does not exist.
+	Get(ctx context.Context, id string) (*Account, error)
+	// Save creates or replaces the account by ID.
+	Save(ctx context.Context, account *Account) error
+	// Delete removes the account with its history, ErrNotFound when it does
+	// not exist.
+	Delete(ctx context.Context, id string) error
+
+	// Cycles returns the history of the account, oldest due date first.
+	Cycles(ctx context.Context, account string) ([]Cycle, error)
+	// ReplaceCycles swaps the history of the account for cycles.
+	ReplaceCycles(ctx context.Context, account string, cycles []Cycle) error
+}
+
+// NewStore keeps the accounts next to the statements in MongoDB, or in memory
+// for the memory driver.
+func NewStore(repo statements.StatementRepository) Store {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryStore()
+}
+
+type MemoryStore struct {
+	mu       sync.RWMutex
+	accounts map[string]Account
+	cycles   map[string][]Cycle
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{accounts: make(map[string]Account), cycles: make(map[string][]Cycle)}
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Account, 0, len(s.accounts))
+	for _, a := range s.accounts {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.accounts[id]
+	if !ok {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, account *Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accounts[account.ID] = *account
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accounts[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.accounts, id)
+	delete(s.cycles, id)
+	return nil
+}
+
+func (s *MemoryStore) Cycles(ctx context.Context, account string) ([]Cycle, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cycles := append([]Cycle{}, s.cycles[account]...)
+	sortCycles(cycles)
+	return cycles, nil
+}
+
+func (s *MemoryStore) ReplaceCycles(ctx context.Context, account string, cycles []Cycle) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cycles[account] = append([]Cycle(nil), cycles...)
+	return nil
+}
+
+func sortCycles(cycles []Cycle) {
+	sort.Slice(cycles, func(i, j int) bool {
+		if !cycles[i].DueDate.Equal(cycles[j].DueDate) {
+			return cycles[i].DueDate.Before(cycles[j].DueDate)
+		}
+		return cycles[i].StatementID < cycles[j].StatementID
+	})
+}
@@ -0,0 +1,150 @@
+package accounts
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// DefaultThreshold is the utilization credit scores are commonly said to
+// suffer above.
+const DefaultThreshold = 0.3
+
+// Tracker records the utilization of the statement cycles of the accounts
+// from the change events, with a periodic pass for the events it missed.
+type Tracker struct {
+	Repo  statements.StatementRepository
+	Store Store
+	// Threshold is the utilization ratio cycles are flagged above, unless
+	// the account sets its own.
+	Threshold float64
+
+	mu sync.Mutex
+}
+
+// NewTrackerFromEnv reads UTILIZATION_THRESHOLD, a ratio, 0.3 by default.
+func NewTrackerFromEnv(repo statements.StatementRepository) *Tracker {
+	threshold, err := strconv.ParseFloat(os.Getenv("UTILIZATION_THRESHOLD"), 64)
+	if err != nil || threshold <= 0 || threshold > 1 {
+		threshold = DefaultThreshold
+	}
+	return &Tracker{Repo: repo, Store: NewStore(repo), Threshold: threshold}
+}
+
+// Run records every account now and then every interval.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := t.RecordAll(ctx); err != nil {
+			slog.Warn("Failed to record the credit utilization", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Publish makes the tracker an events sink: a statement event records the
+// account of the statement.
+func (t *Tracker) Publish(ctx context.Context, event statements.ChangeEvent) error {
+	switch event.Type {
+	case statements.EventStatementCreated, statements.EventStatementUpdated, statements.EventStatementPaid:
+	default:
+		return nil
+	}
+	stmt := event.Statement
+	if stmt == nil {
+		var err error
+		if stmt, err = t.Repo.GetStatement(ctx, event.StatementID); err != nil || stmt == nil {
+			return err
+		}
+	}
+	account, err := t.Store.Get(ctx, stmt.SourceName)
+	if err != nil || account == nil {
+		return err
+	}
+	return t.Record(ctx, account)
+}
+
+func (t *Tracker) RecordAll(ctx context.Context) error {
+	list, err := t.Store.List(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		if err := t.Record(ctx, &list[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Record computes the cycles of the account from its credit card statements.
+// A cycle keeps the limit it was recorded with while its balance is
+// unchanged, so raising the limit does not rewrite the history.
+func (t *Tracker) Record(ctx context.Context, account *Account) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stmts, err := t.Repo.ListStatements(ctx, statements.StatementFilter{SourceName: account.ID})
+	if err != nil {
+		return err
+	}
+	stored, err := t.Store.Cycles(ctx, account.ID)
+	if err != nil {
+		return err
+	}
+	previous := make(map[string]Cycle, len(stored))
+	for _, c := range stored {
+		previous[c.StatementID] = c
+	}
+
+	threshold := t.Threshold
+	if account.Threshold != nil {
+		threshold = *account.Threshold
+	}
+	now := time.Now().UTC()
+	cycles := make([]Cycle, 0, len(stmts))
+	for i := range stmts {
+		stmt := &stmts[i]
+		if stmt.SourceType == statements.BankAccount || stmt.PaymentDueDate == nil {
+			continue
+		}
+		balance := money.Round(stmt.TotalAmount)
+		cycle := Cycle{
+			StatementID: stmt.ID,
+			Account:     account.ID,
+			DueDate:     stmt.PaymentDueDate.UTC(),
+			Currency:    stmt.Currency,
+			Balance:     balance,
+			CreditLimit: account.CreditLimit,
+			RecordedAt:  now,
+		}
+		if c, ok := previous[stmt.ID]; ok && c.Balance == balance {
+			cycle.CreditLimit, cycle.RecordedAt = c.CreditLimit, c.RecordedAt
+		}
+		cycle.Utilization = math.Round(math.Max(balance, 0)/cycle.CreditLimit*10000) / 10000
+		cycle.Threshold = threshold
+		cycle.Over = cycle.Utilization > threshold
+		cycles = append(cycles, cycle)
+	}
+	sortCycles(cycles)
+	if err := t.Store.ReplaceCycles(ctx, account.ID, cycles); err != nil {
+		return err
+	}
+	if n := len(cycles); n > 0 && cycles[n-1].Over && !previous[cycles[n-1].StatementID].Over {
+		slog.Info("Credit utilization above the threshold", "account", account.ID,
+			"statement_id", cycles[n-1].StatementID, "utilization", cycles[n-1].Utilization, "threshold", threshold)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/authz"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/ingest"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/jsonbody"
+)
+
+// maxWebhookBody bounds the webhook bodies read.
+const maxWebhookBody = 1 << 20
+
+type Handler struct {
+	Syncer *Syncer
+}
+
+// ProvidersHandler serves GET /api/aggregator/providers, the configured
+// aggregators.
+func (h *Handler) ProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	for _, name := range Providers() {
+		if _, ok := h.Syncer.Providers[name]; ok {
+			names = append(names, name)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"providers": names})
+}
+
+// LinkTokenHandler serves POST /api/aggregator/providers/{provider}/link_token,
+// the token the frontend opens the aggregator's link flow with. The user is
+// the X-Actor identity.
+func (h *Handler) LinkTokenHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.provider(w, r)
+	if !ok {
+		return
+	}
+	user := r.Header.Get(authz.SubjectHeader)
+	if user == "" {
+		user = "default"
+	}
+	token, err := provider.LinkToken(r.Context(), user)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to create a link token", "provider", r.PathValue("provider"), "error", err)
+		apierror.Reply(w, "Failed to create a link token", http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, token)
+}
+
+// ConnectHandler serves POST /api/aggregator/providers/{provider}/connections
+// with {"public_token": ...}, the token of a completed link. The first sync
+// runs in the background, the aggregator may still be pulling the history.
+func (h *Handler) ConnectHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.provider(w, r); !ok {
+		return
+	}
+	var req struct {
+		PublicToken string `json:"public_token"`
+	}
+	if err := jsonbody.Decode(w, r, &req); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	if req.PublicToken == "" {
+		apierror.Write(w, jsonbody.Invalid("Invalid link payload", ingest.ValidationError{Path: "$.public_token", Message: "is required"}))
+		return
+	}
+	conn, err := h.Syncer.Link(r.Context(), r.PathValue("provider"), req.PublicToken)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to link the item", "provider", r.PathValue("provider"), "error", err)
+		apierror.Reply(w, "Failed to link the item", http.StatusBadGateway)
+		return
+	}
+	go h.Syncer.SyncConnection(context.Background(), conn.ID)
+	writeJSON(w, http.StatusCreated, conn)
+}
+
+// WebhookHandler serves POST /api/aggregator/providers/{provider}/webhooks,
+// the aggregator's notifications. The sync they ask for runs in the
+// background, aggregators retry calls that are not answered quickly.
+func (h *Handler) WebhookHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.provider(w, r)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		apierror.Reply(w, "Failed to read the webhook", http.StatusBadRequest)
+		return
+	}
+	event, err := provider.Webhook(r.Context(), r.Header, body)
+	if errors.Is(err, ErrInvalidWebhook) {
+		accesslog.Logger(r.Context()).Warn("Rejected an aggregator webhook", "provider", r.PathValue("provider"), "error", err)
+		apierror.Reply(w, "Invalid webhook", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to verify the aggregator webhook", "provider", r.PathValue("provider"), "error", err)
+		apierror.Reply(w, "Failed to verify the webhook", http.StatusInternalServerError)
+		return
+	}
+
+	name := r.PathValue("provider")
+	go func() {
+		if err := h.Syncer.Notify(context.Background(), name, event); err != nil {
+			accesslog.Logger(r.Context()).Warn("Failed to sync after an aggregator webhook", "provider", name, "item", event.ItemID, "error", err)
+		}
+	}()
+	w.WriteHeader(http.StatusOK)
+}
+
+// ListHandler serves GET /api/aggregator/connections, without the tokens.
+func (h *Handler) ListHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Syncer.Connections(r.Context())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list the aggregator connections", "error", err)
+		apierror.Reply(w, "Failed to list the connections", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// GetHandler serves GET /api/aggregator/connections/{id}.
+func (h *Handler) GetHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	conn, err := h.Syncer.Connection(r.Context(), id)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to read the aggregator connection", "id", id, "error", err)
+		apierror.Reply(w, "Failed to read the connection", http.StatusInternalServerError)
+		return
+	}
+	if conn == nil {
+		apierror.Reply(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, conn)
+}
+
+// DeleteHandler serves DELETE /api/aggregator/connections/{id}, revoking the
+// access token. The synced statements stay.
+func (h *Handler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := h.Syncer.Unlink(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		apierror.Write(w, err)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to delete the aggregator connection", "id", id, "error", err)
+		apierror.Reply(w, "Failed to delete the connection", http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SyncHandler serves POST /api/aggregator/connections/{id}/sync, syncing the
+// connection now and answering with the ingest run.
+func (h *Handler) SyncHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	run, err := h.Syncer.SyncConnection(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		apierror.Write(w, err)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to sync the aggregator connection", "id", id, "error", err)
+		apierror.Reply(w, "Failed to sync the connection", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+func (h *Handler) provider(w http.ResponseWriter, r *http.Request) (Provider, bool) {
+	provider, err := h.Syncer.provider(r.PathValue("provider"))
+	if err != nil {
+		apierror.Reply(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return provider, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
@@ -0,0 +1,105 @@
+package aggregator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterProvider("mock", func() (Provider, error) {
+		if os.Getenv("AGGREGATOR_MOCK") != "true" {
+			return nil, nil
+		}
+		return Mock{Now: time.Now}, nil
+	})
+}
+
+// Mock is an aggregator without a bank behind it, for developing the link
+// flow in the frontend: any public token links a checking account and a card
+// that spend every day. The cursor is the last day synced.
+type Mock struct {
+	Now func() time.Time
+}
+
+var mockMerchants = []string{"Coffee Shop", "Grocery Store", "Gas Station", "Bookstore", "Pharmacy", "Restaurant"}
+
+func (m Mock) LinkToken(ctx context.Context, user string) (*LinkToken, error) {
+	return &LinkToken{Token: "link-mock-" + user, Expiration: m.Now().UTC().Add(4 * time.Hour)}, nil
+}
+
+func (m Mock) Exchange(ctx context.Context, publicToken string) (*Item, error) {
+	if publicToken == "" {
+		return nil, errors.New("empty public token")
+	}
+	return &Item{ID: "item-" + publicToken, AccessToken: "access-mock-" + publicToken, Institution: "Mock Bank"}, nil
+}
+
+func (m Mock) Accounts(ctx context.Context, accessToken string) ([]Account, error) {
+	item, ok := strings.CutPrefix(accessToken, "access-mock-")
+	if !ok {
+		return nil, errors.New("invalid access token")
+	}
+	return []Account{
+		{ID: "checking-" + item, Name: "Mock Checking", Mask: "0000", Type: "depository", Subtype: "checking", Currency: "USD"},
+		{ID: "card-" + item, Name: "Mock Card", Mask: "1111", Type: "credit", Subtype: "credit card", Currency: "USD"},
+	}, nil
+}
+
+// Sync returns a transaction per account and day after the cursor, starting
+// 30 days ago, up to yesterday.
+func (m Mock) Sync(ctx context.Context, accessToken, cursor string) (*Changes, error) {
+	accounts, err := m.Accounts(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	today := m.Now().UTC().Truncate(24 * time.Hour)
+	day := today.AddDate(0, 0, -30)
+	if cursor != "" {
+		last, err := time.Parse(time.DateOnly, cursor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor %q", cursor)
+		}
+		day = last.AddDate(0, 0, 1)
+	}
+
+	changes := &Changes{Cursor: cursor}
+	for ; day.Before(today); day = day.AddDate(0, 0, 1) {
+		for _, account := range accounts {
+			id := accessToken + "|" + account.ID + "|" + day.Format(time.DateOnly)
+			sum := sha256.Sum256([]byte(id))
+			changes.Added = append(changes.Added, Transaction{
+				ID:          fmt.Sprintf("%x", sum[:8]),
+				AccountID:   account.ID,
+				Date:        day,
+				Description: mockMerchants[sum[8]%byte(len(mockMerchants))],
+				Amount:      float64(binary.BigEndian.Uint16(sum[9:])%10000) / 100,
+				Currency:    account.Currency,
+			})
+		}
+		changes.Cursor = day.Format(time.DateOnly)
+	}
+	return changes, nil
+}
+
+func (Mock) Remove(ctx context.Context, accessToken string) error {
+	return nil
+}
+
+// Webhook reads {"item_id": ...} unsigned.
+func (Mock) Webhook(ctx context.Context, header http.Header, body []byte) (*WebhookEvent, error) {
+	var payload struct {
+		ItemID string `json:"item_id"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.ItemID == "" {
+		return nil, ErrInvalidWebhook
+	}
+	return &WebhookEvent{ItemID: payload.ItemID, Sync: true}, nil
+}
@@ -0,0 +1,70 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps the connections in the <namespace>aggregator_connections
+// collection.
+type MongoStore struct {
+	connections *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database, namespace string) *MongoStore {
+	return &MongoStore{connections: db.Collection(namespace + "aggregator_connections")}
+}
+
+func (s *MongoStore) List(ctx context.Context) ([]Connection, error) {
+	cursor, err := s.connections.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	list := []Connection{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *MongoStore) Get(ctx context.Context, id string) (*Connection, error) {
+	return s.findOne(ctx, bson.M{"_id": id})
+}
+
+func (s *MongoStore) FindItem(ctx context.Context, provider, itemID string) (*Connection, error) {
+	return s.findOne(ctx, bson.M{"provider": provider, "item_id": itemID})
+}
+
+func (s *MongoStore) findOne(ctx context.Context, filter bson.M) (*Connection, error) {
+	var conn Connection
+	err := s.connections.FindOne(ctx, filter).Decode(&conn)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &conn, nil
+}
+
+func (s *MongoStore) Save(ctx context.Context, conn *Connection) error {
+	_, err := s.connections.ReplaceOne(ctx, bson.M{"_id": conn.ID}, conn, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoStore) Delete(ctx context.Context, id string) error {
+	res, err := s.connections.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package aggregator
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterProvider("plaid", newPlaidFromEnv)
+}
+
+var plaidHosts = map[string]string{
+	"sandbox":    "https://sandbox.plaid.com",
+	"production": "https://production.plaid.com",
+}
+
+// Plaid links institutions through Plaid Link and pulls their transactions
+// with /transactions/sync.
+type Plaid struct {
+	BaseURL  string
+	ClientID string
+	Secret   string
+	// ClientName is shown to the user in Link.
+	ClientName   string
+	CountryCodes []string
+	// WebhookURL is where Plaid notifies new transactions, the
+	// /api/aggregator/providers/plaid/webhooks endpoint as the internet
+	// reaches it; empty relies on the scheduled sync alone.
+	WebhookURL string
+	Client     *http.Client
+	Now        func() time.Time
+
+	keysMu sync.Mutex
+	// keys caches the webhook verification keys by key ID.
+	keys map[string]*ecdsa.PublicKey
+}
+
+// newPlaidFromEnv reads PLAID_CLIENT_ID and PLAID_SECRET, PLAID_ENV, sandbox
+// by default, PLAID_COUNTRY_CODES, US by default, and PLAID_WEBHOOK_URL.
+func newPlaidFromEnv() (Provider, error) {
+	clientID := os.Getenv("PLAID_CLIENT_ID")
+	if clientID == "" {
+		return nil, nil
+	}
+	secret := os.Getenv("PLAID_SECRET")
+	if secret == "" {
+		return nil, errors.New("PLAID_CLIENT_ID needs PLAID_SECRET")
+	}
+	env := os.Getenv("PLAID_ENV")
+	if env == "" {
+		env = "sandbox"
+	}
+	host, ok := plaidHosts[env]
+	if !ok {
+		return nil, fmt.Errorf("invalid PLAID_ENV %q, expected sandbox or production", env)
+	}
+	countries := []string{"US"}
+	if v := os.Getenv("PLAID_COUNTRY_CODES"); v != "" {
+		countries = strings.Split(strings.ReplaceAll(strings.ToUpper(v), " ", ""), ",")
+	}
+	return &Plaid{
+		BaseURL:      host,
+		ClientID:     clientID,
+		Secret:       secret,
+		ClientName:   "Finchie",
+		CountryCodes: countries,
+		WebhookURL:   os.Getenv("PLAID_WEBHOOK_URL"),
+		Client:       &http.Client{Timeout: 30 * time.Second},
+		Now:          time.Now,
+	}, nil
+}
+
+// PlaidError is an error response of the Plaid API.
+type PlaidError struct {
+	Status    int    `json:"-"`
+	Type      string `json:"error_type"`
+	Code      string `json:"error_code"`
+	Message   string `json:"error_message"`
+	RequestID string `json:"request_id"`
+}
+
+func (e *PlaidError) Error() string {
+	return fmt.Sprintf("plaid %s %s: %s (request %s)", e.Type, e.Code, e.Message, e.RequestID)
+}
+
+// call posts the request with the credentials to the endpoint and decodes
+// the response into resp.
+func (p *Plaid) call(ctx context.Context, endpoint string, req map[string]any, resp any) error {
+	req["client_id"], req["secret"] = p.ClientID, p.Secret
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.BaseURL+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpResp, err := p.Client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(httpResp.Body, 32<<20))
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		plaidErr := &PlaidError{Status: httpResp.StatusCode}
+		if err := json.Unmarshal(data, plaidErr); err != nil || plaidErr.Code == "" {
+			return fmt.Errorf("plaid %s: %s", endpoint, httpResp.Status)
+		}
+		return plaidErr
+	}
+	return json.Unmarshal(data, resp)
+}
+
+func (p *Plaid) LinkToken(ctx context.Context, user string) (*LinkToken, error) {
+	req := map[string]any{
+		"client_name":   p.ClientName,
+		"language":      "en",
+		"country_codes": p.CountryCodes,
+		"products":      []string{"transactions"},
+		"user":          map[string]string{"client_user_id": user},
+	}
+	if p.WebhookURL != "" {
+		req["webhook"] = p.WebhookURL
+	}
+	var resp struct {
+		LinkToken  string    `json:"link_token"`
+		Expiration time.Time `json:"expiration"`
+	}
+	if err := p.call(ctx, "/link/token/create", req, &resp); err != nil {
+		return nil, err
+	}
+	return &LinkToken{Token: resp.LinkToken, Expiration: resp.Expiration}, nil
+}
+
+// Exchange also looks up the name of the institution, which the statements
+// are named after.
+func (p *Plaid) Exchange(ctx context.Context, publicToken string) (*Item, error) {
+	var exchanged struct {
+		AccessToken string `json:"access_token"`
+		ItemID      string `json:"item_id"`
+	}
+	if err := p.call(ctx, "/item/public_token/exchange", map[string]any{"public_token": publicToken}, &exchanged); err != nil {
+		return nil, err
+	}
+	item := &Item{ID: exchanged.ItemID, AccessToken: exchanged.AccessToken}
+
+	var got struct {
+		Item struct {
+			InstitutionID string `json:"institution_id"`
+		} `json:"item"`
+	}
+	if err := p.call(ctx, "/item/get", map[string]any{"access_token": item.AccessToken}, &got); err != nil {
+		return nil, err
+	}
+	if got.Item.InstitutionID == "" {
+		return item, nil
+	}
+	var institution struct {
+		Institution struct {
+			Name string `json:"name"`
+		} `json:"institution"`
+	}
+	if err := p.call(ctx, "/institutions/get_by_id", map[string]any{
+		"institution_id": got.Item.InstitutionID,
+		"country_codes":  p.CountryCodes,
+	}, &institution); err != nil {
+		return nil, err
+	}
+	item.Institution = institution.Institution.Name
+	return item, nil
+}
+
+type plaidAccount struct {
+	AccountID string `json:"account_id"`
+	Name      string `json:"name"`
+	Mask      string `json:"mask"`
+	Type      string `json:"type"`
+	Subtype   string `json:"subtype"`
+	Balances  struct {
+		Current                *float64 `json:"current"`
+		ISOCurrencyCode        string   `json:"iso_currency_code"`
+		UnofficialCurrencyCode string   `json:"unofficial_currency_code"`
+	} `json:"balances"`
+}
+
+func (p *Plaid) Accounts(ctx context.Context, accessToken string) ([]Account, error) {
+	var resp struct {
+		Accounts []plaidAccount `json:"accounts"`
+	}
+	if err := p.call(ctx, "/accounts/get", map[string]any{"access_token": accessToken}, &resp); err != nil {
+		return nil, err
+	}
+	accounts := make([]Account, len(resp.Accounts))
+	for i, a := range resp.Accounts {
+		accounts[i] = Account{
+			ID:       a.AccountID,
+			Name:     a.Name,
+			Mask:     a.Mask,
+			Type:     a.Type,
+			Subtype:  a.Subtype,
+			Currency: currency(a.Balances.ISOCurrencyCode, a.Balances.UnofficialCurrencyCode),
+			Balance:  a.Balances.Current,
+		}
+	}
+	return accounts, nil
+}
+
+func currency(iso, unofficial string) string {
+	if iso != "" {
+		return iso
+	}
+	return unofficial
+}
+
+type plaidTransaction struct {
+	TransactionID          string  `json:"transaction_id"`
+	AccountID              string  `json:"account_id"`
+	Amount                 float64 `json:"amount"`
+	ISOCurrencyCode        string  `json:"iso_currency_code"`
+	UnofficialCurrencyCode string  `json:"unofficial_currency_code"`
+	Date                   string  `json:"date"`
+	Name                   string  `json:"name"`
+	MerchantName           string  `json:"merchant_name"`
+	Pending                bool    `json:"pending"`
+	Location               struct {
+		City    string `json:"city"`
+		Country string `json:"country"`
+	} `json:"location"`
+	PersonalFinanceCategory *struct {
+		Primary string `json:"primary"`
+	} `json:"personal_finance_category"`
+}
+
+// transaction converts a Plaid transaction, which is already signed as the
+// ledger signs them: positive amounts leave the account.
+func (t plaidTransaction) transaction() (Transaction, error) {
+	date, err := time.Parse(time.DateOnly, t.Date)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("transaction %s: invalid date %q", t.TransactionID, t.Date)
+	}
+	tx := Transaction{
+		ID:           t.TransactionID,
+		AccountID:    t.AccountID,
+		Date:         date,
+		Description:  t.Name,
+		MerchantName: t.MerchantName,
+		City:         t.Location.City,
+		Country:      t.Location.Country,
+		Amount:       t.Amount,
+		Currency:     currency(t.ISOCurrencyCode, t.UnofficialCurrencyCode),
+		Pending:      t.Pending,
+	}
+	if t.PersonalFinanceCategory != nil {
+		tx.Category = t.PersonalFinanceCategory.Primary
+	}
+	return tx, nil
+}
+
+// plaidSyncRestarts bounds how often a sync starts over because the
+// transactions changed while it paged through them.
+const plaidSyncRestarts = 3
+
+func (p *Plaid) Sync(ctx context.Context, accessToken, cursor string) (*Changes, error) {
+	for attempt := 0; ; attempt++ {
+		changes, err := p.sync(ctx, accessToken, cursor)
+		var plaidErr *PlaidError
+		if errors.As(err, &plaidErr) && plaidErr.Code == "TRANSACTIONS_SYNC_MUTATION_DURING_PAGINATION" && attempt < plaidSyncRestarts {
+			continue
+		}
+		return changes, err
+	}
+}
+
+func (p *Plaid) sync(ctx context.Context, accessToken, cursor string) (*Changes, error) {
+	changes := &Changes{Cursor: cursor}
+	for {
+		req := map[string]any{"access_token": accessToken, "count": 500}
+		if changes.Cursor != "" {
+			req["cursor"] = changes.Cursor
+		}
+		var resp struct {
+			Added    []plaidTransaction `json:"added"`
+			Modified []plaidTransaction `json:"modified"`
+			Removed  []struct {
+				TransactionID string `json:"transaction_id"`
+			} `json:"removed"`
+			NextCursor string `json:"next_cursor"`
+			HasMore    bool   `json:"has_more"`
+		}
+		if err := p.call(ctx, "/transactions/sync", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, t := range resp.Added {
+			tx, err := t.transaction()
+			if err != nil {
+				return nil, err
+			}
+			changes.Added = append(changes.Added, tx)
+		}
+		for _, t := range resp.Modified {
+			tx, err := t.transaction()
+			if err != nil {
+				return nil, err
+			}
+			changes.Modified = append(changes.Modified, tx)
+		}
+		for _, r := range resp.Removed {
+			changes.Removed = append(changes.Removed, r.TransactionID)
+		}
+		changes.Cursor = resp.NextCursor
+		if !resp.HasMore {
+			return changes, nil
+		}
+	}
+}
+
+func (p *Plaid) Remove(ctx context.Context, accessToken string) error {
+	var resp struct{}
+	return p.call(ctx, "/item/remove", map[string]any{"access_token": accessToken}, &resp)
+}
@@ -0,0 +1,142 @@
+package aggregator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// plaidWebhookMaxAge is how old the signature of a webhook may be.
+const plaidWebhookMaxAge = 5 * time.Minute
+
+// Webhook verifies the Plaid-Verification header, an ES256 JWT over the
+// SHA-256 of the body signed with a key /webhook_verification_key/get serves,
+// and reads the item. Only the transactions webhooks ask for a sync.
+func (p *Plaid) Webhook(ctx context.Context, header http.Header, body []byte) (*WebhookEvent, error) {
+	if err := p.verify(ctx, header.Get("Plaid-Verification"), body); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	var payload struct {
+		Type   string `json:"webhook_type"`
+		Code   string `json:"webhook_code"`
+		ItemID string `json:"item_id"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.ItemID == "" {
+		return nil, fmt.Errorf("%w: no item", ErrInvalidWebhook)
+	}
+	return &WebhookEvent{
+		ItemID: payload.ItemID,
+		Sync:   payload.Type == "TRANSACTIONS" && payload.Code == "SYNC_UPDATES_AVAILABLE",
+	}, nil
+}
+
+func (p *Plaid) verify(ctx context.Context, token string, body []byte) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("missing or malformed Plaid-Verification header")
+	}
+	var head struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &head); err != nil {
+		return err
+	}
+	if head.Alg != "ES256" {
+		return fmt.Errorf("unexpected algorithm %q", head.Alg)
+	}
+	key, err := p.verificationKey(ctx, head.Kid)
+	if err != nil {
+		return err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		return errors.New("malformed signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(key, digest[:], r, s) {
+		return errors.New("signature does not verify")
+	}
+
+	var claims struct {
+		IssuedAt   int64  `json:"iat"`
+		BodySHA256 string `json:"request_body_sha256"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return err
+	}
+	if age := p.Now().Sub(time.Unix(claims.IssuedAt, 0)); age > plaidWebhookMaxAge || age < -plaidWebhookMaxAge {
+		return fmt.Errorf("signed %s ago", age.Round(time.Second))
+	}
+	sum := sha256.Sum256(body)
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(claims.BodySHA256)) != 1 {
+		return errors.New("body does not match the signature")
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errors.New("malformed JWT segment")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.New("malformed JWT segment")
+	}
+	return nil
+}
+
+// verificationKey returns the P-256 key of the ID, fetched once. Plaid
+// rotates the keys, a new ID is fetched when a webhook names it.
+func (p *Plaid) verificationKey(ctx context.Context, kid string) (*ecdsa.PublicKey, error) {
+	p.keysMu.Lock()
+	defer p.keysMu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	var resp struct {
+		Key struct {
+			Crv       string `json:"crv"`
+			X         string `json:"x"`
+			Y         string `json:"y"`
+			ExpiredAt *int64 `json:"expired_at"`
+		} `json:"key"`
+	}
+	if err := p.call(ctx, "/webhook_verification_key/get", map[string]any{"key_id": kid}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Key.ExpiredAt != nil {
+		return nil, fmt.Errorf("key %s expired", kid)
+	}
+	if resp.Key.Crv != "P-256" {
+		return nil, fmt.Errorf("key %s is on curve %q, expected P-256", kid, resp.Key.Crv)
+	}
+	x, errX := base64.RawURLEncoding.DecodeString(resp.Key.X)
+	y, errY := base64.RawURLEncoding.DecodeString(resp.Key.Y)
+	if errX != nil || errY != nil {
+		return nil, fmt.Errorf("malformed key %s", kid)
+	}
+	key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		return nil, fmt.Errorf("malformed key %s", kid)
+	}
+	if p.keys == nil {
+		p.keys = map[string]*ecdsa.PublicKey{}
+	}
+	p.keys[kid] = key
+	return key, nil
+}
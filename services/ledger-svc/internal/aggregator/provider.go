@@ -0,0 +1,153 @@
+// Package aggregator connects bank accounts through aggregators like Plaid.
+// The frontend links an institution with a link token, the connection keeps
+// the access token the aggregator issues, and the Syncer pulls the accounts'
+// transactions into the ledger on a schedule and when the aggregator notifies
+// a webhook.
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+// Provider is one aggregator.
+type Provider interface {
+	// LinkToken starts linking an institution for the user in the frontend.
+	LinkToken(ctx context.Context, user string) (*LinkToken, error)
+	// Exchange trades the public token the frontend got from a completed link
+	// for the item's access token.
+	Exchange(ctx context.Context, publicToken string) (*Item, error)
+	Accounts(ctx context.Context, accessToken string) ([]Account, error)
+	// Sync returns the transaction changes since the cursor, all pages of
+	// them; an empty cursor starts from the history the aggregator has.
+	Sync(ctx context.Context, accessToken, cursor string) (*Changes, error)
+	// Remove revokes the access token.
+	Remove(ctx context.Context, accessToken string) error
+	// Webhook verifies a webhook call and reads the item it is about.
+	Webhook(ctx context.Context, header http.Header, body []byte) (*WebhookEvent, error)
+}
+
+type LinkToken struct {
+	Token      string    `json:"link_token"`
+	Expiration time.Time `json:"expiration"`
+}
+
+// Item is a linked login at an institution.
+type Item struct {
+	ID          string
+	AccessToken string
+	Institution string
+}
+
+type Account struct {
+	ID   string `bson:"id" json:"id"`
+	Name string `bson:"name" json:"name"`
+	// Mask is the end of the account number, e.g. the last four digits.
+	Mask string `bson:"mask,omitempty" json:"mask,omitempty"`
+	// Type is depository, credit, loan or investment, as Plaid names them.
+	Type     string   `bson:"type" json:"type"`
+	Subtype  string   `bson:"subtype,omitempty" json:"subtype,omitempty"`
+	Currency string   `bson:"currency" json:"currency"`
+	Balance  *float64 `bson:"balance,omitempty" json:"balance,omitempty"`
+}
+
+// Transaction is signed as the ledger signs them, money leaving the account
+// is positive.
+type Transaction struct {
+	ID           string
+	AccountID    string
+	Date         time.Time
+	Description  string
+	MerchantName string
+	City         string
+	Country      string
+	Category     string
+	Amount       float64
+	Currency     string
+	// Pending transactions are removed and added again once they post.
+	Pending bool
+}
+
+type Changes struct {
+	Added    []Transaction
+	Modified []Transaction
+	Removed  []string
+	Cursor   string
+}
+
+// WebhookEvent is a webhook call. Sync is set when the item has new or
+// changed transactions to pull.
+type WebhookEvent struct {
+	ItemID string
+	Sync   bool
+}
+
+var (
+	ErrUnknownProvider = apierror.New(apierror.KindNotFound, "unknown_aggregator", "unknown aggregator")
+	ErrInvalidWebhook  = apierror.New(apierror.KindInvalid, "invalid_webhook", "invalid webhook")
+	ErrNotFound        = apierror.New(apierror.KindNotFound, "connection_not_found", "connection not found")
+	ErrNoTokenKey      = errors.New("the access token is encrypted, set AGGREGATOR_TOKEN_KEY")
+)
+
+// Factory builds a provider from the environment, nil when the provider is
+// not configured. Providers register themselves from an init function.
+type Factory func() (Provider, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// RegisterProvider makes an aggregator available. It panics when the name is
+// already taken, like statements.RegisterDriver.
+func RegisterProvider(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("aggregator: RegisterProvider factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("aggregator: RegisterProvider called twice for provider " + name)
+	}
+	factories[name] = factory
+}
+
+// Providers returns the names of the registered aggregators.
+func Providers() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenProvidersFromEnv builds the configured aggregators by name.
+func OpenProvidersFromEnv() (map[string]Provider, error) {
+	providers := map[string]Provider{}
+	for _, name := range Providers() {
+		factoriesMu.RLock()
+		factory := factories[name]
+		factoriesMu.RUnlock()
+
+		provider, err := factory()
+		if err != nil {
+			return nil, fmt.Errorf("aggregator %s: %w", name, err)
+		}
+		if provider != nil {
+			providers[name] = provider
+		}
+	}
+	return providers, nil
+}
@@ -0,0 +1,142 @@
+package aggregator
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Connection is a linked item and how far its transactions were synced.
+type Connection struct {
+	ID          string `bson:"_id" json:"id"`
+	Provider    string `bson:"provider" json:"provider"`
+	ItemID      string `bson:"item_id" json:"item_id"`
+	Institution string `bson:"institution,omitempty" json:"institution,omitempty"`
+	// SourceName names the statements of the connection, the institution
+	// when the aggregator tells it.
+	SourceName string    `bson:"source_name" json:"source_name"`
+	Accounts   []Account `bson:"accounts" json:"accounts"`
+	// UserID is the user who linked the item when the API authenticates,
+	// the statements are synced for them.
+	UserID string `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	// TenantID is the tenant of the user who linked the item.
+	TenantID string `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+	// AccessToken is sealed with AGGREGATOR_TOKEN_KEY when it is set, and
+	// never served.
+	AccessToken string `bson:"access_token" json:"-"`
+	Cursor      string `bson:"cursor,omitempty" json:"-"`
+
+	CreatedAt    time.Time  `bson:"created_at" json:"created_at"`
+	LastSyncedAt *time.Time `bson:"last_synced_at,omitempty" json:"last_synced_at,omitempty"`
+	// LastError is the error of the last sync, cleared by one that succeeds.
+	LastError string `bson:"last_error,omitempty" json:"last_error,omitempty"`
+}
+
+// ownedBy reports whether the tenant and user of ctx may see the connection.
+func (c *Connection) ownedBy(ctx context.Context) bool {
+	tenant, user := statements.TenantFrom(ctx), statements.UserFrom(ctx)
+	return (tenant == "" || c.TenantID == tenant) && (user == "" || c.UserID == user)
+}
+
+// scope scopes ctx to the tenant and user of the connection.
+func (c *Connection) scope(ctx context.Context) context.Context {
+	return statements.WithTenant(statements.WithUser(ctx, c.UserID), c.TenantID)
+}
+
+// account returns the account of the connection with the ID.
+func (c *Connection) account(id string) (Account, bool) {
+	for _, a := range c.Accounts {
+		if a.ID == id {
+			return a, true
+		}
+	}
+	return Account{}, false
+}
+
+// Store keeps the connections.
+type Store interface {
+	List(ctx context.Context) ([]Connection, error)
+	// Get returns nil when the connection does not exist.
+	Get(ctx context.Context, id string) (*Connection, error)
+	// FindItem returns the connection of the provider's item, nil when it is
+	// not connected.
+	FindItem(ctx context.Context, provider, itemID string) (*Connection, error)
+	Save(ctx context.Context, conn *Connection) error
+	// Delete returns ErrNotFound when the connection does not exist.
+	Delete(ctx context.Context, id string) error
+}
+
+// NewStore keeps the connections next to the statements in MongoDB, or in
+// memory for the memory driver.
+func NewStore(repo statements.StatementRepository) Store {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryStore()
+}
+
+type MemoryStore struct {
+	mu          sync.RWMutex
+	connections map[string]Connection
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{connections: make(map[string]Connection)}
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Connection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Connection, 0, len(s.connections))
+	for _, conn := range s.connections {
+		list = append(list, conn)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Connection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conn, ok := s.connections[id]
+	if !ok {
+		return nil, nil
+	}
+	return &conn, nil
+}
+
+func (s *MemoryStore) FindItem(ctx context.Context, provider, itemID string) (*Connection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, conn := range s.connections {
+		if conn.Provider == provider && conn.ItemID == itemID {
+			return &conn, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, conn *Connection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connections[conn.ID] = *conn
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.connections[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.connections, id)
+	return nil
+}
@@ -0,0 +1,492 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/importers"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/ingest"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// RunSource names the syncer in the ingest runs.
+const RunSource = "aggregator"
+
+// Syncer pulls the transactions of every connection into the ledger. The
+// transactions of an account are kept as one statement per calendar month,
+// <source name>_<account ID>_<YYYYMM> owned by the user who linked the item,
+// and every transaction carries the aggregator's ID as an external reference
+// of the provider's name, so a transaction the aggregator changes or removes
+// is found again. Pending transactions are left out until they post.
+type Syncer struct {
+	Providers map[string]Provider
+	Store     Store
+	Tokens    *Tokens
+	Service   *statements.StatementService
+	Runs      ingest.RunStore
+
+	// mu serializes the syncs, a webhook arriving during the scheduled sync
+	// must not apply the changes of a cursor twice.
+	mu sync.Mutex
+}
+
+// NewSyncerFromEnv opens the configured aggregators and the token key.
+func NewSyncerFromEnv(service *statements.StatementService, runs ingest.RunStore) (*Syncer, error) {
+	providers, err := OpenProvidersFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := TokensFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := providers["plaid"]; ok && !tokens.Encrypted() && os.Getenv("IS_LOCAL") != "true" {
+		slog.Warn("AGGREGATOR_TOKEN_KEY is not set, aggregator access tokens are stored in the clear")
+	}
+	return &Syncer{
+		Providers: providers,
+		Store:     NewStore(service.Repo),
+		Tokens:    tokens,
+		Service:   service,
+		Runs:      runs,
+	}, nil
+}
+
+// Run syncs every connection each interval, until the context is done.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.SyncAll(ctx)
+		}
+	}
+}
+
+func (s *Syncer) provider(name string) (Provider, error) {
+	provider, ok := s.Providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownProvider, name)
+	}
+	return provider, nil
+}
+
+// Link connects the item the frontend linked. Linking an item again, e.g.
+// after its login expired, replaces the access token of its connection.
+func (s *Syncer) Link(ctx context.Context, providerName, publicToken string) (*Connection, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	item, err := provider.Exchange(ctx, publicToken)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := provider.Accounts(ctx, item.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.Store.FindItem(ctx, providerName, item.ID)
+	if err != nil {
+		return nil, err
+	}
+	if conn == nil {
+		conn = &Connection{
+			ID:         uuid.NewString(),
+			Provider:   providerName,
+			ItemID:     item.ID,
+			SourceName: sourceName(providerName, item.Institution),
+			UserID:     statements.UserFrom(ctx),
+			TenantID:   statements.TenantFrom(ctx),
+			CreatedAt:  time.Now().UTC(),
+		}
+	} else if !conn.ownedBy(ctx) {
+		return nil, fmt.Errorf("item %s of %s is linked by another user", item.ID, providerName)
+	}
+	conn.Institution = item.Institution
+	conn.Accounts = accounts
+	conn.AccessToken = s.Tokens.seal(item.AccessToken)
+	if err := s.Store.Save(ctx, conn); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// sourceName names the statements after the institution, as the fetcher
+// names them, e.g. "First Platypus Bank" becomes FIRST_PLATYPUS_BANK.
+func sourceName(provider, institution string) string {
+	name := strings.Join(strings.Fields(strings.ToUpper(institution)), "_")
+	if name == "" {
+		return strings.ToUpper(provider)
+	}
+	return name
+}
+
+// Unlink revokes the access token and deletes the connection; its
+// statements stay in the ledger.
+func (s *Syncer) Unlink(ctx context.Context, id string) error {
+	conn, err := s.Connection(ctx, id)
+	if err != nil {
+		return err
+	}
+	if conn == nil {
+		return ErrNotFound
+	}
+	if provider, err := s.provider(conn.Provider); err != nil {
+		slog.Warn("Deleting the connection of an aggregator no longer configured", "id", id, "provider", conn.Provider)
+	} else if token, err := s.Tokens.open(conn.AccessToken); err != nil {
+		return err
+	} else if err := provider.Remove(ctx, token); err != nil {
+		return fmt.Errorf("revoke the access token: %w", err)
+	}
+	return s.Store.Delete(ctx, id)
+}
+
+// Connections lists the connections of the user of ctx, all of them when the
+// API does not authenticate.
+func (s *Syncer) Connections(ctx context.Context) ([]Connection, error) {
+	list, err := s.Store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(list, func(c Connection) bool { return !c.ownedBy(ctx) }), nil
+}
+
+// Connection returns the connection if the user of ctx owns it, nil when it
+// does not exist.
+func (s *Syncer) Connection(ctx context.Context, id string) (*Connection, error) {
+	conn, err := s.Store.Get(ctx, id)
+	if err != nil || conn == nil || !conn.ownedBy(ctx) {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// SyncAll syncs every connection. Runs that changed nothing are not recorded.
+func (s *Syncer) SyncAll(ctx context.Context) *ingest.Run {
+	run := ingest.NewRun(RunSource)
+	list, err := s.Store.List(ctx)
+	if err != nil {
+		run.Error = err.Error()
+	}
+	for i := range list {
+		if ctx.Err() != nil {
+			break
+		}
+		s.sync(ctx, list[i].ID, run)
+	}
+	s.finish(ctx, run)
+	return run
+}
+
+// SyncConnection syncs the connection now, ErrNotFound when it does not exist.
+func (s *Syncer) SyncConnection(ctx context.Context, id string) (*ingest.Run, error) {
+	conn, err := s.Connection(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if conn == nil {
+		return nil, ErrNotFound
+	}
+	run := ingest.NewRun(RunSource)
+	s.sync(ctx, conn.ID, run)
+	s.finish(ctx, run)
+	return run, nil
+}
+
+// Notify handles a webhook call of the provider, syncing the item it is
+// about when it has new transactions.
+func (s *Syncer) Notify(ctx context.Context, providerName string, event *WebhookEvent) error {
+	if !event.Sync {
+		return nil
+	}
+	conn, err := s.Store.FindItem(ctx, providerName, event.ItemID)
+	if err != nil {
+		return err
+	}
+	if conn == nil {
+		return fmt.Errorf("%w: item %s of %s", ErrNotFound, event.ItemID, providerName)
+	}
+	run := ingest.NewRun(RunSource)
+	s.sync(ctx, conn.ID, run)
+	s.finish(ctx, run)
+	return nil
+}
+
+func (s *Syncer) finish(ctx context.Context, run *ingest.Run) {
+	run.FinishedAt = time.Now().UTC()
+	if run.Error == "" && len(run.Items) == 0 {
+		return
+	}
+	if run.Error != "" {
+		slog.Error("Aggregator sync failed", "error", run.Error)
+	} else {
+		slog.Info("Aggregator sync finished", "imported", run.Imported, "failed", run.Failed)
+	}
+	if err := s.Runs.Save(ctx, run); err != nil {
+		slog.Error("Failed to record the aggregator run", "id", run.ID, "error", err)
+	}
+}
+
+// sync pulls the changes of one connection. The cursor only moves once every
+// statement they touch is saved, a failed sync is pulled again in full. The
+// connection is read under the lock, with the cursor the last sync left.
+func (s *Syncer) sync(ctx context.Context, id string, run *ingest.Run) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conn, err := s.Store.Get(ctx, id)
+	if err != nil {
+		run.Add(ingest.RunItem{Name: id, Status: ingest.ItemFailed, Error: err.Error()})
+		return
+	}
+	if conn == nil {
+		// deleted since it was listed
+		return
+	}
+	if err := s.pull(conn.scope(ctx), conn, run); err != nil {
+		slog.Warn("Failed to sync the aggregator connection", "id", conn.ID, "provider", conn.Provider, "error", err)
+		conn.LastError = err.Error()
+		run.Add(ingest.RunItem{Name: conn.SourceName, Status: ingest.ItemFailed, Error: err.Error()})
+	} else {
+		now := time.Now().UTC()
+		conn.LastSyncedAt, conn.LastError = &now, ""
+	}
+	if err := s.Store.Save(ctx, conn); err != nil {
+		slog.Error("Failed to save the aggregator connection", "id", conn.ID, "error", err)
+	}
+}
+
+func (s *Syncer) pull(ctx context.Context, conn *Connection, run *ingest.Run) error {
+	provider, err := s.provider(conn.Provider)
+	if err != nil {
+		return err
+	}
+	token, err := s.Tokens.open(conn.AccessToken)
+	if err != nil {
+		return err
+	}
+	// new accounts and current balances
+	accounts, err := provider.Accounts(ctx, token)
+	if err != nil {
+		return err
+	}
+	conn.Accounts = accounts
+
+	changes, err := provider.Sync(ctx, token, conn.Cursor)
+	if err != nil {
+		return err
+	}
+	list, err := s.apply(ctx, conn, changes)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, stmt := range list {
+		item := ingest.RunItem{Name: conn.SourceName + " " + *stmt.SourceID, StatementID: stmt.ID}
+		err := s.Service.SaveStatementWithTransactions(ctx, stmt)
+		switch {
+		case errors.Is(err, statements.ErrQueued):
+			item.Status = ingest.ItemQueued
+		case err != nil:
+			item.Status, item.Error = ingest.ItemFailed, err.Error()
+			failed++
+		default:
+			item.Status = ingest.ItemImported
+		}
+		run.Add(item)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d statements failed to save", failed, len(list))
+	}
+	conn.Cursor = changes.Cursor
+	return nil
+}
+
+// month is the statement of an account in a calendar month.
+type month struct {
+	account string
+	start   time.Time
+}
+
+func (m month) sourceID() string {
+	return m.account + "_" + m.start.Format("200601")
+}
+
+// apply merges the changes into the stored transactions of the statements
+// they touch, and returns those statements.
+func (s *Syncer) apply(ctx context.Context, conn *Connection, changes *Changes) ([]*statements.Statement, error) {
+	touched := map[string]month{}
+	transactions := map[string]map[string]statements.Transaction{}
+	load := func(id string, m month) (map[string]statements.Transaction, error) {
+		if txs, ok := transactions[id]; ok {
+			return txs, nil
+		}
+		stored, err := s.Service.Repo.GetTransactions(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		txs := make(map[string]statements.Transaction, len(stored))
+		for _, tx := range stored {
+			txs[tx.ID] = tx
+		}
+		touched[id], transactions[id] = m, txs
+		return txs, nil
+	}
+
+	// a modified transaction may have moved to another month, it is taken
+	// out of the statement it is in and added again
+	gone := append(append([]string{}, changes.Removed...), ids(changes.Modified)...)
+	for _, ref := range gone {
+		stored, err := s.Service.Repo.FindTransactions(ctx, statements.TransactionFilter{ExternalRef: ref, ExternalRefType: conn.Provider})
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range stored {
+			m, ok := conn.month(tx.StatementID)
+			if !ok {
+				continue
+			}
+			txs, err := load(tx.StatementID, m)
+			if err != nil {
+				return nil, err
+			}
+			delete(txs, tx.ID)
+		}
+	}
+
+	for _, t := range append(append([]Transaction{}, changes.Added...), changes.Modified...) {
+		if t.Pending {
+			continue
+		}
+		if _, ok := conn.account(t.AccountID); !ok {
+			slog.Warn("Aggregator transaction of an unknown account", "connection", conn.ID, "account", t.AccountID)
+			continue
+		}
+		m := month{account: t.AccountID, start: time.Date(t.Date.Year(), t.Date.Month(), 1, 0, 0, 0, 0, time.UTC)}
+		txs, err := load(conn.statementID(m), m)
+		if err != nil {
+			return nil, err
+		}
+		tx := ledgerTransaction(conn.Provider, t)
+		txs[tx.ID] = tx
+	}
+
+	list := make([]*statements.Statement, 0, len(touched))
+	for id, m := range touched {
+		list = append(list, conn.statement(id, m, transactions[id]))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func ids(list []Transaction) []string {
+	result := make([]string, len(list))
+	for i, t := range list {
+		result[i] = t.ID
+	}
+	return result
+}
+
+func (c *Connection) statementID(m month) string {
+	return statements.OwnedID(statements.Owner(c.TenantID, c.UserID), c.SourceName+"_"+m.sourceID())
+}
+
+// month reads the account and month back from the ID of a statement of the
+// connection.
+func (c *Connection) month(statementID string) (month, bool) {
+	rest, ok := strings.CutPrefix(statementID, statements.OwnedID(statements.Owner(c.TenantID, c.UserID), c.SourceName+"_"))
+	if !ok {
+		return month{}, false
+	}
+	i := strings.LastIndex(rest, "_")
+	if i < 0 {
+		return month{}, false
+	}
+	start, err := time.Parse("200601", rest[i+1:])
+	if err != nil {
+		return month{}, false
+	}
+	return month{account: rest[:i], start: start}, true
+}
+
+// statement is the statement of the account's month with the transactions,
+// totalling them. Cards are statements of what was charged in the month,
+// not the bills the issuer closes.
+func (c *Connection) statement(id string, m month, txs map[string]statements.Transaction) *statements.Statement {
+	account, _ := c.account(m.account)
+	sourceID := m.sourceID()
+	stmt := &statements.Statement{
+		ID:         id,
+		Type:       statements.BankStatement,
+		SourceType: statements.BankAccount,
+		SourceName: c.SourceName,
+		SourceID:   &sourceID,
+		Currency:   account.Currency,
+		Extra: map[string]any{
+			"aggregator":   c.Provider,
+			"account_name": account.Name,
+			"account_mask": account.Mask,
+		},
+	}
+	if account.Type == "credit" {
+		stmt.Type, stmt.SourceType = statements.CreditCardBill, statements.CreditCard
+	}
+
+	list := make([]statements.Transaction, 0, len(txs))
+	total := 0.0
+	for _, tx := range txs {
+		list = append(list, tx)
+		total += tx.Amount
+		if stmt.Currency == "" {
+			stmt.Currency = tx.Currency
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Date.Equal(list[j].Date) {
+			return list[i].Date.Before(list[j].Date)
+		}
+		return list[i].ID < list[j].ID
+	})
+	stmt.Transactions = &list
+	stmt.TotalAmount = importers.RoundCents(total)
+	return stmt
+}
+
+func ledgerTransaction(provider string, t Transaction) statements.Transaction {
+	tx := statements.Transaction{
+		ID:              importers.StableID(provider, t.ID),
+		Description:     strings.Join(strings.Fields(t.Description), " "),
+		Currency:        t.Currency,
+		MerchantCity:    t.City,
+		MerchantCountry: t.Country,
+		Amount:          importers.RoundCents(t.Amount),
+		Date:            t.Date,
+		ExternalRefs:    []statements.ExternalRef{{Type: provider, Value: t.ID}},
+	}
+	extra := map[string]any{}
+	if t.MerchantName != "" {
+		extra["merchant_name"] = t.MerchantName
+	}
+	if t.Category != "" {
+		extra["aggregator_category"] = t.Category
+	}
+	if len(extra) > 0 {
+		tx.Extra = extra
+	}
+	return tx
+}
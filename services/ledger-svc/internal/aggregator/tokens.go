@@ -0,0 +1,87 @@
+package aggregator
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// sealedPrefix marks access tokens stored as enc:<base64 nonce+ciphertext>.
+const sealedPrefix = "enc:"
+
+// Tokens seals the access tokens at rest with AES-256-GCM. Without a key they
+// are stored as they are.
+type Tokens struct {
+	aead cipher.AEAD
+}
+
+// TokensFromEnv reads AGGREGATOR_TOKEN_KEY, a base64 AES-256 key.
+func TokensFromEnv() (*Tokens, error) {
+	encoded := os.Getenv("AGGREGATOR_TOKEN_KEY")
+	if encoded == "" {
+		return &Tokens{}, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AGGREGATOR_TOKEN_KEY: %w", err)
+	}
+	return NewTokens(key)
+}
+
+func NewTokens(key []byte) (*Tokens, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("AGGREGATOR_TOKEN_KEY has %d bytes, AES-256 needs 32", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{aead: aead}, nil
+}
+
+// Encrypted reports whether tokens are sealed.
+func (t *Tokens) Encrypted() bool {
+	return t.aead != nil
+}
+
+func (t *Tokens) seal(token string) string {
+	if t.aead == nil {
+		return token
+	}
+	nonce := make([]byte, t.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	sealed := t.aead.Seal(nonce, nonce, []byte(token), []byte("aggregator access token"))
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// open returns the access token of a stored value; tokens stored before the
+// key was set are returned as they are.
+func (t *Tokens) open(value string) (string, error) {
+	if !strings.HasPrefix(value, sealedPrefix) {
+		return value, nil
+	}
+	if t.aead == nil {
+		return "", ErrNoTokenKey
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+	if err != nil || len(sealed) < t.aead.NonceSize() {
+		return "", errors.New("malformed encrypted access token")
+	}
+	n := t.aead.NonceSize()
+	token, err := t.aead.Open(nil, sealed[:n], sealed[n:], []byte("aggregator access token"))
+	if err != nil {
+		return "", fmt.Errorf("decrypt the access token: %w", err)
+	}
+	return string(token), nil
+}
@@ -0,0 +1,83 @@
+package analytics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/fx"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// maxSpendMonths bounds the range of a spend query, the previous period
+// doubling what is read.
+const maxSpendMonths = 60
+
+type Handler struct {
+	Repo statements.StatementRepository
+	// FX converts the spend to the currency asked for.
+	FX *fx.Converter
+}
+
+// SpendHandler serves GET /api/analytics/spend?group_by=category|merchant|month|spend_type
+// from one month (YYYY-MM) to another, both inclusive, with the totals, counts
+// and averages per group and the deltas against the period before.
+// spend_type=merchant|fee|interest|transfer|refund limits it to one spend type.
+// currency=USD converts the amounts of every statement to that currency.
+func (h *Handler) SpendHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	groupBy := GroupBy(query.Get("group_by"))
+	if groupBy == "" {
+		groupBy = ByCategory
+	}
+	if !groupBy.Valid() {
+		apierror.Reply(w, "Invalid group_by parameter, expected category, merchant, month or spend_type", http.StatusBadRequest)
+		return
+	}
+	spendType, err := statements.ParseSpendType(query.Get("spend_type"))
+	if err != nil {
+		apierror.Reply(w, "Invalid spend_type parameter, expected merchant, fee, interest, transfer or refund", http.StatusBadRequest)
+		return
+	}
+	from, err := time.Parse(monthLayout, query.Get("from"))
+	if err != nil {
+		apierror.Reply(w, fmt.Sprintf("Invalid from parameter, expected %s", monthLayout), http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(monthLayout, query.Get("to"))
+	if err != nil || to.Before(from) {
+		apierror.Reply(w, fmt.Sprintf("Invalid to parameter, expected %s not before from", monthLayout), http.StatusBadRequest)
+		return
+	}
+	to = to.AddDate(0, 1, 0)
+	if monthsBetween(from, to) > maxSpendMonths {
+		apierror.Reply(w, fmt.Sprintf("Invalid period, at most %d months", maxSpendMonths), http.StatusBadRequest)
+		return
+	}
+
+	currency := strings.ToUpper(query.Get("currency"))
+	if currency != "" && h.FX == nil {
+		apierror.Reply(w, "Currency conversion is not configured", http.StatusBadRequest)
+		return
+	}
+
+	spend, err := SpendIn(r.Context(), h.Repo, h.FX, currency, groupBy, spendType, from, to)
+	if errors.Is(err, fx.ErrNoRate) {
+		apierror.Write(w, err)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to compute spend analytics", "group_by", groupBy, "error", err)
+		apierror.Reply(w, "Failed to compute spend analytics", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(spend); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to encode JSON response", "error", err)
+	}
+}
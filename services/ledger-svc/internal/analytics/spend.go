@@ -0,0 +1,252 @@
+// Package analytics serves the aggregates behind the dashboard charts, run
+// as aggregation pipelines on MongoDB through the statements query builder.
+package analytics
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/fx"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/merchants"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const (
+	monthLayout        = "2006-01"
+	uncategorizedLabel = "Uncategorized"
+)
+
+// GroupBy is the dimension the spend is broken down by.
+type GroupBy string
+
+const (
+	ByCategory GroupBy = "category"
+	// ByMerchant groups the descriptions of a merchant like the merchant
+	// rollup, see merchants.Key.
+	ByMerchant GroupBy = "merchant"
+	ByMonth    GroupBy = "month"
+	// BySpendType separates the merchant spend from fees, interest, transfers
+	// and refunds, see statements.SpendType.
+	BySpendType GroupBy = "spend_type"
+)
+
+func (g GroupBy) Valid() bool {
+	return g == ByCategory || g == ByMerchant || g == ByMonth || g == BySpendType
+}
+
+// Group is the spend of one category, merchant or month. The previous total is
+// of the period of the same length right before, for months the month before.
+// DeltaPct is nil without previous spend.
+type Group struct {
+	Key           string   `json:"key"`
+	Name          string   `json:"name,omitempty"`
+	Total         float64  `json:"total"`
+	Count         int      `json:"count"`
+	Average       float64  `json:"average"`
+	PreviousTotal float64  `json:"previous_total"`
+	Delta         float64  `json:"delta"`
+	DeltaPct      *float64 `json:"delta_pct"`
+}
+
+type Spend struct {
+	GroupBy       GroupBy              `json:"group_by"`
+	SpendType     statements.SpendType `json:"spend_type,omitempty"`
+	Currency      string               `json:"currency,omitempty"`
+	From          string               `json:"from"`
+	To            string               `json:"to"`
+	PreviousFrom  string               `json:"previous_from"`
+	PreviousTo    string               `json:"previous_to"`
+	Total         float64              `json:"total"`
+	Count         int                  `json:"count"`
+	Average       float64              `json:"average"`
+	PreviousTotal float64              `json:"previous_total"`
+	Delta         float64              `json:"delta"`
+	DeltaPct      *float64             `json:"delta_pct"`
+	Groups        []Group              `json:"groups"`
+}
+
+type bucket struct {
+	name        string
+	nameTotal   float64
+	total, prev float64
+	count       int
+}
+
+// SpendBy breaks the spend of the months from to to (month starts, to
+// exclusive) down by group, with the totals of the period before, only of
+// spendType when set. Categories, merchants and spend types are ordered by
+// total, largest first, months by month.
+func SpendBy(ctx context.Context, repo statements.StatementRepository, groupBy GroupBy, spendType statements.SpendType, from, to time.Time) (*Spend, error) {
+	return SpendIn(ctx, repo, nil, "", groupBy, spendType, from, to)
+}
+
+// SpendIn is SpendBy with the amounts converted to currency, at the rates of
+// the first day of their month. The amounts of a statement are in its
+// currency. Without a converter or currency, nothing is converted.
+func SpendIn(ctx context.Context, repo statements.StatementRepository, converter *fx.Converter, currency string, groupBy GroupBy, spendType statements.SpendType, from, to time.Time) (*Spend, error) {
+	convert := converter != nil && currency != ""
+	prevFrom := from.AddDate(0, -monthsBetween(from, to), 0)
+	groups := []string{string(groupBy), "month"}
+	switch groupBy {
+	case ByMerchant:
+		groups[0] = "description"
+	case ByMonth:
+		groups = groups[1:]
+	}
+	if convert {
+		groups = append(groups, "statement_id")
+	}
+	rows, err := statements.RunQuery(ctx, repo, statements.NewQuery(statements.TransactionFilter{From: prevFrom, To: to, SpendType: spendType}).
+		GroupBy(groups...).Sum("amount", "total").Count("count"))
+	if err != nil {
+		return nil, err
+	}
+	if convert {
+		if err := convertRows(ctx, repo, converter, currency, rows); err != nil {
+			return nil, err
+		}
+	}
+
+	current := from.Format(monthLayout)
+	spend := &Spend{
+		GroupBy:      groupBy,
+		SpendType:    spendType,
+		Currency:     strings.ToUpper(currency),
+		From:         current,
+		To:           to.AddDate(0, -1, 0).Format(monthLayout),
+		PreviousFrom: prevFrom.Format(monthLayout),
+		PreviousTo:   from.AddDate(0, -1, 0).Format(monthLayout),
+		Groups:       []Group{},
+	}
+	buckets := map[string]*bucket{}
+	monthTotals := map[string]float64{}
+	for _, row := range rows {
+		month, _ := row["month"].(string)
+		total, _ := row["total"].(float64)
+		count, _ := row["count"].(int)
+		isCurrent := month >= current
+		if isCurrent {
+			spend.Total += total
+			spend.Count += count
+		} else {
+			spend.PreviousTotal += total
+		}
+
+		key, name := month, ""
+		switch groupBy {
+		case ByCategory:
+			if key, _ = row["category"].(string); key == "" {
+				key = uncategorizedLabel
+			}
+		case ByMerchant:
+			name, _ = row["description"].(string)
+			key = merchants.Key(name)
+		case BySpendType:
+			key, _ = row["spend_type"].(string)
+		case ByMonth:
+			monthTotals[month] += total
+			if !isCurrent {
+				continue
+			}
+		}
+		b, ok := buckets[key]
+		if !ok {
+			b = &bucket{}
+			buckets[key] = b
+		}
+		if !isCurrent {
+			b.prev += total
+			continue
+		}
+		b.total += total
+		b.count += count
+		if math.Abs(total) >= b.nameTotal {
+			// the description of the merchant's largest month
+			b.name, b.nameTotal = name, math.Abs(total)
+		}
+	}
+	if groupBy == ByMonth {
+		// a month is compared with the month before
+		for month, b := range buckets {
+			b.prev = monthTotals[previousMonth(month)]
+		}
+	}
+
+	for key, b := range buckets {
+		if b.count == 0 {
+			// spent in the previous period only
+			continue
+		}
+		g := Group{Key: key, Name: b.name, Total: money.Round(b.total), Count: b.count, PreviousTotal: money.Round(b.prev)}
+		g.Average = money.Round(b.total / float64(b.count))
+		g.Delta, g.DeltaPct = delta(b.total, b.prev)
+		spend.Groups = append(spend.Groups, g)
+	}
+	sort.Slice(spend.Groups, func(i, j int) bool {
+		a, b := spend.Groups[i], spend.Groups[j]
+		if groupBy == ByMonth || a.Total == b.Total {
+			return a.Key < b.Key
+		}
+		return a.Total > b.Total
+	})
+
+	if spend.Count > 0 {
+		spend.Average = money.Round(spend.Total / float64(spend.Count))
+	}
+	spend.Delta, spend.DeltaPct = delta(spend.Total, spend.PreviousTotal)
+	spend.Total = money.Round(spend.Total)
+	spend.PreviousTotal = money.Round(spend.PreviousTotal)
+	return spend, nil
+}
+
+// convertRows converts the totals of the rows, per statement and month, from
+// the currency of their statement.
+func convertRows(ctx context.Context, repo statements.StatementRepository, converter *fx.Converter, currency string, rows []statements.Row) error {
+	list, err := repo.ListStatements(ctx, statements.StatementFilter{})
+	if err != nil {
+		return err
+	}
+	currencies := make(map[string]string, len(list))
+	for _, stmt := range list {
+		currencies[stmt.ID] = stmt.Currency
+	}
+	for _, row := range rows {
+		id, _ := row["statement_id"].(string)
+		month, _ := row["month"].(string)
+		total, _ := row["total"].(float64)
+		from := currencies[id]
+		date, err := time.Parse(monthLayout, month)
+		if from == "" || err != nil {
+			continue
+		}
+		if row["total"], err = converter.Convert(ctx, total, from, currency, date); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func delta(total, previous float64) (float64, *float64) {
+	d := money.Round(total - previous)
+	if previous == 0 {
+		return d, nil
+	}
+	pct := money.Round((total - previous) / math.Abs(previous) * 100)
+	return d, &pct
+}
+
+func monthsBetween(from, to time.Time) int {
+	return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+}
+
+func previousMonth(month string) string {
+	t, err := time.Parse(monthLayout, month)
+	if err != nil {
+		return ""
+	}
+	return t.AddDate(0, -1, 0).Format(monthLayout)
+}
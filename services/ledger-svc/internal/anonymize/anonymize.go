@@ -0,0 +1,136 @@
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const maxJitter = 0.1
+
+// Anonymizer produces realistic-but-private copies of statements. All
+// replacements are keyed by Secret and Seed, so the same input always maps to
+// the same output and repeated merchants keep their pattern across
+// transactions, while nobody without the secret can recompute them. Only the
+// fields listed here are copied; owners, state and free text are left out.
+type Anonymizer struct {
+	Secret []byte
+	Seed   string
+}
+
+func (a *Anonymizer) Statement(stmt *statements.Statement, txs []statements.Transaction) *statements.Statement {
+	out := statements.Statement{
+		ID:                "anon_" + a.key("statement", stmt.ID),
+		Type:              stmt.Type,
+		SourceType:        stmt.SourceType,
+		SourceName:        stmt.SourceName,
+		Currency:          stmt.Currency,
+		PaymentDueDate:    stmt.PaymentDueDate,
+		AutopayEnabled:    stmt.AutopayEnabled,
+		AutopayAmountType: stmt.AutopayAmountType,
+	}
+	if stmt.SourceID != nil {
+		sourceID := a.key("source_id", *stmt.SourceID)
+		out.SourceID = &sourceID
+	}
+	for i, fee := range stmt.Fees {
+		out.Fees = append(out.Fees, statements.FeeItem{
+			Type:   fee.Type,
+			Amount: a.jitter(fmt.Sprintf("fee:%d", i), fee.Amount),
+			Date:   fee.Date,
+		})
+	}
+
+	var delta float64
+	anonymized := make([]statements.Transaction, 0, len(txs))
+	for _, tx := range txs {
+		anon := a.Transaction(&tx, out.ID)
+		delta += anon.Amount - tx.Amount
+		anonymized = append(anonymized, anon)
+	}
+	out.Transactions = &anonymized
+
+	// keep the gap between total and transactions, which is what most
+	// reconciliation and normalization bugs are about
+	out.TotalAmount = a.round(stmt.TotalAmount+delta, stmt.TotalAmount)
+	out.PreviousAmount = a.jitterPtr("previous_amount", stmt.PreviousAmount)
+	out.PreviousPaid = a.jitterPtr("previous_paid", stmt.PreviousPaid)
+	out.PreviousUnpaid = a.jitterPtr("previous_unpaid", stmt.PreviousUnpaid)
+	out.CurrentAmount = a.jitterPtr("current_amount", stmt.CurrentAmount)
+	out.MinimumPaymentDue = a.jitterPtr("minimum_payment_due", stmt.MinimumPaymentDue)
+	out.InterestCharged = a.jitterPtr("interest_charged", stmt.InterestCharged)
+	return &out
+}
+
+func (a *Anonymizer) Transaction(tx *statements.Transaction, statementID string) statements.Transaction {
+	return statements.Transaction{
+		ID:              "anon_" + a.key("transaction", tx.ID),
+		StatementID:     statementID,
+		Description:     "Merchant " + a.key("merchant", tx.Description)[:8],
+		Category:        tx.Category,
+		Currency:        tx.Currency,
+		MerchantCountry: tx.MerchantCountry,
+		IsForeign:       tx.IsForeign,
+		Amount:          a.jitter("amount:"+tx.ID, tx.Amount),
+		Date:            tx.Date,
+		SpendType:       tx.SpendType,
+	}
+}
+
+func (a *Anonymizer) key(kind, value string) string {
+	return hex.EncodeToString(a.sum(kind, value))[:16]
+}
+
+func (a *Anonymizer) sum(kind, value string) []byte {
+	mac := hmac.New(sha256.New, a.Secret)
+	mac.Write([]byte(a.Seed + "\x00" + kind + ":" + value))
+	return mac.Sum(nil)
+}
+
+// jitter scales amount by a deterministic factor within ±maxJitter.
+func (a *Anonymizer) jitter(key string, amount float64) float64 {
+	n := binary.BigEndian.Uint64(a.sum("jitter", key)[:8])
+	factor := 1 + maxJitter*(2*float64(n)/float64(math.MaxUint64)-1)
+	return a.round(amount*factor, amount)
+}
+
+func (a *Anonymizer) jitterPtr(key string, amount *float64) *float64 {
+	if amount == nil {
+		return nil
+	}
+	v := a.jitter(key, *amount)
+	return &v
+}
+
+// round keeps whole-unit amounts whole, everything else to cents.
+func (a *Anonymizer) round(v, original float64) float64 {
+	if original == math.Trunc(original) {
+		return math.Round(v)
+	}
+	return math.Round(v*100) / 100
+}
+
+// SecretFromEnv reads ANONYMIZE_SECRET, at least 32 bytes. Without one a
+// random secret is generated, so the pseudonyms change on restart and differ
+// between replicas.
+func SecretFromEnv() ([]byte, error) {
+	secret := []byte(os.Getenv("ANONYMIZE_SECRET"))
+	switch {
+	case len(secret) == 0:
+		secret = make([]byte, 32)
+		rand.Read(secret)
+		slog.Warn("ANONYMIZE_SECRET is not set, anonymized pseudonyms change on restart")
+	case len(secret) < 32:
+		return nil, errors.New("ANONYMIZE_SECRET must be at least 32 bytes")
+	}
+	return secret, nil
+}
@@ -0,0 +1,54 @@
+package anonymize
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+type Handler struct {
+	Repo statements.StatementRepository
+	// Secret keys the pseudonyms, see SecretFromEnv.
+	Secret []byte
+}
+
+// AnonymizedStatementHandler serves GET /api/statements/{id}/anonymized.
+// The optional seed parameter changes the pseudonyms and jitter.
+func (h *Handler) AnonymizedStatementHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	stmt, err := h.Repo.GetStatement(r.Context(), id)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to retrieve statement", "id", id, "error", err)
+		apierror.Reply(w, "Failed to retrieve statement", http.StatusInternalServerError)
+		return
+	}
+	if stmt == nil {
+		apierror.Reply(w, "Statement not found", http.StatusNotFound)
+		return
+	}
+
+	txs, err := h.Repo.GetTransactions(r.Context(), id)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to retrieve transactions for statement", "statement_id", id, "error", err)
+		apierror.Reply(w, "Failed to retrieve transactions", http.StatusInternalServerError)
+		return
+	}
+
+	anonymized := (&Anonymizer{Secret: h.Secret, Seed: r.URL.Query().Get("seed")}).Statement(stmt, txs)
+
+	// Statement.ID is not serialized, expose the re-keyed ID next to the payload
+	body := struct {
+		ID string `json:"id"`
+		*statements.Statement
+	}{anonymized.ID, anonymized}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to encode JSON response", "error", err)
+		apierror.Reply(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
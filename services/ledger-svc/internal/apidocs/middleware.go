@@ -0,0 +1,128 @@
+package apidocs
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/ingest"
+)
+
+// maxValidatedBody caps the bodies read for validation; larger ones reach the
+// handler unchecked and are left to its own limits.
+const maxValidatedBody = 1 << 20
+
+// errInvalidRequest is a request the specification rejects, detailed with
+// each violation.
+var errInvalidRequest = apierror.New(apierror.KindInvalid, "validation_failed", "Request does not match the API specification")
+
+// Middleware checks the path and query parameters and the JSON body of every
+// request against the operation the specification describes for it, and
+// answers mismatches with a 400 listing each violation. Requests to paths the
+// specification does not describe pass through.
+func Middleware(spec *Specification, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op, pathValues := spec.Match(r.Method, r.URL.Path)
+		if op == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		errs := validateParameters(op, pathValues, r)
+		if op.Body != nil && r.Body != nil {
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxValidatedBody+1))
+			if err != nil {
+				apierror.Reply(w, "Invalid request payload", http.StatusBadRequest)
+				return
+			}
+			// hand the handler the full stream: what was read plus the remainder
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			if len(body) <= maxValidatedBody {
+				errs = append(errs, validateBody(op, body)...)
+			}
+		}
+
+		if len(errs) > 0 {
+			accesslog.Logger(r.Context()).Info("Request rejected by the API specification",
+				"method", r.Method, "operation", op.Path, "errors", len(errs))
+			apierror.Write(w, errInvalidRequest.WithDetails(errs))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func validateParameters(op *Operation, pathValues map[string]string, r *http.Request) []ingest.ValidationError {
+	query := r.URL.Query()
+	var errs []ingest.ValidationError
+	for _, p := range op.Parameters {
+		var raw string
+		var present bool
+		switch p.In {
+		case "path":
+			raw, present = pathValues[p.Name]
+		case "query":
+			raw, present = query.Get(p.Name), query.Has(p.Name) && query.Get(p.Name) != ""
+		default:
+			continue
+		}
+		at := p.In + "." + p.Name
+		if !present {
+			if p.Required {
+				errs = append(errs, ingest.ValidationError{Path: at, Message: "is required"})
+			}
+			continue
+		}
+
+		value, ok := convertParameter(raw, p.Schema)
+		if !ok {
+			errs = append(errs, ingest.ValidationError{Path: at, Message: "expected " + schemaType(p.Schema) + ", got " + strconv.Quote(raw)})
+			continue
+		}
+		errs = append(errs, ingest.Validate(p.Schema, value, at)...)
+	}
+	return errs
+}
+
+// convertParameter reads a parameter as the JSON value its schema expects,
+// booleans and numbers being parsed the way the handlers parse them.
+func convertParameter(raw string, schema map[string]any) (any, bool) {
+	switch schemaType(schema) {
+	case "integer":
+		n, err := strconv.Atoi(raw)
+		return float64(n), err == nil
+	case "number":
+		f, err := strconv.ParseFloat(raw, 64)
+		return f, err == nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		return b, err == nil
+	}
+	return raw, true
+}
+
+func schemaType(schema map[string]any) string {
+	t, _ := schema["type"].(string)
+	return t
+}
+
+func validateBody(op *Operation, body []byte) []ingest.ValidationError {
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.BodyRequired {
+			return []ingest.ValidationError{{Path: "$", Message: "request body is required"}}
+		}
+		return nil
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return []ingest.ValidationError{{Path: "$", Message: "malformed JSON: " + err.Error()}}
+	}
+	return ingest.Validate(op.Body, doc, "$")
+}
@@ -0,0 +1,206 @@
+// Package apidocs serves the OpenAPI description of the HTTP API and checks
+// requests against it. openapi.json is written by hand and is the reference:
+// a route added to cmd/main.go belongs there too.
+package apidocs
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+//go:embed openapi.json
+var specJSON []byte
+
+// Spec is the parsed specification with its $refs resolved.
+var Spec = mustLoadSpec(specJSON)
+
+// Parameter is a path or query parameter of an operation.
+type Parameter struct {
+	Name     string
+	In       string
+	Required bool
+	Schema   map[string]any
+}
+
+// Operation is one method of one path of the specification.
+type Operation struct {
+	Method     string
+	Path       string
+	Parameters []Parameter
+	// Body is the schema of a JSON request body, nil when the operation takes
+	// none or takes another media type.
+	Body         map[string]any
+	BodyRequired bool
+
+	segments []string
+}
+
+// Specification holds the operations of the API.
+type Specification struct {
+	Operations []*Operation
+}
+
+func mustLoadSpec(data []byte) *Specification {
+	spec, err := LoadSpec(data)
+	if err != nil {
+		panic(err)
+	}
+	return spec
+}
+
+// LoadSpec parses an OpenAPI document, inlining the #/components/schemas
+// references so the schemas can be validated on their own.
+func LoadSpec(data []byte) (*Specification, error) {
+	var doc struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid API specification: %w", err)
+	}
+
+	spec := &Specification{}
+	for path, methods := range doc.Paths {
+		for method, raw := range methods {
+			var op struct {
+				Parameters []struct {
+					Name     string         `json:"name"`
+					In       string         `json:"in"`
+					Required bool           `json:"required"`
+					Schema   map[string]any `json:"schema"`
+				} `json:"parameters"`
+				RequestBody *struct {
+					Required bool `json:"required"`
+					Content  map[string]struct {
+						Schema map[string]any `json:"schema"`
+					} `json:"content"`
+				} `json:"requestBody"`
+			}
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("invalid operation %s %s: %w", method, path, err)
+			}
+
+			operation := &Operation{
+				Method:   strings.ToUpper(method),
+				Path:     path,
+				segments: strings.Split(strings.Trim(path, "/"), "/"),
+			}
+			for _, p := range op.Parameters {
+				schema, err := resolve(p.Schema, doc.Components.Schemas, 0)
+				if err != nil {
+					return nil, fmt.Errorf("%s %s parameter %s: %w", method, path, p.Name, err)
+				}
+				operation.Parameters = append(operation.Parameters, Parameter{Name: p.Name, In: p.In, Required: p.Required, Schema: schema})
+			}
+			if op.RequestBody != nil {
+				if content, ok := op.RequestBody.Content["application/json"]; ok {
+					body, err := resolve(content.Schema, doc.Components.Schemas, 0)
+					if err != nil {
+						return nil, fmt.Errorf("%s %s request body: %w", method, path, err)
+					}
+					operation.Body, operation.BodyRequired = body, op.RequestBody.Required
+				}
+			}
+			spec.Operations = append(spec.Operations, operation)
+		}
+	}
+	return spec, nil
+}
+
+// resolve returns a copy of schema with its references replaced by the
+// component they point at.
+func resolve(schema map[string]any, components map[string]any, depth int) (map[string]any, error) {
+	if depth > 32 {
+		return nil, fmt.Errorf("schema references nest too deep")
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		name, found := strings.CutPrefix(ref, "#/components/schemas/")
+		target, known := components[name].(map[string]any)
+		if !found || !known {
+			return nil, fmt.Errorf("unknown reference %s", ref)
+		}
+		return resolve(target, components, depth+1)
+	}
+
+	out := make(map[string]any, len(schema))
+	for k, v := range schema {
+		switch v := v.(type) {
+		case map[string]any:
+			if k == "properties" {
+				props := make(map[string]any, len(v))
+				for name, prop := range v {
+					propSchema, _ := prop.(map[string]any)
+					resolved, err := resolve(propSchema, components, depth+1)
+					if err != nil {
+						return nil, err
+					}
+					props[name] = resolved
+				}
+				out[k] = props
+				continue
+			}
+			resolved, err := resolve(v, components, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = resolved
+		default:
+			out[k] = v
+		}
+	}
+	return out, nil
+}
+
+// Match finds the operation serving a request and its path parameters. Like
+// http.ServeMux, a literal segment wins over a {parameter} one, so
+// /api/statements/duplicates is not read as an id.
+func (s *Specification) Match(method, path string) (*Operation, map[string]string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var best *Operation
+	bestLiterals := -1
+	for _, op := range s.Operations {
+		if op.Method != method || len(op.segments) != len(segments) {
+			continue
+		}
+		literals, ok := 0, true
+		for i, seg := range op.segments {
+			if isParam(seg) {
+				continue
+			}
+			if seg != segments[i] {
+				ok = false
+				break
+			}
+			literals++
+		}
+		if ok && literals > bestLiterals {
+			best, bestLiterals = op, literals
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+
+	values := map[string]string{}
+	for i, seg := range best.segments {
+		if isParam(seg) {
+			values[strings.Trim(seg, "{}")] = segments[i]
+		}
+	}
+	return best, values
+}
+
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// SpecHandler serves the specification as written.
+func SpecHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(specJSON)
+}
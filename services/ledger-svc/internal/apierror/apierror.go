@@ -0,0 +1,146 @@
+// Package apierror is how the API reports errors. The services return Errors,
+// a Kind telling how a client should react and a Code it can branch on, and
+// the handlers answer them with Write: the HTTP status of the kind and a JSON
+// envelope of the code, message, details and request ID.
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// Kind classifies errors by the HTTP status they are answered with.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindInvalid
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindMethodNotAllowed
+	KindConflict
+	KindTooLarge
+	KindRateLimited
+	KindNotImplemented
+	KindUpstream
+	KindUnavailable
+	KindTimeout
+)
+
+var kinds = []struct {
+	status int
+	code   string
+}{
+	KindInternal:         {http.StatusInternalServerError, "internal"},
+	KindInvalid:          {http.StatusBadRequest, "invalid_request"},
+	KindUnauthorized:     {http.StatusUnauthorized, "unauthorized"},
+	KindForbidden:        {http.StatusForbidden, "forbidden"},
+	KindNotFound:         {http.StatusNotFound, "not_found"},
+	KindMethodNotAllowed: {http.StatusMethodNotAllowed, "method_not_allowed"},
+	KindConflict:         {http.StatusConflict, "conflict"},
+	KindTooLarge:         {http.StatusRequestEntityTooLarge, "payload_too_large"},
+	KindRateLimited:      {http.StatusTooManyRequests, "rate_limited"},
+	KindNotImplemented:   {http.StatusNotImplemented, "not_implemented"},
+	KindUpstream:         {http.StatusBadGateway, "upstream_failed"},
+	KindUnavailable:      {http.StatusServiceUnavailable, "unavailable"},
+	KindTimeout:          {http.StatusGatewayTimeout, "timeout"},
+}
+
+// Status returns the HTTP status errors of the kind are answered with.
+func (k Kind) Status() int {
+	if int(k) >= len(kinds) {
+		return http.StatusInternalServerError
+	}
+	return kinds[k].status
+}
+
+// Code returns the code of errors of the kind that have none of their own.
+func (k Kind) Code() string {
+	if int(k) >= len(kinds) {
+		return kinds[KindInternal].code
+	}
+	return kinds[k].code
+}
+
+// KindOf returns the kind answered with the status, KindInternal for
+// statuses no kind has.
+func KindOf(status int) Kind {
+	for k, kind := range kinds {
+		if kind.status == status {
+			return Kind(k)
+		}
+	}
+	return KindInternal
+}
+
+// Error is an error a client can act on. Wrapped with %w, its code and kind
+// still answer the request, with the message of the wrapping error.
+type Error struct {
+	Kind Kind
+	// Code is the machine-readable reason, e.g. budget_not_found; the code
+	// of the kind when empty.
+	Code    string
+	Message string
+	// Details is served as is, e.g. the fields a payload is rejected for.
+	Details any
+}
+
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// WithDetails returns a copy of the error with the details.
+func (e *Error) WithDetails(details any) *Error {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+// Response is the body of every error the API answers.
+type Response struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Write answers the request with err. Errors that are not an Error are not
+// the client's to see and are answered as a bare internal error.
+func Write(w http.ResponseWriter, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		write(w, KindInternal.Status(), Response{Code: KindInternal.Code(), Message: "Internal server error"})
+		return
+	}
+	code := apiErr.Code
+	if code == "" {
+		code = apiErr.Kind.Code()
+	}
+	write(w, apiErr.Kind.Status(), Response{Code: code, Message: err.Error(), Details: apiErr.Details})
+}
+
+// Reply answers the request with the message and the code of the status,
+// like http.Error.
+func Reply(w http.ResponseWriter, message string, status int) {
+	write(w, status, Response{Code: KindOf(status).Code(), Message: message})
+}
+
+func write(w http.ResponseWriter, status int, resp Response) {
+	resp.RequestID = w.Header().Get("X-Request-ID")
+	h := w.Header()
+	// headers set for the success response, e.g. by http.ServeContent
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
@@ -0,0 +1,135 @@
+// Package apikeys gives machines, like the statement fetcher, credentials of
+// their own. A key is created on the admin listener and shown once; only the
+// SHA-256 of its secret is stored. Each key carries the scopes it may use and,
+// when the API authenticates users, the user it acts for.
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/authz"
+)
+
+// tokenPrefix marks the API keys, telling them apart from JWTs in the
+// Authorization header.
+const tokenPrefix = "fk_"
+
+const (
+	// ScopeIngest posts statements and imports, and reads the ingest schema.
+	ScopeIngest = "ingest"
+	// ScopeRead reads the API, GET and HEAD requests.
+	ScopeRead = "read"
+)
+
+var (
+	ErrNotFound     = apierror.New(apierror.KindNotFound, "api_key_not_found", "API key not found")
+	ErrInvalidScope = apierror.New(apierror.KindInvalid, "invalid_api_key_scope", "invalid API key scope")
+)
+
+// Key is an API key as stored, without its secret.
+type Key struct {
+	ID     string   `bson:"_id" json:"id"`
+	Name   string   `bson:"name" json:"name"`
+	Scopes []string `bson:"scopes" json:"scopes"`
+	// UserID is the user the key acts for when the API authenticates users.
+	UserID string `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	// TenantID is the tenant of the user, when tokens carry tenants.
+	TenantID string `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+	// SecretHash is the hex SHA-256 of the secret, never served.
+	SecretHash string     `bson:"secret_hash" json:"-"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	LastUsedAt *time.Time `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+// NewKey returns a key and its token, fk_<id>_<secret>, the only time the
+// secret is known.
+func NewKey(name string, scopes []string, userID, tenantID string, now time.Time) (*Key, string, error) {
+	for _, scope := range scopes {
+		if scope != ScopeIngest && scope != ScopeRead {
+			return nil, "", fmt.Errorf("%w %q, expected %s or %s", ErrInvalidScope, scope, ScopeIngest, ScopeRead)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: a key needs at least one scope", ErrInvalidScope)
+	}
+	id, secret := make([]byte, 8), make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	key := &Key{
+		ID:         hex.EncodeToString(id),
+		Name:       name,
+		Scopes:     slices.Compact(slices.Sorted(slices.Values(scopes))),
+		UserID:     userID,
+		TenantID:   tenantID,
+		CreatedAt:  now.UTC(),
+		SecretHash: hashSecret(base64.RawURLEncoding.EncodeToString(secret)),
+	}
+	return key, tokenPrefix + key.ID + "_" + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseToken splits a token into the key ID and the secret.
+func parseToken(token string) (id, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(token, tokenPrefix)
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, "_")
+}
+
+// matches reports whether the secret is the key's, in constant time.
+func (k *Key) matches(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(k.SecretHash)) == 1
+}
+
+func (k *Key) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// Roles returns the roles the scopes of the key amount to under role-based
+// access control: editor to ingest, reader to read.
+func (k *Key) Roles() []string {
+	var roles []string
+	if slices.Contains(k.Scopes, ScopeIngest) {
+		roles = append(roles, authz.RoleEditor)
+	}
+	if slices.Contains(k.Scopes, ScopeRead) {
+		roles = append(roles, authz.RoleReader)
+	}
+	return roles
+}
+
+// Allows reports whether the scopes of the key cover the request.
+func (k *Key) Allows(r *http.Request) bool {
+	if slices.Contains(k.Scopes, ScopeRead) && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		return true
+	}
+	if slices.Contains(k.Scopes, ScopeIngest) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/statements",
+			r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/import/") && !strings.HasPrefix(r.URL.Path, "/api/import/profiles"),
+			r.Method == http.MethodGet && r.URL.Path == "/api/ingest/schema":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package apikeys
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/ingest"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/jsonbody"
+)
+
+// Handler manages the keys on the admin listener:
+//
+//	GET    /apikeys       list keys, without their secrets
+//	POST   /apikeys       create a key from {"name", "scopes", "user_id", "tenant_id"}
+//	DELETE /apikeys/{id}  revoke a key
+type Handler struct {
+	Store Store
+	// RequireUser rejects keys without a user, which would see and change the
+	// data of every user; set when the API authenticates. RequireTenant does
+	// the same for the tenant, when tenants are read from the tokens.
+	RequireUser   bool
+	RequireTenant bool
+}
+
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /apikeys", h.list)
+	mux.HandleFunc("POST /apikeys", h.create)
+	mux.HandleFunc("DELETE /apikeys/{id}", h.revoke)
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Store.List(r.Context())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list API keys", "error", err)
+		apierror.Reply(w, "Failed to list API keys", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// create answers with the key and its token, the only place the token is
+// shown.
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name     string   `json:"name"`
+		Scopes   []string `json:"scopes"`
+		UserID   string   `json:"user_id"`
+		TenantID string   `json:"tenant_id"`
+	}
+	if err := jsonbody.Decode(w, r, &req); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	var missing []ingest.ValidationError
+	if req.Name == "" {
+		missing = append(missing, ingest.ValidationError{Path: "$.name", Message: "is required"})
+	}
+	if h.RequireUser && req.UserID == "" {
+		missing = append(missing, ingest.ValidationError{Path: "$.user_id", Message: "is required when the API authenticates"})
+	}
+	if h.RequireTenant && req.TenantID == "" {
+		missing = append(missing, ingest.ValidationError{Path: "$.tenant_id", Message: "is required with AUTH_TENANT_CLAIM"})
+	}
+	if len(missing) > 0 {
+		apierror.Write(w, jsonbody.Invalid("Invalid API key payload", missing...))
+		return
+	}
+	key, token, err := NewKey(req.Name, req.Scopes, req.UserID, req.TenantID, time.Now())
+	if errors.Is(err, ErrInvalidScope) {
+		apierror.Write(w, err)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to generate an API key", "error", err)
+		apierror.Reply(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Store.Save(r.Context(), key); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to save API key", "error", err)
+		apierror.Reply(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	accesslog.Logger(r.Context()).Info("Created an API key", "key_id", key.ID, "name", key.Name, "scopes", key.Scopes)
+	writeJSON(w, http.StatusCreated, struct {
+		*Key
+		Token string `json:"token"`
+	}{key, token})
+}
+
+func (h *Handler) revoke(w http.ResponseWriter, r *http.Request) {
+	key, err := h.Store.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to get API key", "error", err)
+		apierror.Reply(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+	if key == nil {
+		apierror.Reply(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if !key.Revoked() {
+		now := time.Now().UTC()
+		key.RevokedAt = &now
+		if err := h.Store.Save(r.Context(), key); err != nil {
+			accesslog.Logger(r.Context()).Error("Failed to save API key", "error", err)
+			apierror.Reply(w, "Failed to revoke API key", http.StatusInternalServerError)
+			return
+		}
+		accesslog.Logger(r.Context()).Info("Revoked an API key", "key_id", key.ID, "name", key.Name)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
@@ -0,0 +1,107 @@
+package apikeys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/authz"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// HeaderName carries the key; a bearer token with the key prefix works too.
+const HeaderName = "X-API-Key"
+
+// lastUsedInterval bounds how often using a key writes its LastUsedAt.
+const lastUsedInterval = time.Hour
+
+var errInvalidKey = errors.New("invalid API key")
+
+type keyContextKey struct{}
+
+// FromContext returns the checked key of the request, nil without one.
+func FromContext(ctx context.Context) *Key {
+	key, _ := ctx.Value(keyContextKey{}).(*Key)
+	return key
+}
+
+// Middleware serves requests that present an API key with authenticated,
+// the handler inside user authentication, once the key is checked: unknown,
+// revoked or mismatched keys are answered with 401, requests outside the
+// scopes of the key with 403. The actor of the request is apikey:<id> and it
+// is scoped to the user and tenant of the key. Requests without a key go to next.
+func Middleware(store Store, authenticated, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := keyToken(r)
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key, err := check(r.Context(), store, token)
+		if err != nil {
+			if !errors.Is(err, errInvalidKey) {
+				accesslog.Logger(r.Context()).Error("Failed to check API key", "error", err)
+				apierror.Reply(w, "Failed to check API key", http.StatusInternalServerError)
+				return
+			}
+			accesslog.Logger(r.Context()).Info("Rejected an API key", "method", r.Method, "path", r.URL.Path, "error", err)
+			apierror.Reply(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		accesslog.Add(r.Context(), "api_key", key.ID)
+		if !key.Allows(r) {
+			apierror.Reply(w, "Forbidden: outside the scopes of the API key", http.StatusForbidden)
+			return
+		}
+
+		r.Header.Set(authz.SubjectHeader, "apikey:"+key.ID)
+		r.Header.Set(authz.RolesHeader, strings.Join(key.Roles(), ","))
+		ctx := statements.WithTenant(statements.WithUser(r.Context(), key.UserID), key.TenantID)
+		ctx = context.WithValue(ctx, keyContextKey{}, key)
+		authenticated.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func keyToken(r *http.Request) string {
+	if token := r.Header.Get(HeaderName); token != "" {
+		return strings.TrimSpace(token)
+	}
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		if token = strings.TrimSpace(token); strings.HasPrefix(token, tokenPrefix) {
+			return token
+		}
+	}
+	return ""
+}
+
+func check(ctx context.Context, store Store, token string) (*Key, error) {
+	id, secret, ok := parseToken(token)
+	if !ok {
+		return nil, errInvalidKey
+	}
+	key, err := store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || !key.matches(secret) {
+		return nil, errInvalidKey
+	}
+	if key.Revoked() {
+		return nil, fmt.Errorf("%w: %s is revoked", errInvalidKey, key.ID)
+	}
+
+	if now := time.Now().UTC(); key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedInterval {
+		key.LastUsedAt = &now
+		if err := store.Save(ctx, key); err != nil {
+			// the request is fine, only the bookkeeping failed
+			slog.Warn("Failed to record API key use", "key_id", key.ID, "error", err)
+		}
+	}
+	return key, nil
+}
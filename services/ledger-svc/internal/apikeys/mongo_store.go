@@ -0,0 +1,50 @@
+package apikeys
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps the keys in the <namespace>api_keys collection.
+type MongoStore struct {
+	keys *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database, namespace string) *MongoStore {
+	return &MongoStore{keys: db.Collection(namespace + "api_keys")}
+}
+
+func (s *MongoStore) List(ctx context.Context) ([]Key, error) {
+	cursor, err := s.keys.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	list := []Key{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *MongoStore) Get(ctx context.Context, id string) (*Key, error) {
+	var key Key
+	err := s.keys.FindOne(ctx, bson.M{"_id": id}).Decode(&key)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *MongoStore) Save(ctx context.Context, key *Key) error {
+	_, err := s.keys.ReplaceOne(ctx, bson.M{"_id": key.ID}, key, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,67 @@
+package apikeys
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Store keeps the API keys.
+type Store interface {
+	// List returns the keys, revoked ones included, oldest first.
+	List(ctx context.Context) ([]Key, error)
+	// Get returns nil when the key does not exist.
+	Get(ctx context.Context, id string) (*Key, error)
+	Save(ctx context.Context, key *Key) error
+}
+
+// NewStore keeps the keys next to the statements in MongoDB, or in memory for
+// the memory driver.
+func NewStore(repo statements.StatementRepository) Store {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryStore()
+}
+
+type MemoryStore struct {
+	mu   sync.RWMutex
+	keys map[string]Key
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: make(map[string]Key)}
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		list = append(list, key)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, nil
+	}
+	return &key, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, key *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key.ID] = *key
+	return nil
+}
@@ -0,0 +1,153 @@
+package attachments
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+type Handler struct {
+	Store Store
+	Repo  statements.StatementRepository
+	// MaxSize caps the size of an upload in bytes.
+	MaxSize int64
+	// Signer issues the signed download URLs.
+	Signer *URLSigner
+}
+
+// UploadHandler serves POST /api/statements/{id}/attachments?name=<file name>
+// with the document as the body and its Content-Type.
+func (h *Handler) UploadHandler(w http.ResponseWriter, r *http.Request) {
+	statementID := r.PathValue("id")
+	name := CleanName(r.URL.Query().Get("name"))
+	if name == "" {
+		apierror.Reply(w, "Missing name parameter", http.StatusBadRequest)
+		return
+	}
+	stmt, err := h.Repo.GetStatement(r.Context(), statementID)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to retrieve statement", "id", statementID, "error", err)
+		apierror.Reply(w, "Failed to retrieve statement", http.StatusInternalServerError)
+		return
+	}
+	if stmt == nil {
+		apierror.Reply(w, "Statement not found", http.StatusNotFound)
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		if contentType = mime.TypeByExtension(path.Ext(name)); contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	}
+	attachment := &Attachment{
+		ID:          uuid.NewString(),
+		StatementID: statementID,
+		Name:        name,
+		ContentType: contentType,
+		UploadedAt:  time.Now().UTC(),
+	}
+	err = h.Store.Save(r.Context(), attachment, http.MaxBytesReader(w, r.Body, h.MaxSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		apierror.Reply(w, fmt.Sprintf("Attachment exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to save attachment", "statement_id", statementID, "name", name, "error", err)
+		apierror.Reply(w, "Failed to save attachment", http.StatusInternalServerError)
+		return
+	}
+	accesslog.Logger(r.Context()).Info("Attachment uploaded", "id", attachment.ID, "statement_id", statementID, "size", attachment.Size)
+	writeJSON(w, http.StatusCreated, attachment)
+}
+
+// ListHandler serves GET /api/statements/{id}/attachments.
+func (h *Handler) ListHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.readable(w, r, r.PathValue("id"), errStatementNotFound) {
+		return
+	}
+	list, err := h.Store.List(r.Context(), r.PathValue("id"))
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list attachments", "statement_id", r.PathValue("id"), "error", err)
+		apierror.Reply(w, "Failed to list attachments", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// DownloadHandler serves GET /api/attachments/{id}.
+func (h *Handler) DownloadHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	attachment, content, err := h.Store.Open(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		apierror.Write(w, err)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to open attachment", "id", id, "error", err)
+		apierror.Reply(w, "Failed to open attachment", http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+	if !h.readable(w, r, attachment.StatementID, ErrNotFound) {
+		return
+	}
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+	if _, err := io.Copy(w, content); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to send attachment", "id", id, "error", err)
+	}
+}
+
+var errStatementNotFound = apierror.New(apierror.KindNotFound, "statement_not_found", "statement not found")
+
+// readable reports whether the caller can read the statement, through the
+// scoped repository, answering notFound for the statement of another user
+// or tenant otherwise.
+func (h *Handler) readable(w http.ResponseWriter, r *http.Request, statementID string, notFound error) bool {
+	stmt, err := h.Repo.GetStatement(r.Context(), statementID)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to retrieve statement", "id", statementID, "error", err)
+		apierror.Reply(w, "Failed to retrieve statement", http.StatusInternalServerError)
+		return false
+	}
+	if stmt == nil {
+		apierror.Write(w, notFound)
+		return false
+	}
+	return true
+}
+
+// CleanName keeps the base name of an uploaded file, without directories.
+func CleanName(name string) string {
+	name = path.Base(strings.ReplaceAll(strings.TrimSpace(name), `\`, "/"))
+	if name == "." || name == "/" || name == ".." {
+		return ""
+	}
+	return name
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
@@ -0,0 +1,129 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps the attachments in the <namespace>attachments GridFS
+// bucket, the statement and content type in the file metadata.
+type MongoStore struct {
+	bucket *gridfs.Bucket
+}
+
+func NewMongoStore(db *mongo.Database, namespace string) *MongoStore {
+	bucket, err := gridfs.NewBucket(db, options.GridFSBucket().SetName(namespace+"attachments"))
+	if err != nil {
+		// only fails on invalid options
+		panic(err)
+	}
+	return &MongoStore{bucket: bucket}
+}
+
+type fileMetadata struct {
+	StatementID string `bson:"statement_id"`
+	ContentType string `bson:"content_type"`
+}
+
+type fileDocument struct {
+	ID         string       `bson:"_id"`
+	Length     int64        `bson:"length"`
+	UploadDate time.Time    `bson:"uploadDate"`
+	Name       string       `bson:"filename"`
+	Metadata   fileMetadata `bson:"metadata"`
+}
+
+func (d *fileDocument) attachment() *Attachment {
+	return &Attachment{
+		ID:          d.ID,
+		StatementID: d.Metadata.StatementID,
+		Name:        d.Name,
+		ContentType: d.Metadata.ContentType,
+		Size:        d.Length,
+		UploadedAt:  d.UploadDate.UTC(),
+	}
+}
+
+func (s *MongoStore) Save(ctx context.Context, attachment *Attachment, content io.Reader) error {
+	opts := options.GridFSUpload().SetMetadata(fileMetadata{
+		StatementID: attachment.StatementID,
+		ContentType: attachment.ContentType,
+	})
+	upload, err := s.bucket.OpenUploadStreamWithID(attachment.ID, attachment.Name, opts)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = upload.SetWriteDeadline(deadline)
+	}
+	size, err := io.Copy(upload, content)
+	if err != nil {
+		_ = upload.Abort()
+		return err
+	}
+	if err := upload.Close(); err != nil {
+		return err
+	}
+	attachment.Size = size
+	return nil
+}
+
+func (s *MongoStore) List(ctx context.Context, statementIDs ...string) ([]Attachment, error) {
+	list := []Attachment{}
+	if len(statementIDs) == 0 {
+		return list, nil
+	}
+	opts := options.GridFSFind().SetSort(bson.D{{Key: "metadata.statement_id", Value: 1}, {Key: "uploadDate", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := s.bucket.FindContext(ctx, bson.M{"metadata.statement_id": bson.M{"$in": statementIDs}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc fileDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		list = append(list, *doc.attachment())
+	}
+	return list, cursor.Err()
+}
+
+func (s *MongoStore) Open(ctx context.Context, id string) (*Attachment, io.ReadCloser, error) {
+	var doc fileDocument
+	err := s.bucket.GetFilesCollection().FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	download, err := s.bucket.OpenDownloadStream(id)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = download.SetReadDeadline(deadline)
+	}
+	return doc.attachment(), download, nil
+}
+
+func (s *MongoStore) Delete(ctx context.Context, id string) error {
+	err := s.bucket.DeleteContext(ctx, id)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,157 @@
+package attachments
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+// ErrBadSignature rejects signed URLs that were not issued by the API, were
+// altered or have expired.
+var ErrBadSignature = apierror.New(apierror.KindForbidden, "invalid_signature", "invalid or expired signed URL")
+
+// inlineTypes are shown in the page embedding them; anything else, which
+// could script the API origin, is downloaded.
+var inlineTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp", "image/heic", "application/pdf"}
+
+// URLSigner issues the time-limited download URLs of the attachments, signed
+// with HMAC-SHA256 so the download needs no credentials, e.g. for an <img>.
+type URLSigner struct {
+	Key []byte
+	// TTL is how long a signed URL is valid.
+	TTL time.Duration
+	Now func() time.Time
+}
+
+// URLSignerFromEnv signs with ATTACHMENT_URL_KEY, at least 32 bytes, for
+// ATTACHMENT_URL_TTL_SECONDS (900). Without a key one is generated, so URLs
+// stop working on restart and are only valid on the replica issuing them.
+func URLSignerFromEnv() (*URLSigner, error) {
+	s := &URLSigner{Key: []byte(os.Getenv("ATTACHMENT_URL_KEY")), TTL: 15 * time.Minute, Now: time.Now}
+	if seconds, err := strconv.Atoi(os.Getenv("ATTACHMENT_URL_TTL_SECONDS")); err == nil && seconds > 0 {
+		s.TTL = time.Duration(seconds) * time.Second
+	}
+	switch {
+	case len(s.Key) == 0:
+		s.Key = make([]byte, 32)
+		rand.Read(s.Key)
+		slog.Warn("ATTACHMENT_URL_KEY is not set, signed attachment URLs are valid only until restart")
+	case len(s.Key) < 32:
+		return nil, errors.New("ATTACHMENT_URL_KEY must be at least 32 bytes")
+	}
+	return s, nil
+}
+
+// Sign returns the path of the signed download of the attachment and when
+// it expires.
+func (s *URLSigner) Sign(id string) (string, time.Time) {
+	expires := s.Now().Add(s.TTL).Truncate(time.Second)
+	query := url.Values{
+		"expires":   {strconv.FormatInt(expires.Unix(), 10)},
+		"signature": {s.signature(id, expires.Unix())},
+	}
+	return "/api/attachments/" + url.PathEscape(id) + "/content?" + query.Encode(), expires
+}
+
+// Verify returns ErrBadSignature unless the query holds an unexpired
+// signature of the attachment.
+func (s *URLSigner) Verify(id string, query url.Values) error {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || s.Now().Unix() > expires {
+		return ErrBadSignature
+	}
+	if !hmac.Equal([]byte(query.Get("signature")), []byte(s.signature(id, expires))) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+func (s *URLSigner) signature(id string, expires int64) string {
+	mac := hmac.New(sha256.New, s.Key)
+	fmt.Fprintf(mac, "%s\n%d", id, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignedURLHandler serves GET /api/attachments/{id}/url, a signed download
+// URL of an attachment of a statement the caller can read.
+func (h *Handler) SignedURLHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	attachment, content, err := h.Store.Open(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		apierror.Write(w, err)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to open attachment", "id", id, "error", err)
+		apierror.Reply(w, "Failed to open attachment", http.StatusInternalServerError)
+		return
+	}
+	content.Close()
+	if !h.readable(w, r, attachment.StatementID, ErrNotFound) {
+		return
+	}
+
+	signed, expires := h.Signer.Sign(id)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{"url": signed, "expires_at": expires})
+}
+
+// SignedDownloadHandler serves GET /api/attachments/{id}/content with the
+// query of a signed URL, without credentials. Images and PDFs are served
+// inline to be embedded.
+func (h *Handler) SignedDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := h.Signer.Verify(id, r.URL.Query()); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	attachment, content, err := h.Store.Open(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		apierror.Write(w, err)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to open attachment", "id", id, "error", err)
+		apierror.Reply(w, "Failed to open attachment", http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	disposition := "attachment"
+	mediaType, _, _ := mime.ParseMediaType(attachment.ContentType)
+	for _, inline := range inlineTypes {
+		if strings.EqualFold(mediaType, inline) {
+			disposition = "inline"
+		}
+	}
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(h.maxAge(r)))
+	if _, err := io.Copy(w, content); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to send attachment", "id", id, "error", err)
+	}
+}
+
+// maxAge keeps browsers from caching the download past the expiry of its URL.
+func (h *Handler) maxAge(r *http.Request) int {
+	expires, _ := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	return max(int(expires-h.Signer.Now().Unix()), 0)
+}
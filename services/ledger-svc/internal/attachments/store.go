@@ -0,0 +1,120 @@
+// Package attachments keeps the documents belonging to a statement, the
+// statement PDF itself or the receipts of its transactions.
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+var ErrNotFound = apierror.New(apierror.KindNotFound, "attachment_not_found", "attachment not found")
+
+type Attachment struct {
+	ID          string    `json:"id"`
+	StatementID string    `json:"statement_id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+}
+
+type Store interface {
+	// Save stores the content and sets the size of the attachment.
+	Save(ctx context.Context, attachment *Attachment, content io.Reader) error
+	// List returns the attachments of the statements ordered by statement and
+	// upload time.
+	List(ctx context.Context, statementIDs ...string) ([]Attachment, error)
+	// Open returns ErrNotFound when the attachment does not exist.
+	Open(ctx context.Context, id string) (*Attachment, io.ReadCloser, error)
+	// Delete removes the attachment and its content. Deleting a missing
+	// attachment is not an error.
+	Delete(ctx context.Context, id string) error
+}
+
+// NewStore keeps the attachments in GridFS next to the statements in MongoDB,
+// or in memory for the memory driver.
+func NewStore(repo statements.StatementRepository) Store {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryStore()
+}
+
+type MemoryStore struct {
+	mu       sync.RWMutex
+	meta     map[string]Attachment
+	contents map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{meta: make(map[string]Attachment), contents: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Save(ctx context.Context, attachment *Attachment, content io.Reader) error {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	attachment.Size = int64(len(data))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.meta[attachment.ID] = *attachment
+	s.contents[attachment.ID] = data
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, statementIDs ...string) ([]Attachment, error) {
+	wanted := make(map[string]bool, len(statementIDs))
+	for _, id := range statementIDs {
+		wanted[id] = true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []Attachment{}
+	for _, a := range s.meta {
+		if wanted[a.StatementID] {
+			list = append(list, a)
+		}
+	}
+	sortAttachments(list)
+	return list, nil
+}
+
+func (s *MemoryStore) Open(ctx context.Context, id string) (*Attachment, io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.meta[id]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	return &a, io.NopCloser(bytes.NewReader(s.contents[id])), nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.meta, id)
+	delete(s.contents, id)
+	return nil
+}
+
+func sortAttachments(list []Attachment) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].StatementID != list[j].StatementID {
+			return list[i].StatementID < list[j].StatementID
+		}
+		if !list[i].UploadedAt.Equal(list[j].UploadedAt) {
+			return list[i].UploadedAt.Before(list[j].UploadedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+}
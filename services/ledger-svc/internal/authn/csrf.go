@@ -0,0 +1,31 @@
+package authn
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+// CSRFHeader carries the CSRF token of the session on writes signed in by
+// the session cookie. GET /auth/session hands it to the frontend, which
+// another site cannot read.
+const CSRFHeader = "X-CSRF-Token"
+
+// ErrCSRF rejects a write signed in by a session cookie without the CSRF
+// token of the session: the browser may be sending it for another site.
+var ErrCSRF = apierror.New(apierror.KindForbidden, "csrf_token_invalid", "missing or invalid CSRF token")
+
+// checkCSRF lets through the reads, which change nothing, and the writes
+// carrying the CSRF token of the session.
+func checkCSRF(r *http.Request, session *Session) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	token := r.Header.Get(CSRFHeader)
+	if token == "" || session.CSRFToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(session.CSRFToken)) != 1 {
+		return ErrCSRF
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package authn
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+var ErrInvalidToken = apierror.New(apierror.KindUnauthorized, "invalid_token", "invalid token")
+
+// Claims are the claims of a verified token, numbers as float64.
+type Claims map[string]any
+
+// Verifier checks the signature and the registered claims of JWTs. Tokens
+// signed with a public key algorithm are checked against Keys, HS256/384/512
+// ones against Secret; an algorithm without its key is rejected, so a token
+// cannot choose to be checked against the secret.
+type Verifier struct {
+	Keys   *JWKS
+	Secret []byte
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string
+	Audience string
+	// Leeway is the clock skew allowed on exp and nbf.
+	Leeway time.Duration
+	Now    func() time.Time
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify returns the claims of a valid token, ErrInvalidToken otherwise.
+// Tokens without exp are rejected.
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+	if err := v.verifySignature(ctx, h, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (v *Verifier) verifySignature(ctx context.Context, h header, signed string, signature []byte) error {
+	family, bits := h.Alg[:min(2, len(h.Alg))], h.Alg[min(2, len(h.Alg)):]
+	newHash, ok := hashes[bits]
+	if h.Alg != "EdDSA" && (!ok || !slices.Contains([]string{"HS", "RS", "PS", "ES"}, family)) {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, h.Alg)
+	}
+
+	if family == "HS" {
+		if len(v.Secret) == 0 {
+			return fmt.Errorf("%w: %s tokens are not accepted", ErrInvalidToken, h.Alg)
+		}
+		mac := hmac.New(newHash, v.Secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		return nil
+	}
+
+	if v.Keys == nil {
+		return fmt.Errorf("%w: %s tokens are not accepted", ErrInvalidToken, h.Alg)
+	}
+	key, err := v.Keys.Key(ctx, h.Kid)
+	if err != nil {
+		return err
+	}
+	if !verifyWithKey(h.Alg, key, newHash, []byte(signed), signature) {
+		return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+	return nil
+}
+
+var hashes = map[string]func() hash.Hash{
+	"256": sha256.New,
+	"384": sha512.New384,
+	"512": sha512.New,
+}
+
+var cryptoHashes = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+// verifyWithKey checks a public key signature, false when the key is not of
+// the kind the algorithm needs.
+func verifyWithKey(alg string, key crypto.PublicKey, newHash func() hash.Hash, signed, signature []byte) bool {
+	if alg == "EdDSA" {
+		pub, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(pub, signed, signature)
+	}
+
+	digest := newHash()
+	digest.Write(signed)
+	sum := digest.Sum(nil)
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		if alg[:2] == "PS" {
+			return rsa.VerifyPSS(pub, cryptoHashes[alg[2:]], sum, signature, nil) == nil
+		}
+		return rsa.VerifyPKCS1v15(pub, cryptoHashes[alg[2:]], sum, signature) == nil
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		// r and s, each the size of the curve
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(pub, sum, r, s)
+	}
+	return false
+}
+
+func (v *Verifier) checkClaims(claims Claims) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("%w: no exp claim", ErrInvalidToken)
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(v.Leeway)) {
+		return fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+	if v.Issuer != "" && claims["iss"] != v.Issuer {
+		return fmt.Errorf("%w: issuer %v", ErrInvalidToken, claims["iss"])
+	}
+	if v.Audience != "" && !slices.Contains(stringList(claims["aud"]), v.Audience) {
+		return fmt.Errorf("%w: audience %v", ErrInvalidToken, claims["aud"])
+	}
+	return nil
+}
+
+// stringList reads a claim that is a string or a list of strings; strings
+// are split on spaces and commas, as scopes and roles often are.
+func stringList(claim any) []string {
+	var list []string
+	switch v := claim.(type) {
+	case string:
+		list = strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' })
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
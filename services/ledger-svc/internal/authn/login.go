@@ -0,0 +1,487 @@
+package authn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+const (
+	// SessionCookie carries the session of a signed in browser.
+	SessionCookie = "finchie_session"
+	// loginCookie binds a pending login to the browser that started it.
+	loginCookie = "finchie_login"
+	// loginTimeout is how long the provider has to call back.
+	loginTimeout = 10 * time.Minute
+)
+
+// Provider is an OAuth2 provider users sign in with. OpenID Connect providers
+// identify the user by the ID token, checked by IDTokens; plain OAuth2 ones,
+// like GitHub, by the JSON of UserURL.
+type Provider struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	Scopes       []string
+	IDTokens     *Verifier
+	UserURL      string
+	Client       *http.Client
+}
+
+// newProvider configures a known provider with its client credentials.
+func newProvider(name, clientID, clientSecret string) (*Provider, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	p := &Provider{Name: name, ClientID: clientID, ClientSecret: clientSecret, Client: client}
+	switch name {
+	case "google":
+		const issuer = "https://accounts.google.com"
+		p.AuthURL = "https://accounts.google.com/o/oauth2/v2/auth"
+		p.TokenURL = "https://oauth2.googleapis.com/token"
+		p.Scopes = []string{"openid", "email", "profile"}
+		p.IDTokens = &Verifier{
+			Keys:     &JWKS{Issuer: issuer, Client: client},
+			Issuer:   issuer,
+			Audience: clientID,
+			Leeway:   time.Minute,
+			Now:      time.Now,
+		}
+	case "github":
+		p.AuthURL = "https://github.com/login/oauth/authorize"
+		p.TokenURL = "https://github.com/login/oauth/access_token"
+		p.Scopes = []string{"read:user"}
+		p.UserURL = "https://api.github.com/user"
+	default:
+		return nil, fmt.Errorf("unknown login provider %q, expected google or github", name)
+	}
+	return p, nil
+}
+
+// Login signs browsers in with the authorization code flow and PKCE, and keeps
+// them signed in with a session cookie the Authenticator accepts like a
+// token. Users are named <provider>:<subject>, e.g. google:1234.
+type Login struct {
+	Providers map[string]*Provider
+	Sessions  SessionStore
+	// CallbackURL is the public URL of /auth/callback, as registered with the
+	// providers.
+	CallbackURL string
+	SessionTTL  time.Duration
+	// RolesClaim and TenantClaim read the ID tokens as the Authenticator
+	// reads bearer tokens; without an ID token a required tenant fails the
+	// login.
+	RolesClaim  string
+	TenantClaim string
+	// SameSite of the cookies, None for frontends on another site.
+	SameSite http.SameSite
+	// AllowedOrigin reports whether a frontend origin, e.g. one allowed by
+	// CORS, may be returned to after the login; nil for this site only.
+	AllowedOrigin func(origin string) bool
+	Now           func() time.Time
+}
+
+// LoginFromEnv configures the providers of AUTH_LOGIN_PROVIDERS, nil when
+// there are none, with their AUTH_<PROVIDER>_CLIENT_ID and
+// AUTH_<PROVIDER>_CLIENT_SECRET. AUTH_LOGIN_CALLBACK_URL is required;
+// sessions last AUTH_SESSION_TTL_HOURS, 30 days by default. AUTH_COOKIE_SAMESITE
+// is lax, or none for a frontend on another site, which needs HTTPS.
+func LoginFromEnv(sessions SessionStore) (*Login, error) {
+	raw := os.Getenv("AUTH_LOGIN_PROVIDERS")
+	if raw == "" {
+		return nil, nil
+	}
+	l := &Login{
+		Providers:   map[string]*Provider{},
+		Sessions:    sessions,
+		CallbackURL: os.Getenv("AUTH_LOGIN_CALLBACK_URL"),
+		SessionTTL:  30 * 24 * time.Hour,
+		RolesClaim:  envOr("AUTH_ROLES_CLAIM", "roles"),
+		TenantClaim: os.Getenv("AUTH_TENANT_CLAIM"),
+		SameSite:    http.SameSiteLaxMode,
+		Now:         time.Now,
+	}
+	if _, err := url.ParseRequestURI(l.CallbackURL); err != nil {
+		return nil, errors.New("AUTH_LOGIN_CALLBACK_URL must be the public URL of /auth/callback")
+	}
+	switch sameSite := strings.ToLower(os.Getenv("AUTH_COOKIE_SAMESITE")); sameSite {
+	case "", "lax":
+	case "none":
+		if strings.HasPrefix(l.CallbackURL, "http://") {
+			return nil, errors.New("AUTH_COOKIE_SAMESITE=none needs an https AUTH_LOGIN_CALLBACK_URL")
+		}
+		l.SameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("invalid AUTH_COOKIE_SAMESITE %q, expected lax or none", sameSite)
+	}
+	if hours, err := strconv.Atoi(os.Getenv("AUTH_SESSION_TTL_HOURS")); err == nil && hours > 0 {
+		l.SessionTTL = time.Duration(hours) * time.Hour
+	}
+	for name := range strings.SplitSeq(raw, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "AUTH_" + strings.ToUpper(name) + "_"
+		clientID, clientSecret := os.Getenv(prefix+"CLIENT_ID"), os.Getenv(prefix+"CLIENT_SECRET")
+		if clientID == "" || clientSecret == "" {
+			return nil, fmt.Errorf("%sCLIENT_ID and %sCLIENT_SECRET are required", prefix, prefix)
+		}
+		p, err := newProvider(name, clientID, clientSecret)
+		if err != nil {
+			return nil, err
+		}
+		l.Providers[name] = p
+	}
+	slog.Info("Login enabled", "providers", raw, "callback", l.CallbackURL)
+	return l, nil
+}
+
+// LoginHandler serves GET /auth/login?provider=...&redirect=..., sending the
+// browser to the provider. The provider may be left out when there is one;
+// redirect is the path of the frontend to return to, / by default, or a URL
+// on an allowed frontend origin.
+func (l *Login) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("provider")
+	if name == "" && len(l.Providers) == 1 {
+		for only := range l.Providers {
+			name = only
+		}
+	}
+	p, ok := l.Providers[name]
+	if !ok {
+		apierror.Reply(w, fmt.Sprintf("Unknown login provider %q", name), http.StatusBadRequest)
+		return
+	}
+
+	state, id, err := newSessionToken()
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to start a login", "error", err)
+		apierror.Reply(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	now := l.Now()
+	pending := &Session{
+		ID:        id,
+		Provider:  p.Name,
+		Pending:   true,
+		Verifier:  randomString(),
+		Nonce:     randomString(),
+		Redirect:  l.redirectTarget(r.URL.Query().Get("redirect")),
+		CreatedAt: now.UTC(),
+		ExpiresAt: now.Add(loginTimeout).UTC(),
+	}
+	if err := l.Sessions.Save(r.Context(), pending); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to save a pending login", "error", err)
+		apierror.Reply(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, l.cookie(loginCookie, state, "/auth", pending.ExpiresAt))
+
+	challenge := sha256.Sum256([]byte(pending.Verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {l.CallbackURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	if p.IDTokens != nil {
+		query.Set("nonce", pending.Nonce)
+	}
+	http.Redirect(w, r, p.AuthURL+"?"+query.Encode(), http.StatusFound)
+}
+
+// CallbackHandler serves GET /auth/callback, where the provider returns the
+// browser with a code; it is exchanged for the identity of the user, who is
+// given a session and sent to the redirect of the login.
+func (l *Login) CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		accesslog.Logger(r.Context()).Info("Login refused by the provider", "error", reason, "description", query.Get("error_description"))
+		apierror.Reply(w, "Login refused: "+reason, http.StatusUnauthorized)
+		return
+	}
+	state := query.Get("state")
+	cookie, err := r.Cookie(loginCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		apierror.Reply(w, "Login state does not match, start the login again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, l.cookie(loginCookie, "", "/auth", time.Unix(0, 0)))
+
+	pending, err := l.Sessions.Get(r.Context(), sessionID(state))
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to get a pending login", "error", err)
+		apierror.Reply(w, "Failed to complete login", http.StatusInternalServerError)
+		return
+	}
+	if pending == nil || !pending.Pending {
+		apierror.Reply(w, "Login expired, start the login again", http.StatusBadRequest)
+		return
+	}
+	// a state is good for one callback
+	if err := l.Sessions.Delete(r.Context(), pending.ID); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to delete a pending login", "error", err)
+		apierror.Reply(w, "Failed to complete login", http.StatusInternalServerError)
+		return
+	}
+
+	p := l.Providers[pending.Provider]
+	if p == nil {
+		apierror.Reply(w, "Login expired, start the login again", http.StatusBadRequest)
+		return
+	}
+	id, err := l.identify(r.Context(), p, query.Get("code"), pending)
+	if err != nil {
+		accesslog.Logger(r.Context()).Info("Failed to sign a user in", "provider", p.Name, "error", err)
+		apierror.Reply(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+
+	token, sid, err := newSessionToken()
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to create a session", "error", err)
+		apierror.Reply(w, "Failed to complete login", http.StatusInternalServerError)
+		return
+	}
+	now := l.Now()
+	session := &Session{
+		ID:        sid,
+		User:      id.User,
+		Roles:     id.Roles,
+		Tenant:    id.Tenant,
+		Provider:  p.Name,
+		CSRFToken: randomString(),
+		CreatedAt: now.UTC(),
+		ExpiresAt: now.Add(l.SessionTTL).UTC(),
+	}
+	if err := l.Sessions.Save(r.Context(), session); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to save a session", "error", err)
+		apierror.Reply(w, "Failed to complete login", http.StatusInternalServerError)
+		return
+	}
+	accesslog.Logger(r.Context()).Info("Signed a user in", "user", id.User, "provider", p.Name)
+	http.SetCookie(w, l.cookie(SessionCookie, token, "/", session.ExpiresAt))
+	http.Redirect(w, r, pending.Redirect, http.StatusSeeOther)
+}
+
+// LogoutHandler serves POST /auth/logout, ending the session of the cookie.
+// Like the other writes it needs the CSRF token of the session.
+func (l *Login) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		session, err := l.Sessions.Get(r.Context(), sessionID(cookie.Value))
+		if err != nil {
+			accesslog.Logger(r.Context()).Error("Failed to get a session", "error", err)
+			apierror.Reply(w, "Failed to log out", http.StatusInternalServerError)
+			return
+		}
+		if session != nil {
+			if err := checkCSRF(r, session); err != nil {
+				apierror.Write(w, err)
+				return
+			}
+			if err := l.Sessions.Delete(r.Context(), session.ID); err != nil {
+				accesslog.Logger(r.Context()).Error("Failed to delete a session", "error", err)
+				apierror.Reply(w, "Failed to log out", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	http.SetCookie(w, l.cookie(SessionCookie, "", "/", time.Unix(0, 0)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SessionHandler serves GET /auth/session, who the cookie signs in, for the
+// frontend to tell whether to show the login, and the CSRF token its writes
+// need.
+func (l *Login) SessionHandler(w http.ResponseWriter, r *http.Request) {
+	var session *Session
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		session, err = l.Sessions.Get(r.Context(), sessionID(cookie.Value))
+		if err != nil {
+			accesslog.Logger(r.Context()).Error("Failed to get a session", "error", err)
+			apierror.Reply(w, "Failed to get session", http.StatusInternalServerError)
+			return
+		}
+	}
+	if session == nil || session.Pending {
+		apierror.Reply(w, "Not signed in", http.StatusUnauthorized)
+		return
+	}
+	if session.CSRFToken == "" {
+		// signed in before the sessions had one
+		session.CSRFToken = randomString()
+		if err := l.Sessions.Save(r.Context(), session); err != nil {
+			accesslog.Logger(r.Context()).Error("Failed to save a session", "error", err)
+			apierror.Reply(w, "Failed to get session", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(struct {
+		User      string    `json:"user"`
+		Roles     []string  `json:"roles,omitempty"`
+		Tenant    string    `json:"tenant,omitempty"`
+		Provider  string    `json:"provider"`
+		CSRFToken string    `json:"csrf_token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{session.User, session.Roles, session.Tenant, session.Provider, session.CSRFToken, session.ExpiresAt})
+}
+
+// cookie is HttpOnly, and Secure unless the callback is served over plain
+// HTTP, e.g. locally. SameSite=Lax lets the provider's redirect back carry
+// the login cookie; None lets a frontend on another site send the session,
+// the CSRF token keeping other sites from writing with it.
+func (l *Login) cookie(name, value, path string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   !strings.HasPrefix(l.CallbackURL, "http://"),
+		SameSite: l.SameSite,
+	}
+}
+
+// identify exchanges the code and names the user it was issued for.
+func (l *Login) identify(ctx context.Context, p *Provider, code string, pending *Session) (Identity, error) {
+	if code == "" {
+		return Identity{}, errors.New("no code")
+	}
+	tokens, err := p.exchange(ctx, code, pending.Verifier, l.CallbackURL)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	var id Identity
+	if p.IDTokens != nil {
+		claims, err := p.IDTokens.Verify(ctx, tokens.IDToken)
+		if err != nil {
+			return Identity{}, err
+		}
+		if claims["nonce"] != pending.Nonce {
+			return Identity{}, fmt.Errorf("%w: nonce does not match", ErrInvalidToken)
+		}
+		sub, _ := claims["sub"].(string)
+		id = Identity{User: sub, Roles: stringList(claim(claims, l.RolesClaim))}
+		if l.TenantClaim != "" {
+			id.Tenant, _ = claim(claims, l.TenantClaim).(string)
+		}
+	} else {
+		var user struct {
+			ID json.Number `json:"id"`
+		}
+		if err := p.getJSON(ctx, p.UserURL, tokens.AccessToken, &user); err != nil {
+			return Identity{}, err
+		}
+		id.User = user.ID.String()
+	}
+	if id.User == "" {
+		return Identity{}, errors.New("the provider did not name the user")
+	}
+	if l.TenantClaim != "" && id.Tenant == "" {
+		return Identity{}, fmt.Errorf("no %s claim, a tenant is required", l.TenantClaim)
+	}
+	id.User = p.Name + ":" + id.User
+	return id, nil
+}
+
+type providerTokens struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	Error       string `json:"error"`
+}
+
+func (p *Provider) exchange(ctx context.Context, code, verifier, callbackURL string) (*providerTokens, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {callbackURL},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// GitHub answers with a form unless asked for JSON
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tokens providerTokens
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("token endpoint returned %s: %w", resp.Status, err)
+	}
+	// GitHub reports errors with 200
+	if resp.StatusCode != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("token endpoint returned %s: %s", resp.Status, tokens.Error)
+	}
+	return &tokens, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url, accessToken string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// redirectTarget keeps the redirect on this site or an allowed frontend
+// origin, so the login cannot be used to send users elsewhere.
+func (l *Login) redirectTarget(redirect string) string {
+	if u, err := url.Parse(redirect); err == nil && u.IsAbs() && l.AllowedOrigin != nil && l.AllowedOrigin(u.Scheme+"://"+u.Host) {
+		return redirect
+	}
+	return localPath(redirect)
+}
+
+// localPath keeps the redirect on this site.
+func localPath(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.HasPrefix(redirect, "/\\") {
+		return "/"
+	}
+	return redirect
+}
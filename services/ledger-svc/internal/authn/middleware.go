@@ -0,0 +1,255 @@
+// Package authn authenticates the API requests with JWTs from an OpenID
+// Connect issuer, or signed with a shared secret, so several people can share
+// one deployment. The user of a valid token scopes the statements repository
+// and replaces the identity headers authz and the audit log read, and its
+// tenant, when tokens carry one, isolates the families sharing the deployment.
+// Without configuration the API is open as before, for a single user or
+// behind an authenticating proxy.
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/authz"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// defaultPublicPaths are served without a token: the health checks, the API
+// docs, the login, and the aggregator webhooks and signed attachment
+// downloads, which are verified by their signature.
+var defaultPublicPaths = []string{
+	"/healthz",
+	"/readyz",
+	"/api/docs",
+	"/api/docs/openapi.json",
+	"/auth/*",
+	"/api/aggregator/providers/*/webhooks",
+	"/api/attachments/*/content",
+}
+
+type Authenticator struct {
+	Verifier *Verifier
+	// UserClaim names the user, RolesClaim their roles as a list or a
+	// space or comma separated string. Nested claims are dotted, e.g.
+	// realm_access.roles.
+	UserClaim  string
+	RolesClaim string
+	// TenantClaim names the tenant, required in every token when set.
+	TenantClaim string
+	// PublicPaths are path.Match patterns of the paths served without a
+	// token.
+	PublicPaths []string
+	// Sessions, when set, signs in the browsers with the session cookie of
+	// Login in place of a token.
+	Sessions SessionStore
+}
+
+// Enabled reports whether the environment configures authentication, for the
+// workers that store on behalf of users without serving requests.
+func Enabled() bool {
+	return os.Getenv("AUTH_JWKS_URL") != "" || os.Getenv("AUTH_JWT_ISSUER") != "" || os.Getenv("AUTH_JWT_SECRET") != "" ||
+		os.Getenv("AUTH_LOGIN_PROVIDERS") != ""
+}
+
+// FromEnv configures the authenticator, nil when authentication is off.
+// Tokens are checked against the keys of AUTH_JWKS_URL, discovered from
+// AUTH_JWT_ISSUER without it, and against AUTH_JWT_SECRET for HS256. The
+// issuer and AUTH_JWT_AUDIENCE are required in the claims when set.
+func FromEnv() (*Authenticator, error) {
+	if !Enabled() {
+		return nil, nil
+	}
+	issuer := os.Getenv("AUTH_JWT_ISSUER")
+	verifier := &Verifier{
+		Secret:   []byte(os.Getenv("AUTH_JWT_SECRET")),
+		Issuer:   issuer,
+		Audience: os.Getenv("AUTH_JWT_AUDIENCE"),
+		Leeway:   time.Minute,
+		Now:      time.Now,
+	}
+	if jwksURL := os.Getenv("AUTH_JWKS_URL"); jwksURL != "" || issuer != "" {
+		verifier.Keys = &JWKS{URL: jwksURL, Issuer: issuer, Client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	if len(verifier.Secret) > 0 && len(verifier.Secret) < 32 {
+		return nil, errors.New("AUTH_JWT_SECRET must be at least 32 bytes")
+	}
+
+	a := &Authenticator{
+		Verifier:    verifier,
+		UserClaim:   envOr("AUTH_USER_CLAIM", "sub"),
+		RolesClaim:  envOr("AUTH_ROLES_CLAIM", "roles"),
+		TenantClaim: os.Getenv("AUTH_TENANT_CLAIM"),
+		PublicPaths: defaultPublicPaths,
+	}
+	if raw, ok := os.LookupEnv("AUTH_PUBLIC_PATHS"); ok {
+		a.PublicPaths = nil
+		for _, p := range strings.Split(raw, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				if _, err := path.Match(p, "/"); err != nil {
+					return nil, fmt.Errorf("invalid AUTH_PUBLIC_PATHS pattern %q: %w", p, err)
+				}
+				a.PublicPaths = append(a.PublicPaths, p)
+			}
+		}
+	}
+	slog.Info("JWT authentication enabled", "issuer", issuer, "jwks", verifier.Keys != nil, "secret", len(verifier.Secret) > 0)
+	return a, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// Middleware answers requests without a valid bearer token or session with
+// 401, and writes signed in by a session without its CSRF token with 403.
+// The token is read from the Authorization header, or from the access_token
+// query parameter of GET requests for clients that cannot set headers, e.g.
+// EventSource; without one the session cookie is read. Client identity
+// headers are always dropped; for a valid token they are set from its claims
+// and the request is scoped to its user and tenant.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(authz.SubjectHeader)
+		r.Header.Del(authz.RolesHeader)
+		if a.public(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var id Identity
+		var err error
+		if token := bearerToken(r); token != "" {
+			id, err = a.Authenticate(r.Context(), token)
+		} else if cookie, cookieErr := r.Cookie(SessionCookie); cookieErr == nil && a.Sessions != nil {
+			id, err = a.session(r, cookie.Value)
+			if errors.Is(err, ErrCSRF) {
+				accesslog.Logger(r.Context()).Info("Rejected a session write without its CSRF token", "method", r.Method, "path", r.URL.Path)
+				apierror.Write(w, err)
+				return
+			}
+			if err != nil && !errors.Is(err, ErrInvalidToken) {
+				accesslog.Logger(r.Context()).Error("Failed to get a session", "error", err)
+				apierror.Reply(w, "Failed to get session", http.StatusInternalServerError)
+				return
+			}
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="finchie"`)
+			apierror.Reply(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			accesslog.Logger(r.Context()).Info("Rejected a request token", "method", r.Method, "path", r.URL.Path, "error", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="finchie", error="invalid_token"`)
+			apierror.Reply(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		accesslog.Add(r.Context(), "user", id.User)
+		r.Header.Set(authz.SubjectHeader, id.User)
+		if len(id.Roles) > 0 {
+			r.Header.Set(authz.RolesHeader, strings.Join(id.Roles, ","))
+		}
+		ctx := statements.WithUser(r.Context(), id.User)
+		if id.Tenant != "" {
+			accesslog.Add(ctx, "tenant", id.Tenant)
+			ctx = statements.WithTenant(ctx, id.Tenant)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Identity is who a token names.
+type Identity struct {
+	User   string
+	Roles  []string
+	Tenant string
+}
+
+// Authenticate verifies the token and returns its identity.
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (Identity, error) {
+	claims, err := a.Verifier.Verify(ctx, token)
+	if err != nil {
+		return Identity{}, err
+	}
+	id := Identity{Roles: stringList(claim(claims, a.RolesClaim))}
+	id.User, _ = claim(claims, a.UserClaim).(string)
+	if id.User == "" {
+		return Identity{}, fmt.Errorf("%w: no %s claim", ErrInvalidToken, a.UserClaim)
+	}
+	if a.TenantClaim != "" {
+		id.Tenant, _ = claim(claims, a.TenantClaim).(string)
+		if id.Tenant == "" {
+			return Identity{}, fmt.Errorf("%w: no %s claim", ErrInvalidToken, a.TenantClaim)
+		}
+	}
+	return id, nil
+}
+
+// session returns the identity of a session cookie, ErrInvalidToken when it
+// has ended and ErrCSRF for writes without its CSRF token.
+func (a *Authenticator) session(r *http.Request, token string) (Identity, error) {
+	session, err := a.Sessions.Get(r.Context(), sessionID(token))
+	if err != nil {
+		return Identity{}, err
+	}
+	if session == nil || session.Pending {
+		return Identity{}, fmt.Errorf("%w: no session", ErrInvalidToken)
+	}
+	if err := checkCSRF(r, session); err != nil {
+		return Identity{}, err
+	}
+	return Identity{User: session.User, Roles: session.Roles, Tenant: session.Tenant}, nil
+}
+
+func (a *Authenticator) public(urlPath string) bool {
+	for _, pattern := range a.PublicPaths {
+		if ok, _ := path.Match(pattern, urlPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken takes the token out of the request, removing it from the query
+// so it is not logged with the URL.
+func bearerToken(r *http.Request) string {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	if r.Method != http.MethodGet {
+		return ""
+	}
+	query := r.URL.Query()
+	token := query.Get("access_token")
+	if token != "" {
+		query.Del("access_token")
+		r.URL.RawQuery = query.Encode()
+	}
+	return token
+}
+
+// claim reads a claim by its dotted path.
+func claim(claims Claims, name string) any {
+	var value any = map[string]any(claims)
+	for _, key := range strings.Split(name, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
@@ -0,0 +1,147 @@
+package authn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Session is a browser signed in through a login provider, or one on its way
+// there: a pending login keeps the PKCE verifier and nonce of its state until
+// the provider calls back.
+type Session struct {
+	// ID is the SHA-256 of the cookie value, which is never stored.
+	ID       string   `bson:"_id"`
+	User     string   `bson:"user,omitempty"`
+	Roles    []string `bson:"roles,omitempty"`
+	Tenant   string   `bson:"tenant,omitempty"`
+	Provider string   `bson:"provider"`
+	// CSRFToken is required on the writes the session signs in.
+	CSRFToken string `bson:"csrf_token,omitempty"`
+
+	// Pending marks a login waiting for the callback.
+	Pending  bool   `bson:"pending,omitempty"`
+	Verifier string `bson:"verifier,omitempty"`
+	Nonce    string `bson:"nonce,omitempty"`
+	Redirect string `bson:"redirect,omitempty"`
+
+	CreatedAt time.Time `bson:"created_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// SessionStore keeps the sessions; expired ones are never returned.
+type SessionStore interface {
+	// Get returns nil when the session does not exist or has expired.
+	Get(ctx context.Context, id string) (*Session, error)
+	Save(ctx context.Context, session *Session) error
+	Delete(ctx context.Context, id string) error
+}
+
+// NewSessionStore keeps the sessions next to the statements in MongoDB, or in
+// memory for the memory driver.
+func NewSessionStore(repo statements.StatementRepository) SessionStore {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoSessionStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemorySessionStore()
+}
+
+// newSessionToken returns a random cookie value and the session ID it
+// stands for.
+func newSessionToken() (token, id string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, sessionID(token), nil
+}
+
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]Session)}
+}
+
+func (s *MemorySessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	if !time.Now().Before(session.ExpiresAt) {
+		delete(s.sessions, id)
+		return nil, nil
+	}
+	return &session, nil
+}
+
+func (s *MemorySessionStore) Save(ctx context.Context, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.ID] = *session
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+	return nil
+}
+
+// MongoSessionStore keeps the sessions in the <namespace>sessions collection,
+// which a TTL index on expires_at empties.
+type MongoSessionStore struct {
+	sessions *mongo.Collection
+}
+
+func NewMongoSessionStore(db *mongo.Database, namespace string) *MongoSessionStore {
+	return &MongoSessionStore{sessions: db.Collection(namespace + "sessions")}
+}
+
+func (s *MongoSessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	var session Session
+	// the TTL monitor runs once a minute, expired sessions may linger
+	err := s.sessions.FindOne(ctx, bson.M{"_id": id, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *MongoSessionStore) Save(ctx context.Context, session *Session) error {
+	_, err := s.sessions.ReplaceOne(ctx, bson.M{"_id": session.ID}, session, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoSessionStore) Delete(ctx context.Context, id string) error {
+	_, err := s.sessions.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
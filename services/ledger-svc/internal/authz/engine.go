@@ -0,0 +1,122 @@
+// Package authz decides per request whether a subject may call an endpoint,
+// so permission checks live in one policy instead of in every handler.
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	ActionRead  = "read"
+	ActionWrite = "write"
+
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Input is what a policy decides on.
+type Input struct {
+	Subject string   `json:"subject"`
+	Roles   []string `json:"roles,omitempty"`
+	Action  string   `json:"action"`
+	Method  string   `json:"method"`
+	Path    string   `json:"path"`
+}
+
+type Decision struct {
+	Allow bool `json:"allow"`
+	// Rule names the rule that matched, empty when the default applied.
+	Rule string `json:"rule,omitempty"`
+}
+
+// Engine evaluates a policy. Implementations must be safe for concurrent use.
+type Engine interface {
+	Evaluate(ctx context.Context, input Input) Decision
+}
+
+// Rule matches when every non-empty field matches. Paths are exact, or
+// prefixes when they end in "/**"; "*" matches any role.
+type Rule struct {
+	Name     string   `json:"name"`
+	Effect   string   `json:"effect"`
+	Subjects []string `json:"subjects,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	Actions  []string `json:"actions,omitempty"`
+	Methods  []string `json:"methods,omitempty"`
+	Paths    []string `json:"paths,omitempty"`
+}
+
+// Policy is a list of rules evaluated in order, the first match decides.
+type Policy struct {
+	Default string `json:"default"`
+	Rules   []Rule `json:"rules"`
+}
+
+// RuleEngine evaluates a Policy.
+type RuleEngine struct {
+	policy Policy
+}
+
+func NewRuleEngine(policy Policy) (*RuleEngine, error) {
+	if policy.Default == "" {
+		policy.Default = EffectDeny
+	}
+	if policy.Default != EffectAllow && policy.Default != EffectDeny {
+		return nil, fmt.Errorf("invalid default effect %q, expected allow or deny", policy.Default)
+	}
+	for i, rule := range policy.Rules {
+		if rule.Effect != EffectAllow && rule.Effect != EffectDeny {
+			return nil, fmt.Errorf("rule %d (%s): invalid effect %q, expected allow or deny", i, rule.Name, rule.Effect)
+		}
+		if rule.Name == "" {
+			policy.Rules[i].Name = fmt.Sprintf("rule_%d", i)
+		}
+	}
+	return &RuleEngine{policy: policy}, nil
+}
+
+// LoadPolicyFile reads a JSON policy.
+func LoadPolicyFile(path string) (*RuleEngine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", path, err)
+	}
+	return NewRuleEngine(policy)
+}
+
+func (e *RuleEngine) Evaluate(_ context.Context, input Input) Decision {
+	for _, rule := range e.policy.Rules {
+		if rule.matches(input) {
+			return Decision{Allow: rule.Effect == EffectAllow, Rule: rule.Name}
+		}
+	}
+	return Decision{Allow: e.policy.Default == EffectAllow}
+}
+
+func (r *Rule) matches(input Input) bool {
+	return matchAny(r.Subjects, input.Subject) &&
+		(len(r.Roles) == 0 || slices.ContainsFunc(input.Roles, func(role string) bool { return matchAny(r.Roles, role) })) &&
+		matchAny(r.Actions, input.Action) &&
+		(len(r.Methods) == 0 || slices.ContainsFunc(r.Methods, func(m string) bool { return strings.EqualFold(m, input.Method) })) &&
+		(len(r.Paths) == 0 || slices.ContainsFunc(r.Paths, func(p string) bool { return matchPath(p, input.Path) }))
+}
+
+func matchAny(patterns []string, value string) bool {
+	return len(patterns) == 0 || slices.Contains(patterns, "*") || slices.Contains(patterns, value)
+}
+
+func matchPath(pattern, path string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return path == prefix || strings.HasPrefix(path, prefix+"/")
+	}
+	return pattern == path
+}
@@ -0,0 +1,97 @@
+package authz
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+// Identity headers, set from the token when the service authenticates, see
+// authn. Otherwise they are expected from an authenticating reverse proxy that
+// strips client values.
+const (
+	SubjectHeader = "X-Actor"
+	RolesHeader   = "X-Roles"
+)
+
+// DecisionLog selects which decisions are logged: all, deny or off.
+type DecisionLog string
+
+const (
+	LogAll  DecisionLog = "all"
+	LogDeny DecisionLog = "deny"
+	LogOff  DecisionLog = "off"
+)
+
+// FromEnv loads the policy in AUTHZ_POLICY_FILE; without one every request is
+// allowed, as before the engine existed. AUTHZ_DECISION_LOG defaults to deny.
+func FromEnv() (Engine, DecisionLog, error) {
+	logMode := DecisionLog(os.Getenv("AUTHZ_DECISION_LOG"))
+	switch logMode {
+	case "":
+		logMode = LogDeny
+	case LogAll, LogDeny, LogOff:
+	default:
+		return nil, "", fmt.Errorf("invalid AUTHZ_DECISION_LOG %q, expected all, deny or off", logMode)
+	}
+
+	path := os.Getenv("AUTHZ_POLICY_FILE")
+	if path == "" {
+		return nil, logMode, nil
+	}
+	engine, err := LoadPolicyFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	slog.Info("Authorization policy loaded", "file", path)
+	return engine, logMode, nil
+}
+
+// Middleware evaluates every request against the engine and answers denied
+// ones with 403.
+func Middleware(engine Engine, logMode DecisionLog, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		input := InputFromRequest(r)
+		decision := engine.Evaluate(r.Context(), input)
+
+		if logMode == LogAll || (logMode == LogDeny && !decision.Allow) {
+			accesslog.Logger(r.Context()).Info("Authorization decision",
+				"allow", decision.Allow, "rule", decision.Rule,
+				"subject", input.Subject, "roles", input.Roles,
+				"action", input.Action, "method", input.Method, "path", input.Path)
+		}
+
+		if !decision.Allow {
+			apierror.Reply(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func InputFromRequest(r *http.Request) Input {
+	input := Input{
+		Subject: r.Header.Get(SubjectHeader),
+		Action:  ActionWrite,
+		Method:  r.Method,
+		Path:    r.URL.Path,
+	}
+	if input.Subject == "" {
+		input.Subject = "anonymous"
+	}
+	for role := range strings.SplitSeq(r.Header.Get(RolesHeader), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			input.Roles = append(input.Roles, role)
+		}
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		input.Action = ActionRead
+	}
+	return input
+}
@@ -0,0 +1,201 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+// Permission is what a route needs from the roles of the subject.
+type Permission string
+
+const (
+	// PermPublic marks the routes served to anyone, e.g. the health check.
+	PermPublic          Permission = ""
+	PermReadStatements  Permission = "statements:read"
+	PermWriteStatements Permission = "statements:write"
+	PermManageBudgets   Permission = "budgets:manage"
+	PermAdmin           Permission = "admin"
+)
+
+const (
+	RoleReader = "reader"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// RolePermissions grants the permissions of each role.
+var RolePermissions = map[string][]Permission{
+	RoleReader: {PermReadStatements},
+	RoleEditor: {PermReadStatements, PermWriteStatements, PermManageBudgets},
+	RoleAdmin:  {PermReadStatements, PermWriteStatements, PermManageBudgets, PermAdmin},
+}
+
+// RoutePermissions maps the patterns routes are registered with to the
+// permission they need. Routes not listed need statements:read for GET and
+// HEAD, statements:write otherwise.
+var RoutePermissions = map[string]Permission{
+	"/healthz":                          PermPublic,
+	"/readyz":                           PermPublic,
+	"GET /api/docs":                     PermPublic,
+	"GET /api/docs/openapi.json":        PermPublic,
+	"GET /auth/login":                   PermPublic,
+	"GET /auth/callback":                PermPublic,
+	"POST /auth/logout":                 PermPublic,
+	"GET /auth/session":                 PermPublic,
+	"/graphql":                          PermReadStatements,
+	"GET /metrics":                      PermAdmin,
+	"POST /api/budgets":                 PermManageBudgets,
+	"PUT /api/budgets/{id}":             PermManageBudgets,
+	"DELETE /api/budgets/{id}":          PermManageBudgets,
+	"GET /api/audit":                    PermAdmin,
+	"GET /api/webhooks":                 PermAdmin,
+	"POST /api/webhooks":                PermAdmin,
+	"GET /api/webhooks/{id}":            PermAdmin,
+	"PUT /api/webhooks/{id}":            PermAdmin,
+	"DELETE /api/webhooks/{id}":         PermAdmin,
+	"GET /api/webhooks/{id}/deliveries": PermAdmin,
+	"POST /api/webhooks/{id}/deliveries/{delivery}/redeliver": PermAdmin,
+	"GET /api/roles":                          PermAdmin,
+	"GET /api/roles/assignments":              PermAdmin,
+	"PUT /api/roles/assignments/{subject}":    PermAdmin,
+	"DELETE /api/roles/assignments/{subject}": PermAdmin,
+	"DELETE /api/users/{id}/data":             PermAdmin,
+	"GET /api/erasures/{id}":                  PermAdmin,
+	"GET /api/jobs":                           PermAdmin,
+	"GET /api/jobs/{name}":                    PermAdmin,
+	"POST /api/jobs/{name}/run":               PermAdmin,
+	// verified by the provider signature
+	"POST /api/aggregator/providers/{provider}/webhooks": PermPublic,
+	// verified by the URL signature
+	"GET /api/attachments/{id}/content": PermPublic,
+}
+
+// RBAC grants the subjects of the requests the permissions of their roles:
+// the roles of the identity headers, those assigned in Assignments and, for
+// subjects with neither, DefaultRoles.
+type RBAC struct {
+	// Mux resolves requests to the patterns of RoutePermissions.
+	Mux          *http.ServeMux
+	Assignments  RoleStore
+	DefaultRoles []string
+	// Admins are subjects that are always admins, so a deployment can
+	// assign the first roles.
+	Admins []string
+}
+
+// RBACFromEnv enables role-based access control when RBAC_ENABLED is true.
+// RBAC_DEFAULT_ROLE, reader unless set, is given to subjects without roles,
+// none when empty; RBAC_ADMINS lists the subjects that are always admins.
+// The roles are read from the identity headers, so it refuses to enable
+// unless the service authenticates, which replaces the client values, or
+// RBAC_TRUST_PROXY declares an authenticating proxy that strips them.
+func RBACFromEnv(mux *http.ServeMux, assignments RoleStore, authenticated bool) (*RBAC, error) {
+	if os.Getenv("RBAC_ENABLED") != "true" {
+		return nil, nil
+	}
+	if !authenticated && os.Getenv("RBAC_TRUST_PROXY") != "true" {
+		return nil, fmt.Errorf("RBAC_ENABLED without authentication trusts the %s and %s headers of any client, "+
+			"configure authentication or set RBAC_TRUST_PROXY=true behind an authenticating proxy", SubjectHeader, RolesHeader)
+	}
+	rbac := &RBAC{Mux: mux, Assignments: assignments, DefaultRoles: []string{RoleReader}}
+	if role, ok := os.LookupEnv("RBAC_DEFAULT_ROLE"); ok {
+		rbac.DefaultRoles = nil
+		if role != "" {
+			if _, known := RolePermissions[role]; !known {
+				return nil, fmt.Errorf("invalid RBAC_DEFAULT_ROLE %q, expected reader, editor or admin", role)
+			}
+			rbac.DefaultRoles = []string{role}
+		}
+	}
+	for subject := range strings.SplitSeq(os.Getenv("RBAC_ADMINS"), ",") {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			rbac.Admins = append(rbac.Admins, subject)
+		}
+	}
+	slog.Info("Role-based access control enabled", "default_roles", rbac.DefaultRoles, "admins", len(rbac.Admins))
+	return rbac, nil
+}
+
+// Permission returns the permission the request needs.
+func (a *RBAC) Permission(r *http.Request) Permission {
+	if _, pattern := a.Mux.Handler(r); pattern != "" {
+		if perm, ok := RoutePermissions[pattern]; ok {
+			return perm
+		}
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return PermReadStatements
+	}
+	return PermWriteStatements
+}
+
+// Roles returns the known roles of the subject, from the identity headers,
+// the assignments and the defaults in that order.
+func (a *RBAC) Roles(ctx context.Context, subject string, headerRoles []string) ([]string, error) {
+	var roles []string
+	if slices.Contains(a.Admins, subject) {
+		roles = append(roles, RoleAdmin)
+	}
+	for _, role := range headerRoles {
+		if _, known := RolePermissions[role]; known {
+			roles = append(roles, role)
+		}
+	}
+	assigned, err := a.Assignments.Get(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	if assigned != nil {
+		roles = append(roles, assigned.Roles...)
+	}
+	if len(roles) == 0 {
+		roles = a.DefaultRoles
+	}
+	return slices.Compact(slices.Sorted(slices.Values(roles))), nil
+}
+
+// Granted reports whether one of the roles has the permission.
+func Granted(roles []string, perm Permission) bool {
+	if perm == PermPublic {
+		return true
+	}
+	return slices.ContainsFunc(roles, func(role string) bool {
+		return slices.Contains(RolePermissions[role], perm)
+	})
+}
+
+// Middleware answers requests the roles of their subject do not permit with
+// 403. It reads the same identity headers as the policy middleware.
+func (a *RBAC) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		perm := a.Permission(r)
+		if perm == PermPublic {
+			next.ServeHTTP(w, r)
+			return
+		}
+		input := InputFromRequest(r)
+		roles, err := a.Roles(r.Context(), input.Subject, input.Roles)
+		if err != nil {
+			accesslog.Logger(r.Context()).Error("Failed to get role assignments", "subject", input.Subject, "error", err)
+			apierror.Reply(w, "Failed to check permissions", http.StatusInternalServerError)
+			return
+		}
+		if !Granted(roles, perm) {
+			accesslog.Logger(r.Context()).Info("Permission denied",
+				"subject", input.Subject, "roles", roles, "permission", perm,
+				"method", r.Method, "path", r.URL.Path)
+			apierror.Reply(w, fmt.Sprintf("Forbidden: %s permission required", perm), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,96 @@
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/ingest"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/jsonbody"
+)
+
+// RolesHandler serves the roles and their assignment, for admins.
+type RolesHandler struct {
+	Store RoleStore
+}
+
+// RolesListHandler serves GET /api/roles, the roles and their permissions.
+func (h *RolesHandler) RolesListHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, RolePermissions)
+}
+
+// ListHandler serves GET /api/roles/assignments.
+func (h *RolesHandler) ListHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Store.List(r.Context())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list role assignments", "error", err)
+		apierror.Reply(w, "Failed to list role assignments", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// PutHandler serves PUT /api/roles/assignments/{subject} with {"roles":
+// [...]}, replacing the roles of the subject.
+func (h *RolesHandler) PutHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Roles []string `json:"roles"`
+	}
+	if err := jsonbody.Decode(w, r, &req); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	if len(req.Roles) == 0 {
+		apierror.Write(w, jsonbody.Invalid("Invalid role assignment payload", ingest.ValidationError{Path: "$.roles", Message: "is required"}))
+		return
+	}
+	for _, role := range req.Roles {
+		if _, known := RolePermissions[role]; !known {
+			apierror.Reply(w, fmt.Sprintf("Unknown role %q, expected reader, editor or admin", role), http.StatusBadRequest)
+			return
+		}
+	}
+	assignment := &Assignment{
+		Subject:   r.PathValue("subject"),
+		Roles:     slices.Compact(slices.Sorted(slices.Values(req.Roles))),
+		UpdatedAt: time.Now().UTC(),
+	}
+	if err := h.Store.Save(r.Context(), assignment); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to save role assignment", "error", err)
+		apierror.Reply(w, "Failed to save role assignment", http.StatusInternalServerError)
+		return
+	}
+	accesslog.Logger(r.Context()).Info("Assigned roles", "subject", assignment.Subject, "roles", assignment.Roles, "by", r.Header.Get(SubjectHeader))
+	writeJSON(w, http.StatusOK, assignment)
+}
+
+// DeleteHandler serves DELETE /api/roles/assignments/{subject}; the subject
+// keeps the roles of its token and the defaults.
+func (h *RolesHandler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	subject := r.PathValue("subject")
+	deleted, err := h.Store.Delete(r.Context(), subject)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to delete role assignment", "error", err)
+		apierror.Reply(w, "Failed to delete role assignment", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		apierror.Reply(w, "Role assignment not found", http.StatusNotFound)
+		return
+	}
+	accesslog.Logger(r.Context()).Info("Removed role assignment", "subject", subject, "by", r.Header.Get(SubjectHeader))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
@@ -0,0 +1,140 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Assignment gives a subject roles.
+type Assignment struct {
+	Subject   string    `bson:"_id" json:"subject"`
+	Roles     []string  `bson:"roles" json:"roles"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// RoleStore keeps the role assignments.
+type RoleStore interface {
+	// List returns the assignments by subject.
+	List(ctx context.Context) ([]Assignment, error)
+	// Get returns nil when the subject has no assignment.
+	Get(ctx context.Context, subject string) (*Assignment, error)
+	Save(ctx context.Context, assignment *Assignment) error
+	// Delete returns false when the subject had no assignment.
+	Delete(ctx context.Context, subject string) (bool, error)
+}
+
+// NewRoleStore keeps the assignments next to the statements in MongoDB, or in
+// memory for the memory driver.
+func NewRoleStore(repo statements.StatementRepository) RoleStore {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoRoleStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryRoleStore()
+}
+
+type MemoryRoleStore struct {
+	mu          sync.RWMutex
+	assignments map[string]Assignment
+}
+
+func NewMemoryRoleStore() *MemoryRoleStore {
+	return &MemoryRoleStore{assignments: make(map[string]Assignment)}
+}
+
+func (s *MemoryRoleStore) List(ctx context.Context) ([]Assignment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Assignment, 0, len(s.assignments))
+	for _, a := range s.assignments {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Subject < list[j].Subject })
+	return list, nil
+}
+
+func (s *MemoryRoleStore) Get(ctx context.Context, subject string) (*Assignment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.assignments[subject]
+	if !ok {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+func (s *MemoryRoleStore) Save(ctx context.Context, assignment *Assignment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.assignments[assignment.Subject] = *assignment
+	return nil
+}
+
+func (s *MemoryRoleStore) Delete(ctx context.Context, subject string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.assignments[subject]
+	delete(s.assignments, subject)
+	return ok, nil
+}
+
+// MongoRoleStore keeps the assignments in the <namespace>role_assignments
+// collection.
+type MongoRoleStore struct {
+	assignments *mongo.Collection
+}
+
+func NewMongoRoleStore(db *mongo.Database, namespace string) *MongoRoleStore {
+	return &MongoRoleStore{assignments: db.Collection(namespace + "role_assignments")}
+}
+
+func (s *MongoRoleStore) List(ctx context.Context) ([]Assignment, error) {
+	cursor, err := s.assignments.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	list := []Assignment{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *MongoRoleStore) Get(ctx context.Context, subject string) (*Assignment, error) {
+	var a Assignment
+	err := s.assignments.FindOne(ctx, bson.M{"_id": subject}).Decode(&a)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *MongoRoleStore) Save(ctx context.Context, assignment *Assignment) error {
+	_, err := s.assignments.ReplaceOne(ctx, bson.M{"_id": assignment.Subject}, assignment, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoRoleStore) Delete(ctx context.Context, subject string) (bool, error) {
+	res, err := s.assignments.DeleteOne(ctx, bson.M{"_id": subject})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
@@ -0,0 +1,367 @@
+// Package backup dumps the collections of a namespace into a tar.gz archive
+// and restores them, the supported backup path for self-hosted instances.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	formatVersion  = 1
+	manifestName   = "manifest.json"
+	collectionsDir = "collections"
+	restoreSuffix  = "__restore"
+)
+
+// Manifest describes an archive. Collection names are stored without the
+// namespace, so a backup can be restored into another namespace.
+type Manifest struct {
+	Version     int                   `json:"version"`
+	CreatedAt   time.Time             `json:"created_at"`
+	Database    string                `json:"database"`
+	Namespace   string                `json:"namespace"`
+	Snapshot    bool                  `json:"snapshot"`
+	Collections map[string]Collection `json:"collections"`
+}
+
+type Collection struct {
+	Documents int `json:"documents"`
+	// Indexes are the index specifications without the _id index.
+	Indexes []bson.Raw `json:"-"`
+}
+
+// Backup writes every collection of the namespace to w. All collections are
+// read at one point in time through a snapshot session; a standalone server
+// does not support those, so the backup falls back to plain reads and is only
+// consistent while nothing writes, which the manifest records.
+func Backup(ctx context.Context, db *mongo.Database, namespace string, w io.Writer) (*Manifest, error) {
+	names, err := collectionNames(ctx, db, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Version:     formatVersion,
+		CreatedAt:   time.Now().UTC(),
+		Database:    db.Name(),
+		Namespace:   namespace,
+		Snapshot:    true,
+		Collections: make(map[string]Collection, len(names)),
+	}
+
+	session, err := db.Client().StartSession(options.Session().SetSnapshot(true))
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+	var readCtx context.Context = mongo.NewSessionContext(ctx, session)
+	probe := db.Collection(namespace+names[0]).FindOne(readCtx, bson.M{}).Err()
+	if probe != nil && !errors.Is(probe, mongo.ErrNoDocuments) {
+		slog.Warn("Snapshot reads are not supported, stop writers for a consistent backup", "error", probe)
+		manifest.Snapshot = false
+		readCtx = ctx
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		col := db.Collection(namespace + name)
+		collection, err := dumpCollection(readCtx, col, tw, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to back up %s: %w", name, err)
+		}
+		// listIndexes is not allowed in a snapshot session
+		if collection.Indexes, err = listIndexes(ctx, col); err != nil {
+			return nil, fmt.Errorf("failed to back up the indexes of %s: %w", name, err)
+		}
+		manifest.Collections[name] = collection
+		if err := writeIndexes(tw, name, collection.Indexes); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(tw, manifestName, data); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, gz.Close()
+}
+
+func collectionNames(ctx context.Context, db *mongo.Database, namespace string) ([]string, error) {
+	all, err := db.ListCollectionNames(ctx, bson.M{"type": "collection"})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range all {
+		if strings.HasPrefix(name, namespace) && !strings.HasSuffix(name, restoreSuffix) && !strings.HasPrefix(name, "system.") {
+			names = append(names, strings.TrimPrefix(name, namespace))
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no collections found for namespace %q", namespace)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// dumpCollection writes the documents as concatenated BSON, the mongodump
+// layout. The tar header needs the size up front, so they are spooled to a
+// temporary file first.
+func dumpCollection(ctx context.Context, col *mongo.Collection, tw *tar.Writer, name string) (Collection, error) {
+	var collection Collection
+
+	spool, err := os.CreateTemp("", "finchie-backup-*.bson")
+	if err != nil {
+		return collection, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	cursor, err := col.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return collection, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		if _, err := spool.Write(cursor.Current); err != nil {
+			return collection, err
+		}
+		collection.Documents++
+	}
+	if err := cursor.Err(); err != nil {
+		return collection, err
+	}
+
+	info, err := spool.Stat()
+	if err != nil {
+		return collection, err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return collection, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: path.Join(collectionsDir, name+".bson"), Mode: 0o600, Size: info.Size(), ModTime: time.Now()}); err != nil {
+		return collection, err
+	}
+	_, err = io.Copy(tw, spool)
+	return collection, err
+}
+
+func listIndexes(ctx context.Context, col *mongo.Collection) ([]bson.Raw, error) {
+	cursor, err := col.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var specs []bson.Raw
+	for cursor.Next(ctx) {
+		if name, _ := cursor.Current.Lookup("name").StringValueOK(); name != "_id_" {
+			specs = append(specs, append(bson.Raw(nil), cursor.Current...))
+		}
+	}
+	return specs, cursor.Err()
+}
+
+func writeIndexes(tw *tar.Writer, name string, indexes []bson.Raw) error {
+	var data []byte
+	for _, index := range indexes {
+		data = append(data, index...)
+	}
+	return writeFile(tw, path.Join(collectionsDir, name+".indexes.bson"), data)
+}
+
+func writeFile(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// Restore replaces the collections of the namespace with the ones in the
+// archive. Every collection is loaded into a temporary collection with its
+// indexes first and only renamed over the live one once the whole archive
+// was read, so a broken archive leaves the data untouched. Collections that
+// are not in the archive are kept.
+func Restore(ctx context.Context, db *mongo.Database, namespace string, r io.Reader) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var manifest *Manifest
+	indexes := map[string][]bson.Raw{}
+	var loaded []string
+	cleanup := func() {
+		for _, name := range loaded {
+			if err := db.Collection(namespace + name + restoreSuffix).Drop(ctx); err != nil {
+				slog.Warn("Failed to drop temporary restore collection", "collection", name, "error", err)
+			}
+		}
+	}
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+
+		switch name := header.Name; {
+		case name == manifestName:
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				cleanup()
+				return nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+		case strings.HasSuffix(name, ".indexes.bson"):
+			specs, err := readDocuments(tr)
+			if err != nil {
+				cleanup()
+				return nil, err
+			}
+			indexes[collectionOf(name, ".indexes.bson")] = specs
+		case strings.HasSuffix(name, ".bson"):
+			collection := collectionOf(name, ".bson")
+			loaded = append(loaded, collection)
+			if err := loadCollection(ctx, db.Collection(namespace+collection+restoreSuffix), tr); err != nil {
+				cleanup()
+				return nil, fmt.Errorf("failed to restore %s: %w", collection, err)
+			}
+		}
+	}
+
+	if manifest == nil {
+		cleanup()
+		return nil, errors.New("archive has no manifest")
+	}
+	if manifest.Version != formatVersion {
+		cleanup()
+		return nil, fmt.Errorf("unsupported backup format version %d", manifest.Version)
+	}
+
+	for _, name := range loaded {
+		if err := createIndexes(ctx, db.Collection(namespace+name+restoreSuffix), indexes[name]); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("failed to restore indexes of %s: %w", name, err)
+		}
+	}
+	for _, name := range loaded {
+		err := db.Client().Database("admin").RunCommand(ctx, bson.D{
+			{Key: "renameCollection", Value: db.Name() + "." + namespace + name + restoreSuffix},
+			{Key: "to", Value: db.Name() + "." + namespace + name},
+			{Key: "dropTarget", Value: true},
+		}).Err()
+		if err != nil {
+			return nil, fmt.Errorf("failed to replace %s: %w", name, err)
+		}
+	}
+	return manifest, nil
+}
+
+func collectionOf(name, suffix string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(name, collectionsDir+"/"), suffix)
+}
+
+func loadCollection(ctx context.Context, col *mongo.Collection, r io.Reader) error {
+	if err := col.Drop(ctx); err != nil {
+		return err
+	}
+	// an empty collection still has to exist to replace the live one
+	if err := col.Database().CreateCollection(ctx, col.Name()); err != nil {
+		return err
+	}
+
+	const batchSize = 1000
+	batch := make([]any, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := col.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false))
+		batch = batch[:0]
+		return err
+	}
+	for {
+		doc, err := bson.ReadDocument(r)
+		if errors.Is(err, io.EOF) {
+			return flush()
+		}
+		if err != nil {
+			return err
+		}
+		batch = append(batch, doc)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func readDocuments(r io.Reader) ([]bson.Raw, error) {
+	var docs []bson.Raw
+	for {
+		doc, err := bson.ReadDocument(r)
+		if errors.Is(err, io.EOF) {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+}
+
+func createIndexes(ctx context.Context, col *mongo.Collection, specs []bson.Raw) error {
+	if len(specs) == 0 {
+		return nil
+	}
+	indexes := make(bson.A, len(specs))
+	for i, spec := range specs {
+		// the namespace of the dumped collection does not apply here
+		var index bson.D
+		if err := bson.Unmarshal(spec, &index); err != nil {
+			return err
+		}
+		filtered := index[:0]
+		for _, field := range index {
+			if field.Key != "ns" && field.Key != "v" {
+				filtered = append(filtered, field)
+			}
+		}
+		indexes[i] = filtered
+	}
+	return col.Database().RunCommand(ctx, bson.D{
+		{Key: "createIndexes", Value: col.Name()},
+		{Key: "indexes", Value: indexes},
+	}).Err()
+}
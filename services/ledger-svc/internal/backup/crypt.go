@@ -0,0 +1,215 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Encrypted archives are the archive sealed with AES-256-GCM in chunks, so
+// they are written and read as a stream: the magic, a random nonce prefix,
+// then chunks of a 4 byte length and the sealed data. The nonce of a chunk is
+// the prefix and the chunk number, and the last chunk is flagged in its
+// length and authenticated data, so a truncated archive does not decrypt.
+const (
+	encryptedMagic = "FNCHBAK1"
+	chunkSize      = 64 << 10
+	noncePrefixLen = 8
+	lastChunkFlag  = 1 << 31
+)
+
+var (
+	ErrNoKey          = errors.New("the archive is encrypted, set BACKUP_ENCRYPTION_KEY")
+	ErrCorruptArchive = errors.New("encrypted archive is corrupt or truncated")
+)
+
+// KeyFromEnv reads BACKUP_ENCRYPTION_KEY, a base64 AES-256 key, nil when it is
+// not set.
+func KeyFromEnv() ([]byte, error) {
+	encoded := os.Getenv("BACKUP_ENCRYPTION_KEY")
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BACKUP_ENCRYPTION_KEY: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("BACKUP_ENCRYPTION_KEY has %d bytes, AES-256 needs 32", len(key))
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	n      uint32
+	buf    []byte
+}
+
+// Encrypt returns a writer sealing what is written into w. Close writes the
+// last chunk and must be called.
+func Encrypt(w io.Writer, key []byte) (io.WriteCloser, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, noncePrefixLen)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, encryptedMagic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, prefix: prefix, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.buf == nil {
+		return 0, errors.New("encrypted archive already closed")
+	}
+	written := 0
+	for len(p) > 0 {
+		// a full chunk is only sealed once more follows, the last one is
+		// sealed by Close
+		if len(e.buf) == chunkSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := min(len(p), chunkSize-len(e.buf))
+		e.buf = append(e.buf, p[:n]...)
+		p, written = p[n:], written+n
+	}
+	return written, nil
+}
+
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	if e.buf == nil {
+		return errors.New("encrypted archive already closed")
+	}
+	sealed := e.aead.Seal(nil, chunkNonce(e.prefix, e.n), e.buf, chunkAD(last))
+	length := uint32(len(sealed))
+	if last {
+		length |= lastChunkFlag
+	}
+	if err := binary.Write(e.w, binary.BigEndian, length); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+	e.n++
+	e.buf = e.buf[:0]
+	if last {
+		e.buf = nil
+	}
+	return nil
+}
+
+func chunkNonce(prefix []byte, n uint32) []byte {
+	nonce := make([]byte, noncePrefixLen+4)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixLen:], n)
+	return nonce
+}
+
+func chunkAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+type decryptReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	n      uint32
+	buf    []byte
+	done   bool
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	var length uint32
+	if err := binary.Read(d.r, binary.BigEndian, &length); err != nil {
+		return ErrCorruptArchive
+	}
+	last := length&lastChunkFlag != 0
+	length &^= lastChunkFlag
+	if length > chunkSize+uint32(d.aead.Overhead()) {
+		return ErrCorruptArchive
+	}
+	sealed := make([]byte, length)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return ErrCorruptArchive
+	}
+	plain, err := d.aead.Open(sealed[:0], chunkNonce(d.prefix, d.n), sealed, chunkAD(last))
+	if err != nil {
+		return ErrCorruptArchive
+	}
+	d.n++
+	d.buf, d.done = plain, last
+	return nil
+}
+
+// OpenArchive returns the archive of r, decrypting it with key when it was
+// encrypted, so Restore reads both kinds.
+func OpenArchive(r io.Reader, key []byte) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(encryptedMagic))
+	if err != nil || !bytes.Equal(magic, []byte(encryptedMagic)) {
+		// too short to be encrypted, gzip reports what is wrong with it
+		return br, nil
+	}
+	if key == nil {
+		return nil, ErrNoKey
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, len(encryptedMagic)+noncePrefixLen)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, ErrCorruptArchive
+	}
+	return &decryptReader{r: br, aead: aead, prefix: header[len(encryptedMagic):]}, nil
+}
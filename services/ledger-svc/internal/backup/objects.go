@@ -0,0 +1,186 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Object is an archive kept in an ObjectStore.
+type Object struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// ObjectStore keeps the scheduled archives off the database host.
+type ObjectStore interface {
+	Put(ctx context.Context, name string, r io.ReadSeeker) error
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// List returns the objects by name.
+	List(ctx context.Context) ([]Object, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// OpenObjectStore opens the store of a BACKUP_TARGET: s3://<bucket>/<prefix>
+// for S3 or an S3-compatible service at BACKUP_S3_ENDPOINT, with the
+// credentials of the standard AWS environment, or a directory, e.g. a mounted
+// network share, as file://<path> or a plain path.
+func OpenObjectStore(ctx context.Context, target string) (ObjectStore, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme == "" || u.Scheme == "file" {
+		dir := target
+		if err == nil && u.Scheme == "file" {
+			dir = u.Path
+		}
+		return NewDirStore(dir)
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("invalid backup target %q, expected s3://<bucket>/<prefix> or a directory", target)
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint := os.Getenv("BACKUP_S3_ENDPOINT"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			// MinIO and most S3-compatible services expect path-style URLs
+			o.UsePathStyle = true
+		}
+	})
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3Store{client: client, bucket: u.Host, prefix: prefix}, nil
+}
+
+// DirStore keeps the archives as files of a directory.
+type DirStore struct {
+	dir string
+}
+
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+// Put writes next to the target and renames, so a partial upload is never
+// listed.
+func (s *DirStore) Put(ctx context.Context, name string, r io.ReadSeeker) error {
+	tmp, err := os.CreateTemp(s.dir, "."+name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
+
+func (s *DirStore) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.dir, filepath.Base(name)))
+}
+
+func (s *DirStore) List(ctx context.Context) ([]Object, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var objects []Object
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, Object{Name: entry.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return objects, nil
+}
+
+func (s *DirStore) Delete(ctx context.Context, name string) error {
+	return os.Remove(filepath.Join(s.dir, filepath.Base(name)))
+}
+
+// S3Store keeps the archives under a prefix of a bucket.
+type S3Store struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func (s *S3Store) Put(ctx context.Context, name string, r io.ReadSeeker) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.prefix + name),
+		Body:        r,
+		ContentType: aws.String("application/octet-stream"),
+	})
+	return err
+}
+
+func (s *S3Store) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (s *S3Store) List(ctx context.Context) ([]Object, error) {
+	var objects []Object
+	pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Contents {
+			name := strings.TrimPrefix(aws.ToString(item.Key), s.prefix)
+			// objects of nested prefixes are not ours
+			if name == "" || strings.Contains(name, "/") {
+				continue
+			}
+			objects = append(objects, Object{Name: name, Size: aws.ToInt64(item.Size), ModTime: aws.ToTime(item.LastModified)})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, name string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+	})
+	return err
+}
@@ -0,0 +1,335 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/health"
+)
+
+const (
+	objectPrefix = "finchie-"
+	objectLayout = "20060102T150405Z"
+	objectSuffix = ".tar.gz.enc"
+
+	// staleAfter is how old the last backup may get before the health check
+	// reports it, a day and some slack for a slow run.
+	staleAfter = 26 * time.Hour
+)
+
+// Scheduler writes an encrypted archive to the object store every night and
+// rotates the old ones: the newest archive of each of the last Daily days and
+// of each of the last Monthly months is kept, the others are deleted. Objects
+// it did not name are left alone.
+type Scheduler struct {
+	DB        *mongo.Database
+	Namespace string
+	Store     ObjectStore
+	Key       []byte
+	// At is the time of day in UTC the backup runs, as an offset from
+	// midnight.
+	At      time.Duration
+	Daily   int
+	Monthly int
+
+	mu     sync.Mutex
+	status Status
+}
+
+// Status is the outcome of the last runs, reported by the health check.
+type Status struct {
+	LastAttempt *time.Time
+	LastSuccess *time.Time
+	LastObject  string
+	LastSize    int64
+	// Snapshot is whether the last archive was read at one point in time,
+	// see Backup.
+	Snapshot  bool
+	LastError string
+	Kept      int
+}
+
+// NewSchedulerFromEnv schedules backups to BACKUP_TARGET, nil when it is not
+// set. BACKUP_ENCRYPTION_KEY is required; BACKUP_TIME (HH:MM, UTC) defaults to
+// 03:00, BACKUP_KEEP_DAILY to 7 and BACKUP_KEEP_MONTHLY to 12.
+func NewSchedulerFromEnv(ctx context.Context, db *mongo.Database, namespace string) (*Scheduler, error) {
+	target := os.Getenv("BACKUP_TARGET")
+	if target == "" {
+		return nil, nil
+	}
+	key, err := KeyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, errors.New("BACKUP_TARGET needs BACKUP_ENCRYPTION_KEY, backups are never stored in the clear")
+	}
+
+	at := 3 * time.Hour
+	if v := os.Getenv("BACKUP_TIME"); v != "" {
+		t, err := time.Parse("15:04", v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BACKUP_TIME %q, expected HH:MM", v)
+		}
+		at = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	store, err := OpenObjectStore(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	return &Scheduler{
+		DB:        db,
+		Namespace: namespace,
+		Store:     store,
+		Key:       key,
+		At:        at,
+		Daily:     envCount("BACKUP_KEEP_DAILY", 7),
+		Monthly:   envCount("BACKUP_KEEP_MONTHLY", 12),
+	}, nil
+}
+
+func envCount(name string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || n < 0 {
+		return fallback
+	}
+	return n
+}
+
+// Run backs up at At every day. It starts with an immediate run when the
+// newest archive in the store is older than a day, e.g. after downtime over
+// the scheduled time.
+func (s *Scheduler) Run(ctx context.Context) {
+	latest, err := s.latest(ctx)
+	if err != nil {
+		slog.Warn("Failed to list the scheduled backups", "error", err)
+	}
+	if latest != nil {
+		s.mu.Lock()
+		s.status.LastSuccess, s.status.LastObject, s.status.LastSize = &latest.ModTime, latest.Name, latest.Size
+		s.mu.Unlock()
+	}
+	if err == nil && (latest == nil || time.Since(latest.ModTime) > 24*time.Hour) {
+		s.runLogged(ctx, time.Now().UTC())
+	}
+
+	for {
+		now := time.Now().UTC()
+		timer := time.NewTimer(s.next(now).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.runLogged(ctx, time.Now().UTC())
+	}
+}
+
+// next returns the first scheduled time after now.
+func (s *Scheduler) next(now time.Time) time.Time {
+	t := now.Truncate(24 * time.Hour).Add(s.At)
+	if !t.After(now) {
+		t = t.Add(24 * time.Hour)
+	}
+	return t
+}
+
+func (s *Scheduler) runLogged(ctx context.Context, now time.Time) {
+	if err := s.RunOnce(ctx, now); err != nil {
+		slog.Error("Scheduled backup failed", "error", err)
+	}
+}
+
+// RunOnce writes an archive named after now and rotates the store. Another
+// instance having backed up since the last scheduled time makes it a no-op,
+// so replicas do not upload the same night twice.
+func (s *Scheduler) RunOnce(ctx context.Context, now time.Time) (err error) {
+	s.mu.Lock()
+	s.status.LastAttempt = &now
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err != nil {
+			s.status.LastError = err.Error()
+		}
+	}()
+
+	latest, err := s.latest(ctx)
+	if err != nil {
+		return err
+	}
+	if latest != nil && !latest.ModTime.Before(s.next(now).Add(-24*time.Hour)) {
+		slog.Info("Backup already taken by another instance", "object", latest.Name)
+		s.succeeded(latest.ModTime, latest.Name, latest.Size, true)
+		return nil
+	}
+
+	spool, err := os.CreateTemp("", "finchie-backup-*"+objectSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	w, err := Encrypt(spool, s.Key)
+	if err != nil {
+		return err
+	}
+	manifest, err := Backup(ctx, s.DB, s.Namespace, w)
+	if err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	size, err := spool.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	name := objectPrefix + now.UTC().Format(objectLayout) + objectSuffix
+	if err := s.Store.Put(ctx, name, spool); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", name, err)
+	}
+	slog.Info("Scheduled backup written", "object", name, "bytes", size, "collections", len(manifest.Collections), "snapshot", manifest.Snapshot)
+	s.succeeded(now, name, size, manifest.Snapshot)
+
+	return s.rotate(ctx)
+}
+
+func (s *Scheduler) succeeded(at time.Time, name string, size int64, snapshot bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.LastSuccess, s.status.LastObject, s.status.LastSize, s.status.Snapshot = &at, name, size, snapshot
+	s.status.LastError = ""
+}
+
+func (s *Scheduler) rotate(ctx context.Context) error {
+	objects, err := s.Store.List(ctx)
+	if err != nil {
+		return err
+	}
+	keep, expired := Retain(objects, s.Daily, s.Monthly)
+	for _, o := range expired {
+		if err := s.Store.Delete(ctx, o.Name); err != nil {
+			return fmt.Errorf("failed to delete the expired backup %s: %w", o.Name, err)
+		}
+		slog.Info("Expired backup deleted", "object", o.Name)
+	}
+	s.mu.Lock()
+	s.status.Kept = len(keep)
+	s.mu.Unlock()
+	return nil
+}
+
+// latest returns the newest archive of the store, nil when there is none.
+func (s *Scheduler) latest(ctx context.Context) (*Object, error) {
+	objects, err := s.Store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var latest *Object
+	for i := range objects {
+		taken, ok := takenAt(objects[i].Name)
+		if !ok {
+			continue
+		}
+		if latest == nil || taken.After(latest.ModTime) {
+			o := objects[i]
+			o.ModTime = taken
+			latest = &o
+		}
+	}
+	return latest, nil
+}
+
+// takenAt reads the time an archive was taken from its name.
+func takenAt(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, objectPrefix) || !strings.HasSuffix(name, objectSuffix) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(objectLayout, strings.TrimSuffix(strings.TrimPrefix(name, objectPrefix), objectSuffix))
+	return t, err == nil
+}
+
+// Retain splits the archives into the ones to keep, the newest of each of the
+// last daily days and of each of the last monthly months, and the expired
+// ones. Objects not named like an archive are in neither.
+func Retain(objects []Object, daily, monthly int) (keep, expired []Object) {
+	type archive struct {
+		Object
+		taken time.Time
+	}
+	var archives []archive
+	for _, o := range objects {
+		if taken, ok := takenAt(o.Name); ok {
+			archives = append(archives, archive{o, taken})
+		}
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].taken.After(archives[j].taken) })
+
+	days, months := map[string]bool{}, map[string]bool{}
+	for _, a := range archives {
+		day, month := a.taken.Format(time.DateOnly), a.taken.Format("2006-01")
+		kept := false
+		if !days[day] && len(days) < daily {
+			days[day], kept = true, true
+		}
+		if !months[month] && len(months) < monthly {
+			months[month], kept = true, true
+		}
+		if kept {
+			keep = append(keep, a.Object)
+		} else {
+			expired = append(expired, a.Object)
+		}
+	}
+	return keep, expired
+}
+
+// Check reports the backups degraded when the last run failed or the newest
+// archive is more than a day old. Backups never take the service down.
+func (s *Scheduler) Check() (string, map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	details := map[string]string{
+		"schedule": fmt.Sprintf("%02d:%02d UTC", int(s.At.Hours()), int(s.At.Minutes())%60),
+		"keep":     fmt.Sprintf("%d daily, %d monthly", s.Daily, s.Monthly),
+	}
+	if s.status.LastAttempt != nil {
+		details["last_attempt"] = s.status.LastAttempt.Format(time.RFC3339)
+	}
+	status := health.StatusOK
+	if s.status.LastSuccess == nil {
+		details["last_success"] = "none"
+	} else {
+		details["last_success"] = s.status.LastSuccess.Format(time.RFC3339)
+		details["last_object"] = s.status.LastObject
+		details["last_size"] = strconv.FormatInt(s.status.LastSize, 10)
+		details["kept"] = strconv.Itoa(s.status.Kept)
+		if time.Since(*s.status.LastSuccess) > staleAfter {
+			status = health.StatusDegraded
+		}
+	}
+	if s.status.LastError != "" {
+		details["error"] = s.status.LastError
+		status = health.StatusDegraded
+	}
+	return status, details
+}
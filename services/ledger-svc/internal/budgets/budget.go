@@ -0,0 +1,82 @@
+// Package budgets keeps the spending limits by category and period and
+// tracks the spend against them.
+package budgets
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+var (
+	ErrInvalidBudget = apierror.New(apierror.KindInvalid, "invalid_budget", "invalid budget")
+	ErrNotFound      = apierror.New(apierror.KindNotFound, "budget_not_found", "budget not found")
+)
+
+type Period string
+
+const (
+	Monthly Period = "monthly"
+	// Weekly periods start on Monday.
+	Weekly Period = "weekly"
+)
+
+// Rollover is what a period's outcome carries into the next period.
+type Rollover string
+
+const (
+	RolloverNone Rollover = "none"
+	// RolloverUnused adds what was left of the previous period.
+	RolloverUnused Rollover = "unused"
+	// RolloverAll also takes the overspend of the previous period off.
+	RolloverAll Rollover = "all"
+)
+
+// Budget limits the spend of a category and its subcategories per period. A
+// budget without a category limits the spend overall.
+type Budget struct {
+	ID        string    `bson:"_id" json:"id"`
+	Category  string    `bson:"category" json:"category"`
+	Period    Period    `bson:"period" json:"period"`
+	Limit     float64   `bson:"limit" json:"limit"`
+	Rollover  Rollover  `bson:"rollover" json:"rollover"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+	// TenantID and UserID own the budget, stamped by the store from the
+	// context like the statements.
+	TenantID string `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+	UserID   string `bson:"user_id,omitempty" json:"user_id,omitempty"`
+}
+
+// Normalize fills the defaults and validates the budget.
+func (b *Budget) Normalize() error {
+	b.Category = strings.TrimSpace(b.Category)
+	if b.Period == "" {
+		b.Period = Monthly
+	}
+	if b.Rollover == "" {
+		b.Rollover = RolloverNone
+	}
+	switch {
+	case b.Period != Monthly && b.Period != Weekly:
+		return fmt.Errorf("%w: period %q, expected monthly or weekly", ErrInvalidBudget, b.Period)
+	case b.Rollover != RolloverNone && b.Rollover != RolloverUnused && b.Rollover != RolloverAll:
+		return fmt.Errorf("%w: rollover %q, expected none, unused or all", ErrInvalidBudget, b.Rollover)
+	case b.Limit <= 0:
+		return fmt.Errorf("%w: limit must be positive", ErrInvalidBudget)
+	}
+	return nil
+}
+
+// Bounds returns the period containing t, start inclusive and end exclusive.
+func (p Period) Bounds(t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if p == Weekly {
+		start := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		return start, start.AddDate(0, 0, 7)
+	}
+	start := day.AddDate(0, 0, 1-day.Day())
+	return start, start.AddDate(0, 1, 0)
+}
@@ -0,0 +1,117 @@
+package budgets
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/jsonbody"
+)
+
+type Handler struct {
+	Store   Store
+	Tracker *Tracker
+}
+
+// ListHandler serves GET /api/budgets.
+func (h *Handler) ListHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Store.List(r.Context())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list budgets", "error", err)
+		apierror.Reply(w, "Failed to list budgets", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// CreateHandler serves POST /api/budgets with {"category": ..., "period":
+// ..., "limit": ..., "rollover": ...}, an empty category limiting the overall
+// spend.
+func (h *Handler) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	var budget Budget
+	if err := jsonbody.Decode(w, r, &budget); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	budget.ID = uuid.NewString()
+	h.save(w, r, &budget, http.StatusCreated)
+}
+
+// UpdateHandler serves PUT /api/budgets/{id}, replacing the definition.
+func (h *Handler) UpdateHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	existing, err := h.Store.Get(r.Context(), id)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to read the budget", "id", id, "error", err)
+		apierror.Reply(w, "Failed to read the budget", http.StatusInternalServerError)
+		return
+	}
+	if existing == nil {
+		apierror.Reply(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	var budget Budget
+	if err := jsonbody.Decode(w, r, &budget); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	budget.ID, budget.TenantID, budget.UserID = id, existing.TenantID, existing.UserID
+	h.save(w, r, &budget, http.StatusOK)
+}
+
+func (h *Handler) save(w http.ResponseWriter, r *http.Request, budget *Budget, status int) {
+	if err := budget.Normalize(); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	budget.UpdatedAt = time.Now().UTC()
+	if err := h.Store.Save(r.Context(), budget); err != nil {
+		slog.Error("Failed to save the budget", "id", budget.ID, "error", err)
+		apierror.Reply(w, "Failed to save the budget", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, status, budget)
+}
+
+// DeleteHandler serves DELETE /api/budgets/{id}.
+func (h *Handler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := h.Store.Delete(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		apierror.Write(w, err)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to delete the budget", "id", id, "error", err)
+		apierror.Reply(w, "Failed to delete the budget", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// StatusHandler serves GET /api/budgets/status, the spend of every budget in
+// its current period with the remaining amount, the burn rate and the
+// projected overage.
+func (h *Handler) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := h.Tracker.Status(r.Context(), time.Now())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to compute the budget status", "error", err)
+		apierror.Reply(w, "Failed to compute the budget status", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
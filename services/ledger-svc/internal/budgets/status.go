@@ -0,0 +1,140 @@
+package budgets
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/categories"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const uncategorizedLabel = "Uncategorized"
+
+// Status is where a budget stands in its current period.
+type Status struct {
+	Budget      Budget    `json:"budget"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Spent       float64   `json:"spent"`
+	// Carry is what the rollover brought over from the previous period.
+	Carry     float64 `json:"carry"`
+	Available float64 `json:"available"`
+	Remaining float64 `json:"remaining"`
+	// BurnRate is the spend per day so far in the period, Projected the spend
+	// at the end of the period at that rate.
+	BurnRate         float64 `json:"burn_rate"`
+	Projected        float64 `json:"projected"`
+	ProjectedOverage float64 `json:"projected_overage"`
+	Over             bool    `json:"over"`
+}
+
+// Tracker computes the spend against the budgets from the transactions.
+type Tracker struct {
+	Repo       statements.StatementRepository
+	Store      Store
+	Categories categories.Store
+}
+
+// Status returns the status of every budget in the period containing now. The
+// rollover only looks at the previous period, carries do not accumulate.
+func (t *Tracker) Status(ctx context.Context, now time.Time) ([]Status, error) {
+	list, err := t.Store.List(ctx)
+	if err != nil || len(list) == 0 {
+		return []Status{}, err
+	}
+	taxonomy := &categories.Taxonomy{}
+	if t.Categories != nil {
+		if taxonomy, err = categories.Resolve(ctx, t.Categories, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	now = now.UTC()
+	var from, to time.Time
+	for _, b := range list {
+		start, end := b.Period.Bounds(now)
+		if b.Rollover != RolloverNone {
+			start, _ = b.Period.Bounds(start.Add(-time.Nanosecond))
+		}
+		if from.IsZero() || start.Before(from) {
+			from = start
+		}
+		if end.After(to) {
+			to = end
+		}
+	}
+	txs, err := t.Repo.FindTransactions(ctx, statements.TransactionFilter{From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+	paths := make([][]string, len(txs))
+	for i := range txs {
+		category := txs[i].Category
+		if category == "" {
+			category = uncategorizedLabel
+		}
+		paths[i] = taxonomy.Path(category)
+	}
+
+	result := make([]Status, 0, len(list))
+	for _, b := range list {
+		start, end := b.Period.Bounds(now)
+		prevStart, _ := b.Period.Bounds(start.Add(-time.Nanosecond))
+		var spent, prevSpent float64
+		for i := range txs {
+			if !b.counts(&txs[i]) || !covers(b.Category, paths[i]) {
+				continue
+			}
+			switch date := txs[i].Date; {
+			case !date.Before(start) && date.Before(end):
+				spent += txs[i].Amount
+			case !date.Before(prevStart) && date.Before(start):
+				prevSpent += txs[i].Amount
+			}
+		}
+
+		s := Status{Budget: b, PeriodStart: start, PeriodEnd: end, Spent: money.Round(spent)}
+		switch b.Rollover {
+		case RolloverUnused:
+			s.Carry = money.Round(math.Max(0, b.Limit-prevSpent))
+		case RolloverAll:
+			s.Carry = money.Round(b.Limit - prevSpent)
+		}
+		s.Available = money.Round(b.Limit + s.Carry)
+		s.Remaining = money.Round(s.Available - s.Spent)
+		// a partial day counts as a whole one, so the rate settles early on
+		elapsed := math.Ceil(now.Sub(start).Hours() / 24)
+		if elapsed < 1 {
+			elapsed = 1
+		}
+		s.BurnRate = money.Round(spent / elapsed)
+		s.Projected = money.Round(spent / elapsed * end.Sub(start).Hours() / 24)
+		s.ProjectedOverage = money.Round(math.Max(0, s.Projected-s.Available))
+		s.Over = s.Spent > s.Available
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// counts reports whether the transaction is of the owner of the budget, every
+// transaction counting for a budget without an owner.
+func (b *Budget) counts(tx *statements.Transaction) bool {
+	return (b.TenantID == "" || tx.TenantID == b.TenantID) && (b.UserID == "" || tx.UserID == b.UserID)
+}
+
+// covers reports whether a budget of category includes a transaction with the
+// category path, an overall budget including every transaction.
+func covers(category string, path []string) bool {
+	if category == "" {
+		return true
+	}
+	for _, ancestor := range path {
+		if strings.EqualFold(ancestor, category) {
+			return true
+		}
+	}
+	return false
+}
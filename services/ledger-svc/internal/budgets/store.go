@@ -0,0 +1,143 @@
+package budgets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Store keeps the budget definitions.
+type Store interface {
+	List(ctx context.Context) ([]Budget, error)
+	// Get returns nil when the budget does not exist.
+	Get(ctx context.Context, id string) (*Budget, error)
+	// Save creates or replaces the budget by ID.
+	Save(ctx context.Context, budget *Budget) error
+	// Delete returns ErrNotFound when the budget does not exist.
+	Delete(ctx context.Context, id string) error
+}
+
+// NewStore keeps the budgets next to the statements in MongoDB, or in memory
+// for the memory driver.
+func NewStore(repo statements.StatementRepository) Store {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryStore()
+}
+
+// SeedFromEnv creates a monthly budget for every category of the JSON object
+// in BUDGETS_FILE, e.g. {"Food": 8000}, when there are no budgets yet.
+func SeedFromEnv(ctx context.Context, store Store) error {
+	path := os.Getenv("BUDGETS_FILE")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var limits map[string]float64
+	if err := json.Unmarshal(data, &limits); err != nil {
+		return fmt.Errorf("invalid budgets %s: %w", path, err)
+	}
+	existing, err := store.List(ctx)
+	if err != nil || len(existing) > 0 {
+		return err
+	}
+
+	categories := make([]string, 0, len(limits))
+	for category := range limits {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		budget := &Budget{ID: uuid.NewString(), Category: category, Limit: limits[category], UpdatedAt: time.Now().UTC()}
+		if err := budget.Normalize(); err != nil {
+			return fmt.Errorf("budget of %s: %w", category, err)
+		}
+		if err := store.Save(ctx, budget); err != nil {
+			return err
+		}
+	}
+	slog.Info("Seeded budgets", "file", path, "count", len(categories))
+	return nil
+}
+
+type MemoryStore struct {
+	mu      sync.RWMutex
+	budgets map[string]Budget
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{budgets: make(map[string]Budget)}
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Budget, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Budget, 0, len(s.budgets))
+	for _, b := range s.budgets {
+		if statements.Owns(ctx, b.TenantID, b.UserID) {
+			list = append(list, b)
+		}
+	}
+	sortBudgets(list)
+	return list, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Budget, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	b, ok := s.budgets[id]
+	if !ok || !statements.Owns(ctx, b.TenantID, b.UserID) {
+		return nil, nil
+	}
+	return &b, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, budget *Budget) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.budgets[budget.ID]; ok && !statements.Owns(ctx, existing.TenantID, existing.UserID) {
+		return statements.ErrNotOwned
+	}
+	budget.TenantID, budget.UserID = statements.Stamp(ctx, budget.TenantID, budget.UserID)
+	s.budgets[budget.ID] = *budget
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.budgets[id]; !ok || !statements.Owns(ctx, b.TenantID, b.UserID) {
+		return ErrNotFound
+	}
+	delete(s.budgets, id)
+	return nil
+}
+
+// sortBudgets orders the overall budgets first, then by category and period.
+func sortBudgets(list []Budget) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Category != list[j].Category {
+			return list[i].Category < list[j].Category
+		}
+		if list[i].Period != list[j].Period {
+			return list[i].Period < list[j].Period
+		}
+		return list[i].ID < list[j].ID
+	})
+}
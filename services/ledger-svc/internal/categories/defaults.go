@@ -0,0 +1,36 @@
+package categories
+
+import "time"
+
+// defaultTree lists the subcategories of every root of the default taxonomy.
+var defaultTree = []struct {
+	root     string
+	children []string
+}{
+	{"Food", []string{"Dining", "Groceries", "Coffee"}},
+	{"Transport", []string{"Public Transit", "Taxi", "Fuel", "Parking"}},
+	{"Shopping", []string{"Clothing", "Electronics", "Household"}},
+	{"Travel", []string{"Flights", "Hotels"}},
+	{"Bills", []string{"Utilities", "Phone & Internet", "Insurance", "Subscriptions"}},
+	{"Entertainment", []string{"Streaming", "Events", "Games"}},
+	{"Health", []string{"Medical", "Pharmacy", "Fitness"}},
+	{"Education", nil},
+	{"Fees", []string{"Bank Fees", "Interest"}},
+}
+
+// Default is the taxonomy seeded on the first run.
+func Default() *Taxonomy {
+	var categories []Category
+	for _, node := range defaultTree {
+		categories = append(categories, Category{Name: node.root})
+		for _, child := range node.children {
+			categories = append(categories, Category{Name: child, Parent: node.root})
+		}
+	}
+	return &Taxonomy{
+		Version:    1,
+		Categories: categories,
+		Change:     "default taxonomy",
+		CreatedAt:  time.Now().UTC(),
+	}
+}
@@ -0,0 +1,148 @@
+package categories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/jsonbody"
+)
+
+type Handler struct {
+	Store Store
+
+	mu sync.Mutex
+}
+
+// Resolve returns the taxonomy version named by the version parameter, the
+// latest when it is empty. Without any version it returns an empty taxonomy,
+// in which every category is a root.
+func Resolve(ctx context.Context, store Store, version string) (*Taxonomy, error) {
+	var taxonomy *Taxonomy
+	var err error
+	if version == "" {
+		taxonomy, err = store.Latest(ctx)
+	} else {
+		v, convErr := strconv.Atoi(version)
+		if convErr != nil {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownVersion, version)
+		}
+		if taxonomy, err = store.Version(ctx, v); err == nil && taxonomy == nil {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, v)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if taxonomy == nil {
+		taxonomy = &Taxonomy{}
+	}
+	return taxonomy, nil
+}
+
+// CategoriesHandler serves GET /api/categories, the latest taxonomy or the
+// one of the version parameter.
+func (h *Handler) CategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	taxonomy, err := Resolve(r.Context(), h.Store, r.URL.Query().Get("version"))
+	if errors.Is(err, ErrUnknownVersion) {
+		apierror.Write(w, err)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to read the category taxonomy", "error", err)
+		apierror.Reply(w, "Failed to read the category taxonomy", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, taxonomy)
+}
+
+// HistoryHandler serves GET /api/categories/history, the versions with the
+// change each made, newest first.
+func (h *Handler) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	history, err := h.Store.History(r.Context())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to read the category taxonomy history", "error", err)
+		apierror.Reply(w, "Failed to read the category taxonomy history", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// AddHandler serves POST /api/categories with {"name": ..., "parent": ...}.
+func (h *Handler) AddHandler(w http.ResponseWriter, r *http.Request) {
+	var req Category
+	if err := jsonbody.Decode(w, r, &req); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	h.change(w, r, http.StatusCreated, func(t *Taxonomy) (*Taxonomy, error) {
+		return t.Add(req.Name, req.Parent)
+	})
+}
+
+// MoveHandler serves PUT /api/categories/{name}/parent with {"parent": ...},
+// an empty parent moving the category to the top level. Transactions keep
+// their category, only the roll-up changes from the new version on.
+func (h *Handler) MoveHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Parent string `json:"parent"`
+	}
+	if err := jsonbody.Decode(w, r, &req); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	name := r.PathValue("name")
+	h.change(w, r, http.StatusOK, func(t *Taxonomy) (*Taxonomy, error) {
+		return t.Move(name, req.Parent)
+	})
+}
+
+func (h *Handler) change(w http.ResponseWriter, r *http.Request, status int, apply func(*Taxonomy) (*Taxonomy, error)) {
+	next, err := h.save(r.Context(), apply)
+	switch {
+	case err == nil:
+		slog.Info("Category taxonomy changed", "version", next.Version, "change", next.Change)
+		writeJSON(w, status, next)
+	case errors.Is(err, ErrUnknownCategory):
+		apierror.Write(w, err)
+	case errors.Is(err, ErrInvalidChange):
+		apierror.Write(w, err)
+	case errors.Is(err, ErrConflict):
+		apierror.Write(w, err)
+	default:
+		slog.Error("Failed to change the category taxonomy", "error", err)
+		apierror.Reply(w, "Failed to change the category taxonomy", http.StatusInternalServerError)
+	}
+}
+
+// save derives the next version from the latest one; changes of this instance
+// are serialized, the store catches concurrent ones of other instances.
+func (h *Handler) save(ctx context.Context, apply func(*Taxonomy) (*Taxonomy, error)) (*Taxonomy, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	current, err := Resolve(ctx, h.Store, "")
+	if err != nil {
+		return nil, err
+	}
+	next, err := apply(current)
+	if err != nil {
+		return nil, err
+	}
+	return next, h.Store.Save(ctx, next)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
@@ -0,0 +1,104 @@
+package categories
+
+import (
+	"context"
+	"errors"
+	"maps"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// MongoStore keeps one document per version in the <namespace>category_taxonomy
+// collection, unique by owner and version number.
+type MongoStore struct {
+	col *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database, namespace string) *MongoStore {
+	return &MongoStore{col: db.Collection(namespace + "category_taxonomy")}
+}
+
+func (s *MongoStore) Latest(ctx context.Context) (*Taxonomy, error) {
+	return s.lookup(ctx, bson.M{}, options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}}))
+}
+
+func (s *MongoStore) Version(ctx context.Context, version int) (*Taxonomy, error) {
+	return s.lookup(ctx, bson.M{"version": version}, options.FindOne())
+}
+
+// lookup finds the version of the owner of ctx, or the deployment's when the
+// owner has none.
+func (s *MongoStore) lookup(ctx context.Context, filter bson.M, opts *options.FindOneOptions) (*Taxonomy, error) {
+	for _, f := range ownerFilters(ctx, filter) {
+		var taxonomy Taxonomy
+		err := s.col.FindOne(ctx, f, opts).Decode(&taxonomy)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &taxonomy, nil
+	}
+	return nil, nil
+}
+
+func (s *MongoStore) History(ctx context.Context) ([]Taxonomy, error) {
+	filters := ownerFilters(ctx, bson.M{})
+	histories := make([][]Taxonomy, 0, len(filters))
+	for _, f := range filters {
+		cursor, err := s.col.Find(ctx, f, options.Find().
+			SetSort(bson.D{{Key: "version", Value: -1}}).
+			SetProjection(bson.M{"categories": 0}))
+		if err != nil {
+			return nil, err
+		}
+		history := []Taxonomy{}
+		if err := cursor.All(ctx, &history); err != nil {
+			return nil, err
+		}
+		histories = append(histories, history)
+	}
+	if len(histories) == 1 {
+		return histories[0], nil
+	}
+	return ownHistory(histories[0], histories[1]), nil
+}
+
+// Save inserts the version; the unique index on the owner and version turns a
+// concurrent change into ErrConflict instead of a lost update.
+func (s *MongoStore) Save(ctx context.Context, taxonomy *Taxonomy) error {
+	taxonomy.TenantID, taxonomy.UserID = statements.Stamp(ctx, taxonomy.TenantID, taxonomy.UserID)
+	_, err := s.col.InsertOne(ctx, taxonomy)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+// ownerFilters returns the filter on the versions of the owner of ctx and on
+// those of the deployment, see owners.
+func ownerFilters(ctx context.Context, filter bson.M) []bson.M {
+	deployment := maps.Clone(filter)
+	deployment["tenant_id"], deployment["user_id"] = nil, nil
+	if statements.OwnerFrom(ctx) == "" {
+		return []bson.M{deployment}
+	}
+	tenant, user := statements.Stamp(ctx, "", "")
+	owned := maps.Clone(filter)
+	owned["tenant_id"], owned["user_id"] = orNil(tenant), orNil(user)
+	return []bson.M{owned, deployment}
+}
+
+// orNil matches a missing field for an empty value, the fields are omitted
+// when empty.
+func orNil(v string) any {
+	if v == "" {
+		return nil
+	}
+	return v
+}
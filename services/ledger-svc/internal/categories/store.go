@@ -0,0 +1,158 @@
+package categories
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// ErrConflict is returned when the version to save exists already, i.e. the
+// taxonomy was changed concurrently.
+var ErrConflict = apierror.New(apierror.KindConflict, "taxonomy_conflict", "taxonomy was changed concurrently")
+
+// Store keeps every version of the taxonomy.
+type Store interface {
+	// Latest returns the current version, nil before the first one is saved.
+	Latest(ctx context.Context) (*Taxonomy, error)
+	// Version returns one version, nil when it does not exist.
+	Version(ctx context.Context, version int) (*Taxonomy, error)
+	// History returns every version without its categories, newest first.
+	History(ctx context.Context) ([]Taxonomy, error)
+	// Save adds a version, ErrConflict when it exists.
+	Save(ctx context.Context, taxonomy *Taxonomy) error
+}
+
+// NewStore keeps the taxonomy next to the statements in MongoDB, or in memory
+// for the memory driver.
+func NewStore(repo statements.StatementRepository) Store {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryStore()
+}
+
+// Seed saves the default taxonomy as version 1 when there is none yet.
+func Seed(ctx context.Context, store Store) error {
+	latest, err := store.Latest(ctx)
+	if err != nil || latest != nil {
+		return err
+	}
+	err = store.Save(ctx, Default())
+	if errors.Is(err, ErrConflict) {
+		// seeded by another instance
+		return nil
+	}
+	if err == nil {
+		slog.Info("Seeded the default category taxonomy")
+	}
+	return err
+}
+
+// ownHistory puts the versions of an owner before those of the deployment
+// they started from, which are older than the owner's first one.
+func ownHistory(owned, shared []Taxonomy) []Taxonomy {
+	if len(owned) == 0 {
+		return shared
+	}
+	first := owned[len(owned)-1].Version
+	for _, t := range shared {
+		if t.Version < first {
+			owned = append(owned, t)
+		}
+	}
+	return owned
+}
+
+// MemoryStore keeps the versions by owner, see statements.Owner, the
+// deployment's under the empty one.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	versions map[string]map[int]Taxonomy
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{versions: make(map[string]map[int]Taxonomy)}
+}
+
+func (s *MemoryStore) Latest(ctx context.Context) (*Taxonomy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, owner := range owners(ctx) {
+		var latest *Taxonomy
+		for _, t := range s.versions[owner] {
+			if latest == nil || t.Version > latest.Version {
+				latest = &t
+			}
+		}
+		if latest != nil {
+			return latest, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemoryStore) Version(ctx context.Context, version int) (*Taxonomy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, owner := range owners(ctx) {
+		if t, ok := s.versions[owner][version]; ok {
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MemoryStore) History(ctx context.Context) ([]Taxonomy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	histories := make([][]Taxonomy, 0, 2)
+	for _, owner := range owners(ctx) {
+		history := make([]Taxonomy, 0, len(s.versions[owner]))
+		for _, t := range s.versions[owner] {
+			t.Categories = nil
+			history = append(history, t)
+		}
+		sort.Slice(history, func(i, j int) bool {
+			return history[i].Version > history[j].Version
+		})
+		histories = append(histories, history)
+	}
+	if len(histories) == 1 {
+		return histories[0], nil
+	}
+	return ownHistory(histories[0], histories[1]), nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, taxonomy *Taxonomy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	taxonomy.TenantID, taxonomy.UserID = statements.Stamp(ctx, taxonomy.TenantID, taxonomy.UserID)
+	owner := statements.Owner(taxonomy.TenantID, taxonomy.UserID)
+	if _, exists := s.versions[owner][taxonomy.Version]; exists {
+		return ErrConflict
+	}
+	if s.versions[owner] == nil {
+		s.versions[owner] = make(map[int]Taxonomy)
+	}
+	s.versions[owner][taxonomy.Version] = *taxonomy
+	return nil
+}
+
+// owners returns the owner of ctx and then the deployment, whose versions
+// hold until the owner changes the taxonomy, or the deployment alone for an
+// unscoped ctx.
+func owners(ctx context.Context) []string {
+	if owner := statements.OwnerFrom(ctx); owner != "" {
+		return []string{owner, ""}
+	}
+	return []string{""}
+}
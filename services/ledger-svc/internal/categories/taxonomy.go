@@ -0,0 +1,157 @@
+// Package categories keeps the category taxonomy, the hierarchy summaries roll
+// transaction categories up along. Every change is saved as a new version and
+// old versions stay readable, so a summary can be reproduced as it was.
+package categories
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+var (
+	ErrUnknownCategory = apierror.New(apierror.KindNotFound, "unknown_category", "unknown category")
+	ErrInvalidChange   = apierror.New(apierror.KindInvalid, "invalid_taxonomy_change", "invalid taxonomy change")
+	ErrUnknownVersion  = apierror.New(apierror.KindNotFound, "unknown_taxonomy_version", "unknown taxonomy version")
+)
+
+// Category is a node of the taxonomy; categories without a parent are roots.
+// Transactions refer to categories by name, case insensitively.
+type Category struct {
+	Name   string `bson:"name" json:"name"`
+	Parent string `bson:"parent,omitempty" json:"parent,omitempty"`
+}
+
+// Taxonomy is one version of the hierarchy. It is never modified once saved,
+// changes derive the next version. The versions without an owner are those of
+// the deployment, which every tenant and user starts from; their changes are
+// versions of their own, stamped by the store from the context.
+type Taxonomy struct {
+	Version    int        `bson:"version" json:"version"`
+	Categories []Category `bson:"categories" json:"categories,omitempty"`
+	Change     string     `bson:"change" json:"change"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	TenantID   string     `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+	UserID     string     `bson:"user_id,omitempty" json:"user_id,omitempty"`
+}
+
+func key(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func (t *Taxonomy) find(name string) (int, bool) {
+	for i := range t.Categories {
+		if key(t.Categories[i].Name) == key(name) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// Path returns the names from the root down to the category. A category the
+// taxonomy does not know is its own root.
+func (t *Taxonomy) Path(name string) []string {
+	path := []string{}
+	for seen := 0; name != "" && seen <= len(t.Categories); seen++ {
+		i, ok := t.find(name)
+		if !ok {
+			path = append(path, name)
+			break
+		}
+		path = append(path, t.Categories[i].Name)
+		name = t.Categories[i].Parent
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// RollUp returns the ancestor of the category at depth, 1 being the roots.
+// Categories above depth and a depth of 0 return the category itself.
+func (t *Taxonomy) RollUp(name string, depth int) string {
+	path := t.Path(name)
+	if depth <= 0 || depth >= len(path) {
+		return name
+	}
+	return path[depth-1]
+}
+
+// Descendants returns the category and every category below it.
+func (t *Taxonomy) Descendants(name string) []string {
+	names := []string{name}
+	for i := 0; i < len(names); i++ {
+		for _, c := range t.Categories {
+			if key(c.Parent) == key(names[i]) && key(c.Name) != key(name) {
+				names = append(names, c.Name)
+			}
+		}
+	}
+	return names
+}
+
+func (t *Taxonomy) next(change string, categories []Category) *Taxonomy {
+	return &Taxonomy{
+		Version:    t.Version + 1,
+		Categories: categories,
+		Change:     change,
+		CreatedAt:  time.Now().UTC(),
+	}
+}
+
+// Add derives the version with a new category under parent, or a new root
+// when parent is empty.
+func (t *Taxonomy) Add(name, parent string) (*Taxonomy, error) {
+	name, parent = strings.TrimSpace(name), strings.TrimSpace(parent)
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("%w: a category name must not be empty or contain /", ErrInvalidChange)
+	}
+	if _, exists := t.find(name); exists {
+		return nil, fmt.Errorf("%w: category %q already exists", ErrInvalidChange, name)
+	}
+	change := "add " + name
+	if parent != "" {
+		i, ok := t.find(parent)
+		if !ok {
+			return nil, fmt.Errorf("%w: parent %q", ErrUnknownCategory, parent)
+		}
+		parent = t.Categories[i].Name
+		change += " under " + parent
+	}
+
+	categories := append(append([]Category(nil), t.Categories...), Category{Name: name, Parent: parent})
+	return t.next(change, categories), nil
+}
+
+// Move derives the version with the category under a new parent, or a root
+// when parent is empty. Its subcategories move along.
+func (t *Taxonomy) Move(name, parent string) (*Taxonomy, error) {
+	i, ok := t.find(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCategory, name)
+	}
+	name = t.Categories[i].Name
+	change := "move " + name + " to the top level"
+	if parent = strings.TrimSpace(parent); parent != "" {
+		p, ok := t.find(parent)
+		if !ok {
+			return nil, fmt.Errorf("%w: parent %q", ErrUnknownCategory, parent)
+		}
+		parent = t.Categories[p].Name
+		for _, ancestor := range t.Path(parent) {
+			if key(ancestor) == key(name) {
+				return nil, fmt.Errorf("%w: %q cannot be moved below itself", ErrInvalidChange, name)
+			}
+		}
+		change = "move " + name + " under " + parent
+	}
+	if key(t.Categories[i].Parent) == key(parent) {
+		return nil, fmt.Errorf("%w: %q is already there", ErrInvalidChange, name)
+	}
+
+	categories := append([]Category(nil), t.Categories...)
+	categories[i].Parent = parent
+	return t.next(change, categories), nil
+}
@@ -0,0 +1,439 @@
+// Package config loads the settings of the service into a Config, checked at
+// startup. Each setting is read, the last one winning, from:
+//
+//  1. its default;
+//  2. the YAML file named by --config or CONFIG_FILE, e.g.
+//     storage: {driver: mongo, database: finchie};
+//  3. its environment variable, e.g. MONGO_DB;
+//  4. its flag when it has one, e.g. --storage-driver.
+//
+// Durations are written like 30s or 2m, a bare number being in the unit of
+// the variable, e.g. milliseconds for REQUEST_TIMEOUT_MS. Load exports the
+// settings back to their variables, so the packages configured from the
+// environment, e.g. statements or ratelimit, see the file and the flags too.
+// Credentials are not settings: they stay in the environment, see package
+// secrets.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Config holds the settings of the service. Each field is tagged with its
+// key in the file, its environment variable and, for some, its flag.
+type Config struct {
+	// Port is the port of the API, the one the platform assigns by default,
+	// see Addr.
+	Port      string `yaml:"port" env:"PORT" flag:"port" usage:"port of the API"`
+	AdminAddr string `yaml:"admin_addr" env:"ADMIN_ADDR" flag:"admin-addr" usage:"address of the admin server, e.g. 127.0.0.1:8081, none when empty"`
+	// LogLevel is debug, info, warn or error; debug locally, info otherwise
+	// by default.
+	LogLevel string `yaml:"log_level" env:"LOG_LEVEL" flag:"log-level" usage:"debug, info, warn or error"`
+	// Local logs as text and enables the tools for development.
+	Local bool `yaml:"local" env:"IS_LOCAL" flag:"local" usage:"run for local development"`
+	// Mode is what serve runs, see Modes: replicas of each mode scale on
+	// their own.
+	Mode            string        `yaml:"mode" env:"SERVE_MODE" flag:"mode" usage:"all, api or worker"`
+	RequestTimeout  time.Duration `yaml:"request_timeout" env:"REQUEST_TIMEOUT_MS" flag:"request-timeout" usage:"time a request may take"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT_SECONDS" flag:"shutdown-timeout" usage:"time requests in flight get to finish on shutdown"`
+	Server          Server        `yaml:"server"`
+	Storage         Storage       `yaml:"storage"`
+	Features        Features      `yaml:"features"`
+}
+
+// Server bounds the connections of the API and admin servers, so slow or
+// stuck clients, e.g. a slowloris trickling its headers, do not hold them.
+type Server struct {
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT_SECONDS"`
+	// ReadTimeout bounds the read of a whole request, its body included.
+	ReadTimeout time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT_SECONDS"`
+	// WriteTimeout bounds a response from the end of its request headers;
+	// longer than RequestTimeout so a timed out request is still answered.
+	// The event stream keeps its connection past it.
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT_SECONDS"`
+	// IdleTimeout is how long a kept-alive connection waits for its next
+	// request.
+	IdleTimeout    time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT_SECONDS"`
+	MaxHeaderBytes int           `yaml:"max_header_bytes" env:"SERVER_MAX_HEADER_BYTES"`
+}
+
+// Storage configures the repository of the statements. The MongoDB URI is a
+// credential, read from MONGO_URI.
+type Storage struct {
+	// Driver is mongo, postgres, dynamo or memory; mongo when MONGO_URI is
+	// set and memory otherwise by default.
+	Driver         string        `yaml:"driver" env:"STORAGE_DRIVER" flag:"storage-driver" usage:"mongo, postgres, dynamo or memory"`
+	Database       string        `yaml:"database" env:"MONGO_DB"`
+	Namespace      string        `yaml:"namespace" env:"MONGO_NAMESPACE"`
+	ConnectTimeout time.Duration `yaml:"connect_timeout" env:"MONGO_CONNECT_TIMEOUT_MS"`
+	QueryTimeout   time.Duration `yaml:"query_timeout" env:"MONGO_QUERY_TIMEOUT_MS"`
+}
+
+// Features turns optional parts of the service on and off.
+type Features struct {
+	AccessLog         bool `yaml:"access_log" env:"ACCESS_LOG"`
+	AuditLog          bool `yaml:"audit_log" env:"AUDIT_LOG"`
+	APIValidation     bool `yaml:"api_validation" env:"API_VALIDATION"`
+	RepositoryMetrics bool `yaml:"repository_metrics" env:"REPOSITORY_METRICS"`
+	RateLimit         bool `yaml:"rate_limit" env:"RATE_LIMIT_ENABLED"`
+	RBAC              bool `yaml:"rbac" env:"RBAC_ENABLED"`
+	Playground        bool `yaml:"playground" env:"PLAYGROUND_ENABLED"`
+	DebugCapture      bool `yaml:"debug_capture" env:"DEBUG_CAPTURE"`
+	Compression       bool `yaml:"compression" env:"COMPRESSION"`
+}
+
+// The modes of serve: api serves the API without the background work, worker
+// runs the background work and serves only /healthz and /readyz, all does
+// both.
+const (
+	ModeAll    = "all"
+	ModeAPI    = "api"
+	ModeWorker = "worker"
+)
+
+// Modes are the valid Mode values.
+var Modes = []string{ModeAll, ModeAPI, ModeWorker}
+
+// Default returns the settings used when nothing sets them.
+func Default() *Config {
+	return &Config{
+		Port:            "8080",
+		Mode:            ModeAll,
+		RequestTimeout:  30 * time.Second,
+		ShutdownTimeout: 25 * time.Second,
+		Server: Server{
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       60 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    64 << 10,
+		},
+		Storage: Storage{
+			ConnectTimeout: 10 * time.Second,
+			QueryTimeout:   5 * time.Second,
+		},
+		Features: Features{
+			AccessLog:         true,
+			AuditLog:          true,
+			APIValidation:     true,
+			RepositoryMetrics: true,
+			Compression:       true,
+		},
+	}
+}
+
+// Addr is the address the API listens on.
+func (c *Config) Addr() string {
+	return ":" + c.Port
+}
+
+// ServesAPI reports whether serve serves the API.
+func (c *Config) ServesAPI() bool {
+	return c.Mode != ModeWorker
+}
+
+// RunsWorkers reports whether serve runs the background work.
+func (c *Config) RunsWorkers() bool {
+	return c.Mode != ModeAPI
+}
+
+// Level is the level of LogLevel, valid once loaded.
+func (c *Config) Level() slog.Level {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(c.LogLevel))
+	return level
+}
+
+// Flags are the command-line flags of the settings, see RegisterFlags.
+type Flags struct {
+	file   string
+	values map[string]string // by environment variable
+}
+
+// RegisterFlags defines --config and the flags of the settings on fs, read
+// by Load once fs is parsed.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	flags := &Flags{values: make(map[string]string)}
+	fs.StringVar(&flags.file, "config", "", "YAML file of settings, CONFIG_FILE by default")
+	for _, f := range Default().fields() {
+		if f.flag == "" {
+			continue
+		}
+		env := f.env
+		set := func(value string) error {
+			flags.values[env] = value
+			return nil
+		}
+		if f.value.Kind() == reflect.Bool {
+			fs.BoolFunc(f.flag, f.usage, set)
+		} else {
+			fs.Func(f.flag, f.usage, set)
+		}
+	}
+	return flags
+}
+
+// Load reads the settings from the file, the environment and the flags,
+// which may be nil, checks them and exports them to the environment. The
+// error lists every invalid setting.
+func Load(flags *Flags) (*Config, error) {
+	if flags == nil {
+		flags = &Flags{}
+	}
+	cfg := Default()
+
+	file := flags.file
+	if file == "" {
+		file = os.Getenv("CONFIG_FILE")
+	}
+	if file != "" {
+		if err := cfg.readFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	for _, f := range cfg.fields() {
+		if value := os.Getenv(f.env); value != "" {
+			if err := f.set(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+			}
+		}
+		if value, ok := flags.values[f.env]; ok {
+			if err := f.set(value); err != nil {
+				errs = append(errs, fmt.Errorf("--%s: %w", f.flag, err))
+			}
+		}
+	}
+	// the port the platform assigns, unless the flag sets one
+	if port := os.Getenv("FUNCTIONS_CUSTOMHANDLER_PORT"); port != "" && flags.values["PORT"] == "" {
+		cfg.Port = port
+	}
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = "info"
+		if cfg.Local {
+			cfg.LogLevel = "debug"
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg.export()
+	return cfg, nil
+}
+
+// Validate reports every invalid setting, named by its variable.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(env, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", env, fmt.Sprintf(format, args...)))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		invalid("PORT", "%q is not a port, expected a number from 1 to 65535", c.Port)
+	}
+	if c.AdminAddr != "" {
+		if _, _, err := net.SplitHostPort(c.AdminAddr); err != nil {
+			invalid("ADMIN_ADDR", "%q is not an address, expected host:port, e.g. 127.0.0.1:8081", c.AdminAddr)
+		}
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		invalid("LOG_LEVEL", "%q is not a level, expected debug, info, warn or error", c.LogLevel)
+	}
+	if !slices.Contains(Modes, c.Mode) {
+		invalid("SERVE_MODE", "unknown mode %q, expected one of %v", c.Mode, Modes)
+	}
+	if c.Storage.Driver != "" && !slices.Contains(statements.Drivers(), c.Storage.Driver) {
+		invalid("STORAGE_DRIVER", "unknown driver %q, expected one of %v", c.Storage.Driver, statements.Drivers())
+	}
+	if c.Storage.Driver == "mongo" && c.Storage.Database == "" {
+		invalid("MONGO_DB", "required by the mongo driver")
+	}
+	if !statements.ValidNamespace(c.Storage.Namespace) {
+		invalid("MONGO_NAMESPACE", "%q may only contain letters, digits and underscores", c.Storage.Namespace)
+	}
+	if c.Server.WriteTimeout <= c.RequestTimeout {
+		invalid("SERVER_WRITE_TIMEOUT_SECONDS", "%v is too short, expected longer than REQUEST_TIMEOUT_MS (%v)", c.Server.WriteTimeout, c.RequestTimeout)
+	}
+	if c.Server.MaxHeaderBytes < 4<<10 {
+		invalid("SERVER_MAX_HEADER_BYTES", "%d is too small, expected at least 4096", c.Server.MaxHeaderBytes)
+	}
+	for _, f := range c.fields() {
+		if f.value.Type() != durationType {
+			continue
+		}
+		if unit := durationUnit(f.env); time.Duration(f.value.Int()) < unit {
+			invalid(f.env, "%v is too short, expected at least %v", time.Duration(f.value.Int()), unit)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readFile sets the settings in the YAML file at path. Unknown keys are
+// errors, likely misspelled settings.
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	var errs []error
+	c.readNode(doc.Content[0], c.fields(), "", func(line int, err error) {
+		errs = append(errs, fmt.Errorf("%s:%d: %w", path, line, err))
+	})
+	return errors.Join(errs...)
+}
+
+// readNode sets the fields under prefix from the mapping node.
+func (c *Config) readNode(node *yaml.Node, fields []field, prefix string, fail func(int, error)) {
+	if node.Kind != yaml.MappingNode {
+		fail(node.Line, fmt.Errorf("%s: expected its settings, not a value", strings.TrimSuffix(prefix, ".")))
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := prefix+node.Content[i].Value, node.Content[i+1]
+		if slices.ContainsFunc(fields, func(f field) bool { return strings.HasPrefix(f.key, key+".") }) {
+			c.readNode(value, fields, key+".", fail)
+			continue
+		}
+		j := slices.IndexFunc(fields, func(f field) bool { return f.key == key })
+		switch {
+		case j < 0:
+			fail(node.Content[i].Line, fmt.Errorf("unknown setting %q", key))
+		case value.Kind != yaml.ScalarNode:
+			fail(value.Line, fmt.Errorf("%s: expected a value", key))
+		default:
+			if err := fields[j].set(value.Value); err != nil {
+				fail(value.Line, fmt.Errorf("%s: %w", key, err))
+			}
+		}
+	}
+}
+
+// export sets the variables of the settings, so they hold the merged values.
+func (c *Config) export() {
+	for _, f := range c.fields() {
+		if value := f.format(); value != "" {
+			os.Setenv(f.env, value)
+		}
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// field is a setting of a Config.
+type field struct {
+	key, env, flag, usage string
+	value                 reflect.Value
+}
+
+// fields lists the settings of c, those of nested structs with their keys
+// joined by dots, e.g. storage.database.
+func (c *Config) fields() []field {
+	var fields []field
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		for i := range v.NumField() {
+			sf := v.Type().Field(i)
+			key := prefix + sf.Tag.Get("yaml")
+			if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+				walk(v.Field(i), key+".")
+				continue
+			}
+			fields = append(fields, field{
+				key:   key,
+				env:   sf.Tag.Get("env"),
+				flag:  sf.Tag.Get("flag"),
+				usage: sf.Tag.Get("usage"),
+				value: v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+	return fields
+}
+
+func (f field) set(raw string) error {
+	switch {
+	case f.value.Type() == durationType:
+		d, err := parseDuration(raw, durationUnit(f.env))
+		if err != nil {
+			return fmt.Errorf("%q is not a duration, expected e.g. 30s", raw)
+		}
+		f.value.SetInt(int64(d))
+	case f.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean, expected true or false", raw)
+		}
+		f.value.SetBool(b)
+	case f.value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		f.value.SetInt(int64(n))
+	default:
+		f.value.SetString(raw)
+	}
+	return nil
+}
+
+// format is the value of the variable of the setting, a number in its unit
+// for a duration.
+func (f field) format() string {
+	switch {
+	case f.value.Type() == durationType:
+		return strconv.FormatInt(f.value.Int()/int64(durationUnit(f.env)), 10)
+	case f.value.Kind() == reflect.Bool:
+		return strconv.FormatBool(f.value.Bool())
+	case f.value.Kind() == reflect.Int:
+		return strconv.FormatInt(f.value.Int(), 10)
+	default:
+		return f.value.String()
+	}
+}
+
+// durationUnit is the unit of a duration variable, given by its suffix.
+func durationUnit(env string) time.Duration {
+	switch {
+	case strings.HasSuffix(env, "_MS"):
+		return time.Millisecond
+	case strings.HasSuffix(env, "_MINUTES"):
+		return time.Minute
+	case strings.HasSuffix(env, "_HOURS"):
+		return time.Hour
+	}
+	return time.Second
+}
+
+func parseDuration(raw string, unit time.Duration) (time.Duration, error) {
+	if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Duration(n) * unit, nil
+	}
+	return time.ParseDuration(raw)
+}
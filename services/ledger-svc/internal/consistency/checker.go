@@ -0,0 +1,276 @@
+// Package consistency cross-checks the statements against the transactions
+// collection: transactions left behind by a deleted statement, and statements
+// whose embedded transaction list disagrees with the stored transactions.
+package consistency
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const (
+	// FindingOrphan is a transaction whose statement does not exist.
+	FindingOrphan = "orphan_transaction"
+	// FindingEmbeddedMismatch is a statement whose embedded transactions are
+	// not the ones stored for it.
+	FindingEmbeddedMismatch = "embedded_mismatch"
+)
+
+// Repair is a fix the checker may apply to what it finds.
+type Repair string
+
+const (
+	// RepairRelink attaches an orphan to the statement embedding it.
+	RepairRelink Repair = "relink"
+	// RepairDeleteOrphans deletes the orphans no statement embeds.
+	RepairDeleteOrphans Repair = "delete_orphans"
+	// RepairRebuildEmbedded replaces the embedded transactions of a statement
+	// with the stored ones.
+	RepairRebuildEmbedded Repair = "rebuild_embedded"
+)
+
+// ParseRepairs reads a comma separated list of repairs.
+func ParseRepairs(s string) ([]Repair, error) {
+	var repairs []Repair
+	for _, part := range strings.Split(s, ",") {
+		switch r := Repair(strings.TrimSpace(part)); r {
+		case "":
+		case RepairRelink, RepairDeleteOrphans, RepairRebuildEmbedded:
+			repairs = append(repairs, r)
+		default:
+			return nil, fmt.Errorf("unknown repair %q, expected relink, delete_orphans or rebuild_embedded", r)
+		}
+	}
+	return repairs, nil
+}
+
+type Finding struct {
+	Type          string `json:"type"`
+	StatementID   string `json:"statement_id,omitempty"`
+	TransactionID string `json:"transaction_id,omitempty"`
+	// Missing are the stored transactions the statement does not embed,
+	// Extra the embedded ones not stored for it and Changed the ones whose
+	// amount differs.
+	Missing []string `json:"missing,omitempty"`
+	Extra   []string `json:"extra,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+	// Repair is the fix applied, if any.
+	Repair Repair `json:"repair,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Report struct {
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+	Statements   int       `json:"statements"`
+	Transactions int       `json:"transactions"`
+	Repairs      []Repair  `json:"repairs"`
+	Findings     []Finding `json:"findings"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// Checker runs the checks and keeps the report of the last run.
+type Checker struct {
+	Repo statements.StatementRepository
+	// Repairs are applied by the scheduled runs.
+	Repairs []Repair
+
+	mu   sync.Mutex
+	last *Report
+}
+
+// NewCheckerFromEnv reads the repairs of the scheduled runs from
+// CONSISTENCY_REPAIRS, none by default.
+func NewCheckerFromEnv(repo statements.StatementRepository) (*Checker, error) {
+	repairs, err := ParseRepairs(os.Getenv("CONSISTENCY_REPAIRS"))
+	if err != nil {
+		return nil, fmt.Errorf("CONSISTENCY_REPAIRS: %w", err)
+	}
+	return &Checker{Repo: repo, Repairs: repairs}, nil
+}
+
+func (c *Checker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report := c.Check(ctx, c.Repairs)
+		if report.Error != "" {
+			slog.Warn("Consistency check failed", "error", report.Error)
+		} else if len(report.Findings) > 0 {
+			slog.Warn("Consistency check found problems", "findings", len(report.Findings))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Last returns the report of the last run, nil before the first one.
+func (c *Checker) Last() *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+const pageSize = 1000
+
+type storedTx struct {
+	statementID string
+	amount      float64
+}
+
+// Check compares the collections and applies the repairs. Runs are serialized.
+func (c *Checker) Check(ctx context.Context, repairs []Repair) *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	report := &Report{StartedAt: time.Now().UTC(), Repairs: append([]Repair{}, repairs...), Findings: []Finding{}}
+	if err := c.check(ctx, report, repairs); err != nil {
+		report.Error = err.Error()
+	}
+	report.FinishedAt = time.Now().UTC()
+	c.last = report
+	return report
+}
+
+func (c *Checker) check(ctx context.Context, report *Report, repairs []Repair) error {
+	enabled := map[Repair]bool{}
+	for _, r := range repairs {
+		enabled[r] = true
+	}
+
+	stmts, err := c.Repo.ListStatements(ctx, statements.StatementFilter{})
+	if err != nil {
+		return err
+	}
+	report.Statements = len(stmts)
+	byID := make(map[string]*statements.Statement, len(stmts))
+	embeddedBy := map[string]string{}
+	for i := range stmts {
+		byID[stmts[i].ID] = &stmts[i]
+		if stmts[i].Transactions != nil {
+			for _, tx := range *stmts[i].Transactions {
+				embeddedBy[tx.ID] = stmts[i].ID
+			}
+		}
+	}
+
+	stored := map[string]storedTx{}
+	byStatement := map[string][]statements.Transaction{}
+	var orphans []statements.Transaction
+	page := statements.Page{Limit: pageSize}
+	for {
+		txs, err := c.Repo.ListTransactions(ctx, statements.TransactionFilter{}, page)
+		if err != nil {
+			return err
+		}
+		for _, tx := range txs {
+			stored[tx.ID] = storedTx{statementID: tx.StatementID, amount: tx.Amount}
+			if _, ok := byID[tx.StatementID]; ok {
+				byStatement[tx.StatementID] = append(byStatement[tx.StatementID], tx)
+			} else {
+				orphans = append(orphans, tx)
+			}
+		}
+		if len(txs) < pageSize {
+			break
+		}
+		page.After = txs[len(txs)-1].ID
+	}
+	report.Transactions = len(stored)
+
+	var deletes []string
+	for _, tx := range orphans {
+		finding := Finding{Type: FindingOrphan, StatementID: tx.StatementID, TransactionID: tx.ID}
+		owner, embedded := embeddedBy[tx.ID]
+		switch {
+		case embedded && enabled[RepairRelink]:
+			tx.StatementID = owner
+			finding.Repair = RepairRelink
+			if err := c.Repo.UpsertTransaction(ctx, &tx); err != nil {
+				finding.Error = err.Error()
+			} else {
+				byStatement[owner] = append(byStatement[owner], tx)
+				stored[tx.ID] = storedTx{statementID: owner, amount: tx.Amount}
+			}
+		case !embedded && enabled[RepairDeleteOrphans]:
+			finding.Repair = RepairDeleteOrphans
+			deletes = append(deletes, tx.ID)
+		}
+		report.Findings = append(report.Findings, finding)
+	}
+	if len(deletes) > 0 {
+		if err := c.Repo.BulkDeleteTransactions(ctx, deletes); err != nil {
+			for i := range report.Findings {
+				if report.Findings[i].Repair == RepairDeleteOrphans {
+					report.Findings[i].Error = err.Error()
+				}
+			}
+		}
+	}
+
+	for i := range stmts {
+		stmt := &stmts[i]
+		if stmt.Transactions == nil {
+			// the backend does not embed the transactions
+			continue
+		}
+		finding := compareEmbedded(stmt, stored, byStatement[stmt.ID])
+		if finding == nil {
+			continue
+		}
+		if enabled[RepairRebuildEmbedded] {
+			finding.Repair = RepairRebuildEmbedded
+			txs := byStatement[stmt.ID]
+			sort.Slice(txs, func(a, b int) bool { return txs[a].Date.Before(txs[b].Date) })
+			if txs == nil {
+				txs = []statements.Transaction{}
+			}
+			stmt.Transactions = &txs
+			if err := c.Repo.UpsertStatement(ctx, stmt); err != nil {
+				finding.Error = err.Error()
+			}
+		}
+		report.Findings = append(report.Findings, *finding)
+	}
+	return nil
+}
+
+// compareEmbedded returns the mismatch finding of the statement, nil when its
+// embedded transactions are the stored ones.
+func compareEmbedded(stmt *statements.Statement, stored map[string]storedTx, own []statements.Transaction) *Finding {
+	finding := &Finding{Type: FindingEmbeddedMismatch, StatementID: stmt.ID}
+	embedded := map[string]bool{}
+	for _, tx := range *stmt.Transactions {
+		embedded[tx.ID] = true
+		s, ok := stored[tx.ID]
+		switch {
+		case !ok || s.statementID != stmt.ID:
+			finding.Extra = append(finding.Extra, tx.ID)
+		case s.amount != tx.Amount:
+			finding.Changed = append(finding.Changed, tx.ID)
+		}
+	}
+	for _, tx := range own {
+		if !embedded[tx.ID] {
+			finding.Missing = append(finding.Missing, tx.ID)
+		}
+	}
+	if len(finding.Missing)+len(finding.Extra)+len(finding.Changed) == 0 {
+		return nil
+	}
+	sort.Strings(finding.Missing)
+	sort.Strings(finding.Extra)
+	sort.Strings(finding.Changed)
+	return finding
+}
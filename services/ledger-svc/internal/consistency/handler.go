@@ -0,0 +1,51 @@
+package consistency
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+type Handler struct {
+	Checker *Checker
+}
+
+// ReportHandler serves GET /api/consistency, the report of the last check.
+func (h *Handler) ReportHandler(w http.ResponseWriter, r *http.Request) {
+	report := h.Checker.Last()
+	if report == nil {
+		apierror.Reply(w, "No consistency check has run yet", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// CheckHandler serves POST /api/consistency/check, running a check now with
+// the repairs in ?repair=relink,delete_orphans,rebuild_embedded, none by
+// default.
+func (h *Handler) CheckHandler(w http.ResponseWriter, r *http.Request) {
+	repairs, err := ParseRepairs(r.URL.Query().Get("repair"))
+	if err != nil {
+		apierror.Reply(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report := h.Checker.Check(r.Context(), repairs)
+	if report.Error != "" {
+		accesslog.Logger(r.Context()).Error("Consistency check failed", "error", report.Error)
+		apierror.Reply(w, "Consistency check failed", http.StatusInternalServerError)
+		return
+	}
+	accesslog.Logger(r.Context()).Info("Consistency check ran", "findings", len(report.Findings), "repairs", repairs)
+	writeJSON(w, http.StatusOK, report)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
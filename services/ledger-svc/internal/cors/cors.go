@@ -0,0 +1,122 @@
+// Package cors lets browser frontends served from other origins call the API,
+// session cookie included. Only the origins configured are answered with the
+// CORS headers; the browser keeps the responses from every other origin.
+package cors
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	allowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	// allowedHeaders are the request headers the API reads.
+	allowedHeaders = []string{"Authorization", "Content-Type", "If-None-Match", "Last-Event-ID", "Range",
+		"X-API-Key", "X-CSRF-Token", "X-Ingest-Schema-Version", "X-Request-ID"}
+	// exposedHeaders are the response headers the frontend may read.
+	exposedHeaders = []string{"Accept-Ranges", "Content-Disposition", "Content-Range", "ETag", "Retry-After", "Warning",
+		"X-Export-Complete", "X-Export-Cursor", "X-Request-ID"}
+)
+
+// CORS answers the requests of the Origins with the headers that let the
+// browser hand the responses to the frontend.
+type CORS struct {
+	// Origins are scheme://host[:port], the host may start with *. for its
+	// subdomains, e.g. https://*.finchie.example.com.
+	Origins []string
+	// MaxAge is how long browsers may cache a preflight.
+	MaxAge time.Duration
+}
+
+// FromEnv allows the origins of CORS_ALLOWED_ORIGINS, comma separated; nil
+// when there are none. Preflights are cached for CORS_MAX_AGE_SECONDS, 600
+// by default.
+func FromEnv() (*CORS, error) {
+	c := &CORS{MaxAge: 10 * time.Minute}
+	for origin := range strings.SplitSeq(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		if origin == "" {
+			continue
+		}
+		if err := checkOrigin(origin); err != nil {
+			return nil, err
+		}
+		c.Origins = append(c.Origins, origin)
+	}
+	if len(c.Origins) == 0 {
+		return nil, nil
+	}
+	if seconds, err := strconv.Atoi(os.Getenv("CORS_MAX_AGE_SECONDS")); err == nil && seconds >= 0 {
+		c.MaxAge = time.Duration(seconds) * time.Second
+	}
+	slog.Info("CORS enabled", "origins", c.Origins)
+	return c, nil
+}
+
+func checkOrigin(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+		// a * origin would hand every site the responses of the signed-in users
+		return fmt.Errorf("invalid CORS_ALLOWED_ORIGINS origin %q, expected scheme://host[:port]", origin)
+	}
+	return nil
+}
+
+// Allowed reports whether the origin is one of the Origins.
+func (c *CORS) Allowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	for _, allowed := range c.Origins {
+		if origin == allowed {
+			return true
+		}
+		scheme, host, ok := strings.Cut(allowed, "://*.")
+		if !ok {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(origin, scheme+"://"); ok && strings.HasSuffix(rest, "."+host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware adds the CORS headers to the responses to the allowed origins
+// and answers their preflights itself, which carry no credentials.
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		if !c.Allowed(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Allow-Credentials", "true")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			if !slices.Contains(allowedMethods, r.Header.Get("Access-Control-Request-Method")) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			h.Set("Access-Control-Allow-Methods", strings.Join(allowedMethods, ", "))
+			h.Set("Access-Control-Allow-Headers", strings.Join(allowedHeaders, ", "))
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Expose-Headers", strings.Join(exposedHeaders, ", "))
+		next.ServeHTTP(w, r)
+	})
+}
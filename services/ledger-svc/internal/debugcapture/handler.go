@@ -0,0 +1,77 @@
+package debugcapture
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+// Handler serves the captures on the admin listener:
+//
+//	GET /debug/requests            list captures, newest first
+//	GET /debug/requests/{id}       a single capture
+//	GET /debug/requests/{id}/curl  a curl command replaying it against baseURL
+type Handler struct {
+	Store   *Store
+	BaseURL string
+}
+
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /debug/requests", h.list)
+	mux.HandleFunc("GET /debug/requests/{id}", h.get)
+	mux.HandleFunc("GET /debug/requests/{id}/curl", h.curl)
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.Store.List())
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	capture, ok := h.Store.Get(r.PathValue("id"))
+	if !ok {
+		apierror.Reply(w, "Capture not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, capture)
+}
+
+func (h *Handler) curl(w http.ResponseWriter, r *http.Request) {
+	capture, ok := h.Store.Get(r.PathValue("id"))
+	if !ok {
+		apierror.Reply(w, "Capture not found", http.StatusNotFound)
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "curl -X %s %s", capture.Method, shellQuote(h.BaseURL+capture.URL))
+	if ct := capture.Header.Get("Content-Type"); ct != "" {
+		fmt.Fprintf(&sb, " -H %s", shellQuote("Content-Type: "+ct))
+	}
+	if capture.Body != "" {
+		fmt.Fprintf(&sb, " --data-raw %s", shellQuote(capture.Body))
+	}
+	sb.WriteString("\n")
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := w.Write([]byte(sb.String())); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to write curl command", "error", err)
+	}
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+		apierror.Reply(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
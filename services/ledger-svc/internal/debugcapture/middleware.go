@@ -0,0 +1,163 @@
+package debugcapture
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxCapturedBody     = 1 << 20
+	maxCapturedResponse = 4 << 10
+	redacted            = "[REDACTED]"
+)
+
+var sensitiveKey = regexp.MustCompile(`(?i)password|secret|token|authorization|cookie|api[-_]?key|credential`)
+
+// sensitiveParams are the query parameters that grant access on their own:
+// the signature and expiry of a signed attachment URL and the OAuth code and
+// state of /auth/callback.
+var sensitiveParams = regexp.MustCompile(`(?i)^(signature|expires|code|state)$`)
+
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if r.body.Len() < maxCapturedResponse {
+		r.body.Write(b[:min(len(b), maxCapturedResponse-r.body.Len())])
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the writer, e.g. to flush.
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Middleware keeps a sanitized copy of every request answered with a 5xx so it
+// can be replayed locally.
+func Middleware(store *Store, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		truncated := false
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(r.Body, maxCapturedBody+1))
+			if err == nil {
+				truncated = len(body) > maxCapturedBody
+				// hand the handler the full stream: captured prefix plus the remainder
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+				body = body[:min(len(body), maxCapturedBody)]
+			}
+		}
+
+		rec := &recorder{ResponseWriter: w}
+		defer func() {
+			// a panicking handler is a failure too; record it and let it propagate
+			if p := recover(); p != nil {
+				rec.status = http.StatusInternalServerError
+				store.Add(capture(r, body, truncated, rec))
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+
+		if rec.status >= http.StatusInternalServerError {
+			store.Add(capture(r, body, truncated, rec))
+		}
+	})
+}
+
+func capture(r *http.Request, body []byte, truncated bool, rec *recorder) CapturedRequest {
+	return CapturedRequest{
+		ID:           uuid.NewString(),
+		Time:         time.Now().UTC(),
+		Method:       r.Method,
+		URL:          sanitizeURL(r.URL),
+		Header:       sanitizeHeader(r.Header),
+		Body:         string(sanitizeBody(body)),
+		Truncated:    truncated,
+		Status:       rec.status,
+		ResponseBody: rec.body.String(),
+	}
+}
+
+func sanitizeHeader(header http.Header) http.Header {
+	result := header.Clone()
+	for key := range result {
+		if sensitiveKey.MatchString(key) {
+			result[key] = []string{redacted}
+		}
+	}
+	return result
+}
+
+// sanitizeURL redacts the sensitive query parameters and keeps the rest of
+// the URL as is.
+func sanitizeURL(u *url.URL) string {
+	query := u.Query()
+	changed := false
+	for key := range query {
+		if sensitiveKey.MatchString(key) || sensitiveParams.MatchString(key) {
+			query[key] = []string{redacted}
+			changed = true
+		}
+	}
+	if !changed {
+		return u.String()
+	}
+	sanitized := *u
+	sanitized.RawQuery = query.Encode()
+	return sanitized.String()
+}
+
+// sanitizeBody redacts sensitive JSON fields; non-JSON bodies are kept as is.
+func sanitizeBody(body []byte) []byte {
+	var doc any
+	if len(body) == 0 || json.Unmarshal(body, &doc) != nil {
+		return body
+	}
+	sanitized, err := json.Marshal(redact(doc))
+	if err != nil {
+		return body
+	}
+	return sanitized
+}
+
+func redact(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			if sensitiveKey.MatchString(k) {
+				t[k] = redacted
+			} else {
+				t[k] = redact(val)
+			}
+		}
+	case []any:
+		for i, val := range t {
+			t[i] = redact(val)
+		}
+	}
+	return v
+}
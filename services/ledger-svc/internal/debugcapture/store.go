@@ -0,0 +1,64 @@
+package debugcapture
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+type CapturedRequest struct {
+	ID           string      `json:"id"`
+	Time         time.Time   `json:"time"`
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	Header       http.Header `json:"header"`
+	Body         string      `json:"body,omitempty"`
+	Truncated    bool        `json:"truncated,omitempty"`
+	Status       int         `json:"status"`
+	ResponseBody string      `json:"response_body,omitempty"`
+}
+
+// Store is a bounded ring of the most recent captures.
+type Store struct {
+	mu       sync.RWMutex
+	items    []CapturedRequest
+	capacity int
+}
+
+func NewStore(capacity int) *Store {
+	return &Store{capacity: capacity}
+}
+
+func (s *Store) Add(c CapturedRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items = append(s.items, c)
+	if len(s.items) > s.capacity {
+		s.items = s.items[len(s.items)-s.capacity:]
+	}
+}
+
+// List returns captures newest first.
+func (s *Store) List() []CapturedRequest {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]CapturedRequest, len(s.items))
+	for i, c := range s.items {
+		result[len(s.items)-1-i] = c
+	}
+	return result
+}
+
+func (s *Store) Get(id string) (*CapturedRequest, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, c := range s.items {
+		if c.ID == id {
+			return &c, true
+		}
+	}
+	return nil, false
+}
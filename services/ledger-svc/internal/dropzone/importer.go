@@ -0,0 +1,206 @@
+// Package dropzone imports statement files that banks, or the statement
+// fetcher, drop into a local directory or onto an SFTP server.
+package dropzone
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/ingest"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// RunSource names the importer in the ingest runs.
+const RunSource = "dropzone"
+
+// Importer polls the drop directory, imports every settled file through the
+// ingest schema and the statement service, and archives it into processed/ or
+// failed/ next to it.
+type Importer struct {
+	Open    func(ctx context.Context) (Source, error)
+	Service *statements.StatementService
+	Runs    ingest.RunStore
+	// Settle skips files modified more recently, they may still be uploading.
+	Settle time.Duration
+}
+
+// NewImporterFromEnv reads the drop directory from DROPZONE_URL, a local path
+// or sftp://user@host[:port]/path. It returns nil when DROPZONE_URL is unset.
+func NewImporterFromEnv(service *statements.StatementService, runs ingest.RunStore) (*Importer, error) {
+	raw := os.Getenv("DROPZONE_URL")
+	if raw == "" {
+		return nil, nil
+	}
+	settle := time.Minute
+	if v, err := strconv.Atoi(os.Getenv("DROPZONE_SETTLE_SECONDS")); err == nil && v >= 0 {
+		settle = time.Duration(v) * time.Second
+	}
+	importer := &Importer{Service: service, Runs: runs, Settle: settle}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Scheme == "file" {
+		dir := raw
+		if err == nil && u.Scheme == "file" {
+			dir = u.Path
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("DROPZONE_URL %s is not a directory", dir)
+		}
+		importer.Open = func(context.Context) (Source, error) {
+			return &DirSource{Dir: dir}, nil
+		}
+		return importer, nil
+	}
+	if u.Scheme != "sftp" || u.Host == "" {
+		return nil, fmt.Errorf("invalid DROPZONE_URL %q, expected a directory or sftp://user@host/path", raw)
+	}
+
+	cfg := SFTPConfig{
+		URL:        u,
+		Password:   os.Getenv("DROPZONE_SFTP_PASSWORD"),
+		KeyFile:    os.Getenv("DROPZONE_SFTP_KEY_FILE"),
+		KnownHosts: os.Getenv("DROPZONE_SFTP_KNOWN_HOSTS"),
+		Timeout:    30 * time.Second,
+	}
+	if cfg.KnownHosts == "" {
+		return nil, errors.New("DROPZONE_SFTP_KNOWN_HOSTS is required to verify the SFTP server")
+	}
+	importer.Open = func(ctx context.Context) (Source, error) {
+		return OpenSFTP(ctx, cfg)
+	}
+	return importer, nil
+}
+
+// Run polls now and then every interval.
+func (im *Importer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		im.Poll(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll imports the settled files once. Runs that found nothing to import are
+// not recorded.
+func (im *Importer) Poll(ctx context.Context, now time.Time) *ingest.Run {
+	run := ingest.NewRun(RunSource)
+	im.poll(ctx, now, run)
+	run.FinishedAt = time.Now().UTC()
+
+	if run.Error == "" && len(run.Items) == 0 {
+		return run
+	}
+	if run.Error != "" {
+		slog.Error("Drop zone poll failed", "error", run.Error)
+	} else {
+		slog.Info("Drop zone poll finished", "imported", run.Imported, "failed", run.Failed)
+	}
+	if err := im.Runs.Save(ctx, run); err != nil {
+		slog.Error("Failed to record the drop zone run", "id", run.ID, "error", err)
+	}
+	return run
+}
+
+func (im *Importer) poll(ctx context.Context, now time.Time, run *ingest.Run) {
+	src, err := im.Open(ctx)
+	if err != nil {
+		run.Error = err.Error()
+		return
+	}
+	defer src.Close()
+
+	files, err := src.List(ctx)
+	if err != nil {
+		run.Error = err.Error()
+		return
+	}
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return
+		}
+		if file.ModTime.After(now.Add(-im.Settle)) || strings.HasPrefix(file.Name, ".") {
+			continue
+		}
+
+		item := im.importFile(ctx, src, file.Name)
+		folder := processedFolder
+		if item.Status == ingest.ItemFailed {
+			folder = failedFolder
+			slog.Warn("Failed to import dropped file", "file", file.Name, "error", item.Error)
+		}
+		if err := src.Archive(ctx, file.Name, folder); err != nil {
+			// importing again on the next poll is harmless, statements are upserted
+			slog.Error("Failed to archive dropped file", "file", file.Name, "folder", folder, "error", err)
+		}
+		run.Add(item)
+	}
+}
+
+func (im *Importer) importFile(ctx context.Context, src Source, name string) ingest.RunItem {
+	item := ingest.RunItem{Name: name, Status: ingest.ItemFailed}
+	data, err := src.Read(ctx, name)
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+	stmt, err := parse(name, data)
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+
+	if stmt.Transactions != nil {
+		err = im.Service.SaveStatementWithTransactions(ctx, stmt)
+	} else {
+		err = im.Service.SaveStatement(ctx, stmt)
+	}
+	item.StatementID = stmt.ID
+	switch {
+	case errors.Is(err, statements.ErrQueued):
+		item.Status = ingest.ItemQueued
+	case err != nil:
+		item.Error = err.Error()
+	default:
+		item.Status = ingest.ItemImported
+	}
+	return item
+}
+
+// parse reads a statement file. Only the JSON statements of the ingest schema
+// are understood so far.
+func parse(name string, data []byte) (*statements.Statement, error) {
+	if ext := strings.ToLower(filepath.Ext(name)); ext != ".json" {
+		return nil, fmt.Errorf("no parser for %q files", ext)
+	}
+	violations, err := ingest.ValidatePayload("statement", "", data)
+	if err != nil {
+		return nil, err
+	}
+	if len(violations) > 0 {
+		msgs := make([]string, len(violations))
+		for i, v := range violations {
+			msgs[i] = v.Error()
+		}
+		return nil, fmt.Errorf("payload does not match ingest schema: %s", strings.Join(msgs, "; "))
+	}
+
+	var stmt statements.Statement
+	if err := json.Unmarshal(data, &stmt); err != nil {
+		return nil, err
+	}
+	return &stmt, nil
+}
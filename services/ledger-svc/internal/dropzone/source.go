@@ -0,0 +1,78 @@
+package dropzone
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Folders of the drop directory processed files are moved to.
+const (
+	processedFolder = "processed"
+	failedFolder    = "failed"
+)
+
+type File struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Source is a directory statement files are dropped into, local or remote.
+type Source interface {
+	// List returns the regular files at the top of the directory, the archive
+	// folders are not listed.
+	List(ctx context.Context) ([]File, error)
+	Read(ctx context.Context, name string) ([]byte, error)
+	// Archive moves the file into folder, creating it when missing.
+	Archive(ctx context.Context, name, folder string) error
+	Close() error
+}
+
+// archivedName prefixes the name with the time it was archived, a bank that
+// reuses file names must not overwrite an earlier delivery.
+func archivedName(name string, now time.Time) string {
+	return now.UTC().Format("20060102T150405Z") + "_" + name
+}
+
+// DirSource reads a local directory, e.g. one an SFTP server writes to.
+type DirSource struct {
+	Dir string
+}
+
+func (s *DirSource) List(ctx context.Context) ([]File, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	files := []File{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Name: entry.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return files, nil
+}
+
+func (s *DirSource) Read(ctx context.Context, name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.Dir, name))
+}
+
+func (s *DirSource) Archive(ctx context.Context, name, folder string) error {
+	dir := filepath.Join(s.Dir, folder)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("create %s: %w", dir, err)
+	}
+	return os.Rename(filepath.Join(s.Dir, name), filepath.Join(dir, archivedName(name, time.Now())))
+}
+
+func (s *DirSource) Close() error {
+	return nil
+}
@@ -0,0 +1,159 @@
+package e2e
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/jsonbody"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+type Handler struct {
+	Store Store
+	Mode  statements.E2EMode
+}
+
+// ConfigHandler serves GET /api/e2e, what clients need to know to encrypt
+// statements for this instance.
+func (h *Handler) ConfigHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"mode":             h.Mode,
+		"prefix":           statements.ClientEncryptedPrefix,
+		"encrypted_fields": []string{"transaction.description", "transaction.merchant_city", "transaction.extra", "statement.extra"},
+	})
+}
+
+// ListHandler serves GET /api/e2e/keys.
+func (h *Handler) ListHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Store.List(r.Context())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list e2e keys", "error", err)
+		apierror.Reply(w, "Failed to list keys", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// GetHandler serves GET /api/e2e/keys/{id}.
+func (h *Handler) GetHandler(w http.ResponseWriter, r *http.Request) {
+	key, ok := h.get(w, r)
+	if !ok {
+		return
+	}
+	if key == nil {
+		apierror.Reply(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, key)
+}
+
+// PutHandler serves PUT /api/e2e/keys/{id} with {"purpose": ...,
+// "algorithm": ..., "wrapped_key": ..., "wrapping": {...}, "retired": ...}.
+// It creates the key, or rewraps an existing one, e.g. after a passphrase
+// change; the purpose and algorithm of a key never change.
+func (h *Handler) PutHandler(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Purpose    Purpose           `json:"purpose"`
+		Algorithm  string            `json:"algorithm"`
+		WrappedKey string            `json:"wrapped_key"`
+		Wrapping   map[string]string `json:"wrapping"`
+		Retired    bool              `json:"retired"`
+	}
+	if err := jsonbody.Decode(w, r, &payload); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	existing, ok := h.get(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	key := Key{
+		ID:         r.PathValue("id"),
+		Purpose:    payload.Purpose,
+		Algorithm:  payload.Algorithm,
+		WrappedKey: payload.WrappedKey,
+		Wrapping:   payload.Wrapping,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	status := http.StatusCreated
+	if existing != nil {
+		if existing.Purpose != key.Purpose || existing.Algorithm != key.Algorithm {
+			apierror.Reply(w, "The purpose and algorithm of a key cannot change", http.StatusConflict)
+			return
+		}
+		key.CreatedAt, key.RetiredAt = existing.CreatedAt, existing.RetiredAt
+		status = http.StatusOK
+	}
+	if payload.Retired && key.RetiredAt == nil {
+		key.RetiredAt = &now
+	} else if !payload.Retired {
+		key.RetiredAt = nil
+	}
+	if err := key.Normalize(); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	if err := h.Store.Save(r.Context(), &key); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to save the e2e key", "id", key.ID, "error", err)
+		apierror.Reply(w, "Failed to save the key", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, status, key)
+}
+
+// DeleteHandler serves DELETE /api/e2e/keys/{id}. Only retired keys can be
+// deleted, and whatever they encrypted can no longer be read.
+func (h *Handler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	key, ok := h.get(w, r)
+	if !ok {
+		return
+	}
+	if key == nil {
+		apierror.Reply(w, ErrNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if key.RetiredAt == nil {
+		apierror.Reply(w, ErrKeyInUse.Error(), http.StatusConflict)
+		return
+	}
+	err := h.Store.Delete(r.Context(), key.ID)
+	if errors.Is(err, ErrNotFound) {
+		apierror.Write(w, err)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to delete the e2e key", "id", key.ID, "error", err)
+		apierror.Reply(w, "Failed to delete the key", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// get reads the key of the path, nil when there is none, and reports whether
+// the request can go on.
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) (*Key, bool) {
+	id := r.PathValue("id")
+	key, err := h.Store.Get(r.Context(), id)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to read the e2e key", "id", id, "error", err)
+		apierror.Reply(w, "Failed to read the key", http.StatusInternalServerError)
+		return nil, false
+	}
+	return key, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
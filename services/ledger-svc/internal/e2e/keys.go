@@ -0,0 +1,132 @@
+// Package e2e keeps the keys of clients that encrypt statements before
+// sending them. Keys are stored wrapped by the client, e.g. under a key
+// derived from a passphrase, so the server holds them without being able to
+// use them.
+package e2e
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+var (
+	ErrInvalidKey = apierror.New(apierror.KindInvalid, "invalid_key", "invalid key")
+	ErrNotFound   = apierror.New(apierror.KindNotFound, "key_not_found", "key not found")
+	// ErrKeyInUse is returned when deleting a key that is not retired.
+	ErrKeyInUse = apierror.New(apierror.KindConflict, "key_in_use", "key is not retired")
+)
+
+type Purpose string
+
+const (
+	// PurposeData keys encrypt values into e2e:<key id>:<ciphertext>.
+	PurposeData Purpose = "data"
+	// PurposeIndex keys compute the blind indexes of transactions.
+	PurposeIndex Purpose = "index"
+)
+
+type Key struct {
+	ID      string  `bson:"_id" json:"id"`
+	Purpose Purpose `bson:"purpose" json:"purpose"`
+	// Algorithm is as the client names it, e.g. AES-256-GCM or HMAC-SHA256.
+	Algorithm string `bson:"algorithm" json:"algorithm"`
+	// WrappedKey is the base64 key encrypted by the client, Wrapping how to
+	// unwrap it, e.g. {"kdf": "argon2id", "salt": "..."}. Both are opaque to
+	// the server.
+	WrappedKey string            `bson:"wrapped_key" json:"wrapped_key"`
+	Wrapping   map[string]string `bson:"wrapping,omitempty" json:"wrapping,omitempty"`
+	CreatedAt  time.Time         `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time         `bson:"updated_at" json:"updated_at"`
+	// RetiredAt is set once no new values are encrypted with the key; it
+	// still decrypts the values it encrypted.
+	RetiredAt *time.Time `bson:"retired_at,omitempty" json:"retired_at,omitempty"`
+}
+
+func (k *Key) Normalize() error {
+	if k.ID == "" {
+		return fmt.Errorf("%w: missing id", ErrInvalidKey)
+	}
+	if k.Purpose != PurposeData && k.Purpose != PurposeIndex {
+		return fmt.Errorf("%w: purpose must be data or index", ErrInvalidKey)
+	}
+	if k.Algorithm == "" {
+		return fmt.Errorf("%w: missing algorithm", ErrInvalidKey)
+	}
+	if _, err := base64.StdEncoding.DecodeString(k.WrappedKey); err != nil || k.WrappedKey == "" {
+		return fmt.Errorf("%w: wrapped_key must be base64", ErrInvalidKey)
+	}
+	return nil
+}
+
+type Store interface {
+	List(ctx context.Context) ([]Key, error)
+	// Get returns nil when there is no key with the ID.
+	Get(ctx context.Context, id string) (*Key, error)
+	Save(ctx context.Context, key *Key) error
+	// Delete returns ErrNotFound when there is no key with the ID.
+	Delete(ctx context.Context, id string) error
+}
+
+// NewStore keeps the keys next to the statements in MongoDB, or in memory for
+// the memory driver.
+func NewStore(repo statements.StatementRepository) Store {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryStore()
+}
+
+type MemoryStore struct {
+	mu   sync.RWMutex
+	keys map[string]Key
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: make(map[string]Key)}
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return nil, nil
+	}
+	return &k, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, key *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key.ID] = *key
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.keys, id)
+	return nil
+}
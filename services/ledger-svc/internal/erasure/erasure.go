@@ -0,0 +1,206 @@
+// Package erasure erases the data of a user on request, e.g. under the GDPR
+// right to erasure: their statements and transactions, archived ones
+// included, their attachments, the change events and webhook deliveries
+// carrying their data are deleted, the audit entries of those are deleted
+// and the entries the user made are attributed to statements.ErasedActor.
+// The rollups and snapshots computed from the transactions are rebuilt
+// without them. Erasures run in the background as jobs reporting what was
+// erased.
+package erasure
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/attachments"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/webhooks"
+)
+
+var ErrNotFound = apierror.New(apierror.KindNotFound, "erasure_not_found", "erasure not found")
+
+type Status string
+
+const (
+	StatusRunning Status = "running"
+	StatusDone    Status = "done"
+	StatusFailed  Status = "failed"
+)
+
+// Job is the erasure of the data of a user.
+type Job struct {
+	ID     string `bson:"_id" json:"id"`
+	UserID string `bson:"user_id" json:"user_id"`
+	// TenantID is the tenant of the admin requesting the erasure, the only
+	// one whose admins see the job.
+	TenantID    string     `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+	RequestedBy string     `bson:"requested_by" json:"requested_by"`
+	Status      Status     `bson:"status" json:"status"`
+	Report      Report     `bson:"report" json:"report"`
+	Error       string     `bson:"error,omitempty" json:"error,omitempty"`
+	StartedAt   time.Time  `bson:"started_at" json:"started_at"`
+	FinishedAt  *time.Time `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// Report counts what a job erased, so far while it runs.
+type Report struct {
+	Statements      int `bson:"statements" json:"statements"`
+	Transactions    int `bson:"transactions" json:"transactions"`
+	Attachments     int `bson:"attachments" json:"attachments"`
+	AuditDeleted    int `bson:"audit_deleted" json:"audit_deleted"`
+	AuditAnonymized int `bson:"audit_anonymized" json:"audit_anonymized"`
+	Events          int `bson:"events" json:"events"`
+	Deliveries      int `bson:"deliveries" json:"deliveries"`
+}
+
+// Rebuilder recomputes what is derived from the transactions of everyone,
+// e.g. the trend metrics, the merchant spend and the month-end reports.
+type Rebuilder interface {
+	Rebuild(ctx context.Context, now time.Time) error
+}
+
+// Eraser runs the erasures.
+type Eraser struct {
+	Repo        statements.StatementRepository
+	Attachments attachments.Store
+	Jobs        Store
+	// Webhooks, when set, loses the subscriptions of the user and the
+	// deliveries about them.
+	Webhooks webhooks.Store
+	// Derived are rebuilt once the data of the user is gone.
+	Derived []Rebuilder
+}
+
+// Start records the job erasing the data of the user and runs it in the
+// background. Erasing is idempotent: a job interrupted by a restart is
+// finished by starting another one.
+func (e *Eraser) Start(ctx context.Context, userID, requestedBy string) (*Job, error) {
+	job := &Job{
+		ID:          uuid.NewString(),
+		UserID:      userID,
+		TenantID:    statements.TenantFrom(ctx),
+		RequestedBy: requestedBy,
+		Status:      StatusRunning,
+		StartedAt:   time.Now().UTC(),
+	}
+	if err := e.Jobs.Save(ctx, job); err != nil {
+		return nil, err
+	}
+	slog.Info("Erasure started", "id", job.ID, "user", userID, "requested_by", requestedBy)
+	go e.run(*job)
+	return job, nil
+}
+
+func (e *Eraser) run(job Job) {
+	ctx := statements.WithAuditInfo(context.Background(), statements.AuditInfo{Actor: "erasure"})
+	// scoped to the user in the tenant of the admin requesting it, the job
+	// sees the data of the user there whoever requested it
+	err := e.erase(statements.WithUser(statements.WithTenant(ctx, job.TenantID), job.UserID), &job)
+	if err == nil {
+		err = e.rebuild(ctx)
+	}
+
+	finished := time.Now().UTC()
+	job.FinishedAt = &finished
+	job.Status = StatusDone
+	if err != nil {
+		job.Status, job.Error = StatusFailed, err.Error()
+		slog.Error("Erasure failed", "id", job.ID, "user", job.UserID, "error", err)
+	} else {
+		slog.Info("Erasure done", "id", job.ID, "user", job.UserID, "report", job.Report)
+	}
+	if err := e.Jobs.Save(ctx, &job); err != nil {
+		slog.Error("Failed to save erasure", "id", job.ID, "error", err)
+	}
+}
+
+func (e *Eraser) erase(ctx context.Context, job *Job) error {
+	list, err := e.Repo.ListStatements(ctx, statements.StatementFilter{UserID: job.UserID})
+	if err != nil {
+		return fmt.Errorf("list statements: %w", err)
+	}
+	transactions, err := e.Repo.FindTransactions(ctx, statements.TransactionFilter{UserID: job.UserID})
+	if err != nil {
+		return fmt.Errorf("find transactions: %w", err)
+	}
+	var erased []string
+
+	statementIDs := make([]string, len(list))
+	for i := range list {
+		statementIDs[i] = list[i].ID
+	}
+	// the archive first, its statements have attachments too
+	var archived statements.Erased
+	if eraser, ok := statements.AsOwnerEraser(e.Repo); ok {
+		if archived, err = eraser.EraseOwned(ctx, statementIDs); err != nil {
+			return fmt.Errorf("erase archive and events: %w", err)
+		}
+		job.Report.Statements += len(archived.StatementIDs)
+		job.Report.Transactions += len(archived.TransactionIDs)
+		job.Report.Events = archived.Events
+		erased = append(append(erased, archived.StatementIDs...), archived.TransactionIDs...)
+	}
+
+	if withArchived := append(statementIDs, archived.StatementIDs...); len(withArchived) > 0 {
+		docs, err := e.Attachments.List(ctx, withArchived...)
+		if err != nil {
+			return fmt.Errorf("list attachments: %w", err)
+		}
+		for _, doc := range docs {
+			if err := e.Attachments.Delete(ctx, doc.ID); err != nil {
+				return fmt.Errorf("delete attachment %s: %w", doc.ID, err)
+			}
+			job.Report.Attachments++
+		}
+	}
+
+	transactionIDs := make([]string, len(transactions))
+	for i := range transactions {
+		transactionIDs[i] = transactions[i].ID
+	}
+	if len(transactionIDs) > 0 {
+		if err := e.Repo.BulkDeleteTransactions(ctx, transactionIDs); err != nil {
+			return fmt.Errorf("delete transactions: %w", err)
+		}
+		job.Report.Transactions += len(transactionIDs)
+		erased = append(erased, transactionIDs...)
+	}
+	for _, id := range statementIDs {
+		if err := e.Repo.DeleteStatement(ctx, id); err != nil {
+			return fmt.Errorf("delete statement %s: %w", id, err)
+		}
+		job.Report.Statements++
+		erased = append(erased, id)
+	}
+
+	if e.Webhooks != nil {
+		if job.Report.Deliveries, err = e.Webhooks.EraseOwned(ctx); err != nil {
+			return fmt.Errorf("erase webhooks: %w", err)
+		}
+	}
+
+	// after the deletes, which are audited with the data deleted
+	if store, ok := statements.AsAuditStore(e.Repo); ok {
+		deleted, anonymized, err := store.EraseAudit(ctx, erased, job.UserID)
+		job.Report.AuditDeleted, job.Report.AuditAnonymized = deleted, anonymized
+		if err != nil {
+			return fmt.Errorf("erase audit log: %w", err)
+		}
+	}
+	return nil
+}
+
+// rebuild recomputes the derived data, unscoped as it covers everyone.
+func (e *Eraser) rebuild(ctx context.Context) error {
+	now := time.Now().UTC()
+	for _, d := range e.Derived {
+		if err := d.Rebuild(ctx, now); err != nil {
+			return fmt.Errorf("rebuild %T: %w", d, err)
+		}
+	}
+	return nil
+}
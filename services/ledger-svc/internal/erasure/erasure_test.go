@@ -0,0 +1,120 @@
+package erasure
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/attachments"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/webhooks"
+)
+
+type countingRebuilder struct{ rebuilds int }
+
+func (r *countingRebuilder) Rebuild(ctx context.Context, now time.Time) error {
+	if statements.OwnerFrom(ctx) != "" {
+		panic("rebuild scoped to " + statements.OwnerFrom(ctx))
+	}
+	r.rebuilds++
+	return nil
+}
+
+func TestEraseDeletesTheUserOfTheTenantEverywhere(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	inner := statements.NewInMemoryRepo()
+	repo := statements.NewScopedRepo(inner)
+	hooks := webhooks.NewMemoryStore()
+	derived := &countingRebuilder{}
+	eraser := &Eraser{Repo: repo, Attachments: attachments.NewMemoryStore(), Jobs: NewMemoryStore(), Webhooks: hooks, Derived: []Rebuilder{derived}}
+
+	aliceAcme := statements.WithUser(statements.WithTenant(ctx, "acme"), "alice")
+	aliceUmbrella := statements.WithUser(statements.WithTenant(ctx, "umbrella"), "alice")
+	bobAcme := statements.WithUser(statements.WithTenant(ctx, "acme"), "bob")
+	for _, owner := range []context.Context{aliceAcme, aliceUmbrella, bobAcme} {
+		stmt := &statements.Statement{ID: statements.OwnerFrom(owner) + ":stmt", SourceName: "TSIB", Currency: "TWD"}
+		if err := repo.UpsertStatement(owner, stmt); err != nil {
+			t.Fatalf("UpsertStatement() error = %v", err)
+		}
+		tx := statements.Transaction{ID: statements.OwnerFrom(owner) + ":coffee", StatementID: stmt.ID, Description: "coffee", Amount: 50, Date: time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)}
+		if err := repo.BulkUpsertTransactions(owner, []statements.Transaction{tx}); err != nil {
+			t.Fatalf("BulkUpsertTransactions() error = %v", err)
+		}
+		if err := eraser.Attachments.Save(owner, &attachments.Attachment{ID: stmt.ID + ":receipt", StatementID: stmt.ID}, strings.NewReader("pdf")); err != nil {
+			t.Fatalf("Save() attachment error = %v", err)
+		}
+		if err := hooks.Save(owner, &webhooks.Subscription{ID: statements.OwnerFrom(owner) + ":hook"}); err != nil {
+			t.Fatalf("Save() subscription error = %v", err)
+		}
+	}
+	// an unowned subscription sees everyone, its deliveries about alice go
+	// with her
+	if err := hooks.Save(ctx, &webhooks.Subscription{ID: "admin"}); err != nil {
+		t.Fatalf("Save() subscription error = %v", err)
+	}
+	if err := hooks.Enqueue(ctx, []webhooks.Delivery{
+		{ID: "admin:alice", SubscriptionID: "admin", TenantID: "acme", UserID: "alice"},
+		{ID: "admin:bob", SubscriptionID: "admin", TenantID: "acme", UserID: "bob"},
+		{ID: "acme/alice:hook:1", SubscriptionID: "acme/alice:hook"},
+	}); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	job, err := eraser.Start(statements.WithTenant(ctx, "acme"), "alice", "admin")
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == StatusRunning && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		if job, err = eraser.Jobs.Get(ctx, job.ID); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+	}
+	if job.Status != StatusDone {
+		t.Fatalf("job = %+v, want done", job)
+	}
+	want := Report{Statements: 1, Transactions: 1, Attachments: 1, Events: 1, Deliveries: 2}
+	if job.Report != want {
+		t.Errorf("report = %+v, want %+v", job.Report, want)
+	}
+
+	left, _ := inner.ListStatements(ctx, statements.StatementFilter{})
+	if len(left) != 2 {
+		t.Errorf("statements left = %d, want those of alice in umbrella and bob", len(left))
+	}
+	for _, stmt := range left {
+		if stmt.TenantID == "acme" && stmt.UserID == "alice" {
+			t.Errorf("statement %s of alice in acme was kept", stmt.ID)
+		}
+	}
+	if docs, _ := eraser.Attachments.List(ctx, "umbrella/alice:stmt", "acme/bob:stmt", "acme/alice:stmt"); len(docs) != 2 {
+		t.Errorf("attachments left = %d, want 2", len(docs))
+	}
+
+	events, _ := inner.PendingEvents(ctx, 100)
+	for _, e := range events {
+		if e.TenantID == "acme" && e.UserID == "alice" && (e.Statement != nil || e.Transaction != nil) {
+			t.Errorf("event %s carrying data of alice in acme was kept", e.Type)
+		}
+	}
+
+	if sub, _ := hooks.Get(aliceAcme, "acme/alice:hook"); sub != nil {
+		t.Error("subscription of alice in acme was kept")
+	}
+	if sub, _ := hooks.Get(aliceUmbrella, "umbrella/alice:hook"); sub == nil {
+		t.Error("subscription of alice in umbrella was erased")
+	}
+	if d, _ := hooks.Delivery(ctx, "admin:alice"); d != nil {
+		t.Error("delivery about alice in acme was kept")
+	}
+	if d, _ := hooks.Delivery(ctx, "admin:bob"); d == nil {
+		t.Error("delivery about bob was erased")
+	}
+	if derived.rebuilds != 1 {
+		t.Errorf("rebuilds = %d, want 1", derived.rebuilds)
+	}
+}
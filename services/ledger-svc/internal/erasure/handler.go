@@ -0,0 +1,61 @@
+package erasure
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/authz"
+)
+
+type Handler struct {
+	Eraser *Eraser
+}
+
+// EraseHandler serves DELETE /api/users/{id}/data, answering 202 with the
+// job erasing the data of the user, polled at its Location.
+func (h *Handler) EraseHandler(w http.ResponseWriter, r *http.Request) {
+	userID := strings.TrimSpace(r.PathValue("id"))
+	if userID == "" {
+		apierror.Reply(w, "Missing user ID", http.StatusBadRequest)
+		return
+	}
+	requestedBy := r.Header.Get(authz.SubjectHeader)
+	if requestedBy == "" {
+		requestedBy = "anonymous"
+	}
+	job, err := h.Eraser.Start(r.Context(), userID, requestedBy)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to start erasure", "user", userID, "error", err)
+		apierror.Reply(w, "Failed to start erasure", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", "/api/erasures/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// JobHandler serves GET /api/erasures/{id}, the status and report of a job.
+func (h *Handler) JobHandler(w http.ResponseWriter, r *http.Request) {
+	job, err := h.Eraser.Jobs.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to get erasure", "id", r.PathValue("id"), "error", err)
+		apierror.Reply(w, "Failed to get erasure", http.StatusInternalServerError)
+		return
+	}
+	if job == nil {
+		apierror.Write(w, ErrNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
@@ -0,0 +1,96 @@
+package erasure
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Store keeps the erasure jobs.
+type Store interface {
+	// Get returns nil when the job does not exist or is of another tenant
+	// than the one of ctx.
+	Get(ctx context.Context, id string) (*Job, error)
+	// Save creates or replaces the job by ID.
+	Save(ctx context.Context, job *Job) error
+}
+
+// NewStore keeps the jobs next to the statements in MongoDB, so every replica
+// reports them, or in memory for the memory driver.
+func NewStore(repo statements.StatementRepository) Store {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryStore()
+}
+
+// visible reports whether the job is of the tenant ctx is scoped to; the jobs
+// are about a user, not owned by them, and admins of the tenant see them all.
+func visible(ctx context.Context, job *Job) bool {
+	tenant := statements.TenantFrom(ctx)
+	return tenant == "" || job.TenantID == tenant
+}
+
+type MemoryStore struct {
+	mu   sync.RWMutex
+	jobs map[string]Job
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]Job)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok || !visible(ctx, &job) {
+		return nil, nil
+	}
+	return &job, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[job.ID] = *job
+	return nil
+}
+
+// MongoStore keeps the jobs in the <namespace>erasures collection.
+type MongoStore struct {
+	jobs *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database, namespace string) *MongoStore {
+	return &MongoStore{jobs: db.Collection(namespace + "erasures")}
+}
+
+func (s *MongoStore) Get(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	filter := bson.M{"_id": id}
+	if tenant := statements.TenantFrom(ctx); tenant != "" {
+		filter["tenant_id"] = tenant
+	}
+	err := s.jobs.FindOne(ctx, filter).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *MongoStore) Save(ctx context.Context, job *Job) error {
+	_, err := s.jobs.ReplaceOne(ctx, bson.M{"_id": job.ID}, job, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,63 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const dispatchBatchSize = 100
+
+// Dispatcher publishes the outbox in order. An event that fails to publish stops
+// the batch and is retried on the next tick, so events of a statement are never
+// reordered.
+type Dispatcher struct {
+	Outbox statements.Outbox
+	Sink   Sink
+}
+
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Dispatch(ctx); err != nil {
+				slog.Warn("Failed to dispatch change events", "error", err)
+			}
+		}
+	}
+}
+
+// Dispatch publishes pending events until the outbox is empty or a publish fails.
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	for {
+		pending, err := d.Outbox.PendingEvents(ctx, dispatchBatchSize)
+		if err != nil || len(pending) == 0 {
+			return err
+		}
+
+		published := make([]string, 0, len(pending))
+		var publishErr error
+		for _, event := range pending {
+			if publishErr = d.Sink.Publish(ctx, event); publishErr != nil {
+				break
+			}
+			published = append(published, event.ID)
+		}
+
+		if err := d.Outbox.MarkDispatched(ctx, published); err != nil {
+			return err
+		}
+		if publishErr != nil {
+			return publishErr
+		}
+		if len(pending) < dispatchBatchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Sink publishes change events. Delivery is at least once, consumers
+// deduplicate by event ID.
+type Sink interface {
+	Publish(ctx context.Context, event statements.ChangeEvent) error
+}
+
+// SinkFromEnv builds the sink named by EVENTS_SINK (log, webhook or nats).
+// The log sink is the default so the outbox is always drained.
+func SinkFromEnv() (Sink, error) {
+	switch kind := envOr("EVENTS_SINK", "log"); kind {
+	case "log":
+		return LogSink{}, nil
+	case "webhook":
+		url := os.Getenv("EVENTS_WEBHOOK_URL")
+		if url == "" {
+			return nil, fmt.Errorf("EVENTS_WEBHOOK_URL is required for the webhook sink")
+		}
+		return &WebhookSink{URL: url, Secret: os.Getenv("EVENTS_WEBHOOK_SECRET"), Client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "nats":
+		url := os.Getenv("EVENTS_NATS_URL")
+		if url == "" {
+			url = nats.DefaultURL
+		}
+		conn, err := nats.Connect(url, nats.Name("finchie-ledger"), nats.MaxReconnects(-1))
+		if err != nil {
+			return nil, err
+		}
+		return &NATSSink{Conn: conn, SubjectPrefix: envOr("EVENTS_NATS_SUBJECT_PREFIX", "finchie.")}, nil
+	default:
+		return nil, fmt.Errorf("unknown EVENTS_SINK %q, expected log, webhook or nats", kind)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// MultiSink publishes every event to all sinks. A failing sink fails the event,
+// which is then published again to all of them.
+type MultiSink []Sink
+
+func (m MultiSink) Publish(ctx context.Context, event statements.ChangeEvent) error {
+	for _, sink := range m {
+		if err := sink.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type LogSink struct{}
+
+func (LogSink) Publish(_ context.Context, event statements.ChangeEvent) error {
+	slog.Info("Change event", "id", event.ID, "type", event.Type, "statement_id", event.StatementID, "transaction_id", event.TransactionID)
+	return nil
+}
+
+// WebhookSink POSTs every event as JSON. With a secret, the body is signed with
+// HMAC-SHA256 in the X-Finchie-Signature header.
+type WebhookSink struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+func (s *WebhookSink) Publish(ctx context.Context, event statements.ChangeEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Finchie-Event", event.Type)
+	if s.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Finchie-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// NATSSink publishes to <prefix><event type>, e.g. finchie.statement.created.
+type NATSSink struct {
+	Conn          *nats.Conn
+	SubjectPrefix string
+}
+
+func (s *NATSSink) Publish(ctx context.Context, event statements.ChangeEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(s.SubjectPrefix + event.Type)
+	msg.Header.Set(nats.MsgIdHdr, event.ID)
+	msg.Data = body
+	if err := s.Conn.PublishMsg(msg); err != nil {
+		return err
+	}
+	// wait for the server to have the message before it is marked dispatched
+	return s.Conn.FlushWithContext(ctx)
+}
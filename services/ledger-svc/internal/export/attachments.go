@@ -0,0 +1,147 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/attachments"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+var manifestColumns = []string{
+	"path", "attachment_id", "statement_id", "source_name", "payment_due_date",
+	"name", "content_type", "size", "error",
+}
+
+// AttachmentsZipHandler serves GET /api/export/attachments for the statements
+// due in the months from to to, both YYYY-MM. The ZIP has the attachments as
+// <source name>/<due date>/<name> and a manifest.csv listing them; it is
+// streamed, so an attachment that fails to read is left out and its error
+// noted in the manifest.
+func (e *ExportManager) AttachmentsZipHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, err := time.Parse(monthLayout, query.Get("from"))
+	if err != nil {
+		apierror.Reply(w, "Invalid from parameter, expected YYYY-MM", http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(monthLayout, query.Get("to"))
+	if err != nil {
+		apierror.Reply(w, "Invalid to parameter, expected YYYY-MM", http.StatusBadRequest)
+		return
+	}
+	if to.Before(from) {
+		apierror.Reply(w, "Invalid period", http.StatusBadRequest)
+		return
+	}
+	to = to.AddDate(0, 1, 0)
+
+	stmts, err := e.Repo.ListStatements(r.Context(), statements.StatementFilter{})
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list statements for attachment export", "error", err)
+		apierror.Reply(w, "Failed to list statements", http.StatusInternalServerError)
+		return
+	}
+	byID := map[string]*statements.Statement{}
+	ids := []string{}
+	for i := range stmts {
+		due := stmts[i].PaymentDueDate
+		if due != nil && !due.Before(from) && due.Before(to) {
+			byID[stmts[i].ID] = &stmts[i]
+			ids = append(ids, stmts[i].ID)
+		}
+	}
+	list, err := e.Attachments.List(r.Context(), ids...)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list attachments for export", "error", err)
+		apierror.Reply(w, "Failed to list attachments", http.StatusInternalServerError)
+		return
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return byID[list[i].StatementID].PaymentDueDate.Before(*byID[list[j].StatementID].PaymentDueDate)
+	})
+
+	filename := fmt.Sprintf("finchie_attachments_%s_%s.zip", from.Format(monthLayout), to.AddDate(0, -1, 0).Format(monthLayout))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	archive := zip.NewWriter(w)
+
+	var manifest strings.Builder
+	manifestWriter := csv.NewWriter(&manifest)
+	_ = manifestWriter.Write(manifestColumns)
+	used := map[string]int{}
+	for _, a := range list {
+		stmt := byID[a.StatementID]
+		due := stmt.PaymentDueDate.UTC().Format(time.DateOnly)
+		name := uniqueName(used, path.Join(zipSegment(stmt.SourceName), due, zipSegment(attachments.CleanName(a.Name))))
+
+		errText := ""
+		if err := copyAttachment(r, e.Attachments, archive, a, name); err != nil {
+			accesslog.Logger(r.Context()).Error("Failed to add attachment to export", "id", a.ID, "error", err)
+			errText, name = err.Error(), ""
+		}
+		_ = manifestWriter.Write([]string{
+			name, a.ID, a.StatementID, stmt.SourceName, due,
+			a.Name, a.ContentType, strconv.FormatInt(a.Size, 10), errText,
+		})
+	}
+	manifestWriter.Flush()
+
+	entry, err := archive.Create("manifest.csv")
+	if err == nil {
+		_, err = io.WriteString(entry, manifest.String())
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to finish attachment export", "error", err)
+	}
+}
+
+// copyAttachment adds the attachment to the archive. The entry is only created
+// once the content opened, a failure while copying leaves a truncated entry.
+func copyAttachment(r *http.Request, store attachments.Store, archive *zip.Writer, a attachments.Attachment, name string) error {
+	_, content, err := store.Open(r.Context(), a.ID)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: a.UploadedAt})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, content)
+	return err
+}
+
+// zipSegment keeps a path segment from adding directories or escaping the
+// archive.
+func zipSegment(s string) string {
+	s = strings.NewReplacer("/", "_", `\`, "_").Replace(strings.TrimSpace(s))
+	if s == "" || s == "." || s == ".." {
+		return "_"
+	}
+	return s
+}
+
+// uniqueName numbers the repeated names, receipt.pdf, receipt (2).pdf, ...
+func uniqueName(used map[string]int, name string) string {
+	used[name]++
+	if n := used[name]; n > 1 {
+		ext := path.Ext(name)
+		return uniqueName(used, fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext))
+	}
+	return name
+}
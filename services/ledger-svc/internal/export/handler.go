@@ -0,0 +1,245 @@
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/attachments"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/categories"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+type ExportManager struct {
+	Repo        statements.StatementRepository
+	Categories  categories.Store
+	Attachments attachments.Store
+}
+
+// CategoryRollupHandler serves GET /api/export/rollup.csv for the months from
+// to to, both YYYY-MM. With depth=N the categories are rolled up to the ones N
+// levels below the top, along the latest taxonomy or the one of
+// taxonomy_version; spend_type limits it to one spend type.
+
+func (e *ExportManager) CategoryRollupHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, err := time.Parse(monthLayout, query.Get("from"))
+	if err != nil {
+		apierror.Reply(w, "Invalid from parameter, expected YYYY-MM", http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(monthLayout, query.Get("to"))
+	if err != nil {
+		apierror.Reply(w, "Invalid to parameter, expected YYYY-MM", http.StatusBadRequest)
+		return
+	}
+	if to.Before(from) || monthIndex(from, to) >= maxRollupMonthsRange {
+		apierror.Reply(w, "Invalid period", http.StatusBadRequest)
+		return
+	}
+
+	rollup := NewCategoryRollup(from, to)
+	if depth := query.Get("depth"); depth != "" && depth != "0" {
+		n, err := strconv.Atoi(depth)
+		if err != nil || n < 0 {
+			apierror.Reply(w, "Invalid depth parameter", http.StatusBadRequest)
+			return
+		}
+		taxonomy := &categories.Taxonomy{}
+		if e.Categories != nil {
+			taxonomy, err = categories.Resolve(r.Context(), e.Categories, query.Get("taxonomy_version"))
+			if errors.Is(err, categories.ErrUnknownVersion) {
+				apierror.Reply(w, "Invalid taxonomy_version parameter", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				accesslog.Logger(r.Context()).Error("Failed to read the category taxonomy", "error", err)
+				apierror.Reply(w, "Failed to read the category taxonomy", http.StatusInternalServerError)
+				return
+			}
+		}
+		rollup.RollUp = func(category string) string { return taxonomy.RollUp(category, n) }
+	}
+	spendType, err := statements.ParseSpendType(query.Get("spend_type"))
+	if err != nil {
+		apierror.Reply(w, "Invalid spend_type parameter", http.StatusBadRequest)
+		return
+	}
+	filter := statements.TransactionFilter{From: from, To: to.AddDate(0, 1, 0), SpendType: spendType}
+	_, err = forEachPage(r.Context(), e.Repo, filter, "", 0, func(page []statements.Transaction) error {
+		for i := range page {
+			rollup.Add(&page[i])
+		}
+		return nil
+	})
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to retrieve transactions for export", "from", from, "to", to, "error", err)
+		apierror.Reply(w, "Failed to retrieve transactions", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("finchie_rollup_%s_%s.csv", from.Format(monthLayout), to.Format(monthLayout))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	body, err := compressResponse(w, r)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to create response compressor", "error", err)
+		apierror.Reply(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+	if err := rollup.WriteCSV(body); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to write rollup CSV", "error", err)
+	}
+}
+
+const cursorRangeUnit = "cursor"
+
+var transactionColumns = []string{
+	"id", "statement_id", "date", "description", "category", "amount",
+	"currency", "merchant_city", "merchant_country", "is_foreign", "external_refs", "spend_type",
+	"owner", "paid_by",
+}
+
+// TransactionsCSVHandler streams transactions as CSV in ID order, one compressed
+// chunk per repository page. An interrupted download is resumed from the last
+// received ID, either with ?after=<id> or "Range: cursor=<id>-"; the resumed
+// body has no header row so it can be appended to the partial file. The last
+// ID and whether the export is complete are sent as trailers. The export is
+// not bound by the request timeout; the write deadline is extended page by
+// page instead, so only a stalled client cuts it off.
+func (e *ExportManager) TransactionsCSVHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	query := r.URL.Query()
+	var filter statements.TransactionFilter
+	filter.StatementID = query.Get("statement_id")
+	spendType, err := statements.ParseSpendType(query.Get("spend_type"))
+	if err != nil {
+		apierror.Reply(w, "Invalid spend_type parameter", http.StatusBadRequest)
+		return
+	}
+	filter.SpendType = spendType
+	if v := query.Get("from"); v != "" {
+		from, err := time.Parse(monthLayout, v)
+		if err != nil {
+			apierror.Reply(w, "Invalid from parameter, expected YYYY-MM", http.StatusBadRequest)
+			return
+		}
+		filter.From = from
+	}
+	if v := query.Get("to"); v != "" {
+		to, err := time.Parse(monthLayout, v)
+		if err != nil {
+			apierror.Reply(w, "Invalid to parameter, expected YYYY-MM", http.StatusBadRequest)
+			return
+		}
+		filter.To = to.AddDate(0, 1, 0)
+	}
+
+	limit := 0
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			apierror.Reply(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	after := query.Get("after")
+	unit, spec, rangeRequest := strings.Cut(r.Header.Get("Range"), "=")
+	// other range units are ignored, as RFC 9110 allows
+	rangeRequest = rangeRequest && unit == cursorRangeUnit
+	if rangeRequest {
+		after = strings.TrimSuffix(spec, "-")
+	}
+	resumed := after != ""
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="finchie_transactions.csv"`)
+	w.Header().Set("Accept-Ranges", cursorRangeUnit)
+	w.Header().Set("Trailer", "X-Export-Cursor, X-Export-Complete")
+	// past the read timeout of the server the watch for the client going away
+	// fails and cancels the request
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Now().Add(pageWriteWait))
+	body, err := compressResponse(w, r)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to create response compressor", "error", err)
+		apierror.Reply(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if rangeRequest {
+		w.Header().Set("Content-Range", fmt.Sprintf("%s %s-", cursorRangeUnit, after))
+		w.WriteHeader(http.StatusPartialContent)
+	}
+
+	writer := csv.NewWriter(body)
+	if !resumed {
+		_ = writer.Write(transactionColumns)
+	}
+
+	cursor := after
+	more, err := forEachPage(r.Context(), e.Repo, filter, after, limit, func(page []statements.Transaction) error {
+		_ = rc.SetWriteDeadline(time.Now().Add(pageWriteWait))
+		for _, tx := range page {
+			if err := writer.Write(transactionRecord(&tx)); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+		cursor = page[len(page)-1].ID
+		return flush(rc, body)
+	})
+	complete := err == nil && !more
+	if err != nil {
+		// the status line is gone by now, the trailer tells the client to resume
+		accesslog.Logger(r.Context()).Error("Failed to stream transactions export", "cursor", cursor, "error", err)
+	}
+	if err := body.Close(); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to finish transactions export", "error", err)
+	}
+	w.Header().Set("X-Export-Cursor", cursor)
+	w.Header().Set("X-Export-Complete", strconv.FormatBool(complete))
+}
+
+func transactionRecord(tx *statements.Transaction) []string {
+	isForeign := ""
+	if tx.IsForeign != nil {
+		isForeign = strconv.FormatBool(*tx.IsForeign)
+	}
+	return []string{
+		tx.ID,
+		tx.StatementID,
+		tx.Date.UTC().Format(time.DateOnly),
+		tx.Description,
+		tx.Category,
+		formatAmount(tx.Amount),
+		tx.Currency,
+		tx.MerchantCity,
+		tx.MerchantCountry,
+		isForeign,
+		formatExternalRefs(tx.ExternalRefs),
+		string(statements.ClassifySpend(tx)),
+		tx.Owner,
+		tx.PaidBy,
+	}
+}
+
+// formatExternalRefs joins the references as "type:value;type:value".
+func formatExternalRefs(refs []statements.ExternalRef) string {
+	parts := make([]string, len(refs))
+	for i, ref := range refs {
+		parts[i] = ref.Type + ":" + ref.Value
+	}
+	return strings.Join(parts, ";")
+}
@@ -0,0 +1,121 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const (
+	monthLayout          = "2006-01"
+	uncategorizedLabel   = "Uncategorized"
+	totalLabel           = "Total"
+	maxRollupMonthsRange = 120
+)
+
+// CategoryRollup is a pivot of transaction totals: one row per category and
+// one column per month of the requested period.
+type CategoryRollup struct {
+	Months     []time.Time
+	Categories []string
+	Totals     map[string][]float64
+	// RollUp maps a category to the row it is added to, e.g. its parent.
+	RollUp func(category string) string
+}
+
+func NewCategoryRollup(from, to time.Time) *CategoryRollup {
+	rollup := &CategoryRollup{Totals: map[string][]float64{}}
+	for m := from; !m.After(to); m = m.AddDate(0, 1, 0) {
+		rollup.Months = append(rollup.Months, m)
+	}
+	return rollup
+}
+
+func BuildCategoryRollup(transactions []statements.Transaction, from, to time.Time) *CategoryRollup {
+	rollup := NewCategoryRollup(from, to)
+	for i := range transactions {
+		rollup.Add(&transactions[i])
+	}
+	return rollup
+}
+
+// Add accumulates one transaction, so a rollup can be built page by page
+// without holding the whole period in memory.
+func (c *CategoryRollup) Add(tx *statements.Transaction) {
+	idx := monthIndex(c.Months[0], tx.Date)
+	if idx < 0 || idx >= len(c.Months) {
+		return
+	}
+
+	category := tx.Category
+	if category == "" {
+		category = uncategorizedLabel
+	} else if c.RollUp != nil {
+		category = c.RollUp(category)
+	}
+	row, ok := c.Totals[category]
+	if !ok {
+		row = make([]float64, len(c.Months))
+		c.Totals[category] = row
+		c.Categories = append(c.Categories, category)
+	}
+	row[idx] += tx.Amount
+}
+
+func monthIndex(from, date time.Time) int {
+	date = date.UTC()
+	return (date.Year()-from.Year())*12 + int(date.Month()) - int(from.Month())
+}
+
+// WriteCSV writes the pivot with a trailing total column and total row, the
+// layout of the historical spreadsheet workbook.
+func (c *CategoryRollup) WriteCSV(w io.Writer) error {
+	sort.Strings(c.Categories)
+	writer := csv.NewWriter(w)
+
+	header := []string{"Category"}
+	for _, m := range c.Months {
+		header = append(header, m.Format(monthLayout))
+	}
+	header = append(header, totalLabel)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	columnTotals := make([]float64, len(c.Months))
+	var grandTotal float64
+	for _, category := range c.Categories {
+		record := []string{category}
+		var rowTotal float64
+		for i, amount := range c.Totals[category] {
+			record = append(record, formatAmount(amount))
+			rowTotal += amount
+			columnTotals[i] += amount
+		}
+		record = append(record, formatAmount(rowTotal))
+		grandTotal += rowTotal
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	footer := []string{totalLabel}
+	for _, amount := range columnTotals {
+		footer = append(footer, formatAmount(amount))
+	}
+	footer = append(footer, formatAmount(grandTotal))
+	if err := writer.Write(footer); err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func formatAmount(amount float64) string {
+	return money.FormatPlain(amount)
+}
@@ -0,0 +1,106 @@
+package export
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+	"github.com/klauspost/compress/zstd"
+)
+
+// exportPageSize is the number of transactions read from the repository and
+// flushed to the client at a time.
+const exportPageSize = 1000
+
+// pageWriteWait bounds the writing of one page to a slow client. The export
+// itself has no deadline, every page extends it.
+const pageWriteWait = 30 * time.Second
+
+type flushWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+type identityWriter struct {
+	io.Writer
+}
+
+func (identityWriter) Flush() error { return nil }
+func (identityWriter) Close() error { return nil }
+
+// compressResponse picks zstd or gzip from Accept-Encoding (zstd first) and
+// returns the writer the body has to go through. Close must be called once the
+// body is complete.
+func compressResponse(w http.ResponseWriter, r *http.Request) (flushWriter, error) {
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.ReplaceAll(strings.TrimSpace(params), " ", "") == "q=0" {
+			continue
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+
+	switch {
+	case accepted["zstd"]:
+		w.Header().Set("Content-Encoding", "zstd")
+		return zstd.NewWriter(w)
+	case accepted["gzip"]:
+		w.Header().Set("Content-Encoding", "gzip")
+		return gzip.NewWriter(w), nil
+	default:
+		return identityWriter{w}, nil
+	}
+}
+
+// flush pushes everything written so far through the compressor and out to
+// the client as one chunk.
+func flush(rc *http.ResponseController, body flushWriter) error {
+	if err := body.Flush(); err != nil {
+		return err
+	}
+	if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// forEachPage walks the transactions matching filter in ID order, starting after
+// the given cursor, one repository page at a time. It stops once limit
+// transactions were visited (0 means no limit) and reports whether more remain.
+func forEachPage(ctx context.Context, repo statements.StatementRepository, filter statements.TransactionFilter, after string, limit int, fn func([]statements.Transaction) error) (bool, error) {
+	visited := 0
+	for {
+		size := exportPageSize
+		if limit > 0 {
+			size = min(size, limit-visited)
+		}
+		page, err := repo.ListTransactions(ctx, filter, statements.Page{Limit: size, After: after})
+		if err != nil {
+			return false, err
+		}
+		if len(page) == 0 {
+			return false, nil
+		}
+		if err := fn(page); err != nil {
+			return false, err
+		}
+
+		visited += len(page)
+		after = page[len(page)-1].ID
+		if len(page) < size {
+			return false, nil
+		}
+		if limit > 0 && visited >= limit {
+			more, err := repo.ListTransactions(ctx, filter, statements.Page{Limit: 1, After: after})
+			return len(more) > 0, err
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Package forecast projects the upcoming outflows week by week: the card
+// statements falling due, the recurring charges the merchant rollup detects
+// and the rest of the spend, projected from its history by a pluggable model.
+package forecast
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/merchants"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const (
+	dayLayout = "2006-01-02"
+	day       = 24 * time.Hour
+	week      = 7 * day
+
+	// historyWeeks is how much spend the models learn from, two years for
+	// the seasonal one.
+	historyWeeks = 104
+)
+
+// Week is the projection of a week starting on Monday. Statements are the
+// amounts to pay of the statements due that week, between the minimum payment
+// and the total amount; subscriptions the recurring charges expected that
+// week; spend the rest of the charges as the model projects them.
+type Week struct {
+	Start         string  `json:"start"`
+	Statements    float64 `json:"statements"`
+	Subscriptions float64 `json:"subscriptions"`
+	Spend         Band    `json:"spend"`
+	Expected      float64 `json:"expected"`
+	Low           float64 `json:"low"`
+	High          float64 `json:"high"`
+}
+
+// Forecast covers the days from From to To, both inclusive. The totals add up
+// the weeks, bands included.
+type Forecast struct {
+	Model    string  `json:"model"`
+	From     string  `json:"from"`
+	To       string  `json:"to"`
+	Weeks    []Week  `json:"weeks"`
+	Expected float64 `json:"expected"`
+	Low      float64 `json:"low"`
+	High     float64 `json:"high"`
+}
+
+// Project forecasts the outflows of the horizon days from now on with the
+// named model. Merchants may be nil, the recurring charges are then left in
+// the projected spend.
+func Project(ctx context.Context, repo statements.StatementRepository, store merchants.Store, modelName string, now time.Time, horizon int) (*Forecast, error) {
+	model, ok := lookupModel(modelName)
+	if !ok {
+		return nil, ErrUnknownModel
+	}
+
+	today := now.UTC().Truncate(day)
+	end := today.AddDate(0, 0, horizon)
+	start := weekStart(today)
+	weeks := int((end.Sub(start) + week - 1) / week)
+	f := &Forecast{
+		Model: modelName,
+		From:  today.Format(dayLayout),
+		To:    end.AddDate(0, 0, -1).Format(dayLayout),
+		Weeks: make([]Week, weeks),
+	}
+	for i := range f.Weeks {
+		f.Weeks[i].Start = start.Add(time.Duration(i) * week).Format(dayLayout)
+	}
+	weekOf := func(t time.Time) int {
+		return int(t.Sub(start) / week)
+	}
+
+	all, err := repo.ListStatements(ctx, statements.StatementFilter{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range all {
+		stmt := &all[i]
+		if stmt.SourceType == statements.BankAccount || stmt.IsPaid() || stmt.PaymentDueDate == nil {
+			continue
+		}
+		due := stmt.PaymentDueDate.UTC().Truncate(day)
+		amount := stmt.AmountToPay()
+		if due.Before(today) || !due.Before(end) || amount <= 0 {
+			continue
+		}
+		w := &f.Weeks[weekOf(due)]
+		w.Statements += amount
+		low, high := amount, math.Max(amount, stmt.TotalAmount)
+		if stmt.MinimumPaymentDue != nil {
+			low = math.Min(low, *stmt.MinimumPaymentDue)
+		}
+		w.Low += low
+		w.High += high
+	}
+
+	recurring := make(map[string]bool)
+	if store != nil {
+		charges, err := merchants.ActiveRecurring(ctx, store, now)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range charges {
+			recurring[r.Merchant] = true
+			for n := 1; ; n++ {
+				next := addMonths(r.LastDate, n)
+				if !next.Before(end) {
+					break
+				}
+				if next.Before(today) {
+					continue
+				}
+				w := &f.Weeks[weekOf(next)]
+				w.Subscriptions += r.Amount
+				w.Low += r.Amount
+				w.High += r.Amount
+			}
+		}
+	}
+
+	history, err := weeklySpend(ctx, repo, start, recurring)
+	if err != nil {
+		return nil, err
+	}
+	for i, b := range model.Forecast(history, weeks) {
+		w := &f.Weeks[i]
+		// the first and last weeks are only partly ahead
+		from := maxTime(start.Add(time.Duration(i)*week), today)
+		to := minTime(start.Add(time.Duration(i+1)*week), end)
+		share := float64(to.Sub(from)) / float64(week)
+		w.Spend = Band{Expected: money.Round(b.Expected * share), Low: money.Round(b.Low * share), High: money.Round(b.High * share)}
+
+		w.Statements = money.Round(w.Statements)
+		w.Subscriptions = money.Round(w.Subscriptions)
+		w.Expected = money.Round(w.Statements + w.Subscriptions + w.Spend.Expected)
+		w.Low = money.Round(w.Low + w.Spend.Low)
+		w.High = money.Round(w.High + w.Spend.High)
+		f.Expected += w.Expected
+		f.Low += w.Low
+		f.High += w.High
+	}
+	f.Expected = money.Round(f.Expected)
+	f.Low = money.Round(f.Low)
+	f.High = money.Round(f.High)
+	return f, nil
+}
+
+// weeklySpend returns the weekly totals of the charges of the historyWeeks
+// before start, from the first week with any, leaving out transfers, refunds
+// and the recurring merchants.
+func weeklySpend(ctx context.Context, repo statements.StatementRepository, start time.Time, recurring map[string]bool) ([]float64, error) {
+	from := start.Add(-historyWeeks * week)
+	txs, err := repo.FindTransactions(ctx, statements.TransactionFilter{From: from, To: start})
+	if err != nil {
+		return nil, err
+	}
+	totals := make([]float64, historyWeeks)
+	first := historyWeeks
+	for _, tx := range txs {
+		if tx.Amount <= 0 || statements.ClassifySpend(&tx) == statements.SpendTransfer || recurring[merchants.Key(tx.Description)] {
+			continue
+		}
+		i := int(tx.Date.Sub(from) / week)
+		if i < 0 || i >= historyWeeks {
+			continue
+		}
+		totals[i] += tx.Amount
+		first = min(first, i)
+	}
+	return totals[first:], nil
+}
+
+// weekStart returns the Monday of the week of t.
+func weekStart(t time.Time) time.Time {
+	return t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+}
+
+// addMonths returns the same day n months later, the last day of the month
+// when it has no such day.
+func addMonths(t time.Time, n int) time.Time {
+	t = t.UTC().Truncate(day)
+	month := time.Date(t.Year(), t.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	last := month.AddDate(0, 1, -1).Day()
+	return month.AddDate(0, 0, min(t.Day(), last)-1)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,78 @@
+package forecast
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/merchants"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const (
+	defaultHorizon = 90
+	maxHorizon     = 365
+)
+
+var ErrUnknownModel = apierror.New(apierror.KindInvalid, "unknown_forecast_model", "unknown forecast model")
+
+type Handler struct {
+	Repo statements.StatementRepository
+	// Merchants detects the recurring charges, optional.
+	Merchants merchants.Store
+}
+
+// ForecastHandler serves GET /api/analytics/forecast?horizon=90d&model=average,
+// the horizon in days (d) or weeks (w), the model any registered one.
+func (h *Handler) ForecastHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	horizon, ok := parseHorizon(query.Get("horizon"))
+	if !ok {
+		apierror.Reply(w, fmt.Sprintf("Invalid horizon parameter, expected days (90d) or weeks (12w) up to %d days", maxHorizon), http.StatusBadRequest)
+		return
+	}
+	model := query.Get("model")
+	if model == "" {
+		model = DefaultModel
+	}
+
+	f, err := Project(r.Context(), h.Repo, h.Merchants, model, time.Now(), horizon)
+	if errors.Is(err, ErrUnknownModel) {
+		apierror.Reply(w, fmt.Sprintf("Invalid model parameter, expected one of %s", strings.Join(Models(), ", ")), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to compute the forecast", "model", model, "error", err)
+		apierror.Reply(w, "Failed to compute the forecast", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(f); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to encode JSON response", "error", err)
+	}
+}
+
+// parseHorizon reads a horizon like 90d or 12w as days.
+func parseHorizon(s string) (int, bool) {
+	if s == "" {
+		return defaultHorizon, true
+	}
+	unit := 1
+	switch {
+	case strings.HasSuffix(s, "d"):
+		s = strings.TrimSuffix(s, "d")
+	case strings.HasSuffix(s, "w"):
+		s, unit = strings.TrimSuffix(s, "w"), 7
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 || n*unit > maxHorizon {
+		return 0, false
+	}
+	return n * unit, true
+}
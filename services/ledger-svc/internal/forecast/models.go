@@ -0,0 +1,162 @@
+package forecast
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+const (
+	// DefaultModel is the model used when the request names none.
+	DefaultModel = "average"
+
+	// z80 is the z-score of an 80% band, the bands the models give.
+	z80 = 1.2816
+)
+
+// Band is the projection of one week: the expected amount and an 80% band
+// around it.
+type Band struct {
+	Expected float64 `json:"expected"`
+	Low      float64 `json:"low"`
+	High     float64 `json:"high"`
+}
+
+// Model projects the weekly spend. History holds the totals of the past weeks,
+// oldest first, ending with the last full week; Forecast returns one band per
+// week ahead.
+type Model interface {
+	Forecast(history []float64, weeks int) []Band
+}
+
+var (
+	modelsMu sync.RWMutex
+	models   = make(map[string]Model)
+)
+
+// RegisterModel makes a model usable in the model parameter of the forecast.
+// It panics when the name is already taken, like statements.RegisterDriver.
+func RegisterModel(name string, model Model) {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+
+	if model == nil {
+		panic("forecast: RegisterModel model is nil")
+	}
+	if _, dup := models[name]; dup {
+		panic("forecast: RegisterModel called twice for model " + name)
+	}
+	models[name] = model
+}
+
+// Models returns the names of the registered models.
+func Models() []string {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+
+	names := make([]string, 0, len(models))
+	for name := range models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupModel(name string) (Model, bool) {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+
+	model, ok := models[name]
+	return model, ok
+}
+
+func init() {
+	RegisterModel(DefaultModel, Average{Weeks: 12})
+	RegisterModel("seasonal", Seasonal{Period: 52, Weeks: 12})
+}
+
+// Average projects the mean of the last weeks, the band spanning their
+// standard deviation.
+type Average struct {
+	Weeks int
+}
+
+func (m Average) Forecast(history []float64, weeks int) []Band {
+	recent := tail(history, m.Weeks)
+	mean, sd := meanStd(recent)
+	bands := make([]Band, weeks)
+	for i := range bands {
+		bands[i] = band(mean, sd)
+	}
+	return bands
+}
+
+// Seasonal projects the same week one period earlier, scaled by how the last
+// weeks compare with the same weeks then. Without a full period of history
+// it falls back to Average.
+type Seasonal struct {
+	Period int
+	Weeks  int
+}
+
+func (m Seasonal) Forecast(history []float64, weeks int) []Band {
+	n := len(history)
+	if n < m.Period+m.Weeks {
+		return Average{Weeks: m.Weeks}.Forecast(history, weeks)
+	}
+
+	recent, _ := meanStd(tail(history, m.Weeks))
+	earlier, _ := meanStd(history[n-m.Period-m.Weeks : n-m.Period])
+	level := 1.0
+	if earlier > 0 {
+		level = recent / earlier
+	}
+
+	// the band is how far the seasonal guess was off over the last weeks
+	var sq float64
+	for i := n - m.Weeks; i < n; i++ {
+		d := history[i] - history[i-m.Period]*level
+		sq += d * d
+	}
+	sd := math.Sqrt(sq / float64(m.Weeks))
+
+	bands := make([]Band, weeks)
+	for i := range bands {
+		// a horizon beyond one period repeats the last period
+		back := n - m.Period + i%m.Period
+		bands[i] = band(history[back]*level, sd)
+	}
+	return bands
+}
+
+func band(expected, sd float64) Band {
+	expected = math.Max(expected, 0)
+	return Band{
+		Expected: expected,
+		Low:      math.Max(expected-z80*sd, 0),
+		High:     expected + z80*sd,
+	}
+}
+
+func tail(history []float64, n int) []float64 {
+	if len(history) > n {
+		return history[len(history)-n:]
+	}
+	return history
+}
+
+func meanStd(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(values)))
+}
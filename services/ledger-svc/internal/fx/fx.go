@@ -0,0 +1,226 @@
+// Package fx converts amounts between currencies at the daily reference
+// rates. The rates of a day are fetched once from the providers, merged and
+// cached with the statements; when no provider answers, the latest rates
+// cached before the day are used, up to FX_MAX_STALE_DAYS old.
+package fx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// ErrNoRate is returned when there is no rate for the currencies of a day,
+// neither fetched nor cached.
+var ErrNoRate = apierror.New(apierror.KindUpstream, "no_exchange_rate", "no exchange rate")
+
+// refreshAfter is how long the rates of a day still going are used before
+// they are fetched again.
+const refreshAfter = time.Hour
+
+// Rate is the rate between two currencies on a day.
+type Rate struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Date is the day asked for, RatesDate the day of the rates used, an
+	// earlier one when they are Stale.
+	Date      string  `json:"date"`
+	RatesDate string  `json:"rates_date"`
+	Value     float64 `json:"value"`
+	Stale     bool    `json:"stale"`
+}
+
+// Converter converts at the cached daily rates, fetching the days missing.
+type Converter struct {
+	// Providers are asked in order, the later ones for the currencies the
+	// earlier ones do not quote.
+	Providers []NamedProvider
+	Store     Store
+	// MaxStale is how many days older than asked the rates used when the
+	// providers fail may be.
+	MaxStale int
+	Now      func() time.Time
+
+	mu sync.Mutex
+	// final holds the days read that will not change anymore.
+	final map[string]*DailyRates
+}
+
+// NewConverterFromEnv uses the providers of FX_PROVIDERS and keeps the rates
+// next to the statements. FX_MAX_STALE_DAYS defaults to 7.
+func NewConverterFromEnv(repo statements.StatementRepository) (*Converter, error) {
+	providers, err := OpenProvidersFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	maxStale := 7
+	if n, err := strconv.Atoi(os.Getenv("FX_MAX_STALE_DAYS")); err == nil && n >= 0 {
+		maxStale = n
+	}
+	return &Converter{Providers: providers, Store: NewStore(repo), MaxStale: maxStale, Now: time.Now}, nil
+}
+
+// Convert converts the amount from one currency to the other at the rate of
+// the date, unrounded.
+func (c *Converter) Convert(ctx context.Context, amount float64, from, to string, date time.Time) (float64, error) {
+	if strings.EqualFold(from, to) {
+		return amount, nil
+	}
+	rate, err := c.Rate(ctx, from, to, date)
+	if err != nil {
+		return 0, err
+	}
+	return amount * rate.Value, nil
+}
+
+// Rate returns how many units of to one unit of from buys on the date. Dates
+// after today are converted at today's rates.
+func (c *Converter) Rate(ctx context.Context, from, to string, date time.Time) (*Rate, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	day := c.day(date)
+	rate := &Rate{From: from, To: to, Date: day, RatesDate: day, Value: 1}
+	if from == to {
+		return rate, nil
+	}
+
+	rates, err := c.rates(ctx, day)
+	if err != nil {
+		return nil, err
+	}
+	fromRate, toRate := rates.Rates[from], rates.Rates[to]
+	if fromRate == 0 || toRate == 0 {
+		return nil, fmt.Errorf("%w from %s to %s on %s", ErrNoRate, from, to, day)
+	}
+	rate.RatesDate, rate.Stale = rates.Date, rates.Date != day
+	rate.Value = toRate / fromRate
+	return rate, nil
+}
+
+func (c *Converter) day(date time.Time) string {
+	today := c.Now().UTC()
+	if date.After(today) {
+		date = today
+	}
+	return date.UTC().Format(dateLayout)
+}
+
+// rates returns the rates of the day, cached or fetched, or the latest cached
+// before it when they cannot be fetched.
+func (c *Converter) rates(ctx context.Context, day string) (*DailyRates, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if rates, ok := c.final[day]; ok {
+		return rates, nil
+	}
+	cached, err := c.Store.Get(ctx, day)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && (cached.final() || c.Now().Sub(cached.FetchedAt) < refreshAfter) {
+		c.keep(cached)
+		return cached, nil
+	}
+
+	fetched, fetchErr := c.refresh(ctx, day)
+	if fetchErr == nil {
+		return fetched, nil
+	}
+	if cached != nil {
+		slog.Warn("Failed to refresh the exchange rates, using the cached ones", "date", day, "error", fetchErr)
+		return cached, nil
+	}
+	latest, err := c.Store.Latest(ctx, day)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil && c.withinStale(latest.Date, day) {
+		slog.Warn("Failed to fetch the exchange rates, using stale ones", "date", day, "rates_date", latest.Date, "error", fetchErr)
+		return latest, nil
+	}
+	return nil, fmt.Errorf("%w on %s: %v", ErrNoRate, day, fetchErr)
+}
+
+func (c *Converter) withinStale(ratesDay, day string) bool {
+	from, errFrom := time.Parse(dateLayout, ratesDay)
+	to, errTo := time.Parse(dateLayout, day)
+	return errFrom == nil && errTo == nil && !from.AddDate(0, 0, c.MaxStale).Before(to)
+}
+
+func (c *Converter) keep(rates *DailyRates) {
+	if !rates.final() {
+		return
+	}
+	if c.final == nil {
+		c.final = map[string]*DailyRates{}
+	}
+	c.final[rates.Date] = rates
+}
+
+// Refresh fetches the rates of the day again and caches them.
+func (c *Converter) Refresh(ctx context.Context, date time.Time) (*DailyRates, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.refresh(ctx, c.day(date))
+}
+
+// refresh asks every provider for the day and merges what they quote into
+// the base of the first that answered.
+func (c *Converter) refresh(ctx context.Context, day string) (*DailyRates, error) {
+	if len(c.Providers) == 0 {
+		return nil, errors.New("no exchange rate provider configured, check FX_PROVIDERS")
+	}
+	date, err := time.Parse(dateLayout, day)
+	if err != nil {
+		return nil, err
+	}
+
+	var merged *DailyRates
+	var errs []error
+	for _, p := range c.Providers {
+		base, rates, err := p.Rates(ctx, date)
+		if err == nil && len(rates) == 0 {
+			err = errors.New("no rates")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+			continue
+		}
+		quoted := maps.Clone(rates)
+		quoted[strings.ToUpper(base)] = 1
+		if merged == nil {
+			merged = &DailyRates{Date: day, Base: strings.ToUpper(base), Rates: quoted}
+		} else if pivot := quoted[merged.Base]; pivot > 0 {
+			for currency, rate := range quoted {
+				if _, ok := merged.Rates[currency]; !ok {
+					merged.Rates[currency] = rate / pivot
+				}
+			}
+		} else {
+			continue
+		}
+		merged.Providers = append(merged.Providers, p.Name)
+	}
+	if merged == nil {
+		return nil, errors.Join(errs...)
+	}
+
+	merged.FetchedAt = c.Now().UTC()
+	if err := c.Store.Save(ctx, merged); err != nil {
+		// the rates are good for this conversion, the next one fetches again
+		slog.Warn("Failed to cache the exchange rates", "date", day, "error", err)
+	}
+	delete(c.final, day)
+	c.keep(merged)
+	return merged, nil
+}
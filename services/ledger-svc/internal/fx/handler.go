@@ -0,0 +1,119 @@
+package fx
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+// Handler serves the cached rates on the admin listener:
+//
+//	GET  /fx/rates?from=&to=           the days cached, the last 30 by default
+//	GET  /fx/rates/{date}              the rates of a day, fetched when missing
+//	POST /fx/rates/{date}/refresh      fetch the rates of a day again
+//	GET  /fx/convert?amount=&from=&to=&date=
+type Handler struct {
+	Converter *Converter
+}
+
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /fx/rates", h.list)
+	mux.HandleFunc("GET /fx/rates/{date}", h.get)
+	mux.HandleFunc("POST /fx/rates/{date}/refresh", h.refresh)
+	mux.HandleFunc("GET /fx/convert", h.convert)
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	to := r.URL.Query().Get("to")
+	if to == "" {
+		to = h.Converter.day(h.Converter.Now())
+	}
+	from := r.URL.Query().Get("from")
+	if from == "" {
+		end, err := time.Parse(dateLayout, to)
+		if err != nil {
+			apierror.Reply(w, "Invalid to parameter, expected 2006-01-02", http.StatusBadRequest)
+			return
+		}
+		from = end.AddDate(0, 0, -30).Format(dateLayout)
+	}
+	list, err := h.Converter.Store.List(r.Context(), from, to)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list the cached exchange rates", "error", err)
+		apierror.Reply(w, "Failed to list the rates", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	date, ok := pathDate(w, r)
+	if !ok {
+		return
+	}
+	rates, err := h.Converter.rates(r.Context(), h.Converter.day(date))
+	if err != nil {
+		accesslog.Logger(r.Context()).Warn("Failed to read the exchange rates", "date", r.PathValue("date"), "error", err)
+		apierror.Reply(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, rates)
+}
+
+func (h *Handler) refresh(w http.ResponseWriter, r *http.Request) {
+	date, ok := pathDate(w, r)
+	if !ok {
+		return
+	}
+	rates, err := h.Converter.Refresh(r.Context(), date)
+	if err != nil {
+		accesslog.Logger(r.Context()).Warn("Failed to refresh the exchange rates", "date", r.PathValue("date"), "error", err)
+		apierror.Reply(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, rates)
+}
+
+func (h *Handler) convert(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	amount, err := strconv.ParseFloat(query.Get("amount"), 64)
+	if err != nil {
+		apierror.Reply(w, "Invalid amount parameter", http.StatusBadRequest)
+		return
+	}
+	date := h.Converter.Now()
+	if raw := query.Get("date"); raw != "" {
+		if date, err = time.Parse(dateLayout, raw); err != nil {
+			apierror.Reply(w, "Invalid date parameter, expected 2006-01-02", http.StatusBadRequest)
+			return
+		}
+	}
+	rate, err := h.Converter.Rate(r.Context(), query.Get("from"), query.Get("to"), date)
+	if err != nil {
+		apierror.Reply(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"amount": amount, "converted": amount * rate.Value, "rate": rate})
+}
+
+func pathDate(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	date, err := time.Parse(dateLayout, r.PathValue("date"))
+	if err != nil {
+		apierror.Reply(w, "Invalid date, expected 2006-01-02", http.StatusBadRequest)
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
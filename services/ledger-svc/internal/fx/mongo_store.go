@@ -0,0 +1,60 @@
+package fx
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps the rates in the <namespace>fx_rates collection, one
+// document per day keyed by the date.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database, namespace string) *MongoStore {
+	return &MongoStore{collection: db.Collection(namespace + "fx_rates")}
+}
+
+func (s *MongoStore) Get(ctx context.Context, date string) (*DailyRates, error) {
+	return s.findOne(ctx, bson.M{"_id": date})
+}
+
+func (s *MongoStore) Latest(ctx context.Context, date string) (*DailyRates, error) {
+	return s.findOne(ctx, bson.M{"_id": bson.M{"$lte": date}}, options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}}))
+}
+
+func (s *MongoStore) findOne(ctx context.Context, filter bson.M, opts ...*options.FindOneOptions) (*DailyRates, error) {
+	var rates DailyRates
+	err := s.collection.FindOne(ctx, filter, opts...).Decode(&rates)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rates, nil
+}
+
+func (s *MongoStore) List(ctx context.Context, from, to string) ([]DailyRates, error) {
+	filter := bson.M{"_id": bson.M{"$gte": from, "$lte": to}}
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	list := []DailyRates{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *MongoStore) Save(ctx context.Context, rates *DailyRates) error {
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": rates.Date}, rates, options.Replace().SetUpsert(true))
+	return err
+}
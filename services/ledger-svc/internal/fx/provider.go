@@ -0,0 +1,177 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnknownProvider = errors.New("unknown exchange rate provider")
+
+// Provider serves the daily reference rates.
+type Provider interface {
+	// Rates returns the rates of the day against the base the provider
+	// quotes in, the units of each currency one unit of base buys. Days
+	// without rates, weekends and holidays, have the rates of the last
+	// business day before.
+	Rates(ctx context.Context, date time.Time) (base string, rates map[string]float64, err error)
+}
+
+// Factory builds a provider from the environment, nil when it is not
+// configured.
+type Factory func() (Provider, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// RegisterProvider makes a provider available by name in FX_PROVIDERS. It
+// panics when called twice for the same name.
+func RegisterProvider(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("fx: RegisterProvider factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("fx: RegisterProvider called twice for provider " + name)
+	}
+	factories[name] = factory
+}
+
+// Providers returns the names of the registered providers.
+func Providers() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NamedProvider is a provider with the name it was registered as.
+type NamedProvider struct {
+	Name string
+	Provider
+}
+
+// OpenProvidersFromEnv builds the providers FX_PROVIDERS names, comma
+// separated and tried in order, "openexchangerates,frankfurter" by default.
+// The ones not configured are left out.
+func OpenProvidersFromEnv() ([]NamedProvider, error) {
+	raw := os.Getenv("FX_PROVIDERS")
+	if raw == "" {
+		raw = "openexchangerates,frankfurter"
+	}
+	var providers []NamedProvider
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		factoriesMu.RLock()
+		factory, ok := factories[name]
+		factoriesMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("%w %q, expected one of %s", ErrUnknownProvider, name, strings.Join(Providers(), ", "))
+		}
+		provider, err := factory()
+		if err != nil {
+			return nil, fmt.Errorf("fx provider %s: %w", name, err)
+		}
+		if provider != nil {
+			providers = append(providers, NamedProvider{Name: name, Provider: provider})
+		}
+	}
+	return providers, nil
+}
+
+func init() {
+	RegisterProvider("frankfurter", func() (Provider, error) {
+		return &Frankfurter{BaseURL: envOr("FX_FRANKFURTER_URL", "https://api.frankfurter.app"), Client: &http.Client{Timeout: 10 * time.Second}}, nil
+	})
+	RegisterProvider("openexchangerates", func() (Provider, error) {
+		appID := os.Getenv("FX_OPENEXCHANGERATES_APP_ID")
+		if appID == "" {
+			return nil, nil
+		}
+		return &OpenExchangeRates{AppID: appID, Client: &http.Client{Timeout: 10 * time.Second}}, nil
+	})
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// Frankfurter serves the European Central Bank reference rates, about 30
+// currencies against EUR, without a key.
+type Frankfurter struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func (f *Frankfurter) Rates(ctx context.Context, date time.Time) (string, map[string]float64, error) {
+	var resp struct {
+		Base  string             `json:"base"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := getJSON(ctx, f.Client, f.BaseURL+"/"+date.Format(dateLayout), &resp); err != nil {
+		return "", nil, err
+	}
+	return resp.Base, resp.Rates, nil
+}
+
+// OpenExchangeRates serves about 170 currencies against USD with an app ID.
+type OpenExchangeRates struct {
+	AppID  string
+	Client *http.Client
+}
+
+func (o *OpenExchangeRates) Rates(ctx context.Context, date time.Time) (string, map[string]float64, error) {
+	var resp struct {
+		Base  string             `json:"base"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	endpoint := "https://openexchangerates.org/api/historical/" + date.Format(dateLayout) + ".json?app_id=" + url.QueryEscape(o.AppID)
+	if err := getJSON(ctx, o.Client, endpoint, &resp); err != nil {
+		return "", nil, err
+	}
+	return resp.Base, resp.Rates, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, endpoint string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// the URL may hold the app ID, keep it out of the logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rates request returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,107 @@
+package fx
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const dateLayout = "2006-01-02"
+
+// DailyRates are the rates of a day, the units of each currency one unit of
+// Base buys, merged from the providers that had them.
+type DailyRates struct {
+	// Date is the day, 2006-01-02.
+	Date      string             `bson:"_id" json:"date"`
+	Base      string             `bson:"base" json:"base"`
+	Rates     map[string]float64 `bson:"rates" json:"rates"`
+	Providers []string           `bson:"providers" json:"providers"`
+	FetchedAt time.Time          `bson:"fetched_at" json:"fetched_at"`
+}
+
+// final reports whether the rates were fetched after the day ended, the
+// rates of a day still going may be published later.
+func (d *DailyRates) final() bool {
+	day, err := time.Parse(dateLayout, d.Date)
+	return err == nil && !d.FetchedAt.Before(day.AddDate(0, 0, 1))
+}
+
+// Store caches the daily rates.
+type Store interface {
+	// Get returns nil when the day is not cached.
+	Get(ctx context.Context, date string) (*DailyRates, error)
+	// Latest returns the rates of the latest day cached on or before date,
+	// nil when there is none.
+	Latest(ctx context.Context, date string) (*DailyRates, error)
+	// List returns the days cached from from to to, both inclusive, latest
+	// first.
+	List(ctx context.Context, from, to string) ([]DailyRates, error)
+	Save(ctx context.Context, rates *DailyRates) error
+}
+
+// NewStore caches the rates next to the statements in MongoDB, or in memory
+// for the memory driver.
+func NewStore(repo statements.StatementRepository) Store {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryStore()
+}
+
+type MemoryStore struct {
+	mu   sync.RWMutex
+	days map[string]DailyRates
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{days: make(map[string]DailyRates)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, date string) (*DailyRates, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rates, ok := s.days[date]
+	if !ok {
+		return nil, nil
+	}
+	return &rates, nil
+}
+
+func (s *MemoryStore) Latest(ctx context.Context, date string) (*DailyRates, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var latest *DailyRates
+	for _, rates := range s.days {
+		if rates.Date <= date && (latest == nil || rates.Date > latest.Date) {
+			latest = &rates
+		}
+	}
+	return latest, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, from, to string) ([]DailyRates, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []DailyRates{}
+	for _, rates := range s.days {
+		if rates.Date >= from && rates.Date <= to {
+			list = append(list, rates)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Date > list[j].Date })
+	return list, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, rates *DailyRates) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.days[rates.Date] = *rates
+	return nil
+}
@@ -0,0 +1,448 @@
+// Package graphql serves the read side of the API as GraphQL, so a view
+// fetches a statement with its transactions and their merchants in one
+// request instead of orchestrating the REST calls.
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDepth bounds the nesting of a query, statement → transactions →
+// statement → … would otherwise fan out without end.
+const maxDepth = 12
+
+// Schema is the object types by name and the root query type.
+type Schema struct {
+	Query string
+	Types map[string]*Object
+}
+
+// Object is a type of the schema. The fields resolved by code are listed, the
+// others are read from the Go value by their JSON names.
+type Object struct {
+	Name   string
+	Fields map[string]*Field
+}
+
+type Field struct {
+	// Type names the object type of the value, empty for a scalar or a value
+	// read by its JSON names alone.
+	Type    string
+	Resolve func(ctx context.Context, p Params) (any, error)
+}
+
+type Params struct {
+	// Source is the value of the object the field is on, nil on the root.
+	Source any
+	Args   Args
+}
+
+type Request struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables"`
+	OperationName string         `json:"operationName"`
+}
+
+// Response has no data when the request failed before execution.
+type Response struct {
+	Data   *object `json:"data,omitempty"`
+	Errors []Error `json:"errors,omitempty"`
+}
+
+type Error struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// Execute runs the query. A field that fails is null in the data, with an
+// error naming its path.
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return &Response{Errors: []Error{{Message: err.Error()}}}
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return &Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	vars := make(map[string]any, len(op.defaults)+len(req.Variables))
+	for name, v := range op.defaults {
+		vars[name], _ = literal(v, nil)
+	}
+	for name, v := range req.Variables {
+		vars[name] = v
+	}
+	e := &executor{schema: s, doc: doc, vars: vars}
+	data := e.object(ctx, s.Types[s.Query], nil, op.selectionSet, nil)
+	return &Response{Data: data, Errors: e.errors}
+}
+
+func (d *document) operation(name string) (*operation, error) {
+	var op *operation
+	switch {
+	case name != "":
+		for _, o := range d.operations {
+			if o.name == name {
+				op = o
+			}
+		}
+		if op == nil {
+			return nil, fmt.Errorf("unknown operation %q", name)
+		}
+	case len(d.operations) > 1:
+		return nil, fmt.Errorf("operationName is required with %d operations", len(d.operations))
+	default:
+		op = d.operations[0]
+	}
+	if op.kind != "query" {
+		return nil, fmt.Errorf("%s operations are not supported, only queries", op.kind)
+	}
+	return op, nil
+}
+
+type executor struct {
+	schema *Schema
+	doc    *document
+	vars   map[string]any
+	errors []Error
+}
+
+func (e *executor) fail(path []any, format string, args ...any) {
+	e.errors = append(e.errors, Error{Message: fmt.Sprintf(format, args...), Path: append([]any(nil), path...)})
+}
+
+// object resolves the selection set on source, of type typ or, when typ is
+// nil, by the JSON names of source.
+func (e *executor) object(ctx context.Context, typ *Object, source any, set []selection, path []any) *object {
+	result := &object{values: make(map[string]any)}
+	for _, group := range e.collect(set, nil) {
+		f := group[0]
+		key := f.key()
+		fieldPath := append(path[:len(path):len(path)], key)
+		result.set(key, e.field(ctx, typ, source, group, fieldPath))
+	}
+	return result
+}
+
+func (e *executor) field(ctx context.Context, typ *Object, source any, group []*selection, path []any) any {
+	f := group[0]
+	if f.name == "__typename" {
+		if typ == nil {
+			return nil
+		}
+		return typ.Name
+	}
+	if len(path) > maxDepth {
+		e.fail(path, "query is nested deeper than %d fields", maxDepth)
+		return nil
+	}
+
+	var subset []selection
+	for _, s := range group {
+		subset = append(subset, s.selectionSet...)
+	}
+
+	var def *Field
+	if typ != nil {
+		def = typ.Fields[f.name]
+	}
+	var v any
+	if def != nil {
+		args, err := e.arguments(f.args)
+		if err != nil {
+			e.fail(path, "%v", err)
+			return nil
+		}
+		if v, err = def.Resolve(ctx, Params{Source: source, Args: args}); err != nil {
+			e.fail(path, "%v", err)
+			return nil
+		}
+	} else {
+		var ok bool
+		if v, ok = jsonField(source, f.name); !ok {
+			typeName := "the value"
+			if typ != nil {
+				typeName = typ.Name
+			}
+			e.fail(path, "cannot query field %q on %s", f.name, typeName)
+			return nil
+		}
+	}
+
+	var fieldType *Object
+	if def != nil && def.Type != "" {
+		fieldType = e.schema.Types[def.Type]
+		if len(subset) == 0 {
+			e.fail(path, "field %q of type %s needs a selection of subfields", f.name, fieldType.Name)
+			return nil
+		}
+	}
+	return e.complete(ctx, fieldType, f.name, v, subset, path)
+}
+
+func (e *executor) complete(ctx context.Context, typ *Object, name string, v any, set []selection, path []any) any {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+
+	switch {
+	case (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && rv.Type().Elem().Kind() != reflect.Uint8:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+		list := make([]any, rv.Len())
+		for i := range list {
+			list[i] = e.complete(ctx, typ, name, rv.Index(i).Interface(), set, append(path[:len(path):len(path)], i))
+		}
+		return list
+	case len(set) == 0:
+		return rv.Interface()
+	case rv.Kind() != reflect.Struct && rv.Kind() != reflect.Map || rv.Type() == reflect.TypeOf(time.Time{}):
+		e.fail(path, "field %q is a scalar and has no subfields", name)
+		return nil
+	}
+	return e.object(ctx, typ, rv.Interface(), set, path)
+}
+
+// collect flattens the fragments of a selection set and groups the fields by
+// response key, in order of appearance.
+func (e *executor) collect(set []selection, visited map[string]bool) [][]*selection {
+	var groups [][]*selection
+	index := make(map[string]int)
+	var walk func(set []selection)
+	walk = func(set []selection) {
+		for i := range set {
+			s := &set[i]
+			if !e.included(s.directives) {
+				continue
+			}
+			switch {
+			case s.spread != "":
+				f, ok := e.doc.fragments[s.spread]
+				if !ok || visited[s.spread] {
+					continue
+				}
+				if visited == nil {
+					visited = make(map[string]bool)
+				}
+				visited[s.spread] = true
+				walk(f.selectionSet)
+				delete(visited, s.spread)
+			case s.inline:
+				walk(s.fragment)
+			default:
+				if n, ok := index[s.key()]; ok {
+					groups[n] = append(groups[n], s)
+					continue
+				}
+				index[s.key()] = len(groups)
+				groups = append(groups, []*selection{s})
+			}
+		}
+	}
+	walk(set)
+	return groups
+}
+
+// included applies @skip(if:) and @include(if:).
+func (e *executor) included(directives []directive) bool {
+	for _, d := range directives {
+		cond, _ := literal(d.args["if"], e.vars)
+		if b, ok := cond.(bool); ok && (d.name == "skip" && b || d.name == "include" && !b) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *executor) arguments(args map[string]value) (Args, error) {
+	result := make(Args, len(args))
+	for name, v := range args {
+		var err error
+		if result[name], err = literal(v, e.vars); err != nil {
+			return nil, fmt.Errorf("argument %q: %w", name, err)
+		}
+	}
+	return result, nil
+}
+
+// literal converts an argument value to the Go value JSON variables decode to.
+func literal(v value, vars map[string]any) (any, error) {
+	switch v.kind {
+	case valueInt, valueFloat:
+		return strconv.ParseFloat(v.raw, 64)
+	case valueString, valueEnum:
+		return v.raw, nil
+	case valueBool:
+		return v.raw == "true", nil
+	case valueVariable:
+		return vars[v.variable], nil
+	case valueList:
+		list := make([]any, len(v.list))
+		for i := range v.list {
+			var err error
+			if list[i], err = literal(v.list[i], vars); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case valueObject:
+		obj := make(map[string]any, len(v.object))
+		for name := range v.object {
+			var err error
+			if obj[name], err = literal(v.object[name], vars); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+	}
+	return nil, nil
+}
+
+// jsonField reads the field of a struct, or the key of a map, by its JSON name.
+func jsonField(source any, name string) (any, bool) {
+	rv := reflect.ValueOf(source)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		v := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+		if !v.IsValid() {
+			return nil, true
+		}
+		return v.Interface(), true
+	case reflect.Struct:
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			tag, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+			if sf.Anonymous && tag == "" {
+				if v, ok := jsonField(rv.Field(i).Interface(), name); ok {
+					return v, true
+				}
+				continue
+			}
+			if tag == "-" {
+				continue
+			}
+			if tag == "" {
+				tag = sf.Name
+			}
+			if tag == name {
+				return rv.Field(i).Interface(), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Args are the arguments of a field, as JSON variables decode.
+type Args map[string]any
+
+// String returns "" for a missing argument.
+func (a Args) String(name string) (string, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("argument %q must be a string", name)
+	}
+}
+
+// Int returns fallback for a missing argument.
+func (a Args) Int(name string, fallback int) (int, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return fallback, nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) <= math.MaxInt32 {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("argument %q must be an integer", name)
+}
+
+// Bool returns nil for a missing argument.
+func (a Args) Bool(name string) (*bool, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return &v, nil
+	default:
+		return nil, fmt.Errorf("argument %q must be a boolean", name)
+	}
+}
+
+// Date parses the argument with layout, the zero time when it is missing.
+func (a Args) Date(name, layout string) (time.Time, error) {
+	s, err := a.String(name)
+	if err != nil || s == "" {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("argument %q must be formatted %s", name, layout)
+	}
+	return t, nil
+}
+
+// object keeps the fields of a response object in the order they were
+// selected.
+type object struct {
+	keys   []string
+	values map[string]any
+}
+
+func (o *object) set(key string, v any) {
+	o.keys = append(o.keys, key)
+	o.values[key] = v
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,58 @@
+package graphql
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+// maxQueryBytes bounds the body of a query request.
+const maxQueryBytes = 1 << 20
+
+type Handler struct {
+	Schema *Schema
+}
+
+// ServeHTTP serves /graphql: POST with {"query": ..., "variables": ...,
+// "operationName": ...}, or GET with the same as query parameters, the
+// variables as JSON. A request that does not run is answered 400, field
+// errors come with the data.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Query, req.OperationName = query.Get("query"), query.Get("operationName")
+		if v := query.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				apierror.Reply(w, "Invalid variables parameter, expected a JSON object", http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxQueryBytes)).Decode(&req); err != nil {
+			apierror.Reply(w, "Invalid GraphQL request payload", http.StatusBadRequest)
+			return
+		}
+	default:
+		apierror.Reply(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Query == "" {
+		apierror.Reply(w, "Missing query", http.StatusBadRequest)
+		return
+	}
+
+	resp := h.Schema.Execute(withCache(r.Context()), req)
+	status := http.StatusOK
+	if resp.Data == nil {
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to encode JSON response", "error", err)
+	}
+}
@@ -0,0 +1,422 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The parser covers the query language a read-only API needs: query
+// operations with variables, aliases, arguments, fragments and the skip and
+// include directives. Mutations, subscriptions and type checking of the
+// variables are left out.
+
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind         string
+	name         string
+	defaults     map[string]value
+	selectionSet []selection
+}
+
+type fragment struct {
+	name         string
+	selectionSet []selection
+}
+
+// selection is a field, a fragment spread (spread set) or an inline fragment
+// (fragment set).
+type selection struct {
+	alias        string
+	name         string
+	args         map[string]value
+	directives   []directive
+	selectionSet []selection
+	spread       string
+	fragment     []selection
+	inline       bool
+}
+
+type directive struct {
+	name string
+	args map[string]value
+}
+
+func (s *selection) key() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+// value is an argument literal; variable values name the variable.
+type value struct {
+	kind     valueKind
+	raw      string
+	list     []value
+	object   map[string]value
+	variable string
+}
+
+type valueKind int
+
+const (
+	valueNull valueKind = iota
+	valueInt
+	valueFloat
+	valueString
+	valueBool
+	valueEnum
+	valueList
+	valueObject
+	valueVariable
+)
+
+// SyntaxError is a query that does not parse, at a byte offset.
+type SyntaxError struct {
+	Offset  int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at offset %d: %s", e.Offset, e.Message)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	offset int
+}
+
+type parser struct {
+	src string
+	pos int
+	tok token
+}
+
+func parse(src string) (doc *document, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			syntaxErr, ok := r.(*SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, syntaxErr
+		}
+	}()
+
+	p := &parser{src: src}
+	p.next()
+	doc = &document{fragments: make(map[string]*fragment)}
+	for p.tok.kind != tokenEOF {
+		switch {
+		case p.peek(tokenPunct, "{"):
+			doc.operations = append(doc.operations, &operation{kind: "query", selectionSet: p.selectionSet()})
+		case p.peek(tokenName, "fragment"):
+			p.next()
+			f := &fragment{name: p.name()}
+			p.keyword("on")
+			p.name()
+			p.directives()
+			f.selectionSet = p.selectionSet()
+			doc.fragments[f.name] = f
+		case p.tok.kind == tokenName:
+			doc.operations = append(doc.operations, p.operation())
+		default:
+			p.fail("expected an operation or a fragment")
+		}
+	}
+	if len(doc.operations) == 0 {
+		p.fail("no operation")
+	}
+	return doc, nil
+}
+
+func (p *parser) operation() *operation {
+	op := &operation{kind: p.name(), defaults: make(map[string]value)}
+	if p.tok.kind == tokenName {
+		op.name = p.name()
+	}
+	if p.skip("(") {
+		for !p.skip(")") {
+			p.expect("$")
+			name := p.name()
+			p.expect(":")
+			p.typeRef()
+			if p.skip("=") {
+				op.defaults[name] = p.value()
+			}
+			p.directives()
+		}
+	}
+	p.directives()
+	op.selectionSet = p.selectionSet()
+	return op
+}
+
+func (p *parser) typeRef() {
+	if p.skip("[") {
+		p.typeRef()
+		p.expect("]")
+	} else {
+		p.name()
+	}
+	p.skip("!")
+}
+
+func (p *parser) selectionSet() []selection {
+	p.expect("{")
+	var set []selection
+	for !p.skip("}") {
+		set = append(set, p.selection())
+	}
+	if len(set) == 0 {
+		p.fail("empty selection set")
+	}
+	return set
+}
+
+func (p *parser) selection() selection {
+	if p.skip("...") {
+		if p.tok.kind == tokenName && p.tok.text != "on" {
+			return selection{spread: p.name(), directives: p.directives()}
+		}
+		if p.peek(tokenName, "on") {
+			p.next()
+			p.name()
+		}
+		return selection{inline: true, directives: p.directives(), fragment: p.selectionSet()}
+	}
+
+	s := selection{name: p.name()}
+	if p.skip(":") {
+		s.alias, s.name = s.name, p.name()
+	}
+	s.args = p.arguments()
+	s.directives = p.directives()
+	if p.peek(tokenPunct, "{") {
+		s.selectionSet = p.selectionSet()
+	}
+	return s
+}
+
+func (p *parser) arguments() map[string]value {
+	if !p.skip("(") {
+		return nil
+	}
+	args := make(map[string]value)
+	for !p.skip(")") {
+		name := p.name()
+		p.expect(":")
+		args[name] = p.value()
+	}
+	return args
+}
+
+func (p *parser) directives() []directive {
+	var list []directive
+	for p.skip("@") {
+		list = append(list, directive{name: p.name(), args: p.arguments()})
+	}
+	return list
+}
+
+func (p *parser) value() value {
+	tok := p.tok
+	switch {
+	case p.skip("$"):
+		return value{kind: valueVariable, variable: p.name()}
+	case p.skip("["):
+		v := value{kind: valueList}
+		for !p.skip("]") {
+			v.list = append(v.list, p.value())
+		}
+		return v
+	case p.skip("{"):
+		v := value{kind: valueObject, object: make(map[string]value)}
+		for !p.skip("}") {
+			name := p.name()
+			p.expect(":")
+			v.object[name] = p.value()
+		}
+		return v
+	}
+	p.next()
+	switch tok.kind {
+	case tokenInt:
+		return value{kind: valueInt, raw: tok.text}
+	case tokenFloat:
+		return value{kind: valueFloat, raw: tok.text}
+	case tokenString:
+		return value{kind: valueString, raw: tok.text}
+	case tokenName:
+		switch tok.text {
+		case "true", "false":
+			return value{kind: valueBool, raw: tok.text}
+		case "null":
+			return value{kind: valueNull}
+		}
+		return value{kind: valueEnum, raw: tok.text}
+	}
+	p.tok = tok
+	p.fail("expected a value")
+	return value{}
+}
+
+func (p *parser) peek(kind tokenKind, text string) bool {
+	return p.tok.kind == kind && p.tok.text == text
+}
+
+func (p *parser) skip(punct string) bool {
+	if p.peek(tokenPunct, punct) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(punct string) {
+	if !p.skip(punct) {
+		p.fail(fmt.Sprintf("expected %q", punct))
+	}
+}
+
+func (p *parser) keyword(name string) {
+	if !p.peek(tokenName, name) {
+		p.fail(fmt.Sprintf("expected %q", name))
+	}
+	p.next()
+}
+
+func (p *parser) name() string {
+	if p.tok.kind != tokenName {
+		p.fail("expected a name")
+	}
+	name := p.tok.text
+	p.next()
+	return name
+}
+
+func (p *parser) fail(message string) {
+	found := "end of query"
+	if p.tok.kind != tokenEOF {
+		found = strconv.Quote(p.tok.text)
+	}
+	panic(&SyntaxError{Offset: p.tok.offset, Message: message + ", found " + found})
+}
+
+// next reads the next token, skipping whitespace, commas and comments.
+func (p *parser) next() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != ',' {
+			break
+		}
+		p.pos++
+	}
+	start := p.pos
+	if start >= len(p.src) {
+		p.tok = token{kind: tokenEOF, offset: start}
+		return
+	}
+
+	c := p.src[start]
+	switch {
+	case strings.HasPrefix(p.src[start:], "..."):
+		p.pos += 3
+		p.tok = token{kind: tokenPunct, text: "...", offset: start}
+	case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+		p.pos++
+		p.tok = token{kind: tokenPunct, text: string(c), offset: start}
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = token{kind: tokenName, text: p.src[start:p.pos], offset: start}
+	case c == '-' || isDigit(c):
+		p.number(start)
+	case c == '"':
+		p.string(start)
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[start:])
+		panic(&SyntaxError{Offset: start, Message: fmt.Sprintf("unexpected character %q", r)})
+	}
+}
+
+func (p *parser) number(start int) {
+	kind := tokenInt
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	digits := func() {
+		from := p.pos
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+		}
+		if p.pos == from {
+			panic(&SyntaxError{Offset: start, Message: "invalid number"})
+		}
+	}
+	digits()
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		kind = tokenFloat
+		p.pos++
+		digits()
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		kind = tokenFloat
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		digits()
+	}
+	p.tok = token{kind: kind, text: p.src[start:p.pos], offset: start}
+}
+
+func (p *parser) string(start int) {
+	end := start + 1
+	for end < len(p.src) && p.src[end] != '"' && p.src[end] != '\n' {
+		if p.src[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end >= len(p.src) || p.src[end] != '"' {
+		panic(&SyntaxError{Offset: start, Message: "unterminated string"})
+	}
+	// the escapes of GraphQL strings are those of JSON
+	var text string
+	if err := json.Unmarshal([]byte(p.src[start:end+1]), &text); err != nil {
+		panic(&SyntaxError{Offset: start, Message: "invalid string escape"})
+	}
+	p.pos = end + 1
+	p.tok = token{kind: tokenString, text: text, offset: start}
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
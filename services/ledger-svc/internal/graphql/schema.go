@@ -0,0 +1,346 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accounts"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/analytics"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/merchants"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const monthLayout = "2006-01"
+
+// Resolver reads what the schema exposes. The nested fields are resolved
+// only when selected, so a view pays for what it asks for.
+type Resolver struct {
+	Repo      statements.StatementRepository
+	Service   *statements.StatementService
+	Accounts  accounts.Store
+	Merchants merchants.Store
+}
+
+// Merchant is the merchant of a transaction, keyed like the merchant rollup.
+type Merchant struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+// NewSchema builds the schema:
+//
+//	Query {
+//	  statement(id): Statement
+//	  statements(source_name): [Statement]
+//	  transactions(statement_id, from, to, merchant_country, is_foreign,
+//	    is_transfer, spend_type, first, after): TransactionPage
+//	  accounts: [Account]
+//	  account(id): Account
+//	  spend(group_by, from, to, spend_type): the analytics spend
+//	  merchants(from, to, spend_type): the merchant breakdown
+//	}
+//	Statement { id, transactions: [Transaction], account: Account, ... }
+//	TransactionPage { items: [Transaction], next }
+//	Transaction { statement_id, statement: Statement, merchant: Merchant, ... }
+//	Merchant { key, name, spend(from, to) }
+//	Account { statements: [Statement], utilization(over): cycles, ... }
+//
+// The other fields are those of the REST payloads, by their JSON names.
+func NewSchema(r *Resolver) *Schema {
+	return &Schema{Query: "Query", Types: map[string]*Object{
+		"Query": {Name: "Query", Fields: map[string]*Field{
+			"statement":    {Type: "Statement", Resolve: r.statement},
+			"statements":   {Type: "Statement", Resolve: r.statements},
+			"transactions": {Type: "TransactionPage", Resolve: r.transactions},
+			"accounts":     {Type: "Account", Resolve: r.accounts},
+			"account":      {Type: "Account", Resolve: r.account},
+			"spend":        {Resolve: r.spend},
+			"merchants":    {Resolve: r.merchants},
+		}},
+		"Statement": {Name: "Statement", Fields: map[string]*Field{
+			"id": {Resolve: func(_ context.Context, p Params) (any, error) {
+				return p.Source.(statements.Statement).ID, nil
+			}},
+			"transactions": {Type: "Transaction", Resolve: r.statementTransactions},
+			"account":      {Type: "Account", Resolve: r.statementAccount},
+		}},
+		"TransactionPage": {Name: "TransactionPage", Fields: map[string]*Field{
+			"items": {Type: "Transaction", Resolve: func(_ context.Context, p Params) (any, error) {
+				return p.Source.(statements.TransactionPage).Items, nil
+			}},
+		}},
+		"Transaction": {Name: "Transaction", Fields: map[string]*Field{
+			"statement_id": {Resolve: func(_ context.Context, p Params) (any, error) {
+				return p.Source.(statements.Transaction).StatementID, nil
+			}},
+			"statement": {Type: "Statement", Resolve: r.transactionStatement},
+			"merchant":  {Type: "Merchant", Resolve: r.transactionMerchant},
+		}},
+		"Merchant": {Name: "Merchant", Fields: map[string]*Field{
+			"spend": {Resolve: r.merchantSpend},
+		}},
+		"Account": {Name: "Account", Fields: map[string]*Field{
+			"statements":  {Type: "Statement", Resolve: r.accountStatements},
+			"utilization": {Resolve: r.accountUtilization},
+		}},
+	}}
+}
+
+// cache keeps the statements read by one request, the transactions of a
+// page mostly sharing a few.
+type cache struct {
+	mu         sync.Mutex
+	statements map[string]*statements.Statement
+}
+
+type cacheKey struct{}
+
+func withCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheKey{}, &cache{statements: make(map[string]*statements.Statement)})
+}
+
+func (r *Resolver) getStatement(ctx context.Context, id string) (*statements.Statement, error) {
+	c, _ := ctx.Value(cacheKey{}).(*cache)
+	if c != nil {
+		c.mu.Lock()
+		stmt, ok := c.statements[id]
+		c.mu.Unlock()
+		if ok {
+			return stmt, nil
+		}
+	}
+	stmt, err := r.Repo.GetStatement(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		c.mu.Lock()
+		c.statements[id] = stmt
+		c.mu.Unlock()
+	}
+	return stmt, nil
+}
+
+func (r *Resolver) statement(ctx context.Context, p Params) (any, error) {
+	id, err := p.Args.String("id")
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, errors.New(`argument "id" is required`)
+	}
+	stmt, err := r.getStatement(ctx, id)
+	if err != nil || stmt == nil {
+		return nil, err
+	}
+	return *stmt, nil
+}
+
+func (r *Resolver) statements(ctx context.Context, p Params) (any, error) {
+	sourceName, err := p.Args.String("source_name")
+	if err != nil {
+		return nil, err
+	}
+	return r.Repo.ListStatements(ctx, statements.StatementFilter{SourceName: sourceName})
+}
+
+func (r *Resolver) transactions(ctx context.Context, p Params) (any, error) {
+	var filter statements.TransactionFilter
+	var err error
+	for name, target := range map[string]*string{
+		"statement_id":     &filter.StatementID,
+		"merchant_country": &filter.MerchantCountry,
+	} {
+		if *target, err = p.Args.String(name); err != nil {
+			return nil, err
+		}
+	}
+	if filter.From, err = p.Args.Date("from", time.DateOnly); err != nil {
+		return nil, err
+	}
+	if filter.To, err = p.Args.Date("to", time.DateOnly); err != nil {
+		return nil, err
+	}
+	if filter.IsForeign, err = p.Args.Bool("is_foreign"); err != nil {
+		return nil, err
+	}
+	if filter.IsTransfer, err = p.Args.Bool("is_transfer"); err != nil {
+		return nil, err
+	}
+	if filter.SpendType, err = spendType(p.Args); err != nil {
+		return nil, err
+	}
+
+	var page statements.Page
+	if page.Limit, err = p.Args.Int("first", statements.DefaultPageSize); err != nil {
+		return nil, err
+	}
+	if page.After, err = p.Args.String("after"); err != nil {
+		return nil, err
+	}
+	result, err := r.Service.ListTransactions(ctx, filter, page)
+	if err != nil {
+		return nil, err
+	}
+	return *result, nil
+}
+
+func spendType(args Args) (statements.SpendType, error) {
+	s, err := args.String("spend_type")
+	if err != nil {
+		return "", err
+	}
+	t, err := statements.ParseSpendType(s)
+	if err != nil {
+		return "", fmt.Errorf(`argument "spend_type": %w`, err)
+	}
+	return t, nil
+}
+
+// months reads the from and to months, both inclusive, as [from, to).
+func months(args Args) (time.Time, time.Time, error) {
+	from, err := args.Date("from", monthLayout)
+	if err != nil {
+		return from, from, err
+	}
+	to, err := args.Date("to", monthLayout)
+	if err != nil {
+		return from, to, err
+	}
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return from, to, fmt.Errorf(`arguments "from" and "to" are required, %s, to not before from`, monthLayout)
+	}
+	return from, to.AddDate(0, 1, 0), nil
+}
+
+func (r *Resolver) accounts(ctx context.Context, _ Params) (any, error) {
+	return r.Accounts.List(ctx)
+}
+
+func (r *Resolver) account(ctx context.Context, p Params) (any, error) {
+	id, err := p.Args.String("id")
+	if err != nil {
+		return nil, err
+	}
+	account, err := r.Accounts.Get(ctx, id)
+	if err != nil || account == nil {
+		return nil, err
+	}
+	return *account, nil
+}
+
+func (r *Resolver) spend(ctx context.Context, p Params) (any, error) {
+	groupBy, err := p.Args.String("group_by")
+	if err != nil {
+		return nil, err
+	}
+	if groupBy == "" {
+		groupBy = string(analytics.ByCategory)
+	}
+	if !analytics.GroupBy(groupBy).Valid() {
+		return nil, errors.New(`argument "group_by" must be category, merchant, month or spend_type`)
+	}
+	t, err := spendType(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := months(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	return analytics.SpendBy(ctx, r.Repo, analytics.GroupBy(groupBy), t, from, to)
+}
+
+func (r *Resolver) merchants(ctx context.Context, p Params) (any, error) {
+	t, err := spendType(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := months(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	spend, err := r.Merchants.Spend(ctx, merchants.Query{From: from, To: to, SpendType: t})
+	if err != nil {
+		return nil, err
+	}
+	return merchants.Breakdown(spend), nil
+}
+
+func (r *Resolver) statementTransactions(ctx context.Context, p Params) (any, error) {
+	stmt := p.Source.(statements.Statement)
+	if stmt.Transactions != nil {
+		return *stmt.Transactions, nil
+	}
+	txs, err := r.Repo.GetTransactions(ctx, stmt.ID)
+	if err != nil {
+		return nil, err
+	}
+	if txs == nil {
+		txs = []statements.Transaction{}
+	}
+	return txs, nil
+}
+
+func (r *Resolver) statementAccount(ctx context.Context, p Params) (any, error) {
+	account, err := r.Accounts.Get(ctx, p.Source.(statements.Statement).SourceName)
+	if err != nil || account == nil {
+		return nil, err
+	}
+	return *account, nil
+}
+
+func (r *Resolver) transactionStatement(ctx context.Context, p Params) (any, error) {
+	stmt, err := r.getStatement(ctx, p.Source.(statements.Transaction).StatementID)
+	if err != nil || stmt == nil {
+		return nil, err
+	}
+	return *stmt, nil
+}
+
+// transactionMerchant is null for an encrypted description, the server
+// cannot read the merchant.
+func (r *Resolver) transactionMerchant(_ context.Context, p Params) (any, error) {
+	tx := p.Source.(statements.Transaction)
+	if statements.IsClientEncrypted(tx.Description) {
+		return nil, nil
+	}
+	key := merchants.Key(tx.Description)
+	if key == "" {
+		return nil, nil
+	}
+	return Merchant{Key: key, Name: tx.Description}, nil
+}
+
+func (r *Resolver) merchantSpend(ctx context.Context, p Params) (any, error) {
+	from, to, err := months(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	return r.Merchants.Spend(ctx, merchants.Query{From: from, To: to, Merchant: p.Source.(Merchant).Key})
+}
+
+func (r *Resolver) accountStatements(ctx context.Context, p Params) (any, error) {
+	return r.Repo.ListStatements(ctx, statements.StatementFilter{SourceName: p.Source.(accounts.Account).ID})
+}
+
+func (r *Resolver) accountUtilization(ctx context.Context, p Params) (any, error) {
+	over, err := p.Args.Bool("over")
+	if err != nil {
+		return nil, err
+	}
+	cycles, err := r.Accounts.Cycles(ctx, p.Source.(accounts.Account).ID)
+	if err != nil || over == nil {
+		return cycles, err
+	}
+	kept := cycles[:0]
+	for _, c := range cycles {
+		if c.Over == *over {
+			kept = append(kept, c)
+		}
+	}
+	return kept, nil
+}
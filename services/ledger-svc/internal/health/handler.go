@@ -0,0 +1,70 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+// Checker reports the live status of a component along with details.
+type Checker interface {
+	Check() (status string, details map[string]string)
+}
+
+// Handler reports liveness together with static details about the running
+// instance, such as the storage backend and its namespace, and the status of
+// registered checkers. The overall status is the worst component status.
+type Handler struct {
+	Details  map[string]map[string]string
+	Checkers map[string]Checker
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.Reply(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := StatusOK
+	body := map[string]any{}
+	for name, details := range h.Details {
+		body[name] = details
+	}
+	checks := map[string]any{}
+	for name, checker := range h.Checkers {
+		s, details := checker.Check()
+		checks[name] = map[string]any{"status": s, "details": details}
+		status = worst(status, s)
+	}
+	if len(checks) > 0 {
+		body["checks"] = checks
+	}
+	body["status"] = status
+
+	code := http.StatusOK
+	if status == StatusDown {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to encode JSON response", "error", err)
+	}
+}
+
+func worst(a, b string) string {
+	rank := map[string]int{StatusOK: 0, StatusDegraded: 1, StatusDown: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
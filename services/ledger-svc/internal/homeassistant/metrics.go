@@ -0,0 +1,59 @@
+package homeassistant
+
+import (
+	"context"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+type Metrics struct {
+	TotalDueThisMonth float64
+	DaysToNextDue     *int
+	MonthToDateSpend  float64
+}
+
+func ComputeMetrics(ctx context.Context, repo statements.StatementRepository, now time.Time) (*Metrics, error) {
+	stmts, err := repo.ListStatements(ctx, statements.StatementFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	nextMonthStart := monthStart.AddDate(0, 1, 0)
+
+	metrics := &Metrics{}
+	for _, stmt := range stmts {
+		if stmt.PaymentDueDate == nil {
+			continue
+		}
+		due := stmt.PaymentDueDate.UTC()
+
+		if !due.Before(monthStart) && due.Before(nextMonthStart) {
+			metrics.TotalDueThisMonth += stmt.AmountToPay()
+		}
+
+		if !due.Before(today) && stmt.NeedsManualPayment() {
+			days := int(due.Sub(today).Hours() / 24)
+			if metrics.DaysToNextDue == nil || days < *metrics.DaysToNextDue {
+				metrics.DaysToNextDue = &days
+			}
+		}
+
+		// spending of this month can only show up on statements due this month or later
+		if due.Before(monthStart) {
+			continue
+		}
+		txs, err := repo.GetTransactions(ctx, stmt.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range txs {
+			if !tx.Date.Before(monthStart) && tx.Date.Before(nextMonthStart) {
+				metrics.MonthToDateSpend += tx.Amount
+			}
+		}
+	}
+	return metrics, nil
+}
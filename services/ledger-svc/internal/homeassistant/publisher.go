@@ -0,0 +1,188 @@
+package homeassistant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+type Config struct {
+	Broker          string
+	ClientID        string
+	Username        string
+	Password        string
+	DiscoveryPrefix string
+	StateTopic      string
+	Currency        string
+	Interval        time.Duration
+}
+
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Broker:          os.Getenv("HASS_MQTT_BROKER"),
+		ClientID:        envOr("HASS_MQTT_CLIENT_ID", "finchie-ledger"),
+		Username:        os.Getenv("HASS_MQTT_USERNAME"),
+		Password:        os.Getenv("HASS_MQTT_PASSWORD"),
+		DiscoveryPrefix: envOr("HASS_MQTT_DISCOVERY_PREFIX", "homeassistant"),
+		StateTopic:      envOr("HASS_MQTT_STATE_TOPIC", "finchie"),
+		Currency:        envOr("HASS_CURRENCY", "TWD"),
+		Interval:        5 * time.Minute,
+	}
+	if v, err := strconv.Atoi(os.Getenv("HASS_MQTT_INTERVAL_SECONDS")); err == nil && v > 0 {
+		cfg.Interval = time.Duration(v) * time.Second
+	}
+	return cfg
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+type Publisher struct {
+	cfg    Config
+	repo   statements.StatementRepository
+	client mqtt.Client
+}
+
+// NewPublisherFromEnv returns nil when no broker is configured.
+func NewPublisherFromEnv(repo statements.StatementRepository) *Publisher {
+	cfg := ConfigFromEnv()
+	if cfg.Broker == "" {
+		return nil
+	}
+	return NewPublisher(cfg, repo)
+}
+
+func NewPublisher(cfg Config, repo statements.StatementRepository) *Publisher {
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true)
+
+	return &Publisher{
+		cfg:    cfg,
+		repo:   repo,
+		client: mqtt.NewClient(opts),
+	}
+}
+
+func (p *Publisher) Run(ctx context.Context) {
+	token := p.client.Connect()
+	if !token.WaitTimeout(10*time.Second) || token.Error() != nil {
+		slog.Warn("MQTT connection not established yet, retrying in background", "broker", p.cfg.Broker, "error", token.Error())
+	}
+	defer p.client.Disconnect(250)
+
+	if err := p.publishDiscovery(); err != nil {
+		slog.Error("Failed to publish Home Assistant discovery", "error", err)
+	}
+
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := p.publishState(ctx, time.Now()); err != nil {
+			slog.Error("Failed to publish Home Assistant sensors", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type sensor struct {
+	ObjectID    string
+	Name        string
+	Unit        string
+	DeviceClass string
+	Icon        string
+}
+
+func (p *Publisher) sensors() []sensor {
+	return []sensor{
+		{ObjectID: "total_due_this_month", Name: "Total due this month", Unit: p.cfg.Currency, DeviceClass: "monetary", Icon: "mdi:credit-card-clock"},
+		{ObjectID: "days_to_next_due", Name: "Days to next due date", Unit: "d", DeviceClass: "duration", Icon: "mdi:calendar-alert"},
+		{ObjectID: "month_to_date_spend", Name: "Month-to-date spend", Unit: p.cfg.Currency, DeviceClass: "monetary", Icon: "mdi:cash-minus"},
+	}
+}
+
+func (p *Publisher) stateTopic(objectID string) string {
+	return fmt.Sprintf("%s/%s/state", p.cfg.StateTopic, objectID)
+}
+
+func (p *Publisher) publishDiscovery() error {
+	device := map[string]any{
+		"identifiers":  []string{p.cfg.ClientID},
+		"name":         "Finchie",
+		"manufacturer": "Finchie",
+	}
+
+	for _, s := range p.sensors() {
+		payload, err := json.Marshal(map[string]any{
+			"name":                s.Name,
+			"unique_id":           p.cfg.ClientID + "_" + s.ObjectID,
+			"state_topic":         p.stateTopic(s.ObjectID),
+			"unit_of_measurement": s.Unit,
+			"device_class":        s.DeviceClass,
+			"icon":                s.Icon,
+			"device":              device,
+		})
+		if err != nil {
+			return err
+		}
+
+		topic := fmt.Sprintf("%s/sensor/%s/%s/config", p.cfg.DiscoveryPrefix, p.cfg.ClientID, s.ObjectID)
+		if err := p.publish(topic, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Publisher) publishState(ctx context.Context, now time.Time) error {
+	metrics, err := ComputeMetrics(ctx, p.repo, now)
+	if err != nil {
+		return err
+	}
+
+	states := map[string]string{
+		"total_due_this_month": money.FormatPlain(metrics.TotalDueThisMonth),
+		"month_to_date_spend":  money.FormatPlain(metrics.MonthToDateSpend),
+		"days_to_next_due":     "unknown",
+	}
+	if metrics.DaysToNextDue != nil {
+		states["days_to_next_due"] = strconv.Itoa(*metrics.DaysToNextDue)
+	}
+
+	for objectID, state := range states {
+		if err := p.publish(p.stateTopic(objectID), []byte(state)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Publisher) publish(topic string, payload []byte) error {
+	token := p.client.Publish(topic, 1, true, payload)
+	if !token.WaitTimeout(10 * time.Second) {
+		return fmt.Errorf("publish to %s timed out", topic)
+	}
+	return token.Error()
+}
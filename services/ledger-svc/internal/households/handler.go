@@ -0,0 +1,183 @@
+package households
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/categories"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/jsonbody"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const monthLayout = "2006-01"
+
+type Handler struct {
+	Store      Store
+	Repo       statements.StatementRepository
+	Categories categories.Store
+}
+
+// ListHandler serves GET /api/households.
+func (h *Handler) ListHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Store.List(r.Context())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list households", "error", err)
+		apierror.Reply(w, "Failed to list households", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// CreateHandler serves POST /api/households with {"name": ..., "members":
+// [{"user": ..., "weight": ...}], "rules": [{"category": ..., "weights":
+// {...}}]}.
+func (h *Handler) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	var household Household
+	if err := jsonbody.Decode(w, r, &household); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	household.ID = uuid.NewString()
+	h.save(w, r, &household, http.StatusCreated)
+}
+
+// GetHandler serves GET /api/households/{id}.
+func (h *Handler) GetHandler(w http.ResponseWriter, r *http.Request) {
+	household, ok := h.get(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, household)
+}
+
+// UpdateHandler serves PUT /api/households/{id}, replacing the definition.
+func (h *Handler) UpdateHandler(w http.ResponseWriter, r *http.Request) {
+	existing, ok := h.get(w, r)
+	if !ok {
+		return
+	}
+	var household Household
+	if err := jsonbody.Decode(w, r, &household); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	household.ID, household.TenantID, household.UserID = existing.ID, existing.TenantID, existing.UserID
+	h.save(w, r, &household, http.StatusOK)
+}
+
+func (h *Handler) save(w http.ResponseWriter, r *http.Request, household *Household, status int) {
+	if err := household.Normalize(); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	household.UpdatedAt = time.Now().UTC()
+	if err := h.Store.Save(r.Context(), household); err != nil {
+		slog.Error("Failed to save the household", "id", household.ID, "error", err)
+		apierror.Reply(w, "Failed to save the household", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, status, household)
+}
+
+// DeleteHandler serves DELETE /api/households/{id}. The owners and payers on
+// the transactions are kept.
+func (h *Handler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := h.Store.Delete(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		apierror.Write(w, err)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to delete the household", "id", id, "error", err)
+		apierror.Reply(w, "Failed to delete the household", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SettlementHandler serves GET /api/households/{id}/settlement for the months
+// from to to, both YYYY-MM and the current month by default: the balances of
+// the members and the transfers that settle them.
+func (h *Handler) SettlementHandler(w http.ResponseWriter, r *http.Request) {
+	household, ok := h.get(w, r)
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from
+	query := r.URL.Query()
+	if v := query.Get("from"); v != "" {
+		t, err := time.Parse(monthLayout, v)
+		if err != nil {
+			apierror.Reply(w, "Invalid from parameter, expected YYYY-MM", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if v := query.Get("to"); v != "" {
+		t, err := time.Parse(monthLayout, v)
+		if err != nil {
+			apierror.Reply(w, "Invalid to parameter, expected YYYY-MM", http.StatusBadRequest)
+			return
+		}
+		to = t
+	} else if query.Get("from") != "" {
+		to = from
+	}
+	if to.Before(from) {
+		apierror.Reply(w, "Invalid period", http.StatusBadRequest)
+		return
+	}
+	end := to.AddDate(0, 1, 0)
+
+	taxonomy := &categories.Taxonomy{}
+	if h.Categories != nil {
+		var err error
+		if taxonomy, err = categories.Resolve(r.Context(), h.Categories, ""); err != nil {
+			accesslog.Logger(r.Context()).Error("Failed to read the category taxonomy", "error", err)
+			apierror.Reply(w, "Failed to read the category taxonomy", http.StatusInternalServerError)
+			return
+		}
+	}
+	txs, err := h.Repo.FindTransactions(r.Context(), statements.TransactionFilter{From: from, To: end})
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to retrieve transactions for the settlement", "id", household.ID, "error", err)
+		apierror.Reply(w, "Failed to retrieve transactions", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, Settle(household, txs, taxonomy, from, end))
+}
+
+// get reads the household of the path, answering the request itself when it
+// cannot.
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) (*Household, bool) {
+	id := r.PathValue("id")
+	household, err := h.Store.Get(r.Context(), id)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to read the household", "id", id, "error", err)
+		apierror.Reply(w, "Failed to read the household", http.StatusInternalServerError)
+		return nil, false
+	}
+	if household == nil {
+		apierror.Reply(w, ErrNotFound.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return household, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Package households groups users who share expenses and settles who owes
+// whom from the owner and payer recorded on the transactions.
+package households
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+var (
+	ErrInvalidHousehold = apierror.New(apierror.KindInvalid, "invalid_household", "invalid household")
+	ErrNotFound         = apierror.New(apierror.KindNotFound, "household_not_found", "household not found")
+)
+
+// Member is a user of the household, named like the X-Actor identity. Weight
+// is the member's part of the shared expenses, 1 when omitted.
+type Member struct {
+	User   string  `bson:"user" json:"user"`
+	Weight float64 `bson:"weight" json:"weight"`
+}
+
+// SplitRule splits the shared expenses of a category and its subcategories by
+// other weights than the members'. Members left out pay none of them.
+type SplitRule struct {
+	Category string             `bson:"category" json:"category"`
+	Weights  map[string]float64 `bson:"weights" json:"weights"`
+}
+
+type Household struct {
+	ID        string      `bson:"_id" json:"id"`
+	Name      string      `bson:"name" json:"name"`
+	Members   []Member    `bson:"members" json:"members"`
+	Rules     []SplitRule `bson:"rules,omitempty" json:"rules,omitempty"`
+	UpdatedAt time.Time   `bson:"updated_at" json:"updated_at"`
+	// TenantID and UserID own the household, stamped by the store from the
+	// context like the statements.
+	TenantID string `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+	UserID   string `bson:"user_id,omitempty" json:"user_id,omitempty"`
+}
+
+// Normalize fills the default weights and validates the household.
+func (h *Household) Normalize() error {
+	h.Name = strings.TrimSpace(h.Name)
+	if len(h.Members) == 0 {
+		return fmt.Errorf("%w: no members", ErrInvalidHousehold)
+	}
+	seen := map[string]bool{}
+	for i := range h.Members {
+		m := &h.Members[i]
+		m.User = strings.TrimSpace(m.User)
+		switch {
+		case m.User == "":
+			return fmt.Errorf("%w: member %d has no user", ErrInvalidHousehold, i)
+		case seen[m.User]:
+			return fmt.Errorf("%w: %s is a member twice", ErrInvalidHousehold, m.User)
+		case m.Weight < 0:
+			return fmt.Errorf("%w: negative weight of %s", ErrInvalidHousehold, m.User)
+		case m.Weight == 0:
+			m.Weight = 1
+		}
+		seen[m.User] = true
+	}
+
+	categories := map[string]bool{}
+	for i := range h.Rules {
+		rule := &h.Rules[i]
+		rule.Category = strings.TrimSpace(rule.Category)
+		key := strings.ToLower(rule.Category)
+		if rule.Category == "" || categories[key] {
+			return fmt.Errorf("%w: rule %d needs a category of its own", ErrInvalidHousehold, i)
+		}
+		categories[key] = true
+		total := 0.0
+		for user, weight := range rule.Weights {
+			if !seen[user] {
+				return fmt.Errorf("%w: rule of %s names %s, who is not a member", ErrInvalidHousehold, rule.Category, user)
+			}
+			if weight < 0 {
+				return fmt.Errorf("%w: rule of %s has a negative weight", ErrInvalidHousehold, rule.Category)
+			}
+			total += weight
+		}
+		if total == 0 {
+			return fmt.Errorf("%w: rule of %s splits nothing", ErrInvalidHousehold, rule.Category)
+		}
+	}
+	return nil
+}
+
+// IsMember reports whether the user belongs to the household.
+func (h *Household) IsMember(user string) bool {
+	for _, m := range h.Members {
+		if m.User == user {
+			return true
+		}
+	}
+	return false
+}
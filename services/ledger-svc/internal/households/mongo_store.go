@@ -0,0 +1,70 @@
+package households
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// MongoStore keeps the households in the <namespace>households collection.
+type MongoStore struct {
+	col *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database, namespace string) *MongoStore {
+	return &MongoStore{col: db.Collection(namespace + "households")}
+}
+
+func (s *MongoStore) List(ctx context.Context) ([]Household, error) {
+	cursor, err := s.col.Find(ctx, statements.OwnerFilter(ctx, bson.M{}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	list := []Household{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	sortHouseholds(list)
+	return list, nil
+}
+
+func (s *MongoStore) Get(ctx context.Context, id string) (*Household, error) {
+	var household Household
+	err := s.col.FindOne(ctx, statements.OwnerFilter(ctx, bson.M{"_id": id})).Decode(&household)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &household, nil
+}
+
+func (s *MongoStore) Save(ctx context.Context, household *Household) error {
+	household.TenantID, household.UserID = statements.Stamp(ctx, household.TenantID, household.UserID)
+	_, err := s.col.ReplaceOne(ctx, statements.OwnerFilter(ctx, bson.M{"_id": household.ID}), household, options.Replace().SetUpsert(true))
+	// the document of another owner does not match, the upsert inserts its
+	// ID a second time
+	if mongo.IsDuplicateKeyError(err) {
+		return statements.ErrNotOwned
+	}
+	return err
+}
+
+func (s *MongoStore) Delete(ctx context.Context, id string) error {
+	result, err := s.col.DeleteOne(ctx, statements.OwnerFilter(ctx, bson.M{"_id": id}))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package households
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/categories"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Balance is what a member paid against their part of the expenses; a
+// positive Net is owed to them.
+type Balance struct {
+	User  string  `json:"user"`
+	Paid  float64 `json:"paid"`
+	Share float64 `json:"share"`
+	Net   float64 `json:"net"`
+}
+
+// Transfer is a payment that settles the balances.
+type Transfer struct {
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Amount float64 `json:"amount"`
+}
+
+type Settlement struct {
+	Household    string     `json:"household"`
+	From         time.Time  `json:"from"`
+	To           time.Time  `json:"to"`
+	Total        float64    `json:"total"`
+	Transactions int        `json:"transactions"`
+	Balances     []Balance  `json:"balances"`
+	Transfers    []Transfer `json:"transfers"`
+	// Unattributed counts the transactions of the period without a payer,
+	// they are left out until one is set.
+	Unattributed int `json:"unattributed"`
+}
+
+// Settle splits the transactions paid by a member: an expense with an owner
+// in the household is theirs alone, the others are shared along the split
+// rule of the closest category of the taxonomy path, or else the member
+// weights. Transfers between accounts are no expenses; refunds count
+// negatively. The transfers returned settle every balance in as few payments
+// as the greedy matching of the largest creditor and debtor finds.
+func Settle(h *Household, txs []statements.Transaction, taxonomy *categories.Taxonomy, from, to time.Time) *Settlement {
+	s := &Settlement{Household: h.ID, From: from, To: to}
+	balances := make(map[string]*Balance, len(h.Members))
+	for _, m := range h.Members {
+		balances[m.User] = &Balance{User: m.User}
+	}
+
+	for i := range txs {
+		tx := &txs[i]
+		if statements.ClassifySpend(tx) == statements.SpendTransfer {
+			continue
+		}
+		if tx.PaidBy == "" {
+			s.Unattributed++
+			continue
+		}
+		payer, ok := balances[tx.PaidBy]
+		if !ok {
+			continue
+		}
+		s.Transactions++
+		s.Total += tx.Amount
+		payer.Paid += tx.Amount
+		if owner, ok := balances[tx.Owner]; ok {
+			owner.Share += tx.Amount
+			continue
+		}
+		weights, total := h.weights(taxonomy.Path(tx.Category))
+		for user, weight := range weights {
+			balances[user].Share += tx.Amount * weight / total
+		}
+	}
+
+	s.Total = money.Round(s.Total)
+	for _, m := range h.Members {
+		b := balances[m.User]
+		b.Net = money.Round(b.Paid - b.Share)
+		b.Paid, b.Share = money.Round(b.Paid), money.Round(b.Share)
+		s.Balances = append(s.Balances, *b)
+	}
+	s.Transfers = transfers(s.Balances)
+	return s
+}
+
+// weights returns the split of a shared expense in the category path.
+func (h *Household) weights(path []string) (map[string]float64, float64) {
+	for i := len(path) - 1; i >= 0; i-- {
+		for _, rule := range h.Rules {
+			if strings.EqualFold(rule.Category, path[i]) {
+				return rule.Weights, sum(rule.Weights)
+			}
+		}
+	}
+	weights := make(map[string]float64, len(h.Members))
+	for _, m := range h.Members {
+		weights[m.User] = m.Weight
+	}
+	return weights, sum(weights)
+}
+
+func sum(weights map[string]float64) float64 {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	return total
+}
+
+func transfers(balances []Balance) []Transfer {
+	type party struct {
+		user   string
+		amount float64
+	}
+	var creditors, debtors []party
+	for _, b := range balances {
+		switch {
+		case b.Net >= 0.01:
+			creditors = append(creditors, party{b.User, b.Net})
+		case b.Net <= -0.01:
+			debtors = append(debtors, party{b.User, -b.Net})
+		}
+	}
+	byAmount := func(list []party) {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].amount != list[j].amount {
+				return list[i].amount > list[j].amount
+			}
+			return list[i].user < list[j].user
+		})
+	}
+	byAmount(creditors)
+	byAmount(debtors)
+
+	result := []Transfer{}
+	for len(creditors) > 0 && len(debtors) > 0 {
+		amount := money.Round(math.Min(creditors[0].amount, debtors[0].amount))
+		if amount > 0 {
+			result = append(result, Transfer{From: debtors[0].user, To: creditors[0].user, Amount: amount})
+		}
+		creditors[0].amount -= amount
+		debtors[0].amount -= amount
+		if creditors[0].amount < 0.01 {
+			creditors = creditors[1:]
+		}
+		if debtors[0].amount < 0.01 {
+			debtors = debtors[1:]
+		}
+		byAmount(creditors)
+		byAmount(debtors)
+	}
+	return result
+}
@@ -0,0 +1,95 @@
+package households
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Store keeps the households.
+type Store interface {
+	List(ctx context.Context) ([]Household, error)
+	// Get returns nil when the household does not exist.
+	Get(ctx context.Context, id string) (*Household, error)
+	// Save creates or replaces the household by ID.
+	Save(ctx context.Context, household *Household) error
+	// Delete returns ErrNotFound when the household does not exist.
+	Delete(ctx context.Context, id string) error
+}
+
+// NewStore keeps the households next to the statements in MongoDB, or in
+// memory for the memory driver.
+func NewStore(repo statements.StatementRepository) Store {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryStore()
+}
+
+type MemoryStore struct {
+	mu         sync.RWMutex
+	households map[string]Household
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{households: make(map[string]Household)}
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Household, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Household, 0, len(s.households))
+	for _, h := range s.households {
+		if statements.Owns(ctx, h.TenantID, h.UserID) {
+			list = append(list, h)
+		}
+	}
+	sortHouseholds(list)
+	return list, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Household, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	h, ok := s.households[id]
+	if !ok || !statements.Owns(ctx, h.TenantID, h.UserID) {
+		return nil, nil
+	}
+	return &h, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, household *Household) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.households[household.ID]; ok && !statements.Owns(ctx, existing.TenantID, existing.UserID) {
+		return statements.ErrNotOwned
+	}
+	household.TenantID, household.UserID = statements.Stamp(ctx, household.TenantID, household.UserID)
+	s.households[household.ID] = *household
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if h, ok := s.households[id]; !ok || !statements.Owns(ctx, h.TenantID, h.UserID) {
+		return ErrNotFound
+	}
+	delete(s.households, id)
+	return nil
+}
+
+func sortHouseholds(list []Household) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].ID < list[j].ID
+	})
+}
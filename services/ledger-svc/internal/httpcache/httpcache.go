@@ -0,0 +1,256 @@
+// Package httpcache keeps the responses of the aggregation endpoints, e.g.
+// the spend analytics, for the dashboard loads that follow, so they do not
+// each run the aggregation on the database. Responses are keyed by the owner
+// the request is scoped to and its query, kept for a TTL and dropped as soon
+// as the owner's ledger changes: the Cache hears about the saves as a
+// statements.Notifier and about every write, whichever replica made it, as an
+// events.Sink of the outbox.
+package httpcache
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// maxBody bounds the responses kept, bigger ones are served uncached.
+const maxBody = 1 << 20
+
+var lookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "finchie_http_cache_lookups_total",
+	Help: "Lookups of the response cache, by result: hit, miss or bypass.",
+}, []string{"result"})
+
+type entry struct {
+	owner   string
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// Cache is an in-memory response cache. It is safe for concurrent use.
+type Cache struct {
+	TTL        time.Duration
+	MaxEntries int
+	Now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	// epoch changes on every invalidation, so a response computed across
+	// one is not kept.
+	epoch uint64
+}
+
+func New(ttl time.Duration, maxEntries int) *Cache {
+	return &Cache{TTL: ttl, MaxEntries: maxEntries, Now: time.Now, entries: make(map[string]*entry)}
+}
+
+// FromEnv keeps the responses for RESPONSE_CACHE_TTL_SECONDS (60), none with
+// 0, at most RESPONSE_CACHE_SIZE (1000) of them. It returns nil when
+// disabled.
+func FromEnv() *Cache {
+	ttl := 60
+	if v, err := strconv.Atoi(os.Getenv("RESPONSE_CACHE_TTL_SECONDS")); err == nil && v >= 0 {
+		ttl = v
+	}
+	if ttl == 0 {
+		return nil
+	}
+	size := 1000
+	if v, err := strconv.Atoi(os.Getenv("RESPONSE_CACHE_SIZE")); err == nil && v > 0 {
+		size = v
+	}
+	return New(time.Duration(ttl)*time.Second, size)
+}
+
+// key is the owner and the query of the request, its parameters sorted.
+func key(owner string, r *http.Request) string {
+	return owner + " " + r.URL.Path + "?" + r.URL.Query().Encode()
+}
+
+type recorder struct {
+	http.ResponseWriter
+	// maxAge is the Cache-Control of successful responses
+	maxAge string
+	status int
+	body   bytes.Buffer
+	// overflow is set once the body outgrew maxBody
+	overflow bool
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+		if status == http.StatusOK {
+			r.Header().Set("Cache-Control", r.maxAge)
+			r.Header().Set("X-Cache", "MISS")
+		}
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	if !r.overflow {
+		if r.body.Len()+len(b) > maxBody {
+			r.overflow = true
+			r.body = bytes.Buffer{}
+		} else {
+			r.body.Write(b)
+		}
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the writer, e.g. to flush.
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Middleware serves the GET requests from the cache, answering the others
+// and those with Cache-Control: no-cache from next. Successful responses are
+// kept, unless stale themselves, e.g. served while the database is away.
+// Responses tell clients they may keep them as long, privately.
+func (c *Cache) Middleware(next http.Handler) http.Handler {
+	maxAge := "private, max-age=" + strconv.Itoa(int(c.TTL.Seconds()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		owner := statements.OwnerFrom(r.Context())
+		k := key(owner, r)
+		if strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+			lookups.WithLabelValues("bypass").Inc()
+		} else if e := c.get(k); e != nil {
+			lookups.WithLabelValues("hit").Inc()
+			for name, values := range e.header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Cache-Control", maxAge)
+			w.Header().Set("X-Cache", "HIT")
+			w.Write(e.body)
+			return
+		} else {
+			lookups.WithLabelValues("miss").Inc()
+		}
+
+		c.mu.Lock()
+		epoch := c.epoch
+		c.mu.Unlock()
+		rec := &recorder{ResponseWriter: w, maxAge: maxAge}
+		next.ServeHTTP(rec, r)
+
+		if rec.status != http.StatusOK || rec.overflow || w.Header().Get("Warning") != "" {
+			return
+		}
+		header := http.Header{}
+		for _, name := range []string{"Content-Type", "ETag", "Last-Modified"} {
+			if v := w.Header().Values(name); len(v) > 0 {
+				header[name] = v
+			}
+		}
+		c.put(k, epoch, &entry{owner: owner, header: header, body: rec.body.Bytes()})
+	})
+}
+
+func (c *Cache) get(k string) *entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[k]
+	if !ok {
+		return nil
+	}
+	if !c.Now().Before(e.expires) {
+		delete(c.entries, k)
+		return nil
+	}
+	return e
+}
+
+// put keeps the entry unless the cache was invalidated since epoch. A full
+// cache makes room by dropping the expired entries, else the oldest one.
+func (c *Cache) put(k string, epoch uint64, e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.epoch != epoch {
+		return
+	}
+	now := c.Now()
+	e.expires = now.Add(c.TTL)
+	if _, ok := c.entries[k]; !ok && len(c.entries) >= c.MaxEntries {
+		oldest := ""
+		for key, other := range c.entries {
+			if !now.Before(other.expires) {
+				delete(c.entries, key)
+			} else if oldest == "" || other.expires.Before(c.entries[oldest].expires) {
+				oldest = key
+			}
+		}
+		if len(c.entries) >= c.MaxEntries {
+			delete(c.entries, oldest)
+		}
+	}
+	c.entries[k] = e
+}
+
+// Invalidate drops the responses a change of the owner's ledger may affect:
+// those of the owner and of the scopes covering it, its tenant and the whole
+// deployment. An empty owner drops them all.
+func (c *Cache) Invalidate(owner string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	for k, e := range c.entries {
+		if owner == "" || covers(e.owner, owner) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// covers reports whether the responses of scope include the data of owner,
+// see statements.Owner.
+func covers(scope, owner string) bool {
+	if scope == "" || scope == owner {
+		return true
+	}
+	// a tenant without a user, e.g. acme/
+	return strings.HasSuffix(scope, "/") && strings.HasPrefix(owner, scope)
+}
+
+// Notify drops the responses of the owner of a save, see statements.Notifier.
+func (c *Cache) Notify(ctx context.Context, event statements.ChangeEvent) {
+	c.Invalidate(eventOwner(statements.OwnerFrom(ctx), event))
+}
+
+// Publish drops the responses of the owner of a change recorded in the
+// outbox, see events.Sink. Changes of an unknown owner drop them all.
+func (c *Cache) Publish(_ context.Context, event statements.ChangeEvent) error {
+	c.Invalidate(eventOwner("", event))
+	return nil
+}
+
+func eventOwner(owner string, event statements.ChangeEvent) string {
+	switch {
+	case event.Statement != nil && (event.Statement.TenantID != "" || event.Statement.UserID != ""):
+		return statements.Owner(event.Statement.TenantID, event.Statement.UserID)
+	case event.Transaction != nil && (event.Transaction.TenantID != "" || event.Transaction.UserID != ""):
+		return statements.Owner(event.Transaction.TenantID, event.Transaction.UserID)
+	}
+	return owner
+}
@@ -0,0 +1,95 @@
+// Package httpmetrics measures the API requests for Prometheus: their count
+// and duration by route and status, and those in flight.
+package httpmetrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// unmatched labels the requests no route serves, e.g. scans, so their
+// paths do not each become a series.
+const unmatched = "unmatched"
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "finchie_http_requests_total",
+		Help: "API requests served, by method, route and status.",
+	}, []string{"method", "route", "status"})
+	duration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "finchie_http_request_duration_seconds",
+		Help:    "Latency of API requests, by method and route.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"method", "route"})
+	inFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "finchie_http_requests_in_flight",
+		Help: "API requests being served.",
+	})
+)
+
+type recorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the writer, e.g. to flush.
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Middleware measures every request, labelled with the pattern of the mux
+// route serving it, e.g. /api/statements/{id}/attachments. Requests answered
+// further out, e.g. rate limited or unauthorized, are labelled the same.
+func Middleware(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := unmatched
+		if _, pattern := mux.Handler(r); pattern != "" {
+			// the method is a label of its own
+			if _, path, ok := strings.Cut(pattern, " "); ok {
+				pattern = path
+			}
+			route = pattern
+		}
+		start := time.Now()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		rec := &recorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		method := methodLabel(r.Method)
+		requests.WithLabelValues(method, route, strconv.Itoa(rec.status)).Inc()
+		duration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// methodLabel bounds the methods clients may send to the standard ones.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
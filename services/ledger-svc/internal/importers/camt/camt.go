@@ -0,0 +1,288 @@
+// Package camt reads ISO 20022 CAMT.053 bank to customer statements, of any
+// version: the elements are matched by local name, whatever the namespace.
+// Importing it registers the camt053 importer.
+package camt
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/importers"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+func init() {
+	importers.Register("camt053", Importer{})
+}
+
+// Document is the part of a CAMT.053 document the ledger needs.
+type Document struct {
+	Statements []Statement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type Statement struct {
+	ID      string `xml:"Id"`
+	Account struct {
+		IBAN     string `xml:"Id>IBAN"`
+		Other    string `xml:"Id>Othr>Id"`
+		Currency string `xml:"Ccy"`
+		Servicer string `xml:"Svcr>FinInstnId>Nm"`
+	} `xml:"Acct"`
+	Balances []Balance `xml:"Bal"`
+	Entries  []Entry   `xml:"Ntry"`
+}
+
+type Amount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type Date struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+type Balance struct {
+	// Code is e.g. OPBD for the opening and CLBD for the closing balance.
+	Code   string `xml:"Tp>CdOrPrtry>Cd"`
+	Amount Amount `xml:"Amt"`
+	Mark   string `xml:"CdtDbtInd"`
+	Date   Date   `xml:"Dt"`
+}
+
+type Party struct {
+	Name    string `xml:"Nm"`
+	PtyName string `xml:"Pty>Nm"`
+}
+
+// Status is BOOK, PDNG or INFO: the text of Sts up to version 07, the text of
+// its Cd after.
+type Status string
+
+func (s *Status) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var v struct {
+		Text string `xml:",chardata"`
+		Code string `xml:"Cd"`
+	}
+	if err := d.DecodeElement(&v, &start); err != nil {
+		return err
+	}
+	*s = Status(strings.TrimSpace(v.Code))
+	if *s == "" {
+		*s = Status(strings.TrimSpace(v.Text))
+	}
+	return nil
+}
+
+func (p Party) name() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.PtyName
+}
+
+type Entry struct {
+	Amount Amount `xml:"Amt"`
+	// Mark is CRDT or DBIT.
+	Mark        string `xml:"CdtDbtInd"`
+	Reversal    bool   `xml:"RvslInd"`
+	Status      Status `xml:"Sts"`
+	BookingDate Date   `xml:"BookgDt"`
+	ValueDate   Date   `xml:"ValDt"`
+	// ServicerRef is the bank's unique reference of the entry.
+	ServicerRef string `xml:"AcctSvcrRef"`
+	Info        string `xml:"AddtlNtryInf"`
+	Details     []struct {
+		EndToEndID   string   `xml:"Refs>EndToEndId"`
+		ServicerRef  string   `xml:"Refs>AcctSvcrRef"`
+		Unstructured []string `xml:"RmtInf>Ustrd"`
+		Creditor     Party    `xml:"RltdPties>Cdtr"`
+		Debtor       Party    `xml:"RltdPties>Dbtr"`
+	} `xml:"NtryDtls>TxDtls"`
+}
+
+// Parse reads a CAMT.053 document.
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid XML: %w", err)
+	}
+	if len(doc.Statements) == 0 {
+		return nil, errors.New("no statement (BkToCstmrStmt/Stmt) in the document")
+	}
+	return &doc, nil
+}
+
+func (s *Statement) account() string {
+	if s.Account.IBAN != "" {
+		return s.Account.IBAN
+	}
+	return s.Account.Other
+}
+
+// Importer imports the statements of a CAMT.053 document as bank statements.
+type Importer struct{}
+
+// Import names the statements after opts.SourceName, or the account servicer
+// the document names.
+func (Importer) Import(data []byte, opts importers.Options) ([]*statements.Statement, error) {
+	doc, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*statements.Statement, 0, len(doc.Statements))
+	for i := range doc.Statements {
+		stmt, err := doc.Statements[i].ledger(opts)
+		if err != nil {
+			return nil, fmt.Errorf("statement %s: %w", doc.Statements[i].ID, err)
+		}
+		list = append(list, stmt)
+	}
+	return list, nil
+}
+
+// ledger converts the statement, identified by its account and ID. Entries
+// carry the bank's reference in most documents; those that do not are
+// identified by what they report.
+func (s *Statement) ledger(opts importers.Options) (*statements.Statement, error) {
+	sourceName := opts.SourceName
+	if sourceName == "" {
+		sourceName = strings.TrimSpace(s.Account.Servicer)
+	}
+	account := s.account()
+	currency := s.Account.Currency
+	if currency == "" && len(s.Balances) > 0 {
+		currency = s.Balances[0].Amount.Currency
+	}
+	if currency == "" {
+		currency = opts.Currency
+	}
+	switch {
+	case sourceName == "":
+		return nil, errors.New("the document does not name the account servicer, pass source_name")
+	case account == "":
+		return nil, errors.New("no account ID")
+	case s.ID == "":
+		return nil, errors.New("no statement ID")
+	case currency == "":
+		return nil, errors.New("no account currency, pass currency")
+	}
+
+	ids := importers.NewIDs("camt", account)
+	transactions := make([]statements.Transaction, 0, len(s.Entries))
+	total := 0.0
+	for i, e := range s.Entries {
+		if e.Status != "" && !strings.EqualFold(string(e.Status), "BOOK") {
+			// pending entries (PDNG, INFO) may still change or disappear
+			continue
+		}
+		tx, err := e.ledger(currency)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		ref := e.ServicerRef
+		if ref == "" && len(e.Details) == 1 {
+			ref = e.Details[0].ServicerRef
+		}
+		if ref != "" {
+			tx.ID = importers.StableID("camt", account, ref)
+			tx.ExternalRefs = append(tx.ExternalRefs, statements.ExternalRef{Type: "bank_reference", Value: ref})
+		} else {
+			tx.ID = ids.Next(tx.Date.Format(time.DateOnly), fmt.Sprintf("%.2f", tx.Amount), tx.Description)
+		}
+		transactions = append(transactions, tx)
+		total += tx.Amount
+	}
+
+	sourceID := account + "_" + s.ID
+	return &statements.Statement{
+		Type:         statements.BankStatement,
+		SourceType:   statements.BankAccount,
+		SourceName:   sourceName,
+		SourceID:     &sourceID,
+		Currency:     strings.ToUpper(currency),
+		TotalAmount:  importers.RoundCents(total),
+		Transactions: &transactions,
+	}, nil
+}
+
+func (e *Entry) ledger(currency string) (statements.Transaction, error) {
+	var tx statements.Transaction
+	amount, err := parseAmount(e.Amount.Value)
+	if err != nil {
+		return tx, err
+	}
+	// the ledger counts money leaving the account as positive; reversals are
+	// marked with the way their money moves too
+	debit := e.Mark == "DBIT"
+	if e.Mark != "DBIT" && e.Mark != "CRDT" {
+		return tx, fmt.Errorf("invalid credit/debit indicator %q", e.Mark)
+	}
+	if !debit {
+		amount = -amount
+	}
+	tx.Amount = importers.RoundCents(amount)
+
+	date := e.BookingDate
+	if date.Date == "" && date.DateTime == "" {
+		date = e.ValueDate
+	}
+	if tx.Date, err = parseDate(date); err != nil {
+		return tx, err
+	}
+	if e.Amount.Currency != "" && !strings.EqualFold(e.Amount.Currency, currency) {
+		tx.Currency = strings.ToUpper(e.Amount.Currency)
+	}
+
+	var parts []string
+	if len(e.Details) > 0 {
+		d := e.Details[0]
+		// the counterparty: who was paid, or who paid
+		party := d.Creditor.name()
+		if !debit {
+			party = d.Debtor.name()
+		}
+		parts = append(parts, party)
+		parts = append(parts, d.Unstructured...)
+		if d.EndToEndID != "" && d.EndToEndID != "NOTPROVIDED" {
+			tx.ExternalRefs = append(tx.ExternalRefs, statements.ExternalRef{Type: "end_to_end_id", Value: d.EndToEndID})
+		}
+	}
+	tx.Description = strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+	if tx.Description == "" {
+		tx.Description = strings.Join(strings.Fields(e.Info), " ")
+	}
+	if e.Reversal {
+		tx.Extra = map[string]any{"reversal": true}
+	}
+	return tx, nil
+}
+
+// parseAmount reads the amounts of the format, XML decimals.
+func parseAmount(s string) (float64, error) {
+	amount, err := money.ParseLocale(s, money.Dot)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return amount, nil
+}
+
+func parseDate(d Date) (time.Time, error) {
+	if d.Date != "" {
+		t, err := time.Parse(time.DateOnly, strings.TrimSpace(d.Date))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q", d.Date)
+		}
+		return t, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(d.DateTime)); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date time %q", d.DateTime)
+}
@@ -0,0 +1,200 @@
+package csvimport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/jsonbody"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// maxFileSize caps an upload; a year of transactions is well below it.
+const maxFileSize = 10 << 20
+
+type Handler struct {
+	Store   Store
+	Service *statements.StatementService
+}
+
+// Imported reports the statement an export was imported into.
+type Imported struct {
+	StatementID  string                   `json:"statement_id"`
+	Transactions int                      `json:"transactions"`
+	TotalAmount  float64                  `json:"total_amount"`
+	Queued       bool                     `json:"queued,omitempty"`
+	Preview      []statements.Transaction `json:"preview,omitempty"`
+}
+
+// ListHandler serves GET /api/import/profiles.
+func (h *Handler) ListHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Store.List(r.Context())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list import profiles", "error", err)
+		apierror.Reply(w, "Failed to list import profiles", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// GetHandler serves GET /api/import/profiles/{id}.
+func (h *Handler) GetHandler(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.profile(w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// CreateHandler serves POST /api/import/profiles with {"name": ...,
+// "source_name": ..., "currency": ..., "date_format": ..., "columns":
+// {"date": "Posting Date", ...}, ...}.
+func (h *Handler) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	var profile Profile
+	if err := jsonbody.Decode(w, r, &profile); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	profile.ID = uuid.NewString()
+	h.save(w, r, &profile, http.StatusCreated)
+}
+
+// UpdateHandler serves PUT /api/import/profiles/{id}, replacing the profile.
+func (h *Handler) UpdateHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	existing, ok := h.profile(w, r, id)
+	if !ok {
+		return
+	}
+	var profile Profile
+	if err := jsonbody.Decode(w, r, &profile); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	profile.ID, profile.TenantID, profile.UserID = id, existing.TenantID, existing.UserID
+	h.save(w, r, &profile, http.StatusOK)
+}
+
+func (h *Handler) save(w http.ResponseWriter, r *http.Request, profile *Profile, status int) {
+	if err := profile.Normalize(); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	profile.UpdatedAt = time.Now().UTC()
+	if err := h.Store.Save(r.Context(), profile); err != nil {
+		slog.Error("Failed to save the import profile", "id", profile.ID, "error", err)
+		apierror.Reply(w, "Failed to save the import profile", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, status, profile)
+}
+
+// DeleteHandler serves DELETE /api/import/profiles/{id}.
+func (h *Handler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := h.Store.Delete(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		apierror.Write(w, err)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to delete the import profile", "id", id, "error", err)
+		apierror.Reply(w, "Failed to delete the import profile", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ImportHandler serves POST /api/import/csv?profile=<id> with a CSV export as
+// the body, saving its transactions as a statement of the profile's source.
+// A file the profile cannot read is answered with 400 and its failing rows;
+// ?dry_run=true previews the transactions without saving them.
+func (h *Handler) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("profile") == "" {
+		apierror.Reply(w, "Missing profile parameter", http.StatusBadRequest)
+		return
+	}
+	profile, ok := h.profile(w, r, query.Get("profile"))
+	if !ok {
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxFileSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		apierror.Reply(w, fmt.Sprintf("File exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		apierror.Reply(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	stmt, err := profile.Parse(data)
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"message": "The profile cannot read the file", "rows": parseErr.Rows})
+		return
+	}
+	if err != nil {
+		apierror.Reply(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if query.Get("dry_run") == "true" {
+		if err := stmt.Normalize(); err != nil {
+			apierror.Reply(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, Imported{StatementID: stmt.ID, Transactions: len(*stmt.Transactions), TotalAmount: stmt.TotalAmount, Preview: *stmt.Transactions})
+		return
+	}
+
+	status := http.StatusCreated
+	err = h.Service.SaveStatementWithTransactions(r.Context(), stmt)
+	queued := errors.Is(err, statements.ErrQueued)
+	switch {
+	case queued:
+		status = http.StatusAccepted
+	case errors.Is(err, statements.ErrClientEncryption):
+		apierror.Write(w, err)
+		return
+	case err != nil:
+		accesslog.Logger(r.Context()).Error("Failed to save CSV statement", "id", stmt.ID, "profile", profile.ID, "tx_count", len(*stmt.Transactions), "error", err)
+		apierror.Reply(w, "Failed to save statement", http.StatusInternalServerError)
+		return
+	}
+	accesslog.Logger(r.Context()).Info("CSV file imported", "id", stmt.ID, "profile", profile.ID, "tx_count", len(*stmt.Transactions))
+	writeJSON(w, status, Imported{StatementID: stmt.ID, Transactions: len(*stmt.Transactions), TotalAmount: stmt.TotalAmount, Queued: queued})
+}
+
+// profile reads a profile, answering the request itself when there is none.
+func (h *Handler) profile(w http.ResponseWriter, r *http.Request, id string) (*Profile, bool) {
+	profile, err := h.Store.Get(r.Context(), id)
+	if err != nil {
+		slog.Error("Failed to read the import profile", "id", id, "error", err)
+		apierror.Reply(w, "Failed to read the import profile", http.StatusInternalServerError)
+		return nil, false
+	}
+	if profile == nil {
+		apierror.Reply(w, ErrNotFound.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return profile, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
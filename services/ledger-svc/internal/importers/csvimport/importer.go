@@ -0,0 +1,247 @@
+package csvimport
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/importers"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// maxRowErrors caps the rows a ParseError lists.
+const maxRowErrors = 20
+
+// RowError is a row of the file the profile cannot read. Rows count from 1,
+// the skipped and header rows included, as a spreadsheet shows them.
+type RowError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+// ParseError lists the first rows of a file the profile cannot read.
+type ParseError struct {
+	Rows []RowError
+}
+
+func (e *ParseError) Error() string {
+	msgs := make([]string, len(e.Rows))
+	for i, r := range e.Rows {
+		msgs[i] = fmt.Sprintf("row %d: %s", r.Row, r.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Parse reads a CSV export into one statement of the profile's source holding
+// its transactions. The statement is identified by the dates of its first and
+// last transactions, and transactions by the bank's reference or else by
+// their date, amount and description, so uploading the same export again
+// updates what it imported before. Rows without a date, like the totals some
+// banks append, are skipped.
+func (p *Profile) Parse(data []byte) (*statements.Statement, error) {
+	reader := csv.NewReader(strings.NewReader(importers.Decode(data)))
+	reader.Comma, _ = utf8.DecodeRuneInString(p.Delimiter)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	row := 0
+	next := func() ([]string, error) {
+		record, err := reader.Read()
+		if err == nil {
+			row, _ = reader.FieldPos(0)
+		}
+		return record, err
+	}
+
+	for range p.SkipRows {
+		if _, err := next(); err != nil {
+			return nil, p.readError(err, row+1)
+		}
+	}
+	var header []string
+	if !p.NoHeader {
+		record, err := next()
+		if err != nil {
+			return nil, p.readError(err, row+1)
+		}
+		header = record
+	}
+	index, err := p.columnIndex(header)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := p.layout()
+	var transactions []statements.Transaction
+	var rowErrors []RowError
+	ids := importers.NewIDs("csv", p.SourceName)
+	var first, last time.Time
+	for {
+		record, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, p.readError(err, row+1)
+		}
+		cell := func(field string) string {
+			i, ok := index[field]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		if cell(FieldDate) == "" {
+			continue
+		}
+
+		tx, err := p.transaction(cell, layout)
+		if err != nil {
+			if rowErrors = append(rowErrors, RowError{Row: row, Message: err.Error()}); len(rowErrors) == maxRowErrors {
+				break
+			}
+			continue
+		}
+		tx.ID = p.transactionID(tx, cell(FieldReference), ids)
+		transactions = append(transactions, tx)
+		if first.IsZero() || tx.Date.Before(first) {
+			first = tx.Date
+		}
+		if tx.Date.After(last) {
+			last = tx.Date
+		}
+	}
+	if len(rowErrors) > 0 {
+		return nil, &ParseError{Rows: rowErrors}
+	}
+	if len(transactions) == 0 {
+		return nil, errors.New("no transactions in the file")
+	}
+
+	total := 0.0
+	for _, tx := range transactions {
+		total += tx.Amount
+	}
+	sourceID := first.Format("20060102") + "_" + last.Format("20060102")
+	stmt := &statements.Statement{
+		Type:         statements.BankStatement,
+		SourceType:   p.SourceType,
+		SourceName:   p.SourceName,
+		SourceID:     &sourceID,
+		Currency:     p.Currency,
+		TotalAmount:  importers.RoundCents(total),
+		Transactions: &transactions,
+	}
+	if p.SourceType == statements.CreditCard {
+		stmt.Type = statements.CreditCardBill
+	}
+	return stmt, nil
+}
+
+func (p *Profile) readError(err error, row int) error {
+	if errors.Is(err, io.EOF) {
+		return errors.New("the file ends before its first transaction")
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		row = parseErr.StartLine
+	}
+	return &ParseError{Rows: []RowError{{Row: row, Message: err.Error()}}}
+}
+
+// columnIndex finds the column of every mapped field, by header or by number.
+func (p *Profile) columnIndex(header []string) (map[string]int, error) {
+	index := make(map[string]int, len(p.Columns))
+	for field, column := range p.Columns {
+		if p.NoHeader {
+			n, err := strconv.Atoi(column)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("%w: column %q of %s is not a column number", ErrInvalidProfile, column, field)
+			}
+			index[field] = n - 1
+			continue
+		}
+		found := false
+		for i, name := range header {
+			if strings.EqualFold(strings.TrimSpace(name), column) {
+				index[field], found = i, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: no %q column for %s in the header", ErrInvalidProfile, column, field)
+		}
+	}
+	return index, nil
+}
+
+func (p *Profile) transaction(cell func(string) string, layout string) (statements.Transaction, error) {
+	tx := statements.Transaction{
+		Description: strings.Join(strings.Fields(cell(FieldDescription)), " "),
+		Category:    cell(FieldCategory),
+		Currency:    strings.ToUpper(cell(FieldCurrency)),
+	}
+	date, err := time.Parse(layout, cell(FieldDate))
+	if err != nil {
+		return tx, fmt.Errorf("date %q does not match %s", cell(FieldDate), p.DateFormat)
+	}
+	tx.Date = date.UTC()
+
+	if _, ok := p.Columns[FieldAmount]; ok {
+		amount, err := p.parseAmount(cell(FieldAmount))
+		if err != nil {
+			return tx, err
+		}
+		// the ledger counts money leaving the account as positive
+		if p.AmountSign == DebitNegative {
+			amount = -amount
+		}
+		tx.Amount = amount
+	} else {
+		debit, err := p.parseAmount(cell(FieldDebit))
+		if err != nil && cell(FieldDebit) != "" {
+			return tx, err
+		}
+		credit, err := p.parseAmount(cell(FieldCredit))
+		if err != nil && cell(FieldCredit) != "" {
+			return tx, err
+		}
+		tx.Amount = math.Abs(debit) - math.Abs(credit)
+	}
+	tx.Amount = importers.RoundCents(tx.Amount)
+
+	if ref := cell(FieldReference); ref != "" {
+		tx.ExternalRefs = []statements.ExternalRef{{Type: "bank_reference", Value: ref}}
+	}
+	if memo := cell(FieldMemo); memo != "" {
+		tx.Extra = map[string]any{"memo": memo}
+	}
+	return tx, nil
+}
+
+// parseAmount reads an amount the way spreadsheets and banks write them, see
+// money.ParseLocale, with the decimal separator of the profile.
+func (p *Profile) parseAmount(s string) (float64, error) {
+	locale := money.Dot
+	if p.DecimalComma {
+		locale = money.Comma
+	}
+	return money.ParseLocale(s, locale)
+}
+
+// transactionID derives a stable ID from the bank's reference, or from what
+// the row reports and how many identical rows came before it.
+func (p *Profile) transactionID(tx statements.Transaction, reference string, ids *importers.IDs) string {
+	if reference != "" {
+		return importers.StableID("csv", p.SourceName, "ref", reference)
+	}
+	return ids.Next("row", tx.Date.Format(time.DateOnly), fmt.Sprintf("%.2f", tx.Amount), strings.ToLower(tx.Description))
+}
@@ -0,0 +1,160 @@
+// Package csvimport imports the CSV exports of any institution, read through
+// an import profile that says how the bank lays its export out.
+package csvimport
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+var (
+	ErrInvalidProfile = apierror.New(apierror.KindInvalid, "invalid_import_profile", "invalid import profile")
+	ErrNotFound       = apierror.New(apierror.KindNotFound, "import_profile_not_found", "import profile not found")
+)
+
+// Fields a column can be mapped to.
+const (
+	FieldDate        = "date"
+	FieldDescription = "description"
+	// FieldAmount is a signed amount, see Profile.AmountSign.
+	FieldAmount = "amount"
+	// FieldDebit and FieldCredit split the amount over two columns, money
+	// leaving the account in the first.
+	FieldDebit    = "debit"
+	FieldCredit   = "credit"
+	FieldCurrency = "currency"
+	FieldCategory = "category"
+	// FieldReference is the bank's own ID of the transaction, kept as an
+	// external reference and used for its transaction ID.
+	FieldReference = "reference"
+	FieldMemo      = "memo"
+)
+
+var fields = []string{FieldDate, FieldDescription, FieldAmount, FieldDebit, FieldCredit, FieldCurrency, FieldCategory, FieldReference, FieldMemo}
+
+// AmountSign is how the amount column signs money leaving the account.
+type AmountSign string
+
+const (
+	// DebitNegative exports charges and withdrawals as negative amounts.
+	DebitNegative AmountSign = "debit_negative"
+	DebitPositive AmountSign = "debit_positive"
+)
+
+// Profile describes the CSV export of one bank or card.
+type Profile struct {
+	ID   string `bson:"_id" json:"id"`
+	Name string `bson:"name" json:"name"`
+	// TenantID and UserID own the profile, stamped by the store from the
+	// context like the statements.
+	TenantID string `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+	UserID   string `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	// SourceName and SourceType are those of the statements imported with
+	// the profile.
+	SourceName string                `bson:"source_name" json:"source_name"`
+	SourceType statements.SourceType `bson:"source_type" json:"source_type"`
+	Currency   string                `bson:"currency" json:"currency"`
+	// Delimiter separates the fields, "," by default.
+	Delimiter string `bson:"delimiter" json:"delimiter"`
+	// SkipRows is the number of lines before the header, or before the first
+	// row without one, e.g. an account summary.
+	SkipRows int `bson:"skip_rows,omitempty" json:"skip_rows,omitempty"`
+	// NoHeader reads the columns by number, 1 being the first.
+	NoHeader bool `bson:"no_header,omitempty" json:"no_header,omitempty"`
+	// DateFormat spells the dates with YYYY, YY, MM, M, DD, D, HH, mm and
+	// ss, e.g. DD/MM/YYYY; YYYY-MM-DD by default.
+	DateFormat string `bson:"date_format" json:"date_format"`
+	// DecimalComma reads 1.234,56 rather than 1,234.56.
+	DecimalComma bool       `bson:"decimal_comma,omitempty" json:"decimal_comma,omitempty"`
+	AmountSign   AmountSign `bson:"amount_sign" json:"amount_sign"`
+	// Columns maps the fields to the header of their column, or to its
+	// number with NoHeader.
+	Columns   map[string]string `bson:"columns" json:"columns"`
+	UpdatedAt time.Time         `bson:"updated_at" json:"updated_at"`
+}
+
+// Normalize fills the defaults and validates the profile.
+func (p *Profile) Normalize() error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.SourceName = strings.TrimSpace(p.SourceName)
+	p.Currency = strings.ToUpper(strings.TrimSpace(p.Currency))
+	if p.Name == "" {
+		p.Name = p.SourceName
+	}
+	if p.SourceType == 0 {
+		p.SourceType = statements.BankAccount
+	}
+	if p.Delimiter == "" {
+		p.Delimiter = ","
+	}
+	if p.DateFormat == "" {
+		p.DateFormat = "YYYY-MM-DD"
+	}
+	if p.AmountSign == "" {
+		p.AmountSign = DebitNegative
+	}
+
+	columns := make(map[string]string, len(p.Columns))
+	for field, column := range p.Columns {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if column = strings.TrimSpace(column); column == "" {
+			continue
+		}
+		if !validField(field) {
+			return fmt.Errorf("%w: unknown field %q, expected one of %s", ErrInvalidProfile, field, strings.Join(fields, ", "))
+		}
+		columns[field] = column
+	}
+	p.Columns = columns
+
+	switch {
+	case p.SourceName == "":
+		return fmt.Errorf("%w: missing source_name", ErrInvalidProfile)
+	case p.SourceType != statements.CreditCard && p.SourceType != statements.BankAccount:
+		return fmt.Errorf("%w: unknown source_type %d", ErrInvalidProfile, p.SourceType)
+	case p.Currency == "":
+		return fmt.Errorf("%w: missing currency", ErrInvalidProfile)
+	case utf8.RuneCountInString(p.Delimiter) != 1 || p.Delimiter == "\"" || p.Delimiter == "\n":
+		return fmt.Errorf("%w: delimiter must be a single character", ErrInvalidProfile)
+	case p.SkipRows < 0:
+		return fmt.Errorf("%w: skip_rows must not be negative", ErrInvalidProfile)
+	case p.AmountSign != DebitNegative && p.AmountSign != DebitPositive:
+		return fmt.Errorf("%w: amount_sign %q, expected debit_negative or debit_positive", ErrInvalidProfile, p.AmountSign)
+	case columns[FieldDate] == "" || columns[FieldDescription] == "":
+		return fmt.Errorf("%w: the date and description columns are required", ErrInvalidProfile)
+	case columns[FieldAmount] == "" && columns[FieldDebit] == "" && columns[FieldCredit] == "":
+		return fmt.Errorf("%w: map the amount column, or the debit and credit ones", ErrInvalidProfile)
+	case columns[FieldAmount] != "" && (columns[FieldDebit] != "" || columns[FieldCredit] != ""):
+		return fmt.Errorf("%w: map either the amount column or the debit and credit ones", ErrInvalidProfile)
+	}
+	if !strings.Contains(p.DateFormat, "Y") || !strings.Contains(p.DateFormat, "M") || !strings.Contains(p.DateFormat, "D") {
+		return fmt.Errorf("%w: date_format %q needs a year, a month and a day", ErrInvalidProfile, p.DateFormat)
+	}
+	return nil
+}
+
+func validField(field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+var dateTokens = strings.NewReplacer(
+	"YYYY", "2006", "YY", "06",
+	"MM", "01", "M", "1",
+	"DD", "02", "D", "2",
+	"HH", "15", "mm", "04", "ss", "05",
+)
+
+// layout converts the date format into a time layout.
+func (p *Profile) layout() string {
+	return dateTokens.Replace(p.DateFormat)
+}
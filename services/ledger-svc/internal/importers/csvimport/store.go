@@ -0,0 +1,95 @@
+package csvimport
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Store keeps the import profiles.
+type Store interface {
+	List(ctx context.Context) ([]Profile, error)
+	// Get returns nil when the profile does not exist.
+	Get(ctx context.Context, id string) (*Profile, error)
+	// Save creates or replaces the profile by ID.
+	Save(ctx context.Context, profile *Profile) error
+	// Delete returns ErrNotFound when the profile does not exist.
+	Delete(ctx context.Context, id string) error
+}
+
+// NewStore keeps the profiles next to the statements in MongoDB, or in memory
+// for the memory driver.
+func NewStore(repo statements.StatementRepository) Store {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryStore()
+}
+
+type MemoryStore struct {
+	mu       sync.RWMutex
+	profiles map[string]Profile
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{profiles: make(map[string]Profile)}
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Profile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Profile, 0, len(s.profiles))
+	for _, p := range s.profiles {
+		if statements.Owns(ctx, p.TenantID, p.UserID) {
+			list = append(list, p)
+		}
+	}
+	sortProfiles(list)
+	return list, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Profile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.profiles[id]
+	if !ok || !statements.Owns(ctx, p.TenantID, p.UserID) {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, profile *Profile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.profiles[profile.ID]; ok && !statements.Owns(ctx, existing.TenantID, existing.UserID) {
+		return statements.ErrNotOwned
+	}
+	profile.TenantID, profile.UserID = statements.Stamp(ctx, profile.TenantID, profile.UserID)
+	s.profiles[profile.ID] = *profile
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, ok := s.profiles[id]; !ok || !statements.Owns(ctx, p.TenantID, p.UserID) {
+		return ErrNotFound
+	}
+	delete(s.profiles, id)
+	return nil
+}
+
+func sortProfiles(list []Profile) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].ID < list[j].ID
+	})
+}
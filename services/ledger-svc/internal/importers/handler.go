@@ -0,0 +1,103 @@
+package importers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// maxFileSize caps an upload; a year of transactions is well below it.
+const maxFileSize = 10 << 20
+
+type Handler struct {
+	Service *statements.StatementService
+}
+
+// Imported reports one statement of an imported file.
+type Imported struct {
+	StatementID  string  `json:"statement_id"`
+	SourceName   string  `json:"source_name"`
+	Transactions int     `json:"transactions"`
+	TotalAmount  float64 `json:"total_amount"`
+	Queued       bool    `json:"queued,omitempty"`
+}
+
+// ImportHandler serves POST /api/import/{format} with a statement file as the
+// body, e.g. /api/import/ofx, and ?source_name=, ?currency= and
+// ?day_first=true as Options. Every statement in the file is saved with its
+// transactions; it answers 201 with them, 202 when they were queued for an
+// unavailable database.
+func (h *Handler) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.PathValue("format")
+	importer, ok := lookup(format)
+	if !ok {
+		apierror.Reply(w, fmt.Sprintf("Unknown import format %q, expected one of %s", format, strings.Join(Formats(), ", ")), http.StatusNotFound)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxFileSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		apierror.Reply(w, fmt.Sprintf("File exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		apierror.Reply(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := Options{
+		SourceName: strings.TrimSpace(query.Get("source_name")),
+		Currency:   strings.ToUpper(strings.TrimSpace(query.Get("currency"))),
+		DayFirst:   query.Get("day_first") == "true",
+	}
+	list, err := importer.Import(data, opts)
+	if err != nil {
+		apierror.Reply(w, fmt.Sprintf("Invalid %s file: %v", format, err), http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusCreated
+	imported := make([]Imported, 0, len(list))
+	for _, stmt := range list {
+		err := h.Service.SaveStatementWithTransactions(r.Context(), stmt)
+		queued := errors.Is(err, statements.ErrQueued)
+		switch {
+		case queued:
+			status = http.StatusAccepted
+		case errors.Is(err, statements.ErrClientEncryption):
+			apierror.Write(w, err)
+			return
+		case err != nil:
+			accesslog.Logger(r.Context()).Error("Failed to save imported statement", "format", format, "id", stmt.ID, "tx_count", len(*stmt.Transactions), "error", err)
+			apierror.Reply(w, "Failed to save statement", http.StatusInternalServerError)
+			return
+		}
+		imported = append(imported, Imported{
+			StatementID:  stmt.ID,
+			SourceName:   stmt.SourceName,
+			Transactions: len(*stmt.Transactions),
+			TotalAmount:  stmt.TotalAmount,
+			Queued:       queued,
+		})
+	}
+	accesslog.Logger(r.Context()).Info("Statement file imported", "format", format, "statements", len(imported))
+	writeJSON(w, status, imported)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Package importers turns the statement files banks export into ledger
+// statements. Every format lives in a subpackage that registers its Importer
+// from an init function, so POST /api/import/{format} serves it once the
+// package is imported; csvimport, which needs a profile, has its own endpoint.
+package importers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Options are what the uploader knows that the file may not say.
+type Options struct {
+	// SourceName names the source of the statements, overriding the
+	// institution the file names.
+	SourceName string
+	// Currency is the currency of formats that do not state one, like QIF.
+	Currency string
+	// DayFirst reads ambiguous dates like 02/01/2025 as 2 January.
+	DayFirst bool
+}
+
+// Importer converts the files of one format.
+type Importer interface {
+	// Import returns the statements of the file with their transactions,
+	// signed as the ledger signs them. Any error means the file is invalid.
+	Import(data []byte, opts Options) ([]*statements.Statement, error)
+}
+
+var (
+	importersMu sync.RWMutex
+	importers   = make(map[string]Importer)
+)
+
+// Register makes an importer serve the format. It panics when the format is
+// already taken, like statements.RegisterDriver.
+func Register(format string, importer Importer) {
+	importersMu.Lock()
+	defer importersMu.Unlock()
+
+	if importer == nil {
+		panic("importers: Register importer is nil")
+	}
+	if _, dup := importers[format]; dup {
+		panic("importers: Register called twice for format " + format)
+	}
+	importers[format] = importer
+}
+
+// Formats returns the registered formats.
+func Formats() []string {
+	importersMu.RLock()
+	defer importersMu.RUnlock()
+
+	formats := make([]string, 0, len(importers))
+	for format := range importers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func lookup(format string) (Importer, bool) {
+	importersMu.RLock()
+	defer importersMu.RUnlock()
+
+	importer, ok := importers[strings.ToLower(format)]
+	return importer, ok
+}
+
+// StableID derives a transaction ID from fields that identify the transaction
+// in every file listing it, e.g. the account and the bank's reference.
+func StableID(prefix string, fields ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(fields, "|")))
+	return prefix + "_" + hex.EncodeToString(sum[:12])
+}
+
+// IDs numbers the transactions of formats without references: identical
+// transactions, e.g. two coffees on the same day, are told apart by the order
+// the file lists them in.
+type IDs struct {
+	prefix string
+	scope  []string
+	seen   map[string]int
+}
+
+// NewIDs derives the IDs of one account or source, the scope.
+func NewIDs(prefix string, scope ...string) *IDs {
+	return &IDs{prefix: prefix, scope: scope, seen: map[string]int{}}
+}
+
+// Next returns the ID of the next transaction reporting the fields.
+func (ids *IDs) Next(fields ...string) string {
+	key := strings.Join(fields, "|")
+	n := ids.seen[key]
+	ids.seen[key]++
+	parts := append(append(append([]string{}, ids.scope...), fields...), fmt.Sprint(n))
+	return StableID(ids.prefix, parts...)
+}
+
+// Decode converts a file that is not UTF-8 from Windows-1252, the encoding
+// of most legacy exports, and drops a byte order mark.
+func Decode(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	decoded, err := charmap.Windows1252.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+	return string(decoded)
+}
+
+// RoundCents rounds an amount to two decimals.
+func RoundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,332 @@
+// Package mt940 reads SWIFT MT940 customer statements, the format most
+// European banks offer next to CAMT.053. Importing it registers the mt940
+// importer.
+package mt940
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/importers"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+func init() {
+	importers.Register("mt940", Importer{})
+	importers.Register("sta", Importer{})
+}
+
+// Balance is an opening (:60F:) or closing (:62F:) balance, negative when
+// the account is in debit.
+type Balance struct {
+	Date     time.Time
+	Currency string
+	Amount   float64
+}
+
+// Statement is one message, from :20: to the closing "-".
+type Statement struct {
+	Reference string
+	Account   string
+	Number    string
+	Opening   *Balance
+	Closing   *Balance
+	Entries   []Entry
+}
+
+// Entry is a :61: statement line with the :86: information after it.
+type Entry struct {
+	ValueDate time.Time
+	EntryDate time.Time
+	// Amount is negative for debits, reversals included.
+	Amount            float64
+	Type              string
+	CustomerReference string
+	BankReference     string
+	Details           string
+}
+
+var fieldTag = regexp.MustCompile(`^:(\d{2}[A-Z]?):`)
+
+// Parse reads the statements of a file. The SWIFT block headers some banks
+// keep ({1:...}{4:) are skipped.
+func Parse(data []byte) ([]Statement, error) {
+	var list []Statement
+	var current *Statement
+	var tag, value string
+
+	apply := func() error {
+		if tag == "" {
+			return nil
+		}
+		defer func() { tag, value = "", "" }()
+		if tag == "20" {
+			list = append(list, Statement{Reference: strings.TrimSpace(value)})
+			current = &list[len(list)-1]
+			return nil
+		}
+		if current == nil {
+			return fmt.Errorf("field :%s: before the :20: of a statement", tag)
+		}
+		return current.apply(tag, value)
+	}
+
+	for _, line := range strings.Split(importers.Decode(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "-" || trimmed == "-}" || strings.HasPrefix(trimmed, "{"):
+			if err := apply(); err != nil {
+				return nil, err
+			}
+		case fieldTag.MatchString(line):
+			if err := apply(); err != nil {
+				return nil, err
+			}
+			m := fieldTag.FindStringSubmatch(line)
+			tag, value = m[1], line[len(m[0]):]
+		case tag != "":
+			value += "\n" + line
+		}
+	}
+	if err := apply(); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.New("no MT940 statement (:20:) in the file")
+	}
+	return list, nil
+}
+
+func (s *Statement) apply(tag, value string) error {
+	var err error
+	switch tag {
+	case "25":
+		s.Account = strings.TrimSpace(value)
+	case "28", "28C":
+		s.Number = strings.TrimSpace(value)
+	case "60F", "60M":
+		if s.Opening == nil {
+			s.Opening, err = parseBalance(value)
+		}
+	case "62F", "62M":
+		s.Closing, err = parseBalance(value)
+	case "61":
+		var entry *Entry
+		if entry, err = parseEntry(value); err == nil {
+			s.Entries = append(s.Entries, *entry)
+		}
+	case "86":
+		if len(s.Entries) > 0 {
+			s.Entries[len(s.Entries)-1].Details = parseDetails(value)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf(":%s: %w", tag, err)
+	}
+	return nil
+}
+
+// parseBalance reads C250131EUR1234,56.
+func parseBalance(value string) (*Balance, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < 11 {
+		return nil, fmt.Errorf("invalid balance %q", value)
+	}
+	date, err := time.Parse("060102", value[1:7])
+	if err != nil {
+		return nil, fmt.Errorf("invalid balance date %q", value[1:7])
+	}
+	amount, err := parseAmount(value[10:])
+	if err != nil {
+		return nil, err
+	}
+	switch value[0] {
+	case 'C':
+	case 'D':
+		amount = -amount
+	default:
+		return nil, fmt.Errorf("invalid balance mark %q", value[:1])
+	}
+	return &Balance{Date: date, Currency: value[7:10], Amount: amount}, nil
+}
+
+// entryLine is the :61: layout: value date, optional entry date, mark
+// (C, D, RC, RD), optional funds code, amount, type, customer reference and
+// optional bank reference, with supplementary details on the next line.
+var entryLine = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d+,\d{0,2})([NSF][A-Z0-9]{3})([^\n]*?)(?://([^\n]*))?(?:\n([^\n]*))?$`)
+
+func parseEntry(value string) (*Entry, error) {
+	value = strings.TrimSpace(value)
+	m := entryLine.FindStringSubmatch(value)
+	if m == nil {
+		return nil, fmt.Errorf("invalid statement line %q", firstLine(value))
+	}
+	valueDate, err := time.Parse("060102", m[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid value date %q", m[1])
+	}
+	entry := &Entry{
+		ValueDate:         valueDate,
+		EntryDate:         valueDate,
+		Type:              m[6],
+		CustomerReference: strings.TrimSpace(m[7]),
+		BankReference:     strings.TrimSpace(m[8]),
+	}
+	if m[2] != "" {
+		// the entry date has no year: the value date's, or the next or
+		// previous one around the turn of the year
+		entryDate, err := time.Parse("0102", m[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry date %q", m[2])
+		}
+		entry.EntryDate = time.Date(valueDate.Year(), entryDate.Month(), entryDate.Day(), 0, 0, 0, 0, time.UTC)
+		if diff := entry.EntryDate.Sub(valueDate); diff > 180*24*time.Hour {
+			entry.EntryDate = entry.EntryDate.AddDate(-1, 0, 0)
+		} else if diff < -180*24*time.Hour {
+			entry.EntryDate = entry.EntryDate.AddDate(1, 0, 0)
+		}
+	}
+	if entry.Amount, err = parseAmount(m[5]); err != nil {
+		return nil, err
+	}
+	// a reversed credit takes money out, a reversed debit gives it back
+	if m[3] == "D" || m[3] == "RC" {
+		entry.Amount = -entry.Amount
+	}
+	if entry.CustomerReference == "NONREF" {
+		entry.CustomerReference = ""
+	}
+	return entry, nil
+}
+
+// parseDetails joins the lines of :86:. In the structured layout German banks
+// use (?20 to ?29 purpose, ?32 and ?33 counterparty) it keeps the
+// counterparty and the purpose.
+func parseDetails(value string) string {
+	value = strings.ReplaceAll(value, "\n", "")
+	if !strings.Contains(value, "?20") && !strings.Contains(value, "?32") {
+		return strings.Join(strings.Fields(value), " ")
+	}
+
+	var name, purpose []string
+	for _, field := range strings.Split(value, "?")[1:] {
+		if len(field) < 2 {
+			continue
+		}
+		code, text := field[:2], strings.TrimSpace(field[2:])
+		switch {
+		case code >= "20" && code <= "29", code >= "60" && code <= "63":
+			purpose = append(purpose, text)
+		case code == "32" || code == "33":
+			name = append(name, text)
+		}
+	}
+	return strings.Join(strings.Fields(strings.Join(append(name, purpose...), " ")), " ")
+}
+
+// parseAmount reads the amounts of the format, with a decimal comma.
+func parseAmount(s string) (float64, error) {
+	amount, err := money.ParseLocale(s, money.Comma)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return amount, nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// Importer imports the statements of an MT940 file as bank statements of
+// opts.SourceName, which the format does not carry.
+type Importer struct{}
+
+func (Importer) Import(data []byte, opts importers.Options) ([]*statements.Statement, error) {
+	if opts.SourceName == "" {
+		return nil, errors.New("MT940 files do not name their institution, pass source_name")
+	}
+	parsed, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*statements.Statement, 0, len(parsed))
+	for i := range parsed {
+		stmt, err := parsed[i].ledger(opts)
+		if err != nil {
+			return nil, fmt.Errorf("statement %s: %w", parsed[i].Reference, err)
+		}
+		list = append(list, stmt)
+	}
+	return list, nil
+}
+
+// ledger converts the statement, identified by the account and the date of
+// its closing balance. Bank references are not unique across banks, so the
+// transaction IDs come from the entry itself.
+func (s *Statement) ledger(opts importers.Options) (*statements.Statement, error) {
+	currency := opts.Currency
+	var end time.Time
+	if s.Closing != nil {
+		currency, end = s.Closing.Currency, s.Closing.Date
+	} else if s.Opening != nil {
+		currency = s.Opening.Currency
+	}
+	for _, e := range s.Entries {
+		if e.EntryDate.After(end) {
+			end = e.EntryDate
+		}
+	}
+	switch {
+	case s.Account == "":
+		return nil, errors.New("no account (:25:)")
+	case currency == "":
+		return nil, errors.New("no balance to take the currency from, pass currency")
+	case end.IsZero():
+		return nil, errors.New("no closing balance or entries")
+	}
+
+	ids := importers.NewIDs("mt940", s.Account)
+	transactions := make([]statements.Transaction, 0, len(s.Entries))
+	total := 0.0
+	for _, e := range s.Entries {
+		// the ledger counts money leaving the account as positive
+		amount := importers.RoundCents(-e.Amount)
+		description := e.Details
+		if description == "" {
+			description = e.CustomerReference
+		}
+		tx := statements.Transaction{
+			ID:          ids.Next(e.ValueDate.Format(time.DateOnly), fmt.Sprintf("%.2f", amount), e.CustomerReference, e.BankReference, description),
+			Description: description,
+			Amount:      amount,
+			Date:        e.EntryDate,
+			Extra:       map[string]any{"swift_type": e.Type},
+		}
+		if e.CustomerReference != "" {
+			tx.ExternalRefs = append(tx.ExternalRefs, statements.ExternalRef{Type: "customer_reference", Value: e.CustomerReference})
+		}
+		if e.BankReference != "" {
+			tx.ExternalRefs = append(tx.ExternalRefs, statements.ExternalRef{Type: "bank_reference", Value: e.BankReference})
+		}
+		transactions = append(transactions, tx)
+		total += amount
+	}
+
+	// :25: is usually bank code/account number; keep the ID one path segment
+	sourceID := strings.ReplaceAll(s.Account, "/", "-") + "_" + end.Format("20060102")
+	return &statements.Statement{
+		Type:         statements.BankStatement,
+		SourceType:   statements.BankAccount,
+		SourceName:   opts.SourceName,
+		SourceID:     &sourceID,
+		Currency:     currency,
+		TotalAmount:  importers.RoundCents(total),
+		Transactions: &transactions,
+	}, nil
+}
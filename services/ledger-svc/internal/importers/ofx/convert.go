@@ -0,0 +1,141 @@
+package ofx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/importers"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+func init() {
+	importers.Register("ofx", Importer{})
+	importers.Register("qfx", Importer{})
+}
+
+// Importer imports OFX and QFX files, one statement per account.
+type Importer struct{}
+
+// Import names the statements after opts.SourceName, or the institution the
+// file signs on as.
+func (Importer) Import(data []byte, opts importers.Options) ([]*statements.Statement, error) {
+	file, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	sourceName := opts.SourceName
+	if sourceName == "" {
+		sourceName = file.Org
+	}
+	if sourceName == "" {
+		return nil, errors.New("the file does not name its institution, pass source_name")
+	}
+
+	list := make([]*statements.Statement, len(file.Statements))
+	for i := range file.Statements {
+		if file.Statements[i].Currency == "" {
+			file.Statements[i].Currency = opts.Currency
+		}
+		if list[i], err = file.Statements[i].Ledger(sourceName); err != nil {
+			return nil, fmt.Errorf("statement of account %s: %w", file.Statements[i].AccountID, err)
+		}
+	}
+	return list, nil
+}
+
+// FITIDRefType is the external reference type the FITID of every imported
+// transaction is kept under, see TransactionFilter.ExternalRef.
+const FITIDRefType = "fitid"
+
+// Ledger converts the statement of an account into a ledger statement of the
+// source. Its ID is derived from the account and the end of the statement
+// period, so importing the same download again updates it.
+func (s *Statement) Ledger(sourceName string) (*statements.Statement, error) {
+	if s.Currency == "" {
+		return nil, errors.New("statement without a currency (CURDEF)")
+	}
+	end := s.periodEnd()
+	if end.IsZero() {
+		return nil, errors.New("statement without a period end (DTEND) or balance date")
+	}
+	sourceID := s.AccountID + "_" + end.Format("20060102")
+
+	stmt := &statements.Statement{
+		Type:       statements.BankStatement,
+		SourceType: statements.BankAccount,
+		SourceName: sourceName,
+		SourceID:   &sourceID,
+		Currency:   s.Currency,
+	}
+	if s.Kind == KindCreditCard {
+		stmt.Type, stmt.SourceType = statements.CreditCardBill, statements.CreditCard
+	}
+
+	transactions := make([]statements.Transaction, 0, len(s.Transactions))
+	total := 0.0
+	for _, t := range s.Transactions {
+		tx := t.ledger(s.account())
+		transactions = append(transactions, tx)
+		total += tx.Amount
+	}
+	stmt.Transactions = &transactions
+
+	// the ledger counts money leaving the account as positive, OFX as negative
+	if s.Kind == KindCreditCard && s.LedgerBalance != nil {
+		stmt.TotalAmount = importers.RoundCents(-*s.LedgerBalance)
+	} else {
+		stmt.TotalAmount = importers.RoundCents(total)
+	}
+	return stmt, nil
+}
+
+// account identifies the account across downloads: FITIDs are only unique
+// within it.
+func (s *Statement) account() string {
+	return strings.Join([]string{string(s.Kind), s.BankID, s.AccountID}, "|")
+}
+
+func (t *Transaction) ledger(account string) statements.Transaction {
+	description := strings.Join(strings.Fields(t.Name), " ")
+	if description == "" {
+		description = strings.Join(strings.Fields(t.Memo), " ")
+	}
+
+	extra := map[string]any{}
+	if t.Type != "" {
+		extra["ofx_type"] = t.Type
+	}
+	if t.Memo != "" && t.Memo != t.Name {
+		extra["memo"] = t.Memo
+	}
+	if t.CheckNum != "" {
+		extra["check_number"] = t.CheckNum
+	}
+
+	tx := statements.Transaction{
+		ID:           importers.StableID("ofx", account, t.FITID),
+		Description:  description,
+		Currency:     t.Currency,
+		Amount:       importers.RoundCents(-t.Amount),
+		Date:         t.Posted,
+		ExternalRefs: []statements.ExternalRef{{Type: FITIDRefType, Value: t.FITID}},
+	}
+	if t.RefNum != "" {
+		tx.ExternalRefs = append(tx.ExternalRefs, statements.ExternalRef{Type: "ofx_refnum", Value: t.RefNum})
+	}
+	if len(extra) > 0 {
+		tx.Extra = extra
+	}
+	return tx
+}
+
+// periodEnd is the end of the statement period, the balance date when the
+// file lists no transactions.
+func (s *Statement) periodEnd() time.Time {
+	if s.End.IsZero() {
+		return s.BalanceDate
+	}
+	return s.End
+}
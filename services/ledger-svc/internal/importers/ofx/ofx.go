@@ -0,0 +1,323 @@
+// Package ofx reads the OFX and QFX files banks export, both the SGML of
+// OFX 1.x and the XML of OFX 2.x, and converts their statements into ledger
+// statements. Importing it registers the ofx and qfx importers.
+package ofx
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/importers"
+)
+
+var ErrNoStatements = apierror.New(apierror.KindInvalid, "no_statements", "no bank or credit card statement in the OFX file")
+
+// Kind tells bank account statements from credit card ones.
+type Kind string
+
+const (
+	KindBank       Kind = "bank"
+	KindCreditCard Kind = "credit_card"
+)
+
+// File is what a statement download holds: the institution and one statement
+// per account.
+type File struct {
+	// Org is the financial institution as it signs on, e.g. "Chase".
+	Org        string
+	Statements []Statement
+}
+
+// Statement is the STMTRS or CCSTMTRS of one account.
+type Statement struct {
+	Kind        Kind
+	Currency    string
+	BankID      string
+	AccountID   string
+	AccountType string
+	Start, End  time.Time
+	// LedgerBalance is the balance as OFX signs it: negative when the card
+	// holder owes the issuer or the bank account is overdrawn.
+	LedgerBalance *float64
+	BalanceDate   time.Time
+	Transactions  []Transaction
+}
+
+// Transaction is one STMTTRN. Amount is signed as OFX signs it, negative for
+// money leaving the account.
+type Transaction struct {
+	FITID    string
+	Type     string
+	Posted   time.Time
+	Amount   float64
+	Name     string
+	Memo     string
+	CheckNum string
+	RefNum   string
+	// Currency is the original currency of a foreign transaction.
+	Currency string
+}
+
+// node is an element of the OFX tree. Aggregates have children, elements
+// have a value.
+type node struct {
+	name     string
+	value    string
+	children []*node
+}
+
+func (n *node) child(name string) *node {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// find returns the first node below n at the path, e.g. "BANKACCTFROM/ACCTID".
+func (n *node) find(path string) *node {
+	cur := n
+	for name := range strings.SplitSeq(path, "/") {
+		if cur = cur.child(name); cur == nil {
+			return nil
+		}
+	}
+	return cur
+}
+
+func (n *node) text(path string) string {
+	if c := n.find(path); c != nil {
+		return c.value
+	}
+	return ""
+}
+
+// all returns every node named name below n, at any depth.
+func (n *node) all(name string) []*node {
+	var found []*node
+	for _, c := range n.children {
+		if c.name == name {
+			found = append(found, c)
+			continue
+		}
+		found = append(found, c.all(name)...)
+	}
+	return found
+}
+
+// Parse reads an OFX or QFX file.
+func Parse(data []byte) (*File, error) {
+	root, err := parseTree(importers.Decode(data))
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{Org: root.text("SIGNONMSGSRSV1/SONRS/FI/ORG")}
+	for _, rs := range root.all("STMTRS") {
+		stmt, err := parseStatement(rs, KindBank, "BANKACCTFROM")
+		if err != nil {
+			return nil, err
+		}
+		file.Statements = append(file.Statements, *stmt)
+	}
+	for _, rs := range root.all("CCSTMTRS") {
+		stmt, err := parseStatement(rs, KindCreditCard, "CCACCTFROM")
+		if err != nil {
+			return nil, err
+		}
+		file.Statements = append(file.Statements, *stmt)
+	}
+	if len(file.Statements) == 0 {
+		return nil, ErrNoStatements
+	}
+	return file, nil
+}
+
+func parseStatement(rs *node, kind Kind, accountAggregate string) (*Statement, error) {
+	stmt := &Statement{
+		Kind:        kind,
+		Currency:    strings.ToUpper(rs.text("CURDEF")),
+		BankID:      rs.text(accountAggregate + "/BANKID"),
+		AccountID:   rs.text(accountAggregate + "/ACCTID"),
+		AccountType: rs.text(accountAggregate + "/ACCTTYPE"),
+	}
+	if stmt.AccountID == "" {
+		return nil, fmt.Errorf("%s statement without an account ID", kind)
+	}
+
+	var err error
+	if list := rs.child("BANKTRANLIST"); list != nil {
+		if stmt.Start, err = parseDate(list.text("DTSTART")); err != nil {
+			return nil, fmt.Errorf("invalid DTSTART: %w", err)
+		}
+		if stmt.End, err = parseDate(list.text("DTEND")); err != nil {
+			return nil, fmt.Errorf("invalid DTEND: %w", err)
+		}
+		for _, trn := range list.all("STMTTRN") {
+			tx, err := parseTransaction(trn)
+			if err != nil {
+				return nil, err
+			}
+			stmt.Transactions = append(stmt.Transactions, *tx)
+		}
+	}
+	if bal := rs.child("LEDGERBAL"); bal != nil {
+		amount, err := parseAmount(bal.text("BALAMT"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid LEDGERBAL: %w", err)
+		}
+		stmt.LedgerBalance = &amount
+		if stmt.BalanceDate, err = parseDate(bal.text("DTASOF")); err != nil {
+			return nil, fmt.Errorf("invalid LEDGERBAL date: %w", err)
+		}
+	}
+	return stmt, nil
+}
+
+func parseTransaction(trn *node) (*Transaction, error) {
+	tx := &Transaction{
+		FITID:    trn.text("FITID"),
+		Type:     strings.ToUpper(trn.text("TRNTYPE")),
+		Name:     trn.text("NAME"),
+		Memo:     trn.text("MEMO"),
+		CheckNum: trn.text("CHECKNUM"),
+		RefNum:   trn.text("REFNUM"),
+		Currency: strings.ToUpper(trn.text("ORIGCURRENCY/CURSYM")),
+	}
+	if tx.FITID == "" {
+		return nil, errors.New("transaction without a FITID")
+	}
+	var err error
+	if tx.Amount, err = parseAmount(trn.text("TRNAMT")); err != nil {
+		return nil, fmt.Errorf("transaction %s: invalid TRNAMT: %w", tx.FITID, err)
+	}
+	if tx.Posted, err = parseDate(trn.text("DTPOSTED")); err != nil {
+		return nil, fmt.Errorf("transaction %s: invalid DTPOSTED: %w", tx.FITID, err)
+	}
+	if tx.Name == "" && trn.child("PAYEE") != nil {
+		tx.Name = trn.text("PAYEE/NAME")
+	}
+	return tx, nil
+}
+
+// parseTree reads the tags after the headers. OFX 1.x is SGML and leaves the
+// elements unclosed, so a tag followed by text is an element whatever follows
+// it, and any other tag opens an aggregate.
+func parseTree(data string) (*node, error) {
+	start := strings.Index(strings.ToUpper(data), "<OFX>")
+	if start < 0 {
+		return nil, errors.New("not an OFX file: no <OFX> element")
+	}
+	data = data[start:]
+
+	root := &node{}
+	stack := []*node{root}
+	for len(data) > 0 {
+		open := strings.IndexByte(data, '<')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(data[open:], '>')
+		if end < 0 {
+			return nil, errors.New("unterminated tag")
+		}
+		tag := strings.TrimSpace(data[open+1 : open+end])
+		data = data[open+end+1:]
+
+		if name, closing := strings.CutPrefix(tag, "/"); closing {
+			name = strings.ToUpper(name)
+			// the closing tag of an element, or of an aggregate that may have
+			// unclosed aggregates left open inside it
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].name == name {
+					stack = stack[:i]
+					break
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!") {
+			continue
+		}
+
+		n := &node{name: strings.ToUpper(strings.TrimSuffix(tag, "/"))}
+		parent := stack[len(stack)-1]
+		parent.children = append(parent.children, n)
+
+		next := strings.IndexByte(data, '<')
+		if next < 0 {
+			next = len(data)
+		}
+		if value := strings.TrimSpace(data[:next]); value != "" {
+			n.value = html.UnescapeString(value)
+			data = data[next:]
+			continue
+		}
+		if !strings.HasSuffix(tag, "/") {
+			stack = append(stack, n)
+		}
+	}
+	if len(root.children) == 0 {
+		return nil, errors.New("not an OFX file: empty <OFX> element")
+	}
+	return root.children[0], nil
+}
+
+// parseDate reads an OFX datetime, YYYYMMDD[HHMMSS[.XXX]][[offset[:TZ]]],
+// in GMT unless the offset says otherwise.
+func parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	loc := time.UTC
+	if open := strings.IndexByte(s, '['); open >= 0 {
+		zone := strings.TrimSuffix(s[open+1:], "]")
+		s = s[:open]
+		offset, name, _ := strings.Cut(zone, ":")
+		hours, err := strconv.ParseFloat(offset, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time zone %q", zone)
+		}
+		if name == "" {
+			name = offset
+		}
+		loc = time.FixedZone(name, int(hours*3600))
+	}
+	if dot := strings.IndexByte(s, '.'); dot >= 0 {
+		s = s[:dot]
+	}
+
+	var layout string
+	switch len(s) {
+	case 8:
+		layout = "20060102"
+	case 12:
+		layout = "200601021504"
+	case 14:
+		layout = "20060102150405"
+	default:
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+	t, err := time.ParseInLocation(layout, s, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+	return t.UTC(), nil
+}
+
+// parseAmount reads an OFX amount, which some banks write with a decimal
+// comma.
+func parseAmount(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, ".") {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	return strconv.ParseFloat(strings.TrimPrefix(s, "+"), 64)
+}
@@ -0,0 +1,290 @@
+// Package qif reads the QIF files of Quicken and the tools that still export
+// it. Importing it registers the qif importer.
+package qif
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/importers"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+func init() {
+	importers.Register("qif", Importer{})
+}
+
+// Transaction is one record of a bank, cash or card account list.
+type Transaction struct {
+	Date     time.Time
+	Amount   float64
+	Payee    string
+	Memo     string
+	Category string
+	// Transfer is the account of a [transfer] category.
+	Transfer string
+	Number   string
+}
+
+// Account is a list of transactions under one !Type header, named by the
+// !Account block before it when there is one.
+type Account struct {
+	Name         string
+	Type         string
+	Transactions []Transaction
+}
+
+// Parse reads the bank, cash, card and other asset and liability lists of a
+// file. Investment lists and the category, class and memorized lists are
+// skipped.
+func Parse(data []byte, dayFirst bool) ([]Account, error) {
+	var accounts []Account
+	var current *Account
+	var record map[byte][]string
+	accountName, inAccountBlock, skipping := "", false, true
+
+	flush := func(line int) error {
+		if len(record) == 0 || current == nil {
+			record = nil
+			return nil
+		}
+		tx, err := transaction(record, dayFirst)
+		record = nil
+		if err != nil {
+			return fmt.Errorf("record ending on line %d: %w", line, err)
+		}
+		current.Transactions = append(current.Transactions, *tx)
+		return nil
+	}
+
+	for i, line := range strings.Split(importers.Decode(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "!"):
+			header := strings.ToLower(strings.TrimSpace(line))
+			switch {
+			case header == "!account":
+				inAccountBlock, skipping, current = true, true, nil
+			case strings.HasPrefix(header, "!type:"):
+				kind := strings.TrimSpace(line[len("!type:"):])
+				current, skipping = nil, true
+				if transactionList(kind) {
+					accounts = append(accounts, Account{Name: accountName, Type: kind})
+					current, skipping = &accounts[len(accounts)-1], false
+				}
+			default:
+				// !Option:AutoSwitch and the like
+				current, skipping = nil, true
+			}
+		case line[0] == '^':
+			if inAccountBlock {
+				inAccountBlock = false
+				continue
+			}
+			if err := flush(i + 1); err != nil {
+				return nil, err
+			}
+		case inAccountBlock:
+			if line[0] == 'N' {
+				accountName = strings.TrimSpace(line[1:])
+			}
+		case skipping:
+		default:
+			if record == nil {
+				record = map[byte][]string{}
+			}
+			record[line[0]] = append(record[line[0]], strings.TrimSpace(line[1:]))
+		}
+	}
+	// some exporters leave out the last ^
+	if err := flush(0); err != nil {
+		return nil, err
+	}
+
+	n := 0
+	for _, a := range accounts {
+		n += len(a.Transactions)
+	}
+	if n == 0 {
+		return nil, errors.New("no bank, cash or card transactions in the file")
+	}
+	return accounts, nil
+}
+
+// transactionList reports whether a !Type lists plain transactions.
+func transactionList(kind string) bool {
+	switch strings.ToLower(kind) {
+	case "bank", "cash", "ccard", "oth a", "oth l":
+		return true
+	}
+	return false
+}
+
+func transaction(record map[byte][]string, dayFirst bool) (*Transaction, error) {
+	field := func(code byte) string {
+		if values := record[code]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	date, err := parseDate(field('D'), dayFirst)
+	if err != nil {
+		return nil, err
+	}
+	amountField := field('T')
+	if amountField == "" {
+		amountField = field('U')
+	}
+	// Quicken writes the amounts in the locale of the computer
+	amount, err := money.Parse(amountField)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q", amountField)
+	}
+
+	tx := &Transaction{Date: date, Amount: amount, Payee: field('P'), Memo: field('M'), Number: field('N')}
+	if category := field('L'); strings.HasPrefix(category, "[") && strings.HasSuffix(category, "]") {
+		tx.Transfer = strings.Trim(category, "[]")
+	} else {
+		tx.Category = category
+	}
+	return tx, nil
+}
+
+// parseDate reads the dates Quicken writes, month first unless dayFirst:
+// 1/15/2025, 1/15'25, 01-15-2025, and the unambiguous 2025-01-15.
+func parseDate(s string, dayFirst bool) (time.Time, error) {
+	original := s
+	s = strings.ReplaceAll(strings.TrimSpace(s), " ", "")
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	parts := strings.FieldsFunc(s, func(r rune) bool { return r == '/' || r == '-' || r == '.' || r == '\'' })
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("invalid date %q", original)
+	}
+	n := make([]int, 3)
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q", original)
+		}
+		n[i] = v
+	}
+	month, day, year := n[0], n[1], n[2]
+	if dayFirst {
+		month, day = day, month
+	}
+	if len(parts[2]) <= 2 {
+		// Quicken writes 2000 and later with an apostrophe, e.g. 1/15'25
+		year += 2000
+		if year > time.Now().Year()+1 {
+			year -= 100
+		}
+	}
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if t.Month() != time.Month(month) || t.Day() != day {
+		return time.Time{}, fmt.Errorf("invalid date %q", original)
+	}
+	return t, nil
+}
+
+// Importer imports the accounts of a QIF file, one statement each. QIF states
+// no currency, so opts.Currency is required, and names no institution, so
+// opts.SourceName is too.
+type Importer struct{}
+
+func (Importer) Import(data []byte, opts importers.Options) ([]*statements.Statement, error) {
+	if opts.SourceName == "" {
+		return nil, errors.New("QIF files do not name their institution, pass source_name")
+	}
+	if opts.Currency == "" {
+		return nil, errors.New("QIF files do not state a currency, pass currency")
+	}
+	accounts, err := Parse(data, opts.DayFirst)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*statements.Statement
+	for _, account := range accounts {
+		if len(account.Transactions) == 0 {
+			continue
+		}
+		list = append(list, account.ledger(opts))
+	}
+	return list, nil
+}
+
+// ledger converts the account, identified by its name and the dates of its
+// first and last transactions. QIF has no transaction references, so the IDs
+// come from the date, amount and payee.
+func (a *Account) ledger(opts importers.Options) *statements.Statement {
+	name := a.Name
+	if name == "" {
+		name = a.Type
+	}
+	ids := importers.NewIDs("qif", opts.SourceName, name)
+
+	transactions := make([]statements.Transaction, 0, len(a.Transactions))
+	first, last := a.Transactions[0].Date, a.Transactions[0].Date
+	total := 0.0
+	for _, t := range a.Transactions {
+		description := strings.Join(strings.Fields(t.Payee), " ")
+		if description == "" {
+			description = strings.Join(strings.Fields(t.Memo), " ")
+		}
+		// QIF signs money leaving the account negative, the ledger positive
+		amount := importers.RoundCents(-t.Amount)
+		tx := statements.Transaction{
+			ID:          ids.Next(t.Date.Format(time.DateOnly), fmt.Sprintf("%.2f", amount), strings.ToLower(description)),
+			Description: description,
+			Category:    t.Category,
+			Amount:      amount,
+			Date:        t.Date,
+		}
+		extra := map[string]any{}
+		if t.Memo != "" && t.Memo != t.Payee {
+			extra["memo"] = t.Memo
+		}
+		if t.Transfer != "" {
+			extra["transfer_account"] = t.Transfer
+		}
+		if t.Number != "" {
+			extra["check_number"] = t.Number
+		}
+		if len(extra) > 0 {
+			tx.Extra = extra
+		}
+		transactions = append(transactions, tx)
+		total += amount
+		if t.Date.Before(first) {
+			first = t.Date
+		}
+		if t.Date.After(last) {
+			last = t.Date
+		}
+	}
+
+	sourceID := fmt.Sprintf("%s_%s_%s", name, first.Format("20060102"), last.Format("20060102"))
+	stmt := &statements.Statement{
+		Type:         statements.BankStatement,
+		SourceType:   statements.BankAccount,
+		SourceName:   opts.SourceName,
+		SourceID:     &sourceID,
+		Currency:     opts.Currency,
+		TotalAmount:  importers.RoundCents(total),
+		Transactions: &transactions,
+	}
+	if strings.EqualFold(a.Type, "ccard") {
+		stmt.Type, stmt.SourceType = statements.CreditCardBill, statements.CreditCard
+	}
+	return stmt
+}
@@ -0,0 +1,64 @@
+package ingest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+const VersionHeader = "X-Ingest-Schema-Version"
+
+func SchemaHandler(w http.ResponseWriter, r *http.Request) {
+	var body any
+	if version := r.URL.Query().Get("version"); version != "" {
+		schemas, ok := Schemas[version]
+		if !ok {
+			apierror.Reply(w, "Unknown schema version", http.StatusNotFound)
+			return
+		}
+		body = map[string]any{"version": version, "schemas": schemas}
+	} else {
+		body = map[string]any{"latest": LatestVersion, "versions": Versions(), "schemas": Schemas[LatestVersion]}
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Header().Set(VersionHeader, LatestVersion)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to encode JSON response", "error", err)
+		apierror.Reply(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// RunsHandler lists the latest importer runs, ?source= narrows them to one
+// importer and ?limit= (default 20) caps the count.
+type RunsHandler struct {
+	Store RunStore
+}
+
+func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			apierror.Reply(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	runs, err := h.Store.List(r.Context(), r.URL.Query().Get("source"), limit)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list ingest runs", "error", err)
+		apierror.Reply(w, "Failed to list ingest runs", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(runs); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to encode JSON response", "error", err)
+	}
+}
@@ -0,0 +1,45 @@
+package ingest
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoRunStore keeps the runs in the <namespace>ingest_runs collection.
+type MongoRunStore struct {
+	col *mongo.Collection
+}
+
+func NewMongoRunStore(db *mongo.Database, namespace string) *MongoRunStore {
+	return &MongoRunStore{col: db.Collection(namespace + "ingest_runs")}
+}
+
+func (s *MongoRunStore) Save(ctx context.Context, run *Run) error {
+	_, err := s.col.ReplaceOne(ctx, bson.M{"_id": run.ID}, run, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoRunStore) List(ctx context.Context, source string, limit int) ([]Run, error) {
+	filter := bson.M{}
+	if source != "" {
+		filter["source"] = source
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cursor, err := s.col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	runs := []Run{}
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
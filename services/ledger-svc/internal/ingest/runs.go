@@ -0,0 +1,99 @@
+package ingest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Outcomes of a run item.
+const (
+	ItemImported = "imported"
+	ItemQueued   = "queued"
+	ItemFailed   = "failed"
+)
+
+// Run records one pass of an automated importer over its source, so failures
+// stay visible after the logs rotate.
+type Run struct {
+	ID         string    `bson:"_id" json:"id"`
+	Source     string    `bson:"source" json:"source"`
+	StartedAt  time.Time `bson:"started_at" json:"started_at"`
+	FinishedAt time.Time `bson:"finished_at" json:"finished_at"`
+	Imported   int       `bson:"imported" json:"imported"`
+	Failed     int       `bson:"failed" json:"failed"`
+	// Error is set when the run could not go through its source at all.
+	Error string    `bson:"error,omitempty" json:"error,omitempty"`
+	Items []RunItem `bson:"items" json:"items"`
+}
+
+type RunItem struct {
+	Name        string `bson:"name" json:"name"`
+	StatementID string `bson:"statement_id,omitempty" json:"statement_id,omitempty"`
+	Status      string `bson:"status" json:"status"`
+	Error       string `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+func NewRun(source string) *Run {
+	return &Run{ID: uuid.NewString(), Source: source, StartedAt: time.Now().UTC(), Items: []RunItem{}}
+}
+
+func (r *Run) Add(item RunItem) {
+	r.Items = append(r.Items, item)
+	if item.Status == ItemFailed {
+		r.Failed++
+	} else {
+		r.Imported++
+	}
+}
+
+// RunStore keeps the runs of every importer.
+type RunStore interface {
+	Save(ctx context.Context, run *Run) error
+	// List returns the latest runs first, of one source when source is set.
+	List(ctx context.Context, source string, limit int) ([]Run, error)
+}
+
+// MemoryRunStore keeps the last runs up to its size.
+type MemoryRunStore struct {
+	mu   sync.Mutex
+	size int
+	runs []Run
+}
+
+func NewMemoryRunStore(size int) *MemoryRunStore {
+	return &MemoryRunStore{size: size}
+}
+
+func (s *MemoryRunStore) Save(ctx context.Context, run *Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.runs = append(s.runs, *run)
+	if len(s.runs) > s.size {
+		s.runs = s.runs[len(s.runs)-s.size:]
+	}
+	return nil
+}
+
+func (s *MemoryRunStore) List(ctx context.Context, source string, limit int) ([]Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs := []Run{}
+	for _, run := range s.runs {
+		if source == "" || run.Source == source {
+			runs = append(runs, run)
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
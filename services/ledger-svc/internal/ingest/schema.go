@@ -0,0 +1,77 @@
+package ingest
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+const LatestVersion = "v1"
+
+//go:embed schemas/*.json
+var schemaFS embed.FS
+
+// Schemas maps version -> schema name -> parsed JSON Schema document.
+var Schemas = mustLoadSchemas()
+
+func mustLoadSchemas() map[string]map[string]map[string]any {
+	entries, err := schemaFS.ReadDir("schemas")
+	if err != nil {
+		panic(err)
+	}
+
+	result := map[string]map[string]map[string]any{}
+	for _, entry := range entries {
+		// file names follow <name>.<version>.json
+		parts := strings.Split(strings.TrimSuffix(entry.Name(), ".json"), ".")
+		if len(parts) != 2 {
+			panic(fmt.Sprintf("unexpected schema file name %q", entry.Name()))
+		}
+		name, version := parts[0], parts[1]
+
+		data, err := schemaFS.ReadFile(path.Join("schemas", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var schema map[string]any
+		if err := json.Unmarshal(data, &schema); err != nil {
+			panic(fmt.Sprintf("invalid schema %s: %v", entry.Name(), err))
+		}
+
+		if result[version] == nil {
+			result[version] = map[string]map[string]any{}
+		}
+		result[version][name] = schema
+	}
+	return result
+}
+
+func Versions() []string {
+	versions := make([]string, 0, len(Schemas))
+	for v := range Schemas {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// ValidatePayload checks a raw JSON payload against the named schema of the given
+// version (latest when empty) and returns one error per violation.
+func ValidatePayload(name, version string, payload []byte) ([]ValidationError, error) {
+	if version == "" {
+		version = LatestVersion
+	}
+	schema, ok := Schemas[version][name]
+	if !ok {
+		return nil, fmt.Errorf("unknown schema %s version %s", name, version)
+	}
+
+	var doc any
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return []ValidationError{{Path: "$", Message: "malformed JSON: " + err.Error()}}, nil
+	}
+	return validate(schema, doc, "$"), nil
+}
@@ -0,0 +1,174 @@
+package ingest
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+type ValidationError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// Validate checks a decoded JSON value against a schema, reporting paths below
+// at. The API specification shares it with the ingest schemas.
+func Validate(schema map[string]any, value any, at string) []ValidationError {
+	return validate(schema, value, at)
+}
+
+// validate implements the subset of JSON Schema used by the ingest schemas and
+// the API specification: type, enum, required, properties,
+// additionalProperties, items, minimum, exclusiveMinimum, maximum, minLength,
+// pattern and the date and date-time formats.
+func validate(schema map[string]any, value any, at string) []ValidationError {
+	var errs []ValidationError
+
+	if types := schemaTypes(schema); len(types) > 0 {
+		actual := jsonType(value)
+		if !typeAllowed(types, actual) {
+			return []ValidationError{{Path: at, Message: fmt.Sprintf("expected %s, got %s", strings.Join(types, " or "), actual)}}
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !inEnum(enum, value) {
+		errs = append(errs, ValidationError{Path: at, Message: fmt.Sprintf("value %v is not one of %v", value, enum)})
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		errs = append(errs, validateObject(schema, v, at)...)
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				errs = append(errs, validate(items, item, fmt.Sprintf("%s[%d]", at, i))...)
+			}
+		}
+	case float64:
+		if minimum, ok := schema["minimum"].(float64); ok && v < minimum {
+			errs = append(errs, ValidationError{Path: at, Message: fmt.Sprintf("must be >= %v", minimum)})
+		}
+		if minimum, ok := schema["exclusiveMinimum"].(float64); ok && v <= minimum {
+			errs = append(errs, ValidationError{Path: at, Message: fmt.Sprintf("must be > %v", minimum)})
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && v > maximum {
+			errs = append(errs, ValidationError{Path: at, Message: fmt.Sprintf("must be <= %v", maximum)})
+		}
+	case string:
+		if minLength, ok := schema["minLength"].(float64); ok && float64(len(v)) < minLength {
+			errs = append(errs, ValidationError{Path: at, Message: fmt.Sprintf("must be at least %v characters", minLength)})
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if matched, err := regexp.MatchString(pattern, v); err == nil && !matched {
+				errs = append(errs, ValidationError{Path: at, Message: "must match " + pattern})
+			}
+		}
+		switch schema["format"] {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				errs = append(errs, ValidationError{Path: at, Message: "must be an RFC 3339 date-time with timezone"})
+			}
+		case "date":
+			if _, err := time.Parse(time.DateOnly, v); err != nil {
+				errs = append(errs, ValidationError{Path: at, Message: "must be a date as YYYY-MM-DD"})
+			}
+		}
+	}
+
+	return errs
+}
+
+func validateObject(schema map[string]any, obj map[string]any, at string) []ValidationError {
+	var errs []ValidationError
+
+	if required, ok := schema["required"].([]any); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, present := obj[name]; !present {
+					errs = append(errs, ValidationError{Path: at + "." + name, Message: "is required"})
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		propSchema, known := properties[k].(map[string]any)
+		if !known {
+			if schema["additionalProperties"] == false {
+				errs = append(errs, ValidationError{Path: at + "." + k, Message: "unknown field"})
+			}
+			continue
+		}
+		errs = append(errs, validate(propSchema, obj[k], at+"."+k)...)
+	}
+	return errs
+}
+
+func schemaTypes(schema map[string]any) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		types := make([]string, 0, len(t))
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
+
+func typeAllowed(types []string, actual string) bool {
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func inEnum(enum []any, value any) bool {
+	for _, e := range enum {
+		if e == value {
+			return true
+		}
+	}
+	return false
+}
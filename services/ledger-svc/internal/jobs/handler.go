@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+type Handler struct {
+	Runner *Runner
+}
+
+// ListHandler serves GET /api/jobs, the status and schedule of the jobs.
+func (h *Handler) ListHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Runner.Statuses(r.Context())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list the jobs", "error", err)
+		apierror.Reply(w, "Failed to list the jobs", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// GetHandler serves GET /api/jobs/{name}.
+func (h *Handler) GetHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := h.Runner.Status(r.Context(), r.PathValue("name"))
+	if errors.Is(err, ErrUnknownJob) {
+		apierror.Reply(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to read the job", "job", r.PathValue("name"), "error", err)
+		apierror.Reply(w, "Failed to read the job", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// RunHandler serves POST /api/jobs/{name}/run, asking for a run now, taken
+// up by a worker replica within a minute. It answers 202 without waiting for
+// the run, whose outcome GET /api/jobs/{name} tells.
+func (h *Handler) RunHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	switch err := h.Runner.Trigger(r.Context(), name); {
+	case errors.Is(err, ErrUnknownJob):
+		apierror.Reply(w, "Job not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrRunning):
+		apierror.Reply(w, "Job already running", http.StatusConflict)
+		return
+	case err != nil:
+		accesslog.Logger(r.Context()).Error("Failed to trigger the job", "job", name, "error", err)
+		apierror.Reply(w, "Failed to trigger the job", http.StatusInternalServerError)
+		return
+	}
+	accesslog.Logger(r.Context()).Info("Job triggered", "job", name)
+	status, err := h.Runner.Status(r.Context(), name)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to read the job", "job", name, "error", err)
+		apierror.Reply(w, "Failed to read the job", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
@@ -0,0 +1,290 @@
+// Package jobs runs the periodic background work of the service, e.g. the
+// reminders and the archival, on a schedule and on demand. The status of the
+// runs is kept in a Store, which also keeps a job from running twice at once,
+// in this instance or in another replica sharing the database.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/lease"
+)
+
+// defaultTimeout bounds the runs of the jobs without a Timeout.
+const defaultTimeout = time.Hour
+
+// retryAfter is how long a job waits when its run was skipped, held by
+// another replica or the store unavailable.
+const retryAfter = time.Minute
+
+// recheck is how often a waiting job reads its status again, to see the runs
+// asked for on another replica.
+const recheck = time.Minute
+
+var (
+	ErrUnknownJob = errors.New("unknown job")
+	ErrRunning    = errors.New("job already running")
+)
+
+var runs = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "finchie_job_runs_total",
+	Help: "Runs of the background jobs, by job and result: success, failure or skipped.",
+}, []string{"job", "result"})
+
+// Job is a unit of background work.
+type Job struct {
+	Name        string
+	Description string
+	Schedule    Schedule
+	// Timeout bounds a run and is the lease other replicas wait for, an hour
+	// by default.
+	Timeout time.Duration
+	Run     func(ctx context.Context, now time.Time) error
+}
+
+type entry struct {
+	job     Job
+	running bool
+	// trigger queues a run on demand
+	trigger chan struct{}
+	next    time.Time
+}
+
+// Runner runs the jobs on their schedule. A job is due at the next time of
+// its schedule after its last start, whichever replica started it; a job
+// that never ran, or missed its time while the service was down, runs at
+// once.
+type Runner struct {
+	Store Store
+	// Instance names this replica in the status of the runs it holds.
+	Instance string
+	Now      func() time.Time
+
+	mu   sync.Mutex
+	jobs []*entry
+}
+
+func NewRunner(store Store) *Runner {
+	return &Runner{Store: store, Instance: lease.Instance(), Now: time.Now}
+}
+
+// Add registers the job. Jobs are added before Run.
+func (r *Runner) Add(job Job) {
+	if job.Timeout <= 0 {
+		job.Timeout = defaultTimeout
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs = append(r.jobs, &entry{job: job, trigger: make(chan struct{}, 1)})
+}
+
+// Run runs the jobs until ctx is done and their runs returned.
+func (r *Runner) Run(ctx context.Context) {
+	r.mu.Lock()
+	entries := r.jobs
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.loop(ctx, e)
+		}()
+	}
+	wg.Wait()
+}
+
+func (r *Runner) loop(ctx context.Context, e *entry) {
+	retry := time.Time{}
+	for {
+		due := r.due(ctx, e)
+		if due.Before(retry) {
+			due = retry
+		}
+		r.mu.Lock()
+		e.next = due
+		r.mu.Unlock()
+
+		timer := time.NewTimer(min(max(due.Sub(r.Now()), 0), recheck))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			if r.Now().Before(due) {
+				continue
+			}
+		case <-e.trigger:
+			timer.Stop()
+		}
+		retry = time.Time{}
+		if !r.run(ctx, e) {
+			retry = r.Now().Add(retryAfter)
+		}
+	}
+}
+
+// due returns when the job runs next, by its last start, now when a run was
+// asked for since.
+func (r *Runner) due(ctx context.Context, e *entry) time.Time {
+	status, err := r.Store.Get(ctx, e.job.Name)
+	if err != nil {
+		slog.Warn("Failed to read the job status", "job", e.job.Name, "error", err)
+		return r.Now().Add(retryAfter)
+	}
+	if status == nil || status.LastStart == nil ||
+		status.RequestedAt != nil && status.RequestedAt.After(*status.LastStart) {
+		return r.Now()
+	}
+	next := e.job.Schedule.Next(*status.LastStart)
+	if next.IsZero() {
+		// a schedule never due again, e.g. February 30
+		return r.Now().AddDate(100, 0, 0)
+	}
+	return next
+}
+
+// run runs the job unless it is running, reporting false when it was skipped
+// for another replica holding it or the store failing.
+func (r *Runner) run(ctx context.Context, e *entry) bool {
+	r.mu.Lock()
+	if e.running {
+		r.mu.Unlock()
+		return true
+	}
+	e.running = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		e.running = false
+		r.mu.Unlock()
+	}()
+
+	name := e.job.Name
+	// as precise as MongoDB keeps it, Finish matches the run by its start
+	start := r.Now().UTC().Truncate(time.Millisecond)
+	ok, err := r.Store.Start(ctx, name, r.Instance, start, start.Add(e.job.Timeout))
+	if err != nil {
+		slog.Warn("Failed to start the job", "job", name, "error", err)
+		runs.WithLabelValues(name, "skipped").Inc()
+		return false
+	}
+	if !ok {
+		slog.Info("Job running on another instance", "job", name)
+		runs.WithLabelValues(name, "skipped").Inc()
+		return false
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, e.job.Timeout)
+	err = call(runCtx, e.job, start)
+	cancel()
+	end := r.Now().UTC().Truncate(time.Millisecond)
+	if err != nil {
+		slog.Warn("Job failed", "job", name, "duration", end.Sub(start), "error", err)
+		runs.WithLabelValues(name, "failure").Inc()
+	} else {
+		slog.Info("Job completed", "job", name, "duration", end.Sub(start))
+		runs.WithLabelValues(name, "success").Inc()
+	}
+	if err := r.Store.Finish(context.WithoutCancel(ctx), name, r.Instance, start, end, err); err != nil {
+		slog.Warn("Failed to record the job run", "job", name, "error", err)
+	}
+	return true
+}
+
+// call runs the job, turning a panic into its error so it does not take the
+// runner down.
+func call(ctx context.Context, job Job, now time.Time) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	return job.Run(ctx, now)
+}
+
+// Trigger asks for a run of the job now, run by this instance when it runs
+// the jobs, else by the first worker replica to check. It fails with
+// ErrUnknownJob, or ErrRunning while a run is in progress.
+func (r *Runner) Trigger(ctx context.Context, name string) error {
+	status, err := r.Status(ctx, name)
+	if err != nil {
+		return err
+	}
+	if status.Running {
+		return ErrRunning
+	}
+	if err := r.Store.Request(ctx, name, r.Now().UTC().Truncate(time.Millisecond)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.jobs {
+		if e.job.Name == name {
+			select {
+			case e.trigger <- struct{}{}:
+			default:
+				// already queued
+			}
+		}
+	}
+	return nil
+}
+
+// Statuses returns the status of the jobs, in the order they were added.
+func (r *Runner) Statuses(ctx context.Context) ([]Status, error) {
+	stored, err := r.Store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]Status, len(stored))
+	for _, s := range stored {
+		byName[s.Name] = s
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.Now()
+	list := make([]Status, 0, len(r.jobs))
+	for _, e := range r.jobs {
+		s := byName[e.job.Name]
+		s.Name = e.job.Name
+		s.Description = e.job.Description
+		s.Schedule = e.job.Schedule.String()
+		// a run whose instance died holds the job until its lease expires
+		s.Running = e.running || s.held(now)
+		if !s.Running {
+			s.Instance = ""
+		}
+		if !e.next.IsZero() && !s.Running {
+			next := e.next.UTC()
+			s.NextRun = &next
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// Status returns the status of the job, ErrUnknownJob when it is not one.
+func (r *Runner) Status(ctx context.Context, name string) (*Status, error) {
+	list, err := r.Statuses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].Name == name {
+			return &list[i], nil
+		}
+	}
+	return nil, ErrUnknownJob
+}
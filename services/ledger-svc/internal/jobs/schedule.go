@@ -0,0 +1,191 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells when a job runs next.
+type Schedule interface {
+	// Next returns the first time after the given one the job is due.
+	Next(after time.Time) time.Time
+	String() string
+}
+
+type every time.Duration
+
+// Every runs a job at a fixed interval from its last start.
+func Every(d time.Duration) Schedule {
+	return every(d)
+}
+
+func (e every) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(e))
+}
+
+func (e every) String() string {
+	return "@every " + time.Duration(e).String()
+}
+
+// macros are the shorthands of the usual cron expressions.
+var macros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// cron is a five field cron expression, minute hour day-of-month month
+// day-of-week, in UTC. Each field is a bit set of the values it matches.
+type cron struct {
+	expr                          string
+	minute, hour, dom, month, dow uint64
+	domRestricted, dowRestricted  bool
+}
+
+// fields are the bounds of the cron fields, in order.
+var fields = []struct {
+	name        string
+	first, last int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// ParseSchedule reads "@every <duration>", one of @hourly, @daily, @weekly
+// and @monthly, or a cron expression of five fields in UTC, each a *, a
+// value, a range or a list of them, optionally with a /step, e.g.
+// "30 3 * * 1-5".
+func ParseSchedule(s string) (Schedule, error) {
+	s = strings.TrimSpace(s)
+	if v, ok := strings.CutPrefix(s, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid schedule %q, expected a positive duration after @every", s)
+		}
+		return Every(d), nil
+	}
+	expr := s
+	if m, ok := macros[s]; ok {
+		expr = m
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("invalid schedule %q, expected @every <duration> or five cron fields", s)
+	}
+	c := &cron{expr: s}
+	sets := []*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	for i, part := range parts {
+		set, err := parseField(part, fields[i].first, fields[i].last)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q, %s: %w", s, fields[i].name, err)
+		}
+		*sets[i] = set
+	}
+	// Sunday is 0 or 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domRestricted, c.dowRestricted = parts[2] != "*", parts[4] != "*"
+	return c, nil
+}
+
+func parseField(field string, first, last int) (uint64, error) {
+	var set uint64
+	for part := range strings.SplitSeq(field, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepText)
+			}
+		}
+		lo, hi := first, last
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value %q", from)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid value %q", to)
+				}
+			} else if hasStep {
+				hi = last
+			}
+		}
+		if lo < first || hi > last || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, first, last)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func (c *cron) String() string {
+	return c.expr
+}
+
+// Next walks forward from after, skipping a whole month, day or hour when it
+// does not match. Expressions matching no date, e.g. February 30, give the
+// zero time.
+func (c *cron) Next(after time.Time) time.Time {
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if c.hour&(1<<t.Hour()) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if c.minute&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// matchDay follows cron: with both day fields restricted, a day matching
+// either is due.
+func (c *cron) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	if c.domRestricted && c.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// ScheduleFromEnv reads the schedule of a job from the variable, see
+// ParseSchedule, running it every fallback when it is not set.
+func ScheduleFromEnv(name string, fallback time.Duration) (Schedule, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return Every(fallback), nil
+	}
+	schedule, err := ParseSchedule(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return schedule, nil
+}
@@ -0,0 +1,218 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Status is the record of the runs of a job. A run holds the job until it
+// ends or LeaseUntil passes, e.g. when its instance died mid-run.
+type Status struct {
+	Name       string     `json:"name" bson:"_id"`
+	Running    bool       `json:"running" bson:"running"`
+	Instance   string     `json:"instance,omitempty" bson:"instance,omitempty"`
+	LeaseUntil *time.Time `json:"-" bson:"lease_until,omitempty"`
+	LastStart  *time.Time `json:"last_start,omitempty" bson:"last_start,omitempty"`
+	LastEnd    *time.Time `json:"last_end,omitempty" bson:"last_end,omitempty"`
+	// LastDurationMS is the duration of the last completed run.
+	LastDurationMS int64      `json:"last_duration_ms" bson:"last_duration_ms"`
+	LastError      string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	LastSuccess    *time.Time `json:"last_success,omitempty" bson:"last_success,omitempty"`
+	Runs           int        `json:"runs" bson:"runs"`
+	Failures       int        `json:"failures" bson:"failures"`
+	// RequestedAt is when a run was last asked for on demand, due on the
+	// next check of whichever replica runs the jobs.
+	RequestedAt *time.Time `json:"requested_at,omitempty" bson:"requested_at,omitempty"`
+
+	// set by the Runner, not stored
+	Description string     `json:"description,omitempty" bson:"-"`
+	Schedule    string     `json:"schedule,omitempty" bson:"-"`
+	NextRun     *time.Time `json:"next_run,omitempty" bson:"-"`
+}
+
+// held reports whether a run holds the job at now.
+func (s *Status) held(now time.Time) bool {
+	return s.Running && s.LeaseUntil != nil && now.Before(*s.LeaseUntil)
+}
+
+// Store keeps the status of the jobs and guards them against overlapping
+// runs, across the replicas sharing it.
+type Store interface {
+	// Get returns nil when the job never ran.
+	Get(ctx context.Context, name string) (*Status, error)
+	List(ctx context.Context) ([]Status, error)
+	// Start marks the job run by instance from at until the lease expires,
+	// false when another run holds it.
+	Start(ctx context.Context, name, instance string, at, until time.Time) (bool, error)
+	// Request asks for a run of the job at, see Status.RequestedAt.
+	Request(ctx context.Context, name string, at time.Time) error
+	// Finish records the outcome of the run of instance started at start and
+	// releases the job. A run whose lease was taken over records nothing.
+	Finish(ctx context.Context, name, instance string, start, end time.Time, runErr error) error
+}
+
+// NewStore keeps the jobs next to the statements in MongoDB, so the replicas
+// take turns, or in memory for the memory driver.
+func NewStore(repo statements.StatementRepository) Store {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryStore()
+}
+
+type MemoryStore struct {
+	mu   sync.Mutex
+	jobs map[string]Status
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]Status)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, name string) (*Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.jobs[name]
+	if !ok {
+		return nil, nil
+	}
+	return &status, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Status, 0, len(s.jobs))
+	for _, status := range s.jobs {
+		list = append(list, status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (s *MemoryStore) Start(ctx context.Context, name, instance string, at, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.jobs[name]
+	if status.held(at) {
+		return false, nil
+	}
+	status.Name, status.Running, status.Instance = name, true, instance
+	status.LastStart, status.LeaseUntil = &at, &until
+	s.jobs[name] = status
+	return true, nil
+}
+
+func (s *MemoryStore) Request(ctx context.Context, name string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.jobs[name]
+	status.Name, status.RequestedAt = name, &at
+	s.jobs[name] = status
+	return nil
+}
+
+func (s *MemoryStore) Finish(ctx context.Context, name, instance string, start, end time.Time, runErr error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.jobs[name]
+	if !ok || !status.Running || status.Instance != instance || status.LastStart == nil || !status.LastStart.Equal(start) {
+		return nil
+	}
+	status.Running, status.LeaseUntil = false, nil
+	status.LastEnd = &end
+	status.LastDurationMS = end.Sub(start).Milliseconds()
+	status.Runs++
+	status.LastError = ""
+	if runErr != nil {
+		status.LastError = runErr.Error()
+		status.Failures++
+	} else {
+		status.LastSuccess = &end
+	}
+	s.jobs[name] = status
+	return nil
+}
+
+// MongoStore keeps the jobs in the <namespace>jobs collection. The lease is
+// taken with a conditional upsert: while another run holds the job the
+// filter misses its document and the insert collides with it.
+type MongoStore struct {
+	jobs *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database, namespace string) *MongoStore {
+	return &MongoStore{jobs: db.Collection(namespace + "jobs")}
+}
+
+func (s *MongoStore) Get(ctx context.Context, name string) (*Status, error) {
+	var status Status
+	err := s.jobs.FindOne(ctx, bson.M{"_id": name}).Decode(&status)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (s *MongoStore) List(ctx context.Context) ([]Status, error) {
+	cursor, err := s.jobs.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	list := []Status{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *MongoStore) Start(ctx context.Context, name, instance string, at, until time.Time) (bool, error) {
+	filter := bson.M{"_id": name, "$or": bson.A{
+		bson.M{"running": bson.M{"$ne": true}},
+		bson.M{"lease_until": bson.M{"$lte": at}},
+	}}
+	update := bson.M{"$set": bson.M{"running": true, "instance": instance, "last_start": at, "lease_until": until}}
+	_, err := s.jobs.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *MongoStore) Request(ctx context.Context, name string, at time.Time) error {
+	_, err := s.jobs.UpdateOne(ctx, bson.M{"_id": name}, bson.M{"$set": bson.M{"requested_at": at}}, options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *MongoStore) Finish(ctx context.Context, name, instance string, start, end time.Time, runErr error) error {
+	set := bson.M{"running": false, "last_end": end, "last_duration_ms": end.Sub(start).Milliseconds()}
+	unset := bson.M{"lease_until": ""}
+	inc := bson.M{"runs": 1}
+	if runErr != nil {
+		set["last_error"] = runErr.Error()
+		inc["failures"] = 1
+	} else {
+		set["last_success"] = end
+		unset["last_error"] = ""
+	}
+	filter := bson.M{"_id": name, "running": true, "instance": instance, "last_start": start}
+	_, err := s.jobs.UpdateOne(ctx, filter, bson.M{"$set": set, "$unset": unset, "$inc": inc})
+	return err
+}
@@ -0,0 +1,102 @@
+// Package jsonbody decodes the JSON bodies of API requests strictly: bodies
+// are bounded in size and may hold neither unknown fields nor data after the
+// value. Rejected bodies are reported with the offending fields as details.
+package jsonbody
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/ingest"
+)
+
+// MaxBytes caps the bodies read, JSON_BODY_MAX_KB (1024) kibibytes. File
+// uploads are not JSON and keep their own limits.
+var MaxBytes = maxBytesFromEnv()
+
+func maxBytesFromEnv() int64 {
+	if kb, err := strconv.ParseInt(os.Getenv("JSON_BODY_MAX_KB"), 10, 64); err == nil && kb > 0 {
+		return kb << 10
+	}
+	return 1 << 20
+}
+
+// Invalid returns the error of a body rejected for the fields listed.
+func Invalid(message string, errs ...ingest.ValidationError) *apierror.Error {
+	return &apierror.Error{Kind: apierror.KindInvalid, Code: "invalid_body", Message: message, Details: errs}
+}
+
+// Read returns the body of the request, a payload_too_large error when it is
+// larger than MaxBytes.
+func Read(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, apierror.New(apierror.KindTooLarge, "", "Request body too large").
+			WithDetails([]ingest.ValidationError{{Path: "$", Message: fmt.Sprintf("must be at most %d bytes", tooLarge.Limit)}})
+	}
+	if err != nil {
+		return nil, Invalid("Invalid request payload", ingest.ValidationError{Path: "$", Message: "could not be read"})
+	}
+	return data, nil
+}
+
+// Decode reads the body of the request into v, see Read and Unmarshal.
+func Decode(w http.ResponseWriter, r *http.Request, v any) error {
+	data, err := Read(w, r)
+	if err != nil {
+		return err
+	}
+	return Unmarshal(data, v)
+}
+
+// Unmarshal decodes data into v, rejecting empty bodies, fields v does not
+// have and anything after the value with an invalid_body error.
+func Unmarshal(data []byte, v any) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return Invalid("Invalid request payload", ingest.ValidationError{Path: "$", Message: "request body is required"})
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return Invalid("Invalid request payload", violation(err))
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return Invalid("Invalid request payload", ingest.ValidationError{Path: "$", Message: "unexpected data after the JSON value"})
+	}
+	return nil
+}
+
+// violation tells which field a decoding error is about, as far as
+// encoding/json says.
+func violation(err error) ingest.ValidationError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return ingest.ValidationError{Path: "$", Message: fmt.Sprintf("malformed JSON at byte %d: %s", syntaxErr.Offset, syntaxErr.Error())}
+	case errors.As(err, &typeErr):
+		path := "$"
+		if typeErr.Field != "" {
+			path += "." + typeErr.Field
+		}
+		return ingest.ValidationError{Path: path, Message: fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value)}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return ingest.ValidationError{Path: "$", Message: "truncated JSON"}
+	}
+	// encoding/json has no type for unknown fields
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		if name, err := strconv.Unquote(field); err == nil {
+			return ingest.ValidationError{Path: "$." + name, Message: "unknown field"}
+		}
+	}
+	return ingest.ValidationError{Path: "$", Message: err.Error()}
+}
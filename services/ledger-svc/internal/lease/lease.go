@@ -0,0 +1,192 @@
+// Package lease keeps the replicas of the service from running the same
+// background work at once. A lease is a named lock held by one instance
+// until it releases it or lets it expire, e.g. by dying; a Leader holds one
+// for as long as it runs its work, so exactly one replica does.
+package lease
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Instance names this process among the replicas, its host and PID.
+func Instance() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return host + ":" + strconv.Itoa(os.Getpid())
+}
+
+// Store keeps the leases.
+type Store interface {
+	// Acquire takes the lease for holder until ttl from now, or extends it
+	// when holder has it. It reports false while another holder has it.
+	Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	// Release gives up the lease, when holder has it.
+	Release(ctx context.Context, name, holder string) error
+}
+
+// NewStore keeps the leases next to the statements in MongoDB, shared by the
+// replicas, or in memory for the memory driver, which runs a single one.
+func NewStore(repo statements.StatementRepository) Store {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryStore()
+}
+
+type held struct {
+	holder  string
+	expires time.Time
+}
+
+type MemoryStore struct {
+	Now func() time.Time
+
+	mu     sync.Mutex
+	leases map[string]held
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{Now: time.Now, leases: make(map[string]held)}
+}
+
+func (s *MemoryStore) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Now()
+	if l, ok := s.leases[name]; ok && l.holder != holder && now.Before(l.expires) {
+		return false, nil
+	}
+	s.leases[name] = held{holder: holder, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, name, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.leases[name].holder == holder {
+		delete(s.leases, name)
+	}
+	return nil
+}
+
+// MongoStore keeps the leases in the <namespace>leases collection. A lease is
+// taken with a conditional upsert: while another holder has it, the filter
+// misses its document and the insert collides with it. The replicas'
+// clocks are trusted to agree within a fraction of the TTL.
+type MongoStore struct {
+	leases *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database, namespace string) *MongoStore {
+	return &MongoStore{leases: db.Collection(namespace + "leases")}
+}
+
+func (s *MongoStore) Acquire(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	filter := bson.M{"_id": name, "$or": bson.A{
+		bson.M{"holder": holder},
+		bson.M{"expires_at": bson.M{"$lte": now}},
+	}}
+	update := bson.M{"$set": bson.M{"holder": holder, "expires_at": now.Add(ttl)}}
+	_, err := s.leases.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *MongoStore) Release(ctx context.Context, name, holder string) error {
+	_, err := s.leases.DeleteOne(ctx, bson.M{"_id": name, "holder": holder})
+	return err
+}
+
+// Leader runs work on the one instance holding the lease Name. The others
+// wait and take over once it is released or expires, within TTL.
+type Leader struct {
+	Store  Store
+	Name   string
+	Holder string
+	// TTL is how long the lease outlives a holder that stopped renewing it;
+	// it is renewed every third of it.
+	TTL time.Duration
+}
+
+func NewLeader(store Store, name string, ttl time.Duration) *Leader {
+	return &Leader{Store: store, Name: name, Holder: Instance(), TTL: ttl}
+}
+
+// Run runs work with a context done when the lease is lost, and again once it
+// is won back, until ctx is done. Work returns when its context is done.
+func (l *Leader) Run(ctx context.Context, work func(ctx context.Context)) {
+	ticker := time.NewTicker(l.TTL / 3)
+	defer ticker.Stop()
+
+	// stop stops the work, nil while another instance holds the lease
+	var stop func()
+	renewed := time.Time{}
+	for {
+		ok, err := l.Store.Acquire(ctx, l.Name, l.Holder, l.TTL)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			slog.Warn("Failed to renew the lease", "lease", l.Name, "error", err)
+			// the others take it over once it expires
+			if stop != nil && time.Since(renewed) > l.TTL*2/3 {
+				slog.Warn("Lease expiring, stopping its work", "lease", l.Name)
+				stop()
+				stop = nil
+			}
+		case err != nil:
+		case ok && stop == nil:
+			slog.Info("Lease acquired, starting its work", "lease", l.Name, "holder", l.Holder)
+			stop = start(ctx, work)
+			renewed = time.Now()
+		case ok:
+			renewed = time.Now()
+		case stop != nil:
+			slog.Warn("Lease taken over, stopping its work", "lease", l.Name)
+			stop()
+			stop = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if stop != nil {
+				stop()
+				if err := l.Store.Release(context.WithoutCancel(ctx), l.Name, l.Holder); err != nil {
+					slog.Warn("Failed to release the lease", "lease", l.Name, "error", err)
+				}
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// start runs work until the returned function stops it.
+func start(ctx context.Context, work func(ctx context.Context)) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		work(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,89 @@
+package live
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// heartbeat is how often a comment is sent on an idle stream, so proxies do
+// not close it.
+const heartbeat = 25 * time.Second
+
+// writeWait bounds a write to the stream. It replaces the write timeout of
+// the server, which would end the stream, so only a client that stopped
+// reading is cut off.
+const writeWait = 10 * time.Second
+
+type Handler struct {
+	Hub *Hub
+}
+
+// StreamHandler serves GET /api/events, the changes as Server-Sent Events:
+// an "id", the event type as "event" and the Event as JSON "data". The types
+// query parameter, comma separated, narrows the stream. A reconnecting
+// EventSource sends Last-Event-ID and is sent the events it missed first.
+func (h *Handler) StreamHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	var types []string
+	for _, t := range strings.Split(r.URL.Query().Get("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// nginx buffers responses by default, which holds the events back
+	w.Header().Set("X-Accel-Buffering", "no")
+	// past the read timeout of the server the watch for the client going away
+	// fails and cancels the request
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Now().Add(writeWait))
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprint(w, "retry: 3000\n\n"); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to flush the event stream", "error", err)
+		return
+	}
+
+	events, cancel := h.Hub.Subscribe(statements.OwnerFrom(r.Context()), types, r.Header.Get("Last-Event-ID"))
+	defer cancel()
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			_ = rc.SetWriteDeadline(time.Now().Add(writeWait))
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				// lagging or shutting down, the client reconnects and replays
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				accesslog.Logger(r.Context()).Error("Failed to encode the event", "id", event.ID, "type", event.Type, "error", err)
+				continue
+			}
+			_ = rc.SetWriteDeadline(time.Now().Add(writeWait))
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package live streams the changes of the ledger to the web dashboard as
+// Server-Sent Events, so it updates without polling. The statement service
+// tells the hub about every save; the hub fans the events out to the open
+// streams and keeps the latest ones for clients reconnecting with
+// Last-Event-ID.
+//
+// The hub is in process: a stream sees the changes made by the replica it is
+// connected to. Consumers needing every change, once, use the outbox events.
+// A stream of an authenticated user sees the changes of the user, within
+// their tenant, and the ones of the whole deployment, like the budgets.
+package live
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/budgets"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// EventBudgetExceeded is streamed once per budget and period, when a save
+// takes the spend over it.
+const EventBudgetExceeded = "budget.exceeded"
+
+const (
+	// replaySize is how many events are kept for reconnecting clients.
+	replaySize = 256
+	// subscriberBuffer is how many events a stream may fall behind before it
+	// is closed; the client reconnects and replays what it missed.
+	subscriberBuffer = 64
+)
+
+// Event is a change as streamed, its ID the position in the hub's sequence.
+type Event struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+
+	// owner is the owner the change is of, see statements.Owner, empty for
+	// the whole deployment.
+	owner string
+}
+
+type subscriber struct {
+	ch    chan Event
+	types map[string]bool
+	owner string
+}
+
+func (s *subscriber) wants(event Event) bool {
+	if s.owner != "" && event.owner != "" && event.owner != s.owner {
+		return false
+	}
+	return len(s.types) == 0 || s.types[event.Type]
+}
+
+// Hub is a statements.Notifier fanning the changes out to the subscribers.
+type Hub struct {
+	// Budgets, when set, is checked after every save for the budgets gone
+	// over, which are streamed as budget.exceeded.
+	Budgets *budgets.Tracker
+
+	mu          sync.Mutex
+	seq         uint64
+	recent      []Event
+	subscribers map[*subscriber]struct{}
+	// announced holds the budget periods budget.exceeded was streamed for.
+	announced map[string]bool
+	check     chan struct{}
+}
+
+func NewHub(tracker *budgets.Tracker) *Hub {
+	return &Hub{
+		Budgets:     tracker,
+		subscribers: map[*subscriber]struct{}{},
+		announced:   map[string]bool{},
+		check:       make(chan struct{}, 1),
+	}
+}
+
+// Notify streams the change and asks for a budget check. It never blocks the
+// save it is told about.
+func (h *Hub) Notify(ctx context.Context, event statements.ChangeEvent) {
+	owner := statements.OwnerFrom(ctx)
+	if o := event.Owner(); o != "" {
+		owner = o
+	}
+	h.publish(owner, event.Type, event.OccurredAt, event)
+	if h.Budgets == nil {
+		return
+	}
+	// checks asked for while one is pending are covered by it
+	select {
+	case h.check <- struct{}{}:
+	default:
+	}
+}
+
+// Run checks the budgets the saves asked for until the context is done.
+func (h *Hub) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.check:
+			if err := h.checkBudgets(ctx, time.Now().UTC()); err != nil {
+				slog.Warn("Failed to check the budgets for the event stream", "error", err)
+			}
+		}
+	}
+}
+
+// checkBudgets streams budget.exceeded for the budgets over in the period of
+// now that were not announced yet.
+func (h *Hub) checkBudgets(ctx context.Context, now time.Time) error {
+	status, err := h.Budgets.Status(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, s := range status {
+		if !s.Over {
+			continue
+		}
+		key := fmt.Sprintf("%s:%s", s.Budget.ID, s.PeriodStart.Format("20060102"))
+		h.mu.Lock()
+		seen := h.announced[key]
+		h.announced[key] = true
+		h.mu.Unlock()
+		if !seen {
+			h.publish(statements.Owner(s.Budget.TenantID, s.Budget.UserID), EventBudgetExceeded, now, s)
+		}
+	}
+	return nil
+}
+
+func (h *Hub) publish(owner, eventType string, occurredAt time.Time, data any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	event := Event{ID: strconv.FormatUint(h.seq, 10), Type: eventType, OccurredAt: occurredAt, Data: data, owner: owner}
+	h.recent = append(h.recent, event)
+	if len(h.recent) > replaySize {
+		h.recent = h.recent[len(h.recent)-replaySize:]
+	}
+	for sub := range h.subscribers {
+		if !sub.wants(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			slog.Warn("Closing a lagging event stream")
+			h.drop(sub)
+		}
+	}
+}
+
+// Subscribe opens a stream of the events of the given types, all of them when
+// none are given, of the owner or of every owner when empty. The events after
+// lastID still kept are sent first; an unknown lastID replays nothing. The
+// channel is closed when the subscriber falls behind or cancel is called.
+func (h *Hub) Subscribe(owner string, types []string, lastID string) (<-chan Event, func()) {
+	sub := &subscriber{ch: make(chan Event, subscriberBuffer+replaySize), owner: owner}
+	if len(types) > 0 {
+		sub.types = make(map[string]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if after, err := strconv.ParseUint(lastID, 10, 64); err == nil {
+		for _, event := range h.recent {
+			if id, _ := strconv.ParseUint(event.ID, 10, 64); id > after && sub.wants(event) {
+				sub.ch <- event
+			}
+		}
+	}
+	h.subscribers[sub] = struct{}{}
+	return sub.ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.drop(sub)
+	}
+}
+
+// Close ends every stream, e.g. when the server shuts down: the streams
+// would otherwise hold it until its drain timeout. Clients reconnect with
+// Last-Event-ID.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		h.drop(sub)
+	}
+}
+
+func (h *Hub) drop(sub *subscriber) {
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.ch)
+	}
+}
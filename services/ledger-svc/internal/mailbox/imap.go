@@ -0,0 +1,168 @@
+package mailbox
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// ProcessedFlag marks the messages the poller went through, so they are not
+// fetched again, whichever process polls next.
+const ProcessedFlag = "$FinchieImported"
+
+// Mailbox is the folder statements are mailed to.
+type Mailbox interface {
+	// Unprocessed returns the UIDs of the messages received since the time,
+	// or all when it is zero, that are not marked processed.
+	Unprocessed(ctx context.Context, since time.Time) ([]uint32, error)
+	// Fetch returns the raw message.
+	Fetch(ctx context.Context, uid uint32) ([]byte, error)
+	MarkProcessed(ctx context.Context, uid uint32) error
+	Close() error
+}
+
+// IMAPConfig reaches the mailbox over IMAP.
+type IMAPConfig struct {
+	// URL is imaps://user@host[:port]/folder, or imap:// for STARTTLS on
+	// port 143. The folder defaults to INBOX.
+	URL      *url.URL
+	Password string
+	Timeout  time.Duration
+}
+
+// IMAPMailbox reads a folder over one IMAP session. Like the SFTP drop zone,
+// a session is opened for every poll and closed after it.
+type IMAPMailbox struct {
+	client *client.Client
+	// flag is ProcessedFlag, or \Seen on servers that do not keep keywords.
+	flag string
+}
+
+func OpenIMAP(ctx context.Context, cfg IMAPConfig) (*IMAPMailbox, error) {
+	host := cfg.URL.Hostname()
+	tlsConfig := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+
+	var c *client.Client
+	switch cfg.URL.Scheme {
+	case "imaps":
+		addr := cfg.URL.Host
+		if cfg.URL.Port() == "" {
+			addr = net.JoinHostPort(host, "993")
+		}
+		conn, err := (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		if c, err = client.New(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	case "imap":
+		addr := cfg.URL.Host
+		if cfg.URL.Port() == "" {
+			addr = net.JoinHostPort(host, "143")
+		}
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		if c, err = client.New(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// never send the password in the clear
+		if ok, err := c.SupportStartTLS(); err != nil || !ok {
+			c.Logout()
+			return nil, errors.New("the IMAP server does not support STARTTLS, use imaps://")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			c.Logout()
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q, expected imaps or imap", cfg.URL.Scheme)
+	}
+	c.Timeout = cfg.Timeout
+
+	password := cfg.Password
+	if p, ok := cfg.URL.User.Password(); ok && password == "" {
+		password = p
+	}
+	if err := c.Login(cfg.URL.User.Username(), password); err != nil {
+		c.Logout()
+		return nil, fmt.Errorf("IMAP login: %w", err)
+	}
+
+	folder := strings.Trim(cfg.URL.Path, "/")
+	if folder == "" {
+		folder = "INBOX"
+	}
+	status, err := c.Select(folder, false)
+	if err != nil {
+		c.Logout()
+		return nil, fmt.Errorf("select %s: %w", folder, err)
+	}
+	mb := &IMAPMailbox{client: c, flag: ProcessedFlag}
+	if !slices.Contains(status.PermanentFlags, `\*`) && !slices.Contains(status.PermanentFlags, ProcessedFlag) {
+		mb.flag = imap.SeenFlag
+	}
+	return mb, nil
+}
+
+func (m *IMAPMailbox) Unprocessed(ctx context.Context, since time.Time) ([]uint32, error) {
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{m.flag}
+	criteria.Since = since
+	return m.client.UidSearch(criteria)
+}
+
+func (m *IMAPMailbox) Fetch(ctx context.Context, uid uint32) ([]byte, error) {
+	set := new(imap.SeqSet)
+	set.AddNum(uid)
+	// peek, so fetching does not mark the message read
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- m.client.UidFetch(set, []imap.FetchItem{section.FetchItem()}, messages)
+	}()
+
+	var raw []byte
+	var readErr error
+	for msg := range messages {
+		if body := msg.GetBody(section); body != nil {
+			raw, readErr = io.ReadAll(body)
+		}
+	}
+	if err := <-done; err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("message %d not found", uid)
+	}
+	return raw, nil
+}
+
+func (m *IMAPMailbox) MarkProcessed(ctx context.Context, uid uint32) error {
+	set := new(imap.SeqSet)
+	set.AddNum(uid)
+	return m.client.UidStore(set, imap.FormatFlagsOp(imap.AddFlags, true), []any{m.flag}, nil)
+}
+
+func (m *IMAPMailbox) Close() error {
+	return m.client.Logout()
+}
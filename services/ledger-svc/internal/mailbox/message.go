@@ -0,0 +1,148 @@
+package mailbox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Message is a mail with the attachments it carries, those of forwarded
+// messages included.
+type Message struct {
+	UID uint32
+	// ID is the Message-ID header.
+	ID string
+	// From is the sender's address, lower-cased.
+	From        string
+	Subject     string
+	Date        time.Time
+	Attachments []Attachment
+}
+
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// IsPDF reports whether the attachment is a PDF. Banks often send them as
+// application/octet-stream, so the file name counts too.
+func (a *Attachment) IsPDF() bool {
+	return a.ContentType == "application/pdf" || strings.EqualFold(path.Ext(a.Filename), ".pdf")
+}
+
+// headerDecoder decodes the encoded words of the Subject and file names, in
+// any charset the WHATWG encoding index knows, e.g. Big5 or Shift_JIS.
+var headerDecoder = &mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		enc, err := htmlindex.Get(charset)
+		if err != nil {
+			return nil, err
+		}
+		return enc.NewDecoder().Reader(input), nil
+	},
+}
+
+func decodeHeader(s string) string {
+	decoded, err := headerDecoder.DecodeHeader(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
+
+// ParseMessage reads a raw RFC 5322 message.
+func ParseMessage(raw []byte) (*Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	msg := &Message{
+		ID:      strings.Trim(strings.TrimSpace(m.Header.Get("Message-Id")), "<>"),
+		Subject: decodeHeader(m.Header.Get("Subject")),
+	}
+	if from, err := (&mail.AddressParser{WordDecoder: headerDecoder}).Parse(m.Header.Get("From")); err == nil {
+		msg.From = strings.ToLower(from.Address)
+	}
+	if date, err := m.Header.Date(); err == nil {
+		msg.Date = date.UTC()
+	}
+	if err := msg.walk(textproto.MIMEHeader(m.Header), m.Body, 0); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// maxDepth bounds the nesting of multiparts and forwarded messages.
+const maxDepth = 10
+
+// walk collects the attachments of a part and the parts inside it.
+func (msg *Message) walk(header textproto.MIMEHeader, body io.Reader, depth int) error {
+	if depth > maxDepth {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	disposition, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := decodeHeader(dispParams["filename"])
+	if filename == "" {
+		filename = decodeHeader(params["name"])
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("invalid %s part: %w", mediaType, err)
+			}
+			if err := msg.walk(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	case mediaType == "message/rfc822" && filename == "":
+		// a forwarded statement
+		inner, err := mail.ReadMessage(decodeBody(header, body))
+		if err != nil {
+			return nil
+		}
+		return msg.walk(textproto.MIMEHeader(inner.Header), inner.Body, depth+1)
+	case filename == "" && disposition != "attachment":
+		// the text of the mail
+		return nil
+	}
+
+	data, err := io.ReadAll(decodeBody(header, body))
+	if err != nil {
+		return fmt.Errorf("invalid attachment %q: %w", filename, err)
+	}
+	msg.Attachments = append(msg.Attachments, Attachment{Filename: filename, ContentType: mediaType, Data: data})
+	return nil
+}
+
+func decodeBody(header textproto.MIMEHeader, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
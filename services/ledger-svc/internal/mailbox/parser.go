@@ -0,0 +1,66 @@
+package mailbox
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Parser reads the PDF e-statements of one issuer. Parsers register from the
+// init function of their package, like the importers.
+type Parser interface {
+	// Match reports whether the attachment is a statement the parser reads,
+	// typically by the sender and the file name.
+	Match(msg *Message, att *Attachment) bool
+	// Parse returns the statement of the PDF. The same statement may be mailed
+	// again, so its source ID and transaction IDs must not change between
+	// parses, see importers.StableID.
+	Parse(msg *Message, att *Attachment) (*statements.Statement, error)
+}
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = make(map[string]Parser)
+)
+
+// RegisterParser adds a parser under a name. It panics when the name is
+// already taken.
+func RegisterParser(name string, parser Parser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+
+	if parser == nil {
+		panic("mailbox: RegisterParser parser is nil")
+	}
+	if _, dup := parsers[name]; dup {
+		panic("mailbox: RegisterParser called twice for parser " + name)
+	}
+	parsers[name] = parser
+}
+
+// Parsers returns the names of the registered parsers.
+func Parsers() []string {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+
+	names := make([]string, 0, len(parsers))
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// match returns the first parser, by name, that reads the attachment.
+func match(msg *Message, att *Attachment) (string, Parser) {
+	for _, name := range Parsers() {
+		parsersMu.RLock()
+		parser := parsers[name]
+		parsersMu.RUnlock()
+		if parser.Match(msg, att) {
+			return name, parser
+		}
+	}
+	return "", nil
+}
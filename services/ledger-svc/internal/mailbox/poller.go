@@ -0,0 +1,235 @@
+// Package mailbox imports the e-statements card issuers mail as PDF
+// attachments. The poller watches an IMAP folder and hands every PDF to the
+// registered Parser that reads it; statements go through the statement
+// service like any other import.
+package mailbox
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/ingest"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// RunSource names the poller in the ingest runs.
+const RunSource = "mailbox"
+
+// Poller imports the statements mailed to a mailbox. A message is imported
+// once: after its PDFs went through a parser, imported or failed, it is
+// flagged with ProcessedFlag. Statements are upserted by their ID, so a
+// statement mailed twice, or imported again because flagging failed, stays
+// one statement.
+type Poller struct {
+	Open    func(ctx context.Context) (Mailbox, error)
+	Service *statements.StatementService
+	Runs    ingest.RunStore
+	// Since limits the search to the messages of the last days, zero searches
+	// the whole folder.
+	Since time.Duration
+
+	mu sync.Mutex
+	// skipped are the messages without a PDF any parser reads. They are not
+	// flagged, a parser added later may read them, but the parsers only change
+	// with a restart, so this process does not fetch them again.
+	skipped map[uint32]bool
+	// imported maps the hash of the PDFs already saved to their statement,
+	// reminders often attach the same statement again.
+	imported map[string]string
+}
+
+// NewPollerFromEnv reads the mailbox from MAILBOX_URL, e.g.
+// imaps://me%40example.com@imap.example.com/Statements. It returns nil when
+// MAILBOX_URL is unset.
+func NewPollerFromEnv(service *statements.StatementService, runs ingest.RunStore) (*Poller, error) {
+	raw := os.Getenv("MAILBOX_URL")
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "imaps" && u.Scheme != "imap") || u.Host == "" {
+		return nil, fmt.Errorf("invalid MAILBOX_URL %q, expected imaps://user@host/folder", raw)
+	}
+	cfg := IMAPConfig{
+		URL:      u,
+		Password: os.Getenv("MAILBOX_PASSWORD"),
+		Timeout:  time.Minute,
+	}
+	days := 30
+	if v, err := strconv.Atoi(os.Getenv("MAILBOX_SINCE_DAYS")); err == nil && v >= 0 {
+		days = v
+	}
+	if len(Parsers()) == 0 {
+		slog.Warn("No e-statement parser is registered, the mailbox poller imports nothing")
+	}
+	return &Poller{
+		Open: func(ctx context.Context) (Mailbox, error) {
+			return OpenIMAP(ctx, cfg)
+		},
+		Service: service,
+		Runs:    runs,
+		Since:   time.Duration(days) * 24 * time.Hour,
+	}, nil
+}
+
+// Run polls now and then every interval, until the context is done.
+func (p *Poller) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.Poll(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll imports the unprocessed messages once. Runs that found nothing to
+// import are not recorded.
+func (p *Poller) Poll(ctx context.Context, now time.Time) *ingest.Run {
+	run := ingest.NewRun(RunSource)
+	p.poll(ctx, now, run)
+	run.FinishedAt = time.Now().UTC()
+
+	if run.Error == "" && len(run.Items) == 0 {
+		return run
+	}
+	if run.Error != "" {
+		slog.Error("Mailbox poll failed", "error", run.Error)
+	} else {
+		slog.Info("Mailbox poll finished", "imported", run.Imported, "failed", run.Failed)
+	}
+	if err := p.Runs.Save(ctx, run); err != nil {
+		slog.Error("Failed to record the mailbox run", "id", run.ID, "error", err)
+	}
+	return run
+}
+
+func (p *Poller) poll(ctx context.Context, now time.Time, run *ingest.Run) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.skipped == nil {
+		p.skipped, p.imported = map[uint32]bool{}, map[string]string{}
+	}
+
+	mb, err := p.Open(ctx)
+	if err != nil {
+		run.Error = err.Error()
+		return
+	}
+	defer mb.Close()
+
+	var since time.Time
+	if p.Since > 0 {
+		since = now.Add(-p.Since)
+	}
+	uids, err := mb.Unprocessed(ctx, since)
+	if err != nil {
+		run.Error = err.Error()
+		return
+	}
+	for _, uid := range uids {
+		if ctx.Err() != nil {
+			return
+		}
+		if p.skipped[uid] {
+			continue
+		}
+
+		raw, err := mb.Fetch(ctx, uid)
+		if err != nil {
+			// left unflagged, the next poll tries again
+			run.Add(ingest.RunItem{Name: fmt.Sprintf("message %d", uid), Status: ingest.ItemFailed, Error: err.Error()})
+			continue
+		}
+		msg, err := ParseMessage(raw)
+		var items []ingest.RunItem
+		if err != nil {
+			items = []ingest.RunItem{{Name: fmt.Sprintf("message %d", uid), Status: ingest.ItemFailed, Error: err.Error()}}
+		} else {
+			msg.UID = uid
+			var matched bool
+			if items, matched = p.importMessage(ctx, msg); !matched {
+				p.skipped[uid] = true
+				continue
+			}
+		}
+
+		for _, item := range items {
+			if item.Status == ingest.ItemFailed {
+				slog.Warn("Failed to import mailed statement", "message", uid, "name", item.Name, "error", item.Error)
+			}
+			run.Add(item)
+		}
+		if err := mb.MarkProcessed(ctx, uid); err != nil {
+			// importing again on the next poll is harmless, statements are upserted
+			slog.Error("Failed to flag the mailed statement processed", "message", uid, "error", err)
+		}
+	}
+}
+
+// importMessage saves the statement of every PDF a parser reads. matched is
+// false when no parser reads any of them.
+func (p *Poller) importMessage(ctx context.Context, msg *Message) (items []ingest.RunItem, matched bool) {
+	for i := range msg.Attachments {
+		att := &msg.Attachments[i]
+		if !att.IsPDF() {
+			continue
+		}
+		name, parser := match(msg, att)
+		if parser == nil {
+			continue
+		}
+		matched = true
+
+		sum := sha256.Sum256(att.Data)
+		hash := hex.EncodeToString(sum[:])
+		if _, dup := p.imported[hash]; dup {
+			slog.Info("Mailed statement already imported", "message", msg.UID, "file", att.Filename)
+			continue
+		}
+
+		item := p.importPDF(ctx, msg, att, name, parser)
+		if item.Status != ingest.ItemFailed {
+			p.imported[hash] = item.StatementID
+		}
+		items = append(items, item)
+	}
+	return items, matched
+}
+
+func (p *Poller) importPDF(ctx context.Context, msg *Message, att *Attachment, name string, parser Parser) ingest.RunItem {
+	item := ingest.RunItem{Name: msg.Subject + " / " + att.Filename, Status: ingest.ItemFailed}
+	stmt, err := parser.Parse(msg, att)
+	if err != nil {
+		item.Error = fmt.Sprintf("%s: %v", name, err)
+		return item
+	}
+
+	if stmt.Transactions != nil {
+		err = p.Service.SaveStatementWithTransactions(ctx, stmt)
+	} else {
+		err = p.Service.SaveStatement(ctx, stmt)
+	}
+	item.StatementID = stmt.ID
+	switch {
+	case errors.Is(err, statements.ErrQueued):
+		item.Status = ingest.ItemQueued
+	case err != nil:
+		item.Error = err.Error()
+	default:
+		item.Status = ingest.ItemImported
+	}
+	return item
+}
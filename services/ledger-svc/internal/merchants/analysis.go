@@ -0,0 +1,181 @@
+package merchants
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+)
+
+const (
+	// recurringMinMonths is how many consecutive monthly charges make a merchant
+	// recurring.
+	recurringMinMonths = 3
+	// recurringTolerance is how far a monthly charge may move from the previous
+	// one and still count as the same subscription, price changes included.
+	recurringTolerance = 0.3
+	// priceChangeThreshold ignores rounding and FX noise.
+	priceChangeThreshold = 0.01
+)
+
+type MerchantTotal struct {
+	Merchant string  `json:"merchant"`
+	Name     string  `json:"name"`
+	Amount   float64 `json:"amount"`
+	Count    int     `json:"count"`
+	Months   int     `json:"months"`
+}
+
+// Breakdown totals the spend by merchant, largest first.
+func Breakdown(spend []MonthlySpend) []MerchantTotal {
+	totals := map[string]*MerchantTotal{}
+	lastMonth := map[string]time.Time{}
+	for _, m := range spend {
+		t, ok := totals[m.Merchant]
+		if !ok {
+			t = &MerchantTotal{Merchant: m.Merchant}
+			totals[m.Merchant] = t
+		}
+		// spend is oldest first, the latest name wins
+		t.Name = m.Name
+		t.Amount += m.Amount
+		t.Count += m.Count
+		// a month with charges and refunds counts once
+		if !m.Month.Equal(lastMonth[m.Merchant]) {
+			t.Months++
+			lastMonth[m.Merchant] = m.Month
+		}
+	}
+
+	result := make([]MerchantTotal, 0, len(totals))
+	for _, t := range totals {
+		t.Amount = money.Round(t.Amount)
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Amount != result[j].Amount {
+			return result[i].Amount > result[j].Amount
+		}
+		return result[i].Merchant < result[j].Merchant
+	})
+	return result
+}
+
+// Recurring is a merchant that charged once a month, every month, up to now.
+type Recurring struct {
+	Merchant string    `json:"merchant"`
+	Name     string    `json:"name"`
+	Amount   float64   `json:"amount"`
+	Months   int       `json:"months"`
+	Since    time.Time `json:"since"`
+	LastDate time.Time `json:"last_date"`
+	// Changes are the price changes within the recurring run, oldest first.
+	Changes []PriceChange `json:"changes,omitempty"`
+}
+
+type PriceChange struct {
+	Merchant string    `json:"merchant"`
+	Name     string    `json:"name"`
+	Month    time.Time `json:"month"`
+	Previous float64   `json:"previous"`
+	Current  float64   `json:"current"`
+	Change   float64   `json:"change"`
+}
+
+// DetectRecurring finds the merchants with a single charge in each of at least
+// recurringMinMonths consecutive months, the last one this month or the
+// previous one, so a subscription billed late in the month is not dropped
+// before its charge arrives.
+func DetectRecurring(spend []MonthlySpend, now time.Time) []Recurring {
+	byMerchant := map[string][]MonthlySpend{}
+	for _, m := range spend {
+		byMerchant[m.Merchant] = append(byMerchant[m.Merchant], m)
+	}
+
+	active := monthOf(now).AddDate(0, -1, 0)
+	result := []Recurring{}
+	for merchant, months := range byMerchant {
+		sort.Slice(months, func(i, j int) bool {
+			return months[i].Month.Before(months[j].Month)
+		})
+		last := months[len(months)-1]
+		if last.Month.Before(active) {
+			continue
+		}
+
+		// walk back from the latest month while the charges keep the pattern
+		start := len(months) - 1
+		for start > 0 && sameSubscription(months[start-1], months[start]) {
+			start--
+		}
+		run := months[start:]
+		if len(run) < recurringMinMonths || !singleCharge(run[0]) {
+			continue
+		}
+
+		r := Recurring{
+			Merchant: merchant,
+			Name:     last.Name,
+			Amount:   last.LastAmount,
+			Months:   len(run),
+			Since:    run[0].Month,
+			LastDate: last.LastDate,
+		}
+		for i := 1; i < len(run); i++ {
+			if change, ok := priceChange(run[i-1], run[i]); ok {
+				r.Changes = append(r.Changes, change)
+			}
+		}
+		result = append(result, r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Merchant < result[j].Merchant
+	})
+	return result
+}
+
+// PriceChanges lists the price changes of recurring charges in months from
+// since on, newest first.
+func PriceChanges(recurring []Recurring, since time.Time) []PriceChange {
+	changes := []PriceChange{}
+	for _, r := range recurring {
+		for _, c := range r.Changes {
+			if !c.Month.Before(since) {
+				changes = append(changes, c)
+			}
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if !changes[i].Month.Equal(changes[j].Month) {
+			return changes[i].Month.After(changes[j].Month)
+		}
+		return changes[i].Merchant < changes[j].Merchant
+	})
+	return changes
+}
+
+func singleCharge(m MonthlySpend) bool {
+	return m.Count == 1 && m.Amount > 0
+}
+
+func sameSubscription(prev, next MonthlySpend) bool {
+	return singleCharge(prev) && singleCharge(next) &&
+		next.Month.Equal(prev.Month.AddDate(0, 1, 0)) &&
+		math.Abs(next.Amount-prev.Amount) <= recurringTolerance*prev.Amount
+}
+
+func priceChange(prev, next MonthlySpend) (PriceChange, bool) {
+	change := (next.Amount - prev.Amount) / prev.Amount
+	if math.Abs(change) < priceChangeThreshold {
+		return PriceChange{}, false
+	}
+	return PriceChange{
+		Merchant: next.Merchant,
+		Name:     next.Name,
+		Month:    next.Month,
+		Previous: prev.Amount,
+		Current:  next.Amount,
+		Change:   math.Round(change*10000) / 10000,
+	}, true
+}
@@ -0,0 +1,113 @@
+package merchants
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const (
+	monthLayout = "2006-01"
+	// recurringLookback bounds the months the recurring detection reads.
+	recurringLookback = 24
+)
+
+type Handler struct {
+	Store Store
+}
+
+// MerchantsHandler serves GET /api/merchants: the spend by merchant from one
+// month (YYYY-MM) to another, both inclusive, largest first, only of one
+// spend type with spend_type.
+func (h *Handler) MerchantsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, err := time.Parse(monthLayout, query.Get("from"))
+	if err != nil {
+		apierror.Reply(w, fmt.Sprintf("Invalid from parameter, expected %s", monthLayout), http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(monthLayout, query.Get("to"))
+	if err != nil || to.Before(from) {
+		apierror.Reply(w, fmt.Sprintf("Invalid to parameter, expected %s not before from", monthLayout), http.StatusBadRequest)
+		return
+	}
+
+	spendType, err := statements.ParseSpendType(query.Get("spend_type"))
+	if err != nil {
+		apierror.Reply(w, "Invalid spend_type parameter, expected merchant, fee, interest, transfer or refund", http.StatusBadRequest)
+		return
+	}
+
+	spend, err := h.Store.Spend(r.Context(), Query{From: from, To: to.AddDate(0, 1, 0), SpendType: spendType})
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to read merchant spend", "error", err)
+		apierror.Reply(w, "Failed to read merchant spend", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, Breakdown(spend))
+}
+
+// RecurringHandler serves GET /api/merchants/recurring, the merchants charging
+// monthly with their price changes.
+func (h *Handler) RecurringHandler(w http.ResponseWriter, r *http.Request) {
+	recurring, ok := h.recurring(w, r)
+	if ok {
+		writeJSON(w, recurring)
+	}
+}
+
+// PriceChangesHandler serves GET /api/merchants/price_changes, the price
+// changes of recurring charges since a month (YYYY-MM), the last three months
+// by default.
+func (h *Handler) PriceChangesHandler(w http.ResponseWriter, r *http.Request) {
+	since := monthOf(time.Now()).AddDate(0, -2, 0)
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		if since, err = time.Parse(monthLayout, v); err != nil {
+			apierror.Reply(w, fmt.Sprintf("Invalid since parameter, expected %s", monthLayout), http.StatusBadRequest)
+			return
+		}
+	}
+	recurring, ok := h.recurring(w, r)
+	if ok {
+		writeJSON(w, PriceChanges(recurring, since))
+	}
+}
+
+func (h *Handler) recurring(w http.ResponseWriter, r *http.Request) ([]Recurring, bool) {
+	recurring, err := ActiveRecurring(r.Context(), h.Store, time.Now().UTC())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to read merchant spend", "error", err)
+		apierror.Reply(w, "Failed to read merchant spend", http.StatusInternalServerError)
+		return nil, false
+	}
+	return recurring, true
+}
+
+// ActiveRecurring detects the recurring charges in the merchant spend of the
+// last recurringLookback months, leaving out fees, interest and refunds.
+func ActiveRecurring(ctx context.Context, store Store, now time.Time) ([]Recurring, error) {
+	spend, err := store.Spend(ctx, Query{
+		From:      monthOf(now).AddDate(0, -recurringLookback, 0),
+		To:        monthOf(now).AddDate(0, 1, 0),
+		SpendType: statements.SpendMerchant,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return DetectRecurring(spend, now), nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
@@ -0,0 +1,60 @@
+package merchants
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps the rollup in the <namespace>merchant_spend collection.
+type MongoStore struct {
+	col *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database, namespace string) *MongoStore {
+	return &MongoStore{col: db.Collection(namespace + "merchant_spend")}
+}
+
+// Replace deletes before inserting, like the trend metrics.
+func (s *MongoStore) Replace(ctx context.Context, from, to time.Time, spend []MonthlySpend) error {
+	_, err := s.col.DeleteMany(ctx, bson.M{"month": bson.M{"$gte": from, "$lt": to}})
+	if err != nil || len(spend) == 0 {
+		return err
+	}
+
+	models := make([]mongo.WriteModel, len(spend))
+	for i := range spend {
+		models[i] = mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": spend[i].ID}).
+			SetReplacement(spend[i]).
+			SetUpsert(true)
+	}
+	_, err = s.col.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (s *MongoStore) Spend(ctx context.Context, q Query) ([]MonthlySpend, error) {
+	filter := bson.M{"month": bson.M{"$gte": q.From, "$lt": q.To}}
+	if q.Merchant != "" {
+		filter["merchant"] = q.Merchant
+	}
+	if q.SpendType != "" {
+		filter["spend_type"] = q.SpendType
+	}
+
+	// the ID sorts by month, then merchant and spend type
+	cursor, err := s.col.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	spend := []MonthlySpend{}
+	if err := cursor.All(ctx, &spend); err != nil {
+		return nil, err
+	}
+	return spend, nil
+}
@@ -0,0 +1,116 @@
+package merchants
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const (
+	projectPageSize = 1000
+	// rebuildHorizon bounds a rebuild, far enough for post-dated transactions.
+	rebuildHorizon = 10 * 365 * 24 * time.Hour
+)
+
+// Projector maintains the rollup from the change events: a statement event
+// recomputes the months its transactions fall into. A periodic rebuild catches
+// what the events cannot tell, e.g. the month of a deleted transaction.
+type Projector struct {
+	Repo  statements.StatementRepository
+	Store Store
+
+	mu sync.Mutex
+}
+
+// NewProjector keeps the rollup next to the statements in MongoDB, or in
+// memory for the memory driver.
+func NewProjector(repo statements.StatementRepository) *Projector {
+	var store Store = NewMemoryStore()
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		store = NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return &Projector{Repo: repo, Store: store}
+}
+
+// Publish makes the projector an events sink.
+func (p *Projector) Publish(ctx context.Context, event statements.ChangeEvent) error {
+	switch event.Type {
+	case statements.EventStatementCreated, statements.EventStatementUpdated, statements.EventStatementPaid:
+	default:
+		return nil
+	}
+
+	txs, err := p.Repo.GetTransactions(ctx, event.StatementID)
+	if err != nil || len(txs) == 0 {
+		return err
+	}
+	from, to := monthOf(txs[0].Date), monthOf(txs[0].Date)
+	for i := range txs {
+		if m := monthOf(txs[i].Date); m.Before(from) {
+			from = m
+		} else if m.After(to) {
+			to = m
+		}
+	}
+	return p.Recompute(ctx, from, to.AddDate(0, 1, 0))
+}
+
+func (p *Projector) Rebuild(ctx context.Context, now time.Time) error {
+	return p.Recompute(ctx, time.Time{}, monthOf(now.Add(rebuildHorizon)))
+}
+
+// Recompute aggregates the transactions dated in [from, to), which must be
+// month starts, and replaces the rollup of that range.
+func (p *Projector) Recompute(ctx context.Context, from, to time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	spend := map[string]*MonthlySpend{}
+	filter := statements.TransactionFilter{From: from, To: to}
+	for after := ""; ; {
+		page, err := p.Repo.ListTransactions(ctx, filter, statements.Page{Limit: projectPageSize, After: after})
+		if err != nil {
+			return err
+		}
+		for i := range page {
+			add(spend, &page[i])
+		}
+		if len(page) < projectPageSize {
+			break
+		}
+		after = page[len(page)-1].ID
+	}
+
+	values := make([]MonthlySpend, 0, len(spend))
+	for _, m := range spend {
+		values = append(values, *m)
+	}
+	return p.Store.Replace(ctx, from, to, values)
+}
+
+func add(spend map[string]*MonthlySpend, tx *statements.Transaction) {
+	merchant := Key(tx.Description)
+	if merchant == "" {
+		return
+	}
+	month := monthOf(tx.Date)
+	spendType := statements.ClassifySpend(tx)
+	id := spendID(month, merchant, spendType)
+	m, ok := spend[id]
+	if !ok {
+		m = &MonthlySpend{ID: id, Month: month, Merchant: merchant, SpendType: spendType}
+		spend[id] = m
+	}
+	m.Amount += tx.Amount
+	m.Count++
+	if !tx.Date.Before(m.LastDate) {
+		m.Name, m.LastAmount, m.LastDate = tx.Description, tx.Amount, tx.Date
+	}
+}
+
+func monthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,112 @@
+// Package merchants keeps the spend of every merchant per month, maintained
+// from the change events like the trend metrics, and the analyses that read
+// it instead of scanning the transactions: the merchant breakdown, recurring
+// charges and their price changes.
+package merchants
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// MonthlySpend is the total of one merchant and spend type over a month, the
+// refunds of a merchant adding up apart from its charges.
+type MonthlySpend struct {
+	ID        string               `bson:"_id" json:"-"`
+	Month     time.Time            `bson:"month" json:"month"`
+	Merchant  string               `bson:"merchant" json:"merchant"`
+	SpendType statements.SpendType `bson:"spend_type" json:"spend_type"`
+	// Name is the latest description the merchant appeared with.
+	Name   string  `bson:"name" json:"name"`
+	Amount float64 `bson:"amount" json:"amount"`
+	Count  int     `bson:"count" json:"count"`
+	// LastAmount is the latest charge of the month, what a subscription
+	// costs now.
+	LastAmount float64   `bson:"last_amount" json:"last_amount"`
+	LastDate   time.Time `bson:"last_date" json:"last_date"`
+}
+
+func spendID(month time.Time, merchant string, spendType statements.SpendType) string {
+	return month.Format("2006-01") + "|" + merchant + "|" + string(spendType)
+}
+
+var (
+	merchantNoise = regexp.MustCompile(`[0-9#*/\\-]+`)
+	merchantSpace = regexp.MustCompile(`\s+`)
+)
+
+// Key groups the descriptions of one merchant: card statements add order
+// numbers, dates and terminal IDs to the name.
+func Key(description string) string {
+	key := merchantNoise.ReplaceAllString(strings.ToLower(description), " ")
+	return strings.TrimSpace(merchantSpace.ReplaceAllString(key, " "))
+}
+
+type Query struct {
+	// From is inclusive, To exclusive, both month starts.
+	From      time.Time
+	To        time.Time
+	Merchant  string
+	SpendType statements.SpendType
+}
+
+func (q Query) match(s *MonthlySpend) bool {
+	return !s.Month.Before(q.From) && s.Month.Before(q.To) &&
+		(q.Merchant == "" || s.Merchant == q.Merchant) &&
+		(q.SpendType == "" || s.SpendType == q.SpendType)
+}
+
+// Store keeps the rollup.
+type Store interface {
+	// Replace swaps the rollup of the months in [from, to) for spend.
+	Replace(ctx context.Context, from, to time.Time, spend []MonthlySpend) error
+	// Spend returns the rollup matching q, oldest month first.
+	Spend(ctx context.Context, q Query) ([]MonthlySpend, error)
+}
+
+type MemoryStore struct {
+	mu    sync.RWMutex
+	spend map[string]MonthlySpend
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{spend: make(map[string]MonthlySpend)}
+}
+
+func (s *MemoryStore) Replace(ctx context.Context, from, to time.Time, spend []MonthlySpend) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stale := Query{From: from, To: to}
+	for id, m := range s.spend {
+		if stale.match(&m) {
+			delete(s.spend, id)
+		}
+	}
+	for _, m := range spend {
+		s.spend[m.ID] = m
+	}
+	return nil
+}
+
+func (s *MemoryStore) Spend(ctx context.Context, q Query) ([]MonthlySpend, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []MonthlySpend{}
+	for _, m := range s.spend {
+		if q.match(&m) {
+			result = append(result, m)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
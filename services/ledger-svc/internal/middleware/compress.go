@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// compressor is a gzip or zlib writer, reused across responses.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// encodings are the content codings Compress offers, the preferred first
+// when a client weighs them the same. HTTP deflate is the zlib format.
+var encodings = []struct {
+	name string
+	pool *sync.Pool
+}{
+	{"gzip", &sync.Pool{New: func() any { return gzip.NewWriter(nil) }}},
+	{"deflate", &sync.Pool{New: func() any { return zlib.NewWriter(nil) }}},
+}
+
+// compressible are the content types worth compressing; images, PDFs and
+// archives already are.
+var compressible = []string{"application/json", "application/schema+json", "application/xml", "text/"}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	pool        *sync.Pool
+	c           compressor
+	wroteHeader bool
+}
+
+// WriteHeader decides whether to compress, once the handler set the headers.
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	if compress(status, h) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.encoding)
+		w.c = w.pool.Get().(compressor)
+		w.c.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.c != nil {
+		return w.c.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends what was compressed so far, e.g. a page of a stream.
+func (w *compressWriter) Flush() {
+	if w.c != nil {
+		_ = w.c.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the writer, e.g. to hijack.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) close() {
+	if w.c == nil {
+		return
+	}
+	_ = w.c.Close()
+	w.c.Reset(nil)
+	w.pool.Put(w.c)
+	w.c = nil
+}
+
+func compress(status int, h http.Header) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+	// already encoded, e.g. the export streams, or a range of the content
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	contentType := h.Get("Content-Type")
+	// the events are flushed one by one, too small to gain anything
+	if strings.HasPrefix(contentType, "text/event-stream") {
+		return false
+	}
+	for _, prefix := range compressible {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate returns the index in encodings of the coding the client weighs
+// most in Accept-Encoding, -1 when it accepts none of them.
+func negotiate(r *http.Request) int {
+	best, bestQ := -1, 0.0
+	for part := range strings.SplitSeq(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		for i, e := range encodings {
+			if (coding == e.name || coding == "*") && (q > bestQ || q == bestQ && i < best) {
+				best, bestQ = i, q
+			}
+		}
+	}
+	return best
+}
+
+// Compress compresses the JSON and text responses with gzip or deflate, as
+// negotiated with Accept-Encoding. Responses the handlers encoded themselves
+// are left alone.
+func Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		i := negotiate(r)
+		if r.Method == http.MethodHead || i < 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encodings[i].name, pool: encodings[i].pool}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
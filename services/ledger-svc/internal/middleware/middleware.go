@@ -0,0 +1,27 @@
+// Package middleware composes the middlewares wrapping the API into a Chain
+// and provides the generic ones: Recover answers a panicking handler with a
+// 500 instead of dropping the connection, Compress compresses the responses.
+package middleware
+
+import "net/http"
+
+// Middleware wraps a handler, e.g. accesslog.Middleware.
+type Middleware func(http.Handler) http.Handler
+
+// Chain is a stack of middlewares, the outermost first: requests go through
+// them in order, responses in reverse.
+type Chain []Middleware
+
+// Then wraps h in the middlewares of the chain.
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		h = c[i](h)
+	}
+	return h
+}
+
+// With returns the chain followed by the middlewares, for those optional ones
+// configured at startup.
+func (c Chain) With(m ...Middleware) Chain {
+	return append(c[:len(c):len(c)], m...)
+}
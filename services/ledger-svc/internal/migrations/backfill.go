@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const backfillBatchSize = 1000
+
+// backfillSpendTypes derives the spend type of the transactions stored before
+// it was derived at normalization. It only sets missing values, so a rerun
+// after an interruption picks up where it stopped.
+func backfillSpendTypes(ctx context.Context, db *mongo.Database, namespace string) error {
+	col := db.Collection(namespace + "transactions")
+	cursor, err := col.Find(ctx, bson.M{"spend_type": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"description": 1, "amount": 1, "payment_source": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var models []mongo.WriteModel
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		_, err := col.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		models = models[:0]
+		return err
+	}
+	for cursor.Next(ctx) {
+		var tx statements.Transaction
+		if err := cursor.Decode(&tx); err != nil {
+			return err
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": tx.ID, "spend_type": bson.M{"$exists": false}}).
+			SetUpdate(bson.M{"$set": bson.M{"spend_type": statements.ClassifySpend(&tx)}}))
+		if len(models) == backfillBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// copyField sets the field to the value of another on the documents of the
+// collection stored without it, e.g. the key moved out of _id.
+func copyField(collection, from, to string) func(ctx context.Context, db *mongo.Database, namespace string) error {
+	return func(ctx context.Context, db *mongo.Database, namespace string) error {
+		_, err := db.Collection(namespace+collection).UpdateMany(ctx,
+			bson.M{to: bson.M{"$exists": false}},
+			mongo.Pipeline{{{Key: "$set", Value: bson.M{to: "$" + from}}}})
+		return err
+	}
+}
@@ -0,0 +1,295 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var All = []Migration{
+	{
+		ID:          "0001_transactions_statement_id",
+		Description: "index transactions by statement for expansion and keyset pagination",
+		Up: createIndex("transactions", mongo.IndexModel{
+			Keys:    bson.D{{Key: "statement_id", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("statement_id_1__id_1"),
+		}),
+	},
+	{
+		ID:          "0002_transactions_description_text",
+		Description: "text index on transaction descriptions",
+		Up: createIndex("transactions", mongo.IndexModel{
+			Keys:    bson.D{{Key: "description", Value: "text"}},
+			Options: options.Index().SetName("description_text"),
+		}),
+	},
+	{
+		ID:          "0003_transactions_date",
+		Description: "index transactions by date for range queries and exports",
+		Up: createIndex("transactions", mongo.IndexModel{
+			Keys:    bson.D{{Key: "date", Value: 1}},
+			Options: options.Index().SetName("date_1"),
+		}),
+	},
+	{
+		ID:          "0004_statements_source_due_date",
+		Description: "index statements by source and due date for listings",
+		Up: createIndex("statements", mongo.IndexModel{
+			Keys:    bson.D{{Key: "source_name", Value: 1}, {Key: "payment_due_date", Value: 1}},
+			Options: options.Index().SetName("source_name_1_payment_due_date_1"),
+		}),
+	},
+	{
+		ID:          "0005_statements_source_unique",
+		Description: "unique statement per source name and source id",
+		Up: createIndex("statements", mongo.IndexModel{
+			Keys: bson.D{{Key: "source_name", Value: 1}, {Key: "source_id", Value: 1}},
+			Options: options.Index().
+				SetName("source_name_1_source_id_1_unique").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"source_id": bson.M{"$type": "string"}}),
+		}),
+	},
+	{
+		ID:          "0006_outbox_pending",
+		Description: "index undispatched outbox events in order",
+		Up: createIndex("outbox", mongo.IndexModel{
+			Keys:    bson.D{{Key: "dispatched", Value: 1}, {Key: "occurred_at", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("dispatched_1_occurred_at_1__id_1"),
+		}),
+	},
+	{
+		ID:          "0007_outbox_dispatched_ttl",
+		Description: "expire dispatched outbox events after a week",
+		Up: createIndex("outbox", mongo.IndexModel{
+			Keys:    bson.D{{Key: "dispatched_at", Value: 1}},
+			Options: options.Index().SetName("dispatched_at_ttl").SetExpireAfterSeconds(7 * 24 * 60 * 60),
+		}),
+	},
+	{
+		ID:          "0008_audit_log_entity",
+		Description: "index the audit log by entity, newest first",
+		Up: createIndex("audit_log", mongo.IndexModel{
+			Keys:    bson.D{{Key: "entity_id", Value: 1}, {Key: "at", Value: -1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("entity_id_1_at_-1__id_-1"),
+		}),
+	},
+	{
+		ID:          "0009_metrics_granularity_period",
+		Description: "index trend metrics by granularity and period",
+		Up: createIndex("metrics", mongo.IndexModel{
+			Keys:    bson.D{{Key: "granularity", Value: 1}, {Key: "period", Value: 1}},
+			Options: options.Index().SetName("granularity_1_period_1"),
+		}),
+	},
+	{
+		ID:          "0010_transactions_archive_statement",
+		Description: "index archived transactions by statement",
+		Up: createIndex("transactions_archive", mongo.IndexModel{
+			Keys:    bson.D{{Key: "statement_id", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("statement_id_1__id_1"),
+		}),
+	},
+	{
+		ID:          "0011_transactions_external_refs",
+		Description: "index transactions by external reference",
+		Up: createIndex("transactions", mongo.IndexModel{
+			Keys:    bson.D{{Key: "external_refs.value", Value: 1}, {Key: "external_refs.type", Value: 1}},
+			Options: options.Index().SetName("external_refs.value_1_external_refs.type_1"),
+		}),
+	},
+	{
+		ID:          "0012_ingest_runs_source_started_at",
+		Description: "index ingest runs by source, newest first",
+		Up: createIndex("ingest_runs", mongo.IndexModel{
+			Keys:    bson.D{{Key: "source", Value: 1}, {Key: "started_at", Value: -1}},
+			Options: options.Index().SetName("source_1_started_at_-1"),
+		}),
+	},
+	{
+		ID:          "0013_merchant_spend_merchant_month",
+		Description: "index the merchant spend rollup by merchant and month",
+		Up: createIndex("merchant_spend", mongo.IndexModel{
+			Keys:    bson.D{{Key: "merchant", Value: 1}, {Key: "month", Value: 1}},
+			Options: options.Index().SetName("merchant_1_month_1"),
+		}),
+	},
+	{
+		ID:          "0014_attachments_statement_id",
+		Description: "index the attachment files by statement",
+		Up: createIndex("attachments.files", mongo.IndexModel{
+			Keys:    bson.D{{Key: "metadata.statement_id", Value: 1}, {Key: "uploadDate", Value: 1}},
+			Options: options.Index().SetName("metadata.statement_id_1_uploadDate_1"),
+		}),
+	},
+	{
+		ID:          "0015_transactions_blind_indexes",
+		Description: "find client-encrypted transactions by blind index",
+		Up: createIndex("transactions", mongo.IndexModel{
+			Keys:    bson.D{{Key: "blind_indexes", Value: 1}},
+			Options: options.Index().SetName("blind_indexes_1").SetSparse(true),
+		}),
+	},
+	{
+		ID:          "0016_transactions_spend_type_backfill",
+		Description: "derive the spend type of the transactions stored without one",
+		Up:          backfillSpendTypes,
+	},
+	{
+		ID:          "0017_transactions_spend_type_date",
+		Description: "index transactions by spend type and date for the spend type filters",
+		Up: createIndex("transactions", mongo.IndexModel{
+			Keys:    bson.D{{Key: "spend_type", Value: 1}, {Key: "date", Value: 1}},
+			Options: options.Index().SetName("spend_type_1_date_1"),
+		}),
+	},
+	{
+		ID:          "0018_transactions_dispute_status",
+		Description: "find the disputed transactions by status",
+		Up: createIndex("transactions", mongo.IndexModel{
+			Keys:    bson.D{{Key: "dispute.status", Value: 1}},
+			Options: options.Index().SetName("dispute.status_1").SetSparse(true),
+		}),
+	},
+	{
+		ID:          "0019_credit_utilization_account_due_date",
+		Description: "read the credit utilization history of an account by due date",
+		Up: createIndex("credit_utilization", mongo.IndexModel{
+			Keys:    bson.D{{Key: "account", Value: 1}, {Key: "due_date", Value: 1}},
+			Options: options.Index().SetName("account_1_due_date_1"),
+		}),
+	},
+	{
+		ID:          "0020_webhook_deliveries_due",
+		Description: "find the webhook deliveries due for an attempt",
+		Up: createIndex("webhook_deliveries", mongo.IndexModel{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+			Options: options.Index().SetName("status_1_next_attempt_at_1"),
+		}),
+	},
+	{
+		ID:          "0021_webhook_deliveries_subscription",
+		Description: "list the delivery log of a webhook subscription",
+		Up: createIndex("webhook_deliveries", mongo.IndexModel{
+			Keys:    bson.D{{Key: "subscription_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("subscription_id_1_created_at_-1"),
+		}),
+	},
+	{
+		ID:          "0022_aggregator_connections_item_unique",
+		Description: "one connection per aggregator item",
+		Up: createIndex("aggregator_connections", mongo.IndexModel{
+			Keys: bson.D{{Key: "provider", Value: 1}, {Key: "item_id", Value: 1}},
+			Options: options.Index().
+				SetName("provider_1_item_id_1_unique").
+				SetUnique(true),
+		}),
+	},
+	{
+		ID:          "0023_statements_user_due_date",
+		Description: "list the statements of a user by due date",
+		Up: createIndex("statements", mongo.IndexModel{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "payment_due_date", Value: 1}},
+			Options: options.Index().SetName("user_id_1_payment_due_date_1"),
+		}),
+	},
+	{
+		ID:          "0024_transactions_user_id",
+		Description: "page through the transactions of a user",
+		Up: createIndex("transactions", mongo.IndexModel{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("user_id_1__id_1"),
+		}),
+	},
+	{
+		ID:          "0025_statements_tenant_user_due_date",
+		Description: "list the statements of a tenant and user by due date",
+		Up: createIndex("statements", mongo.IndexModel{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "payment_due_date", Value: 1}},
+			Options: options.Index().SetName("tenant_id_1_user_id_1_payment_due_date_1"),
+		}),
+	},
+	{
+		ID:          "0026_transactions_tenant_user_id",
+		Description: "page through the transactions of a tenant and user",
+		Up: createIndex("transactions", mongo.IndexModel{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("tenant_id_1_user_id_1__id_1"),
+		}),
+	},
+	{
+		ID:          "0027_sessions_expires_ttl",
+		Description: "expire login sessions",
+		Up: createIndex("sessions", mongo.IndexModel{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+		}),
+	},
+	{
+		ID:          "0028_statements_owner_source_unique",
+		Description: "unique statement per owner, source name and source id, replacing the global one",
+		Up: rebuildIndex("statements", "source_name_1_source_id_1_unique", mongo.IndexModel{
+			Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "source_name", Value: 1}, {Key: "source_id", Value: 1}},
+			Options: options.Index().
+				SetName("tenant_id_1_user_id_1_source_name_1_source_id_1_unique").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"source_id": bson.M{"$type": "string"}}),
+		}),
+	},
+	{
+		ID:          "0029_category_taxonomy_owner_version",
+		Description: "key the taxonomy versions by owner and version",
+		Up: func(ctx context.Context, db *mongo.Database, namespace string) error {
+			if err := copyField("category_taxonomy", "_id", "version")(ctx, db, namespace); err != nil {
+				return err
+			}
+			return createIndex("category_taxonomy", mongo.IndexModel{
+				Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "version", Value: -1}},
+				Options: options.Index().SetName("tenant_id_1_user_id_1_version_-1_unique").SetUnique(true),
+			})(ctx, db, namespace)
+		},
+	},
+	{
+		ID:          "0030_reminder_preferences_source",
+		Description: "key the reminder preferences by owner and source",
+		Up:          copyField("reminder_preferences", "_id", "source"),
+	},
+	{
+		ID:          "0031_statements_owner_source_index_unique",
+		Description: "unique statement per owner, source name and blind index of the encrypted source id",
+		Up: createIndex("statements", mongo.IndexModel{
+			Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "source_name", Value: 1}, {Key: "source_index", Value: 1}},
+			Options: options.Index().
+				SetName("tenant_id_1_user_id_1_source_name_1_source_index_1_unique").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"source_index": bson.M{"$type": "string"}}),
+		}),
+	},
+}
+
+func createIndex(collection string, model mongo.IndexModel) func(ctx context.Context, db *mongo.Database, namespace string) error {
+	return func(ctx context.Context, db *mongo.Database, namespace string) error {
+		_, err := db.Collection(namespace+collection).Indexes().CreateOne(ctx, model)
+		return err
+	}
+}
+
+// rebuildIndex creates the index, then drops the one it replaces, so the
+// collection is never left without either.
+func rebuildIndex(collection, old string, model mongo.IndexModel) func(ctx context.Context, db *mongo.Database, namespace string) error {
+	return func(ctx context.Context, db *mongo.Database, namespace string) error {
+		indexes := db.Collection(namespace + collection).Indexes()
+		if _, err := indexes.CreateOne(ctx, model); err != nil {
+			return err
+		}
+		// IndexNotFound when the old index was dropped by hand
+		var cmdErr mongo.CommandError
+		if _, err := indexes.DropOne(ctx, old); err != nil && !(errors.As(err, &cmdErr) && cmdErr.Code == 27) {
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,70 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const collectionName = "schema_migrations"
+
+// Migration is one idempotent schema step. Migrations run in slice order and
+// each ID is applied at most once per namespace.
+type Migration struct {
+	ID          string
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database, namespace string) error
+}
+
+type appliedMigration struct {
+	ID          string    `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// Run applies every migration of All that is not yet recorded in the
+// schema_migrations collection and returns the IDs it applied.
+func Run(ctx context.Context, db *mongo.Database, namespace string) ([]string, error) {
+	return run(ctx, db, namespace, All)
+}
+
+func run(ctx context.Context, db *mongo.Database, namespace string, migrations []Migration) ([]string, error) {
+	col := db.Collection(namespace + collectionName)
+
+	cursor, err := col.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	var applied []appliedMigration
+	if err := cursor.All(ctx, &applied); err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	done := make(map[string]bool, len(applied))
+	for _, m := range applied {
+		done[m.ID] = true
+	}
+
+	var ran []string
+	for _, m := range migrations {
+		if done[m.ID] {
+			continue
+		}
+
+		slog.Info("Applying migration", "id", m.ID, "description", m.Description, "namespace", namespace)
+		if err := m.Up(ctx, db, namespace); err != nil {
+			return ran, fmt.Errorf("migration %s failed: %w", m.ID, err)
+		}
+
+		_, err := col.InsertOne(ctx, appliedMigration{ID: m.ID, Description: m.Description, AppliedAt: time.Now().UTC()})
+		// another replica may have recorded the same migration concurrently
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return ran, fmt.Errorf("failed to record migration %s: %w", m.ID, err)
+		}
+		ran = append(ran, m.ID)
+	}
+	return ran, nil
+}
@@ -0,0 +1,320 @@
+// Package money parses amounts the way statements print them and formats
+// amounts for people and files, so importers, reports and notifications agree
+// on both.
+package money
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+var ErrInvalidAmount = apierror.New(apierror.KindInvalid, "invalid_amount", "invalid amount")
+
+// Locale is how a statement separates the decimals and the thousands.
+type Locale struct {
+	Decimal rune
+	Group   rune
+}
+
+var (
+	// Auto guesses the separators from the amount itself, see Parse.
+	Auto = Locale{}
+	// Dot is 1,234.56, as printed in English and the CJK locales.
+	Dot = Locale{Decimal: '.', Group: ','}
+	// Comma is 1.234,56, as printed in most of continental Europe.
+	Comma = Locale{Decimal: ',', Group: '.'}
+)
+
+// LocaleOf returns the separators of a language tag like "de" or "zh-TW",
+// Auto for an empty or unknown one.
+func LocaleOf(tag string) Locale {
+	lang, _, _ := strings.Cut(strings.ToLower(strings.ReplaceAll(tag, "_", "-")), "-")
+	switch lang {
+	case "en", "zh", "ja", "ko", "th", "ms":
+		return Dot
+	case "de", "fr", "es", "it", "nl", "pt", "id", "tr", "vi", "ru", "pl", "da", "sv", "nb", "fi":
+		return Comma
+	}
+	return Auto
+}
+
+// Parse reads an amount with Auto separators.
+func Parse(s string) (float64, error) {
+	return ParseLocale(s, Auto)
+}
+
+// ParseLocale reads an amount as printed on a statement: with a currency
+// symbol or code, thousands separators, full-width digits, a negative written
+// as -1, (1) or 1- and credits marked CR. Amounts written in CJK numerals, e.g.
+// 一萬二千三百元 or 1.5萬, are read too.
+//
+// With Auto, the last of "." and "," is the decimal separator when both
+// appear; a single separator followed by exactly three digits groups
+// thousands, any other is the decimal separator.
+func ParseLocale(s string, locale Locale) (float64, error) {
+	text := strings.TrimSpace(toHalfWidth(s))
+	if text == "" {
+		return 0, fmt.Errorf("%w: empty", ErrInvalidAmount)
+	}
+
+	negative := false
+	upper := strings.ToUpper(text)
+	switch {
+	case strings.HasSuffix(upper, "CR"):
+		negative, text = true, strings.TrimSpace(text[:len(text)-2])
+	case strings.HasSuffix(upper, "DR"):
+		text = strings.TrimSpace(text[:len(text)-2])
+	}
+	if strings.HasPrefix(text, "(") && strings.HasSuffix(text, ")") {
+		negative, text = !negative, text[1:len(text)-1]
+	}
+	text = stripCurrency(text)
+	if strings.HasSuffix(text, "-") {
+		negative, text = !negative, strings.TrimSpace(strings.TrimSuffix(text, "-"))
+	} else if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "−") {
+		_, size := firstRune(text)
+		negative, text = !negative, strings.TrimSpace(stripCurrency(text[size:]))
+	} else if strings.HasPrefix(text, "+") {
+		text = strings.TrimSpace(stripCurrency(text[1:]))
+	}
+
+	var amount float64
+	var err error
+	if strings.ContainsFunc(text, isCJKNumeral) {
+		amount, err = parseCJK(text, locale)
+	} else {
+		amount, err = parseDigits(text, locale)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", err, s)
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+func firstRune(s string) (rune, int) {
+	for _, r := range s {
+		return r, len(string(r))
+	}
+	return 0, 0
+}
+
+// toHalfWidth maps full-width digits, signs and separators to ASCII.
+func toHalfWidth(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '！' && r <= '～' {
+			return r - '！' + '!'
+		}
+		if r == '　' {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+var currencyAffixes = []string{
+	"NT$", "NTD", "TWD", "US$", "USD", "HK$", "HKD", "JPY", "CNY", "RMB", "EUR", "GBP",
+	"$", "€", "£", "¥", "￥", "₩", "元", "圓", "円",
+}
+
+// stripCurrency removes one currency symbol or code before and after the
+// amount.
+func stripCurrency(s string) string {
+	s = strings.TrimSpace(s)
+	for _, affix := range currencyAffixes {
+		if len(s) >= len(affix) && strings.EqualFold(s[:len(affix)], affix) {
+			s = strings.TrimSpace(s[len(affix):])
+			break
+		}
+	}
+	for _, affix := range currencyAffixes {
+		if len(s) >= len(affix) && strings.EqualFold(s[len(s)-len(affix):], affix) {
+			s = strings.TrimSpace(s[:len(s)-len(affix)])
+			break
+		}
+	}
+	return s
+}
+
+func parseDigits(s string, locale Locale) (float64, error) {
+	if s == "" {
+		return 0, ErrInvalidAmount
+	}
+	decimal := locale.Decimal
+	if locale == Auto {
+		decimal = guessDecimal(s)
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == decimal:
+			b.WriteByte('.')
+		case r == ',' || r == '.' || r == '\'' || r == ' ' || r == ' ' || r == ' ':
+			// grouping
+		default:
+			return 0, ErrInvalidAmount
+		}
+	}
+	amount, err := strconv.ParseFloat(b.String(), 64)
+	if err != nil {
+		return 0, ErrInvalidAmount
+	}
+	return amount, nil
+}
+
+// guessDecimal picks the decimal separator of an amount in an unknown locale.
+func guessDecimal(s string) rune {
+	lastDot, lastComma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		if lastDot > lastComma {
+			return '.'
+		}
+		return ','
+	case lastDot < 0 && lastComma < 0:
+		return '.'
+	}
+	sep, last := '.', lastDot
+	if lastComma >= 0 {
+		sep, last = ',', lastComma
+	}
+	// 1,234,567 and 1.234 group thousands, 12,5 and 0.125 do not
+	if strings.Count(s, string(sep)) > 1 || len(s)-last-1 == 3 && strings.Trim(s[:last], "0 ") != "" {
+		return 0
+	}
+	return sep
+}
+
+var cjkDigits = map[rune]int{
+	'〇': 0, '零': 0, '一': 1, '壹': 1, '二': 2, '貳': 2, '贰': 2, '兩': 2, '两': 2,
+	'三': 3, '參': 3, '叁': 3, '四': 4, '肆': 4, '五': 5, '伍': 5, '六': 6, '陸': 6, '陆': 6,
+	'七': 7, '柒': 7, '八': 8, '捌': 8, '九': 9, '玖': 9,
+}
+
+var cjkSmallUnits = map[rune]float64{
+	'十': 10, '拾': 10, '百': 100, '佰': 100, '千': 1000, '仟': 1000,
+}
+
+var cjkLargeUnits = map[rune]float64{
+	'萬': 1e4, '万': 1e4, '億': 1e8, '亿': 1e8,
+}
+
+func isCJKNumeral(r rune) bool {
+	_, digit := cjkDigits[r]
+	_, small := cjkSmallUnits[r]
+	_, large := cjkLargeUnits[r]
+	return digit || small || large
+}
+
+// parseCJK reads numerals like 一萬二千三百四十五, 十二, 3萬2千 or 1.5萬. Arabic
+// digits may stand in for the CJK ones; units without a digit, like 萬, are
+// not an amount.
+func parseCJK(s string, locale Locale) (float64, error) {
+	var total, section, number float64
+	var digits strings.Builder
+	hasDigit := false
+	flush := func() error {
+		if digits.Len() == 0 {
+			return nil
+		}
+		n, err := parseDigits(digits.String(), locale)
+		digits.Reset()
+		number, hasDigit = n, true
+		return err
+	}
+
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r >= '0' && r <= '9' || r == '.' || r == ',':
+			digits.WriteRune(r)
+			continue
+		case unicode.IsSpace(r):
+			continue
+		}
+		if err := flush(); err != nil {
+			return 0, err
+		}
+		if d, ok := cjkDigits[r]; ok {
+			number, hasDigit = float64(d), true
+		} else if unit, ok := cjkSmallUnits[r]; ok {
+			if number == 0 {
+				// 十二 is twelve
+				number = 1
+			}
+			section += number * unit
+			number = 0
+		} else if unit, ok := cjkLargeUnits[r]; ok {
+			total += (section + number) * unit
+			section, number = 0, 0
+		} else {
+			return 0, ErrInvalidAmount
+		}
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+	if !hasDigit {
+		return 0, ErrInvalidAmount
+	}
+	return total + section + number, nil
+}
+
+// Round rounds to cents, the precision amounts are compared and reported in.
+func Round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// MinorUnits is the number of decimals of a currency, 2 unless it has no
+// minor unit in practice.
+func MinorUnits(currency string) int {
+	switch strings.ToUpper(currency) {
+	case "JPY", "KRW", "VND", "CLP", "ISK", "IDR":
+		return 0
+	}
+	return 2
+}
+
+// FormatPlain is the amount as files and machines read it, 1234.50.
+func FormatPlain(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+// Format is the amount for people in the locale, grouped and with the
+// decimals of the currency, followed by the currency code: 1,234.50 TWD.
+func Format(amount float64, currency string, locale Locale) string {
+	if locale == Auto {
+		locale = Dot
+	}
+	digits := strconv.FormatFloat(math.Abs(amount), 'f', MinorUnits(currency), 64)
+	whole, fraction, _ := strings.Cut(digits, ".")
+
+	var b strings.Builder
+	if amount < 0 && strings.Trim(digits, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteRune(locale.Group)
+		}
+		b.WriteRune(r)
+	}
+	if fraction != "" {
+		b.WriteRune(locale.Decimal)
+		b.WriteString(fraction)
+	}
+	if currency != "" {
+		b.WriteByte(' ')
+		b.WriteString(strings.ToUpper(currency))
+	}
+	return b.String()
+}
@@ -0,0 +1,82 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseLocale(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in     string
+		locale Locale
+		want   float64
+	}{
+		// currency symbols and codes, before or after
+		{"NT$1,234", Auto, 1234},
+		{"TWD 1,234.50", Auto, 1234.5},
+		{"1,234.50 USD", Auto, 1234.5},
+		{"€ 12,50", Auto, 12.5},
+		{"¥3,000", Auto, 3000},
+		{"1,234元", Auto, 1234},
+		// full-width digits and separators
+		{"１，２３４．５", Auto, 1234.5},
+		{"－５００", Auto, -500},
+		// negatives and credits
+		{"-1,234", Auto, -1234},
+		{"(1,234)", Auto, -1234},
+		{"1,234-", Auto, -1234},
+		{"1,234.00 CR", Auto, -1234},
+		{"1,234.00 DR", Auto, 1234},
+		{"-NT$100", Auto, -100},
+		{"NT$-100", Auto, -100},
+		{"+100", Auto, 100},
+		// CJK numerals
+		{"一萬二千三百元", Auto, 12300},
+		{"一萬二千三百四十五", Auto, 12345},
+		{"十二", Auto, 12},
+		{"3萬2千", Auto, 32000},
+		{"1.5萬", Auto, 15000},
+		{"壹佰", Auto, 100},
+		{"兩億", Auto, 2e8},
+		// Auto: the last of . and , is the decimal separator when both appear
+		{"1,234.56", Auto, 1234.56},
+		{"1.234,56", Auto, 1234.56},
+		// Auto: a single separator followed by three digits groups thousands
+		{"1,234", Auto, 1234},
+		{"1.234", Auto, 1234},
+		{"1,234,567", Auto, 1234567},
+		// Auto: any other single separator is the decimal one
+		{"12,5", Auto, 12.5},
+		{"0.125", Auto, 0.125},
+		{"1234.5", Auto, 1234.5},
+		// explicit locales
+		{"1.234", Comma, 1234},
+		{"1,234", Comma, 1.234},
+		{"1.234", Dot, 1.234},
+		{"1,234", Dot, 1234},
+		{"1 234,56", Comma, 1234.56},
+		{"1'234.56", Dot, 1234.56},
+	}
+	for _, tt := range tests {
+		got, err := ParseLocale(tt.in, tt.locale)
+		if err != nil {
+			t.Errorf("ParseLocale(%q) error = %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLocale(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseRejectsNonAmounts(t *testing.T) {
+	t.Parallel()
+
+	for _, in := range []string{"", " ", "abc", "NT$", "1.2.3,4,5", "萬", "千百", "元", "12a"} {
+		if got, err := Parse(in); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("Parse(%q) = %v, %v, want ErrInvalidAmount", in, got, err)
+		}
+	}
+}
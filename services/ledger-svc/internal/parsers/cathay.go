@@ -0,0 +1,188 @@
+package parsers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/importers"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+func init() {
+	Register("cathay", Cathay{})
+}
+
+// Cathay reads the credit card e-statements of Cathay United Bank. Unlike
+// Taishin's, the transaction table prints dates without the year and a card
+// column on every line instead of a line per card.
+type Cathay struct{}
+
+func (Cathay) Match(from, filename string) bool {
+	_, domain, _ := strings.Cut(from, "@")
+	return domain == "cathaybk.com.tw" || strings.HasSuffix(domain, ".cathaybk.com.tw")
+}
+
+const cathayAmount = `(?:NT\$)?\s*(-?\d[\d,]*)`
+
+var cathayBillInfo = map[string]*regexp.Regexp{
+	"本期帳單結帳日":  regexp.MustCompile(`本期帳單結帳日\s*(\d+/\d+/\d+)`),
+	"本期繳款截止日":  regexp.MustCompile(`本期繳款截止日\s*(\d+/\d+/\d+)`),
+	"本期應繳總金額":  regexp.MustCompile(`本期應繳總金額\s*` + cathayAmount),
+	"本期最低應繳金額": regexp.MustCompile(`本期最低應繳金額\s*` + cathayAmount),
+	"上期應繳總金額":  regexp.MustCompile(`上期應繳總金額\s*` + cathayAmount),
+	"上期已繳金額":   regexp.MustCompile(`上期已繳金額\s*` + cathayAmount),
+	"本期新增款項":   regexp.MustCompile(`本期新增款項\s*` + cathayAmount),
+	// 小樹點(信用卡)
+	"本期新增點數": regexp.MustCompile(`本期新增點數\s*(-?\d[\d,]*)`),
+	"本期使用點數": regexp.MustCompile(`本期使用點數\s*(-?\d[\d,]*)`),
+	"本期結餘點數": regexp.MustCompile(`本期結餘點數\s*(-?\d[\d,]*)`),
+	"到期點數":   regexp.MustCompile(`(\d[\d,]*)\s*點將於\s*\d+/\d+/\d+\s*到期`),
+	"點數到期日":  regexp.MustCompile(`點將於\s*(\d+/\d+/\d+)\s*到期`),
+}
+
+func (Cathay) Parse(text string) (*statements.Statement, error) {
+	bill := fields(text, cathayBillInfo)
+	closing, err := parseROCDate(bill["本期帳單結帳日"])
+	if err != nil {
+		return nil, fmt.Errorf("closing date (本期帳單結帳日): %w", err)
+	}
+	total := amountOf(bill, "本期應繳總金額")
+	if total == nil {
+		return nil, errors.New("no amount due (本期應繳總金額) in the statement")
+	}
+
+	sourceID := rocSourceID(closing)
+	stmt := &statements.Statement{
+		Type:              statements.CreditCardBill,
+		SourceType:        statements.CreditCard,
+		SourceName:        "CATHAY",
+		SourceID:          &sourceID,
+		TotalAmount:       *total,
+		PreviousAmount:    amountOf(bill, "上期應繳總金額"),
+		CurrentAmount:     amountOf(bill, "本期新增款項"),
+		Currency:          "TWD",
+		MinimumPaymentDue: amountOf(bill, "本期最低應繳金額"),
+	}
+	// printed as a negative amount, the ledger keeps what was paid
+	if paid := amountOf(bill, "上期已繳金額"); paid != nil {
+		*paid = -*paid
+		stmt.PreviousPaid = paid
+	}
+	if due, err := parseROCDate(bill["本期繳款截止日"]); err == nil {
+		stmt.PaymentDueDate = &due
+	}
+	if balance := amountOf(bill, "本期結餘點數"); balance != nil {
+		points := func(key string) float64 {
+			if v := amountOf(bill, key); v != nil {
+				return *v
+			}
+			return 0
+		}
+		stmt.Rewards = &statements.Rewards{
+			PointsEarned:   points("本期新增點數"),
+			PointsRedeemed: points("本期使用點數"),
+			PointsBalance:  balance,
+			PointsExpiring: points("到期點數"),
+		}
+		if expiry, err := parseROCDate(bill["點數到期日"]); err == nil {
+			stmt.Rewards.PointsExpiryDate = &expiry
+		}
+	}
+
+	transactions, err := cathayTransactions(text, closing, importers.NewIDs("cathay", sourceID))
+	if err != nil {
+		return nil, err
+	}
+	stmt.Transactions = &transactions
+	return stmt, nil
+}
+
+var (
+	cathayHeader = regexp.MustCompile(`交易日\s*入帳日\s*交易說明\s*臺幣金額\s*卡號末四碼\s*行動卡號末四碼\s*消費國家\s*幣別\s*外幣金額\s*折算日`)
+	// 交易日, 入帳日, 交易說明, 臺幣金額, 卡號末四碼 and 行動卡號末四碼,
+	// 消費國家, then 幣別, 外幣金額 and 折算日 of foreign transactions
+	cathayLine = regexp.MustCompile(`^(\d{2}/\d{2})\s+(\d{2}/\d{2})\s+(.+?)\s+(-?\d[\d,]*)(?:\s+(\d{4}))?(?:\s+(\d{4}))?(?:\s+([A-Z]{2}))?(?:\s+([A-Z]{3})\s+(-?\d[\d,]*\.\d+)\s+\d{2}/\d{2})?$`)
+	cathayEnd  = regexp.MustCompile(`^本期(?:消費)?合計`)
+)
+
+// cathayTransactions reads the table after the 交易日 header up to its total
+// line. Payments and fees have no card.
+func cathayTransactions(text string, closing time.Time, ids *importers.IDs) ([]statements.Transaction, error) {
+	loc := cathayHeader.FindStringIndex(text)
+	if loc == nil {
+		slog.Warn("No transaction table in the Cathay statement")
+		return []statements.Transaction{}, nil
+	}
+
+	transactions := []statements.Transaction{}
+	for _, line := range strings.Split(text[loc[1]:], "\n")[1:] {
+		line = strings.TrimSpace(line)
+		if cathayEnd.MatchString(line) {
+			break
+		}
+		m := cathayLine.FindStringSubmatch(line)
+		if m == nil {
+			// page headers and footers inside the table
+			continue
+		}
+
+		date, err := cathayDate(m[1], closing)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %q: %w", line, err)
+		}
+		amount, err := parseAmount(m[4])
+		if err != nil {
+			return nil, fmt.Errorf("transaction %q: %w", line, err)
+		}
+		tx := statements.Transaction{
+			Description:     strings.TrimSpace(m[3]),
+			Amount:          amount,
+			Date:            date,
+			MerchantCountry: m[7],
+			Currency:        m[8],
+			IsForeign:       isForeign(m[7], m[8]),
+		}
+		extra := map[string]any{}
+		if m[5] != "" {
+			extra["card_last_four"] = m[5]
+		}
+		if m[6] != "" {
+			extra["mobile_card_last_four"] = m[6]
+		}
+		if m[9] != "" {
+			if extra["foreign_amount"], err = parseAmount(m[9]); err != nil {
+				return nil, fmt.Errorf("transaction %q: %w", line, err)
+			}
+		}
+		if len(extra) > 0 {
+			tx.Extra = extra
+		}
+		tx.ID = ids.Next(m[5], tx.Date.Format(time.DateOnly), fmt.Sprintf("%.2f", tx.Amount), tx.Description)
+		transactions = append(transactions, tx)
+	}
+	return transactions, nil
+}
+
+// cathayDate reads a MM/DD date of the statement closing on closing; months
+// after the closing one belong to the year before.
+func cathayDate(s string, closing time.Time) (time.Time, error) {
+	month, errM := strconv.Atoi(s[:2])
+	day, errD := strconv.Atoi(s[3:])
+	if errM != nil || errD != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+	year := closing.Year()
+	if time.Month(month) > closing.Month() {
+		year--
+	}
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if t.Month() != time.Month(month) || t.Day() != day {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,28 @@
+package parsers
+
+import (
+	"os"
+	"strings"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/mailbox"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// mailParser serves a parser to the mailbox poller. The PDF password of an
+// issuer is read from ESTATEMENT_PASSWORD_<NAME>, e.g. ESTATEMENT_PASSWORD_TSIB.
+type mailParser struct {
+	name   string
+	parser Parser
+}
+
+func (p mailParser) Match(msg *mailbox.Message, att *mailbox.Attachment) bool {
+	return p.parser.Match(msg.From, att.Filename)
+}
+
+func (p mailParser) Parse(msg *mailbox.Message, att *mailbox.Attachment) (*statements.Statement, error) {
+	text, err := Text(att.Data, os.Getenv("ESTATEMENT_PASSWORD_"+strings.ToUpper(p.name)))
+	if err != nil {
+		return nil, err
+	}
+	return p.parser.Parse(text)
+}
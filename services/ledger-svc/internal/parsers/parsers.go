@@ -0,0 +1,143 @@
+// Package parsers reads the PDF e-statements of card issuers, a Go port of
+// the statement fetcher's processors. Every issuer implements Parser over
+// the text Text extracts from the PDF, and registered parsers serve the
+// mailbox poller.
+package parsers
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/mailbox"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Parser reads the statements of one issuer.
+type Parser interface {
+	// Match reports whether a PDF the sender mailed under the file name is one
+	// of the issuer's statements.
+	Match(from, filename string) bool
+	// Parse reads the statement from the text of its PDF. Transaction IDs
+	// are derived from the statement, so parsing it again yields the same.
+	Parse(text string) (*statements.Statement, error)
+}
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = make(map[string]Parser)
+)
+
+// Register adds the parser of an issuer, and serves it to the mailbox poller.
+// It panics when the name is already taken.
+func Register(name string, parser Parser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+
+	if parser == nil {
+		panic("parsers: Register parser is nil")
+	}
+	if _, dup := parsers[name]; dup {
+		panic("parsers: Register called twice for parser " + name)
+	}
+	parsers[name] = parser
+	mailbox.RegisterParser(name, mailParser{name: name, parser: parser})
+}
+
+// Names returns the names of the registered parsers.
+func Names() []string {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+
+	names := make([]string, 0, len(parsers))
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the parser registered under the name.
+func Lookup(name string) (Parser, bool) {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+
+	parser, ok := parsers[name]
+	return parser, ok
+}
+
+// fields finds the first submatch of every pattern in the text. Missing
+// fields are left out.
+func fields(text string, patterns map[string]*regexp.Regexp) map[string]string {
+	found := make(map[string]string, len(patterns))
+	for key, pattern := range patterns {
+		if m := pattern.FindStringSubmatch(text); m != nil {
+			found[key] = strings.TrimSpace(m[1])
+		}
+	}
+	return found
+}
+
+// parseAmount reads 1,234 or -1,234.50 like money.Parse; the stars that mark
+// points are ignored.
+func parseAmount(s string) (float64, error) {
+	return money.Parse(strings.ReplaceAll(s, "*", ""))
+}
+
+// amountOf returns the amount of a field, nil when it is missing or invalid.
+func amountOf(found map[string]string, key string) *float64 {
+	value, ok := found[key]
+	if !ok {
+		return nil
+	}
+	v, err := parseAmount(value)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+var rocDatePattern = regexp.MustCompile(`^(\d{1,3})/(\d{1,2})/(\d{1,2})$`)
+
+// parseROCDate reads the dates Taiwanese issuers print in years of the
+// Republic of China: 114/04/07 is 7 April 2025.
+func parseROCDate(s string) (time.Time, error) {
+	m := rocDatePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+	year, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2])
+	day, _ := strconv.Atoi(m[3])
+	t := time.Date(year+1911, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if t.Month() != time.Month(month) || t.Day() != day {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+	return t, nil
+}
+
+// rocSourceID names a statement by the year and month it closed, e.g. 114_02,
+// the source ID the statement fetcher posts.
+func rocSourceID(closing time.Time) string {
+	return fmt.Sprintf("%d_%02d", closing.Year()-1911, closing.Month())
+}
+
+// isForeign tells a foreign transaction by its currency, or by where it was
+// made when the issuer prints no currency.
+func isForeign(country, currency string) *bool {
+	var foreign bool
+	switch {
+	case currency != "":
+		foreign = currency != "TWD"
+	case country != "":
+		foreign = country != "TW"
+	default:
+		return nil
+	}
+	return &foreign
+}
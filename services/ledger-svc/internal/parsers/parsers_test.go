@@ -0,0 +1,96 @@
+package parsers
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// TestParsersGolden parses testdata/<parser>_<period>.txt, the text of a
+// statement PDF, and compares the statement with the .golden.json next to it.
+// Run with -update to accept a change.
+func TestParsersGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) < 2 {
+		t.Fatalf("found %d statements in testdata, want one per parser", len(inputs))
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".txt")
+		t.Run(name, func(t *testing.T) {
+			parserName, _, _ := strings.Cut(name, "_")
+			parser, ok := Lookup(parserName)
+			if !ok {
+				t.Fatalf("no parser %q registered", parserName)
+			}
+			text, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stmt, err := parser.Parse(string(text))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got, err := json.MarshalIndent(stmt, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := strings.TrimSuffix(input, ".txt") + ".golden.json"
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v, run go test -update to create it", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("statement differs from %s, got:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestParsersRejectOtherStatements(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range Names() {
+		parser, _ := Lookup(name)
+		if _, err := parser.Parse("親愛的客戶您好，本月無帳單。"); err == nil {
+			t.Errorf("%s: Parse() of a text without statement: expected error", name)
+		}
+	}
+}
+
+func TestParsersMatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		parser, from, filename string
+		want                   bool
+	}{
+		{"tsib", "service@taishinbank.com.tw", "TSB_Creditcard_Estatement_202502.pdf", true},
+		{"tsib", "service@taishinbank.com.tw", "TSB_Bank_Estatement_202502.pdf", false},
+		{"cathay", "estatement@mail.cathaybk.com.tw", "信用卡帳單.pdf", true},
+		{"cathay", "estatement@cathaybk.com.tw.example", "信用卡帳單.pdf", false},
+	}
+	for _, tt := range tests {
+		parser, _ := Lookup(tt.parser)
+		if got := parser.Match(tt.from, tt.filename); got != tt.want {
+			t.Errorf("%s.Match(%q, %q) = %v, want %v", tt.parser, tt.from, tt.filename, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package parsers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+// ErrPassword is returned for an encrypted PDF without the right password.
+var ErrPassword = apierror.New(apierror.KindInvalid, "pdf_password_required", "the PDF is encrypted and the password does not open it")
+
+// Text extracts the text of a PDF line by line, as pdfplumber does for the
+// statement fetcher: glyphs on the same baseline make a line, with a space
+// wherever they are set apart. Issuers encrypt their statements with the
+// holder's ID or birthday; password is empty for unencrypted files.
+func Text(data []byte, password string) (text string, err error) {
+	defer func() {
+		// the PDF reader panics on some malformed content streams
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed PDF: %v", r)
+		}
+	}()
+
+	tried := false
+	reader, err := pdf.NewReaderEncrypted(bytes.NewReader(data), int64(len(data)), func() string {
+		if tried {
+			return ""
+		}
+		tried = true
+		return password
+	})
+	if errors.Is(err, pdf.ErrInvalidPassword) {
+		return "", ErrPassword
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i := 1; i <= reader.NumPage(); i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		for _, line := range lines(page.Content().Text) {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String(), nil
+}
+
+// Tolerances in points, pdfplumber's defaults.
+const (
+	xTolerance = 3
+	yTolerance = 3
+)
+
+func lines(glyphs []pdf.Text) []string {
+	sort.SliceStable(glyphs, func(i, j int) bool { return glyphs[i].Y > glyphs[j].Y })
+
+	var result []string
+	for start := 0; start < len(glyphs); {
+		end := start + 1
+		for end < len(glyphs) && glyphs[start].Y-glyphs[end].Y <= yTolerance {
+			end++
+		}
+		row := glyphs[start:end]
+		sort.SliceStable(row, func(i, j int) bool { return row[i].X < row[j].X })
+
+		var line strings.Builder
+		for i, g := range row {
+			if i > 0 && g.X-(row[i-1].X+row[i-1].W) > xTolerance {
+				line.WriteByte(' ')
+			}
+			line.WriteString(g.S)
+		}
+		if s := strings.TrimSpace(line.String()); s != "" {
+			result = append(result, s)
+		}
+		start = end
+	}
+	return result
+}
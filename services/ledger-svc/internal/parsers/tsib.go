@@ -0,0 +1,200 @@
+package parsers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/importers"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+func init() {
+	Register("tsib", TSIB{})
+}
+
+// TSIB reads the credit card e-statements of Taishin International Bank,
+// TSB_Creditcard_Estatement_YYYYMM.pdf, ported from the statement fetcher's
+// tsib processor. Statements keep the source name and ID the fetcher posts,
+// so both pipelines update the same statement.
+type TSIB struct{}
+
+func (TSIB) Match(from, filename string) bool {
+	return strings.HasPrefix(filename, "TSB_Creditcard_Estatement") && strings.EqualFold(path.Ext(filename), ".pdf")
+}
+
+const tsibAmount = `(-?\d[\d,]*)`
+
+var tsibBillInfo = map[string]*regexp.Regexp{
+	// 帳務資訊
+	"帳單結帳日":    regexp.MustCompile(`帳單結帳日\s*(\d+/\d+/\d+)`),
+	"繳款截止日":    regexp.MustCompile(`繳款截止日\s*(\d+/\d+/\d+)`),
+	"上期應繳總額":   regexp.MustCompile(`上期應繳總額\s*` + tsibAmount),
+	"已繳退款總額":   regexp.MustCompile(`已繳退款總額\s*` + tsibAmount),
+	"前期餘額":     regexp.MustCompile(`前期餘額\s*` + tsibAmount),
+	"本期新增款項":   regexp.MustCompile(`本期新增款項\s*` + tsibAmount),
+	"本期累計應繳金額": regexp.MustCompile(`本期累計應繳金額\s*` + tsibAmount),
+	"本期最低應繳金額": regexp.MustCompile(`本期最低應繳金額\s*` + tsibAmount),
+	// 點數
+	"新增回饋":      regexp.MustCompile(`新增回饋\s+(-?[ \d,*]+)`),
+	"活動回饋/調整":   regexp.MustCompile(`活動回饋/調整\s+(-?[ \d,*]+)`),
+	"本期使用點數/里數": regexp.MustCompile(`本期使用點數/里數\s+(-?[ \d,*]+)`),
+	"本期結餘回饋":    regexp.MustCompile(`本期結餘回饋\s+(-?[ \d,*]+)`),
+	"到期點數":      regexp.MustCompile(`您有\s*(\d[\d,]*)點將於`),
+	"點數到期日":     regexp.MustCompile(`點將於\s*(\d+/\d+/\d+)\s*到期`),
+}
+
+func (TSIB) Parse(text string) (*statements.Statement, error) {
+	bill := fields(text, tsibBillInfo)
+	closing, err := parseROCDate(bill["帳單結帳日"])
+	if err != nil {
+		return nil, fmt.Errorf("closing date (帳單結帳日): %w", err)
+	}
+	total := amountOf(bill, "本期累計應繳金額")
+	if total == nil {
+		return nil, errors.New("no amount due (本期累計應繳金額) in the statement")
+	}
+
+	sourceID := rocSourceID(closing)
+	stmt := &statements.Statement{
+		Type:              statements.CreditCardBill,
+		SourceType:        statements.CreditCard,
+		SourceName:        "TSIB",
+		SourceID:          &sourceID,
+		TotalAmount:       *total,
+		PreviousAmount:    amountOf(bill, "上期應繳總額"),
+		PreviousPaid:      amountOf(bill, "已繳退款總額"),
+		PreviousUnpaid:    amountOf(bill, "前期餘額"),
+		CurrentAmount:     amountOf(bill, "本期新增款項"),
+		Currency:          "TWD",
+		MinimumPaymentDue: amountOf(bill, "本期最低應繳金額"),
+		Rewards:           tsibRewards(bill),
+	}
+	if due, err := parseROCDate(bill["繳款截止日"]); err == nil {
+		stmt.PaymentDueDate = &due
+	}
+
+	transactions, err := tsibTransactions(text, importers.NewIDs("tsib", sourceID))
+	if err != nil {
+		return nil, err
+	}
+	stmt.Transactions = &transactions
+	return stmt, nil
+}
+
+func tsibRewards(bill map[string]string) *statements.Rewards {
+	_, earned := bill["新增回饋"]
+	_, balance := bill["本期結餘回饋"]
+	if !earned && !balance {
+		return nil
+	}
+	points := func(key string) float64 {
+		if v := amountOf(bill, key); v != nil {
+			return *v
+		}
+		return 0
+	}
+	rewards := &statements.Rewards{
+		PointsEarned:   points("新增回饋") + points("活動回饋/調整"),
+		PointsRedeemed: points("本期使用點數/里數"),
+		PointsBalance:  amountOf(bill, "本期結餘回饋"),
+		PointsExpiring: points("到期點數"),
+	}
+	if expiry, err := parseROCDate(bill["點數到期日"]); err == nil {
+		rewards.PointsExpiryDate = &expiry
+	}
+	return rewards
+}
+
+var (
+	tsibHeader = regexp.MustCompile(`消費日\s*入帳起息日\s*消費明細\s*新臺幣金額\s*外幣折算日\s*消費地\s*幣別\s*外幣金額`)
+	tsibCard   = regexp.MustCompile(`^(\S+)\s+(\S+)\s+\(卡號末四碼:(\d{4})\)$`)
+	// 消費日, 入帳起息日, 消費明細, 新臺幣金額 and 消費地
+	tsibDomestic = regexp.MustCompile(`^(\d+/\d+/\d+)\s+(\d+/\d+/\d+)(.*?)\s+(-?\d+(?:,\d+)*)(?:\s+([A-Z]+))?$`)
+	// then 外幣折算日, 消費地, 幣別 and 外幣金額
+	tsibForeign = regexp.MustCompile(`^(\d+/\d+/\d+)\s+(\d+/\d+/\d+)(.*?)\s+(-?\d+(?:,\d+)*)\s+(\d+)\s+([A-Z]+)\s+([A-Z]+)\s+(-?\d+(?:,\d+)*(?:\.\d+))$`)
+)
+
+// tsibTransactions reads the table after the 消費日 header. Transactions come
+// first under no card, e.g. the autopay of the last statement, then under
+// the line of every card. A description too long for its column is printed
+// around the line of the transaction, which is left without one.
+func tsibTransactions(text string, ids *importers.IDs) ([]statements.Transaction, error) {
+	loc := tsibHeader.FindStringIndex(text)
+	if loc == nil {
+		slog.Warn("No transaction table in the TSIB statement")
+		return []statements.Transaction{}, nil
+	}
+	lines := strings.Split(text[loc[1]:], "\n")[1:]
+
+	transactions := []statements.Transaction{}
+	var card string
+	var unmatched []string
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		if m := tsibCard.FindStringSubmatch(line); m != nil {
+			card = m[3]
+			continue
+		}
+
+		var tx statements.Transaction
+		var date, description, amount, foreignAmount string
+		if m := tsibDomestic.FindStringSubmatch(line); m != nil {
+			date, description, amount = m[1], m[3], m[4]
+			tx.MerchantCountry = m[5]
+		} else if m := tsibForeign.FindStringSubmatch(line); m != nil {
+			date, description, amount = m[1], m[3], m[4]
+			tx.MerchantCountry, tx.Currency, foreignAmount = m[6], m[7], m[8]
+		} else {
+			// the table ends with the notes under it
+			if unmatched = append(unmatched, line); len(unmatched) > 2 {
+				break
+			}
+			continue
+		}
+
+		description = strings.TrimSpace(description)
+		if description == "" {
+			if len(unmatched) == 0 || i+1 >= len(lines) {
+				slog.Warn("TSIB transaction without a description", "line", line)
+				continue
+			}
+			previous := unmatched[len(unmatched)-1]
+			unmatched = unmatched[:len(unmatched)-1]
+			i++
+			description = previous + strings.TrimSpace(lines[i])
+		}
+
+		var err error
+		if tx.Date, err = parseROCDate(date); err != nil {
+			return nil, fmt.Errorf("transaction %q: %w", line, err)
+		}
+		if tx.Amount, err = parseAmount(amount); err != nil {
+			return nil, fmt.Errorf("transaction %q: %w", line, err)
+		}
+		tx.Description = description
+		tx.IsForeign = isForeign(tx.MerchantCountry, tx.Currency)
+		extra := map[string]any{}
+		if card != "" {
+			extra["card_last_four"] = card
+		}
+		if foreignAmount != "" {
+			if extra["foreign_amount"], err = parseAmount(foreignAmount); err != nil {
+				return nil, fmt.Errorf("transaction %q: %w", line, err)
+			}
+		}
+		if len(extra) > 0 {
+			tx.Extra = extra
+		}
+		tx.ID = ids.Next(card, tx.Date.Format(time.DateOnly), fmt.Sprintf("%.2f", tx.Amount), tx.Description)
+		transactions = append(transactions, tx)
+	}
+	return transactions, nil
+}
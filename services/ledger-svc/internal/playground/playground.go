@@ -0,0 +1,183 @@
+package playground
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+//go:embed playground.html
+var page string
+
+var pageTemplate = template.Must(template.New("playground").Parse(page))
+
+// Example is a ready-to-send request shown in the playground.
+type Example struct {
+	Group   string            `json:"group"`
+	Name    string            `json:"name"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// SandboxStatementID stands for the statement created by the first example,
+// which the other examples read and modify. Its ID depends on the owner and
+// the encryption settings, so the page takes it from the Location of the
+// create response and substitutes it for this placeholder.
+const SandboxStatementID = "{statement_id}"
+
+// SandboxHeader marks the requests sent from the playground, see Middleware.
+const SandboxHeader = "X-Playground-Sandbox"
+
+// SandboxTenant is the tenant the playground requests are scoped to.
+const SandboxTenant = "playground"
+
+// sandboxUser owns the sandbox of the requests made without a user.
+const sandboxUser = "sandbox"
+
+// sandboxWritable are the paths whose writes are kept per owner. The other
+// writes, e.g. to the tax mappings or the credit limits, would change what
+// every user sees and are refused in the sandbox.
+var sandboxWritable = []string{"/api/statements", "/api/budgets", "/api/households", "/api/reminders/", "/api/webhooks", "/graphql"}
+
+var errSandboxWrite = apierror.New(apierror.KindForbidden, "sandbox_write", "this write is shared by every user and not available in the playground sandbox")
+
+const sandboxStatement = `{
+  "source_name": "Sandbox",
+  "source_id": "2025_01",
+  "total_amount": 1650,
+  "current_amount": 1650,
+  "currency": "TWD",
+  "payment_due_date": "2025-02-24T00:00:00Z",
+  "minimum_payment_due": 165,
+  "fees": [{"type": 1, "description": "Annual fee", "amount": 300}],
+  "rewards": {"points_earned": 16, "points_redeemed": 0, "points_expiring": 0, "cashback": 0},
+  "transactions": [
+    {"id": "sandbox-1", "description": "Coffee", "category": "Food", "amount": 150, "date": "2025-01-05T00:00:00Z"},
+    {"id": "sandbox-2", "description": "Hotel", "category": "Travel", "currency": "JPY", "merchant_city": "Tokyo", "merchant_country": "JP", "amount": 1200, "date": "2025-01-12T00:00:00Z"},
+    {"id": "sandbox-3", "description": "Annual fee", "amount": 300, "date": "2025-01-20T00:00:00Z"}
+  ]
+}`
+
+var Examples = []Example{
+	{Group: "Statements", Name: "Create sandbox statement", Method: http.MethodPost, Path: "/api/statements?$expand=transactions",
+		Headers: map[string]string{"Content-Type": "application/json", "X-Ingest-Schema-Version": "v1"}, Body: sandboxStatement},
+	{Group: "Statements", Name: "Get statement", Method: http.MethodGet, Path: "/api/statements/" + SandboxStatementID},
+	{Group: "Statements", Name: "Get statement with transactions", Method: http.MethodGet, Path: "/api/statements/" + SandboxStatementID + "?$expand=transactions"},
+	{Group: "Statements", Name: "Statement transactions", Method: http.MethodGet, Path: "/api/statements/" + SandboxStatementID + "/transactions"},
+	{Group: "Statements", Name: "Statement attachments", Method: http.MethodGet, Path: "/api/statements/" + SandboxStatementID + "/attachments"},
+	{Group: "Statements", Name: "Reconciliation", Method: http.MethodGet, Path: "/api/statements/" + SandboxStatementID + "/reconciliation"},
+	{Group: "Statements", Name: "Duplicate statements", Method: http.MethodGet, Path: "/api/statements/duplicates?source_name=Sandbox"},
+	{Group: "Statements", Name: "Anonymized statement", Method: http.MethodGet, Path: "/api/statements/" + SandboxStatementID + "/anonymized?seed=playground"},
+	{Group: "Transactions", Name: "List transactions", Method: http.MethodGet, Path: "/api/transactions?statement_id=" + SandboxStatementID + "&limit=2"},
+	{Group: "Transactions", Name: "Link external reference", Method: http.MethodPut, Path: "/api/statements/" + SandboxStatementID + "/transactions/sandbox-2/external_refs",
+		Headers: map[string]string{"Content-Type": "application/json"}, Body: `[{"type": "booking", "value": "HTL-20250112"}]`},
+	{Group: "Transactions", Name: "Attribute to a household member", Method: http.MethodPut, Path: "/api/statements/" + SandboxStatementID + "/transactions/sandbox-2/attribution",
+		Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"owner": "", "paid_by": "alex"}`},
+	{Group: "Transactions", Name: "Open a dispute", Method: http.MethodPut, Path: "/api/statements/" + SandboxStatementID + "/transactions/sandbox-2/dispute",
+		Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"status": "opened", "note": "Charged twice", "deadline": "2025-03-15T00:00:00Z"}`},
+	{Group: "Transactions", Name: "Open disputes", Method: http.MethodGet, Path: "/api/disputes"},
+	{Group: "Transactions", Name: "Find by external reference", Method: http.MethodGet, Path: "/api/transactions?external_ref=HTL-20250112&external_ref_type=booking"},
+	{Group: "Transactions", Name: "Foreign transactions", Method: http.MethodGet, Path: "/api/transactions?is_foreign=true&from=2025-01-01&to=2025-02-01"},
+	{Group: "Transactions", Name: "Card payments from the bank", Method: http.MethodGet, Path: "/api/transactions?is_transfer=true"},
+	{Group: "Summaries", Name: "Rewards", Method: http.MethodGet, Path: "/api/rewards?source_name=Sandbox"},
+	{Group: "Summaries", Name: "Fees", Method: http.MethodGet, Path: "/api/fees?source_name=Sandbox&year=2025"},
+	{Group: "Summaries", Name: "Monthly trend", Method: http.MethodGet, Path: "/api/trends?from=2024-01&to=2025-12&source_name=Sandbox"},
+	{Group: "Summaries", Name: "Daily trend", Method: http.MethodGet, Path: "/api/trends?granularity=day&from=2025-01-01&to=2025-01-31"},
+	{Group: "Summaries", Name: "Audit log", Method: http.MethodGet, Path: "/api/audit?entity_id=" + SandboxStatementID},
+	{Group: "Summaries", Name: "Spend by category", Method: http.MethodGet, Path: "/api/analytics/spend?group_by=category&from=2025-01&to=2025-03"},
+	{Group: "Summaries", Name: "Spend by month", Method: http.MethodGet, Path: "/api/analytics/spend?group_by=month&from=2025-01&to=2025-12"},
+	{Group: "Summaries", Name: "Spend by type", Method: http.MethodGet, Path: "/api/analytics/spend?group_by=spend_type&from=2025-01&to=2025-03"},
+	{Group: "Summaries", Name: "Fees by month", Method: http.MethodGet, Path: "/api/trends?from=2025-01&to=2025-12&spend_type=fee"},
+	{Group: "Summaries", Name: "Cash flow forecast", Method: http.MethodGet, Path: "/api/analytics/forecast?horizon=90d&model=seasonal"},
+	{Group: "Summaries", Name: "Consistency report", Method: http.MethodGet, Path: "/api/consistency"},
+	{Group: "Summaries", Name: "Source health", Method: http.MethodGet, Path: "/api/sources/health?source_name=Sandbox"},
+	{Group: "Payments", Name: "Record payment", Method: http.MethodPost, Path: "/api/statements/" + SandboxStatementID + "/payments",
+		Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"amount": 1650, "date": "2025-02-20T00:00:00Z", "description": "Payment"}`},
+	{Group: "Payments", Name: "Confirm detected payment", Method: http.MethodPost, Path: "/api/statements/" + SandboxStatementID + "/payment/confirm"},
+	{Group: "Reminders", Name: "Active reminders", Method: http.MethodGet, Path: "/api/reminders"},
+	{Group: "Reminders", Name: "Reminder preferences", Method: http.MethodGet, Path: "/api/reminders/preferences"},
+	{Group: "Reminders", Name: "Remind Sandbox by webhook", Method: http.MethodPut, Path: "/api/reminders/preferences/Sandbox",
+		Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"escalation": "5:email,1:webhook"}`},
+	{Group: "Reminders", Name: "Acknowledge reminder", Method: http.MethodPost, Path: "/api/statements/" + SandboxStatementID + "/reminders/ack"},
+	{Group: "Merchants", Name: "Spend by merchant", Method: http.MethodGet, Path: "/api/merchants?from=2025-01&to=2025-03"},
+	{Group: "Merchants", Name: "Recurring charges", Method: http.MethodGet, Path: "/api/merchants/recurring"},
+	{Group: "Merchants", Name: "Price changes", Method: http.MethodGet, Path: "/api/merchants/price_changes"},
+	{Group: "Export", Name: "Category rollup CSV", Method: http.MethodGet, Path: "/api/export/rollup.csv?from=2025-01&to=2025-03"},
+	{Group: "Export", Name: "Top-level category rollup CSV", Method: http.MethodGet, Path: "/api/export/rollup.csv?from=2025-01&to=2025-03&depth=1"},
+	{Group: "Budgets", Name: "Create budget", Method: http.MethodPost, Path: "/api/budgets",
+		Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"category": "Food", "period": "monthly", "limit": 8000, "rollover": "unused"}`},
+	{Group: "Budgets", Name: "Budgets", Method: http.MethodGet, Path: "/api/budgets"},
+	{Group: "Budgets", Name: "Budget status", Method: http.MethodGet, Path: "/api/budgets/status"},
+	{Group: "Households", Name: "Create household", Method: http.MethodPost, Path: "/api/households",
+		Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"name": "Home", "members": [{"user": "alex"}, {"user": "sam"}], "rules": [{"category": "Rent", "weights": {"alex": 60, "sam": 40}}]}`},
+	{Group: "Households", Name: "Households", Method: http.MethodGet, Path: "/api/households"},
+	{Group: "GraphQL", Name: "Statement with transactions and merchants", Method: http.MethodPost, Path: "/graphql",
+		Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"query": "query($id: String!) { statement(id: $id) { id source_name total_amount transactions { id description amount merchant { key } } } }", "variables": {"id": "` + SandboxStatementID + `"}}`},
+	{Group: "Webhooks", Name: "Subscriptions", Method: http.MethodGet, Path: "/api/webhooks"},
+	{Group: "Accounts", Name: "Credit utilization history", Method: http.MethodGet, Path: "/api/accounts/Sandbox/utilization"},
+	{Group: "Budgets", Name: "Phone widget summary", Method: http.MethodGet, Path: "/api/widget/budget"},
+	{Group: "Reports", Name: "Month-end reports", Method: http.MethodGet, Path: "/api/reports"},
+	{Group: "Reports", Name: "Report as reported and as computed now", Method: http.MethodGet, Path: "/api/reports/2025-01"},
+	{Group: "Reports", Name: "Monthly digest", Method: http.MethodGet, Path: "/api/reports/monthly/2025-01?format=text"},
+	{Group: "Reports", Name: "Tax mappings", Method: http.MethodGet, Path: "/api/tax/mappings"},
+	{Group: "Reports", Name: "Tax-year totals", Method: http.MethodGet, Path: "/api/reports/tax?year=2025"},
+	{Group: "Reports", Name: "Tax-year workbook", Method: http.MethodGet, Path: "/api/reports/tax?year=2025&format=xlsx"},
+	{Group: "Categories", Name: "Category taxonomy", Method: http.MethodGet, Path: "/api/categories"},
+	{Group: "Categories", Name: "Taxonomy history", Method: http.MethodGet, Path: "/api/categories/history"},
+	{Group: "Export", Name: "Attachments ZIP", Method: http.MethodGet, Path: "/api/export/attachments?from=2025-01&to=2025-12"},
+	{Group: "Export", Name: "Transactions CSV", Method: http.MethodGet, Path: "/api/export/transactions.csv?from=2025-01&to=2025-01"},
+	{Group: "Ingest", Name: "Ingest schema", Method: http.MethodGet, Path: "/api/ingest/schema"},
+	{Group: "Ingest", Name: "Ingest runs", Method: http.MethodGet, Path: "/api/ingest/runs?source=dropzone&limit=10"},
+	{Group: "Encryption", Name: "Client-side encryption", Method: http.MethodGet, Path: "/api/e2e"},
+	{Group: "Encryption", Name: "Find by blind index", Method: http.MethodGet, Path: "/api/transactions?blind_index=sandbox-token"},
+	{Group: "Service", Name: "Health", Method: http.MethodGet, Path: "/healthz"},
+	{Group: "Service", Name: "Readiness", Method: http.MethodGet, Path: "/readyz"},
+}
+
+// Middleware scopes the requests sent from the playground to the sandbox
+// tenant, each user getting a sandbox of their own, so the examples never
+// read or write the real ledger. It goes inside authentication, whose user it
+// keeps. Writes to what is shared by every user are refused.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(SandboxHeader) == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !slices.ContainsFunc(sandboxWritable, func(prefix string) bool {
+			return strings.HasPrefix(r.URL.Path, prefix)
+		}) {
+			apierror.Write(w, errSandboxWrite)
+			return
+		}
+		user := statements.UserFrom(r.Context())
+		if user == "" {
+			user = sandboxUser
+		}
+		ctx := statements.WithUser(statements.WithTenant(r.Context(), SandboxTenant), user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Handler serves GET /api/playground, a single page that sends the examples
+// from the browser against this instance. It is only registered in local mode
+// (IS_LOCAL=true) or with PLAYGROUND_ENABLED=true, with Middleware.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	data := struct {
+		Examples      []Example
+		SandboxHeader string
+		Placeholder   string
+	}{Examples, SandboxHeader, SandboxStatementID}
+	if err := pageTemplate.Execute(w, data); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to render playground", "error", err)
+	}
+}
@@ -0,0 +1,239 @@
+// Package queue ingests the statements the fetcher publishes to a message
+// queue, NATS JetStream or Kafka, instead of posting them. A message is the
+// body POST /api/statements takes, with the ingest schema version in the
+// X-Ingest-Schema-Version header; statements with transactions replace the
+// stored ones, as with $expand=transactions.
+//
+// Delivery is at least once: a message is acknowledged after the statement is
+// saved, and statements are upserted by ID, so a redelivered message changes
+// nothing. Messages that cannot be saved are retried with a growing delay and
+// go to the dead letter subject or topic after the last attempt; invalid ones
+// go there at once.
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/ingest"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// maxBackoff bounds the delay between attempts.
+const maxBackoff = time.Hour
+
+// Headers set on dead letters, next to the headers of the message.
+const (
+	ReasonHeader   = "Finchie-Dead-Letter-Reason"
+	AttemptsHeader = "Finchie-Attempts"
+)
+
+// Message is a delivery of a statement payload.
+type Message struct {
+	Data   []byte
+	Header map[string]string
+	// Attempt counts the deliveries, 1 for the first.
+	Attempt int
+
+	ack   func(ctx context.Context) error
+	retry func(ctx context.Context, delay time.Duration) error
+}
+
+// Broker is the queue the statements are consumed from.
+type Broker interface {
+	// Fetch waits for the next messages, returning none when there were none
+	// for a while.
+	Fetch(ctx context.Context) ([]*Message, error)
+	// DeadLetter publishes the message with the reason to the dead letters.
+	// The message is acknowledged by the consumer afterwards.
+	DeadLetter(ctx context.Context, msg *Message, reason string) error
+	Close() error
+}
+
+// Consumer saves the statements of the messages the broker delivers.
+type Consumer struct {
+	Broker  Broker
+	Service *statements.StatementService
+	// MaxAttempts is how often a message is tried before it is dead
+	// lettered, the delay doubling from Backoff after every attempt.
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+// NewConsumerFromEnv connects to INGEST_QUEUE_URL, nats://host:4222 for
+// JetStream or kafka://broker1:9092,broker2:9092. It returns nil when the URL
+// is unset. INGEST_QUEUE_MAX_ATTEMPTS defaults to 5 and
+// INGEST_QUEUE_BACKOFF_SECONDS, the first delay, to 10.
+func NewConsumerFromEnv(ctx context.Context, service *statements.StatementService) (*Consumer, error) {
+	raw := os.Getenv("INGEST_QUEUE_URL")
+	if raw == "" {
+		return nil, nil
+	}
+	cfg := Config{
+		Subject:    envOr("INGEST_QUEUE_SUBJECT", "finchie.ingest.statements"),
+		Group:      envOr("INGEST_QUEUE_GROUP", "finchie-ledger"),
+		Stream:     envOr("INGEST_QUEUE_STREAM", "FINCHIE_INGEST"),
+		DeadLetter: os.Getenv("INGEST_QUEUE_DEAD_LETTER"),
+	}
+	if cfg.DeadLetter == "" {
+		cfg.DeadLetter = cfg.Subject + ".dead"
+	}
+
+	var broker Broker
+	var err error
+	switch scheme, rest, _ := strings.Cut(raw, "://"); scheme {
+	case "nats", "tls":
+		broker, err = OpenJetStream(ctx, raw, cfg)
+	case "kafka":
+		broker, err = OpenKafka(strings.Split(rest, ","), cfg)
+	default:
+		return nil, fmt.Errorf("invalid INGEST_QUEUE_URL %q, expected nats://host:port or kafka://host:port[,host:port]", raw)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Consumer{
+		Broker:      broker,
+		Service:     service,
+		MaxAttempts: envInt("INGEST_QUEUE_MAX_ATTEMPTS", 5),
+		Backoff:     time.Duration(envInt("INGEST_QUEUE_BACKOFF_SECONDS", 10)) * time.Second,
+	}, nil
+}
+
+// Config names where the statements are consumed from.
+type Config struct {
+	// Subject is the NATS subject or Kafka topic of the statements.
+	Subject string
+	// Group is the durable JetStream consumer or the Kafka consumer group.
+	Group string
+	// Stream is the JetStream stream, created over Subject and DeadLetter
+	// when it does not exist. Kafka has no streams.
+	Stream     string
+	DeadLetter string
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+// Run consumes until the context is done.
+func (c *Consumer) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		messages, err := c.Broker.Fetch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("Failed to fetch from the ingest queue", "error", err)
+			sleep(ctx, 5*time.Second)
+			continue
+		}
+		for _, msg := range messages {
+			c.Handle(ctx, msg)
+		}
+	}
+}
+
+// errInvalid marks messages no attempt will save.
+var errInvalid = errors.New("invalid statement message")
+
+// Handle saves the statement of the message, then acknowledges, retries or
+// dead letters it.
+func (c *Consumer) Handle(ctx context.Context, msg *Message) {
+	err := c.save(ctx, msg)
+	switch {
+	case err == nil:
+		if err := msg.ack(ctx); err != nil {
+			// redelivered, saving again is harmless
+			slog.Warn("Failed to acknowledge the ingest message", "error", err)
+		}
+	case ctx.Err() != nil:
+		// shutting down, left for redelivery
+		return
+	case errors.Is(err, errInvalid) || msg.Attempt >= c.MaxAttempts:
+		c.deadLetter(ctx, msg, err)
+	default:
+		delay := min(c.Backoff<<min(msg.Attempt-1, 16), maxBackoff)
+		slog.Warn("Failed to ingest the queued statement, retrying", "attempt", msg.Attempt, "delay", delay, "error", err)
+		if err := msg.retry(ctx, delay); err != nil {
+			slog.Error("Failed to retry the ingest message", "error", err)
+		}
+	}
+}
+
+func (c *Consumer) deadLetter(ctx context.Context, msg *Message, reason error) {
+	slog.Error("Dead lettering the queued statement", "attempt", msg.Attempt, "error", reason)
+	if err := c.Broker.DeadLetter(ctx, msg, reason.Error()); err != nil {
+		// not acknowledged, so it is not lost
+		slog.Error("Failed to dead letter the ingest message", "error", err)
+		if err := msg.retry(ctx, c.Backoff); err != nil {
+			slog.Error("Failed to retry the ingest message", "error", err)
+		}
+		return
+	}
+	if err := msg.ack(ctx); err != nil {
+		slog.Warn("Failed to acknowledge the dead lettered message", "error", err)
+	}
+}
+
+func (c *Consumer) save(ctx context.Context, msg *Message) error {
+	violations, err := ingest.ValidatePayload("statement", msg.Header[ingest.VersionHeader], msg.Data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalid, err)
+	}
+	if len(violations) > 0 {
+		list := make([]string, len(violations))
+		for i, v := range violations {
+			list[i] = v.Error()
+		}
+		return fmt.Errorf("%w: payload does not match ingest schema: %s", errInvalid, strings.Join(list, "; "))
+	}
+	var stmt statements.Statement
+	if err := json.Unmarshal(msg.Data, &stmt); err != nil {
+		return fmt.Errorf("%w: %v", errInvalid, err)
+	}
+
+	if stmt.Transactions != nil {
+		err = c.Service.SaveStatementWithTransactions(ctx, &stmt)
+	} else {
+		err = c.Service.SaveStatement(ctx, &stmt)
+	}
+	switch {
+	case errors.Is(err, statements.ErrQueued):
+		// replayed once the database is back
+		slog.Info("Queued statement saved for replay", "id", stmt.ID)
+		return nil
+	case errors.Is(err, statements.ErrClientEncryption):
+		return fmt.Errorf("%w: %v", errInvalid, err)
+	case err != nil:
+		return err
+	}
+	slog.Info("Queued statement ingested", "id", stmt.ID, "attempt", msg.Attempt)
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	fetchBatch   = 20
+	fetchMaxWait = 5 * time.Second
+	// ackWait is how long JetStream waits for a message to be acknowledged
+	// before delivering it again, longer than saving a statement takes.
+	ackWait = 2 * time.Minute
+)
+
+// JetStream consumes the statements with a durable pull consumer. Messages
+// are redelivered after a negative acknowledgement or once ackWait passed,
+// e.g. when the consumer died while saving.
+type JetStream struct {
+	conn       *nats.Conn
+	js         jetstream.JetStream
+	consumer   jetstream.Consumer
+	deadLetter string
+}
+
+func OpenJetStream(ctx context.Context, url string, cfg Config) (*JetStream, error) {
+	conn, err := nats.Connect(url, nats.Name("finchie-ledger-ingest"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if _, err := js.Stream(ctx, cfg.Stream); errors.Is(err, jetstream.ErrStreamNotFound) {
+		slog.Info("Creating the ingest stream", "stream", cfg.Stream, "subject", cfg.Subject)
+		_, err = js.CreateStream(ctx, jetstream.StreamConfig{
+			Name:     cfg.Stream,
+			Subjects: []string{cfg.Subject, cfg.DeadLetter},
+			Storage:  jetstream.FileStorage,
+		})
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("create stream %s: %w", cfg.Stream, err)
+		}
+	} else if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("stream %s: %w", cfg.Stream, err)
+	}
+
+	// the consumer dead letters itself, JetStream must not stop delivering
+	consumer, err := js.CreateOrUpdateConsumer(ctx, cfg.Stream, jetstream.ConsumerConfig{
+		Durable:       cfg.Group,
+		FilterSubject: cfg.Subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       ackWait,
+		MaxDeliver:    -1,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("consumer %s: %w", cfg.Group, err)
+	}
+	return &JetStream{conn: conn, js: js, consumer: consumer, deadLetter: cfg.DeadLetter}, nil
+}
+
+func (j *JetStream) Fetch(ctx context.Context) ([]*Message, error) {
+	batch, err := j.consumer.Fetch(fetchBatch, jetstream.FetchMaxWait(fetchMaxWait))
+	if err != nil {
+		return nil, err
+	}
+	var messages []*Message
+	for m := range batch.Messages() {
+		msg := &Message{Data: m.Data(), Header: map[string]string{}, Attempt: 1}
+		for key := range m.Headers() {
+			msg.Header[key] = m.Headers().Get(key)
+		}
+		if meta, err := m.Metadata(); err == nil {
+			msg.Attempt = int(meta.NumDelivered)
+		}
+		msg.ack = func(ctx context.Context) error { return m.DoubleAck(ctx) }
+		msg.retry = func(ctx context.Context, delay time.Duration) error { return m.NakWithDelay(delay) }
+		messages = append(messages, msg)
+	}
+	if err := batch.Error(); err != nil && !errors.Is(err, nats.ErrTimeout) {
+		return messages, err
+	}
+	return messages, nil
+}
+
+func (j *JetStream) DeadLetter(ctx context.Context, msg *Message, reason string) error {
+	dead := nats.NewMsg(j.deadLetter)
+	dead.Data = msg.Data
+	for key, value := range msg.Header {
+		dead.Header.Set(key, value)
+	}
+	dead.Header.Set(ReasonHeader, reason)
+	dead.Header.Set(AttemptsHeader, strconv.Itoa(msg.Attempt))
+	_, err := j.js.PublishMsg(ctx, dead)
+	return err
+}
+
+func (j *JetStream) Close() error {
+	return j.conn.Drain()
+}
@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// attemptHeader counts the deliveries of a Kafka message, which Kafka does
+// not: a retry is the message published again with the count raised.
+const attemptHeader = "Finchie-Attempt"
+
+// Kafka consumes the statements in a consumer group, committing the offset
+// of a message once it is saved. A retry waits out the delay, publishes the
+// message to the end of the topic and commits it, so a failing statement
+// does not hold up the partition for more than the delay.
+type Kafka struct {
+	reader     *kafka.Reader
+	writer     *kafka.Writer
+	topic      string
+	deadLetter string
+}
+
+func OpenKafka(brokers []string, cfg Config) (*Kafka, error) {
+	if len(brokers) == 0 || brokers[0] == "" {
+		return nil, errors.New("no Kafka brokers in INGEST_QUEUE_URL")
+	}
+	return &Kafka{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: brokers,
+			GroupID: cfg.Group,
+			Topic:   cfg.Subject,
+			MaxWait: fetchMaxWait,
+		}),
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+		topic:      cfg.Subject,
+		deadLetter: cfg.DeadLetter,
+	}, nil
+}
+
+func (k *Kafka) Fetch(ctx context.Context) ([]*Message, error) {
+	fetchCtx, cancel := context.WithTimeout(ctx, fetchMaxWait)
+	defer cancel()
+	m, err := k.reader.FetchMessage(fetchCtx)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{Data: m.Value, Header: map[string]string{}, Attempt: 1}
+	for _, h := range m.Headers {
+		msg.Header[h.Key] = string(h.Value)
+	}
+	if n, err := strconv.Atoi(msg.Header[attemptHeader]); err == nil && n > 0 {
+		msg.Attempt = n
+	}
+	msg.ack = func(ctx context.Context) error {
+		return k.reader.CommitMessages(ctx, m)
+	}
+	msg.retry = func(ctx context.Context, delay time.Duration) error {
+		sleep(ctx, delay)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header := map[string]string{attemptHeader: strconv.Itoa(msg.Attempt + 1)}
+		if err := k.publish(ctx, k.topic, m.Key, msg, header); err != nil {
+			return err
+		}
+		return k.reader.CommitMessages(ctx, m)
+	}
+	return []*Message{msg}, nil
+}
+
+func (k *Kafka) DeadLetter(ctx context.Context, msg *Message, reason string) error {
+	return k.publish(ctx, k.deadLetter, nil, msg, map[string]string{
+		ReasonHeader:   reason,
+		AttemptsHeader: strconv.Itoa(msg.Attempt),
+	})
+}
+
+// publish writes the message to the topic with its headers, the given ones
+// replacing theirs.
+func (k *Kafka) publish(ctx context.Context, topic string, key []byte, msg *Message, header map[string]string) error {
+	out := kafka.Message{Topic: topic, Key: key, Value: msg.Data}
+	for name, value := range msg.Header {
+		if _, replaced := header[name]; !replaced {
+			out.Headers = append(out.Headers, kafka.Header{Key: name, Value: []byte(value)})
+		}
+	}
+	for name, value := range header {
+		out.Headers = append(out.Headers, kafka.Header{Key: name, Value: []byte(value)})
+	}
+	return k.writer.WriteMessages(ctx, out)
+}
+
+func (k *Kafka) Close() error {
+	return errors.Join(k.reader.Close(), k.writer.Close())
+}
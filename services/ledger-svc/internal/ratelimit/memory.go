@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// sweepInterval is how often MemoryLimiter drops idle buckets.
+	sweepInterval = time.Minute
+	// idleBucket is how long a bucket is kept unused, enough for any
+	// sensible limit to refill it so dropping it changes nothing.
+	idleBucket = time.Hour
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryLimiter keeps the buckets in process, each replica limiting on its own.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (l *MemoryLimiter) Name() string {
+	return "memory"
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit) (Decision, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.perSecond())
+	b.updated = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return Decision{Allowed: true}, nil
+	}
+	wait := (1 - b.tokens) / limit.perSecond()
+	return Decision{RetryAfter: time.Duration(wait * float64(time.Second))}, nil
+}
+
+func (l *MemoryLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) > idleBucket {
+			delete(l.buckets, key)
+		}
+	}
+}
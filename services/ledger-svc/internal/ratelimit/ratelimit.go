@@ -0,0 +1,180 @@
+// Package ratelimit bounds how fast each client calls the API with token
+// buckets: a client may send Burst requests at once, then PerMinute a minute.
+// Clients are told apart by their API key, or by their IP address when they
+// present none, and reads and writes are limited separately.
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apikeys"
+)
+
+var rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "finchie_rate_limited_requests_total",
+	Help: "Requests answered with 429 by the rate limiter.",
+}, []string{"class"})
+
+// Class is the kind of route a request is limited as.
+type Class string
+
+const (
+	// ClassRead covers GET, HEAD and OPTIONS requests.
+	ClassRead  Class = "read"
+	ClassWrite Class = "write"
+)
+
+// ClassOf returns the class of the request.
+func ClassOf(r *http.Request) Class {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ClassRead
+	}
+	return ClassWrite
+}
+
+// Limit is a token bucket holding Burst tokens and refilled with PerMinute
+// tokens a minute; each request takes one.
+type Limit struct {
+	PerMinute int
+	Burst     int
+}
+
+func (l Limit) perSecond() float64 {
+	return float64(l.PerMinute) / 60
+}
+
+// Decision is the answer of a Limiter to a request.
+type Decision struct {
+	Allowed bool
+	// RetryAfter is how long until the bucket holds a token again, zero
+	// when the request is allowed.
+	RetryAfter time.Duration
+}
+
+// Limiter takes a token from the bucket of key.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Decision, error)
+	Name() string
+}
+
+// RateLimit limits the requests of each client per class.
+type RateLimit struct {
+	Limiter Limiter
+	Limits  map[Class]Limit
+	// TrustProxy takes the client IP from X-Forwarded-For, as appended by
+	// the proxy in front of the service, instead of the connection.
+	TrustProxy bool
+}
+
+// FromEnv enables rate limiting when RATE_LIMIT_ENABLED is true. Reads and
+// writes get RATE_LIMIT_READS_PER_MINUTE (600) and RATE_LIMIT_WRITES_PER_MINUTE
+// (120) with bursts of RATE_LIMIT_READ_BURST (100) and RATE_LIMIT_WRITE_BURST
+// (20). REDIS_URL shares the buckets between the replicas.
+func FromEnv() *RateLimit {
+	if os.Getenv("RATE_LIMIT_ENABLED") != "true" {
+		return nil
+	}
+	rl := &RateLimit{
+		Limiter: NewMemoryLimiter(),
+		Limits: map[Class]Limit{
+			ClassRead:  {PerMinute: envInt("RATE_LIMIT_READS_PER_MINUTE", 600), Burst: envInt("RATE_LIMIT_READ_BURST", 100)},
+			ClassWrite: {PerMinute: envInt("RATE_LIMIT_WRITES_PER_MINUTE", 120), Burst: envInt("RATE_LIMIT_WRITE_BURST", 20)},
+		},
+		TrustProxy: os.Getenv("RATE_LIMIT_TRUST_PROXY") == "true",
+	}
+	if url := os.Getenv("REDIS_URL"); url != "" {
+		opts, err := redis.ParseURL(url)
+		if err != nil {
+			slog.Warn("Invalid REDIS_URL, rate limiting each instance on its own", "error", err)
+		} else {
+			prefix := os.Getenv("REDIS_PREFIX")
+			if prefix == "" {
+				prefix = "finchie:"
+			}
+			rl.Limiter = NewRedisLimiter(redis.NewClient(opts), prefix+"ratelimit:")
+		}
+	}
+	slog.Info("Rate limiting enabled", "limiter", rl.Limiter.Name(),
+		"reads", rl.Limits[ClassRead], "writes", rl.Limits[ClassWrite], "trust_proxy", rl.TrustProxy)
+	return rl
+}
+
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
+
+// Middleware answers the requests of clients out of tokens with 429 and a
+// Retry-After header. Health checks are never limited, and neither is a
+// request the limiter fails on: an unreachable Redis must not take the API
+// down.
+func (rl *RateLimit) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := ClassOf(r)
+		limit, ok := rl.Limits[class]
+		if !ok || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := rl.Client(r)
+		decision, err := rl.Limiter.Allow(r.Context(), client+":"+string(class), limit)
+		if err != nil {
+			accesslog.Logger(r.Context()).Warn("Failed to check rate limit, allowing the request", "client", client, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !decision.Allowed {
+			rateLimited.WithLabelValues(string(class)).Inc()
+			accesslog.Add(r.Context(), "rate_limited", client)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+			apierror.Reply(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Client returns the bucket key of the client, apikey:<id> for requests
+// with a checked API key and ip:<address> otherwise.
+func (rl *RateLimit) Client(r *http.Request) string {
+	if key := apikeys.FromContext(r.Context()); key != nil {
+		return "apikey:" + key.ID
+	}
+	return "ip:" + rl.clientIP(r)
+}
+
+func (rl *RateLimit) clientIP(r *http.Request) string {
+	if rl.TrustProxy {
+		// the last address is the one the proxy saw, the others are the
+		// client's to make up
+		forwarded := r.Header.Values("X-Forwarded-For")
+		if len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
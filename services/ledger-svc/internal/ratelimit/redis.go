@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeToken refills and takes from the bucket in KEYS[1], a hash of the
+// tokens and when they were counted, atomically and on the clock of Redis so
+// the replicas agree. It returns 1 or 0 for allowed and the milliseconds
+// until the next token.
+var takeToken = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or burst
+local updated = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate)
+local allowed, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000))
+return {allowed, wait}
+`)
+
+// RedisLimiter keeps the buckets in Redis, shared by every replica. A bucket
+// expires once it has refilled.
+type RedisLimiter struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisLimiter(client *redis.Client, prefix string) *RedisLimiter {
+	return &RedisLimiter{client: client, prefix: prefix}
+}
+
+func (l *RedisLimiter) Name() string {
+	return "redis"
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (Decision, error) {
+	res, err := takeToken.Run(ctx, l.client, []string{l.prefix + key}, limit.perSecond(), limit.Burst).Int64Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+	return Decision{Allowed: res[0] == 1, RetryAfter: time.Duration(res[1]) * time.Millisecond}, nil
+}
@@ -0,0 +1,291 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+var ErrStatementNotFound = apierror.New(apierror.KindNotFound, "statement_not_found", "statement not found")
+
+// Escalator raises the reminder level of unpaid statements as their due date
+// approaches. A statement is unpaid while it needs a manual payment and has not
+// been acknowledged; the level reached is stored on the statement so every
+// level is only sent once, also across restarts.
+type Escalator struct {
+	Repo     statements.StatementRepository
+	Policies Policies
+	// Preferences override Policies per account, when set.
+	Preferences PreferenceStore
+	Notifiers   map[Level]Notifier
+	// DigestSenders deliver the digest of the statements mentioned at the
+	// digest level, once a day from DigestHour (UTC) on. Without senders the
+	// mentions are only listed at /api/reminders.
+	DigestSenders map[string]Sender
+	DigestHour    int
+
+	mu sync.Mutex
+}
+
+func NewEscalatorFromEnv(repo statements.StatementRepository) (*Escalator, error) {
+	policies, err := PoliciesFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	digestSenders, err := SendersFromEnv("REMINDER_DIGEST_CHANNELS")
+	if err != nil {
+		return nil, err
+	}
+	digestHour := 8
+	if v := os.Getenv("REMINDER_DIGEST_HOUR"); v != "" {
+		digestHour, err = strconv.Atoi(v)
+		if err != nil || digestHour < 0 || digestHour > 23 {
+			return nil, fmt.Errorf("REMINDER_DIGEST_HOUR: invalid hour %q", v)
+		}
+	}
+
+	notifiers := map[Level]Notifier{LevelDigest: DigestNotifier{}}
+	if email := NewEmailNotifierFromEnv(); email != nil {
+		notifiers[LevelEmail] = email
+		if len(digestSenders) == 0 {
+			digestSenders["email"] = email
+		}
+	}
+	if telegram := NewTelegramNotifierFromEnv(); telegram != nil {
+		notifiers[LevelTelegram] = telegram
+	}
+	if webhook := NewWebhookNotifierFromEnv(); webhook != nil {
+		notifiers[LevelWebhook] = webhook
+	}
+	return &Escalator{
+		Repo:          repo,
+		Policies:      policies,
+		Preferences:   NewPreferenceStore(repo),
+		Notifiers:     notifiers,
+		DigestSenders: digestSenders,
+		DigestHour:    digestHour,
+	}, nil
+}
+
+// Tick sends the reminders due at now and records the level reached, then
+// the digest of the pending mentions when one is due.
+func (e *Escalator) Tick(ctx context.Context, now time.Time) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	policies, err := e.policies(ctx)
+	if err != nil {
+		return err
+	}
+	stmts, err := e.Repo.ListStatements(ctx, statements.StatementFilter{})
+	if err != nil {
+		return err
+	}
+
+	for i := range stmts {
+		stmt := &stmts[i]
+		daysLeft, ok := pending(stmt, now)
+		if !ok {
+			continue
+		}
+		target := policies.For(stmt).LevelAt(daysLeft)
+		if target <= Level(stmt.ReminderLevel) {
+			continue
+		}
+
+		level, notifier := e.notifierFor(target)
+		if notifier == nil || level <= Level(stmt.ReminderLevel) {
+			// the channels above the level reached are not configured
+			continue
+		}
+		if err := notifier.Notify(ctx, newReminder(stmt, daysLeft, level)); err != nil {
+			// the level is not recorded, the next tick retries
+			slog.Warn("Failed to send reminder", "statement_id", stmt.ID, "level", level, "error", err)
+			continue
+		}
+		slog.Info("Reminder sent", "statement_id", stmt.ID, "level", level, "days_left", daysLeft)
+
+		// the fallback level, so the target is still sent once its channel
+		// is configured
+		stmt.ReminderLevel = int(level)
+		err := e.updateReminderState(ctx, stmt.ID, func(stored *statements.Statement) {
+			stored.ReminderLevel = max(stored.ReminderLevel, int(level))
+		})
+		if err != nil && !errors.Is(err, statements.ErrQueued) && !errors.Is(err, ErrStatementNotFound) {
+			return err
+		}
+	}
+	return e.sendDigest(ctx, stmts, now)
+}
+
+// sendDigest sends the mentions not sent yet in one message to every digest
+// sender, at most once a day. The send time is recorded on the statements, so
+// neither the mentions nor the day of the last digest are lost on a restart.
+// When every sender fails, the next tick retries.
+func (e *Escalator) sendDigest(ctx context.Context, stmts []statements.Statement, now time.Time) error {
+	if len(e.DigestSenders) == 0 || now.UTC().Hour() < e.DigestHour {
+		return nil
+	}
+	today := now.UTC().Format(time.DateOnly)
+	for _, stmt := range stmts {
+		if stmt.ReminderDigestedAt != nil && stmt.ReminderDigestedAt.UTC().Format(time.DateOnly) == today {
+			return nil
+		}
+	}
+	mentions := digestMentions(stmts, now)
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	msg := digestMessage(mentions)
+	sent := false
+	for name, sender := range e.DigestSenders {
+		if err := sender.Send(ctx, msg); err != nil {
+			slog.Warn("Failed to send the reminder digest", "channel", name, "error", err)
+			continue
+		}
+		slog.Info("Reminder digest sent", "channel", name, "mentions", len(mentions))
+		sent = true
+	}
+	if !sent {
+		return nil
+	}
+
+	digestedAt := now.UTC()
+	for _, r := range mentions {
+		err := e.updateReminderState(ctx, r.StatementID, func(stored *statements.Statement) {
+			stored.ReminderDigestedAt = &digestedAt
+		})
+		if err != nil && !errors.Is(err, statements.ErrQueued) && !errors.Is(err, ErrStatementNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// digestMentions are the unpaid statements mentioned at the digest level and
+// not sent in a digest yet, earliest due first.
+func digestMentions(stmts []statements.Statement, now time.Time) []Reminder {
+	result := []Reminder{}
+	for i := range stmts {
+		stmt := &stmts[i]
+		daysLeft, ok := pending(stmt, now)
+		if !ok || Level(stmt.ReminderLevel) != LevelDigest || stmt.ReminderDigestedAt != nil {
+			continue
+		}
+		result = append(result, newReminder(stmt, daysLeft, LevelDigest))
+	}
+	sortReminders(result)
+	return result
+}
+
+func digestMessage(mentions []Reminder) Message {
+	var text strings.Builder
+	for _, r := range mentions {
+		text.WriteString("- " + r.Message() + "\n")
+	}
+	return Message{
+		Subject: fmt.Sprintf("Payments due soon (%d)", len(mentions)),
+		Text:    text.String(),
+	}
+}
+
+// updateReminderState applies update to the stored statement, not to a copy
+// listed earlier that a concurrent ingest or payment may have replaced since.
+func (e *Escalator) updateReminderState(ctx context.Context, statementID string, update func(*statements.Statement)) error {
+	stmt, err := e.Repo.GetStatement(ctx, statementID)
+	if err != nil {
+		return err
+	}
+	if stmt == nil {
+		return ErrStatementNotFound
+	}
+	update(stmt)
+	return e.Repo.UpsertStatement(ctx, stmt)
+}
+
+// notifierFor falls back to the closest lower level when the channel of the
+// target level is not configured, e.g. email when there is no Telegram bot.
+func (e *Escalator) notifierFor(target Level) (Level, Notifier) {
+	for l := target; l > LevelNone; l-- {
+		if n, ok := e.Notifiers[l]; ok {
+			return l, n
+		}
+	}
+	return LevelNone, nil
+}
+
+// Active lists the unpaid statements inside their escalation window with the
+// level reached so far, earliest due first.
+func (e *Escalator) Active(ctx context.Context, now time.Time) ([]Reminder, error) {
+	policies, err := e.policies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stmts, err := e.Repo.ListStatements(ctx, statements.StatementFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Reminder{}
+	for i := range stmts {
+		stmt := &stmts[i]
+		daysLeft, ok := pending(stmt, now)
+		if !ok || policies.For(stmt).LevelAt(daysLeft) == LevelNone {
+			continue
+		}
+		result = append(result, newReminder(stmt, daysLeft, Level(stmt.ReminderLevel)))
+	}
+	sortReminders(result)
+	return result, nil
+}
+
+// Acknowledge silences further escalation for a statement.
+func (e *Escalator) Acknowledge(ctx context.Context, statementID string, now time.Time) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ackedAt := now.UTC()
+	return e.updateReminderState(ctx, statementID, func(stored *statements.Statement) {
+		stored.ReminderAckedAt = &ackedAt
+	})
+}
+
+// Mentions lists the statements waiting for the next digest.
+func (e *Escalator) Mentions(ctx context.Context, now time.Time) ([]Reminder, error) {
+	stmts, err := e.Repo.ListStatements(ctx, statements.StatementFilter{})
+	if err != nil {
+		return nil, err
+	}
+	return digestMentions(stmts, now), nil
+}
+
+// pending reports whether the statement is unpaid and not yet due, with the
+// number of days left. Overdue statements are not escalated any further.
+func pending(stmt *statements.Statement, now time.Time) (int, bool) {
+	if stmt.PaymentDueDate == nil || stmt.ReminderAckedAt != nil || !stmt.NeedsManualPayment() {
+		return 0, false
+	}
+	daysLeft := daysUntil(*stmt.PaymentDueDate, now)
+	return daysLeft, daysLeft >= 0
+}
+
+func sortReminders(reminders []Reminder) {
+	sort.Slice(reminders, func(i, j int) bool {
+		if !reminders[i].DueDate.Equal(reminders[j].DueDate) {
+			return reminders[i].DueDate.Before(reminders[j].DueDate)
+		}
+		return reminders[i].StatementID < reminders[j].StatementID
+	})
+}
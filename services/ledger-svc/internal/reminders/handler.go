@@ -0,0 +1,126 @@
+package reminders
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/jsonbody"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+type Handler struct {
+	Escalator *Escalator
+}
+
+// RemindersHandler serves GET /api/reminders: the statements being escalated
+// and the mentions waiting for the next digest.
+func (h *Handler) RemindersHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	active, err := h.Escalator.Active(r.Context(), now)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list reminders", "error", err)
+		apierror.Reply(w, "Failed to list reminders", http.StatusInternalServerError)
+		return
+	}
+	digest, err := h.Escalator.Mentions(r.Context(), now)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list reminders", "error", err)
+		apierror.Reply(w, "Failed to list reminders", http.StatusInternalServerError)
+		return
+	}
+
+	body := struct {
+		Active []Reminder `json:"active"`
+		Digest []Reminder `json:"digest"`
+	}{active, digest}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to encode JSON response", "error", err)
+		apierror.Reply(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// AcknowledgeHandler serves POST /api/statements/{id}/reminders/ack.
+func (h *Handler) AcknowledgeHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := h.Escalator.Acknowledge(r.Context(), id, time.Now())
+	switch {
+	case errors.Is(err, ErrStatementNotFound):
+		apierror.Write(w, err)
+	case errors.Is(err, statements.ErrQueued):
+		w.WriteHeader(http.StatusAccepted)
+	case err != nil:
+		accesslog.Logger(r.Context()).Error("Failed to acknowledge reminder", "id", id, "error", err)
+		apierror.Reply(w, "Failed to acknowledge reminder", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// PreferencesHandler serves GET /api/reminders/preferences.
+func (h *Handler) PreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	prefs, err := h.Escalator.Preferences.List(r.Context())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list reminder preferences", "error", err)
+		apierror.Reply(w, "Failed to list reminder preferences", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+// SavePreferenceHandler serves PUT /api/reminders/preferences/{source} with
+// {"disabled": false, "escalation": "5:email,1:webhook"}.
+func (h *Handler) SavePreferenceHandler(w http.ResponseWriter, r *http.Request) {
+	var pref Preference
+	if err := jsonbody.Decode(w, r, &pref); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	pref.Source = r.PathValue("source")
+	if pref.Escalation != "" {
+		policy, err := ParsePolicy(pref.Escalation)
+		if err != nil {
+			apierror.Reply(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pref.Escalation = policy.String()
+	}
+	pref.UpdatedAt = time.Now().UTC()
+	if err := h.Escalator.Preferences.Save(r.Context(), &pref); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to save reminder preference", "source", pref.Source, "error", err)
+		apierror.Reply(w, "Failed to save reminder preference", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, pref)
+}
+
+// DeletePreferenceHandler serves DELETE /api/reminders/preferences/{source},
+// returning the source to the configured policy.
+func (h *Handler) DeletePreferenceHandler(w http.ResponseWriter, r *http.Request) {
+	source := r.PathValue("source")
+	err := h.Escalator.Preferences.Delete(r.Context(), source)
+	switch {
+	case errors.Is(err, ErrPreferenceNotFound):
+		apierror.Write(w, err)
+	case err != nil:
+		accesslog.Logger(r.Context()).Error("Failed to delete reminder preference", "source", source, "error", err)
+		apierror.Reply(w, "Failed to delete reminder preference", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
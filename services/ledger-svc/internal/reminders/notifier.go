@@ -0,0 +1,294 @@
+package reminders
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+type Notifier interface {
+	Notify(ctx context.Context, reminder Reminder) error
+}
+
+// Message is a notification other than a payment reminder, such as the
+// monthly digest. HTML is the rich alternative of Text for the channels that
+// render it.
+type Message struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
+}
+
+// Sender is implemented by the notifiers that deliver any message, all but the
+// digest one.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// DigestNotifier only mentions the statement in the next digest: the digest
+// level recorded on the statement is the mention, the escalator sends the
+// digest of the pending ones once a day.
+type DigestNotifier struct{}
+
+func (DigestNotifier) Notify(context.Context, Reminder) error {
+	return nil
+}
+
+// SendersFromEnv returns the notifiers named in the variable key, a
+// comma-separated list of email, telegram and webhook configured like the
+// reminders.
+func SendersFromEnv(key string) (map[string]Sender, error) {
+	senders := map[string]Sender{}
+	for _, name := range strings.Split(os.Getenv(key), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		var sender Sender
+		switch name {
+		case "":
+			continue
+		case "email":
+			if n := NewEmailNotifierFromEnv(); n != nil {
+				sender = n
+			}
+		case "telegram":
+			if n := NewTelegramNotifierFromEnv(); n != nil {
+				sender = n
+			}
+		case "webhook":
+			if n := NewWebhookNotifierFromEnv(); n != nil {
+				sender = n
+			}
+		default:
+			return nil, fmt.Errorf("%s: unknown channel %q, expected email, telegram or webhook", key, name)
+		}
+		if sender == nil {
+			return nil, fmt.Errorf("%s: channel %s is not configured", key, name)
+		}
+		senders[name] = sender
+	}
+	return senders, nil
+}
+
+type EmailNotifier struct {
+	Addr     string
+	From     string
+	To       []string
+	Username string
+	Password string
+}
+
+// NewEmailNotifierFromEnv returns nil when SMTP_ADDR or REMINDER_EMAIL_TO is missing.
+func NewEmailNotifierFromEnv() *EmailNotifier {
+	addr, to := os.Getenv("SMTP_ADDR"), os.Getenv("REMINDER_EMAIL_TO")
+	if addr == "" || to == "" {
+		return nil
+	}
+	return &EmailNotifier{
+		Addr:     addr,
+		From:     envOr("SMTP_FROM", "finchie@localhost"),
+		To:       strings.Split(to, ","),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+	}
+}
+
+func (n *EmailNotifier) Notify(_ context.Context, reminder Reminder) error {
+	subject := fmt.Sprintf("Payment reminder: %s due %s", headerLine.Replace(reminder.SourceName), reminder.DueDate.Format(time.DateOnly))
+	return n.mail(subject, "text/plain; charset=utf-8", []byte(reminder.Message()+"\r\n"))
+}
+
+// Send mails the message as multipart/alternative when it has an HTML part.
+func (n *EmailNotifier) Send(_ context.Context, msg Message) error {
+	if msg.HTML == "" {
+		return n.mail(msg.Subject, "text/plain; charset=utf-8", []byte(msg.Text+"\r\n"))
+	}
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return err
+		}
+		if err := qp.Close(); err != nil {
+			return err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return err
+	}
+	return n.mail(msg.Subject, "multipart/alternative; boundary="+parts.Boundary(), body.Bytes())
+}
+
+// headerLine keeps a subject on one header line, a source name or message
+// subject with a line break would otherwise inject headers.
+var headerLine = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+func (n *EmailNotifier) mail(subject, contentType string, body []byte) error {
+	var auth smtp.Auth
+	if n.Username != "" {
+		host, _, _ := strings.Cut(n.Addr, ":")
+		auth = smtp.PlainAuth("", n.Username, n.Password, host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerLine.Replace(subject)))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: %s\r\n\r\n", contentType)
+	msg.Write(body)
+	return smtp.SendMail(n.Addr, auth, n.From, n.To, msg.Bytes())
+}
+
+type TelegramNotifier struct {
+	Token  string
+	ChatID string
+	Client *http.Client
+}
+
+// NewTelegramNotifierFromEnv returns nil when TELEGRAM_BOT_TOKEN or TELEGRAM_CHAT_ID is missing.
+func NewTelegramNotifierFromEnv() *TelegramNotifier {
+	token, chatID := os.Getenv("TELEGRAM_BOT_TOKEN"), os.Getenv("TELEGRAM_CHAT_ID")
+	if token == "" || chatID == "" {
+		return nil
+	}
+	return &TelegramNotifier{Token: token, ChatID: chatID, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (n *TelegramNotifier) Notify(ctx context.Context, reminder Reminder) error {
+	return n.sendMessage(ctx, reminder.Message())
+}
+
+// Send posts the subject and the plain text, Telegram does not render HTML
+// documents.
+func (n *TelegramNotifier) Send(ctx context.Context, msg Message) error {
+	text := msg.Subject + "\n\n" + msg.Text
+	if runes := []rune(text); len(runes) > telegramMaxText {
+		text = string(runes[:telegramMaxText-1]) + "…"
+	}
+	return n.sendMessage(ctx, text)
+}
+
+// telegramMaxText is the longest text sendMessage accepts.
+const telegramMaxText = 4096
+
+func (n *TelegramNotifier) sendMessage(ctx context.Context, text string) error {
+	body, err := json.Marshal(map[string]string{
+		"chat_id": n.ChatID,
+		"text":    text,
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", n.Token)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		// the URL holds the bot token, keep it out of the logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram sendMessage: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("telegram sendMessage returned %s", resp.Status)
+	}
+	return nil
+}
+
+// WebhookNotifier POSTs the reminder as JSON. With a secret, the body is signed
+// with HMAC-SHA256 in the X-Finchie-Signature header, like the event webhook.
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// NewWebhookNotifierFromEnv returns nil when REMINDER_WEBHOOK_URL is missing.
+func NewWebhookNotifierFromEnv() *WebhookNotifier {
+	url := os.Getenv("REMINDER_WEBHOOK_URL")
+	if url == "" {
+		return nil
+	}
+	return &WebhookNotifier{URL: url, Secret: os.Getenv("REMINDER_WEBHOOK_SECRET"), Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, reminder Reminder) error {
+	return n.post(ctx, "reminder", struct {
+		Reminder
+		Message string `json:"message"`
+	}{reminder, reminder.Message()})
+}
+
+// Send posts the message as JSON with the X-Finchie-Event header "message".
+func (n *WebhookNotifier) Send(ctx context.Context, msg Message) error {
+	return n.post(ctx, "message", msg)
+}
+
+func (n *WebhookNotifier) post(ctx context.Context, event string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Finchie-Event", event)
+	if n.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Finchie-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s webhook returned %s", event, resp.Status)
+	}
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
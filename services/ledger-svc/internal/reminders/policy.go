@@ -0,0 +1,232 @@
+package reminders
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Level is how loudly an unpaid statement is brought up. Levels only go up.
+type Level int
+
+const (
+	LevelNone Level = iota
+	LevelDigest
+	LevelEmail
+	LevelTelegram
+	LevelWebhook
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelNone:
+		return "none"
+	case LevelDigest:
+		return "digest"
+	case LevelEmail:
+		return "email"
+	case LevelTelegram:
+		return "telegram"
+	case LevelWebhook:
+		return "webhook"
+	default:
+		return fmt.Sprintf("level_%d", int(l))
+	}
+}
+
+func parseLevel(s string) (Level, error) {
+	for l := LevelDigest; l <= LevelWebhook; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	return LevelNone, fmt.Errorf("unknown reminder level %q", s)
+}
+
+// Step escalates to Level once the due date is DaysBefore days away or less.
+type Step struct {
+	DaysBefore int
+	Level      Level
+}
+
+type Policy []Step
+
+// DefaultPolicy mentions a statement in the digest a week ahead, emails three
+// days ahead and pings on Telegram the day before.
+var DefaultPolicy = Policy{
+	{DaysBefore: 7, Level: LevelDigest},
+	{DaysBefore: 3, Level: LevelEmail},
+	{DaysBefore: 1, Level: LevelTelegram},
+}
+
+// ParsePolicy reads "7:digest,3:email,1:telegram".
+func ParsePolicy(s string) (Policy, error) {
+	var policy Policy
+	for _, part := range strings.Split(s, ",") {
+		days, level, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid escalation step %q, expected <days>:<level>", part)
+		}
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid days in escalation step %q", part)
+		}
+		l, err := parseLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		policy = append(policy, Step{DaysBefore: n, Level: l})
+	}
+	sort.Slice(policy, func(i, j int) bool {
+		return policy[i].DaysBefore > policy[j].DaysBefore
+	})
+	return policy, nil
+}
+
+func (p Policy) String() string {
+	parts := make([]string, len(p))
+	for i, step := range p {
+		parts[i] = fmt.Sprintf("%d:%s", step.DaysBefore, step.Level)
+	}
+	return strings.Join(parts, ",")
+}
+
+// LevelAt is the highest level reached daysLeft days before the due date.
+func (p Policy) LevelAt(daysLeft int) Level {
+	level := LevelNone
+	for _, step := range p {
+		if daysLeft <= step.DaysBefore && step.Level > level {
+			level = step.Level
+		}
+	}
+	return level
+}
+
+// Policies holds the default policy and per-source overrides.
+type Policies struct {
+	Default   Policy
+	Overrides map[string]Policy
+}
+
+// PoliciesFromEnv reads REMINDER_ESCALATION and per-source overrides named
+// REMINDER_ESCALATION_<SOURCE>, e.g. REMINDER_ESCALATION_TSIB=5:email,1:telegram.
+func PoliciesFromEnv() (Policies, error) {
+	policies := Policies{Default: DefaultPolicy, Overrides: map[string]Policy{}}
+	if v := os.Getenv("REMINDER_ESCALATION"); v != "" {
+		p, err := ParsePolicy(v)
+		if err != nil {
+			return policies, fmt.Errorf("REMINDER_ESCALATION: %w", err)
+		}
+		policies.Default = p
+	}
+
+	const prefix = "REMINDER_ESCALATION_"
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(key, prefix) || value == "" {
+			continue
+		}
+		p, err := ParsePolicy(value)
+		if err != nil {
+			return policies, fmt.Errorf("%s: %w", key, err)
+		}
+		policies.Overrides[strings.TrimPrefix(key, prefix)] = p
+	}
+	return policies, nil
+}
+
+// With returns the policies with the stored preferences taking precedence
+// over the overrides from the environment. A disabled source gets an empty
+// policy, it is never reminded.
+func (p Policies) With(prefs []Preference) Policies {
+	overrides := make(map[string]Policy, len(p.Overrides)+len(prefs))
+	for name, policy := range p.Overrides {
+		overrides[strings.ToUpper(name)] = policy
+	}
+	for _, pref := range prefs {
+		switch {
+		case pref.Disabled:
+			overrides[strings.ToUpper(overrideKey(pref.Source))] = Policy{}
+		case pref.Escalation != "":
+			// validated when saved
+			if policy, err := ParsePolicy(pref.Escalation); err == nil {
+				overrides[strings.ToUpper(overrideKey(pref.Source))] = policy
+			}
+		}
+	}
+	return Policies{Default: p.Default, Overrides: overrides}
+}
+
+// For returns the policy of a source. Override names are matched case
+// insensitively with anything but letters and digits replaced by "_".
+func (p Policies) For(sourceName string) Policy {
+	key := overrideKey(sourceName)
+	for name, policy := range p.Overrides {
+		if strings.EqualFold(name, key) {
+			return policy
+		}
+	}
+	return p.Default
+}
+
+func overrideKey(sourceName string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, sourceName)
+}
+
+type Reminder struct {
+	StatementID string    `json:"statement_id"`
+	SourceName  string    `json:"source_name"`
+	DueDate     time.Time `json:"due_date"`
+	Amount      float64   `json:"amount"`
+	Currency    string    `json:"currency"`
+	DaysLeft    int       `json:"days_left"`
+	Level       string    `json:"level"`
+	TenantID    string    `json:"tenant_id,omitempty"`
+	UserID      string    `json:"user_id,omitempty"`
+}
+
+func newReminder(stmt *statements.Statement, daysLeft int, level Level) Reminder {
+	return Reminder{
+		StatementID: stmt.ID,
+		SourceName:  stmt.SourceName,
+		DueDate:     *stmt.PaymentDueDate,
+		Amount:      stmt.AmountToPay(),
+		Currency:    stmt.Currency,
+		DaysLeft:    daysLeft,
+		Level:       level.String(),
+		TenantID:    stmt.TenantID,
+		UserID:      stmt.UserID,
+	}
+}
+
+func (r Reminder) Message() string {
+	when := fmt.Sprintf("in %d days", r.DaysLeft)
+	switch r.DaysLeft {
+	case 0:
+		when = "today"
+	case 1:
+		when = "tomorrow"
+	}
+	return fmt.Sprintf("%s statement of %s is due %s (%s)",
+		r.SourceName, money.Format(r.Amount, r.Currency, money.Dot), when, r.DueDate.Format(time.DateOnly))
+}
+
+// daysUntil counts calendar days in UTC, 0 on the due date itself.
+func daysUntil(due, now time.Time) int {
+	day := func(t time.Time) time.Time {
+		t = t.UTC()
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return int(day(due).Sub(day(now)).Hours() / 24)
+}
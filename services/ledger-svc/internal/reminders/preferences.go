@@ -0,0 +1,177 @@
+package reminders
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrPreferenceNotFound = apierror.New(apierror.KindNotFound, "reminder_preference_not_found", "reminder preference not found")
+
+// Preference is how the statements of one account (source) are reminded,
+// overriding REMINDER_ESCALATION and its per-source variables. The
+// preferences of a tenant and user apply to their statements only, on top of
+// those without an owner.
+type Preference struct {
+	Source   string `bson:"source" json:"source"`
+	Disabled bool   `bson:"disabled" json:"disabled"`
+	// Escalation is a policy like "5:email,1:webhook", the default one when
+	// empty.
+	Escalation string    `bson:"escalation,omitempty" json:"escalation,omitempty"`
+	UpdatedAt  time.Time `bson:"updated_at" json:"updated_at"`
+	TenantID   string    `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+	UserID     string    `bson:"user_id,omitempty" json:"user_id,omitempty"`
+}
+
+// key is the ID of the preference, unique per owner and source.
+func (p *Preference) key() string {
+	return statements.OwnedID(statements.Owner(p.TenantID, p.UserID), p.Source)
+}
+
+// preferenceKey is the key of the preference of the source ctx is scoped to.
+func preferenceKey(ctx context.Context, source string) string {
+	return statements.OwnedID(statements.OwnerFrom(ctx), source)
+}
+
+type PreferenceStore interface {
+	List(ctx context.Context) ([]Preference, error)
+	Save(ctx context.Context, pref *Preference) error
+	// Delete returns ErrPreferenceNotFound when the source has none.
+	Delete(ctx context.Context, source string) error
+}
+
+// NewPreferenceStore keeps the preferences next to the statements in MongoDB,
+// or in memory for the memory driver.
+func NewPreferenceStore(repo statements.StatementRepository) PreferenceStore {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoPreferenceStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryPreferenceStore()
+}
+
+type MemoryPreferenceStore struct {
+	mu    sync.RWMutex
+	prefs map[string]Preference
+}
+
+func NewMemoryPreferenceStore() *MemoryPreferenceStore {
+	return &MemoryPreferenceStore{prefs: make(map[string]Preference)}
+}
+
+func (s *MemoryPreferenceStore) List(ctx context.Context) ([]Preference, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Preference, 0, len(s.prefs))
+	for _, p := range s.prefs {
+		if statements.Owns(ctx, p.TenantID, p.UserID) {
+			list = append(list, p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Source < list[j].Source })
+	return list, nil
+}
+
+func (s *MemoryPreferenceStore) Save(ctx context.Context, pref *Preference) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pref.TenantID, pref.UserID = statements.Stamp(ctx, pref.TenantID, pref.UserID)
+	s.prefs[pref.key()] = *pref
+	return nil
+}
+
+func (s *MemoryPreferenceStore) Delete(ctx context.Context, source string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := preferenceKey(ctx, source)
+	if _, ok := s.prefs[key]; !ok {
+		return ErrPreferenceNotFound
+	}
+	delete(s.prefs, key)
+	return nil
+}
+
+// MongoPreferenceStore keeps the preferences in the
+// <namespace>reminder_preferences collection.
+type MongoPreferenceStore struct {
+	col *mongo.Collection
+}
+
+func NewMongoPreferenceStore(db *mongo.Database, namespace string) *MongoPreferenceStore {
+	return &MongoPreferenceStore{col: db.Collection(namespace + "reminder_preferences")}
+}
+
+func (s *MongoPreferenceStore) List(ctx context.Context) ([]Preference, error) {
+	cursor, err := s.col.Find(ctx, statements.OwnerFilter(ctx, bson.M{}), options.Find().SetSort(bson.D{{Key: "source", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	list := []Preference{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *MongoPreferenceStore) Save(ctx context.Context, pref *Preference) error {
+	pref.TenantID, pref.UserID = statements.Stamp(ctx, pref.TenantID, pref.UserID)
+	_, err := s.col.ReplaceOne(ctx, bson.M{"_id": pref.key()}, pref, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoPreferenceStore) Delete(ctx context.Context, source string) error {
+	result, err := s.col.DeleteOne(ctx, bson.M{"_id": preferenceKey(ctx, source)})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrPreferenceNotFound
+	}
+	return nil
+}
+
+// ownerPolicies are the policies of every owner, see statements.Owner, those
+// of the preferences without an owner under the empty one.
+type ownerPolicies map[string]Policies
+
+// For returns the policy of the statement, by its owner and source.
+func (p ownerPolicies) For(stmt *statements.Statement) Policy {
+	if owned, ok := p[statements.Owner(stmt.TenantID, stmt.UserID)]; ok {
+		return owned.For(stmt.SourceName)
+	}
+	return p[""].For(stmt.SourceName)
+}
+
+// policies returns the policies with the stored preferences applied, those
+// of an owner over those without one.
+func (e *Escalator) policies(ctx context.Context) (ownerPolicies, error) {
+	if e.Preferences == nil {
+		return ownerPolicies{"": e.Policies}, nil
+	}
+	prefs, err := e.Preferences.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byOwner := map[string][]Preference{}
+	for _, pref := range prefs {
+		owner := statements.Owner(pref.TenantID, pref.UserID)
+		byOwner[owner] = append(byOwner[owner], pref)
+	}
+	deployment := e.Policies.With(byOwner[""])
+	policies := ownerPolicies{"": deployment}
+	for owner, owned := range byOwner {
+		if owner != "" {
+			policies[owner] = deployment.With(owned)
+		}
+	}
+	return policies, nil
+}
@@ -0,0 +1,221 @@
+package reports
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"log/slog"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/merchants"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/reminders"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const (
+	digestTop = 5
+	// digestDueDays is how far ahead the digest lists the statements to pay.
+	digestDueDays = 30
+)
+
+//go:embed templates/digest.txt.tmpl templates/digest.html.tmpl
+var digestTemplates embed.FS
+
+var digestFuncs = map[string]any{
+	"amount": func(amount float64) string { return money.Format(amount, "", money.Dot) },
+	"money":  func(amount float64, currency string) string { return money.Format(amount, currency, money.Dot) },
+	"date":   func(t time.Time) string { return t.Format(time.DateOnly) },
+}
+
+var (
+	digestText = template.Must(template.New("digest.txt.tmpl").Funcs(digestFuncs).ParseFS(digestTemplates, "templates/digest.txt.tmpl"))
+	digestHTML = htmltemplate.Must(htmltemplate.New("digest.html.tmpl").Funcs(digestFuncs).ParseFS(digestTemplates, "templates/digest.html.tmpl"))
+)
+
+// Digest is the monthly summary sent to the user: the figures of the report,
+// the merchants the money went to and what is due next.
+type Digest struct {
+	Month         string      `json:"month"`
+	Total         float64     `json:"total"`
+	Transactions  int         `json:"transactions"`
+	TopCategories []Breakdown `json:"top_categories"`
+	Merchants     []Breakdown `json:"merchants"`
+	// Fees adds up the fees and the interest charged in the month.
+	Fees     float64 `json:"fees"`
+	FeeCount int     `json:"fee_count"`
+	Upcoming []Due   `json:"upcoming"`
+	// Reported is whether the figures are the ones of the month-end
+	// snapshot rather than computed from the current data.
+	Reported    bool      `json:"reported"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// Due is a statement to pay by hand within the next digestDueDays days.
+type Due struct {
+	Source   string    `json:"source"`
+	Date     time.Time `json:"date"`
+	Amount   float64   `json:"amount"`
+	Currency string    `json:"currency"`
+}
+
+// Digest summarizes the month from its snapshot, or from the current data
+// before the month is snapshotted. The merchants are always read from the
+// current transactions, the snapshots do not keep them.
+func (g *Generator) Digest(ctx context.Context, month time.Time, now time.Time) (*Digest, error) {
+	report, err := g.Store.Get(ctx, month.Format(monthLayout))
+	if err != nil {
+		return nil, err
+	}
+	reported := report != nil
+	if report == nil || report.SpendTypes == nil {
+		current, err := g.Compute(ctx, month, "")
+		if err != nil {
+			return nil, err
+		}
+		if report == nil {
+			report = current
+		} else {
+			report.SpendTypes = current.SpendTypes
+		}
+	}
+
+	d := &Digest{
+		Month:         report.Month,
+		Total:         report.Total,
+		Transactions:  report.Transactions,
+		TopCategories: largest(report.TopCategories, digestTop),
+		Reported:      reported,
+		GeneratedAt:   now.UTC(),
+	}
+	for _, t := range report.SpendTypes {
+		if t.Name == string(statements.SpendFee) || t.Name == string(statements.SpendInterest) {
+			d.Fees += t.Amount
+			d.FeeCount += t.Count
+		}
+	}
+	d.Fees = money.Round(d.Fees)
+
+	txs, err := g.Repo.FindTransactions(ctx, statements.TransactionFilter{From: month, To: month.AddDate(0, 1, 0), SpendType: statements.SpendMerchant})
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]string{}
+	spend := breakdowns{}
+	for i := range txs {
+		if txs[i].Amount <= 0 || statements.IsClientEncrypted(txs[i].Description) {
+			// the server cannot read the merchant of an encrypted description
+			continue
+		}
+		key := merchants.Key(txs[i].Description)
+		if key == "" {
+			continue
+		}
+		if _, ok := names[key]; !ok {
+			names[key] = txs[i].Description
+		}
+		spend.add(key, txs[i].Amount)
+	}
+	d.Merchants = largest(spend.sorted(), digestTop)
+	for i := range d.Merchants {
+		d.Merchants[i].Name = names[d.Merchants[i].Name]
+	}
+
+	stmts, err := g.Repo.ListStatements(ctx, statements.StatementFilter{})
+	if err != nil {
+		return nil, err
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	until := today.AddDate(0, 0, digestDueDays)
+	for i := range stmts {
+		stmt := &stmts[i]
+		if stmt.PaymentDueDate == nil || stmt.PaymentDueDate.Before(today) || !stmt.PaymentDueDate.Before(until) || !stmt.NeedsManualPayment() {
+			continue
+		}
+		d.Upcoming = append(d.Upcoming, Due{
+			Source:   stmt.SourceName,
+			Date:     stmt.PaymentDueDate.UTC(),
+			Amount:   money.Round(stmt.AmountToPay()),
+			Currency: stmt.Currency,
+		})
+	}
+	sort.Slice(d.Upcoming, func(i, j int) bool { return d.Upcoming[i].Date.Before(d.Upcoming[j].Date) })
+	return d, nil
+}
+
+// largest returns the n entries with the highest amounts, highest first.
+func largest(list []Breakdown, n int) []Breakdown {
+	sorted := append([]Breakdown(nil), list...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Amount > sorted[j].Amount })
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// Subject is the subject line of the digest.
+func (d *Digest) Subject() string {
+	month, _ := time.Parse(monthLayout, d.Month)
+	return fmt.Sprintf("Finchie: your %s summary", month.Format("January 2006"))
+}
+
+// Text renders the plain text digest.
+func (d *Digest) Text() (string, error) {
+	var b bytes.Buffer
+	if err := digestText.Execute(&b, d); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// HTML renders the digest as an HTML document.
+func (d *Digest) HTML() (string, error) {
+	var b bytes.Buffer
+	if err := digestHTML.Execute(&b, d); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Message renders both forms for the notifiers.
+func (d *Digest) Message() (reminders.Message, error) {
+	text, err := d.Text()
+	if err != nil {
+		return reminders.Message{}, err
+	}
+	html, err := d.HTML()
+	if err != nil {
+		return reminders.Message{}, err
+	}
+	return reminders.Message{Subject: d.Subject(), Text: text, HTML: html}, nil
+}
+
+// sendDigest delivers the digest of the month to every sender. A failed
+// delivery is logged and not retried, the digest stays readable at
+// /api/reports/monthly/{month}.
+func (g *Generator) sendDigest(ctx context.Context, month time.Time, now time.Time) {
+	if len(g.Senders) == 0 {
+		return
+	}
+	digest, err := g.Digest(ctx, month, now)
+	if err != nil {
+		slog.Warn("Failed to build the monthly digest", "month", month.Format(monthLayout), "error", err)
+		return
+	}
+	msg, err := digest.Message()
+	if err != nil {
+		slog.Warn("Failed to render the monthly digest", "month", digest.Month, "error", err)
+		return
+	}
+	for name, sender := range g.Senders {
+		if err := sender.Send(ctx, msg); err != nil {
+			slog.Warn("Failed to send the monthly digest", "month", digest.Month, "channel", name, "error", err)
+			continue
+		}
+		slog.Info("Monthly digest sent", "month", digest.Month, "channel", name)
+	}
+}
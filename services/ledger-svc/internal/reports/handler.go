@@ -0,0 +1,127 @@
+package reports
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+type Handler struct {
+	Generator *Generator
+}
+
+// ReportsHandler serves GET /api/reports, the snapshotted months without their
+// breakdowns, newest first.
+func (h *Handler) ReportsHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Generator.Store.List(r.Context())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list reports", "error", err)
+		apierror.Reply(w, "Failed to list reports", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, list)
+}
+
+// ReportHandler serves GET /api/reports/{month} with the month as YYYY-MM: the
+// snapshot as reported and the report as currently computed, and whether the
+// figures changed since. view=reported or view=current returns only one.
+func (h *Handler) ReportHandler(w http.ResponseWriter, r *http.Request) {
+	month, err := time.Parse(monthLayout, r.PathValue("month"))
+	if err != nil {
+		apierror.Reply(w, "Invalid month, expected YYYY-MM", http.StatusBadRequest)
+		return
+	}
+	view := r.URL.Query().Get("view")
+	if view != "" && view != "reported" && view != "current" {
+		apierror.Reply(w, "Invalid view parameter, expected reported or current", http.StatusBadRequest)
+		return
+	}
+
+	var reported, current *Report
+	if view != "current" {
+		if reported, err = h.Generator.Store.Get(r.Context(), month.Format(monthLayout)); err != nil {
+			accesslog.Logger(r.Context()).Error("Failed to read report", "month", month.Format(monthLayout), "error", err)
+			apierror.Reply(w, "Failed to read report", http.StatusInternalServerError)
+			return
+		}
+		if reported == nil && view == "reported" {
+			apierror.Reply(w, "No report was snapshotted for this month", http.StatusNotFound)
+			return
+		}
+	}
+	if view != "reported" {
+		if current, err = h.Generator.Compute(r.Context(), month, ""); err != nil {
+			accesslog.Logger(r.Context()).Error("Failed to compute report", "month", month.Format(monthLayout), "error", err)
+			apierror.Reply(w, "Failed to compute report", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	switch view {
+	case "reported":
+		writeJSON(w, reported)
+	case "current":
+		writeJSON(w, current)
+	default:
+		writeJSON(w, struct {
+			Month    string  `json:"month"`
+			Reported *Report `json:"reported"`
+			Current  *Report `json:"current"`
+			Changed  bool    `json:"changed"`
+		}{month.Format(monthLayout), reported, current, reported != nil && !SameFigures(reported, current)})
+	}
+}
+
+// DigestHandler serves GET /api/reports/monthly/{month}, the digest of the
+// month as JSON, or rendered with format=html or format=text.
+func (h *Handler) DigestHandler(w http.ResponseWriter, r *http.Request) {
+	month, err := time.Parse(monthLayout, r.PathValue("month"))
+	if err != nil {
+		apierror.Reply(w, "Invalid month, expected YYYY-MM", http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "html" && format != "text" {
+		apierror.Reply(w, "Invalid format parameter, expected json, html or text", http.StatusBadRequest)
+		return
+	}
+
+	digest, err := h.Generator.Digest(r.Context(), month, time.Now())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to build digest", "month", month.Format(monthLayout), "error", err)
+		apierror.Reply(w, "Failed to build digest", http.StatusInternalServerError)
+		return
+	}
+	if format == "" || format == "json" {
+		writeJSON(w, digest)
+		return
+	}
+
+	render, contentType := digest.Text, "text/plain; charset=utf-8"
+	if format == "html" {
+		render, contentType = digest.HTML, "text/html; charset=utf-8"
+	}
+	body, err := render()
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to render digest", "month", digest.Month, "error", err)
+		apierror.Reply(w, "Failed to render digest", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	if _, err := io.WriteString(w, body); err != nil {
+		accesslog.Logger(r.Context()).Warn("Failed to write digest", "error", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+		apierror.Reply(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
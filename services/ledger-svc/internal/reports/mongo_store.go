@@ -0,0 +1,62 @@
+package reports
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps one document per month in the <namespace>reports
+// collection, keyed by the month.
+type MongoStore struct {
+	col *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database, namespace string) *MongoStore {
+	return &MongoStore{col: db.Collection(namespace + "reports")}
+}
+
+func (s *MongoStore) Get(ctx context.Context, month string) (*Report, error) {
+	var report Report
+	err := s.col.FindOne(ctx, bson.M{"_id": month}).Decode(&report)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (s *MongoStore) List(ctx context.Context) ([]Report, error) {
+	cursor, err := s.col.Find(ctx, bson.M{}, options.Find().
+		SetSort(bson.D{{Key: "_id", Value: -1}}).
+		SetProjection(bson.M{"sources": 0, "categories": 0, "top_categories": 0, "budgets": 0}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	reports := []Report{}
+	if err := cursor.All(ctx, &reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// Create inserts the snapshot; the unique _id keeps the first one of a month.
+func (s *MongoStore) Create(ctx context.Context, report *Report) error {
+	_, err := s.col.InsertOne(ctx, report)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrExists
+	}
+	return err
+}
+
+func (s *MongoStore) Redact(ctx context.Context, report *Report) error {
+	_, err := s.col.ReplaceOne(ctx, bson.M{"_id": report.Month}, report)
+	return err
+}
@@ -0,0 +1,300 @@
+// Package reports snapshots the month-end summary once the month is over and
+// keeps it unchanged, so what a past report said stays known after the
+// transactions behind it are edited.
+package reports
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/budgets"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/categories"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/reminders"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const (
+	monthLayout        = "2006-01"
+	uncategorizedLabel = "Uncategorized"
+)
+
+// Report is the summary of the transactions dated in one month.
+type Report struct {
+	Month         string      `bson:"_id" json:"month"`
+	Total         float64     `bson:"total" json:"total"`
+	Transactions  int         `bson:"transactions" json:"transactions"`
+	Sources       []Breakdown `bson:"sources" json:"sources,omitempty"`
+	Categories    []Breakdown `bson:"categories" json:"categories,omitempty"`
+	TopCategories []Breakdown `bson:"top_categories" json:"top_categories,omitempty"`
+	// SpendTypes separates the merchant spend from fees, interest, transfers
+	// and refunds; snapshots taken before it was added have none.
+	SpendTypes []Breakdown     `bson:"spend_types,omitempty" json:"spend_types,omitempty"`
+	Budgets    []BudgetOutcome `bson:"budgets,omitempty" json:"budgets,omitempty"`
+	// TaxonomyVersion is the category taxonomy TopCategories and Budgets were
+	// rolled up along.
+	TaxonomyVersion int       `bson:"taxonomy_version" json:"taxonomy_version"`
+	GeneratedAt     time.Time `bson:"generated_at" json:"generated_at"`
+}
+
+type Breakdown struct {
+	Name   string  `bson:"name" json:"name"`
+	Amount float64 `bson:"amount" json:"amount"`
+	Count  int     `bson:"count" json:"count"`
+}
+
+// BudgetOutcome is the spend against a monthly budget, an empty category
+// being the overall one. Rollovers are not applied.
+type BudgetOutcome struct {
+	Category  string  `bson:"category" json:"category"`
+	Limit     float64 `bson:"limit" json:"limit"`
+	Spent     float64 `bson:"spent" json:"spent"`
+	Remaining float64 `bson:"remaining" json:"remaining"`
+	Over      bool    `bson:"over" json:"over"`
+}
+
+// SameFigures reports whether two reports of a month show the same numbers,
+// regardless of when they were generated.
+func SameFigures(a, b *Report) bool {
+	x, y := *a, *b
+	x.GeneratedAt, y.GeneratedAt = time.Time{}, time.Time{}
+	x.TaxonomyVersion, y.TaxonomyVersion = 0, 0
+	if x.SpendTypes == nil || y.SpendTypes == nil {
+		x.SpendTypes, y.SpendTypes = nil, nil
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// Generator computes reports and snapshots the last completed month.
+type Generator struct {
+	Repo       statements.StatementRepository
+	Store      Store
+	Categories categories.Store
+	Budgets    budgets.Store
+	// Delay lets late statements of the month arrive before the snapshot.
+	Delay time.Duration
+	// Senders receive the digest of each month once it is snapshotted.
+	Senders map[string]reminders.Sender
+}
+
+// NewGeneratorFromEnv reads the snapshot delay REPORTS_SNAPSHOT_DELAY_DAYS,
+// five days by default, and the digest channels REPORTS_DIGEST_CHANNELS.
+func NewGeneratorFromEnv(repo statements.StatementRepository, categoryStore categories.Store, budgetStore budgets.Store) (*Generator, error) {
+	days, err := strconv.Atoi(os.Getenv("REPORTS_SNAPSHOT_DELAY_DAYS"))
+	if err != nil || days < 0 {
+		days = 5
+	}
+	senders, err := reminders.SendersFromEnv("REPORTS_DIGEST_CHANNELS")
+	if err != nil {
+		return nil, err
+	}
+	return &Generator{
+		Repo:       repo,
+		Store:      NewStore(repo),
+		Categories: categoryStore,
+		Budgets:    budgetStore,
+		Delay:      time.Duration(days) * 24 * time.Hour,
+		Senders:    senders,
+	}, nil
+}
+
+// Snapshot persists the report of the last month that ended at least Delay
+// before now, unless it exists, and sends its digest. Months missed while the
+// service was down are not backfilled, a report computed later would not be
+// the one of month end.
+func (g *Generator) Snapshot(ctx context.Context, now time.Time) error {
+	month := monthOf(now.Add(-g.Delay)).AddDate(0, -1, 0)
+	existing, err := g.Store.Get(ctx, month.Format(monthLayout))
+	if err != nil || existing != nil {
+		return err
+	}
+
+	report, err := g.Compute(ctx, month, "")
+	if err != nil {
+		return err
+	}
+	err = g.Store.Create(ctx, report)
+	if errors.Is(err, ErrExists) {
+		// snapshotted by another instance
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("Month-end report snapshotted", "month", report.Month, "total", report.Total)
+	g.sendDigest(ctx, month, now)
+	return nil
+}
+
+// Rebuild recomputes the snapshots after an erasure and redacts those counting
+// transactions that are gone, along the taxonomy they were rolled up along.
+// Snapshots the erasure left alone keep the figures of month end.
+func (g *Generator) Rebuild(ctx context.Context, now time.Time) error {
+	list, err := g.Store.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, stored := range list {
+		month, err := time.Parse(monthLayout, stored.Month)
+		if err != nil {
+			return err
+		}
+		version := ""
+		if stored.TaxonomyVersion > 0 {
+			version = strconv.Itoa(stored.TaxonomyVersion)
+		}
+		report, err := g.Compute(ctx, month, version)
+		if err != nil {
+			return err
+		}
+		if report.Transactions == stored.Transactions && report.Total == stored.Total {
+			continue
+		}
+		if err := g.Store.Redact(ctx, report); err != nil {
+			return err
+		}
+		slog.Info("Month-end report redacted", "month", report.Month)
+	}
+	return nil
+}
+
+// Compute builds the report of the month from the current data, along the
+// latest taxonomy or taxonomyVersion.
+func (g *Generator) Compute(ctx context.Context, month time.Time, taxonomyVersion string) (*Report, error) {
+	taxonomy := &categories.Taxonomy{}
+	if g.Categories != nil {
+		var err error
+		if taxonomy, err = categories.Resolve(ctx, g.Categories, taxonomyVersion); err != nil {
+			return nil, err
+		}
+	}
+
+	monthly, err := g.monthlyBudgets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	txs, err := g.Repo.FindTransactions(ctx, statements.TransactionFilter{From: month, To: month.AddDate(0, 1, 0)})
+	if err != nil {
+		return nil, err
+	}
+	stmts, err := g.Repo.ListStatements(ctx, statements.StatementFilter{})
+	if err != nil {
+		return nil, err
+	}
+	sourceOf := make(map[string]string, len(stmts))
+	for i := range stmts {
+		sourceOf[stmts[i].ID] = stmts[i].SourceName
+	}
+
+	report := &Report{
+		Month:           month.Format(monthLayout),
+		Transactions:    len(txs),
+		TaxonomyVersion: taxonomy.Version,
+		GeneratedAt:     time.Now().UTC(),
+	}
+	sources, leaves, tops, types := breakdowns{}, breakdowns{}, breakdowns{}, breakdowns{}
+	spent := make([]float64, len(monthly))
+	for i := range txs {
+		tx := &txs[i]
+		category := tx.Category
+		if category == "" {
+			category = uncategorizedLabel
+		}
+		report.Total += tx.Amount
+		sources.add(sourceOf[tx.StatementID], tx.Amount)
+		leaves.add(category, tx.Amount)
+		tops.add(taxonomy.RollUp(category, 1), tx.Amount)
+		types.add(string(statements.ClassifySpend(tx)), tx.Amount)
+
+		path := taxonomy.Path(category)
+		for j, b := range monthly {
+			if b.Category == "" {
+				spent[j] += tx.Amount
+				continue
+			}
+			for _, ancestor := range path {
+				if strings.EqualFold(ancestor, b.Category) {
+					spent[j] += tx.Amount
+					break
+				}
+			}
+		}
+	}
+
+	report.Total = money.Round(report.Total)
+	report.Sources = sources.sorted()
+	report.Categories = leaves.sorted()
+	report.TopCategories = tops.sorted()
+	report.SpendTypes = types.sorted()
+	for j, b := range monthly {
+		report.Budgets = append(report.Budgets, BudgetOutcome{
+			Category:  b.Category,
+			Limit:     b.Limit,
+			Spent:     money.Round(spent[j]),
+			Remaining: money.Round(b.Limit - spent[j]),
+			Over:      money.Round(spent[j]) > b.Limit,
+		})
+	}
+	return report, nil
+}
+
+// monthlyBudgets lists the current monthly budget definitions, the weekly ones
+// do not line up with a month.
+func (g *Generator) monthlyBudgets(ctx context.Context) ([]budgets.Budget, error) {
+	if g.Budgets == nil {
+		return nil, nil
+	}
+	list, err := g.Budgets.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	monthly := list[:0]
+	for _, b := range list {
+		if b.Period == budgets.Monthly {
+			monthly = append(monthly, b)
+		}
+	}
+	return monthly, nil
+}
+
+type breakdowns map[string]*Breakdown
+
+func (b breakdowns) add(name string, amount float64) {
+	entry, ok := b[name]
+	if !ok {
+		entry = &Breakdown{Name: name}
+		b[name] = entry
+	}
+	entry.Amount += amount
+	entry.Count++
+}
+
+// sorted lists the entries by name with the amounts rounded to cents, so
+// reports of the same data compare equal.
+func (b breakdowns) sorted() []Breakdown {
+	if len(b) == 0 {
+		// as decoded from a stored snapshot
+		return nil
+	}
+	result := make([]Breakdown, 0, len(b))
+	for _, entry := range b {
+		entry.Amount = money.Round(entry.Amount)
+		result = append(result, *entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func monthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,89 @@
+package reports
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// ErrExists is returned when the report of the month was snapshotted already;
+// snapshots are never replaced.
+var ErrExists = apierror.New(apierror.KindConflict, "report_exists", "report already exists")
+
+// Store keeps the snapshots. It has no update or delete on purpose, only
+// Redact replaces a snapshot, once an erasure deleted data behind it.
+type Store interface {
+	// Get returns the snapshot of a month (YYYY-MM), nil when there is none.
+	Get(ctx context.Context, month string) (*Report, error)
+	// List returns every snapshot without the breakdowns, newest first.
+	List(ctx context.Context) ([]Report, error)
+	// Create saves a snapshot, ErrExists when the month has one.
+	Create(ctx context.Context, report *Report) error
+	// Redact replaces the snapshot of the month of report.
+	Redact(ctx context.Context, report *Report) error
+}
+
+// NewStore keeps the snapshots next to the statements in MongoDB, or in memory
+// for the memory driver.
+func NewStore(repo statements.StatementRepository) Store {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryStore()
+}
+
+type MemoryStore struct {
+	mu      sync.RWMutex
+	reports map[string]Report
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{reports: make(map[string]Report)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, month string) (*Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	report, ok := s.reports[month]
+	if !ok {
+		return nil, nil
+	}
+	return &report, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Report, 0, len(s.reports))
+	for _, r := range s.reports {
+		list = append(list, Report{Month: r.Month, Total: r.Total, Transactions: r.Transactions, TaxonomyVersion: r.TaxonomyVersion, GeneratedAt: r.GeneratedAt})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Month > list[j].Month
+	})
+	return list, nil
+}
+
+func (s *MemoryStore) Create(ctx context.Context, report *Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.reports[report.Month]; exists {
+		return ErrExists
+	}
+	s.reports[report.Month] = *report
+	return nil
+}
+
+func (s *MemoryStore) Redact(ctx context.Context, report *Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reports[report.Month] = *report
+	return nil
+}
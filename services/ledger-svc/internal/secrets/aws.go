@@ -0,0 +1,103 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// awsSecrets calls GetSecretValue of AWS Secrets Manager with the default
+// credentials chain, like the DynamoDB driver.
+type awsSecrets struct {
+	cfg      aws.Config
+	endpoint string
+	signer   *v4.Signer
+	client   *http.Client
+}
+
+func newAWSSecrets(ctx context.Context) (Provider, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config: %w", err)
+	}
+	p := &awsSecrets{cfg: cfg, signer: v4.NewSigner(), client: &http.Client{Timeout: 10 * time.Second}}
+	// e.g. LocalStack
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER"); endpoint != "" {
+		p.endpoint = endpoint
+	} else if cfg.BaseEndpoint != nil {
+		p.endpoint = *cfg.BaseEndpoint
+	}
+	return p, nil
+}
+
+func (p *awsSecrets) Get(ctx context.Context, id string) (string, error) {
+	region := p.cfg.Region
+	// arn:aws:secretsmanager:<region>:<account>:secret:<name>
+	if parts := strings.Split(id, ":"); len(parts) > 3 && parts[0] == "arn" {
+		region = parts[3]
+	}
+	if region == "" {
+		return "", fmt.Errorf("no AWS region, set AWS_REGION or refer to the secret by ARN")
+	}
+	endpoint := p.endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + region + ".amazonaws.com"
+	}
+
+	body, _ := json.Marshal(map[string]string{"SecretId": id})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	creds, err := p.cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("AWS credentials: %w", err)
+	}
+	hash := sha256.Sum256(body)
+	if err := p.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "secretsmanager", region, time.Now()); err != nil {
+		return "", err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &failure)
+		return "", fmt.Errorf("secrets manager answered %d %s: %s", resp.StatusCode, failure.Type, failure.Message)
+	}
+	var out struct {
+		SecretString *string
+		SecretBinary []byte
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return "", fmt.Errorf("decode secret: %w", err)
+	}
+	if out.SecretString != nil {
+		return *out.SecretString, nil
+	}
+	return string(out.SecretBinary), nil
+}
@@ -0,0 +1,180 @@
+package secrets
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	gcpSecretsEndpoint = "https://secretmanager.googleapis.com/v1/"
+	gcpMetadataToken   = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	gcpScope           = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// gcpSecrets accesses GCP Secret Manager versions with the service account
+// key of GOOGLE_APPLICATION_CREDENTIALS, or else the account of the instance
+// from the metadata server.
+type gcpSecrets struct {
+	account *serviceAccount
+	client  *http.Client
+}
+
+type serviceAccount struct {
+	Type        string `json:"type"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+func newGCPSecrets(ctx context.Context) (Provider, error) {
+	p := &gcpSecrets{client: &http.Client{Timeout: 10 * time.Second}}
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		return p, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("GOOGLE_APPLICATION_CREDENTIALS: %w", err)
+	}
+	var account serviceAccount
+	if err := json.Unmarshal(data, &account); err != nil || account.Type != "service_account" {
+		return nil, fmt.Errorf("GOOGLE_APPLICATION_CREDENTIALS: %s is not a service account key", path)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	p.account = &account
+	return p, nil
+}
+
+func (p *gcpSecrets) Get(ctx context.Context, name string) (string, error) {
+	if !strings.HasPrefix(name, "projects/") || !strings.Contains(name, "/secrets/") {
+		return "", fmt.Errorf("expected projects/<project>/secrets/<secret>[/versions/<version>]")
+	}
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	token, err := p.token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("GCP credentials: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpSecretsEndpoint+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	var out struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := p.do(req, &out); err != nil {
+		return "", fmt.Errorf("secret manager: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(out.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("decode secret: %w", err)
+	}
+	return string(data), nil
+}
+
+// token returns an access token for the Secret Manager API.
+func (p *gcpSecrets) token(ctx context.Context) (string, error) {
+	var req *http.Request
+	var err error
+	if p.account == nil {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataToken, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Metadata-Flavor", "Google")
+	} else {
+		assertion, err := p.account.assertion(time.Now())
+		if err != nil {
+			return "", err
+		}
+		form := url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, p.account.TokenURI, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := p.do(req, &out); err != nil {
+		return "", err
+	}
+	return out.AccessToken, nil
+}
+
+// assertion signs the JWT the service account exchanges for a token.
+func (a *serviceAccount) assertion(now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(a.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("service account key has no PEM private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("service account key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("service account key is not RSA")
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   a.ClientEmail,
+		"scope": gcpScope,
+		"aud":   a.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (p *gcpSecrets) do(req *http.Request, v any) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(data, &failure)
+		return fmt.Errorf("%s answered %d: %s", req.URL.Host, resp.StatusCode, failure.Error.Message)
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,169 @@
+// Package secrets keeps credentials out of the plain environment. At startup
+// Resolve replaces, in the environment the rest of the service reads:
+//
+//   - X_FILE=/run/secrets/x with the content of the file as X, e.g. a Docker
+//     or Kubernetes secret mounted as a file, for the X of Variables;
+//   - X=awssm://<name or ARN>[#field] with the AWS Secrets Manager secret;
+//   - X=gcpsm://projects/<project>/secrets/<secret>[/versions/<v>][#field]
+//     with the GCP Secret Manager secret, the latest version by default.
+//
+// A #field takes that field of a JSON secret, e.g. awssm://prod/finchie#mongo_uri.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// fileSuffix marks the variables naming the file of another one.
+const fileSuffix = "_FILE"
+
+// Variables are the credentials the service reads that may be set from a
+// file. Other _FILE variables, e.g. SSL_CERT_FILE or BUDGETS_FILE, already
+// name files and are left alone.
+var Variables = []string{
+	"AGGREGATOR_TOKEN_KEY",
+	"ANONYMIZE_SECRET",
+	"ATTACHMENT_URL_KEY",
+	"AUTH_GITHUB_CLIENT_SECRET",
+	"AUTH_GOOGLE_CLIENT_SECRET",
+	"AUTH_JWT_SECRET",
+	"BACKUP_ENCRYPTION_KEY",
+	"DROPZONE_SFTP_PASSWORD",
+	"DROPZONE_URL",
+	"EVENTS_NATS_URL",
+	"EVENTS_WEBHOOK_SECRET",
+	"FIELD_BLIND_INDEX_KEY",
+	"FIELD_ENCRYPTION_KEYS",
+	"HASS_MQTT_PASSWORD",
+	"MAILBOX_PASSWORD",
+	"MAILBOX_URL",
+	"MONGO_URI",
+	"PLAID_SECRET",
+	"POSTGRES_URL",
+	"REDIS_URL",
+	"REMINDER_WEBHOOK_SECRET",
+	"SMTP_PASSWORD",
+	"TELEGRAM_BOT_TOKEN",
+}
+
+// Provider fetches secrets from a secret manager.
+type Provider interface {
+	// Get returns the secret the reference names, without the scheme.
+	Get(ctx context.Context, ref string) (string, error)
+}
+
+// Resolver resolves the environment with the Providers of each scheme.
+type Resolver struct {
+	Providers map[string]Provider
+}
+
+// Resolve resolves the environment with the AWS and GCP secret managers,
+// configured only when a variable refers to them.
+func Resolve(ctx context.Context) error {
+	r := &Resolver{Providers: map[string]Provider{
+		"awssm": &lazy{newProvider: newAWSSecrets},
+		"gcpsm": &lazy{newProvider: newGCPSecrets},
+	}}
+	return r.Resolve(ctx)
+}
+
+// Resolve sets the variables with a _FILE variant or a secret reference,
+// naming each one it fails on.
+func (r *Resolver) Resolve(ctx context.Context) error {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			env[name] = value
+		}
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	var resolved []string
+	for _, name := range names {
+		value := env[name]
+		if target, ok := strings.CutSuffix(name, fileSuffix); ok && slices.Contains(Variables, target) {
+			if _, set := env[target]; set {
+				errs = append(errs, fmt.Errorf("%s and %s are both set, keep one", target, name))
+				continue
+			}
+			data, err := os.ReadFile(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				continue
+			}
+			os.Setenv(target, strings.TrimRight(string(data), "\r\n"))
+			resolved = append(resolved, target)
+			continue
+		}
+
+		scheme, ref, ok := strings.Cut(value, "://")
+		provider, known := r.Providers[scheme]
+		if !ok || !known {
+			continue
+		}
+		secret, err := r.get(ctx, provider, ref)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", name, value, err))
+			continue
+		}
+		os.Setenv(name, secret)
+		resolved = append(resolved, name)
+	}
+	if len(resolved) > 0 {
+		slog.Info("Resolved secrets", "variables", resolved)
+	}
+	return errors.Join(errs...)
+}
+
+// get fetches the secret, and the field of it the reference ends with.
+func (r *Resolver) get(ctx context.Context, provider Provider, ref string) (string, error) {
+	ref, field, _ := strings.Cut(ref, "#")
+	secret, err := provider.Get(ctx, ref)
+	if err != nil || field == "" {
+		return secret, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("field %s of a secret that is not a JSON object", field)
+	}
+	value, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("the secret has no field %s", field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(value)
+	return string(b), err
+}
+
+// lazy configures its provider on first use, so a deployment without
+// references needs no cloud credentials.
+type lazy struct {
+	newProvider func(ctx context.Context) (Provider, error)
+	provider    Provider
+	err         error
+}
+
+func (l *lazy) Get(ctx context.Context, ref string) (string, error) {
+	if l.provider == nil && l.err == nil {
+		l.provider, l.err = l.newProvider(ctx)
+	}
+	if l.err != nil {
+		return "", l.err
+	}
+	return l.provider.Get(ctx, ref)
+}
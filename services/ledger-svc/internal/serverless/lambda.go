@@ -0,0 +1,236 @@
+// Package serverless runs the HTTP handlers of the service behind function
+// platforms. AWS Lambda gets an adapter translating API Gateway and function
+// URL events; Google Cloud Functions (2nd gen) and Azure Functions custom
+// handlers forward plain HTTP, so the server only has to listen on the port
+// they give it.
+package serverless
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// IsLambda reports whether the process runs as an AWS Lambda function.
+func IsLambda() bool {
+	return os.Getenv("AWS_LAMBDA_RUNTIME_API") != ""
+}
+
+// StartLambda serves handler as a Lambda function and never returns. Events
+// come from an API Gateway REST API (payload 1.0), an HTTP API or a function
+// URL (payload 2.0). Responses are buffered, so they are subject to the 6 MB
+// Lambda payload limit, and background work only runs while an invocation
+// is in progress.
+func StartLambda(handler http.Handler) {
+	lambda.Start(LambdaHandler(handler))
+}
+
+// LambdaHandler translates API Gateway and function URL events into requests
+// for handler and its responses back into events.
+func LambdaHandler(handler http.Handler) func(ctx context.Context, event json.RawMessage) (any, error) {
+	return func(ctx context.Context, event json.RawMessage) (any, error) {
+		var probe struct {
+			Version string `json:"version"`
+		}
+		if err := json.Unmarshal(event, &probe); err != nil {
+			return nil, fmt.Errorf("decode event: %w", err)
+		}
+
+		if probe.Version == "2.0" {
+			var req events.APIGatewayV2HTTPRequest
+			if err := json.Unmarshal(event, &req); err != nil {
+				return nil, fmt.Errorf("decode HTTP API event: %w", err)
+			}
+			r, err := requestV2(ctx, &req)
+			if err != nil {
+				return nil, err
+			}
+			w := newResponseWriter()
+			handler.ServeHTTP(w, r)
+			return w.responseV2(), nil
+		}
+
+		var req events.APIGatewayProxyRequest
+		if err := json.Unmarshal(event, &req); err != nil {
+			return nil, fmt.Errorf("decode REST API event: %w", err)
+		}
+		r, err := requestV1(ctx, &req)
+		if err != nil {
+			return nil, err
+		}
+		w := newResponseWriter()
+		handler.ServeHTTP(w, r)
+		return w.responseV1(), nil
+	}
+}
+
+func requestV1(ctx context.Context, e *events.APIGatewayProxyRequest) (*http.Request, error) {
+	query := url.Values{}
+	for name, values := range e.MultiValueQueryStringParameters {
+		query[name] = values
+	}
+	for name, value := range e.QueryStringParameters {
+		if _, ok := query[name]; !ok {
+			query.Set(name, value)
+		}
+	}
+
+	header := http.Header{}
+	for name, values := range e.MultiValueHeaders {
+		for _, v := range values {
+			header.Add(name, v)
+		}
+	}
+	for name, value := range e.Headers {
+		if header.Get(name) == "" {
+			header.Set(name, value)
+		}
+	}
+	return newRequest(ctx, e.HTTPMethod, e.Path, query.Encode(), header, e.Body, e.IsBase64Encoded, e.RequestContext.Identity.SourceIP)
+}
+
+func requestV2(ctx context.Context, e *events.APIGatewayV2HTTPRequest) (*http.Request, error) {
+	path := e.RawPath
+	if stage := e.RequestContext.Stage; stage != "" && stage != "$default" {
+		// HTTP APIs keep the stage in the path, REST APIs do not
+		path = strings.TrimPrefix(path, "/"+stage)
+	}
+
+	header := http.Header{}
+	for name, value := range e.Headers {
+		// repeated headers arrive joined with commas, which is equivalent
+		header.Set(name, value)
+	}
+	if len(e.Cookies) > 0 {
+		header.Set("Cookie", strings.Join(e.Cookies, "; "))
+	}
+	return newRequest(ctx, e.RequestContext.HTTP.Method, path, e.RawQueryString, header, e.Body, e.IsBase64Encoded, e.RequestContext.HTTP.SourceIP)
+}
+
+func newRequest(ctx context.Context, method, path, rawQuery string, header http.Header, body string, isBase64 bool, sourceIP string) (*http.Request, error) {
+	var payload []byte
+	if isBase64 {
+		var err error
+		if payload, err = base64.StdEncoding.DecodeString(body); err != nil {
+			return nil, fmt.Errorf("decode request body: %w", err)
+		}
+	} else {
+		payload = []byte(body)
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	target := &url.URL{Path: path, RawQuery: rawQuery}
+	r, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	r.Header = header
+	r.Host = header.Get("Host")
+	r.RequestURI = target.RequestURI()
+	if sourceIP != "" {
+		r.RemoteAddr = sourceIP + ":0"
+	}
+	return r, nil
+}
+
+// responseWriter buffers the response of one invocation.
+type responseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseWriter() *responseWriter {
+	return &responseWriter{header: http.Header{}}
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
+
+// encodedBody returns the body as API Gateway expects it, base64 unless it
+// is text.
+func (w *responseWriter) encodedBody() (string, bool) {
+	if w.header.Get("Content-Type") == "" && w.body.Len() > 0 {
+		w.header.Set("Content-Type", http.DetectContentType(w.body.Bytes()))
+	}
+	if isText(w.header.Get("Content-Type")) {
+		return w.body.String(), false
+	}
+	return base64.StdEncoding.EncodeToString(w.body.Bytes()), true
+}
+
+func (w *responseWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *responseWriter) responseV1() events.APIGatewayProxyResponse {
+	body, isBase64 := w.encodedBody()
+	return events.APIGatewayProxyResponse{
+		StatusCode:        w.statusCode(),
+		MultiValueHeaders: w.header,
+		Body:              body,
+		IsBase64Encoded:   isBase64,
+	}
+}
+
+func (w *responseWriter) responseV2() events.APIGatewayV2HTTPResponse {
+	body, isBase64 := w.encodedBody()
+	cookies := w.header.Values("Set-Cookie")
+	headers := make(map[string]string, len(w.header))
+	for name, values := range w.header {
+		if name != "Set-Cookie" {
+			headers[name] = strings.Join(values, ",")
+		}
+	}
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode:      w.statusCode(),
+		Headers:         headers,
+		Body:            body,
+		IsBase64Encoded: isBase64,
+		Cookies:         cookies,
+	}
+}
+
+func isText(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json",
+		strings.HasSuffix(mediaType, "+json"),
+		mediaType == "application/xml",
+		mediaType == "application/javascript",
+		mediaType == "application/x-www-form-urlencoded":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package statements
+
+import (
+	"context"
+	"strings"
+)
+
+// Attribution says whom a transaction is for and who paid it, see
+// Transaction.Owner and Transaction.PaidBy.
+type Attribution struct {
+	Owner  string `json:"owner"`
+	PaidBy string `json:"paid_by"`
+}
+
+// SetAttribution replaces the owner and payer of a transaction of the
+// statement; empty values clear them.
+func (s *StatementService) SetAttribution(ctx context.Context, statementID, transactionID string, attribution Attribution) (*Transaction, error) {
+	txs, err := s.Repo.GetTransactions(ctx, statementID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range txs {
+		if txs[i].ID != transactionID {
+			continue
+		}
+		tx := txs[i]
+		tx.Owner, tx.PaidBy = strings.TrimSpace(attribution.Owner), strings.TrimSpace(attribution.PaidBy)
+		return &tx, s.Repo.UpsertTransaction(ctx, &tx)
+	}
+	return nil, ErrTransactionNotFound
+}
+
+// keepAttribution carries the owner and payer set through the API over to the
+// re-posted transactions that do not bring their own.
+func keepAttribution(current, desired []Transaction) {
+	stored := make(map[string]Attribution, len(current))
+	for _, tx := range current {
+		if tx.Owner != "" || tx.PaidBy != "" {
+			stored[tx.ID] = Attribution{Owner: tx.Owner, PaidBy: tx.PaidBy}
+		}
+	}
+	for i := range desired {
+		tx := &desired[i]
+		a, ok := stored[tx.ID]
+		if !ok {
+			continue
+		}
+		if tx.Owner == "" {
+			tx.Owner = a.Owner
+		}
+		if tx.PaidBy == "" {
+			tx.PaidBy = a.PaidBy
+		}
+	}
+}
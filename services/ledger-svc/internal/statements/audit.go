@@ -0,0 +1,359 @@
+package statements
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AuditInsert = "insert"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+
+	auditEntityStatement   = "statement"
+	auditEntityTransaction = "transaction"
+
+	// ErasedActor replaces the actor of the entries of an erased user.
+	ErasedActor = "erased-user"
+)
+
+// AuditEntry records one mutation with the entity as the API showed it before
+// and after. Before is empty for inserts, After for deletes.
+type AuditEntry struct {
+	ID         string         `bson:"_id" json:"id"`
+	EntityType string         `bson:"entity_type" json:"entity_type"`
+	EntityID   string         `bson:"entity_id" json:"entity_id"`
+	Action     string         `bson:"action" json:"action"`
+	Before     map[string]any `bson:"before,omitempty" json:"before,omitempty"`
+	After      map[string]any `bson:"after,omitempty" json:"after,omitempty"`
+	Actor      string         `bson:"actor" json:"actor"`
+	RequestID  string         `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	At         time.Time      `bson:"at" json:"at"`
+}
+
+// AuditStore keeps the audit log. It also resolves transactions by ID, which
+// the audit decorator needs for the before snapshot of deletes.
+type AuditStore interface {
+	RecordAudit(ctx context.Context, entries []AuditEntry) error
+	// AuditHistory returns the entries of an entity, newest first.
+	AuditHistory(ctx context.Context, entityID string, limit int) ([]AuditEntry, error)
+	TransactionsByID(ctx context.Context, ids []string) ([]Transaction, error)
+	// EraseAudit deletes the entries of the entities and attributes those
+	// made by the actor to ErasedActor, returning how many entries were
+	// deleted and anonymized.
+	EraseAudit(ctx context.Context, entityIDs []string, actor string) (deleted, anonymized int, err error)
+}
+
+// AsAuditStore unwraps repository decorators down to the one keeping the audit log.
+func AsAuditStore(repo StatementRepository) (AuditStore, bool) {
+	for _, layer := range Layers(repo) {
+		if a, ok := layer.(*AuditRepo); ok {
+			return a.store, true
+		}
+	}
+	return nil, false
+}
+
+// AuditInfo tells the audit log who made a change.
+type AuditInfo struct {
+	Actor     string
+	RequestID string
+}
+
+type auditInfoKey struct{}
+
+func WithAuditInfo(ctx context.Context, info AuditInfo) context.Context {
+	return context.WithValue(ctx, auditInfoKey{}, info)
+}
+
+// auditInfoFrom attributes changes without request context, e.g. from the
+// reminder escalator or replayed writes, to "system".
+func auditInfoFrom(ctx context.Context) AuditInfo {
+	info, _ := ctx.Value(auditInfoKey{}).(AuditInfo)
+	if info.Actor == "" {
+		info.Actor = "system"
+	}
+	return info
+}
+
+// AuditRepo records every write of the wrapped repository in an AuditStore.
+// The entries are written after the change succeeded and a failed audit write
+// is logged rather than failing the change, which is already committed.
+type AuditRepo struct {
+	StatementRepository
+	store AuditStore
+}
+
+func NewAuditRepo(repo StatementRepository, store AuditStore) *AuditRepo {
+	return &AuditRepo{StatementRepository: repo, store: store}
+}
+
+// AuditFromEnv wraps repo, unless AUDIT_LOG is false, keeping the log in the
+// layer of repo that can, the storage driver. It goes above the encryption,
+// so the snapshots read like the API rather than hold ciphertext.
+func AuditFromEnv(repo StatementRepository) StatementRepository {
+	if os.Getenv("AUDIT_LOG") == "false" {
+		return repo
+	}
+	for _, layer := range Layers(repo) {
+		if store, ok := layer.(AuditStore); ok {
+			return NewAuditRepo(repo, store)
+		}
+	}
+	return repo
+}
+
+// applied reports whether a write went through or was queued to be replayed;
+// the audit log records both with the actor of the call.
+func applied(err error) bool {
+	return err == nil || errors.Is(err, ErrQueued)
+}
+
+func (r *AuditRepo) Unwrap() StatementRepository {
+	return r.StatementRepository
+}
+
+func (r *AuditRepo) Describe() map[string]string {
+	if d, ok := r.StatementRepository.(Describer); ok {
+		return d.Describe()
+	}
+	return nil
+}
+
+func (r *AuditRepo) UpsertStatement(ctx context.Context, statement *Statement) error {
+	before, err := r.statementSnapshot(ctx, statement.ID)
+	if err != nil {
+		return err
+	}
+	err = r.StatementRepository.UpsertStatement(ctx, statement)
+	if !applied(err) {
+		return err
+	}
+
+	batch := newAuditBatch(ctx)
+	batch.add(auditEntityStatement, statement.ID, before, snapshotOf(statementWithoutTransactions(statement)))
+	r.record(ctx, batch)
+	return err
+}
+
+func (r *AuditRepo) DeleteStatement(ctx context.Context, id string) error {
+	before, err := r.statementSnapshot(ctx, id)
+	if err != nil {
+		return err
+	}
+	txs, err := r.StatementRepository.GetTransactions(ctx, id)
+	if err != nil {
+		return err
+	}
+	err = r.StatementRepository.DeleteStatement(ctx, id)
+	if !applied(err) {
+		return err
+	}
+
+	batch := newAuditBatch(ctx)
+	for i := range txs {
+		batch.add(auditEntityTransaction, txs[i].ID, snapshotOf(txs[i]), nil)
+	}
+	batch.add(auditEntityStatement, id, before, nil)
+	r.record(ctx, batch)
+	return err
+}
+
+func (r *AuditRepo) UpsertTransaction(ctx context.Context, tx *Transaction) error {
+	return r.upsertTransactions(ctx, []Transaction{*tx}, func() error {
+		return r.StatementRepository.UpsertTransaction(ctx, tx)
+	})
+}
+
+func (r *AuditRepo) BulkUpsertTransactions(ctx context.Context, transactions []Transaction) error {
+	return r.upsertTransactions(ctx, transactions, func() error {
+		return r.StatementRepository.BulkUpsertTransactions(ctx, transactions)
+	})
+}
+
+func (r *AuditRepo) upsertTransactions(ctx context.Context, transactions []Transaction, write func() error) error {
+	before, err := r.transactionSnapshots(ctx, transactionIDs(transactions))
+	if err != nil {
+		return err
+	}
+	err = write()
+	if !applied(err) {
+		return err
+	}
+
+	batch := newAuditBatch(ctx)
+	for i := range transactions {
+		batch.add(auditEntityTransaction, transactions[i].ID, before[transactions[i].ID], snapshotOf(transactions[i]))
+	}
+	r.record(ctx, batch)
+	return err
+}
+
+func (r *AuditRepo) DeleteTransaction(ctx context.Context, id string) error {
+	before, err := r.transactionSnapshots(ctx, []string{id})
+	if err != nil {
+		return err
+	}
+	err = r.StatementRepository.DeleteTransaction(ctx, id)
+	if !applied(err) {
+		return err
+	}
+	batch := newAuditBatch(ctx)
+	batch.add(auditEntityTransaction, id, before[id], nil)
+	r.record(ctx, batch)
+	return err
+}
+
+func (r *AuditRepo) BulkDeleteTransactions(ctx context.Context, ids []string) error {
+	before, err := r.transactionSnapshots(ctx, ids)
+	if err != nil {
+		return err
+	}
+	err = r.StatementRepository.BulkDeleteTransactions(ctx, ids)
+	if !applied(err) {
+		return err
+	}
+	batch := newAuditBatch(ctx)
+	for _, id := range ids {
+		batch.add(auditEntityTransaction, id, before[id], nil)
+	}
+	r.record(ctx, batch)
+	return err
+}
+
+func (r *AuditRepo) SaveStatementWithDelta(ctx context.Context, statement *Statement, delta TransactionDelta) error {
+	before, err := r.statementSnapshot(ctx, statement.ID)
+	if err != nil {
+		return err
+	}
+	txBefore, err := r.transactionSnapshots(ctx, append(transactionIDs(delta.Upserts), delta.Deletes...))
+	if err != nil {
+		return err
+	}
+	err = r.StatementRepository.SaveStatementWithDelta(ctx, statement, delta)
+	if !applied(err) {
+		return err
+	}
+
+	batch := newAuditBatch(ctx)
+	for i := range delta.Upserts {
+		batch.add(auditEntityTransaction, delta.Upserts[i].ID, txBefore[delta.Upserts[i].ID], snapshotOf(delta.Upserts[i]))
+	}
+	for _, id := range delta.Deletes {
+		batch.add(auditEntityTransaction, id, txBefore[id], nil)
+	}
+	batch.add(auditEntityStatement, statement.ID, before, snapshotOf(statementWithoutTransactions(statement)))
+	r.record(ctx, batch)
+	return err
+}
+
+func (r *AuditRepo) statementSnapshot(ctx context.Context, id string) (map[string]any, error) {
+	stmt, err := r.StatementRepository.GetStatement(ctx, id)
+	if err != nil || stmt == nil {
+		return nil, err
+	}
+	return snapshotOf(statementWithoutTransactions(stmt)), nil
+}
+
+func (r *AuditRepo) transactionSnapshots(ctx context.Context, ids []string) (map[string]map[string]any, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	// read through the layers below, decrypted
+	txs, err := transactionsByID(ctx, r.StatementRepository, ids)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make(map[string]map[string]any, len(txs))
+	for i := range txs {
+		snapshots[txs[i].ID] = snapshotOf(txs[i])
+	}
+	return snapshots, nil
+}
+
+// auditBatch collects the entries of one repository call, which share the
+// actor, request ID and timestamp.
+type auditBatch struct {
+	info    AuditInfo
+	at      time.Time
+	entries []AuditEntry
+}
+
+func newAuditBatch(ctx context.Context) *auditBatch {
+	return &auditBatch{info: auditInfoFrom(ctx), at: time.Now().UTC()}
+}
+
+// add records the change, unless the write left the entity as it was, e.g. a
+// statement posted again unchanged.
+func (b *auditBatch) add(entityType, entityID string, before, after map[string]any) {
+	var action string
+	switch {
+	case before == nil && after == nil:
+		return
+	case before == nil:
+		action = AuditInsert
+	case after == nil:
+		action = AuditDelete
+	case reflect.DeepEqual(before, after):
+		return
+	default:
+		action = AuditUpdate
+	}
+
+	b.entries = append(b.entries, AuditEntry{
+		ID:         uuid.NewString(),
+		EntityType: entityType,
+		EntityID:   entityID,
+		Action:     action,
+		Before:     before,
+		After:      after,
+		Actor:      b.info.Actor,
+		RequestID:  b.info.RequestID,
+		At:         b.at,
+	})
+}
+
+func (r *AuditRepo) record(ctx context.Context, batch *auditBatch) {
+	if len(batch.entries) == 0 {
+		return
+	}
+	// the change is committed, do not let a cancelled request drop its entries
+	if err := r.store.RecordAudit(context.WithoutCancel(ctx), batch.entries); err != nil {
+		slog.Error("Failed to record audit entries", "count", len(batch.entries), "error", err)
+	}
+}
+
+func statementWithoutTransactions(stmt *Statement) Statement {
+	snapshot := *stmt
+	snapshot.Transactions = nil
+	return snapshot
+}
+
+// snapshotOf captures v in its JSON form, so the log reads like the API and
+// compares equal after a round trip through the store.
+func snapshotOf(v any) map[string]any {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var snapshot map[string]any
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil
+	}
+	return snapshot
+}
+
+func transactionIDs(transactions []Transaction) []string {
+	ids := make([]string, len(transactions))
+	for i := range transactions {
+		ids[i] = transactions[i].ID
+	}
+	return ids
+}
@@ -0,0 +1,133 @@
+package statements
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// txCounts are the statement sizes the ingestion benchmarks run with, a
+// typical month to a busy business card.
+var txCounts = []int{10, 100, 1000}
+
+func benchStatement(i, txCount int) *Statement {
+	due := time.Date(2025, 2, 24, 0, 0, 0, 0, time.UTC)
+	txs := make([]Transaction, txCount)
+	total := 0.0
+	for j := range txs {
+		amount := float64(100 + j%900)
+		txs[j] = Transaction{
+			ID:          fmt.Sprintf("BENCH_%08d_%04d", i, j),
+			Description: "MERCHANT " + strconv.Itoa(j%50),
+			Currency:    "TWD",
+			Amount:      amount,
+			Date:        due.AddDate(0, 0, -30+j%28),
+		}
+		total += amount
+	}
+	return &Statement{
+		SourceName:     "BENCH",
+		SourceID:       ptr(fmt.Sprintf("%08d", i)),
+		Currency:       "TWD",
+		TotalAmount:    total,
+		PaymentDueDate: &due,
+		Transactions:   &txs,
+	}
+}
+
+func BenchmarkSaveStatementWithTransactions(b *testing.B) {
+	for _, n := range txCounts {
+		b.Run(fmt.Sprintf("txs=%d", n), func(b *testing.B) {
+			ctx := b.Context()
+			service := NewService(NewInMemoryRepo())
+			stmts := make([]*Statement, b.N)
+			for i := range stmts {
+				stmts[i] = benchStatement(i, n)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := range b.N {
+				if err := service.SaveStatementWithTransactions(ctx, stmts[i]); err != nil {
+					b.Fatalf("SaveStatementWithTransactions() error = %v", err)
+				}
+			}
+			b.ReportMetric(float64(b.N*n)/b.Elapsed().Seconds(), "txs/s")
+		})
+	}
+}
+
+// BenchmarkSaveHandler measures an ingestion through the API handler: the
+// body read, its validation against the ingest schema and the save.
+func BenchmarkSaveHandler(b *testing.B) {
+	for _, n := range txCounts {
+		b.Run(fmt.Sprintf("txs=%d", n), func(b *testing.B) {
+			repo := NewInMemoryRepo()
+			manager := &StatementManager{Service: NewService(repo), Repo: repo}
+			bodies := make([][]byte, b.N)
+			for i := range bodies {
+				body, err := json.Marshal(ingestPayload(benchStatement(i, n)))
+				if err != nil {
+					b.Fatal(err)
+				}
+				bodies[i] = body
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := range b.N {
+				r := httptest.NewRequest(http.MethodPost, "/api/statements?$expand=transactions", bytes.NewReader(bodies[i]))
+				r.Header.Set("Content-Type", "application/json")
+				r.Header.Set("X-Ingest-Schema-Version", "v1")
+				w := httptest.NewRecorder()
+				manager.SaveHandler(w, r)
+				if w.Code >= 300 {
+					b.Fatalf("SaveHandler() status = %d: %s", w.Code, w.Body)
+				}
+			}
+			b.ReportMetric(float64(b.N*n)/b.Elapsed().Seconds(), "txs/s")
+		})
+	}
+}
+
+// ingestPayload is the statement as a fetcher posts it, without the ID the
+// service derives.
+func ingestPayload(stmt *Statement) map[string]any {
+	txs := make([]map[string]any, len(*stmt.Transactions))
+	for i, tx := range *stmt.Transactions {
+		txs[i] = map[string]any{"id": tx.ID, "description": tx.Description, "currency": tx.Currency, "amount": tx.Amount, "date": tx.Date}
+	}
+	return map[string]any{
+		"source_name":      stmt.SourceName,
+		"source_id":        stmt.SourceID,
+		"currency":         stmt.Currency,
+		"total_amount":     stmt.TotalAmount,
+		"payment_due_date": stmt.PaymentDueDate,
+		"transactions":     txs,
+	}
+}
+
+// BenchmarkCachedGetTransactions measures a cache hit, the decoding of the
+// cached transactions, to weigh against a round trip to the database.
+func BenchmarkCachedGetTransactions(b *testing.B) {
+	ctx := b.Context()
+	repo := NewCachedRepo(NewInMemoryRepo(), NewLRUStore(1000), time.Minute)
+	stmt := benchStatement(0, 100)
+	if err := NewService(repo).SaveStatementWithTransactions(ctx, stmt); err != nil {
+		b.Fatalf("SaveStatementWithTransactions() error = %v", err)
+	}
+
+	b.ReportAllocs()
+	for range b.N {
+		txs, err := repo.GetTransactions(ctx, stmt.ID)
+		if err != nil || len(txs) != 100 {
+			b.Fatalf("GetTransactions() = %d transactions, %v", len(txs), err)
+		}
+	}
+	if hits := repo.hits.Load(); hits < int64(b.N)-1 {
+		b.Fatalf("cache hits = %d, want %d", hits, b.N-1)
+	}
+}
@@ -0,0 +1,360 @@
+package statements
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/health"
+)
+
+// ErrCircuitOpen is returned without calling the database while the circuit
+// is open. It is an unavailable error, see IsUnavailableError, so the reads
+// are served from the caches and the writes queued as when the database is
+// unreachable.
+var ErrCircuitOpen = errors.New("database circuit open")
+
+// The states of the circuit, the values of finchie_repository_circuit_state.
+const (
+	CircuitClosed   = "closed"
+	CircuitHalfOpen = "half_open"
+	CircuitOpen     = "open"
+)
+
+var (
+	circuitState = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "finchie_repository_circuit_state",
+		Help: "State of the circuit breaker of the statement repository: 0 closed, 1 half-open, 2 open.",
+	})
+	circuitTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "finchie_repository_circuit_transitions_total",
+		Help: "Changes of state of the circuit breaker of the statement repository, by the state entered.",
+	}, []string{"state"})
+	circuitRejections = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "finchie_repository_circuit_rejections_total",
+		Help: "Statement repository calls failed fast by the open circuit.",
+	})
+)
+
+// BreakerPolicy trips the circuit after Threshold calls in a row found the
+// database unavailable, and tries it again after Cooldown.
+type BreakerPolicy struct {
+	Threshold     int
+	Cooldown      time.Duration
+	IsUnavailable func(error) bool
+}
+
+// BreakerRepo fails the calls fast while the database is down, instead of
+// each waiting for its timeout. Once Cooldown passed a single call probes the
+// database, half-open: its success closes the circuit, its failure opens it
+// again.
+type BreakerRepo struct {
+	StatementRepository
+	policy BreakerPolicy
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	// probeAt is when the probe in flight started, zero without one
+	probeAt time.Time
+}
+
+func NewBreakerRepo(repo StatementRepository, policy BreakerPolicy) *BreakerRepo {
+	circuitState.Set(0)
+	return &BreakerRepo{StatementRepository: repo, policy: policy, now: time.Now, state: CircuitClosed}
+}
+
+// breakerFromEnv wraps repo in a BreakerRepo unless CIRCUIT_BREAKER_THRESHOLD
+// is 0.
+func breakerFromEnv(repo StatementRepository, isUnavailable func(error) bool) StatementRepository {
+	threshold, err := strconv.Atoi(os.Getenv("CIRCUIT_BREAKER_THRESHOLD"))
+	if err != nil || threshold < 0 {
+		threshold = 5
+	}
+	if threshold == 0 {
+		return repo
+	}
+	return NewBreakerRepo(repo, BreakerPolicy{
+		Threshold:     threshold,
+		Cooldown:      envDuration("CIRCUIT_BREAKER_COOLDOWN_MS", 30*time.Second),
+		IsUnavailable: isUnavailable,
+	})
+}
+
+func (r *BreakerRepo) Unwrap() StatementRepository {
+	return r.StatementRepository
+}
+
+func (r *BreakerRepo) Describe() map[string]string {
+	if d, ok := r.StatementRepository.(Describer); ok {
+		return d.Describe()
+	}
+	return nil
+}
+
+// State returns the state of the circuit and, while it is open, how long
+// until a call probes the database again. Past the cooldown the circuit is
+// half-open, waiting for the next call to probe.
+func (r *BreakerRepo) State() (string, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current()
+}
+
+// current is State, under mu.
+func (r *BreakerRepo) current() (string, time.Duration) {
+	if r.state != CircuitOpen {
+		return r.state, 0
+	}
+	if wait := r.openedAt.Add(r.policy.Cooldown).Sub(r.now()); wait > 0 {
+		return CircuitOpen, wait
+	}
+	return CircuitHalfOpen, 0
+}
+
+// Check reports the circuit down while it is open, so /readyz takes the
+// instance out of rotation until the cooldown ends, and degraded while it is
+// half-open.
+func (r *BreakerRepo) Check() (string, map[string]string) {
+	r.mu.Lock()
+	state, retryAfter := r.current()
+	details := map[string]string{"state": state, "consecutive_failures": strconv.Itoa(r.failures)}
+	r.mu.Unlock()
+	switch state {
+	case CircuitOpen:
+		details["retry_after_seconds"] = strconv.Itoa(retryAfterSeconds(retryAfter))
+		return health.StatusDown, details
+	case CircuitHalfOpen:
+		return health.StatusDegraded, details
+	}
+	return health.StatusOK, details
+}
+
+// allow reports whether a call goes through to the database, and whether it
+// is the probe of a half-open circuit. A probe that did not report back
+// within the cooldown, e.g. it panicked, is replaced.
+func (r *BreakerRepo) allow() (bool, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, _ := r.current()
+	switch state {
+	case CircuitOpen:
+		return false, false
+	case CircuitHalfOpen:
+		r.setState(CircuitHalfOpen)
+		now := r.now()
+		if !r.probeAt.IsZero() && now.Before(r.probeAt.Add(r.policy.Cooldown)) {
+			return false, false
+		}
+		r.probeAt = now
+		return true, true
+	}
+	return true, false
+}
+
+// record counts the outcome of a call. A call the database answered, even
+// with an error, closes the circuit; one cut short by its caller tells
+// nothing.
+func (r *BreakerRepo) record(op string, probe bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if probe {
+		r.probeAt = time.Time{}
+	}
+	switch {
+	case err != nil && r.policy.IsUnavailable(err) && !errors.Is(err, context.Canceled):
+		r.failures++
+		if probe || r.state == CircuitClosed && r.failures >= r.policy.Threshold {
+			if r.state == CircuitClosed {
+				slog.Error("Database unavailable, opening the circuit", "op", op, "failures", r.failures, "cooldown", r.policy.Cooldown, "error", err)
+			}
+			r.openedAt = r.now()
+			r.setState(CircuitOpen)
+		}
+	case errors.Is(err, context.Canceled):
+		// cut short by its caller
+	default:
+		if r.state != CircuitClosed {
+			slog.Info("Database available, closing the circuit", "op", op)
+			r.setState(CircuitClosed)
+		}
+		r.failures = 0
+	}
+}
+
+// setState changes the state, under mu.
+func (r *BreakerRepo) setState(state string) {
+	if r.state == state {
+		return
+	}
+	r.state = state
+	circuitTransitions.WithLabelValues(state).Inc()
+	switch state {
+	case CircuitClosed:
+		circuitState.Set(0)
+	case CircuitHalfOpen:
+		circuitState.Set(1)
+	case CircuitOpen:
+		circuitState.Set(2)
+	}
+}
+
+func breakerCall[T any](ctx context.Context, r *BreakerRepo, op string, fn func() (T, error)) (T, error) {
+	var zero T
+	ok, probe := r.allow()
+	if !ok {
+		circuitRejections.Inc()
+		tripCircuit(ctx)
+		return zero, ErrCircuitOpen
+	}
+	result, err := fn()
+	r.record(op, probe, err)
+	return result, err
+}
+
+func (r *BreakerRepo) do(ctx context.Context, op string, fn func() error) error {
+	_, err := breakerCall(ctx, r, op, func() (struct{}, error) { return struct{}{}, fn() })
+	return err
+}
+
+func (r *BreakerRepo) GetStatement(ctx context.Context, id string) (*Statement, error) {
+	return breakerCall(ctx, r, "get_statement", func() (*Statement, error) {
+		return r.StatementRepository.GetStatement(ctx, id)
+	})
+}
+
+func (r *BreakerRepo) ListStatements(ctx context.Context, filter StatementFilter) ([]Statement, error) {
+	return breakerCall(ctx, r, "list_statements", func() ([]Statement, error) {
+		return r.StatementRepository.ListStatements(ctx, filter)
+	})
+}
+
+func (r *BreakerRepo) UpsertStatement(ctx context.Context, statement *Statement) error {
+	return r.do(ctx, "upsert_statement", func() error {
+		return r.StatementRepository.UpsertStatement(ctx, statement)
+	})
+}
+
+func (r *BreakerRepo) DeleteStatement(ctx context.Context, id string) error {
+	return r.do(ctx, "delete_statement", func() error {
+		return r.StatementRepository.DeleteStatement(ctx, id)
+	})
+}
+
+func (r *BreakerRepo) GetTransactions(ctx context.Context, statementID string) ([]Transaction, error) {
+	return breakerCall(ctx, r, "get_transactions", func() ([]Transaction, error) {
+		return r.StatementRepository.GetTransactions(ctx, statementID)
+	})
+}
+
+func (r *BreakerRepo) ListTransactions(ctx context.Context, filter TransactionFilter, page Page) ([]Transaction, error) {
+	return breakerCall(ctx, r, "list_transactions", func() ([]Transaction, error) {
+		return r.StatementRepository.ListTransactions(ctx, filter, page)
+	})
+}
+
+func (r *BreakerRepo) FindTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error) {
+	return breakerCall(ctx, r, "find_transactions", func() ([]Transaction, error) {
+		return r.StatementRepository.FindTransactions(ctx, filter)
+	})
+}
+
+func (r *BreakerRepo) UpsertTransaction(ctx context.Context, tx *Transaction) error {
+	return r.do(ctx, "upsert_transaction", func() error {
+		return r.StatementRepository.UpsertTransaction(ctx, tx)
+	})
+}
+
+func (r *BreakerRepo) DeleteTransaction(ctx context.Context, id string) error {
+	return r.do(ctx, "delete_transaction", func() error {
+		return r.StatementRepository.DeleteTransaction(ctx, id)
+	})
+}
+
+func (r *BreakerRepo) BulkUpsertTransactions(ctx context.Context, transactions []Transaction) error {
+	return r.do(ctx, "bulk_upsert_transactions", func() error {
+		return r.StatementRepository.BulkUpsertTransactions(ctx, transactions)
+	})
+}
+
+func (r *BreakerRepo) BulkDeleteTransactions(ctx context.Context, ids []string) error {
+	return r.do(ctx, "bulk_delete_transactions", func() error {
+		return r.StatementRepository.BulkDeleteTransactions(ctx, ids)
+	})
+}
+
+func (r *BreakerRepo) SaveStatementWithDelta(ctx context.Context, statement *Statement, delta TransactionDelta) error {
+	return r.do(ctx, "save_statement_with_delta", func() error {
+		return r.StatementRepository.SaveStatementWithDelta(ctx, statement, delta)
+	})
+}
+
+type circuitTripKey struct{}
+
+// tripCircuit has Middleware answer the request of ctx with 503, for the
+// failures of an unavailable database.
+func tripCircuit(ctx context.Context) {
+	if trip, _ := ctx.Value(circuitTripKey{}).(*atomic.Bool); trip != nil {
+		trip.Store(true)
+	}
+}
+
+// Middleware answers 503 with a Retry-After header, instead of the 500 of the
+// handler, the requests that failed on the open circuit. The requests the
+// caches or the write queue answered are untouched.
+func (r *BreakerRepo) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		trip := &atomic.Bool{}
+		rec := &circuitRecorder{ResponseWriter: w, breaker: r, trip: trip}
+		next.ServeHTTP(rec, req.WithContext(context.WithValue(req.Context(), circuitTripKey{}, trip)))
+	})
+}
+
+type circuitRecorder struct {
+	http.ResponseWriter
+	breaker  *BreakerRepo
+	trip     *atomic.Bool
+	replaced bool
+}
+
+func (r *circuitRecorder) WriteHeader(status int) {
+	if status != http.StatusInternalServerError || !r.trip.Load() {
+		r.ResponseWriter.WriteHeader(status)
+		return
+	}
+	r.replaced = true
+	_, retryAfter := r.breaker.State()
+	r.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+	apierror.Reply(r.ResponseWriter, "The database is unavailable, retry later", http.StatusServiceUnavailable)
+}
+
+func (r *circuitRecorder) Write(b []byte) (int, error) {
+	if r.replaced {
+		// the body of the 500
+		return len(b), nil
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the writer, e.g. to flush.
+func (r *circuitRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// retryAfterSeconds is the Retry-After of the wait, at least a second.
+func retryAfterSeconds(wait time.Duration) int {
+	return max(int(math.Ceil(wait.Seconds())), 1)
+}
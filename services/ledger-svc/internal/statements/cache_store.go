@@ -0,0 +1,218 @@
+package statements
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CacheStore holds encoded repository reads for CachedRepo. Every Delete and
+// DeletePrefix moves the store to a new generation; Set only stores a value
+// read at the generation it is given, so a read racing a write never caches
+// what the write replaced.
+type CacheStore interface {
+	// Get returns the value of key, nil on a miss, and the generation of the
+	// store to hand to Set.
+	Get(ctx context.Context, key string) ([]byte, int64, error)
+	// Set stores the value unless the store moved past generation.
+	Set(ctx context.Context, key string, generation int64, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	// DeletePrefix drops every key starting with prefix.
+	DeletePrefix(ctx context.Context, prefix string) error
+	Name() string
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// LRUStore is an in-process CacheStore bounded to size entries.
+type LRUStore struct {
+	mu         sync.Mutex
+	size       int
+	generation int64
+	order      *list.List
+	items      map[string]*list.Element
+}
+
+func NewLRUStore(size int) *LRUStore {
+	return &LRUStore{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (s *LRUStore) Name() string {
+	return "lru"
+}
+
+func (s *LRUStore) Get(_ context.Context, key string) ([]byte, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return nil, s.generation, nil
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		s.order.Remove(el)
+		delete(s.items, key)
+		return nil, s.generation, nil
+	}
+	s.order.MoveToFront(el)
+	return entry.value, s.generation, nil
+}
+
+func (s *LRUStore) Set(_ context.Context, key string, generation int64, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if generation != s.generation {
+		return nil
+	}
+	entry := &lruEntry{key: key, value: value, expires: time.Now().Add(ttl)}
+	if el, ok := s.items[key]; ok {
+		el.Value = entry
+		s.order.MoveToFront(el)
+		return nil
+	}
+	s.items[key] = s.order.PushFront(entry)
+	for s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+func (s *LRUStore) Delete(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generation++
+	for _, key := range keys {
+		if el, ok := s.items[key]; ok {
+			s.order.Remove(el)
+			delete(s.items, key)
+		}
+	}
+	return nil
+}
+
+func (s *LRUStore) DeletePrefix(_ context.Context, prefix string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generation++
+	for key, el := range s.items {
+		if strings.HasPrefix(key, prefix) {
+			s.order.Remove(el)
+			delete(s.items, key)
+		}
+	}
+	return nil
+}
+
+// redisGenerationKey counts the invalidations of the keys of a RedisStore.
+const redisGenerationKey = "cache:generation"
+
+// RedisStore is a CacheStore shared by every instance of the service. The
+// generation is a counter in Redis, bumped in the same transaction as the
+// deletes, and Set watches it.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) Name() string {
+	return "redis"
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, int64, error) {
+	values, err := s.client.MGet(ctx, s.prefix+key, s.prefix+redisGenerationKey).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	var generation int64
+	if v, ok := values[1].(string); ok {
+		if generation, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, 0, err
+		}
+	}
+	if v, ok := values[0].(string); ok {
+		return []byte(v), generation, nil
+	}
+	return nil, generation, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, generation int64, value []byte, ttl time.Duration) error {
+	generationKey := s.prefix + redisGenerationKey
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, generationKey).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if current != generation {
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, s.prefix+key, value, ttl)
+			return nil
+		})
+		return err
+	}, generationKey)
+	if errors.Is(err, redis.TxFailedErr) {
+		// invalidated while storing, the value may be stale
+		return nil
+	}
+	return err
+}
+
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = s.prefix + key
+	}
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, s.prefix+redisGenerationKey)
+		pipe.Del(ctx, prefixed...)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) DeletePrefix(ctx context.Context, prefix string) error {
+	// bump first, a value stored while scanning is then refused
+	if err := s.client.Incr(ctx, s.prefix+redisGenerationKey).Err(); err != nil {
+		return err
+	}
+	iter := s.client.Scan(ctx, 0, s.prefix+prefix+"*", 500).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.client.Del(ctx, keys...).Err()
+}
@@ -0,0 +1,251 @@
+package statements
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/health"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	statementCachePrefix    = "stmt:"
+	transactionsCachePrefix = "txs:"
+)
+
+// CachedRepo is a read-through cache for GetStatement and GetTransactions.
+// Writes invalidate the affected entries once done; deletes by transaction ID
+// cannot tell the statement apart and drop every cached transaction list
+// instead. A write whose entries could not be invalidated fails with
+// ErrCacheInvalidation, since other instances would go on reading the
+// replaced values until they expire.
+type CachedRepo struct {
+	StatementRepository
+	store CacheStore
+	ttl   time.Duration
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// cachedTransactions wraps the list, BSON documents cannot be arrays.
+type cachedTransactions struct {
+	Items []Transaction `bson:"items"`
+}
+
+func NewCachedRepo(repo StatementRepository, store CacheStore, ttl time.Duration) *CachedRepo {
+	return &CachedRepo{
+		StatementRepository: repo,
+		store:               store,
+		ttl:                 ttl,
+	}
+}
+
+// ErrCacheInvalidation is returned for a write that was stored but whose
+// cached entries could not be dropped.
+var ErrCacheInvalidation = apierror.New(apierror.KindUnavailable, "cache_invalidation_failed", "the write was stored but the cache could not be invalidated, retry it")
+
+// cacheFromEnv wraps repo in a CachedRepo sharing its entries through
+// REDIS_URL, and returns it as is without. An in-process cache is not used:
+// the writes of another instance would never invalidate it.
+func cacheFromEnv(repo StatementRepository) (StatementRepository, error) {
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		return repo, nil
+	}
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	ttl := envDuration("CACHE_TTL_MS", time.Minute)
+	store := NewRedisStore(redis.NewClient(opts), envOr("REDIS_PREFIX", "finchie:"))
+	slog.Info("Repository read cache enabled", "store", store.Name(), "ttl", ttl)
+	return NewCachedRepo(repo, store, ttl), nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func (r *CachedRepo) Unwrap() StatementRepository {
+	return r.StatementRepository
+}
+
+func (r *CachedRepo) Describe() map[string]string {
+	if d, ok := r.StatementRepository.(Describer); ok {
+		return d.Describe()
+	}
+	return nil
+}
+
+// Check reports the hit/miss counters, the cache never makes the service unhealthy.
+func (r *CachedRepo) Check() (string, map[string]string) {
+	hits, misses := r.hits.Load(), r.misses.Load()
+	ratio := 0.0
+	if hits+misses > 0 {
+		ratio = float64(hits) / float64(hits+misses)
+	}
+	return health.StatusOK, map[string]string{
+		"store":     r.store.Name(),
+		"hits":      strconv.FormatInt(hits, 10),
+		"misses":    strconv.FormatInt(misses, 10),
+		"hit_ratio": strconv.FormatFloat(ratio, 'f', 3, 64),
+	}
+}
+
+// get looks key up, reporting the generation to store a miss at. ok is false
+// when the store cannot be read; the read then bypasses the cache.
+func (r *CachedRepo) get(ctx context.Context, key string, v any) (hit bool, generation int64, ok bool) {
+	data, generation, err := r.store.Get(ctx, key)
+	if err != nil {
+		slog.Warn("Failed to read the cache", "key", key, "error", err)
+		r.misses.Add(1)
+		return false, 0, false
+	}
+	if data != nil && bson.Unmarshal(data, v) == nil {
+		r.hits.Add(1)
+		return true, generation, true
+	}
+	r.misses.Add(1)
+	return false, generation, true
+}
+
+func (r *CachedRepo) GetStatement(ctx context.Context, id string) (*Statement, error) {
+	key := statementCachePrefix + id
+	var cached Statement
+	hit, generation, ok := r.get(ctx, key, &cached)
+	if hit {
+		return &cached, nil
+	}
+
+	stmt, err := r.StatementRepository.GetStatement(ctx, id)
+	if err != nil || stmt == nil || !ok {
+		return stmt, err
+	}
+	r.set(ctx, key, generation, stmt)
+	return stmt, nil
+}
+
+func (r *CachedRepo) GetTransactions(ctx context.Context, statementID string) ([]Transaction, error) {
+	key := transactionsCachePrefix + statementID
+	var cached cachedTransactions
+	hit, generation, ok := r.get(ctx, key, &cached)
+	if hit {
+		return cached.Items, nil
+	}
+
+	txs, err := r.StatementRepository.GetTransactions(ctx, statementID)
+	if err != nil || !ok {
+		return txs, err
+	}
+	r.set(ctx, key, generation, cachedTransactions{Items: txs})
+	return txs, nil
+}
+
+// set stores a read made at generation. A failure only costs a miss.
+func (r *CachedRepo) set(ctx context.Context, key string, generation int64, v any) {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		slog.Warn("Failed to encode cache entry", "key", key, "error", err)
+		return
+	}
+	if err := r.store.Set(ctx, key, generation, data, r.ttl); err != nil {
+		slog.Warn("Failed to store cache entry", "key", key, "error", err)
+	}
+}
+
+// invalidated runs write, then drops the cached entries it replaced, even
+// after a failed write that may have been applied.
+func (r *CachedRepo) invalidated(ctx context.Context, write func() error, keys ...string) error {
+	err := write()
+	if len(keys) == 0 {
+		return err
+	}
+	if invErr := r.store.Delete(context.WithoutCancel(ctx), keys...); invErr != nil {
+		slog.Error("Failed to invalidate the cache", "keys", keys, "error", invErr)
+		return errors.Join(err, fmt.Errorf("%w: %w", ErrCacheInvalidation, invErr))
+	}
+	return err
+}
+
+// invalidatedPrefix is invalidated for every key starting with prefix.
+func (r *CachedRepo) invalidatedPrefix(ctx context.Context, write func() error, prefix string) error {
+	err := write()
+	if invErr := r.store.DeletePrefix(context.WithoutCancel(ctx), prefix); invErr != nil {
+		slog.Error("Failed to invalidate the cache", "prefix", prefix, "error", invErr)
+		return errors.Join(err, fmt.Errorf("%w: %w", ErrCacheInvalidation, invErr))
+	}
+	return err
+}
+
+func (r *CachedRepo) UpsertStatement(ctx context.Context, statement *Statement) error {
+	return r.invalidated(ctx, func() error {
+		return r.StatementRepository.UpsertStatement(ctx, statement)
+	}, statementCachePrefix+statement.ID)
+}
+
+func (r *CachedRepo) DeleteStatement(ctx context.Context, id string) error {
+	return r.invalidated(ctx, func() error {
+		return r.StatementRepository.DeleteStatement(ctx, id)
+	}, statementCachePrefix+id, transactionsCachePrefix+id)
+}
+
+// UpsertTransaction also invalidates every list, the transaction may have
+// moved from another statement.
+func (r *CachedRepo) UpsertTransaction(ctx context.Context, tx *Transaction) error {
+	return r.invalidatedPrefix(ctx, func() error {
+		return r.StatementRepository.UpsertTransaction(ctx, tx)
+	}, transactionsCachePrefix)
+}
+
+func (r *CachedRepo) DeleteTransaction(ctx context.Context, id string) error {
+	return r.invalidatedPrefix(ctx, func() error {
+		return r.StatementRepository.DeleteTransaction(ctx, id)
+	}, transactionsCachePrefix)
+}
+
+func (r *CachedRepo) BulkUpsertTransactions(ctx context.Context, transactions []Transaction) error {
+	return r.invalidated(ctx, func() error {
+		return r.StatementRepository.BulkUpsertTransactions(ctx, transactions)
+	}, transactionKeys(transactions)...)
+}
+
+func (r *CachedRepo) BulkDeleteTransactions(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return r.StatementRepository.BulkDeleteTransactions(ctx, ids)
+	}
+	return r.invalidatedPrefix(ctx, func() error {
+		return r.StatementRepository.BulkDeleteTransactions(ctx, ids)
+	}, transactionsCachePrefix)
+}
+
+func (r *CachedRepo) SaveStatementWithDelta(ctx context.Context, statement *Statement, delta TransactionDelta) error {
+	keys := append(transactionKeys(delta.Upserts),
+		statementCachePrefix+statement.ID, transactionsCachePrefix+statement.ID)
+	return r.invalidated(ctx, func() error {
+		return r.StatementRepository.SaveStatementWithDelta(ctx, statement, delta)
+	}, keys...)
+}
+
+func transactionKeys(transactions []Transaction) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, tx := range transactions {
+		if !seen[tx.StatementID] {
+			seen[tx.StatementID] = true
+			keys = append(keys, transactionsCachePrefix+tx.StatementID)
+		}
+	}
+	return keys
+}
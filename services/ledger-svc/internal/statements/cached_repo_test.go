@@ -0,0 +1,108 @@
+package statements
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// stalledReads holds GetStatement after the read until released, the window
+// in which a concurrent write replaces what was read.
+type stalledReads struct {
+	StatementRepository
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (r *stalledReads) GetStatement(ctx context.Context, id string) (*Statement, error) {
+	stmt, err := r.StatementRepository.GetStatement(ctx, id)
+	r.read <- struct{}{}
+	<-r.release
+	return stmt, err
+}
+
+func TestCachedRepoDoesNotCacheAReadRacingAWrite(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	inner := NewInMemoryRepo()
+	if err := inner.UpsertStatement(ctx, &Statement{ID: "stmt_1", Currency: "TWD", TotalAmount: 100}); err != nil {
+		t.Fatal(err)
+	}
+	stalled := &stalledReads{StatementRepository: inner, read: make(chan struct{}), release: make(chan struct{})}
+	repo := NewCachedRepo(stalled, NewLRUStore(10), time.Minute)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = repo.GetStatement(ctx, "stmt_1")
+	}()
+	<-stalled.read
+	if err := repo.UpsertStatement(ctx, &Statement{ID: "stmt_1", Currency: "TWD", TotalAmount: 200}); err != nil {
+		t.Fatalf("UpsertStatement() error = %v", err)
+	}
+	close(stalled.release)
+	<-done
+
+	go func() { <-stalled.read }()
+	stmt, err := repo.GetStatement(ctx, "stmt_1")
+	if err != nil || stmt == nil {
+		t.Fatalf("GetStatement() = %v, %v", stmt, err)
+	}
+	if stmt.TotalAmount != 200 {
+		t.Errorf("TotalAmount = %v, want 200: the read racing the write was cached", stmt.TotalAmount)
+	}
+}
+
+// brokenCache cannot be written, like an unreachable Redis.
+type brokenCache struct {
+	*LRUStore
+}
+
+var errCacheDown = errors.New("cache down")
+
+func (brokenCache) Delete(context.Context, ...string) error {
+	return errCacheDown
+}
+
+func (brokenCache) DeletePrefix(context.Context, string) error {
+	return errCacheDown
+}
+
+func TestCachedRepoFailsWritesItCannotInvalidate(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	inner := NewInMemoryRepo()
+	repo := NewCachedRepo(inner, brokenCache{NewLRUStore(10)}, time.Minute)
+
+	err := repo.UpsertStatement(ctx, &Statement{ID: "stmt_1", Currency: "TWD", TotalAmount: 100})
+	if !errors.Is(err, ErrCacheInvalidation) || !errors.Is(err, errCacheDown) {
+		t.Errorf("UpsertStatement() error = %v, want ErrCacheInvalidation", err)
+	}
+	if stmt, _ := inner.GetStatement(ctx, "stmt_1"); stmt == nil {
+		t.Error("the statement was not stored")
+	}
+	if err := repo.DeleteTransaction(ctx, "tx_1"); !errors.Is(err, ErrCacheInvalidation) {
+		t.Errorf("DeleteTransaction() error = %v, want ErrCacheInvalidation", err)
+	}
+}
+
+func TestCacheIsOffWithoutRedis(t *testing.T) {
+	t.Setenv("REDIS_URL", "")
+
+	inner := NewInMemoryRepo()
+	repo, err := cacheFromEnv(inner)
+	if err != nil {
+		t.Fatalf("cacheFromEnv() error = %v", err)
+	}
+	if repo != StatementRepository(inner) {
+		t.Errorf("cacheFromEnv() = %T, want the repository itself", repo)
+	}
+
+	t.Setenv("REDIS_URL", "not a url")
+	if _, err := cacheFromEnv(inner); err == nil {
+		t.Error("cacheFromEnv() accepted an invalid REDIS_URL")
+	}
+}
@@ -0,0 +1,446 @@
+package statements
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/health"
+)
+
+// ErrQueued is returned for writes accepted while the database is unreachable.
+// They are replayed in order once connectivity returns.
+var ErrQueued = errors.New("write queued for replay")
+
+// ErrUnavailable wraps the writes refused while the database is unreachable
+// and the outbox cannot take them.
+var ErrUnavailable = apierror.New(apierror.KindUnavailable, "database_unavailable", "database unavailable, retry later")
+
+// ErrUncached wraps the error of a read the degraded read cache cannot answer
+// while the database is unreachable.
+var ErrUncached = errors.New("not in the degraded read cache")
+
+// pendingWrite is a queued write, kept as data so the outbox file can hold it.
+type pendingWrite struct {
+	Op           string            `bson:"op"`
+	ID           string            `bson:"id,omitempty"`
+	IDs          []string          `bson:"ids,omitempty"`
+	Statement    *Statement        `bson:"statement,omitempty"`
+	Paid         bool              `bson:"paid,omitempty"`
+	Transaction  *Transaction      `bson:"transaction,omitempty"`
+	Transactions []Transaction     `bson:"transactions,omitempty"`
+	Delta        *TransactionDelta `bson:"delta,omitempty"`
+}
+
+func (w *pendingWrite) apply(ctx context.Context, repo StatementRepository) error {
+	switch w.Op {
+	case "upsert_statement":
+		stmt := w.statement()
+		return repo.UpsertStatement(ctx, &stmt)
+	case "delete_statement":
+		return repo.DeleteStatement(ctx, w.ID)
+	case "upsert_transaction":
+		tx := *w.Transaction
+		return repo.UpsertTransaction(ctx, &tx)
+	case "delete_transaction":
+		return repo.DeleteTransaction(ctx, w.ID)
+	case "bulk_upsert_transactions":
+		return repo.BulkUpsertTransactions(ctx, w.Transactions)
+	case "bulk_delete_transactions":
+		return repo.BulkDeleteTransactions(ctx, w.IDs)
+	case "save_statement_with_delta":
+		stmt := w.statement()
+		delta, err := reconcile(ctx, repo, &stmt, *w.Delta)
+		if err != nil {
+			return err
+		}
+		return repo.SaveStatementWithDelta(ctx, &stmt, delta)
+	}
+	return fmt.Errorf("unknown queued write %q", w.Op)
+}
+
+func (w *pendingWrite) statement() Statement {
+	stmt := *w.Statement
+	stmt.paidTransition = w.Paid
+	return stmt
+}
+
+// reconcile brings a save queued during an outage up to date with what is
+// stored: its delta and managed state were computed from the degraded read
+// cache, stale or empty, so the deletes are computed again and the state kept
+// from the stored statement and transactions is carried over again.
+func reconcile(ctx context.Context, repo StatementRepository, stmt *Statement, delta TransactionDelta) (TransactionDelta, error) {
+	existing, err := repo.GetStatement(ctx, stmt.ID)
+	if err != nil {
+		return delta, err
+	}
+	if existing != nil {
+		mergeManagedState(stmt, existing)
+	}
+	current, err := repo.GetTransactions(ctx, stmt.ID)
+	if err != nil {
+		return delta, err
+	}
+	desired := append([]Transaction(nil), delta.Upserts...)
+	refs := make(map[string][]ExternalRef, len(current))
+	for _, tx := range current {
+		refs[tx.ID] = tx.ExternalRefs
+	}
+	for i := range desired {
+		desired[i].ExternalRefs = normalizeExternalRefs(append(desired[i].ExternalRefs, refs[desired[i].ID]...))
+	}
+	keepAttribution(current, desired)
+	keepDisputes(current, desired)
+	return computeDelta(current, desired), nil
+}
+
+// DegradableRepo keeps the service answering while the underlying repository is
+// unavailable: recent reads are served from the last-known values and writes are
+// queued in an outbox for replay. The outbox is kept in a file, so the queued
+// writes survive a restart; without one, writes fail while the database is
+// unavailable.
+type DegradableRepo struct {
+	StatementRepository
+	isUnavailable func(error) bool
+
+	mu           sync.Mutex
+	statements   map[string]Statement
+	transactions map[string][]Transaction
+	order        []string
+	cacheSize    int
+	outbox       []pendingWrite
+	outboxSize   int
+	outboxFile   string
+	degraded     bool
+}
+
+func NewDegradableRepo(repo StatementRepository, isUnavailable func(error) bool, cacheSize, outboxSize int) *DegradableRepo {
+	return &DegradableRepo{
+		StatementRepository: repo,
+		isUnavailable:       isUnavailable,
+		statements:          make(map[string]Statement),
+		transactions:        make(map[string][]Transaction),
+		cacheSize:           cacheSize,
+		outboxSize:          outboxSize,
+	}
+}
+
+func (r *DegradableRepo) Unwrap() StatementRepository {
+	return r.StatementRepository
+}
+
+func (r *DegradableRepo) Describe() map[string]string {
+	if d, ok := r.StatementRepository.(Describer); ok {
+		return d.Describe()
+	}
+	return nil
+}
+
+// Degraded reports whether the last repository call failed for lack of
+// connectivity or writes are still waiting for replay.
+func (r *DegradableRepo) Degraded() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.degraded || len(r.outbox) > 0
+}
+
+func (r *DegradableRepo) Check() (string, map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	details := map[string]string{"queued_writes": strconv.Itoa(len(r.outbox))}
+	if r.degraded || len(r.outbox) > 0 {
+		return health.StatusDegraded, details
+	}
+	return health.StatusOK, details
+}
+
+func (r *DegradableRepo) GetStatement(ctx context.Context, id string) (*Statement, error) {
+	stmt, err := r.StatementRepository.GetStatement(ctx, id)
+	if err == nil {
+		r.markHealthy()
+		if stmt != nil {
+			r.remember(id, func() { r.statements[id] = *stmt })
+		}
+		return stmt, nil
+	}
+	if !r.isUnavailable(err) {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.degraded = true
+	if cached, ok := r.statements[id]; ok {
+		slog.Warn("Serving statement from degraded read cache", "id", id, "error", err)
+		return &cached, nil
+	}
+	return nil, err
+}
+
+func (r *DegradableRepo) GetTransactions(ctx context.Context, statementID string) ([]Transaction, error) {
+	txs, err := r.StatementRepository.GetTransactions(ctx, statementID)
+	if err == nil {
+		r.markHealthy()
+		r.remember(statementID, func() { r.transactions[statementID] = txs })
+		return txs, nil
+	}
+	if !r.isUnavailable(err) {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.degraded = true
+	if cached, ok := r.transactions[statementID]; ok {
+		slog.Warn("Serving transactions from degraded read cache", "statement_id", statementID, "error", err)
+		return cached, nil
+	}
+	return nil, fmt.Errorf("%w: %w", ErrUncached, err)
+}
+
+func (r *DegradableRepo) UpsertStatement(ctx context.Context, statement *Statement) error {
+	stmt := *statement
+	err := r.write(ctx, pendingWrite{Op: "upsert_statement", Statement: &stmt, Paid: statement.paidTransition})
+	if err == nil || errors.Is(err, ErrQueued) {
+		r.remember(stmt.ID, func() { r.statements[stmt.ID] = stmt })
+	}
+	return err
+}
+
+func (r *DegradableRepo) DeleteStatement(ctx context.Context, id string) error {
+	err := r.write(ctx, pendingWrite{Op: "delete_statement", ID: id})
+	if err == nil || errors.Is(err, ErrQueued) {
+		r.mu.Lock()
+		delete(r.statements, id)
+		delete(r.transactions, id)
+		r.mu.Unlock()
+	}
+	return err
+}
+
+func (r *DegradableRepo) UpsertTransaction(ctx context.Context, tx *Transaction) error {
+	t := *tx
+	return r.write(ctx, pendingWrite{Op: "upsert_transaction", Transaction: &t})
+}
+
+func (r *DegradableRepo) DeleteTransaction(ctx context.Context, id string) error {
+	return r.write(ctx, pendingWrite{Op: "delete_transaction", ID: id})
+}
+
+func (r *DegradableRepo) BulkUpsertTransactions(ctx context.Context, transactions []Transaction) error {
+	return r.write(ctx, pendingWrite{Op: "bulk_upsert_transactions", Transactions: append([]Transaction(nil), transactions...)})
+}
+
+func (r *DegradableRepo) BulkDeleteTransactions(ctx context.Context, ids []string) error {
+	return r.write(ctx, pendingWrite{Op: "bulk_delete_transactions", IDs: append([]string(nil), ids...)})
+}
+
+func (r *DegradableRepo) SaveStatementWithDelta(ctx context.Context, statement *Statement, delta TransactionDelta) error {
+	stmt := *statement
+	err := r.write(ctx, pendingWrite{Op: "save_statement_with_delta", Statement: &stmt, Paid: statement.paidTransition, Delta: &delta})
+	if err == nil || errors.Is(err, ErrQueued) {
+		r.remember(stmt.ID, func() {
+			r.statements[stmt.ID] = stmt
+			r.transactions[stmt.ID] = delta.Upserts
+		})
+	}
+	return err
+}
+
+func (r *DegradableRepo) write(ctx context.Context, w pendingWrite) error {
+	// keep ordering: once something is queued, later writes queue behind it
+	r.mu.Lock()
+	if len(r.outbox) > 0 {
+		defer r.mu.Unlock()
+		return r.enqueue(ctx, w)
+	}
+	r.mu.Unlock()
+
+	err := w.apply(ctx, r.StatementRepository)
+	if err == nil || !r.isUnavailable(err) {
+		if err == nil {
+			r.markHealthy()
+		}
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.degraded = true
+	if r.outboxFile == "" {
+		// a 202 for a write that a restart would lose is a lie, the client
+		// retries the 503
+		tripCircuit(ctx)
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	slog.Warn("Database unavailable, queueing write", "op", w.Op, "error", err)
+	return r.enqueue(ctx, w)
+}
+
+// enqueue appends the write to the outbox and its file; r.mu is held.
+func (r *DegradableRepo) enqueue(ctx context.Context, w pendingWrite) error {
+	if len(r.outbox) >= r.outboxSize {
+		tripCircuit(ctx)
+		return fmt.Errorf("%w: write outbox is full", ErrUnavailable)
+	}
+	outbox := append(r.outbox, w)
+	if err := r.persist(outbox); err != nil {
+		tripCircuit(ctx)
+		return fmt.Errorf("%w: persist write outbox: %w", ErrUnavailable, err)
+	}
+	r.outbox = outbox
+	return ErrQueued
+}
+
+// PersistOutbox keeps the outbox in the file at path and queues the writes a
+// previous process left there.
+func (r *DegradableRepo) PersistOutbox(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var doc struct {
+		Writes []pendingWrite `bson:"writes"`
+	}
+	if len(data) > 0 {
+		if err := bson.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("read write outbox %s: %w", path, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outboxFile = path
+	r.outbox = append(doc.Writes, r.outbox...)
+	if len(doc.Writes) > 0 {
+		r.degraded = true
+		slog.Warn("Queued writes left by the previous run, replaying them", "writes", len(doc.Writes), "file", path)
+	}
+	return nil
+}
+
+// persist replaces the outbox file with the writes, fsynced before the
+// rename so a crash leaves either version; r.mu is held.
+func (r *DegradableRepo) persist(writes []pendingWrite) error {
+	if r.outboxFile == "" {
+		return nil
+	}
+	data, err := bson.Marshal(struct {
+		Writes []pendingWrite `bson:"writes"`
+	}{writes})
+	if err != nil {
+		return err
+	}
+	tmp := r.outboxFile + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.outboxFile)
+}
+
+// Run replays queued writes until ctx is done.
+func (r *DegradableRepo) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.replay(ctx)
+		}
+	}
+}
+
+// Flush replays the queued writes once more, e.g. before the process exits,
+// and returns how many are still queued in the outbox file.
+func (r *DegradableRepo) Flush(ctx context.Context) int {
+	r.replay(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.outbox)
+}
+
+func (r *DegradableRepo) replay(ctx context.Context) {
+	for {
+		r.mu.Lock()
+		if len(r.outbox) == 0 {
+			r.mu.Unlock()
+			return
+		}
+		next := r.outbox[0]
+		r.mu.Unlock()
+
+		err := next.apply(ctx, r.StatementRepository)
+		if err != nil && r.isUnavailable(err) {
+			return
+		}
+		if err != nil {
+			slog.Error("Dropping queued write after permanent failure", "op", next.Op, "error", err)
+		} else {
+			slog.Info("Replayed queued write", "op", next.Op)
+		}
+
+		r.mu.Lock()
+		r.outbox = r.outbox[1:]
+		if err := r.persist(r.outbox); err != nil {
+			// the next persist rewrites it, a restart before replays the
+			// write again
+			slog.Warn("Failed to persist write outbox", "error", err)
+		}
+		if len(r.outbox) == 0 {
+			r.degraded = false
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *DegradableRepo) markHealthy() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.outbox) == 0 {
+		r.degraded = false
+	}
+}
+
+// remember stores a read result and evicts the oldest entries past cacheSize.
+func (r *DegradableRepo) remember(key string, store func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	store()
+	for i, k := range r.order {
+		if k == key {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	r.order = append(r.order, key)
+	for len(r.order) > r.cacheSize {
+		oldest := r.order[0]
+		r.order = r.order[1:]
+		delete(r.statements, oldest)
+		delete(r.transactions, oldest)
+	}
+}
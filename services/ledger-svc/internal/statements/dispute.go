@@ -0,0 +1,198 @@
+package statements
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+// DisputeStatus is the stage of a chargeback claimed from the card issuer.
+type DisputeStatus string
+
+const (
+	DisputeOpened DisputeStatus = "opened"
+	// DisputePending waits on the issuer or the merchant.
+	DisputePending     DisputeStatus = "pending"
+	DisputeResolved    DisputeStatus = "resolved"
+	DisputeChargedBack DisputeStatus = "charged_back"
+)
+
+// disputeTransitions lists the statuses each status may move to. A resolved
+// dispute can be reopened, a chargeback is final.
+var disputeTransitions = map[DisputeStatus][]DisputeStatus{
+	"":                 {DisputeOpened},
+	DisputeOpened:      {DisputePending, DisputeResolved, DisputeChargedBack},
+	DisputePending:     {DisputeOpened, DisputeResolved, DisputeChargedBack},
+	DisputeResolved:    {DisputeOpened},
+	DisputeChargedBack: {},
+}
+
+// OpenDisputeStatuses are the statuses of the disputes still in progress.
+var OpenDisputeStatuses = []DisputeStatus{DisputeOpened, DisputePending}
+
+var (
+	ErrDisputeNotFound   = apierror.New(apierror.KindNotFound, "dispute_not_found", "transaction has no dispute")
+	ErrInvalidTransition = apierror.New(apierror.KindConflict, "invalid_dispute_transition", "invalid dispute transition")
+)
+
+func (s DisputeStatus) Valid() bool {
+	_, ok := disputeTransitions[s]
+	return ok && s != ""
+}
+
+// IsOpen reports whether the dispute is still in progress.
+func (s DisputeStatus) IsOpen() bool {
+	return slices.Contains(OpenDisputeStatuses, s)
+}
+
+// Dispute tracks a chargeback of the transaction. Deadline is the date the
+// issuer expects an answer or documents by.
+type Dispute struct {
+	Status    DisputeStatus  `bson:"status" json:"status"`
+	Deadline  *time.Time     `bson:"deadline,omitempty" json:"deadline,omitempty"`
+	Notes     []DisputeNote  `bson:"notes,omitempty" json:"notes,omitempty"`
+	History   []DisputeEvent `bson:"history" json:"history"`
+	OpenedAt  time.Time      `bson:"opened_at" json:"opened_at"`
+	UpdatedAt time.Time      `bson:"updated_at" json:"updated_at"`
+}
+
+type DisputeNote struct {
+	At   time.Time `bson:"at" json:"at"`
+	Text string    `bson:"text" json:"text"`
+}
+
+// DisputeEvent records a status change.
+type DisputeEvent struct {
+	At     time.Time     `bson:"at" json:"at"`
+	Status DisputeStatus `bson:"status" json:"status"`
+}
+
+// DisputeUpdate changes a dispute: every field is optional, an empty status
+// keeps the current one.
+type DisputeUpdate struct {
+	Status   DisputeStatus `json:"status"`
+	Note     string        `json:"note"`
+	Deadline *time.Time    `json:"deadline"`
+}
+
+// apply validates the transition and changes the dispute, a new one when d is
+// nil.
+func (d *Dispute) apply(update DisputeUpdate, now time.Time) (*Dispute, error) {
+	var next Dispute
+	if d != nil {
+		next = *d
+		next.Notes = slices.Clone(d.Notes)
+		next.History = slices.Clone(d.History)
+	} else if update.Status == "" {
+		update.Status = DisputeOpened
+	}
+
+	if update.Status != "" && update.Status != next.Status {
+		if !update.Status.Valid() {
+			return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidTransition, update.Status)
+		}
+		if !slices.Contains(disputeTransitions[next.Status], update.Status) {
+			from := string(next.Status)
+			if from == "" {
+				from = "none"
+			}
+			return nil, fmt.Errorf("%w from %s to %s", ErrInvalidTransition, from, update.Status)
+		}
+		if next.OpenedAt.IsZero() {
+			next.OpenedAt = now
+		}
+		next.Status = update.Status
+		next.History = append(next.History, DisputeEvent{At: now, Status: update.Status})
+	}
+	if note := strings.TrimSpace(update.Note); note != "" {
+		next.Notes = append(next.Notes, DisputeNote{At: now, Text: note})
+	}
+	if update.Deadline != nil {
+		deadline := update.Deadline.UTC()
+		next.Deadline = &deadline
+	}
+	next.UpdatedAt = now
+	return &next, nil
+}
+
+// Dispute returns the dispute of a transaction of the statement,
+// ErrDisputeNotFound when it is not disputed.
+func (s *StatementService) Dispute(ctx context.Context, statementID, transactionID string) (*Dispute, error) {
+	txs, err := s.Repo.GetTransactions(ctx, statementID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range txs {
+		if txs[i].ID != transactionID {
+			continue
+		}
+		if txs[i].Dispute == nil {
+			return nil, ErrDisputeNotFound
+		}
+		return txs[i].Dispute, nil
+	}
+	return nil, ErrTransactionNotFound
+}
+
+// UpdateDispute opens the dispute of a transaction of the statement or moves
+// it along, ErrInvalidTransition when the status cannot follow the current
+// one.
+func (s *StatementService) UpdateDispute(ctx context.Context, statementID, transactionID string, update DisputeUpdate) (*Transaction, error) {
+	txs, err := s.Repo.GetTransactions(ctx, statementID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range txs {
+		if txs[i].ID != transactionID {
+			continue
+		}
+		tx := txs[i]
+		dispute, err := tx.Dispute.apply(update, time.Now().UTC())
+		if err != nil {
+			return nil, err
+		}
+		tx.Dispute = dispute
+		return &tx, s.Repo.UpsertTransaction(ctx, &tx)
+	}
+	return nil, ErrTransactionNotFound
+}
+
+// Disputes returns the transactions disputed with one of the statuses,
+// earliest deadline first and the ones without a deadline last.
+func (s *StatementService) Disputes(ctx context.Context, statuses []DisputeStatus) ([]Transaction, error) {
+	txs, err := s.Repo.FindTransactions(ctx, TransactionFilter{DisputeStatuses: statuses})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(txs, func(i, j int) bool {
+		a, b := txs[i].Dispute.Deadline, txs[j].Dispute.Deadline
+		switch {
+		case a == nil || b == nil:
+			return a != nil && b == nil
+		default:
+			return a.Before(*b)
+		}
+	})
+	return txs, nil
+}
+
+// keepDisputes carries the disputes over to the re-posted transactions, the
+// fetchers never report them.
+func keepDisputes(current, desired []Transaction) {
+	stored := make(map[string]*Dispute, len(current))
+	for _, tx := range current {
+		if tx.Dispute != nil {
+			stored[tx.ID] = tx.Dispute
+		}
+	}
+	for i := range desired {
+		if dispute, ok := stored[desired[i].ID]; ok {
+			desired[i].Dispute = dispute
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package statements
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+var ErrInvalidMerge = apierror.New(apierror.KindInvalid, "invalid_merge", "invalid merge")
+
+// Duplicate is a pair of statements of the same source and total whose
+// periods overlap, which most likely describe the same bill under two IDs,
+// e.g. after a fetcher started reporting source IDs.
+type Duplicate struct {
+	SourceName   string    `json:"source_name"`
+	TotalAmount  float64   `json:"total_amount"`
+	StatementIDs [2]string `json:"statement_ids"`
+	// SameContent is set when the transactions are identical as well.
+	SameContent bool `json:"same_content"`
+}
+
+// period is the range of the transaction dates of a statement. Without
+// transactions it is the month before the due date.
+type period struct {
+	from, to time.Time
+}
+
+func (p period) overlaps(other period) bool {
+	return !p.to.Before(other.from) && !other.to.Before(p.from)
+}
+
+// FindDuplicates lists probable duplicates, of one source when sourceName is
+// not empty. Only statements sharing source and total are compared, so the
+// transactions are read for few of them.
+func (s *StatementService) FindDuplicates(ctx context.Context, sourceName string) ([]Duplicate, error) {
+	stmts, err := s.Repo.ListStatements(ctx, StatementFilter{SourceName: sourceName})
+	if err != nil {
+		return nil, err
+	}
+
+	type groupKey struct {
+		source string
+		cents  int64
+	}
+	groups := map[groupKey][]*Statement{}
+	for i := range stmts {
+		key := groupKey{stmts[i].SourceName, int64(math.Round(stmts[i].TotalAmount * 100))}
+		groups[key] = append(groups[key], &stmts[i])
+	}
+
+	periods := map[string]period{}
+	periodOf := func(stmt *Statement) (period, error) {
+		if p, ok := periods[stmt.ID]; ok {
+			return p, nil
+		}
+		p, err := s.periodOf(ctx, stmt)
+		periods[stmt.ID] = p
+		return p, err
+	}
+
+	duplicates := []Duplicate{}
+	for _, group := range groups {
+		for i, a := range group {
+			for _, b := range group[i+1:] {
+				sameContent := a.ContentHash != "" && a.ContentHash == b.ContentHash
+				if !sameContent {
+					pa, err := periodOf(a)
+					if err != nil {
+						return nil, err
+					}
+					pb, err := periodOf(b)
+					if err != nil {
+						return nil, err
+					}
+					if !pa.overlaps(pb) {
+						continue
+					}
+				}
+				ids := [2]string{a.ID, b.ID}
+				sort.Strings(ids[:])
+				duplicates = append(duplicates, Duplicate{
+					SourceName:   a.SourceName,
+					TotalAmount:  a.TotalAmount,
+					StatementIDs: ids,
+					SameContent:  sameContent,
+				})
+			}
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].SourceName != duplicates[j].SourceName {
+			return duplicates[i].SourceName < duplicates[j].SourceName
+		}
+		return duplicates[i].StatementIDs[0] < duplicates[j].StatementIDs[0]
+	})
+	return duplicates, nil
+}
+
+func (s *StatementService) periodOf(ctx context.Context, stmt *Statement) (period, error) {
+	txs, err := s.Repo.GetTransactions(ctx, stmt.ID)
+	if err != nil {
+		return period{}, err
+	}
+	if len(txs) == 0 {
+		due := dueDateOf(stmt)
+		if due.IsZero() {
+			return period{}, nil
+		}
+		return period{from: due.AddDate(0, -1, 1), to: due}, nil
+	}
+	p := period{from: txs[0].Date, to: txs[0].Date}
+	for i := range txs {
+		if txs[i].Date.Before(p.from) {
+			p.from = txs[i].Date
+		}
+		if txs[i].Date.After(p.to) {
+			p.to = txs[i].Date
+		}
+	}
+	return p, nil
+}
+
+type MergeResult struct {
+	ID                  string `json:"id"`
+	Removed             string `json:"removed"`
+	MovedTransactions   int    `json:"moved_transactions"`
+	DroppedTransactions int    `json:"dropped_transactions"`
+}
+
+// MergeStatements moves the transactions of the duplicate that keep does not
+// have yet, matched by date, amount and description, to keep and removes the
+// duplicate with the rest of its transactions. Reminder and payment state of
+// the duplicate is kept when keep has none. A nil result means one of the
+// statements does not exist.
+//
+// The transactions are moved before the duplicate is removed, so an
+// interrupted merge loses nothing and can be run again.
+func (s *StatementService) MergeStatements(ctx context.Context, keepID, duplicateID string) (*MergeResult, error) {
+	if keepID == duplicateID {
+		return nil, fmt.Errorf("%w: a statement cannot be merged into itself", ErrInvalidMerge)
+	}
+	keep, err := s.Repo.GetStatement(ctx, keepID)
+	if err != nil || keep == nil {
+		return nil, err
+	}
+	duplicate, err := s.Repo.GetStatement(ctx, duplicateID)
+	if err != nil || duplicate == nil {
+		return nil, err
+	}
+	if keep.SourceName != duplicate.SourceName {
+		return nil, fmt.Errorf("%w: statements of %s and %s cannot be merged", ErrInvalidMerge, keep.SourceName, duplicate.SourceName)
+	}
+
+	keepTxs, err := s.Repo.GetTransactions(ctx, keep.ID)
+	if err != nil {
+		return nil, err
+	}
+	duplicateTxs, err := s.Repo.GetTransactions(ctx, duplicate.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MergeResult{ID: keep.ID, Removed: duplicate.ID}
+	have := make(map[string]bool, len(keepTxs))
+	for i := range keepTxs {
+		have[keepTxs[i].fingerprint()] = true
+	}
+	var moved []Transaction
+	for _, tx := range duplicateTxs {
+		if fp := tx.fingerprint(); !have[fp] {
+			have[fp] = true
+			tx.StatementID = keep.ID
+			moved = append(moved, tx)
+		}
+	}
+	result.MovedTransactions = len(moved)
+	result.DroppedTransactions = len(duplicateTxs) - len(moved)
+
+	queued := false
+	writes := []func() error{
+		func() error { return s.Repo.BulkUpsertTransactions(ctx, moved) },
+		func() error { return s.Repo.DeleteStatement(ctx, duplicate.ID) },
+		func() error {
+			mergeDuplicateState(keep, duplicate)
+			return s.Repo.UpsertStatement(ctx, keep)
+		},
+	}
+	for _, write := range writes {
+		err := write()
+		if errors.Is(err, ErrQueued) {
+			queued = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if queued {
+		return result, ErrQueued
+	}
+	return result, nil
+}
+
+// mergeDuplicateState keeps the furthest reminder escalation of the two
+// statements, and the payment of the duplicate when the kept one is open.
+func mergeDuplicateState(keep, duplicate *Statement) {
+	mergeReminderState(keep, duplicate)
+	if keep.Status == StatusOpen {
+		keep.Status = duplicate.Status
+		keep.PaidAt = duplicate.PaidAt
+		keep.PaymentMatch = duplicate.PaymentMatch
+	}
+}
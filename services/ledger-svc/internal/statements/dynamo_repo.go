@@ -0,0 +1,711 @@
+package statements
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const dynamoDriver = "dynamo"
+
+func init() {
+	RegisterDriver(dynamoDriver, openDynamoFromEnv)
+}
+
+const (
+	dynamoGSI = "gsi1"
+
+	entityStatement   = "statement"
+	entityTransaction = "transaction"
+
+	statementSK         = "#STATEMENT"
+	transactionSKPrefix = "TX#"
+	// transactionShards spreads the transactions of the index over as many
+	// partition keys, one key would take every write of the table
+	transactionShards = 16
+	// legacyTransactionGSIPK is the single index key of the transactions
+	// written before sharding, rewritten by reshardTransactions
+	legacyTransactionGSIPK = "TX"
+
+	// DynamoDB limits
+	dynamoBatchSize       = 25
+	dynamoTransactionSize = 100
+)
+
+// DynamoRepo stores statements and transactions in a single table:
+//
+//	statement:   pk = STMT#<id>, sk = #STATEMENT,  gsi1pk = SOURCE#<source_name>, gsi1sk = <due date>#<id>
+//	transaction: pk = STMT#<statement_id>, sk = TX#<id>, gsi1pk = TX#<shard>, gsi1sk = <id>
+//
+// The shard of a transaction is a hash of its ID, so a transaction is found by
+// ID with one query and listing across statements merges the 16 shards. The
+// table needs the string keys pk (hash) and sk (range) and a global secondary
+// index "gsi1" on gsi1pk (hash) and gsi1sk (range) projecting all attributes.
+// The documents themselves are kept as JSON in the data attribute. Change
+// events are not recorded, DynamoRepo has no outbox.
+type DynamoRepo struct {
+	client  DynamoAPI
+	table   string
+	timeout time.Duration
+}
+
+// DynamoAPI is the part of *dynamodb.Client DynamoRepo uses.
+type DynamoAPI interface {
+	dynamodb.QueryAPIClient
+	dynamodb.ScanAPIClient
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+type dynamoItem struct {
+	PK          string `dynamodbav:"pk"`
+	SK          string `dynamodbav:"sk"`
+	GSI1PK      string `dynamodbav:"gsi1pk"`
+	GSI1SK      string `dynamodbav:"gsi1sk"`
+	Entity      string `dynamodbav:"entity"`
+	StatementID string `dynamodbav:"statement_id,omitempty"`
+	Data        string `dynamodbav:"data"`
+}
+
+func NewDynamoRepo(client DynamoAPI, table string, timeout time.Duration) *DynamoRepo {
+	return &DynamoRepo{
+		client:  client,
+		table:   table,
+		timeout: timeout,
+	}
+}
+
+func openDynamoFromEnv() (StatementRepository, error) {
+	table := os.Getenv("DYNAMO_TABLE")
+	if table == "" {
+		return nil, errors.New("DYNAMO_TABLE is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), envDuration("DYNAMO_CONNECT_TIMEOUT_MS", 10*time.Second))
+	defer cancel()
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		// DYNAMO_ENDPOINT points at DynamoDB Local during development
+		if endpoint := os.Getenv("DYNAMO_ENDPOINT"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+
+	if _, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)}); err != nil {
+		return nil, fmt.Errorf("describe table %s: %w", table, err)
+	}
+	repo := NewDynamoRepo(client, table, envDuration("DYNAMO_QUERY_TIMEOUT_MS", 5*time.Second))
+	if err := repo.reshardTransactions(ctx); err != nil {
+		return nil, fmt.Errorf("reshard transactions: %w", err)
+	}
+	return cacheFromEnv(repo)
+}
+
+// reshardTransactions moves the transactions still indexed under the single
+// legacy key to their shard. Once done the query finds nothing, so it is cheap
+// to run on every start.
+func (r *DynamoRepo) reshardTransactions(ctx context.Context) error {
+	var requests []types.WriteRequest
+	paginator := dynamodb.NewQueryPaginator(r.client, &dynamodb.QueryInput{
+		TableName:              aws.String(r.table),
+		IndexName:              aws.String(dynamoGSI),
+		KeyConditionExpression: aws.String("gsi1pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: legacyTransactionGSIPK},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, item := range page.Items {
+			tx, err := decodeTransaction(item)
+			if err != nil {
+				return err
+			}
+			item["gsi1pk"] = &types.AttributeValueMemberS{Value: transactionGSIPK(tx.ID)}
+			requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+		}
+	}
+	if len(requests) > 0 {
+		slog.Info("Resharding the DynamoDB transaction index", "table", r.table, "transactions", len(requests))
+	}
+	return r.batchWrite(ctx, requests)
+}
+
+func (r *DynamoRepo) Describe() map[string]string {
+	return map[string]string{
+		"storage": "dynamo",
+		"table":   r.table,
+	}
+}
+
+func statementPK(id string) string {
+	return "STMT#" + id
+}
+
+// transactionGSIPK is the index key of the shard of a transaction.
+func transactionGSIPK(id string) string {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return shardGSIPK(int(h.Sum32() % transactionShards))
+}
+
+func shardGSIPK(shard int) string {
+	return fmt.Sprintf("TX#%02d", shard)
+}
+
+func statementItem(stmt *Statement) (map[string]types.AttributeValue, error) {
+	doc := *stmt
+	doc.Transactions = nil
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return attributevalue.MarshalMap(dynamoItem{
+		PK:     statementPK(stmt.ID),
+		SK:     statementSK,
+		GSI1PK: "SOURCE#" + stmt.SourceName,
+		GSI1SK: dueDateOf(stmt).UTC().Format(time.RFC3339) + "#" + stmt.ID,
+		Entity: entityStatement,
+		Data:   string(data),
+	})
+}
+
+func transactionItem(tx *Transaction) (map[string]types.AttributeValue, error) {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return nil, err
+	}
+	return attributevalue.MarshalMap(dynamoItem{
+		PK:          statementPK(tx.StatementID),
+		SK:          transactionSKPrefix + tx.ID,
+		GSI1PK:      transactionGSIPK(tx.ID),
+		GSI1SK:      tx.ID,
+		Entity:      entityTransaction,
+		StatementID: tx.StatementID,
+		Data:        string(data),
+	})
+}
+
+func transactionKey(statementID, id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: statementPK(statementID)},
+		"sk": &types.AttributeValueMemberS{Value: transactionSKPrefix + id},
+	}
+}
+
+func decodeStatement(av map[string]types.AttributeValue) (Statement, error) {
+	var item dynamoItem
+	var stmt Statement
+	if err := attributevalue.UnmarshalMap(av, &item); err != nil {
+		return stmt, err
+	}
+	if err := json.Unmarshal([]byte(item.Data), &stmt); err != nil {
+		return stmt, err
+	}
+	stmt.ID = strings.TrimPrefix(item.PK, "STMT#")
+	return stmt, nil
+}
+
+func decodeTransaction(av map[string]types.AttributeValue) (Transaction, error) {
+	var item dynamoItem
+	var tx Transaction
+	if err := attributevalue.UnmarshalMap(av, &item); err != nil {
+		return tx, err
+	}
+	if err := json.Unmarshal([]byte(item.Data), &tx); err != nil {
+		return tx, err
+	}
+	tx.StatementID = item.StatementID
+	return tx, nil
+}
+
+func (r *DynamoRepo) GetStatement(ctx context.Context, id string) (*Statement, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	out, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.table),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: statementPK(id)},
+			"sk": &types.AttributeValueMemberS{Value: statementSK},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out.Item == nil {
+		return nil, nil
+	}
+	stmt, err := decodeStatement(out.Item)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt, nil
+}
+
+func (r *DynamoRepo) ListStatements(ctx context.Context, filter StatementFilter) ([]Statement, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var items []map[string]types.AttributeValue
+	if filter.SourceName != "" {
+		paginator := dynamodb.NewQueryPaginator(r.client, &dynamodb.QueryInput{
+			TableName:              aws.String(r.table),
+			IndexName:              aws.String(dynamoGSI),
+			KeyConditionExpression: aws.String("gsi1pk = :pk"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk": &types.AttributeValueMemberS{Value: "SOURCE#" + filter.SourceName},
+			},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, page.Items...)
+		}
+	} else {
+		paginator := dynamodb.NewScanPaginator(r.client, &dynamodb.ScanInput{
+			TableName:                 aws.String(r.table),
+			FilterExpression:          aws.String("entity = :entity"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{":entity": &types.AttributeValueMemberS{Value: entityStatement}},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, page.Items...)
+		}
+	}
+
+	statements := make([]Statement, 0, len(items))
+	for _, item := range items {
+		stmt, err := decodeStatement(item)
+		if err != nil {
+			return nil, err
+		}
+		if !filter.Match(&stmt) {
+			continue
+		}
+		statements = append(statements, stmt)
+	}
+	sort.SliceStable(statements, func(i, j int) bool {
+		return dueDateOf(&statements[i]).Before(dueDateOf(&statements[j]))
+	})
+	return statements, nil
+}
+
+func (r *DynamoRepo) UpsertStatement(ctx context.Context, statement *Statement) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	item, err := statementItem(statement)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(r.table), Item: item})
+	return err
+}
+
+// DeleteStatement deletes the whole partition of the statement, its
+// transactions first since the statement item sorts before them.
+func (r *DynamoRepo) DeleteStatement(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var requests []types.WriteRequest
+	paginator := dynamodb.NewQueryPaginator(r.client, &dynamodb.QueryInput{
+		TableName:              aws.String(r.table),
+		KeyConditionExpression: aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: statementPK(id)},
+		},
+		ProjectionExpression: aws.String("pk, sk"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, item := range page.Items {
+			requests = append(requests, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: item}})
+		}
+	}
+	if len(requests) > 0 {
+		// move the statement item last
+		requests = append(requests[1:], requests[0])
+	}
+	return r.batchWrite(ctx, requests)
+}
+
+func (r *DynamoRepo) GetTransactions(ctx context.Context, statementId string) ([]Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return r.queryTransactions(ctx, TransactionFilter{StatementID: statementId}, "", 0)
+}
+
+func (r *DynamoRepo) ListTransactions(ctx context.Context, filter TransactionFilter, page Page) ([]Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return r.queryTransactions(ctx, filter, page.After, page.Limit)
+}
+
+func (r *DynamoRepo) FindTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	transactions, err := r.queryTransactions(ctx, filter, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Date.Before(transactions[j].Date)
+	})
+	return transactions, nil
+}
+
+// queryTransactions reads transactions ordered by ID, either from the statement
+// partition or from every shard of the index, and applies the rest of the
+// filter while reading. A limit of 0 reads everything.
+func (r *DynamoRepo) queryTransactions(ctx context.Context, filter TransactionFilter, after string, limit int) ([]Transaction, error) {
+	if filter.StatementID != "" {
+		// the statement item sorts before "TX#", so "sk > TX#<after>" only matches transactions
+		return r.queryPartition(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(r.table),
+			KeyConditionExpression: aws.String("pk = :pk AND sk > :after"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":    &types.AttributeValueMemberS{Value: statementPK(filter.StatementID)},
+				":after": &types.AttributeValueMemberS{Value: transactionSKPrefix + after},
+			},
+		}, filter, limit)
+	}
+
+	// each shard is ordered by ID, the first limit matches of every shard
+	// hold the first limit matches overall
+	shards := make([][]Transaction, transactionShards)
+	errs := make([]error, transactionShards)
+	var wg sync.WaitGroup
+	for i := range shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shards[i], errs[i] = r.queryPartition(ctx, &dynamodb.QueryInput{
+				TableName:              aws.String(r.table),
+				IndexName:              aws.String(dynamoGSI),
+				KeyConditionExpression: aws.String("gsi1pk = :pk AND gsi1sk > :after"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":pk":    &types.AttributeValueMemberS{Value: shardGSIPK(i)},
+					":after": &types.AttributeValueMemberS{Value: after},
+				},
+			}, filter, limit)
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var transactions []Transaction
+	for _, shard := range shards {
+		transactions = append(transactions, shard...)
+	}
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactions[i].ID < transactions[j].ID
+	})
+	if limit > 0 && len(transactions) > limit {
+		transactions = transactions[:limit]
+	}
+	return transactions, nil
+}
+
+// queryPartition reads the transactions of one query up to the limit of
+// matches.
+func (r *DynamoRepo) queryPartition(ctx context.Context, input *dynamodb.QueryInput, filter TransactionFilter, limit int) ([]Transaction, error) {
+	var transactions []Transaction
+	paginator := dynamodb.NewQueryPaginator(r.client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			tx, err := decodeTransaction(item)
+			if err != nil {
+				return nil, err
+			}
+			if !filter.Match(&tx) {
+				continue
+			}
+			transactions = append(transactions, tx)
+			if limit > 0 && len(transactions) == limit {
+				return transactions, nil
+			}
+		}
+	}
+	return transactions, nil
+}
+
+// UpsertTransaction writes the transaction to the partition of its statement.
+// A transaction moved to another statement is deleted from the partition of
+// the previous one in the same transaction.
+func (r *DynamoRepo) UpsertTransaction(ctx context.Context, tx *Transaction) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	item, err := transactionItem(tx)
+	if err != nil {
+		return err
+	}
+	previous, err := r.statementOfTransaction(ctx, tx.ID)
+	if err != nil {
+		return err
+	}
+	if previous == "" || previous == tx.StatementID {
+		_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(r.table), Item: item})
+		return err
+	}
+	_, err = r.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: []types.TransactWriteItem{
+		{Put: &types.Put{TableName: aws.String(r.table), Item: item}},
+		{Delete: &types.Delete{TableName: aws.String(r.table), Key: transactionKey(previous, tx.ID)}},
+	}})
+	return err
+}
+
+func (r *DynamoRepo) DeleteTransaction(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	statementID, err := r.statementOfTransaction(ctx, id)
+	if err != nil {
+		return err
+	}
+	if statementID == "" {
+		return errors.New("transaction not found")
+	}
+	_, err = r.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.table),
+		Key:       transactionKey(statementID, id),
+	})
+	return err
+}
+
+// statementOfTransaction looks up the partition of a transaction by its ID,
+// returning "" when it does not exist.
+func (r *DynamoRepo) statementOfTransaction(ctx context.Context, id string) (string, error) {
+	tx, err := r.transactionByID(ctx, id)
+	if err != nil || tx == nil {
+		return "", err
+	}
+	return tx.StatementID, nil
+}
+
+// transactionByID reads a transaction from the index shard of its ID, nil
+// when it does not exist.
+func (r *DynamoRepo) transactionByID(ctx context.Context, id string) (*Transaction, error) {
+	out, err := r.client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(r.table),
+		IndexName:              aws.String(dynamoGSI),
+		KeyConditionExpression: aws.String("gsi1pk = :pk AND gsi1sk = :id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: transactionGSIPK(id)},
+			":id": &types.AttributeValueMemberS{Value: id},
+		},
+		Limit: aws.Int32(1),
+	})
+	if err != nil || len(out.Items) == 0 {
+		return nil, err
+	}
+	tx, err := decodeTransaction(out.Items[0])
+	if err != nil {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+// TransactionsByID reads the transactions with the IDs, whoever owns them, so
+// ScopedRepo can check the owner before a write.
+func (r *DynamoRepo) TransactionsByID(ctx context.Context, ids []string) ([]Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var transactions []Transaction
+	for _, id := range ids {
+		tx, err := r.transactionByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if tx != nil {
+			transactions = append(transactions, *tx)
+		}
+	}
+	return transactions, nil
+}
+
+// BulkUpsertTransactions writes the transactions, then deletes the ones moved
+// to another statement from the partition of the previous one. An interrupted
+// move leaves a copy behind rather than losing the transaction.
+func (r *DynamoRepo) BulkUpsertTransactions(ctx context.Context, transactions []Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	requests, err := putRequests(transactions)
+	if err != nil {
+		return err
+	}
+	var moved []types.WriteRequest
+	for _, tx := range transactions {
+		previous, err := r.statementOfTransaction(ctx, tx.ID)
+		if err != nil {
+			return err
+		}
+		if previous != "" && previous != tx.StatementID {
+			moved = append(moved, types.WriteRequest{
+				DeleteRequest: &types.DeleteRequest{Key: transactionKey(previous, tx.ID)},
+			})
+		}
+	}
+	if err := r.batchWrite(ctx, requests); err != nil {
+		return err
+	}
+	return r.batchWrite(ctx, moved)
+}
+
+func (r *DynamoRepo) BulkDeleteTransactions(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	requests := make([]types.WriteRequest, 0, len(ids))
+	for _, id := range ids {
+		statementID, err := r.statementOfTransaction(ctx, id)
+		if err != nil {
+			return err
+		}
+		if statementID == "" {
+			continue
+		}
+		requests = append(requests, types.WriteRequest{
+			DeleteRequest: &types.DeleteRequest{Key: transactionKey(statementID, id)},
+		})
+	}
+	return r.batchWrite(ctx, requests)
+}
+
+func putRequests(transactions []Transaction) ([]types.WriteRequest, error) {
+	requests := make([]types.WriteRequest, 0, len(transactions))
+	for i := range transactions {
+		item, err := transactionItem(&transactions[i])
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+	return requests, nil
+}
+
+// batchWrite sends the requests in batches of 25 and resends unprocessed items
+// until the context is done.
+func (r *DynamoRepo) batchWrite(ctx context.Context, requests []types.WriteRequest) error {
+	for start := 0; start < len(requests); start += dynamoBatchSize {
+		pending := requests[start:min(start+dynamoBatchSize, len(requests))]
+		for backoff := 50 * time.Millisecond; len(pending) > 0; backoff *= 2 {
+			out, err := r.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{r.table: pending},
+			})
+			if err != nil {
+				return err
+			}
+			pending = out.UnprocessedItems[r.table]
+			if len(pending) == 0 {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+		}
+	}
+	return nil
+}
+
+// SaveStatementWithDelta writes the statement and its transaction delta in one
+// TransactWriteItems call. DynamoDB caps a transaction at 100 items; larger
+// deltas are written in batches with the statement last, so an interrupted save
+// leaves the previous statement in place and is repaired by re-posting it.
+func (r *DynamoRepo) SaveStatementWithDelta(ctx context.Context, statement *Statement, delta TransactionDelta) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	stmtItem, err := statementItem(statement)
+	if err != nil {
+		return err
+	}
+	requests, err := putRequests(delta.Upserts)
+	if err != nil {
+		return err
+	}
+	for _, id := range delta.Deletes {
+		requests = append(requests, types.WriteRequest{
+			DeleteRequest: &types.DeleteRequest{Key: transactionKey(statement.ID, id)},
+		})
+	}
+
+	if len(requests)+1 > dynamoTransactionSize {
+		if err := r.batchWrite(ctx, requests); err != nil {
+			return err
+		}
+		_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(r.table), Item: stmtItem})
+		return err
+	}
+
+	items := make([]types.TransactWriteItem, 0, len(requests)+1)
+	for _, req := range requests {
+		if req.PutRequest != nil {
+			items = append(items, types.TransactWriteItem{
+				Put: &types.Put{TableName: aws.String(r.table), Item: req.PutRequest.Item},
+			})
+		} else {
+			items = append(items, types.TransactWriteItem{
+				Delete: &types.Delete{TableName: aws.String(r.table), Key: req.DeleteRequest.Key},
+			})
+		}
+	}
+	items = append(items, types.TransactWriteItem{
+		Put: &types.Put{TableName: aws.String(r.table), Item: stmtItem},
+	})
+	_, err = r.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	return err
+}
@@ -0,0 +1,252 @@
+package statements
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeDynamo keeps the items of one table in memory and understands the key
+// conditions and filters DynamoRepo sends.
+type fakeDynamo struct {
+	mu    sync.Mutex
+	items map[string]map[string]types.AttributeValue
+}
+
+func newFakeDynamo() *fakeDynamo {
+	return &fakeDynamo{items: make(map[string]map[string]types.AttributeValue)}
+}
+
+func attrS(item map[string]types.AttributeValue, name string) string {
+	if v, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+func (f *fakeDynamo) key(item map[string]types.AttributeValue) string {
+	return attrS(item, "pk") + "|" + attrS(item, "sk")
+}
+
+// match evaluates "a = :x AND b > :y" conditions against an item.
+func match(item map[string]types.AttributeValue, expr *string, values map[string]types.AttributeValue) bool {
+	if expr == nil {
+		return true
+	}
+	for _, cond := range strings.Split(*expr, " AND ") {
+		parts := strings.Fields(cond)
+		got, want := attrS(item, parts[0]), values[parts[2]].(*types.AttributeValueMemberS).Value
+		if parts[1] == "=" && got != want || parts[1] == ">" && got <= want {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fakeDynamo) GetItem(_ context.Context, in *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &dynamodb.GetItemOutput{Item: f.items[f.key(in.Key)]}, nil
+}
+
+func (f *fakeDynamo) PutItem(_ context.Context, in *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.items[f.key(in.Item)] = in.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamo) DeleteItem(_ context.Context, in *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.items, f.key(in.Key))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (f *fakeDynamo) BatchWriteItem(_ context.Context, in *dynamodb.BatchWriteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, requests := range in.RequestItems {
+		for _, req := range requests {
+			if req.PutRequest != nil {
+				f.items[f.key(req.PutRequest.Item)] = req.PutRequest.Item
+			} else {
+				delete(f.items, f.key(req.DeleteRequest.Key))
+			}
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+func (f *fakeDynamo) TransactWriteItems(_ context.Context, in *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, item := range in.TransactItems {
+		if item.Put != nil {
+			f.items[f.key(item.Put.Item)] = item.Put.Item
+		} else {
+			delete(f.items, f.key(item.Delete.Key))
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (f *fakeDynamo) Query(_ context.Context, in *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sortKey := "sk"
+	if in.IndexName != nil {
+		sortKey = "gsi1sk"
+	}
+	var items []map[string]types.AttributeValue
+	for _, item := range f.items {
+		if match(item, in.KeyConditionExpression, in.ExpressionAttributeValues) {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return attrS(items[i], sortKey) < attrS(items[j], sortKey)
+	})
+	if in.Limit != nil && len(items) > int(*in.Limit) {
+		items = items[:*in.Limit]
+	}
+	return &dynamodb.QueryOutput{Items: items}, nil
+}
+
+func (f *fakeDynamo) Scan(_ context.Context, in *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var items []map[string]types.AttributeValue
+	for _, item := range f.items {
+		if match(item, in.FilterExpression, in.ExpressionAttributeValues) {
+			items = append(items, item)
+		}
+	}
+	return &dynamodb.ScanOutput{Items: items}, nil
+}
+
+func (f *fakeDynamo) indexKeys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for _, item := range f.items {
+		if attrS(item, "entity") == entityTransaction && !slices.Contains(keys, attrS(item, "gsi1pk")) {
+			keys = append(keys, attrS(item, "gsi1pk"))
+		}
+	}
+	return keys
+}
+
+func TestDynamoTransactionsAreShardedAndListedInOrder(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	client := newFakeDynamo()
+	repo := NewDynamoRepo(client, "finchie", time.Second)
+
+	var transactions []Transaction
+	for i := range 40 {
+		transactions = append(transactions, Transaction{
+			ID:          fmt.Sprintf("tx_%02d", i),
+			StatementID: fmt.Sprintf("stmt_%d", i%3),
+			Date:        time.Date(2025, 1, 1+i%28, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	if err := repo.BulkUpsertTransactions(ctx, transactions); err != nil {
+		t.Fatalf("BulkUpsertTransactions() error = %v", err)
+	}
+	if keys := client.indexKeys(); len(keys) < 2 || slices.Contains(keys, legacyTransactionGSIPK) {
+		t.Errorf("index keys = %v, want the transactions spread over the shards", keys)
+	}
+
+	var ids []string
+	for after := ""; ; {
+		page, err := repo.ListTransactions(ctx, TransactionFilter{}, Page{Limit: 7, After: after})
+		if err != nil {
+			t.Fatalf("ListTransactions() error = %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, tx := range page {
+			ids = append(ids, tx.ID)
+		}
+		after = page[len(page)-1].ID
+	}
+	if len(ids) != len(transactions) || !slices.IsSorted(ids) {
+		t.Errorf("paged IDs = %v, want all %d in order", ids, len(transactions))
+	}
+
+	if err := repo.DeleteTransaction(ctx, "tx_05"); err != nil {
+		t.Fatalf("DeleteTransaction() error = %v", err)
+	}
+	if got, _ := repo.GetTransactions(ctx, "stmt_2"); slices.ContainsFunc(got, func(tx Transaction) bool { return tx.ID == "tx_05" }) {
+		t.Error("tx_05 is still stored after DeleteTransaction")
+	}
+}
+
+func TestDynamoReshardsLegacyTransactions(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	client := newFakeDynamo()
+	repo := NewDynamoRepo(client, "finchie", time.Second)
+
+	item, err := transactionItem(&Transaction{ID: "tx_1", StatementID: "stmt_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item["gsi1pk"] = &types.AttributeValueMemberS{Value: legacyTransactionGSIPK}
+	if _, err := client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String("finchie"), Item: item}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.reshardTransactions(ctx); err != nil {
+		t.Fatalf("reshardTransactions() error = %v", err)
+	}
+	if keys := client.indexKeys(); !slices.Equal(keys, []string{transactionGSIPK("tx_1")}) {
+		t.Errorf("index keys = %v, want the shard of tx_1", keys)
+	}
+	if got, err := repo.FindTransactions(ctx, TransactionFilter{}); err != nil || len(got) != 1 {
+		t.Errorf("FindTransactions() = %v, %v, want tx_1", got, err)
+	}
+}
+
+func TestDynamoMovedTransactionLeavesNoCopyBehind(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	repo := NewDynamoRepo(newFakeDynamo(), "finchie", time.Second)
+
+	if err := repo.UpsertTransaction(ctx, &Transaction{ID: "tx_1", StatementID: "stmt_1"}); err != nil {
+		t.Fatalf("UpsertTransaction() error = %v", err)
+	}
+	if err := repo.UpsertTransaction(ctx, &Transaction{ID: "tx_1", StatementID: "stmt_2"}); err != nil {
+		t.Fatalf("UpsertTransaction(moved) error = %v", err)
+	}
+	if err := repo.BulkUpsertTransactions(ctx, []Transaction{{ID: "tx_1", StatementID: "stmt_3"}}); err != nil {
+		t.Fatalf("BulkUpsertTransactions(moved) error = %v", err)
+	}
+
+	for statementID, want := range map[string]int{"stmt_1": 0, "stmt_2": 0, "stmt_3": 1} {
+		got, err := repo.GetTransactions(ctx, statementID)
+		if err != nil {
+			t.Fatalf("GetTransactions(%s) error = %v", statementID, err)
+		}
+		if len(got) != want {
+			t.Errorf("GetTransactions(%s) = %d transactions, want %d", statementID, len(got), want)
+		}
+	}
+	if got, _ := repo.FindTransactions(ctx, TransactionFilter{}); len(got) != 1 || got[0].StatementID != "stmt_3" {
+		t.Errorf("FindTransactions() = %v, want tx_1 of stmt_3 only", got)
+	}
+}
@@ -0,0 +1,129 @@
+package statements
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+// ClientEncryptedPrefix marks a value the client encrypted before sending it,
+// as e2e:<key id>:<base64 ciphertext>. The server stores it as it is and never
+// holds the key; how the client encrypts is up to the client.
+const ClientEncryptedPrefix = "e2e:"
+
+const (
+	maxBlindIndexes     = 32
+	maxBlindIndexLength = 128
+)
+
+// E2EMode is whether statements may or must arrive encrypted by the client,
+// for hosted instances whose operator should not read transaction details.
+type E2EMode string
+
+const (
+	// E2EOff stores e2e: values like any other text.
+	E2EOff E2EMode = "off"
+	// E2EOptional accepts client-encrypted values and rejects malformed ones.
+	E2EOptional E2EMode = "optional"
+	// E2ERequired also rejects plaintext in the fields clients encrypt: the
+	// description, merchant city and extra of transactions and the extra of
+	// statements.
+	E2ERequired E2EMode = "required"
+)
+
+var ErrClientEncryption = apierror.New(apierror.KindInvalid, "invalid_client_encryption", "invalid client-side encryption")
+
+// E2EModeFromEnv reads E2E_ENCRYPTION, off by default.
+func E2EModeFromEnv() (E2EMode, error) {
+	switch mode := E2EMode(strings.ToLower(os.Getenv("E2E_ENCRYPTION"))); mode {
+	case "", E2EOff:
+		return E2EOff, nil
+	case E2EOptional, E2ERequired:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid E2E_ENCRYPTION %q, expected off, optional or required", mode)
+	}
+}
+
+// IsClientEncrypted reports whether a value was encrypted by the client. The
+// server cannot match, normalize or categorize such values.
+func IsClientEncrypted(value string) bool {
+	return strings.HasPrefix(value, ClientEncryptedPrefix)
+}
+
+func checkClientEncrypted(field, value string, required bool) error {
+	if !IsClientEncrypted(value) {
+		if required && value != "" {
+			return fmt.Errorf("%w: %s is not encrypted", ErrClientEncryption, field)
+		}
+		return nil
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, ClientEncryptedPrefix), ":")
+	if !ok || id == "" || encoded == "" {
+		return fmt.Errorf("%w: %s is not e2e:<key id>:<base64 ciphertext>", ErrClientEncryption, field)
+	}
+	if _, err := base64.StdEncoding.DecodeString(encoded); err != nil {
+		return fmt.Errorf("%w: %s ciphertext is not base64", ErrClientEncryption, field)
+	}
+	return nil
+}
+
+func checkClientEncryptedExtra(field string, extra any, required bool) error {
+	if extra == nil {
+		return nil
+	}
+	s, ok := extra.(string)
+	if !ok {
+		if required {
+			return fmt.Errorf("%w: %s is not encrypted", ErrClientEncryption, field)
+		}
+		return nil
+	}
+	return checkClientEncrypted(field, s, required)
+}
+
+// checkE2E validates the client-encrypted values and blind indexes of a
+// statement, and rejects plaintext in E2ERequired mode.
+func (s *StatementService) checkE2E(statement *Statement) error {
+	if s.E2E == "" || s.E2E == E2EOff {
+		return nil
+	}
+	required := s.E2E == E2ERequired
+	if err := checkClientEncryptedExtra("extra", statement.Extra, required); err != nil {
+		return err
+	}
+	if statement.Transactions == nil {
+		return nil
+	}
+	for i, tx := range *statement.Transactions {
+		err := checkClientEncrypted("description", tx.Description, required)
+		if err == nil {
+			err = checkClientEncrypted("merchant_city", tx.MerchantCity, required)
+		}
+		if err == nil {
+			err = checkClientEncryptedExtra("extra", tx.Extra, required)
+		}
+		if err == nil {
+			err = checkBlindIndexes(tx.BlindIndexes)
+		}
+		if err != nil {
+			return fmt.Errorf("transaction at index %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func checkBlindIndexes(tokens []string) error {
+	if len(tokens) > maxBlindIndexes {
+		return fmt.Errorf("%w: more than %d blind indexes", ErrClientEncryption, maxBlindIndexes)
+	}
+	for _, token := range tokens {
+		if token == "" || len(token) > maxBlindIndexLength {
+			return fmt.Errorf("%w: blind indexes are 1 to %d characters", ErrClientEncryption, maxBlindIndexLength)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,523 @@
+package statements
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Fields that can be encrypted at rest, as named in ENCRYPTED_FIELDS.
+const (
+	FieldStatementSourceID = "statement.source_id"
+	FieldStatementExtra    = "statement.extra"
+	FieldTransactionExtra  = "transaction.extra"
+)
+
+var encryptableFields = []string{FieldStatementSourceID, FieldStatementExtra, FieldTransactionExtra}
+
+// encryptedPrefix marks stored values as enc:<key id>:<base64 nonce+ciphertext>.
+const encryptedPrefix = "enc:"
+
+var ErrUnknownKey = errors.New("unknown field encryption key")
+
+// KeyProvider supplies the field encryption keys by ID, along with the ID of
+// the one new values are encrypted with. Keys are 32 bytes for AES-256; a KMS
+// implementation would return data keys it unwrapped.
+type KeyProvider interface {
+	Keys(ctx context.Context) (current string, keys map[string][]byte, err error)
+}
+
+// EnvKeyProvider reads FIELD_ENCRYPTION_KEYS, comma separated <id>:<base64 key>
+// pairs with the current key first. Older keys stay listed until the
+// reencrypt command has moved every value off them.
+type EnvKeyProvider struct{}
+
+func (EnvKeyProvider) Keys(ctx context.Context) (string, map[string][]byte, error) {
+	current, keys := "", map[string][]byte{}
+	for _, pair := range strings.Split(os.Getenv("FIELD_ENCRYPTION_KEYS"), ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || id == "" {
+			return "", nil, fmt.Errorf("invalid FIELD_ENCRYPTION_KEYS entry %q, expected <id>:<base64 key>", pair)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid field encryption key %s: %w", id, err)
+		}
+		if current == "" {
+			current = id
+		}
+		keys[id] = key
+	}
+	return current, keys, nil
+}
+
+// IndexKeyProvider is implemented by key providers that supply the blind
+// index key, required when source IDs are encrypted. Unlike the encryption
+// keys it is never rotated: the unique source index and the statement IDs are
+// derived from it.
+type IndexKeyProvider interface {
+	IndexKey(ctx context.Context) ([]byte, error)
+}
+
+// IndexKey reads FIELD_BLIND_INDEX_KEY, a base64 key of at least 32 bytes.
+func (EnvKeyProvider) IndexKey(ctx context.Context) ([]byte, error) {
+	encoded := os.Getenv("FIELD_BLIND_INDEX_KEY")
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FIELD_BLIND_INDEX_KEY: %w", err)
+	}
+	return key, nil
+}
+
+// FieldCipher encrypts designated fields with AES-GCM and random nonces. The
+// field name is the additional data, so a value cannot be moved to another
+// field. Equal source IDs share a blind index, an HMAC under the index key,
+// which the unique source index is built on, so it survives key rotation.
+type FieldCipher struct {
+	current string
+	aeads   map[string]cipher.AEAD
+	index   []byte
+	fields  map[string]bool
+}
+
+func NewFieldCipher(ctx context.Context, provider KeyProvider, fields []string) (*FieldCipher, error) {
+	current, keys, err := provider.Keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("%w: current key %q", ErrUnknownKey, current)
+	}
+
+	c := &FieldCipher{current: current, aeads: map[string]cipher.AEAD{}, fields: map[string]bool{}}
+	for id, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("field encryption key %s has %d bytes, AES-256 needs 32", id, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if c.aeads[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	for _, field := range fields {
+		if !contains(encryptableFields, field) {
+			return nil, fmt.Errorf("unknown encrypted field %q, expected one of %s", field, strings.Join(encryptableFields, ", "))
+		}
+		c.fields[field] = true
+	}
+	if c.fields[FieldStatementSourceID] {
+		if p, ok := provider.(IndexKeyProvider); ok {
+			if c.index, err = p.IndexKey(ctx); err != nil {
+				return nil, err
+			}
+		}
+		if len(c.index) < 32 {
+			return nil, fmt.Errorf("encrypting %s needs a blind index key of at least 32 bytes, e.g. FIELD_BLIND_INDEX_KEY", FieldStatementSourceID)
+		}
+	}
+	return c, nil
+}
+
+// sourceIndex returns the blind index of a plaintext source ID.
+func (c *FieldCipher) sourceIndex(sourceID string) string {
+	mac := hmac.New(sha256.New, c.index)
+	mac.Write([]byte(FieldStatementSourceID + "\x00"))
+	mac.Write([]byte(sourceID))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *FieldCipher) encrypt(field string, plaintext []byte) string {
+	aead := c.aeads[c.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(field))
+	return encryptedPrefix + c.current + ":" + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// decrypt returns the plaintext of an encrypted value; values stored before
+// encryption was enabled are returned as they are.
+func (c *FieldCipher) decrypt(field, value string) ([]byte, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return []byte(value), nil
+	}
+	id, encoded, _ := strings.Cut(strings.TrimPrefix(value, encryptedPrefix), ":")
+	aead, ok := c.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q in %s", ErrUnknownKey, id, field)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("malformed encrypted %s", field)
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(field))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: %w", field, err)
+	}
+	return plaintext, nil
+}
+
+func isEncrypted(value any) bool {
+	s, ok := value.(string)
+	return ok && strings.HasPrefix(s, encryptedPrefix)
+}
+
+// stale reports whether a designated value still needs encrypting with the
+// current key.
+func (c *FieldCipher) stale(value any) bool {
+	if value == nil {
+		return false
+	}
+	s, ok := value.(string)
+	return !ok || !strings.HasPrefix(s, encryptedPrefix+c.current+":")
+}
+
+func (c *FieldCipher) encryptExtra(field string, extra any) (any, error) {
+	if !c.fields[field] || extra == nil || isEncrypted(extra) {
+		return extra, nil
+	}
+	data, err := json.Marshal(plainValue(extra))
+	if err != nil {
+		return nil, fmt.Errorf("encode %s: %w", field, err)
+	}
+	return c.encrypt(field, data), nil
+}
+
+func (c *FieldCipher) decryptExtra(field string, extra any) (any, error) {
+	if !isEncrypted(extra) {
+		return extra, nil
+	}
+	data, err := c.decrypt(field, extra.(string))
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", field, err)
+	}
+	return value, nil
+}
+
+// plainValue turns the documents the Mongo driver decodes into an any field
+// into maps and slices, so they encode as JSON objects.
+func plainValue(v any) any {
+	switch v := v.(type) {
+	case primitive.D:
+		m := make(map[string]any, len(v))
+		for _, e := range v {
+			m[e.Key] = plainValue(e.Value)
+		}
+		return m
+	case primitive.M:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = plainValue(e)
+		}
+		return m
+	case primitive.A:
+		a := make([]any, len(v))
+		for i, e := range v {
+			a[i] = plainValue(e)
+		}
+		return a
+	}
+	return v
+}
+
+func (c *FieldCipher) encryptStatement(stmt *Statement) error {
+	if c.fields[FieldStatementSourceID] && stmt.SourceID != nil && !isEncrypted(*stmt.SourceID) {
+		stmt.SourceIndex = c.sourceIndex(*stmt.SourceID)
+		v := c.encrypt(FieldStatementSourceID, []byte(*stmt.SourceID))
+		stmt.SourceID = &v
+	}
+	var err error
+	if stmt.Extra, err = c.encryptExtra(FieldStatementExtra, stmt.Extra); err != nil {
+		return err
+	}
+	if stmt.Transactions != nil {
+		txs := append([]Transaction(nil), *stmt.Transactions...)
+		for i := range txs {
+			if err := c.encryptTransaction(&txs[i]); err != nil {
+				return err
+			}
+		}
+		stmt.Transactions = &txs
+	}
+	return nil
+}
+
+func (c *FieldCipher) decryptStatement(stmt *Statement) error {
+	if stmt.SourceID != nil {
+		v, err := c.decrypt(FieldStatementSourceID, *stmt.SourceID)
+		if err != nil {
+			return err
+		}
+		s := string(v)
+		stmt.SourceID = &s
+	}
+	var err error
+	if stmt.Extra, err = c.decryptExtra(FieldStatementExtra, stmt.Extra); err != nil {
+		return err
+	}
+	if stmt.Transactions != nil {
+		txs := append([]Transaction(nil), *stmt.Transactions...)
+		for i := range txs {
+			if err := c.decryptTransaction(&txs[i]); err != nil {
+				return err
+			}
+		}
+		stmt.Transactions = &txs
+	}
+	return nil
+}
+
+func (c *FieldCipher) encryptTransaction(tx *Transaction) (err error) {
+	tx.Extra, err = c.encryptExtra(FieldTransactionExtra, tx.Extra)
+	return err
+}
+
+func (c *FieldCipher) decryptTransaction(tx *Transaction) (err error) {
+	tx.Extra, err = c.decryptExtra(FieldTransactionExtra, tx.Extra)
+	return err
+}
+
+// EncryptedRepo encrypts the designated fields on the way in and decrypts
+// every encrypted field on the way out, so the layers below, their caches,
+// audit log and backups included, only see ciphertext.
+type EncryptedRepo struct {
+	StatementRepository
+	cipher *FieldCipher
+}
+
+func NewEncryptedRepo(repo StatementRepository, cipher *FieldCipher) *EncryptedRepo {
+	return &EncryptedRepo{StatementRepository: repo, cipher: cipher}
+}
+
+// EncryptionFromEnv wraps repo when FIELD_ENCRYPTION_KEYS is set, encrypting
+// the ENCRYPTED_FIELDS, all of them by default.
+func EncryptionFromEnv(repo StatementRepository) (StatementRepository, error) {
+	if os.Getenv("FIELD_ENCRYPTION_KEYS") == "" {
+		return repo, nil
+	}
+	fields := encryptableFields
+	if v := os.Getenv("ENCRYPTED_FIELDS"); v != "" {
+		fields = strings.Split(v, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+	}
+	c, err := NewFieldCipher(context.Background(), EnvKeyProvider{}, fields)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Field encryption enabled", "key", c.current, "fields", fields)
+	return NewEncryptedRepo(repo, c), nil
+}
+
+func (r *EncryptedRepo) Unwrap() StatementRepository {
+	return r.StatementRepository
+}
+
+func (r *EncryptedRepo) Describe() map[string]string {
+	if d, ok := r.StatementRepository.(Describer); ok {
+		return d.Describe()
+	}
+	return nil
+}
+
+func (r *EncryptedRepo) GetStatement(ctx context.Context, id string) (*Statement, error) {
+	stmt, err := r.StatementRepository.GetStatement(ctx, id)
+	if err != nil || stmt == nil {
+		return stmt, err
+	}
+	// the layer below may hand out the statement it keeps
+	decrypted := *stmt
+	if err := r.cipher.decryptStatement(&decrypted); err != nil {
+		return nil, err
+	}
+	return &decrypted, nil
+}
+
+func (r *EncryptedRepo) ListStatements(ctx context.Context, filter StatementFilter) ([]Statement, error) {
+	stmts, err := r.StatementRepository.ListStatements(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for i := range stmts {
+		if err := r.cipher.decryptStatement(&stmts[i]); err != nil {
+			return nil, err
+		}
+	}
+	return stmts, nil
+}
+
+func (r *EncryptedRepo) UpsertStatement(ctx context.Context, statement *Statement) error {
+	encrypted := *statement
+	if err := r.cipher.encryptStatement(&encrypted); err != nil {
+		return err
+	}
+	return r.StatementRepository.UpsertStatement(ctx, &encrypted)
+}
+
+func (r *EncryptedRepo) decryptTransactions(txs []Transaction, err error) ([]Transaction, error) {
+	if err != nil {
+		return nil, err
+	}
+	for i := range txs {
+		if err := r.cipher.decryptTransaction(&txs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return txs, nil
+}
+
+func (r *EncryptedRepo) encryptTransactions(txs []Transaction) ([]Transaction, error) {
+	encrypted := append([]Transaction(nil), txs...)
+	for i := range encrypted {
+		if err := r.cipher.encryptTransaction(&encrypted[i]); err != nil {
+			return nil, err
+		}
+	}
+	return encrypted, nil
+}
+
+func (r *EncryptedRepo) GetTransactions(ctx context.Context, statementID string) ([]Transaction, error) {
+	return r.decryptTransactions(r.StatementRepository.GetTransactions(ctx, statementID))
+}
+
+func (r *EncryptedRepo) ListTransactions(ctx context.Context, filter TransactionFilter, page Page) ([]Transaction, error) {
+	return r.decryptTransactions(r.StatementRepository.ListTransactions(ctx, filter, page))
+}
+
+func (r *EncryptedRepo) FindTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error) {
+	return r.decryptTransactions(r.StatementRepository.FindTransactions(ctx, filter))
+}
+
+// TransactionsByID resolves the transactions of the layers below, decrypted.
+func (r *EncryptedRepo) TransactionsByID(ctx context.Context, ids []string) ([]Transaction, error) {
+	return r.decryptTransactions(transactionsByID(ctx, r.StatementRepository, ids))
+}
+
+func (r *EncryptedRepo) UpsertTransaction(ctx context.Context, tx *Transaction) error {
+	encrypted := *tx
+	if err := r.cipher.encryptTransaction(&encrypted); err != nil {
+		return err
+	}
+	return r.StatementRepository.UpsertTransaction(ctx, &encrypted)
+}
+
+func (r *EncryptedRepo) BulkUpsertTransactions(ctx context.Context, transactions []Transaction) error {
+	encrypted, err := r.encryptTransactions(transactions)
+	if err != nil {
+		return err
+	}
+	return r.StatementRepository.BulkUpsertTransactions(ctx, encrypted)
+}
+
+func (r *EncryptedRepo) SaveStatementWithDelta(ctx context.Context, statement *Statement, delta TransactionDelta) error {
+	encrypted := *statement
+	if err := r.cipher.encryptStatement(&encrypted); err != nil {
+		return err
+	}
+	upserts, err := r.encryptTransactions(delta.Upserts)
+	if err != nil {
+		return err
+	}
+	return r.StatementRepository.SaveStatementWithDelta(ctx, &encrypted, TransactionDelta{Upserts: upserts, Deletes: delta.Deletes})
+}
+
+// Reencrypt rewrites every statement and transaction whose designated fields
+// are plaintext or encrypted with an older key, or whose source ID lacks its
+// blind index, and returns how many it rewrote. Archived statements are not visited.
+func (r *EncryptedRepo) Reencrypt(ctx context.Context) (statements, transactions int, err error) {
+	c := r.cipher
+	stored, err := r.StatementRepository.ListStatements(ctx, StatementFilter{})
+	if err != nil {
+		return 0, 0, err
+	}
+	for i := range stored {
+		stmt := &stored[i]
+		if c.fields[FieldStatementSourceID] && stmt.SourceID != nil && (c.stale(*stmt.SourceID) || stmt.SourceIndex == "") ||
+			c.fields[FieldStatementExtra] && c.stale(stmt.Extra) {
+			if err := c.decryptStatement(stmt); err != nil {
+				return statements, transactions, fmt.Errorf("statement %s: %w", stmt.ID, err)
+			}
+			if err := r.UpsertStatement(ctx, stmt); err != nil {
+				return statements, transactions, fmt.Errorf("statement %s: %w", stmt.ID, err)
+			}
+			statements++
+		}
+
+		if !c.fields[FieldTransactionExtra] {
+			continue
+		}
+		txs, err := r.StatementRepository.GetTransactions(ctx, stmt.ID)
+		if err != nil {
+			return statements, transactions, err
+		}
+		var changed []Transaction
+		for _, tx := range txs {
+			if c.stale(tx.Extra) {
+				if err := c.decryptTransaction(&tx); err != nil {
+					return statements, transactions, fmt.Errorf("transaction %s: %w", tx.ID, err)
+				}
+				changed = append(changed, tx)
+			}
+		}
+		if len(changed) > 0 {
+			if err := r.BulkUpsertTransactions(ctx, changed); err != nil {
+				return statements, transactions, err
+			}
+			transactions += len(changed)
+		}
+	}
+	return statements, transactions, nil
+}
+
+// SourceIndex returns the blind index of a plaintext source ID, when source
+// IDs are encrypted.
+func (r *EncryptedRepo) SourceIndex(sourceID string) (string, bool) {
+	if !r.cipher.fields[FieldStatementSourceID] {
+		return "", false
+	}
+	return r.cipher.sourceIndex(sourceID), true
+}
+
+// AsEncryptedRepo unwraps repository decorators down to the encrypting one.
+func AsEncryptedRepo(repo StatementRepository) (*EncryptedRepo, bool) {
+	for _, layer := range Layers(repo) {
+		if e, ok := layer.(*EncryptedRepo); ok {
+			return e, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,168 @@
+package statements
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Enricher adds to a statement at ingest, e.g. the categories or the merchant
+// names of its transactions. It runs after normalization, before the statement
+// is stored.
+type Enricher interface {
+	Enrich(ctx context.Context, statement *Statement) error
+}
+
+// EnricherFactory builds an enricher from the config of its ENRICHERS_FILE
+// entry, null when there is none. Enrichers register themselves from an init
+// function in the file implementing them.
+type EnricherFactory func(config json.RawMessage) (Enricher, error)
+
+var (
+	enrichersMu sync.RWMutex
+	enrichers   = make(map[string]EnricherFactory)
+)
+
+// RegisterEnricher makes an enricher usable in ENRICHERS_FILE. It panics when
+// the name is already taken, like RegisterDriver.
+func RegisterEnricher(name string, factory EnricherFactory) {
+	enrichersMu.Lock()
+	defer enrichersMu.Unlock()
+
+	if factory == nil {
+		panic("statements: RegisterEnricher factory is nil")
+	}
+	if _, dup := enrichers[name]; dup {
+		panic("statements: RegisterEnricher called twice for enricher " + name)
+	}
+	enrichers[name] = factory
+}
+
+// Enrichers returns the names of the registered enrichers.
+func Enrichers() []string {
+	enrichersMu.RLock()
+	defer enrichersMu.RUnlock()
+
+	names := make([]string, 0, len(enrichers))
+	for name := range enrichers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+const defaultEnricherTimeout = time.Second
+
+// EnricherStep is a configured enricher in the ingest pipeline.
+type EnricherStep struct {
+	Name     string
+	Enricher Enricher
+	Timeout  time.Duration
+}
+
+// EnrichersFromEnv builds the pipeline in ENRICHERS_FILE, a JSON list run in
+// order, e.g. [{"name": "categorizer", "timeout_ms": 500, "config": {...}}].
+// Entries with "enabled": false are skipped. Without the file nothing runs.
+func EnrichersFromEnv() ([]EnricherStep, error) {
+	path := os.Getenv("ENRICHERS_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []struct {
+		Name      string          `json:"name"`
+		Enabled   *bool           `json:"enabled"`
+		TimeoutMS int             `json:"timeout_ms"`
+		Config    json.RawMessage `json:"config"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid enrichers %s: %w", path, err)
+	}
+
+	var steps []EnricherStep
+	for i, entry := range entries {
+		if entry.Enabled != nil && !*entry.Enabled {
+			continue
+		}
+		enrichersMu.RLock()
+		factory, ok := enrichers[entry.Name]
+		enrichersMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown enricher %q in entry %d, registered: %v", entry.Name, i, Enrichers())
+		}
+		enricher, err := factory(entry.Config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config of enricher %s: %w", entry.Name, err)
+		}
+		step := EnricherStep{Name: entry.Name, Enricher: enricher, Timeout: defaultEnricherTimeout}
+		if entry.TimeoutMS > 0 {
+			step.Timeout = time.Duration(entry.TimeoutMS) * time.Millisecond
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// enrich runs the enrichers in order. Each works on a copy of the statement
+// that is only kept when it returns in time without an error or a panic, so a
+// failing enricher is skipped and never blocks ingestion.
+func (s *StatementService) enrich(ctx context.Context, statement *Statement) {
+	for _, step := range s.Enrichers {
+		enriched, err := runEnricher(ctx, step, statement)
+		if err != nil {
+			slog.Warn("Enricher failed, skipping it", "enricher", step.Name, "id", statement.ID, "error", err)
+			continue
+		}
+		*statement = *enriched
+	}
+}
+
+func runEnricher(ctx context.Context, step EnricherStep, statement *Statement) (*Statement, error) {
+	ctx, cancel := context.WithTimeout(ctx, step.Timeout)
+	defer cancel()
+
+	working := enrichmentCopy(statement)
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- step.Enricher.Enrich(ctx, working)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+		return working, nil
+	case <-ctx.Done():
+		// the enricher may still be writing to working, it is dropped
+		return nil, ctx.Err()
+	}
+}
+
+// enrichmentCopy copies the statement and the fields of its transactions an
+// enricher may change in place.
+func enrichmentCopy(statement *Statement) *Statement {
+	c := *statement
+	if statement.Transactions != nil {
+		txs := make([]Transaction, len(*statement.Transactions))
+		copy(txs, *statement.Transactions)
+		for i := range txs {
+			txs[i].ExternalRefs = append([]ExternalRef(nil), txs[i].ExternalRefs...)
+		}
+		c.Transactions = &txs
+	}
+	return &c
+}
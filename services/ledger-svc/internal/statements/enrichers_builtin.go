@@ -0,0 +1,125 @@
+package statements
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	RegisterEnricher("categorizer", newCategorizer)
+	RegisterEnricher("merchant_normalizer", newMerchantNormalizer)
+}
+
+type patternRule struct {
+	pattern *regexp.Regexp
+	value   string
+}
+
+// compileRules compiles the pattern of each rule, value naming the field the
+// rule sets.
+func compileRules(raw []map[string]string, value string) ([]patternRule, error) {
+	rules := make([]patternRule, len(raw))
+	for i, r := range raw {
+		pattern, err := regexp.Compile(r["pattern"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of rule %d: %w", i, err)
+		}
+		if r[value] == "" {
+			return nil, fmt.Errorf("rule %d has no %s", i, value)
+		}
+		rules[i] = patternRule{pattern: pattern, value: r[value]}
+	}
+	return rules, nil
+}
+
+// categorizer sets the category of the transactions matching the description
+// patterns, the first matching rule winning. Categories from the fetcher are
+// kept unless overwrite is set. Config:
+//
+//	{"rules": [{"pattern": "(?i)uber|taxi", "category": "Transport"}], "overwrite": false}
+type categorizer struct {
+	rules     []patternRule
+	overwrite bool
+}
+
+func newCategorizer(config json.RawMessage) (Enricher, error) {
+	var cfg struct {
+		Rules     []map[string]string `json:"rules"`
+		Overwrite bool                `json:"overwrite"`
+	}
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Rules) == 0 {
+		return nil, errors.New("no rules")
+	}
+	rules, err := compileRules(cfg.Rules, "category")
+	if err != nil {
+		return nil, err
+	}
+	return &categorizer{rules: rules, overwrite: cfg.Overwrite}, nil
+}
+
+func (c *categorizer) Enrich(ctx context.Context, statement *Statement) error {
+	for i := range *statement.Transactions {
+		tx := &(*statement.Transactions)[i]
+		if (tx.Category != "" && !c.overwrite) || IsClientEncrypted(tx.Description) {
+			continue
+		}
+		for _, rule := range c.rules {
+			if rule.pattern.MatchString(tx.Description) {
+				tx.Category = rule.value
+				break
+			}
+		}
+	}
+	return nil
+}
+
+var descriptionSpace = regexp.MustCompile(`\s+`)
+
+// merchantNormalizer collapses the whitespace of the descriptions and renames
+// the ones matching an alias, the first matching alias winning. External
+// references are extracted from the descriptions as fetched. Config:
+//
+//	{"aliases": [{"pattern": "(?i)^amzn mktp", "name": "Amazon"}]}
+type merchantNormalizer struct {
+	aliases []patternRule
+}
+
+func newMerchantNormalizer(config json.RawMessage) (Enricher, error) {
+	var cfg struct {
+		Aliases []map[string]string `json:"aliases"`
+	}
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	aliases, err := compileRules(cfg.Aliases, "name")
+	if err != nil {
+		return nil, err
+	}
+	return &merchantNormalizer{aliases: aliases}, nil
+}
+
+func (m *merchantNormalizer) Enrich(ctx context.Context, statement *Statement) error {
+	for i := range *statement.Transactions {
+		tx := &(*statement.Transactions)[i]
+		if IsClientEncrypted(tx.Description) {
+			continue
+		}
+		tx.Description = descriptionSpace.ReplaceAllString(strings.TrimSpace(tx.Description), " ")
+		for _, alias := range m.aliases {
+			if alias.pattern.MatchString(tx.Description) {
+				tx.Description = alias.value
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package statements
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrUnscopedErasure = errors.New("erasing needs a context scoped to the user")
+
+// Erased is what EraseOwned deleted.
+type Erased struct {
+	// StatementIDs and TransactionIDs are the archived ones.
+	StatementIDs   []string
+	TransactionIDs []string
+	Events         int
+}
+
+// OwnerEraser is implemented by repositories keeping data of an owner beyond
+// what ListStatements and FindTransactions return.
+type OwnerEraser interface {
+	// EraseOwned deletes the archived statements and transactions of the
+	// owner ctx is scoped to, and the change events carrying their data: the
+	// events naming the owner, or one of statementIDs for the events recorded
+	// before events named their owner. Events without data, e.g. of the
+	// deletes, are kept for the subscribers.
+	EraseOwned(ctx context.Context, statementIDs []string) (Erased, error)
+}
+
+// AsOwnerEraser unwraps repository decorators down to the one keeping the
+// archive and the outbox.
+func AsOwnerEraser(repo StatementRepository) (OwnerEraser, bool) {
+	for _, layer := range Layers(repo) {
+		if e, ok := layer.(OwnerEraser); ok {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// erasable reports whether EraseOwned deletes the event.
+func (e *ChangeEvent) erasable(ctx context.Context, statementIDs map[string]bool) bool {
+	if e.Statement == nil && e.Transaction == nil {
+		return false
+	}
+	return e.UserID != "" && Owns(ctx, e.TenantID, e.UserID) || statementIDs[e.StatementID]
+}
@@ -0,0 +1,148 @@
+package statements
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+var ErrTransactionNotFound = apierror.New(apierror.KindNotFound, "transaction_not_found", "transaction not found")
+
+// ExternalRef links a transaction to a record in another system, e.g. an
+// order number, invoice ID or booking reference.
+type ExternalRef struct {
+	Type  string `bson:"type" json:"type"`
+	Value string `bson:"value" json:"value"`
+}
+
+// normalizeExternalRefs lowercases the types, trims the values and drops
+// empty and repeated references.
+func normalizeExternalRefs(refs []ExternalRef) []ExternalRef {
+	if len(refs) == 0 {
+		return nil
+	}
+	seen := make(map[ExternalRef]bool, len(refs))
+	result := refs[:0]
+	for _, ref := range refs {
+		ref = ExternalRef{Type: strings.ToLower(strings.TrimSpace(ref.Type)), Value: strings.TrimSpace(ref.Value)}
+		if ref.Type == "" || ref.Value == "" || seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		result = append(result, ref)
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// HasExternalRef reports whether the transaction carries value, of refType
+// when it is not empty.
+func (bd *Transaction) HasExternalRef(refType, value string) bool {
+	for _, ref := range bd.ExternalRefs {
+		if ref.Value == value && (refType == "" || strings.EqualFold(ref.Type, refType)) {
+			return true
+		}
+	}
+	return false
+}
+
+// RefRule extracts a reference of Type from transaction descriptions: the
+// first capture group of Pattern, or the whole match without one.
+type RefRule struct {
+	Type    string         `json:"type"`
+	Pattern *regexp.Regexp `json:"-"`
+}
+
+// RefRulesFromEnv reads the JSON rules in EXTERNAL_REF_RULES_FILE, e.g.
+// [{"type": "order", "pattern": "(?i)order #?(\\d{3}-\\d{7}-\\d{7})"}].
+func RefRulesFromEnv() ([]RefRule, error) {
+	path := os.Getenv("EXTERNAL_REF_RULES_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw []struct {
+		Type    string `json:"type"`
+		Pattern string `json:"pattern"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid external reference rules %s: %w", path, err)
+	}
+
+	rules := make([]RefRule, len(raw))
+	for i, r := range raw {
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of external reference rule %d: %w", i, err)
+		}
+		if r.Type == "" {
+			return nil, fmt.Errorf("external reference rule %d has no type", i)
+		}
+		rules[i] = RefRule{Type: r.Type, Pattern: pattern}
+	}
+	return rules, nil
+}
+
+// applyRefRules adds the references the rules find in the description to the
+// ones the transaction already has.
+func applyRefRules(rules []RefRule, tx *Transaction) {
+	if IsClientEncrypted(tx.Description) {
+		return
+	}
+	for _, rule := range rules {
+		match := rule.Pattern.FindStringSubmatch(tx.Description)
+		if match == nil {
+			continue
+		}
+		value := match[0]
+		if len(match) > 1 {
+			value = match[1]
+		}
+		tx.ExternalRefs = append(tx.ExternalRefs, ExternalRef{Type: rule.Type, Value: value})
+	}
+	tx.ExternalRefs = normalizeExternalRefs(tx.ExternalRefs)
+}
+
+// SetExternalRefs replaces the references of a transaction of the statement.
+func (s *StatementService) SetExternalRefs(ctx context.Context, statementID, transactionID string, refs []ExternalRef) (*Transaction, error) {
+	txs, err := s.Repo.GetTransactions(ctx, statementID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range txs {
+		if txs[i].ID != transactionID {
+			continue
+		}
+		tx := txs[i]
+		tx.ExternalRefs = normalizeExternalRefs(refs)
+		return &tx, s.Repo.UpsertTransaction(ctx, &tx)
+	}
+	return nil, ErrTransactionNotFound
+}
+
+// linkExternalRefs applies the rules to the desired transactions and keeps
+// the references stored on them, so a re-post does not drop the ones set
+// through the API.
+func (s *StatementService) linkExternalRefs(current, desired []Transaction) {
+	stored := make(map[string][]ExternalRef, len(current))
+	for _, tx := range current {
+		if len(tx.ExternalRefs) > 0 {
+			stored[tx.ID] = tx.ExternalRefs
+		}
+	}
+	for i := range desired {
+		tx := &desired[i]
+		tx.ExternalRefs = append(tx.ExternalRefs, stored[tx.ID]...)
+		applyRefRules(s.RefRules, tx)
+	}
+}
@@ -0,0 +1,66 @@
+package statements
+
+import (
+	"context"
+	"sort"
+)
+
+type FeeSummary struct {
+	SourceName      string             `json:"source_name"`
+	Year            int                `json:"year"`
+	TotalFees       float64            `json:"total_fees"`
+	InterestCharged float64            `json:"interest_charged"`
+	ByType          map[string]float64 `json:"by_type"`
+}
+
+// FeeSummary totals fees and interest per account (source name) per year of the
+// payment due date. A year of 0 includes all years.
+func (s *StatementService) FeeSummary(ctx context.Context, sourceName string, year int) ([]FeeSummary, error) {
+	statements, err := s.Repo.ListStatements(ctx, StatementFilter{SourceName: sourceName})
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		source string
+		year   int
+	}
+	summaries := make(map[key]*FeeSummary)
+	for _, stmt := range statements {
+		if len(stmt.Fees) == 0 && stmt.InterestCharged == nil {
+			continue
+		}
+
+		stmtYear := dueDateOf(&stmt).Year()
+		if year != 0 && stmtYear != year {
+			continue
+		}
+
+		k := key{source: stmt.SourceName, year: stmtYear}
+		summary, ok := summaries[k]
+		if !ok {
+			summary = &FeeSummary{SourceName: stmt.SourceName, Year: stmtYear, ByType: map[string]float64{}}
+			summaries[k] = summary
+		}
+
+		for _, fee := range stmt.Fees {
+			summary.TotalFees += fee.Amount
+			summary.ByType[fee.Type.String()] += fee.Amount
+		}
+		if stmt.InterestCharged != nil {
+			summary.InterestCharged += *stmt.InterestCharged
+		}
+	}
+
+	result := make([]FeeSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].SourceName != result[j].SourceName {
+			return result[i].SourceName < result[j].SourceName
+		}
+		return result[i].Year < result[j].Year
+	})
+	return result, nil
+}
@@ -1,11 +1,23 @@
 package statements
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/ingest"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/jsonbody"
 )
 
 type StatementManager struct {
@@ -13,91 +25,439 @@ type StatementManager struct {
 	Repo    StatementRepository
 }
 
-func (s *StatementManager) StatementsHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		s.getHandler(w, r)
-	case http.MethodPost:
-		s.postHandler(w, r)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+const (
+	staleWarning  = `110 - "Response is stale"`
+	queuedWarning = `199 - "Database unavailable, write queued for replay"`
+)
+
+func (s *StatementManager) degraded() bool {
+	for _, layer := range Layers(s.Repo) {
+		if d, ok := layer.(interface{ Degraded() bool }); ok {
+			return d.Degraded()
+		}
 	}
+	return false
 }
 
-func (s *StatementManager) getHandler(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query()
-	id := query.Get("id")
+// LegacyGetHandler serves GET /api/statements?id=..., the route
+// GET /api/statements/{id} replaces, kept for the existing clients.
+func (s *StatementManager) LegacyGetHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
 	if id == "" {
-		http.Error(w, "Missing id parameter", http.StatusBadRequest)
+		apierror.Reply(w, "Missing id parameter", http.StatusBadRequest)
 		return
 	}
+	s.writeStatement(w, r, id)
+}
+
+// GetHandler serves GET /api/statements/{id}, with its transactions when
+// $expand=transactions.
+func (s *StatementManager) GetHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeStatement(w, r, r.PathValue("id"))
+}
 
-	stmt, err := s.Repo.GetStatement(id)
+func (s *StatementManager) writeStatement(w http.ResponseWriter, r *http.Request, id string) {
+	query := r.URL.Query()
+	stmt, err := s.Repo.GetStatement(r.Context(), id)
 	if err != nil {
-		slog.Error("Failed to retrieve statement", "id", id, "error", err)
-		http.Error(w, "Failed to retrieve statement", http.StatusInternalServerError)
+		accesslog.Logger(r.Context()).Error("Failed to retrieve statement", "id", id, "error", err)
+		apierror.Reply(w, "Failed to retrieve statement", http.StatusInternalServerError)
 		return
 	}
 
 	if stmt == nil {
-		http.Error(w, "Statement not found", http.StatusNotFound)
+		apierror.Reply(w, "Statement not found", http.StatusNotFound)
 		return
 	}
 
-	expandTx := shouldExpandTransactions(query)
-	if expandTx {
-		txs, err := s.Repo.GetTransactions(id)
-		if err != nil {
-			slog.Error("Failed to retrieve transactions for statement", "statement_id", id, "error", err)
-			http.Error(w, "Failed to retrieve transactions", http.StatusInternalServerError)
-			return
-		}
-		stmt.Transactions = &txs
+	if shouldExpandTransactions(query) {
+		s.writeExpandedStatement(w, r, id, stmt)
+		return
+	}
+
+	if s.degraded() {
+		w.Header().Set("Warning", staleWarning)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(stmt); err != nil {
-		slog.Error("Failed to encode JSON response", "error", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		accesslog.Logger(r.Context()).Error("Failed to encode JSON response", "error", err)
+		apierror.Reply(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 }
 
-func (s *StatementManager) postHandler(w http.ResponseWriter, r *http.Request) {
-	var stmt Statement
-	err := json.NewDecoder(r.Body).Decode(&stmt)
+// expandPageSize is the number of transactions read from the repository and
+// encoded at a time when a statement is expanded.
+const expandPageSize = 500
+
+// writeExpandedStatement streams the statement with its transactions, read a
+// page at a time, so statements with thousands of them are never held in
+// memory whole. A page failing once the response started aborts it, the
+// client sees a truncated body rather than a valid one missing transactions.
+func (s *StatementManager) writeExpandedStatement(w http.ResponseWriter, r *http.Request, id string, stmt *Statement) {
+	ctx := r.Context()
+	filter := TransactionFilter{StatementID: id}
+	page, err := s.Repo.ListTransactions(ctx, filter, Page{Limit: expandPageSize})
+	if err == nil && len(page) == 0 {
+		// the transactions of archived statements are not paged
+		page, err = s.Repo.GetTransactions(ctx, id)
+	}
 	if err != nil {
-		slog.Error("Failed to decode statement payload", "error", err)
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		accesslog.Logger(ctx).Error("Failed to retrieve transactions for statement", "statement_id", id, "error", err)
+		apierror.Reply(w, "Failed to retrieve transactions", http.StatusInternalServerError)
 		return
 	}
 
-	err = s.Service.SaveStatement(&stmt)
+	stmt.Transactions = nil
+	head, err := json.Marshal(stmt)
 	if err != nil {
-		slog.Error("Failed to update statement", "id", stmt.ID, "error", err)
-		http.Error(w, "Failed to update statement", http.StatusInternalServerError)
+		accesslog.Logger(ctx).Error("Failed to encode JSON response", "error", err)
+		apierror.Reply(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if s.degraded() {
+		w.Header().Set("Warning", staleWarning)
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	// the statement up to its closing brace, then its transactions
+	body := bufio.NewWriterSize(w, 32<<10)
+	body.Write(head[:len(head)-1])
+	if len(head) > 2 {
+		body.WriteByte(',')
+	}
+	body.WriteString(`"transactions":[`)
+	enc := json.NewEncoder(body)
+	for n := 0; ; {
+		for i := range page {
+			if n > 0 {
+				body.WriteByte(',')
+			}
+			n++
+			if err := enc.Encode(&page[i]); err != nil {
+				accesslog.Logger(ctx).Error("Failed to encode transaction", "statement_id", id, "id", page[i].ID, "error", err)
+				panic(http.ErrAbortHandler)
+			}
+		}
+		if len(page) < expandPageSize {
+			break
+		}
+		page, err = s.Repo.ListTransactions(ctx, filter, Page{Limit: expandPageSize, After: page[len(page)-1].ID})
+		if err != nil {
+			accesslog.Logger(ctx).Error("Failed to retrieve transactions for statement", "statement_id", id, "after", n, "error", err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+	body.WriteString("]}\n")
+	if err := body.Flush(); err != nil {
+		accesslog.Logger(ctx).Debug("Failed to write statement", "id", id, "error", err)
+	}
+}
+
+// TransactionsOfStatementHandler serves GET /api/statements/{id}/transactions.
+func (s *StatementManager) TransactionsOfStatementHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	stmt, err := s.Repo.GetStatement(r.Context(), id)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to retrieve statement", "id", id, "error", err)
+		apierror.Reply(w, "Failed to retrieve statement", http.StatusInternalServerError)
+		return
+	}
+	if stmt == nil {
+		apierror.Reply(w, "Statement not found", http.StatusNotFound)
+		return
+	}
+
+	txs, err := s.Repo.GetTransactions(r.Context(), id)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to retrieve transactions for statement", "statement_id", id, "error", err)
+		apierror.Reply(w, "Failed to retrieve transactions", http.StatusInternalServerError)
+		return
+	}
+	if s.degraded() {
+		w.Header().Set("Warning", staleWarning)
+	}
+	writeJSON(w, txs)
+}
+
+// SaveHandler serves POST /api/statements, creating or replacing the
+// statement of the payload.
+func (s *StatementManager) SaveHandler(w http.ResponseWriter, r *http.Request) {
+	payload, err := jsonbody.Read(w, r)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+
+	version := r.Header.Get(ingest.VersionHeader)
+	violations, err := ingest.ValidatePayload("statement", version, payload)
+	if err != nil {
+		apierror.Reply(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(violations) > 0 {
+		accesslog.Logger(r.Context()).Warn("Statement payload does not match ingest schema", "version", version, "violations", violations)
+		apierror.Write(w, jsonbody.Invalid("Payload does not match ingest schema", violations...))
+		return
+	}
+
+	var stmt Statement
+	if err := jsonbody.Unmarshal(payload, &stmt); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to decode statement payload", "error", err)
+		apierror.Write(w, err)
 		return
 	}
 
+	queued := false
 	expandTx := shouldExpandTransactions(r.URL.Query())
 	if expandTx {
 		if stmt.Transactions == nil {
-			http.Error(w, "Transactions null when expanding", http.StatusBadRequest)
+			apierror.Reply(w, "Transactions null when expanding", http.StatusBadRequest)
 			return
 		}
 
-		err = s.Service.SyncTransactions(stmt.ID, stmt.Transactions)
-		if err != nil {
-			slog.Error("Failed to sync transactions", "statement_id", stmt.ID, "tx_count", len(*stmt.Transactions), "error", err)
-			http.Error(w, "Failed to sync transactions", http.StatusInternalServerError)
+		err = s.Service.SaveStatementWithTransactions(r.Context(), &stmt)
+		if errors.Is(err, ErrQueued) {
+			queued = true
+		} else if errors.Is(err, ErrClientEncryption) {
+			apierror.Write(w, err)
+			return
+		} else if errors.Is(err, ErrNotOwned) {
+			apierror.Write(w, fmt.Errorf("statement %w", err))
+			return
+		} else if err != nil {
+			accesslog.Logger(r.Context()).Error("Failed to save statement with transactions", "id", stmt.ID, "tx_count", len(*stmt.Transactions), "error", err)
+			apierror.Reply(w, "Failed to save statement with transactions", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		err = s.Service.SaveStatement(r.Context(), &stmt)
+		if errors.Is(err, ErrQueued) {
+			queued = true
+		} else if errors.Is(err, ErrClientEncryption) {
+			apierror.Write(w, err)
+			return
+		} else if errors.Is(err, ErrNotOwned) {
+			apierror.Write(w, fmt.Errorf("statement %w", err))
+			return
+		} else if err != nil {
+			accesslog.Logger(r.Context()).Error("Failed to update statement", "id", stmt.ID, "error", err)
+			apierror.Reply(w, "Failed to update statement", http.StatusInternalServerError)
 			return
 		}
 	}
 
+	// the ID is derived from the payload and the owner, the client learns it here
+	w.Header().Set("Location", "/api/statements/"+url.PathEscape(stmt.ID))
+	if queued {
+		w.Header().Set("Warning", queuedWarning)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
 	w.WriteHeader(http.StatusCreated)
 }
 
+func (s *StatementManager) RewardsHandler(w http.ResponseWriter, r *http.Request) {
+	sourceName := r.URL.Query().Get("source_name")
+	summaries, err := s.Service.RewardsSummary(r.Context(), sourceName)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to summarize rewards", "source_name", sourceName, "error", err)
+		apierror.Reply(w, "Failed to summarize rewards", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, summaries)
+}
+
+func (s *StatementManager) TransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := parseTransactionFilter(query)
+	if err != nil {
+		apierror.Reply(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page := Page{After: query.Get("after")}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			apierror.Reply(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		page.Limit = n
+	}
+
+	result, err := s.Service.ListTransactions(r.Context(), filter, page)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list transactions", "filter", filter, "error", err)
+		apierror.Reply(w, "Failed to list transactions", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, result)
+}
+
+func (s *StatementManager) FeesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	sourceName := query.Get("source_name")
+	year := 0
+	if y := query.Get("year"); y != "" {
+		n, err := strconv.Atoi(y)
+		if err != nil {
+			apierror.Reply(w, "Invalid year parameter", http.StatusBadRequest)
+			return
+		}
+		year = n
+	}
+
+	summaries, err := s.Service.FeeSummary(r.Context(), sourceName, year)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to summarize fees", "source_name", sourceName, "year", year, "error", err)
+		apierror.Reply(w, "Failed to summarize fees", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, summaries)
+}
+
+func (s *StatementManager) SourceHealthHandler(w http.ResponseWriter, r *http.Request) {
+	sourceName := r.URL.Query().Get("source_name")
+	health, err := s.Service.SourceHealth(r.Context(), sourceName, time.Now().UTC())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to compute source health", "source_name", sourceName, "error", err)
+		apierror.Reply(w, "Failed to compute source health", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, health)
+}
+
+// AuditHandler serves GET /api/audit?entity_id=...: the recorded changes of a
+// statement or transaction, newest first.
+func (s *StatementManager) AuditHandler(w http.ResponseWriter, r *http.Request) {
+	store, ok := AsAuditStore(s.Repo)
+	if !ok {
+		apierror.Reply(w, "Audit log is not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	query := r.URL.Query()
+	entityID := query.Get("entity_id")
+	if entityID == "" {
+		apierror.Reply(w, "Missing entity_id parameter", http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			apierror.Reply(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, 1000)
+	}
+
+	entries, err := store.AuditHistory(r.Context(), entityID, limit)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to read audit log", "entity_id", entityID, "error", err)
+		apierror.Reply(w, "Failed to read audit log", http.StatusInternalServerError)
+		return
+	}
+	visible, err := s.auditVisible(r.Context(), entityID, entries)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to read the audited entity", "entity_id", entityID, "error", err)
+		apierror.Reply(w, "Failed to read audit log", http.StatusInternalServerError)
+		return
+	}
+	if !visible {
+		// as for an entity without entries, so its ID is not confirmed
+		entries = []AuditEntry{}
+	}
+
+	writeJSON(w, entries)
+}
+
+// auditVisible reports whether the caller owns the audited statement or
+// transaction, read through the scoped repository. One deleted since is
+// judged by the owner its entries recorded.
+func (s *StatementManager) auditVisible(ctx context.Context, entityID string, entries []AuditEntry) (bool, error) {
+	if OwnerFrom(ctx) == "" {
+		return true, nil
+	}
+	stmt, err := s.Repo.GetStatement(ctx, entityID)
+	if err != nil || stmt != nil {
+		return stmt != nil, err
+	}
+	txs, err := transactionsByID(ctx, s.Repo, []string{entityID})
+	if err != nil || len(txs) > 0 {
+		return len(txs) > 0 && Owns(ctx, txs[0].TenantID, txs[0].UserID), err
+	}
+	for _, e := range entries {
+		for _, snapshot := range []map[string]any{e.Before, e.After} {
+			if snapshot == nil {
+				continue
+			}
+			tenantID, _ := snapshot["tenant_id"].(string)
+			userID, _ := snapshot["user_id"].(string)
+			if !Owns(ctx, tenantID, userID) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func parseTransactionFilter(query url.Values) (TransactionFilter, error) {
+	filter := TransactionFilter{
+		StatementID:     query.Get("statement_id"),
+		MerchantCountry: query.Get("merchant_country"),
+		ExternalRef:     query.Get("external_ref"),
+		ExternalRefType: query.Get("external_ref_type"),
+		BlindIndex:      query.Get("blind_index"),
+	}
+
+	for name, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := query.Get(name); v != "" {
+			t, err := time.Parse(time.DateOnly, v)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s parameter, expected YYYY-MM-DD", name)
+			}
+			*target = t
+		}
+	}
+
+	if v := query.Get("is_foreign"); v != "" {
+		isForeign, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, errors.New("invalid is_foreign parameter")
+		}
+		filter.IsForeign = &isForeign
+	}
+	if v := query.Get("is_transfer"); v != "" {
+		isTransfer, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, errors.New("invalid is_transfer parameter")
+		}
+		filter.IsTransfer = &isTransfer
+	}
+	spendType, err := ParseSpendType(query.Get("spend_type"))
+	if err != nil {
+		return filter, fmt.Errorf("invalid spend_type parameter: %w", err)
+	}
+	filter.SpendType = spendType
+	return filter, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+		apierror.Reply(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
 func shouldExpandTransactions(query url.Values) bool {
 	expand := strings.SplitSeq(query.Get("$expand"), ",")
 	for e := range expand {
@@ -107,3 +467,265 @@ func shouldExpandTransactions(query url.Values) bool {
 	}
 	return false
 }
+
+// PaymentsHandler serves POST /api/statements/{id}/payments: records a payment
+// and closes the statement when it matches with enough confidence.
+func (s *StatementManager) PaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var payment Payment
+	if err := jsonbody.Decode(w, r, &payment); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	if payment.Amount <= 0 {
+		apierror.Write(w, jsonbody.Invalid("Invalid payment payload", ingest.ValidationError{Path: "$.amount", Message: "must be > 0"}))
+		return
+	}
+
+	stmt, err := s.Service.RecordPayment(r.Context(), id, payment)
+	s.writePaymentResult(w, id, stmt, err, "Failed to record payment")
+}
+
+// ConfirmPaymentHandler serves POST /api/statements/{id}/payment/confirm for
+// statements held as payment_detected.
+func (s *StatementManager) ConfirmPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	stmt, err := s.Service.ConfirmPayment(r.Context(), id)
+	if errors.Is(err, ErrNothingToConfirm) {
+		apierror.Write(w, err)
+		return
+	}
+	s.writePaymentResult(w, id, stmt, err, "Failed to confirm payment")
+}
+
+func (s *StatementManager) writePaymentResult(w http.ResponseWriter, id string, stmt *Statement, err error, failure string) {
+	switch {
+	case errors.Is(err, ErrQueued):
+		w.Header().Set("Warning", queuedWarning)
+	case err != nil:
+		slog.Error(failure, "id", id, "error", err)
+		apierror.Reply(w, failure, http.StatusInternalServerError)
+		return
+	case stmt == nil:
+		apierror.Reply(w, "Statement not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, struct {
+		ID           string          `json:"id"`
+		Status       StatementStatus `json:"status"`
+		PaidAt       *time.Time      `json:"paid_at,omitempty"`
+		PaymentMatch *PaymentMatch   `json:"payment_match,omitempty"`
+	}{stmt.ID, stmt.Status, stmt.PaidAt, stmt.PaymentMatch})
+}
+
+// ExternalRefsHandler serves PUT /api/statements/{id}/transactions/{txid}/external_refs,
+// replacing the references of the transaction with the posted array.
+func (s *StatementManager) ExternalRefsHandler(w http.ResponseWriter, r *http.Request) {
+	id, txID := r.PathValue("id"), r.PathValue("txid")
+	var refs []ExternalRef
+	if err := jsonbody.Decode(w, r, &refs); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+
+	tx, err := s.Service.SetExternalRefs(r.Context(), id, txID, refs)
+	switch {
+	case errors.Is(err, ErrTransactionNotFound):
+		apierror.Write(w, err)
+		return
+	case errors.Is(err, ErrQueued):
+		w.Header().Set("Warning", queuedWarning)
+	case err != nil:
+		accesslog.Logger(r.Context()).Error("Failed to set external references", "id", id, "transaction_id", txID, "error", err)
+		apierror.Reply(w, "Failed to set external references", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, tx)
+}
+
+// AttributionHandler serves PUT /api/statements/{id}/transactions/{txid}/attribution
+// with {"owner": ..., "paid_by": ...}, the household members the transaction
+// is for and was paid by.
+func (s *StatementManager) AttributionHandler(w http.ResponseWriter, r *http.Request) {
+	id, txID := r.PathValue("id"), r.PathValue("txid")
+	var attribution Attribution
+	if err := jsonbody.Decode(w, r, &attribution); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+
+	tx, err := s.Service.SetAttribution(r.Context(), id, txID, attribution)
+	switch {
+	case errors.Is(err, ErrTransactionNotFound):
+		apierror.Write(w, err)
+		return
+	case errors.Is(err, ErrQueued):
+		w.Header().Set("Warning", queuedWarning)
+	case err != nil:
+		accesslog.Logger(r.Context()).Error("Failed to set attribution", "id", id, "transaction_id", txID, "error", err)
+		apierror.Reply(w, "Failed to set attribution", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, tx)
+}
+
+// DisputeHandler serves GET /api/statements/{id}/transactions/{txid}/dispute.
+func (s *StatementManager) DisputeHandler(w http.ResponseWriter, r *http.Request) {
+	id, txID := r.PathValue("id"), r.PathValue("txid")
+	dispute, err := s.Service.Dispute(r.Context(), id, txID)
+	switch {
+	case errors.Is(err, ErrTransactionNotFound):
+		apierror.Write(w, err)
+	case errors.Is(err, ErrDisputeNotFound):
+		apierror.Write(w, err)
+	case err != nil:
+		accesslog.Logger(r.Context()).Error("Failed to read dispute", "id", id, "transaction_id", txID, "error", err)
+		apierror.Reply(w, "Failed to read dispute", http.StatusInternalServerError)
+	default:
+		writeJSON(w, dispute)
+	}
+}
+
+// UpdateDisputeHandler serves PUT /api/statements/{id}/transactions/{txid}/dispute
+// with {"status": ..., "note": ..., "deadline": ...}, opening the dispute when
+// there is none. Transitions the workflow does not allow answer 409.
+func (s *StatementManager) UpdateDisputeHandler(w http.ResponseWriter, r *http.Request) {
+	id, txID := r.PathValue("id"), r.PathValue("txid")
+	var update DisputeUpdate
+	if err := jsonbody.Decode(w, r, &update); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+
+	tx, err := s.Service.UpdateDispute(r.Context(), id, txID, update)
+	switch {
+	case errors.Is(err, ErrTransactionNotFound):
+		apierror.Write(w, err)
+		return
+	case errors.Is(err, ErrInvalidTransition):
+		apierror.Write(w, err)
+		return
+	case errors.Is(err, ErrQueued):
+		w.Header().Set("Warning", queuedWarning)
+	case err != nil:
+		accesslog.Logger(r.Context()).Error("Failed to update dispute", "id", id, "transaction_id", txID, "error", err)
+		apierror.Reply(w, "Failed to update dispute", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, tx)
+}
+
+// DisputesHandler serves GET /api/disputes, the disputed transactions by
+// deadline. status is open by default (opened and pending), all, or a
+// comma-separated list of statuses.
+func (s *StatementManager) DisputesHandler(w http.ResponseWriter, r *http.Request) {
+	var statuses []DisputeStatus
+	switch v := r.URL.Query().Get("status"); v {
+	case "", "open":
+		statuses = OpenDisputeStatuses
+	case "all":
+		statuses = []DisputeStatus{DisputeOpened, DisputePending, DisputeResolved, DisputeChargedBack}
+	default:
+		for _, part := range strings.Split(v, ",") {
+			status := DisputeStatus(strings.TrimSpace(part))
+			if !status.Valid() {
+				apierror.Reply(w, "Invalid status parameter, expected open, all or opened, pending, resolved, charged_back", http.StatusBadRequest)
+				return
+			}
+			statuses = append(statuses, status)
+		}
+	}
+
+	txs, err := s.Service.Disputes(r.Context(), statuses)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list disputes", "error", err)
+		apierror.Reply(w, "Failed to list disputes", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, txs)
+}
+
+// DuplicatesHandler serves GET /api/statements/duplicates, optionally of one
+// source_name.
+func (s *StatementManager) DuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	duplicates, err := s.Service.FindDuplicates(r.Context(), r.URL.Query().Get("source_name"))
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to find duplicate statements", "error", err)
+		apierror.Reply(w, "Failed to find duplicate statements", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, duplicates)
+}
+
+// ReconciliationHandler serves GET /api/statements/{id}/reconciliation, the
+// total of the statement against its stored transactions with the likely
+// missing amounts, within ?tolerance= (0.01 by default). The statement is
+// marked reconciled, or no longer reconciled, accordingly.
+func (s *StatementManager) ReconciliationHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	tolerance := reconcileTolerance
+	if v := r.URL.Query().Get("tolerance"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t < 0 || math.IsNaN(t) || math.IsInf(t, 0) {
+			apierror.Reply(w, "Invalid tolerance parameter", http.StatusBadRequest)
+			return
+		}
+		tolerance = t
+	}
+
+	report, err := s.Service.Reconciliation(r.Context(), id, tolerance)
+	if errors.Is(err, ErrQueued) {
+		w.Header().Set("Warning", queuedWarning)
+	} else if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to reconcile statement", "id", id, "error", err)
+		apierror.Reply(w, "Failed to reconcile statement", http.StatusInternalServerError)
+		return
+	}
+	if report == nil {
+		apierror.Reply(w, "Statement not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, report)
+}
+
+// MergeHandler serves POST /api/statements/merge with a body of
+// {"keep": "<id>", "duplicate": "<id>"}.
+func (s *StatementManager) MergeHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Keep      string `json:"keep"`
+		Duplicate string `json:"duplicate"`
+	}
+	if err := jsonbody.Decode(w, r, &req); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	var missing []ingest.ValidationError
+	if req.Keep == "" {
+		missing = append(missing, ingest.ValidationError{Path: "$.keep", Message: "is required"})
+	}
+	if req.Duplicate == "" {
+		missing = append(missing, ingest.ValidationError{Path: "$.duplicate", Message: "is required"})
+	}
+	if len(missing) > 0 {
+		apierror.Write(w, jsonbody.Invalid("Invalid merge payload", missing...))
+		return
+	}
+
+	result, err := s.Service.MergeStatements(r.Context(), req.Keep, req.Duplicate)
+	switch {
+	case errors.Is(err, ErrInvalidMerge):
+		apierror.Write(w, err)
+		return
+	case errors.Is(err, ErrQueued):
+		w.Header().Set("Warning", queuedWarning)
+	case err != nil:
+		accesslog.Logger(r.Context()).Error("Failed to merge statements", "keep", req.Keep, "duplicate", req.Duplicate, "error", err)
+		apierror.Reply(w, "Failed to merge statements", http.StatusInternalServerError)
+		return
+	case result == nil:
+		apierror.Reply(w, "Statement not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, result)
+}
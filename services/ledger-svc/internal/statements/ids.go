@@ -0,0 +1,171 @@
+package statements
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IDStrategy selects how statements without an ID get one.
+type IDStrategy string
+
+const (
+	// IDStrategyDefault uses the source ID, then the due date, then a random UUID.
+	IDStrategyDefault IDStrategy = "default"
+	// IDStrategyHash always derives the ID from the statement content, so a
+	// source without stable identifiers can re-post safely. A re-parse that
+	// changes the content yields a new ID.
+	IDStrategyHash IDStrategy = "hash"
+)
+
+// IDStrategies holds the default strategy and per-source overrides.
+type IDStrategies struct {
+	Default   IDStrategy
+	Overrides map[string]IDStrategy
+}
+
+// IDStrategiesFromEnv reads STATEMENT_ID_STRATEGY and per-source overrides
+// named STATEMENT_ID_STRATEGY_<SOURCE>, e.g. STATEMENT_ID_STRATEGY_ESUN=hash.
+func IDStrategiesFromEnv() (IDStrategies, error) {
+	strategies := IDStrategies{Default: IDStrategyDefault, Overrides: map[string]IDStrategy{}}
+
+	const name = "STATEMENT_ID_STRATEGY"
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		source, isOverride := strings.CutPrefix(key, name+"_")
+		if value == "" || key != name && !isOverride {
+			continue
+		}
+		strategy := IDStrategy(value)
+		if strategy != IDStrategyDefault && strategy != IDStrategyHash {
+			return strategies, fmt.Errorf("invalid %s %q, expected default or hash", key, value)
+		}
+		if isOverride {
+			strategies.Overrides[source] = strategy
+		} else {
+			strategies.Default = strategy
+		}
+	}
+	return strategies, nil
+}
+
+// For returns the strategy of a source. Override names are matched case
+// insensitively with anything but letters and digits replaced by "_".
+func (s IDStrategies) For(sourceName string) IDStrategy {
+	key := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, sourceName)
+	for name, strategy := range s.Overrides {
+		if strings.EqualFold(name, key) {
+			return strategy
+		}
+	}
+	if s.Default == "" {
+		return IDStrategyDefault
+	}
+	return s.Default
+}
+
+// contentHash fingerprints what the issuer reported: source, due date, currency,
+// total and the transactions by date, amount and description, in any order.
+func (b *Statement) contentHash() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%.2f\n", b.SourceName, b.Currency, b.TotalAmount)
+	if b.PaymentDueDate != nil {
+		fmt.Fprintln(h, b.PaymentDueDate.UTC().Format(time.DateOnly))
+	}
+
+	var fingerprints []string
+	if b.Transactions != nil {
+		for i := range *b.Transactions {
+			fingerprints = append(fingerprints, (*b.Transactions)[i].fingerprint())
+		}
+	}
+	sort.Strings(fingerprints)
+	for _, f := range fingerprints {
+		fmt.Fprintln(h, f)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fingerprint identifies a transaction by what the issuer reported, ignoring
+// its ID and case and spacing of the description.
+func (bd *Transaction) fingerprint() string {
+	return fmt.Sprintf("%s|%.2f|%s", bd.Date.UTC().Format(time.DateOnly), bd.Amount,
+		strings.ToLower(strings.Join(strings.Fields(bd.Description), " ")))
+}
+
+// identify fingerprints the statement and assigns its ID ahead of Normalize
+// when the source uses content hashes. A statement that would otherwise get a
+// random ID takes the ID of a stored statement with the same content instead,
+// so posting it again updates that statement rather than duplicating it.
+func (s *StatementService) identify(ctx context.Context, statement *Statement) {
+	if statement.SourceName == "" {
+		// rejected by Normalize
+		return
+	}
+	statement.ContentHash = statement.contentHash()
+	if statement.ID != "" {
+		return
+	}
+
+	if s.IDs.For(statement.SourceName) == IDStrategyHash {
+		statement.ID = OwnedID(Owner(statement.TenantID, statement.UserID), fmt.Sprintf("%s_%s", statement.SourceName, statement.ContentHash[:16]))
+		return
+	}
+	if statement.SourceID != nil {
+		s.identifyBySource(ctx, statement)
+		return
+	}
+	if statement.PaymentDueDate != nil {
+		return
+	}
+
+	candidates, err := s.Repo.ListStatements(ctx, StatementFilter{SourceName: statement.SourceName})
+	if err != nil {
+		slog.Warn("Failed to check for a duplicate statement", "source_name", statement.SourceName, "error", err)
+		return
+	}
+	for i := range candidates {
+		if candidates[i].ContentHash == statement.ContentHash {
+			slog.Info("Statement matches a stored one, updating it", "id", candidates[i].ID)
+			statement.ID = candidates[i].ID
+			return
+		}
+	}
+}
+
+// identifyBySource keeps an encrypted source ID out of the statement ID,
+// which carries its blind index instead. A stored statement with the source
+// ID keeps its ID, whether it holds the plaintext source ID or a blind index
+// under a replaced key.
+func (s *StatementService) identifyBySource(ctx context.Context, statement *Statement) {
+	encrypted, ok := AsEncryptedRepo(s.Repo)
+	if !ok {
+		return
+	}
+	index, ok := encrypted.SourceIndex(*statement.SourceID)
+	if !ok {
+		return
+	}
+	candidates, err := s.Repo.ListStatements(ctx, StatementFilter{SourceName: statement.SourceName})
+	if err != nil {
+		slog.Warn("Failed to look up the statement of the source", "source_name", statement.SourceName, "error", err)
+	}
+	for i := range candidates {
+		if candidates[i].SourceID != nil && *candidates[i].SourceID == *statement.SourceID {
+			statement.ID = candidates[i].ID
+			return
+		}
+	}
+	statement.ID = OwnedID(Owner(statement.TenantID, statement.UserID), fmt.Sprintf("%s_%s", statement.SourceName, index))
+}
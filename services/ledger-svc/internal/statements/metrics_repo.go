@@ -0,0 +1,153 @@
+package statements
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	repoDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "finchie_repository_duration_seconds",
+		Help:    "Latency of statement repository calls.",
+		Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"driver", "method"})
+	repoErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "finchie_repository_errors_total",
+		Help: "Statement repository calls that returned an error.",
+	}, []string{"driver", "method"})
+	repoDocuments = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "finchie_repository_documents_total",
+		Help: "Statements and transactions read or written by statement repository calls.",
+	}, []string{"driver", "method"})
+)
+
+// MetricsRepo records the latency, errors and document count of every call to
+// the repository it wraps. As the outermost layer it measures what callers
+// see, cache hits and queued writes included.
+type MetricsRepo struct {
+	StatementRepository
+	driver string
+}
+
+func NewMetricsRepo(repo StatementRepository, driver string) *MetricsRepo {
+	return &MetricsRepo{StatementRepository: repo, driver: driver}
+}
+
+func metricsFromEnv(repo StatementRepository, driver string) StatementRepository {
+	if os.Getenv("REPOSITORY_METRICS") == "false" {
+		return repo
+	}
+	return NewMetricsRepo(repo, driver)
+}
+
+func (r *MetricsRepo) Unwrap() StatementRepository {
+	return r.StatementRepository
+}
+
+func (r *MetricsRepo) Describe() map[string]string {
+	if d, ok := r.StatementRepository.(Describer); ok {
+		return d.Describe()
+	}
+	return nil
+}
+
+func (r *MetricsRepo) observe(method string, start time.Time, documents int, err error) {
+	repoDuration.WithLabelValues(r.driver, method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		repoErrors.WithLabelValues(r.driver, method).Inc()
+		return
+	}
+	repoDocuments.WithLabelValues(r.driver, method).Add(float64(documents))
+}
+
+func (r *MetricsRepo) GetStatement(ctx context.Context, id string) (*Statement, error) {
+	start := time.Now()
+	stmt, err := r.StatementRepository.GetStatement(ctx, id)
+	found := 0
+	if stmt != nil {
+		found = 1
+	}
+	r.observe("get_statement", start, found, err)
+	return stmt, err
+}
+
+func (r *MetricsRepo) ListStatements(ctx context.Context, filter StatementFilter) ([]Statement, error) {
+	start := time.Now()
+	stmts, err := r.StatementRepository.ListStatements(ctx, filter)
+	r.observe("list_statements", start, len(stmts), err)
+	return stmts, err
+}
+
+func (r *MetricsRepo) UpsertStatement(ctx context.Context, statement *Statement) error {
+	start := time.Now()
+	err := r.StatementRepository.UpsertStatement(ctx, statement)
+	r.observe("upsert_statement", start, 1, err)
+	return err
+}
+
+func (r *MetricsRepo) DeleteStatement(ctx context.Context, id string) error {
+	start := time.Now()
+	err := r.StatementRepository.DeleteStatement(ctx, id)
+	r.observe("delete_statement", start, 1, err)
+	return err
+}
+
+func (r *MetricsRepo) GetTransactions(ctx context.Context, statementID string) ([]Transaction, error) {
+	start := time.Now()
+	txs, err := r.StatementRepository.GetTransactions(ctx, statementID)
+	r.observe("get_transactions", start, len(txs), err)
+	return txs, err
+}
+
+func (r *MetricsRepo) ListTransactions(ctx context.Context, filter TransactionFilter, page Page) ([]Transaction, error) {
+	start := time.Now()
+	txs, err := r.StatementRepository.ListTransactions(ctx, filter, page)
+	r.observe("list_transactions", start, len(txs), err)
+	return txs, err
+}
+
+func (r *MetricsRepo) FindTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error) {
+	start := time.Now()
+	txs, err := r.StatementRepository.FindTransactions(ctx, filter)
+	r.observe("find_transactions", start, len(txs), err)
+	return txs, err
+}
+
+func (r *MetricsRepo) UpsertTransaction(ctx context.Context, tx *Transaction) error {
+	start := time.Now()
+	err := r.StatementRepository.UpsertTransaction(ctx, tx)
+	r.observe("upsert_transaction", start, 1, err)
+	return err
+}
+
+func (r *MetricsRepo) DeleteTransaction(ctx context.Context, id string) error {
+	start := time.Now()
+	err := r.StatementRepository.DeleteTransaction(ctx, id)
+	r.observe("delete_transaction", start, 1, err)
+	return err
+}
+
+func (r *MetricsRepo) BulkUpsertTransactions(ctx context.Context, transactions []Transaction) error {
+	start := time.Now()
+	err := r.StatementRepository.BulkUpsertTransactions(ctx, transactions)
+	r.observe("bulk_upsert_transactions", start, len(transactions), err)
+	return err
+}
+
+func (r *MetricsRepo) BulkDeleteTransactions(ctx context.Context, ids []string) error {
+	start := time.Now()
+	err := r.StatementRepository.BulkDeleteTransactions(ctx, ids)
+	r.observe("bulk_delete_transactions", start, len(ids), err)
+	return err
+}
+
+func (r *MetricsRepo) SaveStatementWithDelta(ctx context.Context, statement *Statement, delta TransactionDelta) error {
+	start := time.Now()
+	err := r.StatementRepository.SaveStatementWithDelta(ctx, statement, delta)
+	r.observe("save_statement_with_delta", start, 1+len(delta.Upserts)+len(delta.Deletes), err)
+	return err
+}
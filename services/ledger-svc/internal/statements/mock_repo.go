@@ -1,16 +1,29 @@
 package statements
 
 import (
+	"context"
 	"errors"
+	"sort"
 	"sync"
+	"time"
 )
 
 type InMemoryRepo struct {
 	statements   map[string]*Statement
 	transactions map[string]Transaction
+	events       []ChangeEvent
+	audit        []AuditEntry
 	mu           sync.RWMutex
 }
 
+const memoryDriver = "memory"
+
+func init() {
+	RegisterDriver(memoryDriver, func() (StatementRepository, error) {
+		return NewInMemoryRepo(), nil
+	})
+}
+
 func NewInMemoryRepo() *InMemoryRepo {
 	return &InMemoryRepo{
 		statements:   make(map[string]*Statement),
@@ -18,7 +31,11 @@ func NewInMemoryRepo() *InMemoryRepo {
 	}
 }
 
-func (r *InMemoryRepo) GetStatement(id string) (*Statement, error) {
+func (r *InMemoryRepo) Describe() map[string]string {
+	return map[string]string{"storage": "memory"}
+}
+
+func (r *InMemoryRepo) GetStatement(ctx context.Context, id string) (*Statement, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -29,15 +46,85 @@ func (r *InMemoryRepo) GetStatement(id string) (*Statement, error) {
 	return stmt, nil
 }
 
-func (r *InMemoryRepo) UpsertStatement(statement *Statement) error {
+func (r *InMemoryRepo) ListStatements(ctx context.Context, filter StatementFilter) ([]Statement, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []Statement
+	for _, stmt := range r.statements {
+		if !filter.Match(stmt) {
+			continue
+		}
+		result = append(result, *stmt)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return dueDateOf(&result[i]).Before(dueDateOf(&result[j]))
+	})
+	return result, nil
+}
+
+func (r *InMemoryRepo) UpsertStatement(ctx context.Context, statement *Statement) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	r.statements[statement.ID] = statement
+	if r.sourceTaken(statement) {
+		return ErrDuplicateSource
+	}
+	r.upsertStatement(statement)
+	return nil
+}
+
+func (r *InMemoryRepo) DeleteStatement(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for txID, tx := range r.transactions {
+		if tx.StatementID == id {
+			r.deleteTransaction(txID)
+		}
+	}
+	if stmt, ok := r.statements[id]; ok {
+		delete(r.statements, id)
+		r.events = append(r.events, statementDeletedEvent(id).ownedBy(stmt.TenantID, stmt.UserID))
+	}
 	return nil
 }
 
-func (r *InMemoryRepo) GetTransactions(statementId string) ([]Transaction, error) {
+// sourceTaken reports whether another statement of the owner has the source
+// ID, or the blind index of the encrypted one, of statement, which the unique
+// indexes of MongoDB reject.
+func (r *InMemoryRepo) sourceTaken(statement *Statement) bool {
+	if statement.SourceID == nil {
+		return false
+	}
+	for id, stmt := range r.statements {
+		if id == statement.ID || stmt.SourceName != statement.SourceName || stmt.TenantID != statement.TenantID || stmt.UserID != statement.UserID {
+			continue
+		}
+		if statement.SourceIndex != "" && stmt.SourceIndex == statement.SourceIndex ||
+			stmt.SourceID != nil && *stmt.SourceID == *statement.SourceID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *InMemoryRepo) upsertStatement(statement *Statement) {
+	_, exists := r.statements[statement.ID]
+	r.statements[statement.ID] = statement
+	r.events = append(r.events, statementEvent(statement, !exists))
+}
+
+func (r *InMemoryRepo) deleteTransaction(id string) bool {
+	tx, ok := r.transactions[id]
+	if ok {
+		delete(r.transactions, id)
+		r.events = append(r.events, transactionDeletedEvent(tx.StatementID, id).ownedBy(tx.TenantID, tx.UserID))
+	}
+	return ok
+}
+
+func (r *InMemoryRepo) GetTransactions(ctx context.Context, statementId string) ([]Transaction, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -50,21 +137,209 @@ func (r *InMemoryRepo) GetTransactions(statementId string) ([]Transaction, error
 	return result, nil
 }
 
-func (r *InMemoryRepo) UpsertTransaction(tx *Transaction) error {
+func (r *InMemoryRepo) ListTransactions(ctx context.Context, filter TransactionFilter, page Page) ([]Transaction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []Transaction
+	for _, tx := range r.transactions {
+		if filter.Match(&tx) && tx.ID > page.After {
+			result = append(result, tx)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	if page.Limit > 0 && len(result) > page.Limit {
+		result = result[:page.Limit]
+	}
+	return result, nil
+}
+
+func (r *InMemoryRepo) FindTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []Transaction
+	for _, tx := range r.transactions {
+		if filter.Match(&tx) {
+			result = append(result, tx)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Date.Before(result[j].Date)
+	})
+	return result, nil
+}
+
+func (r *InMemoryRepo) UpsertTransaction(ctx context.Context, tx *Transaction) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	r.transactions[tx.ID] = *tx
+	r.events = append(r.events, transactionUpdatedEvent(tx))
 	return nil
 }
 
-func (r *InMemoryRepo) DeleteTransaction(id string) error {
+func (r *InMemoryRepo) DeleteTransaction(ctx context.Context, id string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, ok := r.transactions[id]; !ok {
+	if !r.deleteTransaction(id) {
 		return errors.New("transaction not found")
 	}
-	delete(r.transactions, id)
 	return nil
 }
+
+func dueDateOf(stmt *Statement) time.Time {
+	if stmt.PaymentDueDate == nil {
+		return time.Time{}
+	}
+	return *stmt.PaymentDueDate
+}
+
+func (r *InMemoryRepo) SaveStatementWithDelta(ctx context.Context, statement *Statement, delta TransactionDelta) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sourceTaken(statement) {
+		return ErrDuplicateSource
+	}
+	for _, tx := range delta.Upserts {
+		r.transactions[tx.ID] = tx
+	}
+	for _, id := range delta.Deletes {
+		r.deleteTransaction(id)
+	}
+	r.upsertStatement(statement)
+	return nil
+}
+
+func (r *InMemoryRepo) BulkUpsertTransactions(ctx context.Context, transactions []Transaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, tx := range transactions {
+		r.transactions[tx.ID] = tx
+	}
+	return nil
+}
+
+func (r *InMemoryRepo) BulkDeleteTransactions(ctx context.Context, ids []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range ids {
+		r.deleteTransaction(id)
+	}
+	return nil
+}
+
+func (r *InMemoryRepo) PendingEvents(ctx context.Context, limit int) ([]ChangeEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]ChangeEvent(nil), r.events[:min(limit, len(r.events))]...), nil
+}
+
+// MarkDispatched drops the events, there is nothing to keep them for in memory.
+func (r *InMemoryRepo) MarkDispatched(ctx context.Context, ids []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dispatched := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		dispatched[id] = true
+	}
+	remaining := r.events[:0]
+	for _, e := range r.events {
+		if !dispatched[e.ID] {
+			remaining = append(remaining, e)
+		}
+	}
+	r.events = remaining
+	return nil
+}
+
+func (r *InMemoryRepo) RecordAudit(ctx context.Context, entries []AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.audit = append(r.audit, entries...)
+	return nil
+}
+
+func (r *InMemoryRepo) AuditHistory(ctx context.Context, entityID string, limit int) ([]AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []AuditEntry{}
+	for i := len(r.audit) - 1; i >= 0 && len(result) < limit; i-- {
+		if r.audit[i].EntityID == entityID {
+			result = append(result, r.audit[i])
+		}
+	}
+	return result, nil
+}
+
+func (r *InMemoryRepo) EraseAudit(ctx context.Context, entityIDs []string, actor string) (deleted, anonymized int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	erased := make(map[string]bool, len(entityIDs))
+	for _, id := range entityIDs {
+		erased[id] = true
+	}
+	kept := r.audit[:0]
+	for _, entry := range r.audit {
+		if erased[entry.EntityID] {
+			deleted++
+			continue
+		}
+		if entry.Actor == actor {
+			entry.Actor = ErasedActor
+			anonymized++
+		}
+		kept = append(kept, entry)
+	}
+	r.audit = kept
+	return deleted, anonymized, nil
+}
+
+func (r *InMemoryRepo) TransactionsByID(ctx context.Context, ids []string) ([]Transaction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []Transaction
+	for _, id := range ids {
+		if tx, ok := r.transactions[id]; ok {
+			result = append(result, tx)
+		}
+	}
+	return result, nil
+}
+
+func (r *InMemoryRepo) EraseOwned(ctx context.Context, statementIDs []string) (Erased, error) {
+	if UserFrom(ctx) == "" {
+		return Erased{}, ErrUnscopedErasure
+	}
+	ids := make(map[string]bool, len(statementIDs))
+	for _, id := range statementIDs {
+		ids[id] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var erased Erased
+	remaining := r.events[:0]
+	for _, e := range r.events {
+		if e.erasable(ctx, ids) {
+			erased.Events++
+			continue
+		}
+		remaining = append(remaining, e)
+	}
+	r.events = remaining
+	return erased, nil
+}
@@ -3,6 +3,8 @@ package statements
 import (
 	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,35 +14,123 @@ type StatementType int
 
 const (
 	CreditCardBill StatementType = 1
+	BankStatement  StatementType = 2
 )
 
 type SourceType int
 
 const (
 	CreditCard SourceType = 1
+	// BankAccount statements list what left the account as positive amounts,
+	// like the charges on a card, and have nothing to pay.
+	BankAccount SourceType = 2
 )
 
+type AutopayAmountType int
+
+const (
+	AutopayFullBalance    AutopayAmountType = 1
+	AutopayMinimumPayment AutopayAmountType = 2
+)
+
+// StatementStatus is managed by payment detection, a statement without one is open.
+type StatementStatus string
+
+const (
+	StatusOpen            StatementStatus = ""
+	StatusPaymentDetected StatementStatus = "payment_detected"
+	StatusPaid            StatementStatus = "paid"
+)
+
+type FeeType int
+
+const (
+	AnnualFee           FeeType = 1
+	LateFee             FeeType = 2
+	ForeignExchangeFee  FeeType = 3
+	CashAdvanceInterest FeeType = 4
+)
+
+func (t FeeType) String() string {
+	switch t {
+	case AnnualFee:
+		return "annual_fee"
+	case LateFee:
+		return "late_fee"
+	case ForeignExchangeFee:
+		return "fx_fee"
+	case CashAdvanceInterest:
+		return "cash_advance_interest"
+	default:
+		return fmt.Sprintf("fee_type_%d", int(t))
+	}
+}
+
+func (t FeeType) Valid() bool {
+	return t >= AnnualFee && t <= CashAdvanceInterest
+}
+
 type Statement struct {
-	ID             string         `bson:"_id" json:"-"`
-	Type           StatementType  `bson:"type" json:"type"`
-	SourceType     SourceType     `bson:"source_type" json:"source_type"`
-	SourceName     string         `bson:"source_name" json:"source_name"`
-	SourceID       *string        `bson:"source_id,omitempty" json:"source_id,omitempty"`
-	TotalAmount    float64        `bson:"total_amount" json:"total_amount"`
-	PreviousAmount *float64       `bson:"previous_amount,omitempty" json:"previous_amount,omitempty"`
-	PreviousPaid   *float64       `bson:"previous_paid,omitempty" json:"previous_paid,omitempty"`
-	PreviousUnpaid *float64       `bson:"previous_unpaid,omitempty" json:"previous_unpaid,omitempty"`
-	CurrentAmount  *float64       `bson:"current_amount,omitempty" json:"current_amount,omitempty"`
-	Currency       string         `bson:"currency" json:"currency"`
-	PaymentDueDate *time.Time     `bson:"payment_due_date,omitempty" json:"payment_due_date,omitempty"`
-	Transactions   *[]Transaction `bson:"transactions,omitempty" json:"transactions,omitempty"`
-	Extra          any            `bson:"extra,omitempty" json:"extra,omitempty"`
+	ID                string            `bson:"_id" json:"-"`
+	Type              StatementType     `bson:"type" json:"type"`
+	SourceType        SourceType        `bson:"source_type" json:"source_type"`
+	SourceName        string            `bson:"source_name" json:"source_name"`
+	SourceID          *string           `bson:"source_id,omitempty" json:"source_id,omitempty"`
+	SourceIndex       string            `bson:"source_index,omitempty" json:"-"` // blind index of an encrypted SourceID
+	TotalAmount       float64           `bson:"total_amount" json:"total_amount"`
+	PreviousAmount    *float64          `bson:"previous_amount,omitempty" json:"previous_amount,omitempty"`
+	PreviousPaid      *float64          `bson:"previous_paid,omitempty" json:"previous_paid,omitempty"`
+	PreviousUnpaid    *float64          `bson:"previous_unpaid,omitempty" json:"previous_unpaid,omitempty"`
+	CurrentAmount     *float64          `bson:"current_amount,omitempty" json:"current_amount,omitempty"`
+	Currency          string            `bson:"currency" json:"currency"`
+	PaymentDueDate    *time.Time        `bson:"payment_due_date,omitempty" json:"payment_due_date,omitempty"`
+	MinimumPaymentDue *float64          `bson:"minimum_payment_due,omitempty" json:"minimum_payment_due,omitempty"`
+	AutopayEnabled    bool              `bson:"autopay_enabled" json:"autopay_enabled"`
+	AutopayAmountType AutopayAmountType `bson:"autopay_amount_type,omitempty" json:"autopay_amount_type,omitempty"`
+	Fees              []FeeItem         `bson:"fees,omitempty" json:"fees,omitempty"`
+	InterestCharged   *float64          `bson:"interest_charged,omitempty" json:"interest_charged,omitempty"`
+	Rewards           *Rewards          `bson:"rewards,omitempty" json:"rewards,omitempty"`
+	Transactions      *[]Transaction    `bson:"transactions,omitempty" json:"transactions,omitempty"`
+	Extra             any               `bson:"extra,omitempty" json:"extra,omitempty"`
+
+	// ContentHash fingerprints the statement as ingested, see contentHash.
+	ContentHash string `bson:"content_hash,omitempty" json:"content_hash,omitempty"`
+	// UserID is the user owning the statement when the API authenticates,
+	// set from the request and never ingested.
+	UserID string `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	// TenantID is the family owning the statement, set like UserID.
+	TenantID string `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+
+	// reminder state, managed by the reminders escalator and never ingested
+	ReminderLevel   int        `bson:"reminder_level,omitempty" json:"reminder_level,omitempty"`
+	ReminderAckedAt *time.Time `bson:"reminder_acked_at,omitempty" json:"reminder_acked_at,omitempty"`
+	// ReminderDigestedAt is when the digest mentioning the statement was sent.
+	ReminderDigestedAt *time.Time `bson:"reminder_digested_at,omitempty" json:"reminder_digested_at,omitempty"`
+
+	// payment state, managed by payment detection and never ingested
+	Status       StatementStatus `bson:"status,omitempty" json:"status,omitempty"`
+	PaidAt       *time.Time      `bson:"paid_at,omitempty" json:"paid_at,omitempty"`
+	PaymentMatch *PaymentMatch   `bson:"payment_match,omitempty" json:"payment_match,omitempty"`
+
+	// reconciliation state, set when the reconciliation report finds the
+	// transactions add up to the total and cleared when the statement is
+	// posted again; ReconciledAt is when it was last found reconciled
+	Reconciled   bool       `bson:"reconciled" json:"reconciled,omitempty"`
+	ReconciledAt *time.Time `bson:"reconciled_at,omitempty" json:"reconciled_at,omitempty"`
+
+	// paidTransition marks an update that closed the statement, so the
+	// repository records statement.paid instead of statement.updated.
+	paidTransition bool
 }
 
 func (b *Statement) Normalize() error {
-	if b.SourceName == "" || b.TotalAmount <= 0 || b.Currency == "" {
+	if b.SourceName == "" || b.Currency == "" {
 		return errors.New("invalid statement: missing required fields")
 	}
+	// a negative total is a credit balance (more refunds than charges)
+	if math.IsNaN(b.TotalAmount) || math.IsInf(b.TotalAmount, 0) {
+		return errors.New("invalid statement: total amount is not a number")
+	}
 
 	b.GenerateID()
 
@@ -48,8 +138,39 @@ func (b *Statement) Normalize() error {
 		b.Transactions = &[]Transaction{}
 	}
 
+	if b.MinimumPaymentDue != nil && *b.MinimumPaymentDue < 0 {
+		return errors.New("invalid statement: minimum payment due must not be negative")
+	}
+	if b.AutopayEnabled && b.AutopayAmountType == 0 {
+		b.AutopayAmountType = AutopayFullBalance
+	}
+	if b.AutopayAmountType != 0 && b.AutopayAmountType != AutopayFullBalance && b.AutopayAmountType != AutopayMinimumPayment {
+		return fmt.Errorf("invalid statement: unknown autopay amount type %d", b.AutopayAmountType)
+	}
+
+	for i := range b.Fees {
+		if err := b.Fees[i].Normalize(); err != nil {
+			return fmt.Errorf("invalid fee at index %d: %w", i, err)
+		}
+	}
+	if b.InterestCharged != nil && *b.InterestCharged < 0 {
+		return errors.New("invalid statement: interest charged must not be negative")
+	}
+
+	if b.Rewards == nil {
+		b.Rewards = sumTransactionRewards(*b.Transactions)
+	}
+	if b.Rewards != nil {
+		if err := b.Rewards.Normalize(); err != nil {
+			return fmt.Errorf("invalid rewards: %w", err)
+		}
+	}
+
 	for i, detail := range *b.Transactions {
+		detail.ID = ownedTransactionID(Owner(b.TenantID, b.UserID), detail.ID)
 		detail.StatementID = b.ID
+		detail.TenantID, detail.UserID = b.TenantID, b.UserID
+		detail.inferForeign(b.Currency)
 
 		err := detail.Normalize()
 		if err != nil {
@@ -58,14 +179,21 @@ func (b *Statement) Normalize() error {
 		(*b.Transactions)[i] = detail
 	}
 
-	if len(*b.Transactions) == 0 && b.TotalAmount > 0 {
+	if len(*b.Transactions) == 0 && b.TotalAmount != 0 {
+		date := time.Now().UTC()
+		if b.PaymentDueDate != nil {
+			date = b.PaymentDueDate.UTC()
+		}
 		b.Transactions = &[]Transaction{
 			{
 				ID:          b.ID,
 				Description: "Total Amount",
 				Amount:      b.TotalAmount,
-				Date:        b.PaymentDueDate.UTC(),
+				Date:        date,
 				StatementID: b.ID,
+				SpendType:   SpendMerchant,
+				UserID:      b.UserID,
+				TenantID:    b.TenantID,
 			},
 		}
 	}
@@ -73,6 +201,38 @@ func (b *Statement) Normalize() error {
 	return nil
 }
 
+// IsCredit reports whether the issuer owes the holder, i.e. refunds exceeded
+// charges. The credit carries over into the next statement.
+func (b *Statement) IsCredit() bool {
+	return b.TotalAmount < 0
+}
+
+func (b *Statement) IsPaid() bool {
+	return b.Status == StatusPaid
+}
+
+// AmountToPay is what has to be paid by the due date: the minimum payment when
+// autopay only covers the minimum, the total amount otherwise, and nothing for
+// a credit balance.
+func (b *Statement) AmountToPay() float64 {
+	if b.IsCredit() {
+		return 0
+	}
+	if b.AutopayAmountType == AutopayMinimumPayment && b.MinimumPaymentDue != nil {
+		return *b.MinimumPaymentDue
+	}
+	return b.TotalAmount
+}
+
+// NeedsManualPayment reports whether the user has to act before the due date.
+// Statements settled by full-balance autopay or with nothing to pay need no reminder.
+func (b *Statement) NeedsManualPayment() bool {
+	if b.SourceType == BankAccount || b.IsPaid() || b.AmountToPay() <= 0 {
+		return false
+	}
+	return !b.AutopayEnabled || b.AutopayAmountType != AutopayFullBalance
+}
+
 func (b *Statement) GenerateID() {
 	if b.ID == "" {
 		switch {
@@ -85,28 +245,139 @@ func (b *Statement) GenerateID() {
 		default:
 			b.ID = fmt.Sprintf("%s_%s", b.SourceName, uuid.NewString())
 		}
+		b.ID = OwnedID(Owner(b.TenantID, b.UserID), b.ID)
 	}
 }
 
 type Transaction struct {
-	ID            string         `bson:"_id" json:"id"`
-	Description   string         `bson:"description" json:"description"`
-	Amount        float64        `bson:"amount" json:"amount"`
-	Date          time.Time      `bson:"date" json:"date"`
-	StatementID   string         `bson:"statement_id,omitempty" json:"-"`
-	PaymentSource *PaymentSource `bson:"payment_source,omitempty" json:"-"`
-	Extra         any            `bson:"extra,omitempty" json:"extra,omitempty"`
+	ID              string         `bson:"_id" json:"id"`
+	Description     string         `bson:"description" json:"description"`
+	Category        string         `bson:"category,omitempty" json:"category,omitempty"`
+	Currency        string         `bson:"currency,omitempty" json:"currency,omitempty"`
+	MerchantCity    string         `bson:"merchant_city,omitempty" json:"merchant_city,omitempty"`
+	MerchantCountry string         `bson:"merchant_country,omitempty" json:"merchant_country,omitempty"`
+	IsForeign       *bool          `bson:"is_foreign,omitempty" json:"is_foreign,omitempty"`
+	Amount          float64        `bson:"amount" json:"amount"`
+	Date            time.Time      `bson:"date" json:"date"`
+	StatementID     string         `bson:"statement_id,omitempty" json:"-"`
+	PaymentSource   *PaymentSource `bson:"payment_source,omitempty" json:"payment_source,omitempty"`
+	Rewards         *TxRewards     `bson:"rewards,omitempty" json:"rewards,omitempty"`
+	ExternalRefs    []ExternalRef  `bson:"external_refs,omitempty" json:"external_refs,omitempty"`
+	// SpendType is derived at normalization unless the fetcher sets it.
+	SpendType SpendType `bson:"spend_type,omitempty" json:"spend_type,omitempty"`
+	// Owner is the person the expense is for, empty when it is shared by the
+	// household; PaidBy is the person whose money paid it. Both name the
+	// users as the X-Actor identity does.
+	Owner  string `bson:"owner,omitempty" json:"owner,omitempty"`
+	PaidBy string `bson:"paid_by,omitempty" json:"paid_by,omitempty"`
+	// Dispute is managed through the dispute endpoints, never ingested.
+	Dispute *Dispute `bson:"dispute,omitempty" json:"dispute,omitempty"`
+	Extra   any      `bson:"extra,omitempty" json:"extra,omitempty"`
+
+	// BlindIndexes are opaque tokens a client computes from the values it
+	// encrypts, e.g. an HMAC of the description, so equal values can be found
+	// by equality without the server reading them.
+	BlindIndexes []string `bson:"blind_indexes,omitempty" json:"blind_indexes,omitempty"`
+	// UserID and TenantID are the user and family owning the statement of
+	// the transaction.
+	UserID   string `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	TenantID string `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
 }
 
 func (bd *Transaction) Normalize() error {
+	// payment links are found by linkCardPayments, never ingested
 	if bd.PaymentSource != nil {
 		bd.PaymentSource = nil
 	}
+	bd.Dispute = nil
+	bd.ExternalRefs = normalizeExternalRefs(bd.ExternalRefs)
+	bd.Owner, bd.PaidBy = strings.TrimSpace(bd.Owner), strings.TrimSpace(bd.PaidBy)
+	if bd.SpendType != "" && !bd.SpendType.Valid() {
+		return fmt.Errorf("unknown spend type %q", bd.SpendType)
+	}
+	bd.SpendType = ClassifySpend(bd)
 	return nil
 }
 
+// inferForeign derives IsForeign from the transaction currency when the
+// fetcher did not report it explicitly.
+func (bd *Transaction) inferForeign(statementCurrency string) {
+	bd.MerchantCountry = strings.ToUpper(strings.TrimSpace(bd.MerchantCountry))
+	bd.Currency = strings.ToUpper(strings.TrimSpace(bd.Currency))
+	if bd.IsForeign != nil || bd.Currency == "" || statementCurrency == "" {
+		return
+	}
+	isForeign := !strings.EqualFold(bd.Currency, statementCurrency)
+	bd.IsForeign = &isForeign
+}
+
+// PaymentSource links a bank transaction paying a card to the card statement
+// it settles, and to the credit the card listed for it when there is one. The
+// money is counted once, as the card transactions; filter the linked
+// transfers out of bank spending with TransactionFilter.IsTransfer.
 type PaymentSource struct {
 	Type          string `bson:"type" json:"type"`
 	TransactionID string `bson:"transaction_id" json:"transaction_id"`
 	StatementID   string `bson:"statement_id" json:"statement_id"`
 }
+
+type Rewards struct {
+	PointsEarned     float64    `bson:"points_earned" json:"points_earned"`
+	PointsRedeemed   float64    `bson:"points_redeemed" json:"points_redeemed"`
+	PointsBalance    *float64   `bson:"points_balance,omitempty" json:"points_balance,omitempty"`
+	PointsExpiring   float64    `bson:"points_expiring" json:"points_expiring"`
+	PointsExpiryDate *time.Time `bson:"points_expiry_date,omitempty" json:"points_expiry_date,omitempty"`
+	Cashback         float64    `bson:"cashback" json:"cashback"`
+}
+
+func (r *Rewards) Normalize() error {
+	if r.PointsRedeemed < 0 || r.PointsExpiring < 0 {
+		return errors.New("redeemed and expiring points must not be negative")
+	}
+	if r.PointsExpiryDate != nil {
+		expiry := r.PointsExpiryDate.UTC()
+		r.PointsExpiryDate = &expiry
+	}
+	return nil
+}
+
+type TxRewards struct {
+	Points   float64 `bson:"points" json:"points"`
+	Cashback float64 `bson:"cashback" json:"cashback"`
+}
+
+func sumTransactionRewards(transactions []Transaction) *Rewards {
+	var rewards *Rewards
+	for _, tx := range transactions {
+		if tx.Rewards == nil {
+			continue
+		}
+		if rewards == nil {
+			rewards = &Rewards{}
+		}
+		rewards.PointsEarned += tx.Rewards.Points
+		rewards.Cashback += tx.Rewards.Cashback
+	}
+	return rewards
+}
+
+type FeeItem struct {
+	Type        FeeType    `bson:"type" json:"type"`
+	Description string     `bson:"description,omitempty" json:"description,omitempty"`
+	Amount      float64    `bson:"amount" json:"amount"`
+	Date        *time.Time `bson:"date,omitempty" json:"date,omitempty"`
+}
+
+func (f *FeeItem) Normalize() error {
+	if !f.Type.Valid() {
+		return fmt.Errorf("unknown fee type %d", f.Type)
+	}
+	if f.Amount < 0 {
+		return errors.New("fee amount must not be negative")
+	}
+	if f.Date != nil {
+		date := f.Date.UTC()
+		f.Date = &date
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package statements
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestStatementNormalizeAcceptsCreditBalance(t *testing.T) {
+	t.Parallel()
+
+	due := time.Date(2025, 2, 24, 0, 0, 0, 0, time.UTC)
+	stmt := Statement{SourceName: "TSIB", Currency: "TWD", TotalAmount: -500, PaymentDueDate: &due}
+
+	if err := stmt.Normalize(); err != nil {
+		t.Fatalf("Normalize() error = %v", err)
+	}
+	if !stmt.IsCredit() {
+		t.Errorf("IsCredit() = false, want true")
+	}
+
+	txs := *stmt.Transactions
+	if len(txs) != 1 || txs[0].Amount != -500 || !txs[0].Date.Equal(due) {
+		t.Errorf("placeholder transactions = %+v, want one of -500 on %v", txs, due)
+	}
+}
+
+func TestStatementNormalizePlaceholderWithoutDueDate(t *testing.T) {
+	t.Parallel()
+
+	stmt := Statement{SourceName: "TSIB", Currency: "TWD", TotalAmount: -20}
+	if err := stmt.Normalize(); err != nil {
+		t.Fatalf("Normalize() error = %v", err)
+	}
+	if txs := *stmt.Transactions; len(txs) != 1 || txs[0].Date.IsZero() {
+		t.Errorf("placeholder transactions = %+v, want one dated transaction", txs)
+	}
+}
+
+func TestStatementNormalizeZeroTotalHasNoPlaceholder(t *testing.T) {
+	t.Parallel()
+
+	stmt := Statement{SourceName: "TSIB", Currency: "TWD"}
+	if err := stmt.Normalize(); err != nil {
+		t.Fatalf("Normalize() error = %v", err)
+	}
+	if len(*stmt.Transactions) != 0 {
+		t.Errorf("transactions = %+v, want none", *stmt.Transactions)
+	}
+}
+
+func TestStatementNormalizeRejectsInvalidTotals(t *testing.T) {
+	t.Parallel()
+
+	for _, total := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		stmt := Statement{SourceName: "TSIB", Currency: "TWD", TotalAmount: total}
+		if err := stmt.Normalize(); err == nil {
+			t.Errorf("Normalize() with total %v: expected error", total)
+		}
+	}
+}
+
+func TestStatementAmountToPay(t *testing.T) {
+	t.Parallel()
+
+	minimum := 100.0
+	tests := []struct {
+		name       string
+		stmt       Statement
+		wantAmount float64
+		wantManual bool
+	}{
+		{"charges", Statement{TotalAmount: 700}, 700, true},
+		{"credit balance", Statement{TotalAmount: -500}, 0, false},
+		{"credit with minimum autopay", Statement{TotalAmount: -500, MinimumPaymentDue: &minimum, AutopayEnabled: true, AutopayAmountType: AutopayMinimumPayment}, 0, false},
+		{"full autopay", Statement{TotalAmount: 700, AutopayEnabled: true, AutopayAmountType: AutopayFullBalance}, 700, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tt.stmt.AmountToPay(); got != tt.wantAmount {
+				t.Errorf("AmountToPay() = %v, want %v", got, tt.wantAmount)
+			}
+			if got := tt.stmt.NeedsManualPayment(); got != tt.wantManual {
+				t.Errorf("NeedsManualPayment() = %v, want %v", got, tt.wantManual)
+			}
+		})
+	}
+}
+
+func TestTransactionNormalizeClassifiesSpend(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		tx   Transaction
+		want SpendType
+	}{
+		{"merchant", Transaction{Description: "7-ELEVEN TAIPEI", Amount: 85}, SpendMerchant},
+		{"annual fee", Transaction{Description: "年費", Amount: 1200}, SpendFee},
+		{"fx fee", Transaction{Description: "國外交易服務費", Amount: 15}, SpendFee},
+		{"interest", Transaction{Description: "循環利息", Amount: 42}, SpendInterest},
+		{"card payment", Transaction{Description: "自動扣繳 THANK YOU", Amount: -5000}, SpendTransfer},
+		{"refund", Transaction{Description: "AMAZON RETURN", Amount: -300}, SpendRefund},
+		{"fetcher type kept", Transaction{Description: "ANNUAL FEE", Amount: 1200, SpendType: SpendMerchant}, SpendMerchant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.tx.Normalize(); err != nil {
+				t.Fatalf("Normalize() error = %v", err)
+			}
+			if tt.tx.SpendType != tt.want {
+				t.Errorf("SpendType = %q, want %q", tt.tx.SpendType, tt.want)
+			}
+		})
+	}
+
+	invalid := Transaction{Description: "x", Amount: 1, SpendType: "gift"}
+	if err := invalid.Normalize(); err == nil {
+		t.Error("Normalize() accepted an unknown spend type")
+	}
+}
@@ -0,0 +1,193 @@
+package statements
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const archiveBatchSize = 100
+
+// archiveCollections is the cold tier. Archived statements and their
+// transactions leave the hot collections, so indexes and aggregations only
+// cover recent data; GetStatement and GetTransactions read both tiers.
+type archiveCollections struct {
+	statements   *mongo.Collection
+	transactions *mongo.Collection
+}
+
+// ArchivePolicy moves statements due more than After ago into the archive.
+type ArchivePolicy struct {
+	After    time.Duration
+	Interval time.Duration
+}
+
+// ArchivePolicyFromEnv reads ARCHIVE_AFTER_YEARS (0, the default, disables
+// archiving) and ARCHIVE_INTERVAL_HOURS.
+func ArchivePolicyFromEnv() (ArchivePolicy, bool) {
+	years := envInt("ARCHIVE_AFTER_YEARS", 0)
+	if years <= 0 {
+		return ArchivePolicy{}, false
+	}
+	return ArchivePolicy{
+		After:    time.Duration(years) * 365 * 24 * time.Hour,
+		Interval: time.Duration(envInt("ARCHIVE_INTERVAL_HOURS", 24)) * time.Hour,
+	}, true
+}
+
+// Archive moves the statements due before cutoff with their transactions into
+// the archive and returns how many it moved. Each statement moves in one
+// transaction; without transactions the archive copy is written first and the
+// hot documents deleted last, so an interrupted run is completed by the next.
+func (r *MongoRepo) Archive(ctx context.Context, cutoff time.Time) (int, error) {
+	archived := 0
+	for {
+		ids, err := r.archivableStatements(ctx, cutoff)
+		if err != nil || len(ids) == 0 {
+			return archived, err
+		}
+		for _, id := range ids {
+			if err := r.archiveStatement(ctx, id); err != nil {
+				return archived, err
+			}
+			archived++
+		}
+		if len(ids) < archiveBatchSize {
+			return archived, nil
+		}
+	}
+}
+
+func (r *MongoRepo) archivableStatements(ctx context.Context, cutoff time.Time) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
+	defer cancel()
+
+	cursor, err := r.statementCol.Find(ctx, bson.M{"payment_due_date": bson.M{"$lt": cutoff}},
+		options.Find().SetProjection(bson.M{"_id": 1}).SetLimit(archiveBatchSize))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(docs))
+	for i := range docs {
+		ids[i] = docs[i].ID
+	}
+	return ids, nil
+}
+
+func (r *MongoRepo) archiveStatement(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
+	defer cancel()
+
+	return r.inTransaction(ctx, func(ctx context.Context) error {
+		var stmt bson.Raw
+		if err := r.statementCol.FindOne(ctx, bson.M{"_id": id}).Decode(&stmt); err != nil {
+			return err
+		}
+		txs, err := findRaw(ctx, r.transactionCol, bson.M{"statement_id": id})
+		if err != nil {
+			return err
+		}
+
+		if len(txs) > 0 {
+			models := make([]mongo.WriteModel, len(txs))
+			for i, tx := range txs {
+				models[i] = mongo.NewReplaceOneModel().
+					SetFilter(bson.M{"_id": tx.Lookup("_id")}).
+					SetReplacement(tx).
+					SetUpsert(true)
+			}
+			if _, err := r.archive.transactions.BulkWrite(ctx, models); err != nil {
+				return err
+			}
+		}
+		if _, err := r.archive.statements.ReplaceOne(ctx, bson.M{"_id": id}, stmt, options.Replace().SetUpsert(true)); err != nil {
+			return err
+		}
+
+		if _, err := r.transactionCol.DeleteMany(ctx, bson.M{"statement_id": id}); err != nil {
+			return err
+		}
+		_, err = r.statementCol.DeleteOne(ctx, bson.M{"_id": id})
+		return err
+	})
+}
+
+func findRaw(ctx context.Context, col *mongo.Collection, filter bson.M) ([]bson.Raw, error) {
+	cursor, err := col.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []bson.Raw
+	for cursor.Next(ctx) {
+		docs = append(docs, append(bson.Raw(nil), cursor.Current...))
+	}
+	return docs, cursor.Err()
+}
+
+// EraseOwned deletes the archived statements and transactions of the owner
+// ctx is scoped to, and the change events carrying their data.
+func (r *MongoRepo) EraseOwned(ctx context.Context, statementIDs []string) (Erased, error) {
+	if UserFrom(ctx) == "" {
+		return Erased{}, ErrUnscopedErasure
+	}
+	var erased Erased
+	var err error
+	if erased.TransactionIDs, err = deleteOwned(ctx, r.archive.transactions, OwnerFilter(ctx, bson.M{})); err != nil {
+		return erased, err
+	}
+	if erased.StatementIDs, err = deleteOwned(ctx, r.archive.statements, OwnerFilter(ctx, bson.M{})); err != nil {
+		return erased, err
+	}
+
+	result, err := r.outboxCol.DeleteMany(ctx, bson.M{"$and": bson.A{
+		bson.M{"$or": bson.A{
+			OwnerFilter(ctx, bson.M{}),
+			bson.M{"statement_id": bson.M{"$in": append(statementIDs, erased.StatementIDs...)}},
+		}},
+		bson.M{"$or": bson.A{
+			bson.M{"statement": bson.M{"$exists": true}},
+			bson.M{"transaction": bson.M{"$exists": true}},
+		}},
+	}})
+	if err != nil {
+		return erased, err
+	}
+	erased.Events = int(result.DeletedCount)
+	return erased, nil
+}
+
+// deleteOwned deletes the documents matching filter and returns their IDs.
+func deleteOwned(ctx context.Context, col *mongo.Collection, filter bson.M) ([]string, error) {
+	cursor, err := col.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, len(docs))
+	for i := range docs {
+		ids[i] = docs[i].ID
+	}
+	_, err = col.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return ids, err
+}
@@ -0,0 +1,75 @@
+package statements
+
+import (
+	"context"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (r *MongoRepo) RecordAudit(ctx context.Context, entries []AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
+	defer cancel()
+
+	docs := make([]any, len(entries))
+	for i := range entries {
+		docs[i] = entries[i]
+	}
+	_, err := r.auditCol.InsertMany(ctx, docs)
+	return err
+}
+
+func (r *MongoRepo) AuditHistory(ctx context.Context, entityID string, limit int) ([]AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
+	defer cancel()
+
+	cursor, err := r.auditCol.Find(ctx, bson.M{"entity_id": entityID}, options.Find().
+		SetSort(bson.D{{Key: "at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *MongoRepo) EraseAudit(ctx context.Context, entityIDs []string, actor string) (deleted, anonymized int, err error) {
+	for batch := range slices.Chunk(entityIDs, 1000) {
+		res, err := r.auditCol.DeleteMany(ctx, bson.M{"entity_id": bson.M{"$in": batch}})
+		if err != nil {
+			return deleted, anonymized, err
+		}
+		deleted += int(res.DeletedCount)
+	}
+	res, err := r.auditCol.UpdateMany(ctx, bson.M{"actor": actor}, bson.M{"$set": bson.M{"actor": ErasedActor}})
+	if err != nil {
+		return deleted, anonymized, err
+	}
+	return deleted, int(res.ModifiedCount), nil
+}
+
+func (r *MongoRepo) TransactionsByID(ctx context.Context, ids []string) ([]Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
+	defer cancel()
+
+	cursor, err := r.transactionCol.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
@@ -0,0 +1,120 @@
+package statements
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/health"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/auth"
+)
+
+// Classes of MongoDB connection errors, as logged and reported by the health
+// check.
+const (
+	MongoErrAuth        = "authentication"
+	MongoErrUnreachable = "unreachable"
+	MongoErrConfig      = "configuration"
+	MongoErrOther       = "server"
+)
+
+// ClassifyMongoError tells bad credentials from an unreachable server. The
+// driver reports a failed handshake as a server selection error, so the auth
+// check comes first.
+func ClassifyMongoError(err error) string {
+	var authErr *auth.Error
+	var cmdErr mongo.CommandError
+	msg := strings.ToLower(err.Error())
+	switch {
+	case errors.As(err, &authErr),
+		errors.As(err, &cmdErr) && (cmdErr.Code == 13 || cmdErr.Code == 18), // Unauthorized, AuthenticationFailed
+		strings.Contains(msg, "auth error"),
+		strings.Contains(msg, "authentication failed"):
+		return MongoErrAuth
+	case IsUnavailableError(err):
+		return MongoErrUnreachable
+	default:
+		return MongoErrOther
+	}
+}
+
+// MongoHealth pings the primary in the background and reports down while it
+// cannot be reached, which makes /healthz answer 503 so the instance is taken
+// out of rotation until the database is back.
+type MongoHealth struct {
+	client  *mongo.Client
+	timeout time.Duration
+
+	mu       sync.Mutex
+	checked  time.Time
+	latency  time.Duration
+	err      error
+	failures int
+}
+
+func NewMongoHealth(client *mongo.Client, timeout time.Duration) *MongoHealth {
+	return &MongoHealth{client: client, timeout: timeout}
+}
+
+// Run pings now and then every interval.
+func (h *MongoHealth) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		h.ping(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *MongoHealth) ping(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	start := time.Now()
+	err := h.client.Ping(ctx, readpref.Primary())
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	wasDown := h.err != nil
+	h.checked, h.latency, h.err = start.UTC(), time.Since(start), err
+	if err != nil {
+		h.failures++
+		if !wasDown {
+			slog.Error("MongoDB health check failed", "class", ClassifyMongoError(err), "error", err)
+		}
+		return
+	}
+	if wasDown {
+		slog.Info("MongoDB is reachable again", "failed_checks", h.failures)
+	}
+	h.failures = 0
+}
+
+func (h *MongoHealth) Check() (string, map[string]string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.checked.IsZero() {
+		return health.StatusOK, map[string]string{"last_check": "pending"}
+	}
+	details := map[string]string{
+		"last_check": h.checked.Format(time.RFC3339),
+		"latency":    h.latency.Round(time.Millisecond).String(),
+	}
+	if h.err != nil {
+		details["error"] = h.err.Error()
+		details["error_class"] = ClassifyMongoError(h.err)
+		details["failed_checks"] = strconv.Itoa(h.failures)
+		return health.StatusDown, details
+	}
+	return health.StatusOK, details
+}
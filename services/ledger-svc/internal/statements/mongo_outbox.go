@@ -0,0 +1,54 @@
+package statements
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (r *MongoRepo) recordEvents(ctx context.Context, events []ChangeEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	docs := make([]any, len(events))
+	for i := range events {
+		docs[i] = events[i]
+	}
+	_, err := r.outboxCol.InsertMany(ctx, docs)
+	return err
+}
+
+func (r *MongoRepo) PendingEvents(ctx context.Context, limit int) ([]ChangeEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
+	defer cancel()
+
+	cursor, err := r.outboxCol.Find(ctx, bson.M{"dispatched": false}, options.Find().
+		SetSort(bson.D{{Key: "occurred_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var events []ChangeEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// MarkDispatched keeps the events with a dispatched_at timestamp, the TTL index
+// of the outbox migration removes them after a week.
+func (r *MongoRepo) MarkDispatched(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
+	defer cancel()
+
+	_, err := r.outboxCol.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}},
+		bson.M{"$set": bson.M{"dispatched": true, "dispatched_at": time.Now().UTC()}})
+	return err
+}
@@ -0,0 +1,175 @@
+package statements
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoDateFormats are the $dateToString formats of the derived date fields.
+var mongoDateFormats = map[string]string{"year": "%Y", "month": "%Y-%m", "day": "%Y-%m-%d"}
+
+// QueryTransactions runs a validated query as an aggregation pipeline.
+func (r *MongoRepo) QueryTransactions(ctx context.Context, q Query) ([]Row, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
+	defer cancel()
+
+	opts := options.Aggregate()
+	if r.queryCfg.BatchSize > 0 {
+		opts.SetBatchSize(r.queryCfg.BatchSize)
+	}
+	if r.queryCfg.MaxTime > 0 {
+		opts.SetMaxTime(r.queryCfg.MaxTime)
+	}
+	cursor, err := r.transactionCol.Aggregate(ctx, queryPipeline(q), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rows := []Row{}
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		row := make(Row, len(doc))
+		for k, v := range doc {
+			row[k] = rowValue(v)
+		}
+		for _, f := range q.Fields {
+			if _, ok := row[f]; !ok && len(q.Aggregates) == 0 {
+				// an unset is_foreign is left out of the projection
+				row[f] = nil
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, cursor.Err()
+}
+
+func queryPipeline(q Query) mongo.Pipeline {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: transactionQuery(q.Filter)}}}
+
+	derived := bson.D{}
+	for field, format := range mongoDateFormats {
+		derived = append(derived, bson.E{Key: field, Value: bson.M{"$dateToString": bson.M{"format": format, "date": "$date", "timezone": "UTC"}}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: derived}})
+
+	if len(q.Conditions) > 0 {
+		match := bson.A{}
+		for _, c := range q.Conditions {
+			match = append(match, bson.M{documentField(c.Field): conditionValue(c)})
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"$and": match}}})
+	}
+
+	project := bson.D{{Key: "_id", Value: 0}}
+	if len(q.Aggregates) > 0 {
+		keys := bson.D{}
+		for _, f := range q.Groups {
+			keys = append(keys, bson.E{Key: f, Value: fieldExpr(f)})
+			project = append(project, bson.E{Key: f, Value: "$_id." + f})
+		}
+		group := bson.D{{Key: "_id", Value: keys}}
+		for _, a := range q.Aggregates {
+			var acc bson.M
+			if a.Func == AggCount {
+				acc = bson.M{"$sum": 1}
+			} else {
+				acc = bson.M{"$" + string(a.Func): "$" + documentField(a.Field)}
+			}
+			group = append(group, bson.E{Key: a.As, Value: acc})
+			project = append(project, bson.E{Key: a.As, Value: 1})
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$group", Value: group}})
+	} else {
+		for _, f := range q.Fields {
+			project = append(project, bson.E{Key: f, Value: fieldExpr(f)})
+		}
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$project", Value: project}})
+
+	if len(q.Sort) > 0 {
+		sort := bson.D{}
+		for _, s := range q.Sort {
+			order := 1
+			if s.Desc {
+				order = -1
+			}
+			sort = append(sort, bson.E{Key: s.Field, Value: order})
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sort}})
+	}
+	if q.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: q.Limit}})
+	}
+	return pipeline
+}
+
+// documentField is the stored field of a query field, the derived date fields
+// being added to the documents under their own name.
+func documentField(field string) string {
+	if stored := queryFields[field]; stored != "" {
+		return stored
+	}
+	return field
+}
+
+// textQueryFields are omitted from the documents when empty.
+var textQueryFields = map[string]bool{
+	"statement_id": true, "description": true, "category": true,
+	"currency": true, "merchant_city": true, "merchant_country": true,
+	"spend_type": true, "owner": true, "paid_by": true,
+}
+
+// fieldExpr reads a field for grouping and projection, an omitted text field
+// as the empty string like EvaluateQuery does.
+func fieldExpr(field string) any {
+	if textQueryFields[field] {
+		return bson.M{"$ifNull": bson.A{"$" + documentField(field), ""}}
+	}
+	return "$" + documentField(field)
+}
+
+// conditionValue translates a condition, matching the empty string to the
+// missing field as well since empty text fields are omitted when stored.
+func conditionValue(c Condition) any {
+	if s, ok := c.Value.(string); ok && s == "" && (c.Op == OpEq || c.Op == OpNe) {
+		empty := bson.M{"$in": bson.A{"", nil}}
+		if c.Op == OpNe {
+			return bson.M{"$not": empty}
+		}
+		return empty
+	}
+	switch c.Op {
+	case OpEq:
+		return bson.M{"$eq": c.Value}
+	case OpContains:
+		s, _ := c.Value.(string)
+		return primitive.Regex{Pattern: regexp.QuoteMeta(s), Options: "i"}
+	default:
+		return bson.M{"$" + string(c.Op): c.Value}
+	}
+}
+
+// rowValue converts the decoded values to the types EvaluateQuery returns.
+func rowValue(v any) any {
+	switch x := v.(type) {
+	case primitive.DateTime:
+		return x.Time().UTC()
+	case int32:
+		return int(x)
+	case int64:
+		return int(x)
+	case time.Time:
+		return x.UTC()
+	}
+	return v
+}
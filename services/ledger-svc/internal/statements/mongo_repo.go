@@ -3,33 +3,108 @@ package statements
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
 )
 
 type MongoRepo struct {
 	db             *mongo.Database
+	namespace      string
 	statementCol   *mongo.Collection
 	transactionCol *mongo.Collection
+	outboxCol      *mongo.Collection
+	auditCol       *mongo.Collection
+	archive        archiveCollections
+	queryCfg       MongoQueryConfig
 }
 
-func NewMongoRepo(db *mongo.Database) *MongoRepo {
+// MongoQueryConfig bounds every query with Timeout (on top of the caller's
+// deadline) and tunes the read queries on large collections.
+// When IndexHints is enabled the following indexes must exist:
+//   - transactions: { statement_id: 1, _id: 1 }
+//   - statements:   { source_name: 1, payment_due_date: 1 }
+type MongoQueryConfig struct {
+	Timeout    time.Duration
+	BatchSize  int32
+	MaxTime    time.Duration
+	IndexHints bool
+}
+
+var (
+	transactionsByStatementIndex = bson.D{{Key: "statement_id", Value: 1}, {Key: "_id", Value: 1}}
+	statementsBySourceIndex      = bson.D{{Key: "source_name", Value: 1}, {Key: "payment_due_date", Value: 1}}
+)
+
+// NewMongoRepo prefixes every collection name with namespace so several
+// environments (e.g. "staging_") can share one database.
+func NewMongoRepo(db *mongo.Database, namespace string, queryCfg MongoQueryConfig) *MongoRepo {
+	// audit snapshots decode as maps so they encode back to JSON objects
+	auditOpts := options.Collection().SetBSONOptions(&options.BSONOptions{DefaultDocumentM: true})
 	return &MongoRepo{
 		db:             db,
-		statementCol:   db.Collection("statements"),
-		transactionCol: db.Collection("transactions"),
+		namespace:      namespace,
+		statementCol:   db.Collection(namespace + "statements"),
+		transactionCol: db.Collection(namespace + "transactions"),
+		outboxCol:      db.Collection(namespace + "outbox"),
+		auditCol:       db.Collection(namespace+"audit_log", auditOpts),
+		archive: archiveCollections{
+			statements:   db.Collection(namespace + "statements_archive"),
+			transactions: db.Collection(namespace + "transactions_archive"),
+		},
+		queryCfg: queryCfg,
+	}
+}
+
+func (r *MongoRepo) Describe() map[string]string {
+	return map[string]string{
+		"storage":   "mongo",
+		"db":        r.db.Name(),
+		"namespace": r.namespace,
+	}
+}
+
+func (r *MongoRepo) Database() *mongo.Database {
+	return r.db
+}
+
+func (r *MongoRepo) Namespace() string {
+	return r.namespace
+}
+
+// Close disconnects the client, shared by every store of the database, once
+// nothing uses it anymore.
+func (r *MongoRepo) Close(ctx context.Context) error {
+	return r.db.Client().Disconnect(ctx)
+}
+
+func (r *MongoRepo) findOptions(hint bson.D) *options.FindOptions {
+	opts := options.Find()
+	if r.queryCfg.BatchSize > 0 {
+		opts.SetBatchSize(r.queryCfg.BatchSize)
 	}
+	if r.queryCfg.MaxTime > 0 {
+		opts.SetMaxTime(r.queryCfg.MaxTime)
+	}
+	if r.queryCfg.IndexHints && hint != nil {
+		opts.SetHint(hint)
+	}
+	return opts
 }
 
-func (r *MongoRepo) GetStatement(id string) (*Statement, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (r *MongoRepo) GetStatement(ctx context.Context, id string) (*Statement, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
 	defer cancel()
 
 	var stmt Statement
 	err := r.statementCol.FindOne(ctx, bson.M{"_id": id}).Decode(&stmt)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		err = r.archive.statements.FindOne(ctx, bson.M{"_id": id}).Decode(&stmt)
+	}
 	if errors.Is(err, mongo.ErrNoDocuments) {
 		return nil, nil
 	}
@@ -39,22 +114,97 @@ func (r *MongoRepo) GetStatement(id string) (*Statement, error) {
 	return &stmt, nil
 }
 
-func (r *MongoRepo) UpsertStatement(statement *Statement) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (r *MongoRepo) ListStatements(ctx context.Context, filter StatementFilter) ([]Statement, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
 	defer cancel()
 
-	_, err := r.statementCol.UpdateByID(ctx, statement.ID, bson.M{"$set": statement},
-		options.Update().SetUpsert(true))
-	return err
+	query := bson.M{}
+	var hint bson.D
+	if filter.SourceName != "" {
+		query["source_name"] = filter.SourceName
+		hint = statementsBySourceIndex
+	}
+	if filter.TenantID != "" {
+		query["tenant_id"] = filter.TenantID
+	}
+	if filter.UserID != "" {
+		query["user_id"] = filter.UserID
+	}
+
+	cursor, err := r.statementCol.Find(ctx, query,
+		r.findOptions(hint).SetSort(bson.D{{Key: "payment_due_date", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var statements []Statement
+	if err := cursor.All(ctx, &statements); err != nil {
+		return nil, err
+	}
+	return statements, nil
 }
 
-func (r *MongoRepo) GetTransactions(statementId string) ([]Transaction, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (r *MongoRepo) UpsertStatement(ctx context.Context, statement *Statement) error {
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
 	defer cancel()
 
-	cursor, err := r.transactionCol.Find(ctx, bson.M{
-		"statement_id": statementId,
+	return r.inTransaction(ctx, func(ctx context.Context) error {
+		var events []ChangeEvent
+		if err := r.upsertStatement(ctx, statement, &events); err != nil {
+			return err
+		}
+		return r.recordEvents(ctx, events)
 	})
+}
+
+// DeleteStatement removes the transactions before the statement, so without
+// multi-document transactions an interrupted delete can be retried.
+func (r *MongoRepo) DeleteStatement(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
+	defer cancel()
+
+	return r.inTransaction(ctx, func(ctx context.Context) error {
+		owner := bson.M{"tenant_id": 1, "user_id": 1}
+		txs, err := findTransactions(ctx, r.transactionCol, id, options.Find().SetProjection(owner))
+		if err != nil {
+			return err
+		}
+		var events []ChangeEvent
+		if len(txs) > 0 {
+			if _, err := r.transactionCol.DeleteMany(ctx, bson.M{"statement_id": id}); err != nil {
+				return err
+			}
+			for _, tx := range txs {
+				events = append(events, transactionDeletedEvent(id, tx.ID).ownedBy(tx.TenantID, tx.UserID))
+			}
+		}
+
+		var stmt Statement
+		err = r.statementCol.FindOneAndDelete(ctx, bson.M{"_id": id}, options.FindOneAndDelete().SetProjection(owner)).Decode(&stmt)
+		switch {
+		case err == nil:
+			events = append(events, statementDeletedEvent(id).ownedBy(stmt.TenantID, stmt.UserID))
+		case !errors.Is(err, mongo.ErrNoDocuments):
+			return err
+		}
+		return r.recordEvents(ctx, events)
+	})
+}
+
+func (r *MongoRepo) GetTransactions(ctx context.Context, statementId string) ([]Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
+	defer cancel()
+
+	transactions, err := findTransactions(ctx, r.transactionCol, statementId, r.findOptions(transactionsByStatementIndex))
+	if err != nil || len(transactions) > 0 {
+		return transactions, err
+	}
+	return findTransactions(ctx, r.archive.transactions, statementId, options.Find())
+}
+
+func findTransactions(ctx context.Context, col *mongo.Collection, statementID string, opts *options.FindOptions) ([]Transaction, error) {
+	cursor, err := col.Find(ctx, bson.M{"statement_id": statementID}, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -67,25 +217,251 @@ func (r *MongoRepo) GetTransactions(statementId string) ([]Transaction, error) {
 	return transactions, nil
 }
 
-func (r *MongoRepo) UpsertTransaction(tx *Transaction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (r *MongoRepo) ListTransactions(ctx context.Context, filter TransactionFilter, page Page) ([]Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
 	defer cancel()
 
-	_, err := r.transactionCol.UpdateByID(ctx, tx.ID, bson.M{"$set": tx},
-		options.Update().SetUpsert(true))
-	return err
+	query := transactionQuery(filter)
+	if page.After != "" {
+		query["_id"] = bson.M{"$gt": page.After}
+	}
+
+	var hint bson.D
+	if filter.StatementID != "" {
+		hint = transactionsByStatementIndex
+	}
+
+	opts := r.findOptions(hint).
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(int64(page.Limit))
+
+	cursor, err := r.transactionCol.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
 }
 
-func (r *MongoRepo) DeleteTransaction(id string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (r *MongoRepo) FindTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
 	defer cancel()
 
-	result, err := r.transactionCol.DeleteOne(ctx, bson.M{"_id": id})
+	cursor, err := r.transactionCol.Find(ctx, transactionQuery(filter),
+		r.findOptions(nil).SetSort(bson.D{{Key: "date", Value: 1}}))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var transactions []Transaction
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+func transactionQuery(filter TransactionFilter) bson.M {
+	query := bson.M{}
+	if filter.StatementID != "" {
+		query["statement_id"] = filter.StatementID
+	}
+	if filter.TenantID != "" {
+		query["tenant_id"] = filter.TenantID
+	}
+	if filter.UserID != "" {
+		query["user_id"] = filter.UserID
+	}
+	if filter.MerchantCountry != "" {
+		query["merchant_country"] = strings.ToUpper(filter.MerchantCountry)
+	}
+	if filter.IsForeign != nil {
+		query["is_foreign"] = *filter.IsForeign
+	}
+	if filter.ExternalRef != "" {
+		ref := bson.M{"value": filter.ExternalRef}
+		if filter.ExternalRefType != "" {
+			ref["type"] = strings.ToLower(filter.ExternalRefType)
+		}
+		query["external_refs"] = bson.M{"$elemMatch": ref}
+	}
+	if filter.BlindIndex != "" {
+		query["blind_indexes"] = filter.BlindIndex
+	}
+	if filter.IsTransfer != nil {
+		query["payment_source"] = bson.M{"$exists": *filter.IsTransfer}
+	}
+	if filter.SpendType != "" {
+		query["spend_type"] = filter.SpendType
+	}
+	if len(filter.DisputeStatuses) > 0 {
+		query["dispute.status"] = bson.M{"$in": filter.DisputeStatuses}
+	}
+
+	dateRange := bson.M{}
+	if !filter.From.IsZero() {
+		dateRange["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		dateRange["$lt"] = filter.To
+	}
+	if len(dateRange) > 0 {
+		query["date"] = dateRange
+	}
+	return query
+}
+
+func (r *MongoRepo) UpsertTransaction(ctx context.Context, tx *Transaction) error {
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
+	defer cancel()
+
+	return r.inTransaction(ctx, func(ctx context.Context) error {
+		_, err := r.transactionCol.UpdateByID(ctx, tx.ID, bson.M{"$set": tx},
+			options.Update().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+		return r.recordEvents(ctx, []ChangeEvent{transactionUpdatedEvent(tx)})
+	})
+}
+
+func (r *MongoRepo) DeleteTransaction(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
+	defer cancel()
+
+	return r.inTransaction(ctx, func(ctx context.Context) error {
+		var tx Transaction
+		err := r.transactionCol.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&tx)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return errors.New("transaction not found")
+		}
+		if err != nil {
+			return err
+		}
+		return r.recordEvents(ctx, []ChangeEvent{transactionDeletedEvent(tx.StatementID, id).ownedBy(tx.TenantID, tx.UserID)})
+	})
+}
+
+func (r *MongoRepo) BulkUpsertTransactions(ctx context.Context, transactions []Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
+	defer cancel()
+
+	_, err := r.transactionCol.BulkWrite(ctx, upsertModels(transactions), options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (r *MongoRepo) BulkDeleteTransactions(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
+	defer cancel()
+
+	return r.inTransaction(ctx, func(ctx context.Context) error {
+		// read the statements first, the events name the statement of each deleted transaction
+		cursor, err := r.transactionCol.Find(ctx, bson.M{"_id": bson.M{"$in": ids}},
+			options.Find().SetProjection(bson.M{"statement_id": 1, "tenant_id": 1, "user_id": 1}))
+		if err != nil {
+			return err
+		}
+		var existing []Transaction
+		if err := cursor.All(ctx, &existing); err != nil {
+			return err
+		}
+		if len(existing) == 0 {
+			return nil
+		}
+
+		if _, err := r.transactionCol.BulkWrite(ctx, []mongo.WriteModel{deleteModel(ids)}); err != nil {
+			return err
+		}
+		events := make([]ChangeEvent, 0, len(existing))
+		for _, tx := range existing {
+			events = append(events, transactionDeletedEvent(tx.StatementID, tx.ID).ownedBy(tx.TenantID, tx.UserID))
+		}
+		return r.recordEvents(ctx, events)
+	})
+}
+
+func upsertModels(transactions []Transaction) []mongo.WriteModel {
+	models := make([]mongo.WriteModel, 0, len(transactions))
+	for _, tx := range transactions {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": tx.ID}).
+			SetUpdate(bson.M{"$set": tx}).
+			SetUpsert(true))
+	}
+	return models
+}
+
+func deleteModel(ids []string) mongo.WriteModel {
+	return mongo.NewDeleteManyModel().SetFilter(bson.M{"_id": bson.M{"$in": ids}})
+}
+
+// IsUnavailableError reports whether err means MongoDB could not be reached,
+// or was not tried while the circuit is open, as opposed to a rejected query
+// or write.
+func IsUnavailableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var selectionErr topology.ServerSelectionError
+	return errors.Is(err, ErrCircuitOpen) ||
+		mongo.IsNetworkError(err) ||
+		mongo.IsTimeout(err) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, mongo.ErrClientDisconnected) ||
+		errors.As(err, &selectionErr)
+}
+
+// transientServerCodes are replica set state changes, e.g. a primary election
+// during Atlas maintenance, after which the same command succeeds.
+var transientServerCodes = []int{
+	6,     // HostUnreachable
+	7,     // HostNotFound
+	89,    // NetworkTimeout
+	91,    // ShutdownInProgress
+	189,   // PrimarySteppedDown
+	9001,  // SocketException
+	10107, // NotWritablePrimary
+	11600, // InterruptedAtShutdown
+	11602, // InterruptedDueToReplStateChange
+	13435, // NotPrimaryNoSecondaryOk
+	13436, // NotPrimaryOrSecondary
+}
+
+// IsTransientError reports whether err is worth retrying: network errors, server
+// selection failures and errors the server labels or codes as retryable.
+// Context cancellation and deadlines are never retried, nor is a command that
+// ran out of its server time limit (ExceededTimeLimit), it would again.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var selectionErr topology.ServerSelectionError
+	if mongo.IsNetworkError(err) || errors.As(err, &selectionErr) {
+		return true
+	}
+
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+	if serverErr.HasErrorLabel("RetryableWriteError") || serverErr.HasErrorLabel("TransientTransactionError") {
+		return true
 	}
-	if result.DeletedCount == 0 {
-		return errors.New("transaction not found")
+	for _, code := range transientServerCodes {
+		if serverErr.HasErrorCode(code) {
+			return true
+		}
 	}
-	return nil
+	return false
 }
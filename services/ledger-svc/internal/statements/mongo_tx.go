@@ -0,0 +1,100 @@
+package statements
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// standaloneServer is set once the server rejected a multi-document transaction.
+var standaloneServer atomic.Bool
+
+// inTransaction runs fn inside a multi-document transaction, so readers never
+// observe a partial write and the outbox events are committed with the change
+// they describe.
+//
+// Multi-document transactions need a replica set or sharded cluster. On a
+// standalone server (the usual local docker setup) fn runs without one, so
+// every fn orders its writes to stay repairable by re-posting the statement.
+func (r *MongoRepo) inTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if standaloneServer.Load() {
+		return fn(ctx)
+	}
+
+	session, err := r.db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		return nil, fn(sc)
+	})
+	if isTransactionUnsupported(err) {
+		standaloneServer.Store(true)
+		slog.Warn("MongoDB does not support transactions, falling back to sequential writes", "error", err)
+		return fn(ctx)
+	}
+	return err
+}
+
+// SaveStatementWithDelta writes the statement, its transaction delta and the
+// change events in one transaction. Without transactions the writes are applied
+// transactions first, deletions next and the statement last, so an interrupted
+// save leaves the previous statement document in place.
+func (r *MongoRepo) SaveStatementWithDelta(ctx context.Context, statement *Statement, delta TransactionDelta) error {
+	ctx, cancel := context.WithTimeout(ctx, r.queryCfg.Timeout)
+	defer cancel()
+
+	return r.inTransaction(ctx, func(ctx context.Context) error {
+		return r.applyDelta(ctx, statement, delta)
+	})
+}
+
+func (r *MongoRepo) applyDelta(ctx context.Context, statement *Statement, delta TransactionDelta) error {
+	models := upsertModels(delta.Upserts)
+	if len(delta.Deletes) > 0 {
+		models = append(models, deleteModel(delta.Deletes))
+	}
+	if len(models) > 0 {
+		if _, err := r.transactionCol.BulkWrite(ctx, models); err != nil {
+			return err
+		}
+	}
+
+	events := make([]ChangeEvent, 0, len(delta.Deletes)+1)
+	for _, id := range delta.Deletes {
+		events = append(events, transactionDeletedEvent(statement.ID, id).ownedBy(statement.TenantID, statement.UserID))
+	}
+	if err := r.upsertStatement(ctx, statement, &events); err != nil {
+		return err
+	}
+	return r.recordEvents(ctx, events)
+}
+
+// upsertStatement writes the statement and appends its created/updated event.
+func (r *MongoRepo) upsertStatement(ctx context.Context, statement *Statement, events *[]ChangeEvent) error {
+	result, err := r.statementCol.UpdateByID(ctx, statement.ID, bson.M{"$set": statement}, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateSource
+	}
+	if err != nil {
+		return err
+	}
+	*events = append(*events, statementEvent(statement, result.UpsertedCount > 0))
+	return nil
+}
+
+func isTransactionUnsupported(err error) bool {
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+	// IllegalOperation: "Transaction numbers are only allowed on a replica set member or mongos"
+	return cmdErr.Code == 20 || cmdErr.HasErrorMessage("Transaction numbers are only allowed")
+}
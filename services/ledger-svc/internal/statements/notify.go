@@ -0,0 +1,43 @@
+package statements
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventTransactionsSynced is told to the notifier when the transactions of a
+// statement were replaced; the outbox covers them with the statement event.
+const EventTransactionsSynced = "transactions.synced"
+
+// Notifier hears about the statements the service saved, in process and right
+// after the write. Unlike the outbox events it is best effort: nothing is told
+// for writes queued while the database is away, nor to other replicas.
+type Notifier interface {
+	Notify(ctx context.Context, event ChangeEvent)
+}
+
+// Notifiers tells every notifier in turn.
+type Notifiers []Notifier
+
+func (n Notifiers) Notify(ctx context.Context, event ChangeEvent) {
+	for _, notifier := range n {
+		notifier.Notify(ctx, event)
+	}
+}
+
+func (s *StatementService) notify(ctx context.Context, event ChangeEvent) {
+	if s.Notifier != nil {
+		s.Notifier.Notify(ctx, event)
+	}
+}
+
+func transactionsSyncedEvent(statementID string) ChangeEvent {
+	return ChangeEvent{
+		ID:          uuid.NewString(),
+		Type:        EventTransactionsSynced,
+		StatementID: statementID,
+		OccurredAt:  time.Now().UTC(),
+	}
+}
@@ -0,0 +1,121 @@
+package statements
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EventStatementCreated   = "statement.created"
+	EventStatementUpdated   = "statement.updated"
+	EventStatementPaid      = "statement.paid"
+	EventStatementDeleted   = "statement.deleted"
+	EventTransactionUpdated = "transaction.updated"
+	EventTransactionDeleted = "transaction.deleted"
+)
+
+// ChangeEvent is written to the outbox together with the change it describes
+// and published later by the events dispatcher, at least once.
+type ChangeEvent struct {
+	ID            string       `bson:"_id" json:"id"`
+	Type          string       `bson:"type" json:"type"`
+	StatementID   string       `bson:"statement_id,omitempty" json:"statement_id,omitempty"`
+	TransactionID string       `bson:"transaction_id,omitempty" json:"transaction_id,omitempty"`
+	Statement     *Statement   `bson:"statement,omitempty" json:"statement,omitempty"`
+	Transaction   *Transaction `bson:"transaction,omitempty" json:"transaction,omitempty"`
+	// TenantID and UserID are the owner of the statement the event is about,
+	// the webhooks and live subscribers of other owners never see it.
+	TenantID     string     `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+	UserID       string     `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	OccurredAt   time.Time  `bson:"occurred_at" json:"occurred_at"`
+	Dispatched   bool       `bson:"dispatched" json:"-"`
+	DispatchedAt *time.Time `bson:"dispatched_at,omitempty" json:"-"`
+}
+
+// Owner returns the owner of the event, see Owner.
+func (e ChangeEvent) Owner() string {
+	return Owner(e.TenantID, e.UserID)
+}
+
+func (e ChangeEvent) ownedBy(tenantID, userID string) ChangeEvent {
+	e.TenantID, e.UserID = tenantID, userID
+	return e
+}
+
+// Outbox is implemented by repositories that record change events atomically
+// with their writes.
+type Outbox interface {
+	// PendingEvents returns undispatched events, oldest first.
+	PendingEvents(ctx context.Context, limit int) ([]ChangeEvent, error)
+	MarkDispatched(ctx context.Context, ids []string) error
+}
+
+// AsOutbox unwraps repository decorators down to the one recording events.
+func AsOutbox(repo StatementRepository) (Outbox, bool) {
+	for _, layer := range Layers(repo) {
+		if o, ok := layer.(Outbox); ok {
+			return o, true
+		}
+	}
+	return nil, false
+}
+
+func statementEvent(stmt *Statement, created bool) ChangeEvent {
+	snapshot := *stmt
+	snapshot.Transactions = nil
+
+	eventType := EventStatementUpdated
+	switch {
+	case created:
+		eventType = EventStatementCreated
+	case stmt.paidTransition:
+		eventType = EventStatementPaid
+	}
+	return ChangeEvent{
+		ID:          uuid.NewString(),
+		Type:        eventType,
+		StatementID: stmt.ID,
+		Statement:   &snapshot,
+		OccurredAt:  time.Now().UTC(),
+		TenantID:    stmt.TenantID,
+		UserID:      stmt.UserID,
+	}
+}
+
+// transactionUpdatedEvent is recorded for the writes of a single transaction,
+// the edits made through the API; the transactions saved with a statement are
+// covered by its event.
+func transactionUpdatedEvent(tx *Transaction) ChangeEvent {
+	snapshot := *tx
+	return ChangeEvent{
+		ID:            uuid.NewString(),
+		Type:          EventTransactionUpdated,
+		StatementID:   tx.StatementID,
+		TransactionID: tx.ID,
+		Transaction:   &snapshot,
+		OccurredAt:    time.Now().UTC(),
+		TenantID:      tx.TenantID,
+		UserID:        tx.UserID,
+	}
+}
+
+func transactionDeletedEvent(statementID, transactionID string) ChangeEvent {
+	return ChangeEvent{
+		ID:            uuid.NewString(),
+		Type:          EventTransactionDeleted,
+		StatementID:   statementID,
+		TransactionID: transactionID,
+		OccurredAt:    time.Now().UTC(),
+	}
+}
+
+func statementDeletedEvent(statementID string) ChangeEvent {
+	return ChangeEvent{
+		ID:          uuid.NewString(),
+		Type:        EventStatementDeleted,
+		StatementID: statementID,
+		OccurredAt:  time.Now().UTC(),
+	}
+}
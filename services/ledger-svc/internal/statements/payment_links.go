@@ -0,0 +1,159 @@
+package statements
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	// PaymentSourceCardPayment is the PaymentSource type of a bank transaction
+	// paying a card statement.
+	PaymentSourceCardPayment = "card_payment"
+
+	paymentSourceBank = "bank_transaction"
+)
+
+// a card is paid from the bank up to 45 days before its due date and a few
+// days after, the window paymentConfidence rewards
+const (
+	cardPaymentLead  = 45 * 24 * time.Hour
+	cardPaymentGrace = 4 * 24 * time.Hour
+)
+
+// linkCardPayments matches the card payments among the transactions of a bank
+// statement to the card statements they settle, or the other way around for
+// a card statement, whichever arrives last. Each match links the bank
+// transaction to the card statement and records the payment on the card
+// statement, closing it per PAYMENT_AUTOCLOSE.
+func (s *StatementService) linkCardPayments(ctx context.Context, statement *Statement) error {
+	all, err := s.Repo.ListStatements(ctx, StatementFilter{})
+	if err != nil {
+		return err
+	}
+
+	var cards []*Statement
+	banks := make(map[string]bool)
+	for i := range all {
+		switch {
+		case all[i].SourceType == BankAccount:
+			banks[all[i].ID] = true
+		case all[i].PaymentDueDate != nil && all[i].TotalAmount > 0:
+			cards = append(cards, &all[i])
+		}
+	}
+
+	var payments []Transaction
+	var from, to time.Time
+	if statement.SourceType == BankAccount {
+		if statement.Transactions == nil {
+			return nil
+		}
+		for _, tx := range *statement.Transactions {
+			if tx.Amount > 0 {
+				payments = append(payments, tx)
+			}
+		}
+		if len(payments) == 0 {
+			return nil
+		}
+		from, to = payments[0].Date, payments[0].Date
+		for _, tx := range payments {
+			from, to = minTime(from, tx.Date), maxTime(to, tx.Date)
+		}
+		from, to = from.Add(-cardPaymentGrace), to.Add(cardPaymentLead+24*time.Hour)
+	} else {
+		if statement.PaymentDueDate == nil || len(banks) == 0 {
+			return nil
+		}
+		from, to = statement.PaymentDueDate.Add(-cardPaymentLead), statement.PaymentDueDate.Add(cardPaymentGrace)
+		unlinked := false
+		txs, err := s.Repo.FindTransactions(ctx, TransactionFilter{From: from, To: to, IsTransfer: &unlinked})
+		if err != nil {
+			return err
+		}
+		for _, tx := range txs {
+			if banks[tx.StatementID] && tx.Amount > 0 {
+				payments = append(payments, tx)
+			}
+		}
+	}
+
+	// card statements already paid by another bank transaction
+	linked := true
+	transfers, err := s.Repo.FindTransactions(ctx, TransactionFilter{From: from.Add(-cardPaymentGrace), To: to.Add(cardPaymentLead), IsTransfer: &linked})
+	if err != nil {
+		return err
+	}
+	paidBy := make(map[string]string)
+	for _, tx := range transfers {
+		paidBy[tx.PaymentSource.StatementID] = tx.ID
+	}
+
+	now := time.Now().UTC()
+	for _, tx := range payments {
+		card, confidence := s.bestCardStatement(cards, tx, paidBy)
+		if card == nil {
+			continue
+		}
+		paidBy[card.ID] = tx.ID
+
+		tx.PaymentSource = &PaymentSource{Type: PaymentSourceCardPayment, StatementID: card.ID}
+		tx.SpendType = SpendTransfer
+		if card.PaymentMatch != nil && card.PaymentMatch.Source == paymentSourceTransaction {
+			tx.PaymentSource.TransactionID = card.PaymentMatch.Payment.TransactionID
+		}
+		if err := s.Repo.UpsertTransaction(ctx, &tx); err != nil && !errors.Is(err, ErrQueued) {
+			return err
+		}
+
+		payment := Payment{Amount: tx.Amount, Date: tx.Date, Description: tx.Description, TransactionID: tx.ID}
+		if s.applyPayment(card, payment, paymentSourceBank, confidence, now) {
+			if err := s.Repo.UpsertStatement(ctx, card); err != nil && !errors.Is(err, ErrQueued) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// bestCardStatement returns the card statement a bank transaction most
+// likely pays, nil when none clears the payment threshold.
+func (s *StatementService) bestCardStatement(cards []*Statement, tx Transaction, paidBy map[string]string) (*Statement, float64) {
+	payment := Payment{Amount: tx.Amount, Date: tx.Date, Description: tx.Description}
+	var best *Statement
+	var bestConfidence float64
+	for _, card := range cards {
+		if by, ok := paidBy[card.ID]; ok && by != tx.ID {
+			continue
+		}
+		due := *card.PaymentDueDate
+		if tx.Date.Before(due.Add(-cardPaymentLead)) || !tx.Date.Before(due.Add(cardPaymentGrace)) {
+			continue
+		}
+		confidence := paymentConfidence(card, payment, false)
+		if confidence == 0 || confidence < s.Payments.Threshold || confidence < bestConfidence {
+			continue
+		}
+		// on a tie, the statement due first is paid first
+		if best != nil && confidence == bestConfidence && !due.Before(*best.PaymentDueDate) {
+			continue
+		}
+		best, bestConfidence = card, confidence
+	}
+	return best, bestConfidence
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
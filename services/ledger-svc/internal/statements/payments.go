@@ -0,0 +1,221 @@
+package statements
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+var ErrNothingToConfirm = apierror.New(apierror.KindConflict, "nothing_to_confirm", "statement has no detected payment to confirm")
+
+type PaymentCloseMode string
+
+const (
+	// PaymentCloseAuto marks matching statements paid right away.
+	PaymentCloseAuto PaymentCloseMode = "auto"
+	// PaymentCloseConfirm holds matches as payment_detected until confirmed.
+	PaymentCloseConfirm PaymentCloseMode = "confirm"
+	PaymentCloseOff     PaymentCloseMode = "off"
+)
+
+type PaymentConfig struct {
+	Mode      PaymentCloseMode
+	Threshold float64
+}
+
+var DefaultPaymentConfig = PaymentConfig{Mode: PaymentCloseAuto, Threshold: 0.8}
+
+// PaymentConfigFromEnv reads PAYMENT_AUTOCLOSE (auto, confirm or off) and
+// PAYMENT_AUTOCLOSE_THRESHOLD (0-1).
+func PaymentConfigFromEnv() (PaymentConfig, error) {
+	cfg := DefaultPaymentConfig
+	if v := os.Getenv("PAYMENT_AUTOCLOSE"); v != "" {
+		switch mode := PaymentCloseMode(v); mode {
+		case PaymentCloseAuto, PaymentCloseConfirm, PaymentCloseOff:
+			cfg.Mode = mode
+		default:
+			return cfg, fmt.Errorf("invalid PAYMENT_AUTOCLOSE %q, expected auto, confirm or off", v)
+		}
+	}
+	if v := os.Getenv("PAYMENT_AUTOCLOSE_THRESHOLD"); v != "" {
+		threshold, err := strconv.ParseFloat(v, 64)
+		if err != nil || threshold < 0 || threshold > 1 {
+			return cfg, fmt.Errorf("invalid PAYMENT_AUTOCLOSE_THRESHOLD %q, expected a number between 0 and 1", v)
+		}
+		cfg.Threshold = threshold
+	}
+	return cfg, nil
+}
+
+// Payment is money paid towards a statement, either reported through the
+// payments API or found as a credit on a later statement.
+type Payment struct {
+	Amount        float64   `json:"amount"`
+	Date          time.Time `json:"date"`
+	Description   string    `json:"description,omitempty"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+}
+
+type PaymentMatch struct {
+	Payment     Payment    `bson:"payment" json:"payment"`
+	Source      string     `bson:"source" json:"source"`
+	Confidence  float64    `bson:"confidence" json:"confidence"`
+	DetectedAt  time.Time  `bson:"detected_at" json:"detected_at"`
+	ConfirmedAt *time.Time `bson:"confirmed_at,omitempty" json:"confirmed_at,omitempty"`
+}
+
+const (
+	paymentSourceAPI         = "api"
+	paymentSourceTransaction = "transaction"
+)
+
+var paymentKeywords = []string{"payment", "thank you", "autopay", "繳款", "扣繳", "還款"}
+
+// paymentConfidence scores how likely payment settles stmt: the amount weighs
+// most (the exact total, the minimum payment or an overpayment), a payment-like
+// description and a date around the due date add to it.
+func paymentConfidence(stmt *Statement, payment Payment, explicit bool) float64 {
+	if stmt.TotalAmount <= 0 {
+		return 0
+	}
+
+	const cent = 0.005
+	var score float64
+	switch {
+	case math.Abs(payment.Amount-stmt.TotalAmount) <= cent:
+		score = 0.7
+	case payment.Amount > stmt.TotalAmount:
+		score = 0.6
+	case stmt.MinimumPaymentDue != nil && math.Abs(payment.Amount-*stmt.MinimumPaymentDue) <= cent:
+		score = 0.4
+	default:
+		// partial payments never close a statement
+		return 0
+	}
+
+	description := strings.ToLower(payment.Description)
+	if explicit || containsAny(description, paymentKeywords) {
+		score += 0.2
+	}
+	if stmt.PaymentDueDate != nil && !payment.Date.IsZero() {
+		due := *stmt.PaymentDueDate
+		if !payment.Date.Before(due.AddDate(0, 0, -45)) && !payment.Date.After(due.AddDate(0, 0, 3)) {
+			score += 0.1
+		}
+	}
+	return math.Round(score*100) / 100
+}
+
+func containsAny(s string, words []string) bool {
+	for _, w := range words {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPayment records the match on stmt when it clears the threshold and
+// reports whether stmt changed.
+func (s *StatementService) applyPayment(stmt *Statement, payment Payment, source string, confidence float64, now time.Time) bool {
+	if s.Payments.Mode == PaymentCloseOff || stmt.IsPaid() || confidence < s.Payments.Threshold {
+		return false
+	}
+	if stmt.PaymentMatch != nil && stmt.PaymentMatch.Confidence >= confidence {
+		return false
+	}
+
+	stmt.PaymentMatch = &PaymentMatch{Payment: payment, Source: source, Confidence: confidence, DetectedAt: now}
+	if s.Payments.Mode == PaymentCloseConfirm {
+		stmt.Status = StatusPaymentDetected
+		return true
+	}
+	markPaid(stmt, now)
+	return true
+}
+
+func markPaid(stmt *Statement, now time.Time) {
+	stmt.Status = StatusPaid
+	stmt.PaidAt = &now
+	stmt.paidTransition = true
+}
+
+// RecordPayment matches a payment reported through the API against a statement.
+func (s *StatementService) RecordPayment(ctx context.Context, statementID string, payment Payment) (*Statement, error) {
+	stmt, err := s.Repo.GetStatement(ctx, statementID)
+	if err != nil || stmt == nil {
+		return nil, err
+	}
+	if payment.Date.IsZero() {
+		payment.Date = time.Now().UTC()
+	}
+
+	confidence := paymentConfidence(stmt, payment, true)
+	if !s.applyPayment(stmt, payment, paymentSourceAPI, confidence, time.Now().UTC()) {
+		return stmt, nil
+	}
+	return stmt, s.Repo.UpsertStatement(ctx, stmt)
+}
+
+// ConfirmPayment closes a statement held as payment_detected.
+func (s *StatementService) ConfirmPayment(ctx context.Context, statementID string) (*Statement, error) {
+	stmt, err := s.Repo.GetStatement(ctx, statementID)
+	if err != nil || stmt == nil {
+		return nil, err
+	}
+	if stmt.Status != StatusPaymentDetected || stmt.PaymentMatch == nil {
+		return stmt, ErrNothingToConfirm
+	}
+
+	now := time.Now().UTC()
+	stmt.PaymentMatch.ConfirmedAt = &now
+	markPaid(stmt, now)
+	return stmt, s.Repo.UpsertStatement(ctx, stmt)
+}
+
+// detectPayments looks for payments of earlier open statements of the same
+// source among the credits of a newly saved statement, the way a card lists
+// the payment received for the previous bill.
+func (s *StatementService) detectPayments(ctx context.Context, statement *Statement) error {
+	if s.Payments.Mode == PaymentCloseOff || statement.SourceType == BankAccount || statement.Transactions == nil || statement.PaymentDueDate == nil {
+		return nil
+	}
+
+	candidates, err := s.Repo.ListStatements(ctx, StatementFilter{SourceName: statement.SourceName})
+	if err != nil {
+		return err
+	}
+
+	// latest open statement first, each credit settles at most one statement
+	now := time.Now().UTC()
+	used := make(map[string]bool)
+	for i := len(candidates) - 1; i >= 0; i-- {
+		open := &candidates[i]
+		if open.ID == statement.ID || open.IsPaid() || open.PaymentDueDate == nil || !open.PaymentDueDate.Before(*statement.PaymentDueDate) {
+			continue
+		}
+
+		for _, tx := range *statement.Transactions {
+			if tx.Amount >= 0 || used[tx.ID] {
+				continue
+			}
+			payment := Payment{Amount: -tx.Amount, Date: tx.Date, Description: tx.Description, TransactionID: tx.ID}
+			if !s.applyPayment(open, payment, paymentSourceTransaction, paymentConfidence(open, payment, false), now) {
+				continue
+			}
+			used[tx.ID] = true
+			if err := s.Repo.UpsertStatement(ctx, open); err != nil && !errors.Is(err, ErrQueued) {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,378 @@
+package statements
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const postgresDriver = "postgres"
+
+func init() {
+	RegisterDriver(postgresDriver, openPostgresFromEnv)
+}
+
+// pgUniqueViolation is the SQLSTATE of a unique index conflict.
+const pgUniqueViolation = "23505"
+
+// postgresSchema creates the tables on first use. The documents are kept as
+// JSONB in data, the columns only hold what is queried or unique.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS statements (
+	id           text PRIMARY KEY,
+	tenant_id    text NOT NULL DEFAULT '',
+	user_id      text NOT NULL DEFAULT '',
+	source_name  text NOT NULL DEFAULT '',
+	source_key   text NOT NULL DEFAULT '',
+	source_index text NOT NULL DEFAULT '',
+	due_date     timestamptz NOT NULL,
+	data         jsonb NOT NULL
+);
+CREATE INDEX IF NOT EXISTS statements_source_due ON statements (source_name, due_date);
+CREATE UNIQUE INDEX IF NOT EXISTS statements_owner_source ON statements (tenant_id, user_id, source_key) WHERE source_key <> '';
+CREATE TABLE IF NOT EXISTS transactions (
+	id           text PRIMARY KEY,
+	statement_id text NOT NULL,
+	date         timestamptz NOT NULL,
+	data         jsonb NOT NULL
+);
+CREATE INDEX IF NOT EXISTS transactions_statement ON transactions (statement_id, id);
+`
+
+// PostgresRepo stores statements and transactions in the statements and
+// transactions tables of POSTGRES_URL. Filters other than the statement and
+// source are applied while reading, like DynamoRepo. Change events are not
+// recorded, PostgresRepo has no outbox.
+type PostgresRepo struct {
+	pool    *pgxpool.Pool
+	timeout time.Duration
+}
+
+func NewPostgresRepo(pool *pgxpool.Pool, timeout time.Duration) *PostgresRepo {
+	return &PostgresRepo{
+		pool:    pool,
+		timeout: timeout,
+	}
+}
+
+func openPostgresFromEnv() (StatementRepository, error) {
+	url := os.Getenv("POSTGRES_URL")
+	if url == "" {
+		return nil, errors.New("POSTGRES_URL is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), envDuration("POSTGRES_CONNECT_TIMEOUT_MS", 10*time.Second))
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pool.Exec(ctx, postgresSchema); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("create schema: %w", err)
+	}
+	repo, err := cacheFromEnv(NewPostgresRepo(pool, envDuration("POSTGRES_QUERY_TIMEOUT_MS", 5*time.Second)))
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (r *PostgresRepo) Describe() map[string]string {
+	cfg := r.pool.Config().ConnConfig
+	return map[string]string{
+		"storage":  "postgres",
+		"host":     cfg.Host,
+		"database": cfg.Database,
+	}
+}
+
+// pgQuerier is the part of a pool or transaction the writes use.
+type pgQuerier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func scanStatement(row pgx.Row) (Statement, error) {
+	var stmt Statement
+	var id, sourceIndex string
+	var data []byte
+	if err := row.Scan(&id, &sourceIndex, &data); err != nil {
+		return stmt, err
+	}
+	if err := json.Unmarshal(data, &stmt); err != nil {
+		return stmt, err
+	}
+	stmt.ID = id
+	stmt.SourceIndex = sourceIndex
+	return stmt, nil
+}
+
+func scanTransaction(row pgx.Row) (Transaction, error) {
+	var tx Transaction
+	var statementID string
+	var data []byte
+	if err := row.Scan(&statementID, &data); err != nil {
+		return tx, err
+	}
+	if err := json.Unmarshal(data, &tx); err != nil {
+		return tx, err
+	}
+	tx.StatementID = statementID
+	return tx, nil
+}
+
+func (r *PostgresRepo) GetStatement(ctx context.Context, id string) (*Statement, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	stmt, err := scanStatement(r.pool.QueryRow(ctx, `SELECT id, source_index, data FROM statements WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stmt, nil
+}
+
+func (r *PostgresRepo) ListStatements(ctx context.Context, filter StatementFilter) ([]Statement, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx, `SELECT id, source_index, data FROM statements
+		WHERE ($1 = '' OR source_name = $1) AND ($2 = '' OR tenant_id = $2) AND ($3 = '' OR user_id = $3)
+		ORDER BY due_date, id`, filter.SourceName, filter.TenantID, filter.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statements []Statement
+	for rows.Next() {
+		stmt, err := scanStatement(rows)
+		if err != nil {
+			return nil, err
+		}
+		if !filter.Match(&stmt) {
+			continue
+		}
+		statements = append(statements, stmt)
+	}
+	return statements, rows.Err()
+}
+
+func (r *PostgresRepo) UpsertStatement(ctx context.Context, statement *Statement) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return upsertStatement(ctx, r.pool, statement)
+}
+
+func upsertStatement(ctx context.Context, q pgQuerier, stmt *Statement) error {
+	doc := *stmt
+	doc.Transactions = nil
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	// the unique key is the blind index of an encrypted source ID, the
+	// plaintext source ID otherwise
+	sourceKey := stmt.SourceIndex
+	if sourceKey == "" && stmt.SourceID != nil {
+		sourceKey = *stmt.SourceID
+	}
+	_, err = q.Exec(ctx, `INSERT INTO statements (id, tenant_id, user_id, source_name, source_key, source_index, due_date, data)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET tenant_id = $2, user_id = $3, source_name = $4, source_key = $5, source_index = $6, due_date = $7, data = $8`,
+		stmt.ID, stmt.TenantID, stmt.UserID, stmt.SourceName, sourceKey, stmt.SourceIndex, dueDateOf(stmt).UTC(), data)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return ErrDuplicateSource
+	}
+	return err
+}
+
+func (r *PostgresRepo) DeleteStatement(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM transactions WHERE statement_id = $1`, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `DELETE FROM statements WHERE id = $1`, id)
+		return err
+	})
+}
+
+func (r *PostgresRepo) GetTransactions(ctx context.Context, statementId string) ([]Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return r.queryTransactions(ctx, TransactionFilter{StatementID: statementId}, "", 0, "id")
+}
+
+func (r *PostgresRepo) ListTransactions(ctx context.Context, filter TransactionFilter, page Page) ([]Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return r.queryTransactions(ctx, filter, page.After, page.Limit, "id")
+}
+
+func (r *PostgresRepo) FindTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return r.queryTransactions(ctx, filter, "", 0, "date, id")
+}
+
+// queryTransactions reads the transactions after the given ID in order, of one
+// statement or across statements, and applies the rest of the filter while
+// reading. A limit of 0 reads everything.
+func (r *PostgresRepo) queryTransactions(ctx context.Context, filter TransactionFilter, after string, limit int, order string) ([]Transaction, error) {
+	rows, err := r.pool.Query(ctx, `SELECT statement_id, data FROM transactions
+		WHERE ($1 = '' OR statement_id = $1) AND id > $2
+		AND ($3::timestamptz IS NULL OR date >= $3) AND ($4::timestamptz IS NULL OR date < $4)
+		ORDER BY `+order,
+		filter.StatementID, after, nullTime(filter.From), nullTime(filter.To))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []Transaction
+	for rows.Next() {
+		tx, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		if !filter.Match(&tx) {
+			continue
+		}
+		transactions = append(transactions, tx)
+		if limit > 0 && len(transactions) == limit {
+			break
+		}
+	}
+	return transactions, rows.Err()
+}
+
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// TransactionsByID reads the transactions with the IDs, whoever owns them, so
+// ScopedRepo can check the owner before a write.
+func (r *PostgresRepo) TransactionsByID(ctx context.Context, ids []string) ([]Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx, `SELECT statement_id, data FROM transactions WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transactions []Transaction
+	for rows.Next() {
+		tx, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, tx)
+	}
+	return transactions, rows.Err()
+}
+
+func (r *PostgresRepo) UpsertTransaction(ctx context.Context, tx *Transaction) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return upsertTransaction(ctx, r.pool, tx)
+}
+
+func upsertTransaction(ctx context.Context, q pgQuerier, tx *Transaction) error {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(ctx, `INSERT INTO transactions (id, statement_id, date, data) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET statement_id = $2, date = $3, data = $4`,
+		tx.ID, tx.StatementID, tx.Date.UTC(), data)
+	return err
+}
+
+func (r *PostgresRepo) DeleteTransaction(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	tag, err := r.pool.Exec(ctx, `DELETE FROM transactions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.New("transaction not found")
+	}
+	return nil
+}
+
+func (r *PostgresRepo) BulkUpsertTransactions(ctx context.Context, transactions []Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		for i := range transactions {
+			if err := upsertTransaction(ctx, tx, &transactions[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *PostgresRepo) BulkDeleteTransactions(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	_, err := r.pool.Exec(ctx, `DELETE FROM transactions WHERE id = ANY($1)`, ids)
+	return err
+}
+
+// SaveStatementWithDelta writes the statement and its transaction delta in one
+// database transaction.
+func (r *PostgresRepo) SaveStatementWithDelta(ctx context.Context, statement *Statement, delta TransactionDelta) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		for i := range delta.Upserts {
+			if err := upsertTransaction(ctx, tx, &delta.Upserts[i]); err != nil {
+				return err
+			}
+		}
+		if len(delta.Deletes) > 0 {
+			if _, err := tx.Exec(ctx, `DELETE FROM transactions WHERE statement_id = $1 AND id = ANY($2)`, statement.ID, delta.Deletes); err != nil {
+				return err
+			}
+		}
+		return upsertStatement(ctx, tx, statement)
+	})
+}
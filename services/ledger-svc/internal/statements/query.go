@@ -0,0 +1,474 @@
+package statements
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+var ErrInvalidQuery = apierror.New(apierror.KindInvalid, "invalid_query", "invalid query")
+
+// Query is a read over the transactions for analytics, written once and run
+// by whichever backend holds the data: a filter, then either a projection to
+// some fields or aggregates per group, sorted and limited. Build it with
+// NewQuery and the chained methods, e.g.
+//
+//	NewQuery(filter).Where("category", OpEq, "Food").GroupBy("month").
+//		Sum("amount", "total").OrderBy("month", false)
+//
+// The fields are the stored transaction fields by their JSON names plus the
+// ones derived from the date in UTC, year ("2006"), month ("2006-01") and day
+// ("2006-01-02").
+type Query struct {
+	Filter     TransactionFilter
+	Conditions []Condition
+	// Fields are the fields of the rows without aggregates, all stored fields
+	// when empty.
+	Fields     []string
+	Groups     []string
+	Aggregates []Aggregate
+	Sort       []SortField
+	Limit      int
+}
+
+type Op string
+
+const (
+	OpEq  Op = "eq"
+	OpNe  Op = "ne"
+	OpGt  Op = "gt"
+	OpGte Op = "gte"
+	OpLt  Op = "lt"
+	OpLte Op = "lte"
+	// OpIn takes a []any of the values.
+	OpIn Op = "in"
+	// OpContains is a case-insensitive substring match of a text field.
+	OpContains Op = "contains"
+)
+
+type Condition struct {
+	Field string
+	Op    Op
+	Value any
+}
+
+type AggregateFunc string
+
+const (
+	AggSum   AggregateFunc = "sum"
+	AggAvg   AggregateFunc = "avg"
+	AggMin   AggregateFunc = "min"
+	AggMax   AggregateFunc = "max"
+	AggCount AggregateFunc = "count"
+)
+
+// Aggregate computes Func over Field (unused by count) into the row field As.
+type Aggregate struct {
+	Func  AggregateFunc
+	Field string
+	As    string
+}
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Row is one result of a query by field name. Dates are time.Time, amounts
+// and aggregates float64, counts int and is_foreign a bool or nil.
+type Row map[string]any
+
+// Querier is implemented by the backends that run queries natively.
+type Querier interface {
+	QueryTransactions(ctx context.Context, q Query) ([]Row, error)
+}
+
+func NewQuery(filter TransactionFilter) Query {
+	return Query{Filter: filter}
+}
+
+func (q Query) Where(field string, op Op, value any) Query {
+	q.Conditions = append(q.Conditions[:len(q.Conditions):len(q.Conditions)], Condition{Field: field, Op: op, Value: value})
+	return q
+}
+
+func (q Query) Select(fields ...string) Query {
+	q.Fields = append(q.Fields[:len(q.Fields):len(q.Fields)], fields...)
+	return q
+}
+
+func (q Query) GroupBy(fields ...string) Query {
+	q.Groups = append(q.Groups[:len(q.Groups):len(q.Groups)], fields...)
+	return q
+}
+
+func (q Query) aggregate(fn AggregateFunc, field, as string) Query {
+	q.Aggregates = append(q.Aggregates[:len(q.Aggregates):len(q.Aggregates)], Aggregate{Func: fn, Field: field, As: as})
+	return q
+}
+
+func (q Query) Sum(field, as string) Query { return q.aggregate(AggSum, field, as) }
+func (q Query) Avg(field, as string) Query { return q.aggregate(AggAvg, field, as) }
+func (q Query) Min(field, as string) Query { return q.aggregate(AggMin, field, as) }
+func (q Query) Max(field, as string) Query { return q.aggregate(AggMax, field, as) }
+func (q Query) Count(as string) Query      { return q.aggregate(AggCount, "", as) }
+
+func (q Query) OrderBy(field string, desc bool) Query {
+	q.Sort = append(q.Sort[:len(q.Sort):len(q.Sort)], SortField{Field: field, Desc: desc})
+	return q
+}
+
+func (q Query) Take(limit int) Query {
+	q.Limit = limit
+	return q
+}
+
+// queryFields maps the field names of a query to the stored document fields;
+// the derived ones have none.
+var queryFields = map[string]string{
+	"id":               "_id",
+	"statement_id":     "statement_id",
+	"date":             "date",
+	"description":      "description",
+	"category":         "category",
+	"currency":         "currency",
+	"merchant_city":    "merchant_city",
+	"merchant_country": "merchant_country",
+	"is_foreign":       "is_foreign",
+	"amount":           "amount",
+	"spend_type":       "spend_type",
+	"owner":            "owner",
+	"paid_by":          "paid_by",
+	"year":             "",
+	"month":            "",
+	"day":              "",
+}
+
+var (
+	storedQueryFields = []string{"id", "statement_id", "date", "description", "category", "currency", "merchant_city", "merchant_country", "is_foreign", "amount", "spend_type", "owner", "paid_by"}
+	dateFormats       = map[string]string{"year": "2006", "month": "2006-01", "day": time.DateOnly}
+)
+
+// Validate checks the field names and operators and fills the default
+// projection.
+func (q *Query) Validate() error {
+	check := func(field string) error {
+		if _, ok := queryFields[field]; !ok {
+			return fmt.Errorf("%w: unknown field %q", ErrInvalidQuery, field)
+		}
+		return nil
+	}
+	for _, c := range q.Conditions {
+		if err := check(c.Field); err != nil {
+			return err
+		}
+		switch c.Op {
+		case OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpContains:
+		case OpIn:
+			if _, ok := c.Value.([]any); !ok {
+				return fmt.Errorf("%w: %s in expects a list", ErrInvalidQuery, c.Field)
+			}
+		default:
+			return fmt.Errorf("%w: unknown operator %q", ErrInvalidQuery, c.Op)
+		}
+	}
+
+	output := map[string]bool{}
+	if len(q.Aggregates) == 0 {
+		if len(q.Groups) > 0 {
+			return fmt.Errorf("%w: grouping needs an aggregate", ErrInvalidQuery)
+		}
+		if len(q.Fields) == 0 {
+			q.Fields = storedQueryFields
+		}
+		for _, f := range q.Fields {
+			if err := check(f); err != nil {
+				return err
+			}
+			output[f] = true
+		}
+	} else {
+		for _, f := range q.Groups {
+			if err := check(f); err != nil {
+				return err
+			}
+			output[f] = true
+		}
+		for _, a := range q.Aggregates {
+			switch a.Func {
+			case AggCount:
+			case AggSum, AggAvg, AggMin, AggMax:
+				if err := check(a.Field); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("%w: unknown aggregate %q", ErrInvalidQuery, a.Func)
+			}
+			if a.As == "" || output[a.As] {
+				return fmt.Errorf("%w: aggregate %s needs a distinct name", ErrInvalidQuery, a.Func)
+			}
+			output[a.As] = true
+		}
+	}
+	for _, s := range q.Sort {
+		if !output[s.Field] {
+			return fmt.Errorf("%w: sort field %q is not in the result", ErrInvalidQuery, s.Field)
+		}
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("%w: negative limit", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// RunQuery runs the query on the first layer of repo that implements Querier,
+// or in process over FindTransactions for the backends that do not.
+// Native queries read the stored documents, bypassing the decorators above
+// the backend, none of which change the queryable fields; the tenant and user
+// of ctx ScopedRepo would enforce are added to the filter here.
+func RunQuery(ctx context.Context, repo StatementRepository, q Query) ([]Row, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	q.Filter.TenantID, q.Filter.UserID = Stamp(ctx, q.Filter.TenantID, q.Filter.UserID)
+	for _, layer := range Layers(repo) {
+		if querier, ok := layer.(Querier); ok {
+			return querier.QueryTransactions(ctx, q)
+		}
+	}
+	txs, err := repo.FindTransactions(ctx, q.Filter)
+	if err != nil {
+		return nil, err
+	}
+	return EvaluateQuery(txs, q), nil
+}
+
+// EvaluateQuery runs a validated query over transactions already matching its
+// filter.
+func EvaluateQuery(txs []Transaction, q Query) []Row {
+	var rows []Row
+	for i := range txs {
+		row := transactionRow(&txs[i])
+		if matchConditions(row, q.Conditions) {
+			rows = append(rows, row)
+		}
+	}
+	if len(q.Aggregates) > 0 {
+		rows = aggregateRows(rows, q.Groups, q.Aggregates)
+	} else {
+		for i, row := range rows {
+			projected := make(Row, len(q.Fields))
+			for _, f := range q.Fields {
+				projected[f] = row[f]
+			}
+			rows[i] = projected
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, s := range q.Sort {
+			if c := compareValues(rows[i][s.Field], rows[j][s.Field]); c != 0 {
+				return (c < 0) != s.Desc
+			}
+		}
+		return false
+	})
+	if q.Limit > 0 && len(rows) > q.Limit {
+		rows = rows[:q.Limit]
+	}
+	if rows == nil {
+		rows = []Row{}
+	}
+	return rows
+}
+
+func transactionRow(tx *Transaction) Row {
+	row := Row{
+		"id":               tx.ID,
+		"statement_id":     tx.StatementID,
+		"date":             tx.Date,
+		"description":      tx.Description,
+		"category":         tx.Category,
+		"currency":         tx.Currency,
+		"merchant_city":    tx.MerchantCity,
+		"merchant_country": tx.MerchantCountry,
+		"is_foreign":       nil,
+		"amount":           tx.Amount,
+		"spend_type":       string(ClassifySpend(tx)),
+		"owner":            tx.Owner,
+		"paid_by":          tx.PaidBy,
+	}
+	if tx.IsForeign != nil {
+		row["is_foreign"] = *tx.IsForeign
+	}
+	for field, layout := range dateFormats {
+		row[field] = tx.Date.UTC().Format(layout)
+	}
+	return row
+}
+
+func matchConditions(row Row, conditions []Condition) bool {
+	for _, c := range conditions {
+		v := row[c.Field]
+		var ok bool
+		switch c.Op {
+		case OpEq:
+			ok = compareValues(v, c.Value) == 0
+		case OpNe:
+			ok = compareValues(v, c.Value) != 0
+		case OpGt:
+			ok = v != nil && compareValues(v, c.Value) > 0
+		case OpGte:
+			ok = v != nil && compareValues(v, c.Value) >= 0
+		case OpLt:
+			ok = v != nil && compareValues(v, c.Value) < 0
+		case OpLte:
+			ok = v != nil && compareValues(v, c.Value) <= 0
+		case OpIn:
+			for _, candidate := range c.Value.([]any) {
+				if compareValues(v, candidate) == 0 {
+					ok = true
+					break
+				}
+			}
+		case OpContains:
+			s, isString := v.(string)
+			sub, _ := c.Value.(string)
+			ok = isString && strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+type aggregateGroup struct {
+	row    Row
+	values []float64
+	counts []int
+}
+
+func aggregateRows(rows []Row, groups []string, aggregates []Aggregate) []Row {
+	byKey := map[string]*aggregateGroup{}
+	var order []*aggregateGroup
+	for _, row := range rows {
+		key := ""
+		for _, f := range groups {
+			key += fmt.Sprintf("%v\x00", row[f])
+		}
+		g, ok := byKey[key]
+		if !ok {
+			g = &aggregateGroup{row: Row{}, values: make([]float64, len(aggregates)), counts: make([]int, len(aggregates))}
+			for _, f := range groups {
+				g.row[f] = row[f]
+			}
+			byKey[key] = g
+			order = append(order, g)
+		}
+		for i, a := range aggregates {
+			if a.Func == AggCount {
+				g.counts[i]++
+				continue
+			}
+			v, isNumber := row[a.Field].(float64)
+			if !isNumber {
+				continue
+			}
+			switch {
+			case g.counts[i] == 0:
+				g.values[i] = v
+			case a.Func == AggMin:
+				g.values[i] = math.Min(g.values[i], v)
+			case a.Func == AggMax:
+				g.values[i] = math.Max(g.values[i], v)
+			default:
+				g.values[i] += v
+			}
+			g.counts[i]++
+		}
+	}
+
+	result := make([]Row, 0, len(order))
+	for _, g := range order {
+		for i, a := range aggregates {
+			switch {
+			case a.Func == AggCount:
+				g.row[a.As] = g.counts[i]
+			case g.counts[i] == 0:
+				g.row[a.As] = nil
+			case a.Func == AggAvg:
+				g.row[a.As] = g.values[i] / float64(g.counts[i])
+			default:
+				g.row[a.As] = g.values[i]
+			}
+		}
+		result = append(result, g.row)
+	}
+	return result
+}
+
+// compareValues orders values of the same kind, nil before anything else;
+// values of different kinds compare by their text.
+func compareValues(a, b any) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+	switch x := a.(type) {
+	case float64:
+		if y, ok := toFloat(b); ok {
+			return cmp.Compare(x, y)
+		}
+	case int:
+		if y, ok := toFloat(b); ok {
+			return cmp.Compare(float64(x), y)
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y)
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0
+			case !x:
+				return -1
+			default:
+				return 1
+			}
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
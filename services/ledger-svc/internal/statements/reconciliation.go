@@ -0,0 +1,132 @@
+package statements
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Reconciliation compares the total of a statement with its stored
+// transactions.
+type Reconciliation struct {
+	StatementID       string  `json:"statement_id"`
+	TotalAmount       float64 `json:"total_amount"`
+	TransactionsTotal float64 `json:"transactions_total"`
+	TransactionCount  int     `json:"transaction_count"`
+	// Placeholder is set when only the total was stored as a transaction, the
+	// transactions were not parsed.
+	Placeholder bool `json:"placeholder,omitempty"`
+	// Discrepancy is the total amount minus the transactions total.
+	Discrepancy float64 `json:"discrepancy"`
+	// BalanceDiscrepancy is the total amount minus the previous unpaid and the
+	// current amount, when the statement reports both.
+	BalanceDiscrepancy *float64 `json:"balance_discrepancy,omitempty"`
+	Tolerance          float64  `json:"tolerance"`
+	// Candidates are amounts the statement reports without a transaction of
+	// that amount, the likely missing ones.
+	Candidates []ReconciliationCandidate `json:"candidates"`
+	// Unexplained is what is left of the discrepancy once every candidate is
+	// added to the transactions.
+	Unexplained float64 `json:"unexplained"`
+	Reconciled  bool    `json:"reconciled"`
+}
+
+type ReconciliationCandidate struct {
+	// Kind is a fee type (annual_fee, late_fee, ...), interest,
+	// previous_unpaid or cashback.
+	Kind        string  `json:"kind"`
+	Description string  `json:"description,omitempty"`
+	Amount      float64 `json:"amount"`
+	// Explains is set when the candidate alone accounts for the discrepancy.
+	Explains bool `json:"explains"`
+}
+
+// Reconcile compares the statement with its transactions. It is reconciled
+// when the transactions add up to the total and, when the statement reports
+// them, the previous unpaid and current amounts do too, within the tolerance.
+func Reconcile(stmt *Statement, txs []Transaction, tolerance float64) *Reconciliation {
+	r := &Reconciliation{
+		StatementID:      stmt.ID,
+		TotalAmount:      stmt.TotalAmount,
+		TransactionCount: len(txs),
+		Placeholder:      len(txs) == 1 && txs[0].ID == stmt.ID,
+		Tolerance:        tolerance,
+		Candidates:       []ReconciliationCandidate{},
+	}
+	for _, tx := range txs {
+		r.TransactionsTotal += tx.Amount
+	}
+	r.TransactionsTotal = round2(r.TransactionsTotal)
+	r.Discrepancy = round2(stmt.TotalAmount - r.TransactionsTotal)
+	r.Reconciled = len(txs) > 0 && math.Abs(r.Discrepancy) <= tolerance
+	if stmt.PreviousUnpaid != nil && stmt.CurrentAmount != nil {
+		d := round2(stmt.TotalAmount - *stmt.PreviousUnpaid - *stmt.CurrentAmount)
+		r.BalanceDiscrepancy = &d
+		r.Reconciled = r.Reconciled && math.Abs(d) <= tolerance
+	}
+
+	hasAmount := func(amount float64) bool {
+		for _, tx := range txs {
+			if math.Abs(tx.Amount-amount) <= tolerance {
+				return true
+			}
+		}
+		return false
+	}
+	candidate := func(kind, description string, amount float64) {
+		if amount == 0 || hasAmount(amount) {
+			return
+		}
+		r.Candidates = append(r.Candidates, ReconciliationCandidate{
+			Kind:        kind,
+			Description: description,
+			Amount:      amount,
+			Explains:    math.Abs(r.Discrepancy-amount) <= tolerance,
+		})
+	}
+	for _, fee := range stmt.Fees {
+		candidate(fee.Type.String(), fee.Description, fee.Amount)
+	}
+	if stmt.InterestCharged != nil {
+		candidate("interest", "", *stmt.InterestCharged)
+	}
+	if stmt.PreviousUnpaid != nil {
+		candidate("previous_unpaid", "", *stmt.PreviousUnpaid)
+	}
+	if stmt.Rewards != nil {
+		candidate("cashback", "", -stmt.Rewards.Cashback)
+	}
+
+	r.Unexplained = r.Discrepancy
+	for _, c := range r.Candidates {
+		r.Unexplained -= c.Amount
+	}
+	r.Unexplained = round2(r.Unexplained)
+	return r
+}
+
+// Reconciliation reconciles a statement with its stored transactions, nil
+// when there is no such statement, and marks it reconciled or no longer
+// reconciled accordingly.
+func (s *StatementService) Reconciliation(ctx context.Context, id string, tolerance float64) (*Reconciliation, error) {
+	stmt, err := s.Repo.GetStatement(ctx, id)
+	if err != nil || stmt == nil {
+		return nil, err
+	}
+	txs, err := s.Repo.GetTransactions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	r := Reconcile(stmt, txs, tolerance)
+	if r.Reconciled == stmt.Reconciled {
+		return r, nil
+	}
+	stmt.Reconciled = r.Reconciled
+	if r.Reconciled {
+		now := time.Now().UTC()
+		stmt.ReconciledAt = &now
+	}
+	// the report stands when the write is queued
+	return r, s.Repo.UpsertStatement(ctx, stmt)
+}
@@ -0,0 +1,121 @@
+package statements
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Driver builds a repository from the environment. Drivers register themselves
+// from an init function in the file implementing them.
+type Driver func() (StatementRepository, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Driver)
+)
+
+// RegisterDriver makes a storage driver selectable through STORAGE_DRIVER.
+// It panics when the name is already taken, like database/sql.Register.
+func RegisterDriver(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if driver == nil {
+		panic("statements: RegisterDriver driver is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("statements: RegisterDriver called twice for driver " + name)
+	}
+	drivers[name] = driver
+}
+
+// Drivers returns the names of the registered storage drivers.
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func openDriver(name string) (StatementRepository, error) {
+	driversMu.RLock()
+	driver, ok := drivers[name]
+	driversMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown storage driver %q, registered: %v", name, Drivers())
+	}
+	return driver()
+}
+
+// NewRepoFromEnv opens the driver named by STORAGE_DRIVER. Without it, mongo is
+// used when MONGO_URI is set and memory otherwise. A driver that fails to open
+// is an error: falling back to memory would lose every write and let migrate
+// report success against the wrong store. The repository is scoped to the
+// user of the context, see ScopedRepo.
+func NewRepoFromEnv() (StatementRepository, error) {
+	name := os.Getenv("STORAGE_DRIVER")
+	if name == "" {
+		name = memoryDriver
+		if os.Getenv("MONGO_URI") != "" {
+			name = mongoDriver
+		}
+	}
+
+	repo, err := openDriver(name)
+	if err != nil {
+		return nil, fmt.Errorf("open storage driver %s: %w", name, err)
+	}
+	slog.Info("Using storage driver", "driver", name)
+	return NewScopedRepo(metricsFromEnv(repo, name)), nil
+}
+
+// OpenFromEnv opens the repository of NewRepoFromEnv with the field
+// encryption of EncryptionFromEnv and the audit log of AuditFromEnv on top.
+func OpenFromEnv() (StatementRepository, error) {
+	repo, err := NewRepoFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	repo, err = EncryptionFromEnv(repo)
+	if err != nil {
+		return nil, err
+	}
+	return AuditFromEnv(repo), nil
+}
+
+// SideStores names the stores kept next to the statements in the database of
+// the mongo driver: API keys, sessions, roles and the like. Their
+// constructors fall back to memory with any other driver.
+var SideStores = []string{
+	"accounts", "aggregator connections", "API keys", "attachments",
+	"budgets", "categories", "CSV import profiles", "end-to-end keys",
+	"erasure requests", "exchange rates", "households", "ingest runs",
+	"jobs", "leases", "merchants", "reminder preferences", "reports",
+	"roles", "sessions", "tax settings", "trends", "webhooks",
+}
+
+// CheckSideStores returns an error listing SideStores unless repo is backed
+// by MongoDB or by memory, which keeps nothing anyway. The postgres and
+// dynamo drivers keep statements and transactions only: their side stores
+// would be lost on restart and differ between replicas.
+func CheckSideStores(repo StatementRepository) error {
+	if _, ok := AsMongoRepo(repo); ok {
+		return nil
+	}
+	for _, layer := range Layers(repo) {
+		if _, ok := layer.(*InMemoryRepo); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("the storage driver keeps statements and transactions only, the %s stores need the mongo driver", strings.Join(SideStores, ", "))
+}
@@ -2,48 +2,276 @@ package statements
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
 )
 
 type StatementRepository interface {
-	GetStatement(id string) (*Statement, error)
-	UpsertStatement(statement *Statement) error
-	GetTransactions(statementId string) ([]Transaction, error)
-	UpsertTransaction(transactions *Transaction) error
-	DeleteTransaction(id string) error
+	GetStatement(ctx context.Context, id string) (*Statement, error)
+	ListStatements(ctx context.Context, filter StatementFilter) ([]Statement, error)
+	UpsertStatement(ctx context.Context, statement *Statement) error
+	// DeleteStatement removes the statement and the transactions still
+	// attached to it. Deleting a missing statement is not an error.
+	DeleteStatement(ctx context.Context, id string) error
+	GetTransactions(ctx context.Context, statementId string) ([]Transaction, error)
+	ListTransactions(ctx context.Context, filter TransactionFilter, page Page) ([]Transaction, error)
+	FindTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error)
+	UpsertTransaction(ctx context.Context, transactions *Transaction) error
+	DeleteTransaction(ctx context.Context, id string) error
+	BulkUpsertTransactions(ctx context.Context, transactions []Transaction) error
+	BulkDeleteTransactions(ctx context.Context, ids []string) error
+	SaveStatementWithDelta(ctx context.Context, statement *Statement, delta TransactionDelta) error
+}
+
+// ErrDuplicateSource is returned for a statement whose source ID another
+// statement of its owner already has, under another ID.
+var ErrDuplicateSource = apierror.New(apierror.KindConflict, "duplicate_source", "another statement has the same source ID")
+
+// TransactionDelta is the set of changes that brings the stored transactions of
+// a statement in line with the submitted ones.
+type TransactionDelta struct {
+	Upserts []Transaction
+	Deletes []string
+}
+
+// Describer is implemented by repositories that can report their backing
+// storage for self-checks and the health endpoint.
+type Describer interface {
+	Describe() map[string]string
+}
+
+// Layers lists repo and every repository decorated by it, outermost first.
+func Layers(repo StatementRepository) []StatementRepository {
+	layers := []StatementRepository{repo}
+	for {
+		u, ok := repo.(interface{ Unwrap() StatementRepository })
+		if !ok {
+			return layers
+		}
+		repo = u.Unwrap()
+		layers = append(layers, repo)
+	}
+}
+
+// AsMongoRepo unwraps repository decorators down to the Mongo implementation,
+// if there is one.
+func AsMongoRepo(repo StatementRepository) (*MongoRepo, bool) {
+	for {
+		switch r := repo.(type) {
+		case *MongoRepo:
+			return r, true
+		case interface{ Unwrap() StatementRepository }:
+			repo = r.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+type StatementFilter struct {
+	SourceName string
+	// TenantID and UserID match the statements of the tenant and user, set by
+	// ScopedRepo.
+	TenantID string
+	UserID   string
+}
+
+func (f StatementFilter) Match(stmt *Statement) bool {
+	if f.SourceName != "" && stmt.SourceName != f.SourceName {
+		return false
+	}
+	if f.TenantID != "" && stmt.TenantID != f.TenantID {
+		return false
+	}
+	if f.UserID != "" && stmt.UserID != f.UserID {
+		return false
+	}
+	return true
 }
 
-func NewRepoFromEnv() StatementRepository {
+// TransactionFilter selects transactions across statements. From is inclusive,
+// To is exclusive; zero values leave the range open.
+type TransactionFilter struct {
+	StatementID     string
+	From            time.Time
+	To              time.Time
+	MerchantCountry string
+	IsForeign       *bool
+	// ExternalRef matches transactions with a reference of that value, of
+	// ExternalRefType when set.
+	ExternalRef     string
+	ExternalRefType string
+	// BlindIndex matches transactions carrying that client-computed token.
+	BlindIndex string
+	// IsTransfer matches transactions with or without a PaymentSource, i.e.
+	// bank transactions linked to the card statement they pay.
+	IsTransfer *bool
+	SpendType  SpendType
+	// DisputeStatuses matches transactions disputed with one of the statuses.
+	DisputeStatuses []DisputeStatus
+	// TenantID and UserID match the transactions of the tenant and user, set
+	// by ScopedRepo.
+	TenantID string
+	UserID   string
+}
+
+func (f TransactionFilter) Match(tx *Transaction) bool {
+	if f.StatementID != "" && tx.StatementID != f.StatementID {
+		return false
+	}
+	if f.TenantID != "" && tx.TenantID != f.TenantID {
+		return false
+	}
+	if f.UserID != "" && tx.UserID != f.UserID {
+		return false
+	}
+	if f.MerchantCountry != "" && !strings.EqualFold(tx.MerchantCountry, f.MerchantCountry) {
+		return false
+	}
+	if f.IsForeign != nil && (tx.IsForeign == nil || *tx.IsForeign != *f.IsForeign) {
+		return false
+	}
+	if f.ExternalRef != "" && !tx.HasExternalRef(f.ExternalRefType, f.ExternalRef) {
+		return false
+	}
+	if f.BlindIndex != "" && !slices.Contains(tx.BlindIndexes, f.BlindIndex) {
+		return false
+	}
+	if f.IsTransfer != nil && (tx.PaymentSource != nil) != *f.IsTransfer {
+		return false
+	}
+	if f.SpendType != "" && ClassifySpend(tx) != f.SpendType {
+		return false
+	}
+	if len(f.DisputeStatuses) > 0 && (tx.Dispute == nil || !slices.Contains(f.DisputeStatuses, tx.Dispute.Status)) {
+		return false
+	}
+	if !f.From.IsZero() && tx.Date.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !tx.Date.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// Page is a keyset page: items with an ID greater than After, up to Limit.
+type Page struct {
+	Limit int
+	After string
+}
+
+const mongoDriver = "mongo"
+
+func init() {
+	RegisterDriver(mongoDriver, openMongoFromEnv)
+}
+
+func openMongoFromEnv() (StatementRepository, error) {
 	mongoURI := os.Getenv("MONGO_URI")
 	dbName := os.Getenv("MONGO_DB")
+	namespace := os.Getenv("MONGO_NAMESPACE")
 
-	if mongoURI != "" && dbName != "" {
-		db, err := connectMongo(mongoURI, dbName)
-		if err != nil {
-			slog.Warn("Failed to connect MongoDB. Falling back to in-memory.", "error", err)
-		} else {
-			slog.Info("Using MongoDB repository", "db", dbName)
-			return NewMongoRepo(db)
+	if mongoURI == "" || dbName == "" {
+		return nil, errors.New("MONGO_URI and MONGO_DB are required")
+	}
+	if !validNamespace.MatchString(namespace) {
+		return nil, fmt.Errorf("invalid MONGO_NAMESPACE %q, only letters, digits and underscores are allowed", namespace)
+	}
+
+	db, err := connectMongo(mongoURI, dbName, envDuration("MONGO_CONNECT_TIMEOUT_MS", 10*time.Second))
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Using MongoDB repository", "db", dbName, "namespace", namespace)
+	mongoRepo := NewMongoRepo(db, namespace, mongoQueryConfigFromEnv())
+	retryRepo := NewRetryRepo(mongoRepo, retryPolicyFromEnv(IsTransientError))
+	breakerRepo := breakerFromEnv(retryRepo, IsUnavailableError)
+	cachedRepo, err := cacheFromEnv(breakerRepo)
+	if err != nil {
+		return nil, err
+	}
+	degradable := NewDegradableRepo(cachedRepo,
+		IsUnavailableError, envInt("DEGRADED_CACHE_SIZE", 256), envInt("DEGRADED_OUTBOX_SIZE", 1000))
+	if path := os.Getenv("DEGRADED_OUTBOX_FILE"); path != "" {
+		if err := degradable.PersistOutbox(path); err != nil {
+			return nil, err
 		}
 	}
+	return degradable, nil
+}
+
+var validNamespace = regexp.MustCompile(`^[A-Za-z0-9_]*$`)
 
-	slog.Warn("connecting string not found, using in-memory repo")
-	return NewInMemoryRepo()
+// ValidNamespace reports whether namespace may prefix the collection names.
+func ValidNamespace(namespace string) bool {
+	return validNamespace.MatchString(namespace)
 }
 
-func connectMongo(uri, dbName string) (*mongo.Database, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// connectMongo opens the pool and pings the primary once. Failures retrying
+// will not fix, bad credentials or a malformed URI, are returned; an
+// unreachable server is only logged, DegradableRepo queues writes until the
+// health check sees it again.
+func connectMongo(uri, dbName string, timeout time.Duration) (*mongo.Database, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	clientOpts := options.Client().ApplyURI(uri)
+	clientOpts := options.Client().ApplyURI(uri).
+		SetMaxPoolSize(uint64(envInt("MONGO_MAX_POOL_SIZE", 100))).
+		SetMinPoolSize(uint64(envInt("MONGO_MIN_POOL_SIZE", 0))).
+		SetServerSelectionTimeout(envDuration("MONGO_SERVER_SELECTION_TIMEOUT_MS", 5*time.Second))
 	client, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("MongoDB %s error: %w", MongoErrConfig, err)
+	}
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
+		class := ClassifyMongoError(err)
+		if class != MongoErrUnreachable {
+			_ = client.Disconnect(context.Background())
+			return nil, fmt.Errorf("MongoDB %s error: %w", class, err)
+		}
+		slog.Warn("MongoDB is unreachable, starting degraded", "error", err)
 	}
 	return client.Database(dbName), nil
 }
+
+func mongoQueryConfigFromEnv() MongoQueryConfig {
+	cfg := MongoQueryConfig{
+		Timeout: envDuration("MONGO_QUERY_TIMEOUT_MS", 5*time.Second),
+	}
+	if v, err := strconv.ParseInt(os.Getenv("MONGO_BATCH_SIZE"), 10, 32); err == nil {
+		cfg.BatchSize = int32(v)
+	}
+	if v, err := strconv.Atoi(os.Getenv("MONGO_MAX_TIME_MS")); err == nil {
+		cfg.MaxTime = time.Duration(v) * time.Millisecond
+	}
+	cfg.IndexHints = os.Getenv("MONGO_INDEX_HINTS") == "true"
+	return cfg
+}
+
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return time.Duration(v) * time.Millisecond
+	}
+	return fallback
+}
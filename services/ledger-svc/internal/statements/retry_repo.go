@@ -0,0 +1,159 @@
+package statements
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy retries transient errors with capped exponential backoff and full
+// jitter. Attempts counts the first call.
+type RetryPolicy struct {
+	Attempts    int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	IsTransient func(error) bool
+}
+
+func retryPolicyFromEnv(isTransient func(error) bool) RetryPolicy {
+	return RetryPolicy{
+		Attempts:    envInt("MONGO_RETRY_ATTEMPTS", 3),
+		BaseDelay:   envDuration("MONGO_RETRY_BASE_MS", 100*time.Millisecond),
+		MaxDelay:    envDuration("MONGO_RETRY_MAX_MS", 2*time.Second),
+		IsTransient: isTransient,
+	}
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := min(p.BaseDelay<<attempt, p.MaxDelay)
+	if ceiling <= 0 {
+		// overflowed shift
+		ceiling = p.MaxDelay
+	}
+	return rand.N(ceiling + 1)
+}
+
+// Do calls fn until it succeeds, fails permanently, the attempts are used up or
+// ctx is done.
+func (p RetryPolicy) Do(ctx context.Context, op string, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !p.IsTransient(err) || attempt >= p.Attempts-1 {
+			return err
+		}
+
+		delay := p.backoff(attempt)
+		slog.Warn("Transient repository error, retrying", "op", op, "attempt", attempt+1, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// RetryRepo retries every repository call under its policy. All writes of the
+// repositories are idempotent upserts and deletes, so retrying a write whose
+// acknowledgment was lost is safe.
+type RetryRepo struct {
+	StatementRepository
+	policy RetryPolicy
+}
+
+func NewRetryRepo(repo StatementRepository, policy RetryPolicy) *RetryRepo {
+	return &RetryRepo{StatementRepository: repo, policy: policy}
+}
+
+func (r *RetryRepo) Unwrap() StatementRepository {
+	return r.StatementRepository
+}
+
+func (r *RetryRepo) Describe() map[string]string {
+	if d, ok := r.StatementRepository.(Describer); ok {
+		return d.Describe()
+	}
+	return nil
+}
+
+func retryResult[T any](ctx context.Context, p RetryPolicy, op string, fn func() (T, error)) (T, error) {
+	var result T
+	err := p.Do(ctx, op, func() error {
+		var err error
+		result, err = fn()
+		return err
+	})
+	return result, err
+}
+
+func (r *RetryRepo) GetStatement(ctx context.Context, id string) (*Statement, error) {
+	return retryResult(ctx, r.policy, "get_statement", func() (*Statement, error) {
+		return r.StatementRepository.GetStatement(ctx, id)
+	})
+}
+
+func (r *RetryRepo) ListStatements(ctx context.Context, filter StatementFilter) ([]Statement, error) {
+	return retryResult(ctx, r.policy, "list_statements", func() ([]Statement, error) {
+		return r.StatementRepository.ListStatements(ctx, filter)
+	})
+}
+
+func (r *RetryRepo) UpsertStatement(ctx context.Context, statement *Statement) error {
+	return r.policy.Do(ctx, "upsert_statement", func() error {
+		return r.StatementRepository.UpsertStatement(ctx, statement)
+	})
+}
+
+func (r *RetryRepo) DeleteStatement(ctx context.Context, id string) error {
+	return r.policy.Do(ctx, "delete_statement", func() error {
+		return r.StatementRepository.DeleteStatement(ctx, id)
+	})
+}
+
+func (r *RetryRepo) GetTransactions(ctx context.Context, statementID string) ([]Transaction, error) {
+	return retryResult(ctx, r.policy, "get_transactions", func() ([]Transaction, error) {
+		return r.StatementRepository.GetTransactions(ctx, statementID)
+	})
+}
+
+func (r *RetryRepo) ListTransactions(ctx context.Context, filter TransactionFilter, page Page) ([]Transaction, error) {
+	return retryResult(ctx, r.policy, "list_transactions", func() ([]Transaction, error) {
+		return r.StatementRepository.ListTransactions(ctx, filter, page)
+	})
+}
+
+func (r *RetryRepo) FindTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error) {
+	return retryResult(ctx, r.policy, "find_transactions", func() ([]Transaction, error) {
+		return r.StatementRepository.FindTransactions(ctx, filter)
+	})
+}
+
+func (r *RetryRepo) UpsertTransaction(ctx context.Context, tx *Transaction) error {
+	return r.policy.Do(ctx, "upsert_transaction", func() error {
+		return r.StatementRepository.UpsertTransaction(ctx, tx)
+	})
+}
+
+func (r *RetryRepo) DeleteTransaction(ctx context.Context, id string) error {
+	return r.policy.Do(ctx, "delete_transaction", func() error {
+		return r.StatementRepository.DeleteTransaction(ctx, id)
+	})
+}
+
+func (r *RetryRepo) BulkUpsertTransactions(ctx context.Context, transactions []Transaction) error {
+	return r.policy.Do(ctx, "bulk_upsert_transactions", func() error {
+		return r.StatementRepository.BulkUpsertTransactions(ctx, transactions)
+	})
+}
+
+func (r *RetryRepo) BulkDeleteTransactions(ctx context.Context, ids []string) error {
+	return r.policy.Do(ctx, "bulk_delete_transactions", func() error {
+		return r.StatementRepository.BulkDeleteTransactions(ctx, ids)
+	})
+}
+
+func (r *RetryRepo) SaveStatementWithDelta(ctx context.Context, statement *Statement, delta TransactionDelta) error {
+	return r.policy.Do(ctx, "save_statement_with_delta", func() error {
+		return r.StatementRepository.SaveStatementWithDelta(ctx, statement, delta)
+	})
+}
@@ -0,0 +1,62 @@
+package statements
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type RewardsSummary struct {
+	SourceName       string     `json:"source_name"`
+	PointsEarned     float64    `json:"points_earned"`
+	PointsRedeemed   float64    `json:"points_redeemed"`
+	PointsBalance    *float64   `json:"points_balance,omitempty"`
+	PointsExpiring   float64    `json:"points_expiring"`
+	PointsExpiryDate *time.Time `json:"points_expiry_date,omitempty"`
+	Cashback         float64    `json:"cashback"`
+	StatementCount   int        `json:"statement_count"`
+}
+
+// RewardsSummary aggregates rewards per account (source name). Earned, redeemed and
+// cashback are summed over all statements, while balance and expiring points are
+// taken from the latest statement reporting them.
+func (s *StatementService) RewardsSummary(ctx context.Context, sourceName string) ([]RewardsSummary, error) {
+	statements, err := s.Repo.ListStatements(ctx, StatementFilter{SourceName: sourceName})
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make(map[string]*RewardsSummary)
+	for _, stmt := range statements {
+		if stmt.Rewards == nil {
+			continue
+		}
+
+		summary, ok := summaries[stmt.SourceName]
+		if !ok {
+			summary = &RewardsSummary{SourceName: stmt.SourceName}
+			summaries[stmt.SourceName] = summary
+		}
+
+		summary.PointsEarned += stmt.Rewards.PointsEarned
+		summary.PointsRedeemed += stmt.Rewards.PointsRedeemed
+		summary.Cashback += stmt.Rewards.Cashback
+		summary.StatementCount++
+
+		// statements are ordered by due date, so later ones overwrite earlier ones
+		if stmt.Rewards.PointsBalance != nil {
+			summary.PointsBalance = stmt.Rewards.PointsBalance
+		}
+		summary.PointsExpiring = stmt.Rewards.PointsExpiring
+		summary.PointsExpiryDate = stmt.Rewards.PointsExpiryDate
+	}
+
+	result := make([]RewardsSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].SourceName < result[j].SourceName
+	})
+	return result, nil
+}
@@ -1,49 +1,269 @@
 package statements
 
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
 type StatementService struct {
-	Repo StatementRepository
+	Repo     StatementRepository
+	Payments PaymentConfig
+	IDs      IDStrategies
+	RefRules []RefRule
+	// Enrichers run in order on every statement before it is stored.
+	Enrichers []EnricherStep
+	// E2E is whether statements may or must arrive encrypted by the client.
+	E2E E2EMode
+	// Notifier, when set, is told about every statement saved.
+	Notifier Notifier
 }
 
 func NewService(repo StatementRepository) *StatementService {
 	return &StatementService{
-		Repo: repo,
+		Repo:     repo,
+		Payments: DefaultPaymentConfig,
 	}
 }
 
-func (s *StatementService) SaveStatement(statement *Statement) error {
+func (s *StatementService) SaveStatement(ctx context.Context, statement *Statement) error {
+	if err := s.checkE2E(statement); err != nil {
+		return err
+	}
+	statement.TenantID, statement.UserID = TenantFrom(ctx), UserFrom(ctx)
+	s.identify(ctx, statement)
 	if err := statement.Normalize(); err != nil {
 		return err
 	}
-	return s.Repo.UpsertStatement(statement)
+	existed := s.carryOverState(ctx, statement)
+	s.enrich(ctx, statement)
+	if err := s.Repo.UpsertStatement(ctx, statement); err != nil {
+		return err
+	}
+	observeSaved(existed)
+	s.notify(ctx, statementEvent(statement, !existed))
+	return nil
+}
+
+// carryOverState copies what the fetcher does not know about from stored
+// statements. It is best effort: a failed lookup must not block ingestion,
+// e.g. while writes are queued for an unavailable database. It reports
+// whether the statement was stored before.
+func (s *StatementService) carryOverState(ctx context.Context, statement *Statement) bool {
+	// the payment state is set by payment detection only, never by the poster
+	statement.Status, statement.PaidAt, statement.PaymentMatch = StatusOpen, nil, nil
+	if err := s.carryOverPrevious(ctx, statement); err != nil {
+		slog.Warn("Failed to carry over previous balance", "id", statement.ID, "error", err)
+	}
+	existed, err := s.keepManagedState(ctx, statement)
+	if err != nil {
+		slog.Warn("Failed to keep reminder and payment state", "id", statement.ID, "error", err)
+	}
+	return existed
+}
+
+// keepManagedState preserves the reminder escalation, acknowledgment and
+// payment status when a statement is posted again. A failed lookup leaves the
+// statement open; a queued save is merged again when replayed.
+func (s *StatementService) keepManagedState(ctx context.Context, statement *Statement) (bool, error) {
+	existing, err := s.Repo.GetStatement(ctx, statement.ID)
+	if err != nil || existing == nil {
+		return false, err
+	}
+	mergeManagedState(statement, existing)
+	return true, nil
+}
+
+// mergeManagedState carries the state of the stored statement over to the
+// posted one. The payment state is always the stored one, whatever was posted.
+func mergeManagedState(statement, existing *Statement) {
+	mergeReminderState(statement, existing)
+	statement.Status = existing.Status
+	statement.PaidAt = existing.PaidAt
+	statement.PaymentMatch = existing.PaymentMatch
+}
+
+func mergeReminderState(statement, existing *Statement) {
+	statement.ReminderLevel = max(statement.ReminderLevel, existing.ReminderLevel)
+	if statement.ReminderAckedAt == nil {
+		statement.ReminderAckedAt = existing.ReminderAckedAt
+	}
+	if statement.ReminderDigestedAt == nil {
+		statement.ReminderDigestedAt = existing.ReminderDigestedAt
+	}
+}
+
+// carryOverPrevious fills the previous balance of a statement from the statement
+// before it of the same source when the fetcher did not report it, so a credit
+// balance (negative total) is carried into the next cycle.
+func (s *StatementService) carryOverPrevious(ctx context.Context, statement *Statement) error {
+	if statement.PreviousAmount != nil || statement.PaymentDueDate == nil {
+		return nil
+	}
+
+	previous, err := s.previousStatement(ctx, statement)
+	if err != nil || previous == nil {
+		return err
+	}
+
+	previousAmount := previous.TotalAmount
+	statement.PreviousAmount = &previousAmount
+	if statement.PreviousUnpaid == nil && previous.IsCredit() {
+		// a credit is never "paid", it is consumed by the next charges
+		statement.PreviousUnpaid = &previousAmount
+	}
+	return nil
 }
 
-func (s *StatementService) SyncTransactions(statementID string, transactions *[]Transaction) error {
-	currentTransactions, err := s.Repo.GetTransactions(statementID)
+func (s *StatementService) previousStatement(ctx context.Context, statement *Statement) (*Statement, error) {
+	candidates, err := s.Repo.ListStatements(ctx, StatementFilter{SourceName: statement.SourceName})
 	if err != nil {
+		return nil, err
+	}
+
+	var previous *Statement
+	for i := range candidates {
+		c := &candidates[i]
+		if c.ID == statement.ID || c.PaymentDueDate == nil || !c.PaymentDueDate.Before(*statement.PaymentDueDate) {
+			continue
+		}
+		if previous == nil || c.PaymentDueDate.After(*previous.PaymentDueDate) {
+			previous = c
+		}
+	}
+	return previous, nil
+}
+
+// SaveStatementWithTransactions persists the statement and replaces its stored
+// transactions with the embedded ones in a single atomic repository write.
+func (s *StatementService) SaveStatementWithTransactions(ctx context.Context, statement *Statement) error {
+	if err := s.checkE2E(statement); err != nil {
 		return err
 	}
+	statement.TenantID, statement.UserID = TenantFrom(ctx), UserFrom(ctx)
+	s.identify(ctx, statement)
+	if err := statement.Normalize(); err != nil {
+		return err
+	}
+	existed := s.carryOverState(ctx, statement)
 
-	newTxMap := make(map[string]*Transaction)
+	current, err := s.Repo.GetTransactions(ctx, statement.ID)
+	if errors.Is(err, ErrUncached) {
+		// the database is unavailable, the save is queued and reconciled
+		// with the stored transactions when it is replayed
+		current, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	s.linkExternalRefs(current, *statement.Transactions)
+	keepAttribution(current, *statement.Transactions)
+	keepDisputes(current, *statement.Transactions)
+	s.enrich(ctx, statement)
+	delta := computeDelta(current, *statement.Transactions)
+	if err := s.Repo.SaveStatementWithDelta(ctx, statement, delta); err != nil {
+		return err
+	}
+	observeSaved(existed)
+	observeSync(delta)
+	s.notify(ctx, statementEvent(statement, !existed))
+	s.notify(ctx, transactionsSyncedEvent(statement.ID))
+	if err := s.detectPayments(ctx, statement); err != nil {
+		slog.Warn("Failed to detect payments", "id", statement.ID, "error", err)
+	}
+	if err := s.linkCardPayments(ctx, statement); err != nil {
+		slog.Warn("Failed to link card payments", "id", statement.ID, "error", err)
+	}
+	return nil
+}
+
+func computeDelta(current, desired []Transaction) TransactionDelta {
+	delta := TransactionDelta{Upserts: desired}
+	keep := make(map[string]bool, len(desired))
+	for _, tx := range desired {
+		keep[tx.ID] = true
+	}
+	for _, tx := range current {
+		if !keep[tx.ID] {
+			delta.Deletes = append(delta.Deletes, tx.ID)
+		}
+	}
+	return delta
+}
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+type TransactionPage struct {
+	Items []Transaction `json:"items"`
+	Next  string        `json:"next,omitempty"`
+}
+
+func (s *StatementService) ListTransactions(ctx context.Context, filter TransactionFilter, page Page) (*TransactionPage, error) {
+	if page.Limit <= 0 {
+		page.Limit = DefaultPageSize
+	}
+	page.Limit = min(page.Limit, MaxPageSize)
+
+	// fetch one extra item to know whether there is a next page
+	items, err := s.Repo.ListTransactions(ctx, filter, Page{Limit: page.Limit + 1, After: page.After})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TransactionPage{Items: items}
+	if len(items) > page.Limit {
+		result.Items = items[:page.Limit]
+		result.Next = result.Items[page.Limit-1].ID
+	}
+	if result.Items == nil {
+		result.Items = []Transaction{}
+	}
+	return result, nil
+}
+
+// SyncTransactions makes the stored transactions of a statement match the given
+// ones. The full delta is computed up front and applied with two bulk writes.
+func (s *StatementService) SyncTransactions(ctx context.Context, statementID string, transactions *[]Transaction) error {
+	desired := make([]Transaction, 0, len(*transactions))
 	for _, tx := range *transactions {
+		tx.ID = ownedTransactionID(OwnerFrom(ctx), tx.ID)
 		if err := tx.Normalize(); err != nil {
 			return err
 		}
-		err = s.Repo.UpsertTransaction(&tx)
-		if err != nil {
-			return err
-		}
-		newTxMap[tx.ID] = &tx
+		desired = append(desired, tx)
 	}
 
-	// Delete transactions that no longer exist
-	for _, transaction := range currentTransactions {
-		if _, exists := newTxMap[transaction.ID]; !exists {
-			err = s.Repo.DeleteTransaction(transaction.ID)
-			if err != nil {
-				return err
-			}
-		}
+	current, err := s.Repo.GetTransactions(ctx, statementID)
+	if err != nil {
+		return err
+	}
+	s.linkExternalRefs(current, desired)
+	keepAttribution(current, desired)
+	keepDisputes(current, desired)
+	delta := computeDelta(current, desired)
+
+	queued := false
+	err = s.Repo.BulkUpsertTransactions(ctx, delta.Upserts)
+	if errors.Is(err, ErrQueued) {
+		queued = true
+	} else if err != nil {
+		return err
 	}
 
+	err = s.Repo.BulkDeleteTransactions(ctx, delta.Deletes)
+	if errors.Is(err, ErrQueued) {
+		queued = true
+	} else if err != nil {
+		return err
+	}
+
+	if queued {
+		return ErrQueued
+	}
+	observeSync(delta)
+	s.notify(ctx, transactionsSyncedEvent(statementID))
 	return nil
 }
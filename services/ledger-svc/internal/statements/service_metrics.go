@@ -0,0 +1,34 @@
+package statements
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	statementsSaved = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "finchie_statements_saved_total",
+		Help: "Statements saved by the statement service, new or updated.",
+	}, []string{"result"})
+	transactionsSynced = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "finchie_transactions_synced_total",
+		Help: "Transactions written when syncing the transactions of a statement.",
+	})
+	syncDeletes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "finchie_transactions_sync_deleted_total",
+		Help: "Transactions deleted when syncing the transactions of a statement.",
+	})
+)
+
+func observeSaved(existed bool) {
+	result := "created"
+	if existed {
+		result = "updated"
+	}
+	statementsSaved.WithLabelValues(result).Inc()
+}
+
+func observeSync(delta TransactionDelta) {
+	transactionsSynced.Add(float64(len(delta.Upserts)))
+	syncDeletes.Add(float64(len(delta.Deletes)))
+}
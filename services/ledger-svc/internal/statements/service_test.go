@@ -0,0 +1,1211 @@
+package statements
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestSaveStatementCarriesCreditBalanceIntoNextStatement(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	repo := NewInMemoryRepo()
+	service := NewService(repo)
+
+	january := &Statement{
+		SourceName:     "TSIB",
+		SourceID:       ptr("2025_01"),
+		Currency:       "TWD",
+		TotalAmount:    -500,
+		PaymentDueDate: ptr(time.Date(2025, 1, 24, 0, 0, 0, 0, time.UTC)),
+	}
+	if err := service.SaveStatement(ctx, january); err != nil {
+		t.Fatalf("SaveStatement(january) error = %v", err)
+	}
+
+	february := &Statement{
+		SourceName:     "TSIB",
+		SourceID:       ptr("2025_02"),
+		Currency:       "TWD",
+		CurrentAmount:  ptr(1200.0),
+		TotalAmount:    700,
+		PaymentDueDate: ptr(time.Date(2025, 2, 24, 0, 0, 0, 0, time.UTC)),
+	}
+	if err := service.SaveStatement(ctx, february); err != nil {
+		t.Fatalf("SaveStatement(february) error = %v", err)
+	}
+
+	saved, err := repo.GetStatement(ctx, february.ID)
+	if err != nil || saved == nil {
+		t.Fatalf("GetStatement() = %v, %v", saved, err)
+	}
+	if saved.PreviousAmount == nil || *saved.PreviousAmount != -500 {
+		t.Errorf("PreviousAmount = %v, want -500", saved.PreviousAmount)
+	}
+	if saved.PreviousUnpaid == nil || *saved.PreviousUnpaid != -500 {
+		t.Errorf("PreviousUnpaid = %v, want -500", saved.PreviousUnpaid)
+	}
+	if got := *saved.PreviousUnpaid + *saved.CurrentAmount; got != saved.TotalAmount {
+		t.Errorf("previous unpaid + current = %v, want total %v", got, saved.TotalAmount)
+	}
+}
+
+func TestSaveStatementKeepsReportedPreviousAmount(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	repo := NewInMemoryRepo()
+	service := NewService(repo)
+
+	credit := &Statement{
+		SourceName:     "TSIB",
+		SourceID:       ptr("2025_01"),
+		Currency:       "TWD",
+		TotalAmount:    -500,
+		PaymentDueDate: ptr(time.Date(2025, 1, 24, 0, 0, 0, 0, time.UTC)),
+	}
+	next := &Statement{
+		SourceName:     "TSIB",
+		SourceID:       ptr("2025_02"),
+		Currency:       "TWD",
+		TotalAmount:    300,
+		PreviousAmount: ptr(-400.0),
+		PaymentDueDate: ptr(time.Date(2025, 2, 24, 0, 0, 0, 0, time.UTC)),
+	}
+	for _, stmt := range []*Statement{credit, next} {
+		if err := service.SaveStatement(ctx, stmt); err != nil {
+			t.Fatalf("SaveStatement(%s) error = %v", *stmt.SourceID, err)
+		}
+	}
+
+	if *next.PreviousAmount != -400 || next.PreviousUnpaid != nil {
+		t.Errorf("previous = %v / %v, want reported -400 and no unpaid", *next.PreviousAmount, next.PreviousUnpaid)
+	}
+}
+
+func TestSaveStatementWithTransactionsSupportsRefundHeavyMonth(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	repo := NewInMemoryRepo()
+	service := NewService(repo)
+
+	date := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	stmt := &Statement{
+		SourceName:     "TSIB",
+		SourceID:       ptr("2025_03"),
+		Currency:       "TWD",
+		TotalAmount:    -150,
+		PaymentDueDate: ptr(time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC)),
+		Transactions: &[]Transaction{
+			{ID: "charge", Description: "Coffee", Amount: 50, Date: date},
+			{ID: "refund", Description: "Refund", Amount: -200, Date: date},
+		},
+	}
+	if err := service.SaveStatementWithTransactions(ctx, stmt); err != nil {
+		t.Fatalf("SaveStatementWithTransactions() error = %v", err)
+	}
+
+	txs, err := repo.GetTransactions(ctx, stmt.ID)
+	if err != nil {
+		t.Fatalf("GetTransactions() error = %v", err)
+	}
+	var sum float64
+	for _, tx := range txs {
+		sum += tx.Amount
+	}
+	if len(txs) != 2 || sum != stmt.TotalAmount {
+		t.Errorf("stored %d transactions summing to %v, want 2 summing to %v", len(txs), sum, stmt.TotalAmount)
+	}
+}
+
+func TestSaveStatementWithoutIdentifiersIsIdempotent(t *testing.T) {
+	t.Parallel()
+
+	for _, strategy := range []IDStrategy{IDStrategyDefault, IDStrategyHash} {
+		t.Run(string(strategy), func(t *testing.T) {
+			t.Parallel()
+
+			ctx := t.Context()
+			repo := NewInMemoryRepo()
+			service := NewService(repo)
+			service.IDs = IDStrategies{Default: strategy}
+
+			post := func() *Statement {
+				stmt := &Statement{
+					SourceName:  "Wallet",
+					Currency:    "TWD",
+					TotalAmount: 350,
+					Transactions: &[]Transaction{
+						{ID: "w-2", Description: "Bus  pass", Amount: 200, Date: time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)},
+						{ID: "w-1", Description: "Coffee", Amount: 150, Date: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+					},
+				}
+				if err := service.SaveStatementWithTransactions(ctx, stmt); err != nil {
+					t.Fatalf("SaveStatementWithTransactions() error = %v", err)
+				}
+				return stmt
+			}
+
+			first, second := post(), post()
+			if first.ID != second.ID {
+				t.Errorf("re-posted statement got ID %q, want %q", second.ID, first.ID)
+			}
+			if stmts, _ := repo.ListStatements(ctx, StatementFilter{}); len(stmts) != 1 {
+				t.Errorf("stored %d statements, want 1", len(stmts))
+			}
+		})
+	}
+}
+
+func TestSaveStatementWithTransactionsKeepsExternalRefs(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	repo := NewInMemoryRepo()
+	service := NewService(repo)
+	service.RefRules = []RefRule{{Type: "order", Pattern: regexp.MustCompile(`order #(\d+)`)}}
+
+	date := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	post := func() *Statement {
+		stmt := &Statement{
+			SourceName:     "TSIB",
+			SourceID:       ptr("2025_03"),
+			Currency:       "TWD",
+			TotalAmount:    150,
+			PaymentDueDate: ptr(time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC)),
+			Transactions: &[]Transaction{
+				{ID: "shop", Description: "Shop order #1234", Amount: 100, Date: date},
+				{ID: "hotel", Description: "Hotel", Amount: 50, Date: date},
+			},
+		}
+		if err := service.SaveStatementWithTransactions(ctx, stmt); err != nil {
+			t.Fatalf("SaveStatementWithTransactions() error = %v", err)
+		}
+		return stmt
+	}
+
+	stmt := post()
+	if _, err := service.SetExternalRefs(ctx, stmt.ID, "hotel", []ExternalRef{{Type: " Booking", Value: "HTL-1 "}}); err != nil {
+		t.Fatalf("SetExternalRefs() error = %v", err)
+	}
+	post()
+
+	page, err := service.ListTransactions(ctx, TransactionFilter{ExternalRef: "HTL-1", ExternalRefType: "booking"}, Page{})
+	if err != nil {
+		t.Fatalf("ListTransactions() error = %v", err)
+	}
+	if len(page.Items) != 1 || page.Items[0].ID != "hotel" {
+		t.Errorf("found %+v by booking reference, want the hotel transaction", page.Items)
+	}
+	page, err = service.ListTransactions(ctx, TransactionFilter{ExternalRef: "1234"}, Page{})
+	if err != nil {
+		t.Fatalf("ListTransactions() error = %v", err)
+	}
+	if len(page.Items) != 1 || page.Items[0].ID != "shop" {
+		t.Errorf("found %+v by extracted order reference, want the shop transaction", page.Items)
+	}
+	if _, err := service.SetExternalRefs(ctx, stmt.ID, "missing", nil); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("SetExternalRefs() of a missing transaction error = %v, want ErrTransactionNotFound", err)
+	}
+}
+
+func TestSaveStatementWithTransactionsKeepsAttribution(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	repo := NewInMemoryRepo()
+	service := NewService(repo)
+
+	date := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	post := func(paidBy string) *Statement {
+		stmt := &Statement{
+			SourceName:     "TSIB",
+			SourceID:       ptr("2025_03"),
+			Currency:       "TWD",
+			TotalAmount:    150,
+			PaymentDueDate: ptr(time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC)),
+			Transactions: &[]Transaction{
+				{ID: "groceries", Description: "Market", Amount: 100, Date: date, PaidBy: paidBy},
+				{ID: "gift", Description: "Flowers", Amount: 50, Date: date},
+			},
+		}
+		if err := service.SaveStatementWithTransactions(ctx, stmt); err != nil {
+			t.Fatalf("SaveStatementWithTransactions() error = %v", err)
+		}
+		return stmt
+	}
+
+	stmt := post("")
+	if _, err := service.SetAttribution(ctx, stmt.ID, "gift", Attribution{Owner: " sam ", PaidBy: "alex"}); err != nil {
+		t.Fatalf("SetAttribution() error = %v", err)
+	}
+	if _, err := service.SetAttribution(ctx, stmt.ID, "groceries", Attribution{PaidBy: "alex"}); err != nil {
+		t.Fatalf("SetAttribution() error = %v", err)
+	}
+	post("sam")
+
+	txs, err := repo.GetTransactions(ctx, stmt.ID)
+	if err != nil {
+		t.Fatalf("GetTransactions() error = %v", err)
+	}
+	got := map[string]Attribution{}
+	for _, tx := range txs {
+		got[tx.ID] = Attribution{Owner: tx.Owner, PaidBy: tx.PaidBy}
+	}
+	want := map[string]Attribution{
+		"gift":      {Owner: "sam", PaidBy: "alex"},
+		"groceries": {PaidBy: "sam"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("attribution after re-post = %+v, want %+v", got, want)
+	}
+}
+
+func TestDisputeWorkflow(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	repo := NewInMemoryRepo()
+	service := NewService(repo)
+
+	date := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	post := func() *Statement {
+		stmt := &Statement{
+			SourceName:     "TSIB",
+			SourceID:       ptr("2025_03"),
+			Currency:       "TWD",
+			TotalAmount:    150,
+			PaymentDueDate: ptr(time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC)),
+			Transactions: &[]Transaction{
+				{ID: "double", Description: "Shop", Amount: 100, Date: date},
+				{ID: "fine", Description: "Cafe", Amount: 50, Date: date},
+			},
+		}
+		if err := service.SaveStatementWithTransactions(ctx, stmt); err != nil {
+			t.Fatalf("SaveStatementWithTransactions() error = %v", err)
+		}
+		return stmt
+	}
+	stmt := post()
+
+	if _, err := service.UpdateDispute(ctx, stmt.ID, "double", DisputeUpdate{Status: DisputeResolved}); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("resolving an undisputed transaction error = %v, want ErrInvalidTransition", err)
+	}
+	deadline := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := service.UpdateDispute(ctx, stmt.ID, "double", DisputeUpdate{Note: "Charged twice", Deadline: &deadline}); err != nil {
+		t.Fatalf("UpdateDispute() opening error = %v", err)
+	}
+	if _, err := service.UpdateDispute(ctx, stmt.ID, "double", DisputeUpdate{Status: DisputePending}); err != nil {
+		t.Fatalf("UpdateDispute() to pending error = %v", err)
+	}
+	post()
+
+	open, err := service.Disputes(ctx, OpenDisputeStatuses)
+	if err != nil {
+		t.Fatalf("Disputes() error = %v", err)
+	}
+	if len(open) != 1 || open[0].ID != "double" || open[0].Dispute.Status != DisputePending || len(open[0].Dispute.Notes) != 1 {
+		t.Fatalf("open disputes after re-post = %+v, want the pending dispute with its note", open)
+	}
+
+	if _, err := service.UpdateDispute(ctx, stmt.ID, "double", DisputeUpdate{Status: DisputeChargedBack}); err != nil {
+		t.Fatalf("UpdateDispute() to charged_back error = %v", err)
+	}
+	if _, err := service.UpdateDispute(ctx, stmt.ID, "double", DisputeUpdate{Status: DisputeOpened}); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("reopening a chargeback error = %v, want ErrInvalidTransition", err)
+	}
+	dispute, err := service.Dispute(ctx, stmt.ID, "double")
+	if err != nil {
+		t.Fatalf("Dispute() error = %v", err)
+	}
+	var history []DisputeStatus
+	for _, e := range dispute.History {
+		history = append(history, e.Status)
+	}
+	if want := []DisputeStatus{DisputeOpened, DisputePending, DisputeChargedBack}; !reflect.DeepEqual(history, want) {
+		t.Errorf("dispute history = %v, want %v", history, want)
+	}
+	if _, err := service.Dispute(ctx, stmt.ID, "fine"); !errors.Is(err, ErrDisputeNotFound) {
+		t.Errorf("Dispute() of an undisputed transaction error = %v, want ErrDisputeNotFound", err)
+	}
+}
+
+func TestMergeDuplicateStatements(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	repo := NewInMemoryRepo()
+	service := NewService(repo)
+
+	date := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	due := ptr(time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC))
+	older := &Statement{
+		SourceName:     "TSIB",
+		Currency:       "TWD",
+		TotalAmount:    150,
+		PaymentDueDate: due,
+		Transactions: &[]Transaction{
+			{ID: "old-coffee", Description: "Coffee", Amount: 50, Date: date},
+			{ID: "old-books", Description: "Books", Amount: 100, Date: date.AddDate(0, 0, 1)},
+		},
+	}
+	newer := &Statement{
+		SourceName:     "TSIB",
+		SourceID:       ptr("2025_03"),
+		Currency:       "TWD",
+		TotalAmount:    150,
+		PaymentDueDate: due,
+		Transactions: &[]Transaction{
+			{ID: "coffee", Description: "coffee ", Amount: 50, Date: date},
+		},
+	}
+	for _, stmt := range []*Statement{older, newer} {
+		if err := service.SaveStatementWithTransactions(ctx, stmt); err != nil {
+			t.Fatalf("SaveStatementWithTransactions() error = %v", err)
+		}
+	}
+
+	duplicates, err := service.FindDuplicates(ctx, "TSIB")
+	if err != nil {
+		t.Fatalf("FindDuplicates() error = %v", err)
+	}
+	if len(duplicates) != 1 || duplicates[0].SameContent {
+		t.Fatalf("FindDuplicates() = %+v, want one pair with different content", duplicates)
+	}
+
+	result, err := service.MergeStatements(ctx, newer.ID, older.ID)
+	if err != nil {
+		t.Fatalf("MergeStatements() error = %v", err)
+	}
+	if result.MovedTransactions != 1 || result.DroppedTransactions != 1 {
+		t.Errorf("MergeStatements() = %+v, want 1 moved and 1 dropped", result)
+	}
+	if stmt, _ := repo.GetStatement(ctx, older.ID); stmt != nil {
+		t.Errorf("duplicate statement %s still exists", older.ID)
+	}
+	txs, _ := repo.GetTransactions(ctx, newer.ID)
+	if len(txs) != 2 {
+		t.Errorf("kept statement has %d transactions, want 2", len(txs))
+	}
+	if duplicates, _ := service.FindDuplicates(ctx, ""); len(duplicates) != 0 {
+		t.Errorf("FindDuplicates() after merge = %+v, want none", duplicates)
+	}
+	if _, err := service.MergeStatements(ctx, newer.ID, newer.ID); !errors.Is(err, ErrInvalidMerge) {
+		t.Errorf("MergeStatements() into itself error = %v, want ErrInvalidMerge", err)
+	}
+}
+
+type staticKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+func (k staticKeys) Keys(context.Context) (string, map[string][]byte, error) {
+	return k.current, k.keys, nil
+}
+
+func (k staticKeys) IndexKey(context.Context) ([]byte, error) {
+	return bytes.Repeat([]byte{9}, 32), nil
+}
+
+func TestEncryptedRepoEncryptsAtRestAndReencrypts(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	inner := NewInMemoryRepo()
+	oldCipher, err := NewFieldCipher(ctx, staticKeys{"k1", map[string][]byte{"k1": oldKey}}, encryptableFields)
+	if err != nil {
+		t.Fatalf("NewFieldCipher() error = %v", err)
+	}
+	service := NewService(NewEncryptedRepo(inner, oldCipher))
+
+	stmt := &Statement{
+		SourceName:     "TSIB",
+		SourceID:       ptr("2025_01"),
+		Currency:       "TWD",
+		TotalAmount:    50,
+		PaymentDueDate: ptr(time.Date(2025, 1, 24, 0, 0, 0, 0, time.UTC)),
+		Extra:          map[string]any{"card": "4111"},
+		Transactions: &[]Transaction{
+			{ID: "coffee", Description: "coffee", Amount: 50, Date: time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC), Extra: map[string]any{"account": "123"}},
+		},
+	}
+	if err := service.SaveStatementWithTransactions(ctx, stmt); err != nil {
+		t.Fatalf("SaveStatementWithTransactions() error = %v", err)
+	}
+
+	if strings.Contains(stmt.ID, "2025_01") {
+		t.Errorf("statement ID = %s, want it without the encrypted source ID", stmt.ID)
+	}
+	stored, _ := inner.GetStatement(ctx, stmt.ID)
+	if !strings.HasPrefix(*stored.SourceID, "enc:k1:") || !isEncrypted(stored.Extra) {
+		t.Fatalf("stored statement = %v, %v, want encrypted with k1", *stored.SourceID, stored.Extra)
+	}
+	index := stored.SourceIndex
+	if index == "" {
+		t.Fatalf("stored source index is empty, want the blind index")
+	}
+	read, err := service.Repo.GetStatement(ctx, stmt.ID)
+	if err != nil || *read.SourceID != "2025_01" || read.Extra.(map[string]any)["card"] != "4111" {
+		t.Fatalf("GetStatement() = %+v, %v, want decrypted fields", read, err)
+	}
+
+	newCipher, err := NewFieldCipher(ctx, staticKeys{"k2", map[string][]byte{"k1": oldKey, "k2": newKey}}, encryptableFields)
+	if err != nil {
+		t.Fatalf("NewFieldCipher() error = %v", err)
+	}
+	rotated := NewEncryptedRepo(inner, newCipher)
+	stmts, txs, err := rotated.Reencrypt(ctx)
+	if err != nil || stmts != 1 || txs != 1 {
+		t.Fatalf("Reencrypt() = %d, %d, %v, want 1 statement and 1 transaction", stmts, txs, err)
+	}
+	if stored, _ := inner.GetStatement(ctx, stmt.ID); !strings.HasPrefix(*stored.SourceID, "enc:k2:") || stored.SourceIndex != index {
+		t.Errorf("stored source = %s, %s, want encrypted with k2 under the same blind index", *stored.SourceID, stored.SourceIndex)
+	}
+	readTxs, err := rotated.GetTransactions(ctx, stmt.ID)
+	if err != nil || len(readTxs) != 1 || readTxs[0].Extra.(map[string]any)["account"] != "123" {
+		t.Errorf("GetTransactions() = %+v, %v, want decrypted extra", readTxs, err)
+	}
+	if stmts, txs, _ := rotated.Reencrypt(ctx); stmts != 0 || txs != 0 {
+		t.Errorf("second Reencrypt() = %d, %d, want nothing left", stmts, txs)
+	}
+
+	again := &Statement{SourceName: "TSIB", SourceID: ptr("2025_01"), Currency: "TWD", TotalAmount: 60}
+	if err := NewService(rotated).SaveStatement(ctx, again); err != nil || again.ID != stmt.ID {
+		t.Errorf("SaveStatement() of the same source after rotation = %s, %v, want %s", again.ID, err, stmt.ID)
+	}
+	duplicate := &Statement{ID: "other", SourceName: "TSIB", SourceID: ptr("2025_01"), Currency: "TWD"}
+	if err := rotated.UpsertStatement(ctx, duplicate); !errors.Is(err, ErrDuplicateSource) {
+		t.Errorf("UpsertStatement() of another statement with the source = %v, want ErrDuplicateSource", err)
+	}
+}
+
+func TestEncryptedSourceIDsNeedABlindIndexKey(t *testing.T) {
+	t.Parallel()
+
+	keys := map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}
+	if _, err := NewFieldCipher(t.Context(), noIndexKey{"k1", keys}, encryptableFields); err == nil {
+		t.Error("NewFieldCipher() without a blind index key succeeded, want an error")
+	}
+	if _, err := NewFieldCipher(t.Context(), noIndexKey{"k1", keys}, []string{FieldStatementExtra}); err != nil {
+		t.Errorf("NewFieldCipher() of the extras error = %v, want none", err)
+	}
+}
+
+type noIndexKey staticKeys
+
+func (k noIndexKey) Keys(context.Context) (string, map[string][]byte, error) {
+	return k.current, k.keys, nil
+}
+
+func TestAuditLogRecordsPlaintextOfTheOwnerOnly(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	cipher, err := NewFieldCipher(ctx, staticKeys{"k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}, encryptableFields)
+	if err != nil {
+		t.Fatalf("NewFieldCipher() error = %v", err)
+	}
+	repo := AuditFromEnv(NewEncryptedRepo(NewScopedRepo(NewInMemoryRepo()), cipher))
+	acme := WithTenant(WithUser(ctx, "alice"), "acme")
+	umbrella := WithTenant(WithUser(ctx, "alice"), "umbrella")
+
+	stmt := &Statement{ID: "owned", SourceName: "TSIB", Currency: "TWD", Extra: map[string]any{"card": "4111"}}
+	if err := repo.UpsertStatement(acme, stmt); err != nil {
+		t.Fatalf("UpsertStatement() error = %v", err)
+	}
+	tx := Transaction{ID: "coffee", StatementID: "owned", Amount: 100, Date: time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC), Extra: map[string]any{"account": "123"}}
+	if err := repo.BulkUpsertTransactions(acme, []Transaction{tx}); err != nil {
+		t.Fatalf("BulkUpsertTransactions() error = %v", err)
+	}
+	if err := repo.DeleteTransaction(acme, "coffee"); err != nil {
+		t.Fatalf("DeleteTransaction() error = %v", err)
+	}
+
+	store, _ := AsAuditStore(repo)
+	entries, err := store.AuditHistory(ctx, "coffee", 10)
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("AuditHistory() = %d entries, %v, want the insert and the delete", len(entries), err)
+	}
+	// newest first, the delete snapshots the stored transaction before it
+	if extra, _ := entries[0].Before["extra"].(map[string]any); extra["account"] != "123" {
+		t.Errorf("delete snapshot extra = %v, want the plaintext", entries[0].Before["extra"])
+	}
+
+	manager := &StatementManager{Repo: repo}
+	for _, c := range []struct {
+		ctx  context.Context
+		want int
+	}{{acme, 1}, {umbrella, 0}} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequestWithContext(c.ctx, http.MethodGet, "/api/audit?entity_id=owned", nil)
+		manager.AuditHandler(rec, req)
+		var got []AuditEntry
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || len(got) != c.want {
+			t.Errorf("AuditHandler(%s) = %s, want %d entries", TenantFrom(c.ctx), rec.Body.String(), c.want)
+		}
+	}
+}
+
+func TestRunQueryGroupsAndProjectsInProcess(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	repo := NewInMemoryRepo()
+	march := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	err := repo.BulkUpsertTransactions(ctx, []Transaction{
+		{ID: "coffee", Description: "Coffee", Category: "Food", Amount: 50, Date: march},
+		{ID: "lunch", Description: "Lunch", Category: "Food", Amount: 150, Date: march.AddDate(0, 0, 1)},
+		{ID: "train", Description: "Train", Category: "Transport", Amount: 300, Date: march.AddDate(0, 1, 0)},
+		{ID: "refund", Description: "Coffee refund", Category: "Food", Amount: -50, Date: march.AddDate(0, 1, 2)},
+	})
+	if err != nil {
+		t.Fatalf("BulkUpsertTransactions() error = %v", err)
+	}
+
+	rows, err := RunQuery(ctx, repo, NewQuery(TransactionFilter{}).
+		Where("category", OpEq, "Food").GroupBy("month").
+		Sum("amount", "total").Count("count").OrderBy("month", true))
+	if err != nil {
+		t.Fatalf("RunQuery() error = %v", err)
+	}
+	want := []Row{
+		{"month": "2025-04", "total": -50.0, "count": 1},
+		{"month": "2025-03", "total": 200.0, "count": 2},
+	}
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Fatalf("grouped rows = %v, want %v", rows, want)
+	}
+
+	rows, err = RunQuery(ctx, repo, NewQuery(TransactionFilter{}).
+		Where("description", OpContains, "coffee").Select("id", "amount").OrderBy("amount", false).Take(1))
+	if err != nil {
+		t.Fatalf("RunQuery() error = %v", err)
+	}
+	if len(rows) != 1 || rows[0]["id"] != "refund" || len(rows[0]) != 2 {
+		t.Fatalf("projected rows = %v, want only the refund id and amount", rows)
+	}
+
+	if _, err := RunQuery(ctx, repo, NewQuery(TransactionFilter{}).GroupBy("month").OrderBy("amount", false)); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("RunQuery() error = %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestTenantsCannotReadEachOther(t *testing.T) {
+	t.Parallel()
+
+	repo := NewScopedRepo(NewInMemoryRepo())
+	service := NewService(repo)
+	// the same user in two families
+	acme := WithTenant(WithUser(t.Context(), "alice"), "acme")
+	umbrella := WithTenant(WithUser(t.Context(), "alice"), "umbrella")
+
+	saved := map[string]*Statement{}
+	for _, ctx := range []context.Context{acme, umbrella} {
+		stmt := &Statement{
+			SourceName:     "TSIB",
+			SourceID:       ptr("2025_01"),
+			Currency:       "TWD",
+			TotalAmount:    100,
+			PaymentDueDate: ptr(time.Date(2025, 1, 24, 0, 0, 0, 0, time.UTC)),
+			Transactions:   &[]Transaction{{ID: TenantFrom(ctx) + "-coffee", Description: "Coffee", Amount: 100, Date: time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)}},
+		}
+		if err := service.SaveStatementWithTransactions(ctx, stmt); err != nil {
+			t.Fatalf("SaveStatementWithTransactions(%s) error = %v", TenantFrom(ctx), err)
+		}
+		saved[TenantFrom(ctx)] = stmt
+	}
+	if saved["acme"].ID == saved["umbrella"].ID {
+		t.Fatalf("both tenants saved statement %s, want IDs of their own", saved["acme"].ID)
+	}
+	if saved["acme"].TenantID != "acme" {
+		t.Errorf("TenantID = %q, want acme", saved["acme"].TenantID)
+	}
+
+	if got, err := repo.GetStatement(umbrella, saved["acme"].ID); err != nil || got != nil {
+		t.Errorf("GetStatement(other tenant) = %v, %v, want nil", got, err)
+	}
+	if txs, err := repo.GetTransactions(umbrella, saved["acme"].ID); err != nil || len(txs) != 0 {
+		t.Errorf("GetTransactions(other tenant) = %v, %v, want none", txs, err)
+	}
+	list, err := repo.ListStatements(umbrella, StatementFilter{TenantID: "acme"})
+	if err != nil || len(list) != 1 || list[0].ID != saved["umbrella"].ID {
+		t.Errorf("ListStatements(tenant filter of another) = %v, %v, want only the own statement", list, err)
+	}
+	// the transaction IDs are the owner's too
+	ownID := OwnedID(Owner("umbrella", "alice"), "umbrella-coffee")
+	txs, err := repo.FindTransactions(umbrella, TransactionFilter{})
+	if err != nil || len(txs) != 1 || txs[0].ID != ownID {
+		t.Errorf("FindTransactions() = %v, %v, want only the own transaction", txs, err)
+	}
+	rows, err := RunQuery(umbrella, repo, NewQuery(TransactionFilter{}).Select("id"))
+	if err != nil || len(rows) != 1 || rows[0]["id"] != ownID {
+		t.Errorf("RunQuery() = %v, %v, want only the own transaction", rows, err)
+	}
+	if all, err := repo.FindTransactions(t.Context(), TransactionFilter{}); err != nil || len(all) != 2 {
+		t.Errorf("FindTransactions(unscoped) = %d, %v, want both tenants", len(all), err)
+	}
+
+	// the source ID is unique per owner, as the index of MongoDB enforces
+	dup := *saved["acme"]
+	dup.ID = OwnedID(Owner("acme", "alice"), "TSIB_copy")
+	if err := repo.UpsertStatement(acme, &dup); !errors.Is(err, ErrDuplicateSource) {
+		t.Errorf("UpsertStatement(same source, other ID) error = %v, want ErrDuplicateSource", err)
+	}
+}
+
+func TestTenantsCannotWriteEachOther(t *testing.T) {
+	t.Parallel()
+
+	repo := NewScopedRepo(NewInMemoryRepo())
+	acme := WithTenant(WithUser(t.Context(), "alice"), "acme")
+	umbrella := WithTenant(WithUser(t.Context(), "alice"), "umbrella")
+	date := time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)
+
+	stmt := &Statement{ID: "shared", SourceName: "TSIB", Currency: "TWD"}
+	if err := repo.UpsertStatement(acme, stmt); err != nil {
+		t.Fatalf("UpsertStatement() error = %v", err)
+	}
+	if err := repo.BulkUpsertTransactions(acme, []Transaction{{ID: "coffee", StatementID: "shared", Amount: 100, Date: date}}); err != nil {
+		t.Fatalf("BulkUpsertTransactions() error = %v", err)
+	}
+
+	takeover := &Statement{ID: "shared", SourceName: "TSIB", Currency: "TWD", TotalAmount: 1}
+	if err := repo.UpsertStatement(umbrella, takeover); !errors.Is(err, ErrNotOwned) {
+		t.Errorf("UpsertStatement(other tenant) error = %v, want ErrNotOwned", err)
+	}
+	if err := repo.SaveStatementWithDelta(umbrella, takeover, TransactionDelta{}); !errors.Is(err, ErrNotOwned) {
+		t.Errorf("SaveStatementWithDelta(other tenant) error = %v, want ErrNotOwned", err)
+	}
+	if err := repo.UpsertTransaction(umbrella, &Transaction{ID: "coffee", Amount: 1, Date: date}); !errors.Is(err, ErrNotOwned) {
+		t.Errorf("UpsertTransaction(other tenant) error = %v, want ErrNotOwned", err)
+	}
+	if err := repo.DeleteStatement(umbrella, "shared"); err != nil {
+		t.Errorf("DeleteStatement(other tenant) error = %v", err)
+	}
+	if err := repo.BulkDeleteTransactions(umbrella, []string{"coffee"}); err != nil {
+		t.Errorf("BulkDeleteTransactions(other tenant) error = %v", err)
+	}
+
+	got, err := repo.GetStatement(acme, "shared")
+	if err != nil || got == nil || got.TotalAmount != 0 || got.TenantID != "acme" {
+		t.Fatalf("GetStatement() = %+v, %v, want the untouched statement of acme", got, err)
+	}
+	txs, err := repo.FindTransactions(acme, TransactionFilter{})
+	if err != nil || len(txs) != 1 || txs[0].Amount != 100 {
+		t.Fatalf("FindTransactions() = %+v, %v, want the untouched transaction of acme", txs, err)
+	}
+}
+
+func TestChangeEventsNameTheirOwner(t *testing.T) {
+	t.Parallel()
+
+	repo := NewInMemoryRepo()
+	acme := WithTenant(WithUser(t.Context(), "alice"), "acme")
+	scoped := NewScopedRepo(repo)
+	stmt := &Statement{ID: "owned", SourceName: "TSIB", Currency: "TWD"}
+	if err := scoped.UpsertStatement(acme, stmt); err != nil {
+		t.Fatalf("UpsertStatement() error = %v", err)
+	}
+	if err := scoped.BulkUpsertTransactions(acme, []Transaction{{ID: "coffee", StatementID: "owned", Amount: 100, Date: time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)}}); err != nil {
+		t.Fatalf("BulkUpsertTransactions() error = %v", err)
+	}
+	// deleted unscoped, as the workers do, the events still name the owner
+	if err := repo.DeleteStatement(t.Context(), "owned"); err != nil {
+		t.Fatalf("DeleteStatement() error = %v", err)
+	}
+
+	events, err := repo.PendingEvents(t.Context(), 10)
+	if err != nil {
+		t.Fatalf("PendingEvents() error = %v", err)
+	}
+	types := map[string]bool{}
+	for _, e := range events {
+		types[e.Type] = true
+		if e.Owner() != "acme/alice" {
+			t.Errorf("%s event owner = %q, want acme/alice", e.Type, e.Owner())
+		}
+	}
+	if !types[EventStatementDeleted] || !types[EventTransactionDeleted] {
+		t.Errorf("event types = %v, want the deletes", types)
+	}
+}
+
+type enricherFunc func(ctx context.Context, statement *Statement) error
+
+func (f enricherFunc) Enrich(ctx context.Context, statement *Statement) error {
+	return f(ctx, statement)
+}
+
+func TestSaveStatementSkipsFailingEnrichers(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	repo := NewInMemoryRepo()
+	service := NewService(repo)
+	categorize, err := newCategorizer([]byte(`{"rules": [{"pattern": "(?i)coffee", "category": "Food"}]}`))
+	if err != nil {
+		t.Fatalf("newCategorizer() error = %v", err)
+	}
+	service.Enrichers = []EnricherStep{
+		{Name: "panics", Timeout: time.Second, Enricher: enricherFunc(func(ctx context.Context, statement *Statement) error {
+			(*statement.Transactions)[0].Category = "Broken"
+			panic("boom")
+		})},
+		{Name: "categorizer", Timeout: time.Second, Enricher: categorize},
+		{Name: "slow", Timeout: 10 * time.Millisecond, Enricher: enricherFunc(func(ctx context.Context, statement *Statement) error {
+			(*statement.Transactions)[0].Description = "Changed too late"
+			<-ctx.Done()
+			return ctx.Err()
+		})},
+	}
+
+	stmt := &Statement{
+		SourceName:     "TSIB",
+		SourceID:       ptr("2025_03"),
+		Currency:       "TWD",
+		TotalAmount:    50,
+		PaymentDueDate: ptr(time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC)),
+		Transactions: &[]Transaction{
+			{ID: "coffee", Description: "Coffee", Amount: 50, Date: time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+	if err := service.SaveStatementWithTransactions(ctx, stmt); err != nil {
+		t.Fatalf("SaveStatementWithTransactions() error = %v", err)
+	}
+
+	stored, err := repo.GetTransactions(ctx, stmt.ID)
+	if err != nil {
+		t.Fatalf("GetTransactions() error = %v", err)
+	}
+	if len(stored) != 1 || stored[0].Category != "Food" || stored[0].Description != "Coffee" {
+		t.Fatalf("stored transactions = %+v, want only the categorizer applied", stored)
+	}
+}
+
+func TestSaveStatementRequiresClientEncryption(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	repo := NewInMemoryRepo()
+	service := NewService(repo)
+	service.E2E = E2ERequired
+
+	newStatement := func(description string) *Statement {
+		return &Statement{
+			SourceName:     "TSIB",
+			SourceID:       ptr("2025_04"),
+			Currency:       "TWD",
+			TotalAmount:    50,
+			PaymentDueDate: ptr(time.Date(2025, 4, 24, 0, 0, 0, 0, time.UTC)),
+			Transactions: &[]Transaction{
+				{ID: "coffee", Description: description, Amount: 50, Date: time.Date(2025, 4, 3, 0, 0, 0, 0, time.UTC), BlindIndexes: []string{"token-1"}},
+			},
+		}
+	}
+	if err := service.SaveStatementWithTransactions(ctx, newStatement("Coffee")); !errors.Is(err, ErrClientEncryption) {
+		t.Fatalf("SaveStatementWithTransactions(plaintext) error = %v, want ErrClientEncryption", err)
+	}
+	if err := service.SaveStatementWithTransactions(ctx, newStatement("e2e:k1:not base64!")); !errors.Is(err, ErrClientEncryption) {
+		t.Fatalf("SaveStatementWithTransactions(malformed) error = %v, want ErrClientEncryption", err)
+	}
+
+	stmt := newStatement("e2e:k1:Y2lwaGVydGV4dA==")
+	if err := service.SaveStatementWithTransactions(ctx, stmt); err != nil {
+		t.Fatalf("SaveStatementWithTransactions() error = %v", err)
+	}
+	found, err := repo.FindTransactions(ctx, TransactionFilter{BlindIndex: "token-1"})
+	if err != nil {
+		t.Fatalf("FindTransactions() error = %v", err)
+	}
+	if len(found) != 1 || found[0].Description != "e2e:k1:Y2lwaGVydGV4dA==" {
+		t.Fatalf("found = %+v, want the encrypted transaction as sent", found)
+	}
+}
+
+func TestReconciliationListsMissingFeesAndMarksReconciled(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	repo := NewInMemoryRepo()
+	service := NewService(repo)
+	day := time.Date(2025, 5, 3, 0, 0, 0, 0, time.UTC)
+	stmt := &Statement{
+		SourceName:      "TSIB",
+		SourceID:        ptr("2025_05"),
+		Currency:        "TWD",
+		TotalAmount:     1350,
+		PaymentDueDate:  ptr(time.Date(2025, 5, 24, 0, 0, 0, 0, time.UTC)),
+		Fees:            []FeeItem{{Type: AnnualFee, Description: "Annual fee", Amount: 300}},
+		InterestCharged: ptr(50.0),
+		Transactions:    &[]Transaction{{ID: "hotel", Description: "Hotel", Amount: 1000, Date: day}},
+	}
+	if err := service.SaveStatementWithTransactions(ctx, stmt); err != nil {
+		t.Fatalf("SaveStatementWithTransactions() error = %v", err)
+	}
+
+	report, err := service.Reconciliation(ctx, stmt.ID, reconcileTolerance)
+	if err != nil {
+		t.Fatalf("Reconciliation() error = %v", err)
+	}
+	if report.Reconciled || report.Discrepancy != 350 || report.Unexplained != 0 || len(report.Candidates) != 2 {
+		t.Fatalf("report = %+v, want a discrepancy of 350 explained by the fee and the interest", report)
+	}
+	if report.Candidates[0].Kind != "annual_fee" || report.Candidates[1].Kind != "interest" {
+		t.Fatalf("candidates = %+v, want the annual fee and the interest", report.Candidates)
+	}
+
+	fees := []Transaction{
+		{ID: "fee", Description: "Annual fee", Amount: 300, Date: day, StatementID: stmt.ID},
+		{ID: "interest", Description: "Interest", Amount: 50, Date: day, StatementID: stmt.ID},
+	}
+	if err := repo.BulkUpsertTransactions(ctx, fees); err != nil {
+		t.Fatalf("BulkUpsertTransactions() error = %v", err)
+	}
+	report, err = service.Reconciliation(ctx, stmt.ID, reconcileTolerance)
+	if err != nil {
+		t.Fatalf("Reconciliation() error = %v", err)
+	}
+	stored, err := repo.GetStatement(ctx, stmt.ID)
+	if err != nil {
+		t.Fatalf("GetStatement() error = %v", err)
+	}
+	if !report.Reconciled || len(report.Candidates) != 0 || !stored.Reconciled || stored.ReconciledAt == nil {
+		t.Fatalf("report = %+v, stored reconciled = %v, want the statement marked reconciled", report, stored.Reconciled)
+	}
+}
+
+func TestBankPaymentLinksCardStatement(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	repo := NewInMemoryRepo()
+	service := NewService(repo)
+	card := &Statement{
+		SourceName:     "TSIB",
+		SourceType:     CreditCard,
+		SourceID:       ptr("2025_06"),
+		Currency:       "TWD",
+		TotalAmount:    5000,
+		PaymentDueDate: ptr(time.Date(2025, 6, 24, 0, 0, 0, 0, time.UTC)),
+		Transactions: &[]Transaction{
+			{ID: "laptop", Description: "Laptop", Amount: 5000, Date: time.Date(2025, 5, 20, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+	if err := service.SaveStatementWithTransactions(ctx, card); err != nil {
+		t.Fatalf("SaveStatementWithTransactions(card) error = %v", err)
+	}
+	bank := &Statement{
+		SourceName:  "Bank",
+		SourceType:  BankAccount,
+		Type:        BankStatement,
+		SourceID:    ptr("2025_06"),
+		Currency:    "TWD",
+		TotalAmount: 5300,
+		Transactions: &[]Transaction{
+			{ID: "card-payment", Description: "TSIB credit card payment", Amount: 5000, Date: time.Date(2025, 6, 20, 0, 0, 0, 0, time.UTC)},
+			{ID: "groceries", Description: "Groceries", Amount: 300, Date: time.Date(2025, 6, 21, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+	if err := service.SaveStatementWithTransactions(ctx, bank); err != nil {
+		t.Fatalf("SaveStatementWithTransactions(bank) error = %v", err)
+	}
+
+	linked := true
+	transfers, err := repo.FindTransactions(ctx, TransactionFilter{IsTransfer: &linked})
+	if err != nil {
+		t.Fatalf("FindTransactions() error = %v", err)
+	}
+	if len(transfers) != 1 || transfers[0].ID != "card-payment" || transfers[0].PaymentSource.StatementID != card.ID {
+		t.Fatalf("transfers = %+v, want the card payment linked to %s", transfers, card.ID)
+	}
+	stored, err := repo.GetStatement(ctx, card.ID)
+	if err != nil {
+		t.Fatalf("GetStatement() error = %v", err)
+	}
+	if !stored.IsPaid() || stored.PaymentMatch.Payment.TransactionID != "card-payment" {
+		t.Fatalf("card statement = %+v, want it paid by the bank transaction", stored.PaymentMatch)
+	}
+}
+
+func TestPaymentDetectionClosesTheEarlierStatement(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		mode PaymentCloseMode
+		want StatementStatus
+	}{
+		{PaymentCloseAuto, StatusPaid},
+		{PaymentCloseConfirm, StatusPaymentDetected},
+		{PaymentCloseOff, StatusOpen},
+	} {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			t.Parallel()
+
+			ctx := t.Context()
+			repo := NewInMemoryRepo()
+			service := NewService(repo)
+			service.Payments.Mode = tc.mode
+			january := &Statement{
+				SourceName:     "TSIB",
+				SourceID:       ptr("2025_01"),
+				Currency:       "TWD",
+				TotalAmount:    1200,
+				PaymentDueDate: ptr(time.Date(2025, 1, 24, 0, 0, 0, 0, time.UTC)),
+				Transactions:   &[]Transaction{{ID: "dinner", Amount: 1200, Date: time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)}},
+			}
+			if err := service.SaveStatementWithTransactions(ctx, january); err != nil {
+				t.Fatalf("SaveStatementWithTransactions(january) error = %v", err)
+			}
+			february := &Statement{
+				SourceName:     "TSIB",
+				SourceID:       ptr("2025_02"),
+				Currency:       "TWD",
+				TotalAmount:    300,
+				PaymentDueDate: ptr(time.Date(2025, 2, 24, 0, 0, 0, 0, time.UTC)),
+				Transactions: &[]Transaction{
+					{ID: "partial", Description: "PAYMENT THANK YOU", Amount: -200, Date: time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)},
+					{ID: "payment", Description: "PAYMENT THANK YOU", Amount: -1200, Date: time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC)},
+					{ID: "lunch", Amount: 1700, Date: time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC)},
+				},
+			}
+			if err := service.SaveStatementWithTransactions(ctx, february); err != nil {
+				t.Fatalf("SaveStatementWithTransactions(february) error = %v", err)
+			}
+
+			stored, err := repo.GetStatement(ctx, january.ID)
+			if err != nil {
+				t.Fatalf("GetStatement() error = %v", err)
+			}
+			if stored.Status != tc.want {
+				t.Fatalf("Status = %q, want %q", stored.Status, tc.want)
+			}
+			if tc.want == StatusOpen {
+				return
+			}
+			if stored.PaymentMatch == nil || stored.PaymentMatch.Payment.TransactionID != "payment" || stored.PaymentMatch.Confidence < service.Payments.Threshold {
+				t.Fatalf("PaymentMatch = %+v, want the full payment", stored.PaymentMatch)
+			}
+			if tc.want == StatusPaymentDetected {
+				if _, err := service.ConfirmPayment(ctx, january.ID); err != nil {
+					t.Fatalf("ConfirmPayment() error = %v", err)
+				}
+				if stored, _ = repo.GetStatement(ctx, january.ID); !stored.IsPaid() || stored.PaymentMatch.ConfirmedAt == nil {
+					t.Fatalf("confirmed statement = %q, %+v, want it paid", stored.Status, stored.PaymentMatch)
+				}
+			}
+			if _, err := service.ConfirmPayment(ctx, january.ID); !errors.Is(err, ErrNothingToConfirm) {
+				t.Errorf("ConfirmPayment(paid) error = %v, want ErrNothingToConfirm", err)
+			}
+		})
+	}
+}
+
+func TestRecordPaymentBelowTheThresholdKeepsTheStatementOpen(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	repo := NewInMemoryRepo()
+	service := NewService(repo)
+	stmt := &Statement{
+		SourceName:        "TSIB",
+		SourceID:          ptr("2025_03"),
+		Currency:          "TWD",
+		TotalAmount:       1000,
+		MinimumPaymentDue: ptr(100.0),
+		PaymentDueDate:    ptr(time.Date(2025, 3, 24, 0, 0, 0, 0, time.UTC)),
+	}
+	if err := service.SaveStatement(ctx, stmt); err != nil {
+		t.Fatalf("SaveStatement() error = %v", err)
+	}
+
+	for _, amount := range []float64{300, 100} {
+		paid, err := service.RecordPayment(ctx, stmt.ID, Payment{Amount: amount, Date: time.Date(2025, 3, 20, 0, 0, 0, 0, time.UTC)})
+		if err != nil {
+			t.Fatalf("RecordPayment(%v) error = %v", amount, err)
+		}
+		if paid.Status != StatusOpen {
+			t.Errorf("RecordPayment(%v) status = %q, want open", amount, paid.Status)
+		}
+	}
+	paid, err := service.RecordPayment(ctx, stmt.ID, Payment{Amount: 1000, Date: time.Date(2025, 3, 20, 0, 0, 0, 0, time.UTC)})
+	if err != nil || !paid.IsPaid() || paid.PaidAt == nil {
+		t.Fatalf("RecordPayment(1000) = %+v, %v, want it paid", paid, err)
+	}
+}
+
+func TestRepostedStatementKeepsTheStoredPaymentState(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	repo := NewInMemoryRepo()
+	service := NewService(repo)
+	posted := func(status StatementStatus) *Statement {
+		return &Statement{
+			SourceName:     "TSIB",
+			SourceID:       ptr("2025_04"),
+			Currency:       "TWD",
+			TotalAmount:    800,
+			PaymentDueDate: ptr(time.Date(2025, 4, 24, 0, 0, 0, 0, time.UTC)),
+			Status:         status,
+			PaidAt:         ptr(time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)),
+		}
+	}
+
+	// a new statement is open whatever was posted
+	stmt := posted(StatusPaid)
+	if err := service.SaveStatement(ctx, stmt); err != nil {
+		t.Fatalf("SaveStatement() error = %v", err)
+	}
+	if stored, _ := repo.GetStatement(ctx, stmt.ID); stored.Status != StatusOpen || stored.PaidAt != nil {
+		t.Fatalf("new statement = %q paid at %v, want open", stored.Status, stored.PaidAt)
+	}
+
+	paid, err := service.RecordPayment(ctx, stmt.ID, Payment{Amount: 800, Date: time.Date(2025, 4, 20, 0, 0, 0, 0, time.UTC)})
+	if err != nil || !paid.IsPaid() {
+		t.Fatalf("RecordPayment() = %+v, %v, want it paid", paid, err)
+	}
+	for _, status := range []StatementStatus{StatusOpen, StatusPaymentDetected} {
+		if err := service.SaveStatement(ctx, posted(status)); err != nil {
+			t.Fatalf("SaveStatement(%q) error = %v", status, err)
+		}
+		stored, _ := repo.GetStatement(ctx, stmt.ID)
+		if !stored.IsPaid() || !stored.PaidAt.Equal(*paid.PaidAt) || stored.PaymentMatch == nil {
+			t.Errorf("reposted as %q = %q paid at %v, want the recorded payment kept", status, stored.Status, stored.PaidAt)
+		}
+	}
+}
+
+var errDown = errors.New("database down")
+
+// outageRepo fails the calls of the degraded repository while down.
+type outageRepo struct {
+	StatementRepository
+	down bool
+}
+
+func (r *outageRepo) GetStatement(ctx context.Context, id string) (*Statement, error) {
+	if r.down {
+		return nil, errDown
+	}
+	return r.StatementRepository.GetStatement(ctx, id)
+}
+
+func (r *outageRepo) ListStatements(ctx context.Context, filter StatementFilter) ([]Statement, error) {
+	if r.down {
+		return nil, errDown
+	}
+	return r.StatementRepository.ListStatements(ctx, filter)
+}
+
+func (r *outageRepo) GetTransactions(ctx context.Context, statementID string) ([]Transaction, error) {
+	if r.down {
+		return nil, errDown
+	}
+	return r.StatementRepository.GetTransactions(ctx, statementID)
+}
+
+func (r *outageRepo) SaveStatementWithDelta(ctx context.Context, statement *Statement, delta TransactionDelta) error {
+	if r.down {
+		return errDown
+	}
+	return r.StatementRepository.SaveStatementWithDelta(ctx, statement, delta)
+}
+
+func TestDegradedWritesAreRefusedWithoutAnOutboxFile(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	outage := &outageRepo{StatementRepository: NewInMemoryRepo(), down: true}
+	repo := NewDegradableRepo(outage, func(err error) bool { return errors.Is(err, errDown) }, 10, 10)
+	stmt := &Statement{ID: "tsib", SourceName: "TSIB", Currency: "TWD"}
+	if err := repo.SaveStatementWithDelta(ctx, stmt, TransactionDelta{}); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("SaveStatementWithDelta() error = %v, want ErrUnavailable", err)
+	}
+	if left := repo.Flush(ctx); left != 0 {
+		t.Errorf("Flush() = %d queued writes, want none", left)
+	}
+}
+
+func TestDegradedSaveSurvivesARestartAndIsReconciled(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	file := filepath.Join(t.TempDir(), "outbox")
+	unavailable := func(err error) bool { return errors.Is(err, errDown) }
+	inner := NewInMemoryRepo()
+	due := ptr(time.Date(2025, 1, 24, 0, 0, 0, 0, time.UTC))
+	day := time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)
+
+	stored := &Statement{ID: "tsib", SourceName: "TSIB", Currency: "TWD", PaymentDueDate: due, Status: StatusPaid}
+	kept := Transaction{ID: "a", StatementID: "tsib", Description: "coffee", Amount: 50, Date: day, Dispute: &Dispute{Status: DisputeOpened}}
+	gone := Transaction{ID: "b", StatementID: "tsib", Description: "tea", Amount: 30, Date: day}
+	if err := inner.SaveStatementWithDelta(ctx, stored, TransactionDelta{Upserts: []Transaction{kept, gone}}); err != nil {
+		t.Fatalf("SaveStatementWithDelta() error = %v", err)
+	}
+
+	// the read cache is cold, the delta cannot tell that b is stored
+	outage := &outageRepo{StatementRepository: inner, down: true}
+	first := NewDegradableRepo(outage, unavailable, 10, 10)
+	if err := first.PersistOutbox(file); err != nil {
+		t.Fatalf("PersistOutbox() error = %v", err)
+	}
+	posted := &Statement{ID: "tsib", SourceName: "TSIB", Currency: "TWD", PaymentDueDate: due, Transactions: &[]Transaction{
+		{ID: "a", Description: "coffee", Amount: 50, Date: day},
+		{ID: "c", Description: "cake", Amount: 20, Date: day},
+	}}
+	if err := NewService(first).SaveStatementWithTransactions(ctx, posted); !errors.Is(err, ErrQueued) {
+		t.Fatalf("SaveStatementWithTransactions() error = %v, want ErrQueued", err)
+	}
+
+	// a new process replays the outbox file once the database is back
+	outage.down = false
+	second := NewDegradableRepo(outage, unavailable, 10, 10)
+	if err := second.PersistOutbox(file); err != nil {
+		t.Fatalf("PersistOutbox() error = %v", err)
+	}
+	if left := second.Flush(ctx); left != 0 {
+		t.Fatalf("Flush() = %d queued writes, want none", left)
+	}
+
+	txs, _ := inner.GetTransactions(ctx, "tsib")
+	ids := map[string]*Transaction{}
+	for i := range txs {
+		ids[txs[i].ID] = &txs[i]
+	}
+	if len(ids) != 2 || ids["a"] == nil || ids["c"] == nil {
+		t.Fatalf("transactions after replay = %+v, want a and c", txs)
+	}
+	if ids["a"].Dispute == nil {
+		t.Error("dispute of a was lost on replay")
+	}
+	if stmt, _ := inner.GetStatement(ctx, "tsib"); stmt.Status != StatusPaid {
+		t.Errorf("status after replay = %q, want the stored %q", stmt.Status, StatusPaid)
+	}
+
+	outage.down = true
+	third := NewDegradableRepo(outage, unavailable, 10, 10)
+	if err := third.PersistOutbox(file); err != nil {
+		t.Fatalf("PersistOutbox() error = %v", err)
+	}
+	if left := third.Flush(ctx); left != 0 {
+		t.Errorf("outbox file after replay holds %d writes, want none", left)
+	}
+}
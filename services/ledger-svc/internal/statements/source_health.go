@@ -0,0 +1,219 @@
+package statements
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// healthWindow is the number of most recent statements the current grade is based on.
+	healthWindow = 6
+	// statement cycles are monthly, a due date outside this gap means a late or missed statement
+	minCycleGap = 25 * 24 * time.Hour
+	maxCycleGap = 35 * 24 * time.Hour
+	// overdueAfter is how long after the latest due date the next statement counts as missing
+	overdueAfter = 45 * 24 * time.Hour
+
+	reconcileTolerance = 0.01
+	trendThreshold     = 0.05
+)
+
+type SourceHealth struct {
+	SourceName       string              `json:"source_name"`
+	Grade            string              `json:"grade"`
+	Score            float64             `json:"score"`
+	Trend            string              `json:"trend"`
+	ParseSuccessRate float64             `json:"parse_success_rate"`
+	ReconciledRate   float64             `json:"reconciled_rate"`
+	PunctualityRate  float64             `json:"punctuality_rate"`
+	DataQuality      float64             `json:"data_quality"`
+	LastDueDate      *time.Time          `json:"last_due_date,omitempty"`
+	History          []SourceHealthPoint `json:"history"`
+}
+
+type SourceHealthPoint struct {
+	StatementID string    `json:"statement_id"`
+	DueDate     time.Time `json:"due_date"`
+	Grade       string    `json:"grade"`
+	Score       float64   `json:"score"`
+}
+
+type statementSignals struct {
+	parsed     float64
+	reconciled float64
+	punctual   float64
+	quality    float64
+}
+
+func (s statementSignals) score() float64 {
+	return (s.parsed + s.reconciled + s.punctual + s.quality) / 4
+}
+
+// SourceHealth grades every account (source name) from four signals per statement:
+// whether the transactions were parsed (not just the total placeholder), whether
+// they reconcile with the totals, whether the statement arrived one cycle after the
+// previous one, and how many optional fields were filled. The grade covers the last
+// healthWindow statements, the history has one point per statement.
+func (s *StatementService) SourceHealth(ctx context.Context, sourceName string, now time.Time) ([]SourceHealth, error) {
+	statements, err := s.Repo.ListStatements(ctx, StatementFilter{SourceName: sourceName})
+	if err != nil {
+		return nil, err
+	}
+
+	bySource := make(map[string][]Statement)
+	for _, stmt := range statements {
+		bySource[stmt.SourceName] = append(bySource[stmt.SourceName], stmt)
+	}
+
+	result := make([]SourceHealth, 0, len(bySource))
+	for name, stmts := range bySource {
+		sort.SliceStable(stmts, func(i, j int) bool {
+			return dueDateOf(&stmts[i]).Before(dueDateOf(&stmts[j]))
+		})
+
+		health := SourceHealth{SourceName: name, History: make([]SourceHealthPoint, 0, len(stmts))}
+		signals := make([]statementSignals, 0, len(stmts))
+		for i := range stmts {
+			txs, err := s.Repo.GetTransactions(ctx, stmts[i].ID)
+			if err != nil {
+				return nil, err
+			}
+
+			var previous *Statement
+			if i > 0 {
+				previous = &stmts[i-1]
+			}
+			sig := signalsOf(&stmts[i], previous, txs)
+			signals = append(signals, sig)
+			health.History = append(health.History, SourceHealthPoint{
+				StatementID: stmts[i].ID,
+				DueDate:     dueDateOf(&stmts[i]),
+				Grade:       gradeOf(sig.score()),
+				Score:       round2(sig.score()),
+			})
+		}
+
+		last := stmts[len(stmts)-1]
+		health.LastDueDate = last.PaymentDueDate
+		recent := signals[max(0, len(signals)-healthWindow):]
+		if last.PaymentDueDate != nil && now.Sub(*last.PaymentDueDate) > overdueAfter {
+			// the next statement has not arrived, count it as a missed cycle
+			recent = append(recent[:len(recent):len(recent)], statementSignals{})
+		}
+		health.summarize(recent)
+		health.Trend = trendOf(health.History)
+		result = append(result, health)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].SourceName < result[j].SourceName
+	})
+	return result, nil
+}
+
+func signalsOf(stmt, previous *Statement, txs []Transaction) statementSignals {
+	var sig statementSignals
+
+	placeholder := len(txs) == 1 && txs[0].ID == stmt.ID
+	if len(txs) > 0 && !placeholder {
+		sig.parsed = 1
+	}
+
+	if Reconcile(stmt, txs, reconcileTolerance).Reconciled {
+		sig.reconciled = 1
+	}
+
+	sig.punctual = 1
+	if previous != nil && previous.PaymentDueDate != nil {
+		if stmt.PaymentDueDate == nil {
+			sig.punctual = 0
+		} else if gap := stmt.PaymentDueDate.Sub(*previous.PaymentDueDate); gap < minCycleGap || gap > maxCycleGap {
+			sig.punctual = 0
+		}
+	}
+
+	checks := []bool{
+		stmt.SourceID != nil,
+		stmt.PaymentDueDate != nil,
+		stmt.CurrentAmount != nil,
+		stmt.PreviousAmount != nil,
+		stmt.MinimumPaymentDue != nil,
+	}
+	if sig.parsed == 1 {
+		categorized := 0
+		for _, tx := range txs {
+			if tx.Category != "" {
+				categorized++
+			}
+		}
+		checks = append(checks, categorized*2 >= len(txs))
+	}
+	filled := 0
+	for _, ok := range checks {
+		if ok {
+			filled++
+		}
+	}
+	sig.quality = float64(filled) / float64(len(checks))
+	return sig
+}
+
+func (h *SourceHealth) summarize(signals []statementSignals) {
+	var total statementSignals
+	for _, sig := range signals {
+		total.parsed += sig.parsed
+		total.reconciled += sig.reconciled
+		total.punctual += sig.punctual
+		total.quality += sig.quality
+	}
+	n := float64(len(signals))
+	h.ParseSuccessRate = round2(total.parsed / n)
+	h.ReconciledRate = round2(total.reconciled / n)
+	h.PunctualityRate = round2(total.punctual / n)
+	h.DataQuality = round2(total.quality / n)
+	h.Score = round2(total.score() / n)
+	h.Grade = gradeOf(h.Score)
+}
+
+// trendOf compares the latest statement with the average of the ones before it.
+func trendOf(history []SourceHealthPoint) string {
+	if len(history) < 2 {
+		return "stable"
+	}
+	previous := history[max(0, len(history)-1-3) : len(history)-1]
+	var avg float64
+	for _, p := range previous {
+		avg += p.Score
+	}
+	avg /= float64(len(previous))
+
+	switch diff := history[len(history)-1].Score - avg; {
+	case diff > trendThreshold:
+		return "improving"
+	case diff < -trendThreshold:
+		return "declining"
+	default:
+		return "stable"
+	}
+}
+
+func gradeOf(score float64) string {
+	switch {
+	case score >= 0.9:
+		return "A"
+	case score >= 0.75:
+		return "B"
+	case score >= 0.6:
+		return "C"
+	case score >= 0.4:
+		return "D"
+	default:
+		return "F"
+	}
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,76 @@
+package statements
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SpendType tells the merchant spend apart from what the issuer or the
+// holder moved: fees, interest, transfers such as card payments, and refunds.
+type SpendType string
+
+const (
+	SpendMerchant SpendType = "merchant"
+	SpendFee      SpendType = "fee"
+	SpendInterest SpendType = "interest"
+	SpendTransfer SpendType = "transfer"
+	SpendRefund   SpendType = "refund"
+)
+
+var SpendTypes = []SpendType{SpendMerchant, SpendFee, SpendInterest, SpendTransfer, SpendRefund}
+
+func (t SpendType) Valid() bool {
+	switch t {
+	case SpendMerchant, SpendFee, SpendInterest, SpendTransfer, SpendRefund:
+		return true
+	}
+	return false
+}
+
+// ParseSpendType reads a spend type parameter, the empty string being none.
+func ParseSpendType(s string) (SpendType, error) {
+	t := SpendType(strings.ToLower(strings.TrimSpace(s)))
+	if t != "" && !t.Valid() {
+		return "", fmt.Errorf("unknown spend type %q, expected merchant, fee, interest, transfer or refund", s)
+	}
+	return t, nil
+}
+
+var (
+	interestKeywords = []string{"interest", "finance charge", "利息", "循環息"}
+	feeKeywords      = []string{
+		"annual fee", "late fee", "late charge", "foreign transaction fee", "fx fee", "service fee", "cash advance fee", "overlimit fee",
+		"年費", "手續費", "服務費", "違約金", "滯納金", "國外交易",
+	}
+	transferKeywords = []string{"transfer", "轉帳", "轉出", "轉入"}
+)
+
+// ClassifySpend returns the spend type of a transaction, derived from its
+// description and amount unless the fetcher or a client set one. A credit is
+// a refund unless it reads like a payment; client-encrypted descriptions are
+// only told apart by the sign of the amount.
+func ClassifySpend(tx *Transaction) SpendType {
+	if tx.SpendType != "" {
+		return tx.SpendType
+	}
+	if tx.PaymentSource != nil {
+		return SpendTransfer
+	}
+	description := strings.ToLower(tx.Description)
+	if IsClientEncrypted(tx.Description) {
+		description = ""
+	}
+	switch {
+	case tx.Amount < 0 && containsAny(description, paymentKeywords):
+		return SpendTransfer
+	case tx.Amount < 0:
+		return SpendRefund
+	case containsAny(description, interestKeywords):
+		return SpendInterest
+	case containsAny(description, feeKeywords):
+		return SpendFee
+	case containsAny(description, transferKeywords):
+		return SpendTransfer
+	}
+	return SpendMerchant
+}
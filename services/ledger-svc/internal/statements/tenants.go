@@ -0,0 +1,61 @@
+package statements
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type tenantKey struct{}
+
+// WithTenant scopes the repository calls made with ctx to the tenant, a
+// family sharing the deployment with others: they see and change only what
+// the tenant owns, on top of the user scope of WithUser. An empty tenant
+// leaves ctx unscoped.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	if tenantID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFrom returns the tenant ctx is scoped to, empty when it is not.
+func TenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// Owner names the tenant and user owning what is stored, tenant/user, or
+// the user alone without a tenant, for OwnedID and for the caches and streams
+// kept per owner.
+func Owner(tenantID, userID string) string {
+	if tenantID == "" {
+		return userID
+	}
+	return tenantID + "/" + userID
+}
+
+// OwnerFrom returns the owner ctx is scoped to, empty when it is not.
+func OwnerFrom(ctx context.Context) string {
+	return Owner(TenantFrom(ctx), UserFrom(ctx))
+}
+
+// Owns reports whether the scope of ctx covers what the tenant and user own,
+// for the repository and the stores kept beside it.
+func Owns(ctx context.Context, tenantID, userID string) bool {
+	tenant, user := TenantFrom(ctx), UserFrom(ctx)
+	return (tenant == "" || tenantID == tenant) && (user == "" || userID == user)
+}
+
+// OwnerFilter adds the tenant and user ctx is scoped to, to a MongoDB filter
+// on the tenant_id and user_id fields, for the stores kept beside the
+// repository. An unscoped ctx leaves it as is.
+func OwnerFilter(ctx context.Context, filter bson.M) bson.M {
+	if tenant := TenantFrom(ctx); tenant != "" {
+		filter["tenant_id"] = tenant
+	}
+	if user := UserFrom(ctx); user != "" {
+		filter["user_id"] = user
+	}
+	return filter
+}
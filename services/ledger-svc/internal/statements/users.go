@@ -0,0 +1,290 @@
+package statements
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+)
+
+// ErrNotOwned is returned when a user writes a statement or transaction
+// stored for another user or tenant.
+var ErrNotOwned = apierror.New(apierror.KindForbidden, "not_owned", "owned by another user")
+
+// errOwnershipUnknown refuses a scoped transaction write on a repository none
+// of whose layers resolves transactions by ID: the owner of a stored one could
+// not be checked.
+var errOwnershipUnknown = errors.New("statements: the repository cannot resolve transactions by ID to check their owner")
+
+type userKey struct{}
+
+// WithUser scopes the repository calls made with ctx to the user: they see
+// and change only what the user owns, and what they store is owned by the
+// user. An empty user leaves ctx unscoped.
+func WithUser(ctx context.Context, userID string) context.Context {
+	if userID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+// UserFrom returns the user ctx is scoped to, empty when it is not.
+func UserFrom(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+// OwnedID prefixes an ID derived from the source with the owner, see Owner,
+// so the statements of two users of the same bank do not collide.
+func OwnedID(owner, id string) string {
+	if owner == "" {
+		return id
+	}
+	return owner + ":" + id
+}
+
+// ownedTransactionID is OwnedID for the ID of an ingested transaction, which
+// the importers derive from the file alone, left as is when it already is
+// the owner's, e.g. for a transaction read back and posted again.
+func ownedTransactionID(owner, id string) string {
+	if owner == "" || id == "" || strings.HasPrefix(id, owner+":") {
+		return id
+	}
+	return OwnedID(owner, id)
+}
+
+// ScopedRepo enforces the tenant and the user of the context on the wrapped
+// repository. Calls without either, from the workers and commands of a
+// deployment without authentication, see and change everything as before.
+// Native queries bypass it, RunQuery scopes them instead. A write whose
+// ownership cannot be read, e.g. while the database is away or on a
+// repository that cannot resolve transactions by ID, fails rather than being
+// queued or trusted.
+type ScopedRepo struct {
+	StatementRepository
+}
+
+func NewScopedRepo(repo StatementRepository) *ScopedRepo {
+	return &ScopedRepo{StatementRepository: repo}
+}
+
+func (r *ScopedRepo) Unwrap() StatementRepository {
+	return r.StatementRepository
+}
+
+func (r *ScopedRepo) Describe() map[string]string {
+	if d, ok := r.StatementRepository.(Describer); ok {
+		return d.Describe()
+	}
+	return nil
+}
+
+// GetStatement answers nil for the statements of other users and tenants, as
+// for missing ones, so their IDs are not confirmed.
+func (r *ScopedRepo) GetStatement(ctx context.Context, id string) (*Statement, error) {
+	stmt, err := r.StatementRepository.GetStatement(ctx, id)
+	if err != nil || stmt == nil {
+		return stmt, err
+	}
+	if !Owns(ctx, stmt.TenantID, stmt.UserID) {
+		return nil, nil
+	}
+	return stmt, nil
+}
+
+func (r *ScopedRepo) ListStatements(ctx context.Context, filter StatementFilter) ([]Statement, error) {
+	filter.TenantID, filter.UserID = Stamp(ctx, filter.TenantID, filter.UserID)
+	return r.StatementRepository.ListStatements(ctx, filter)
+}
+
+func (r *ScopedRepo) UpsertStatement(ctx context.Context, statement *Statement) error {
+	if err := r.own(ctx, statement); err != nil {
+		return err
+	}
+	return r.StatementRepository.UpsertStatement(ctx, statement)
+}
+
+func (r *ScopedRepo) DeleteStatement(ctx context.Context, id string) error {
+	if OwnerFrom(ctx) == "" {
+		return r.StatementRepository.DeleteStatement(ctx, id)
+	}
+	stmt, err := r.StatementRepository.GetStatement(ctx, id)
+	if err != nil {
+		return err
+	}
+	if stmt == nil || !Owns(ctx, stmt.TenantID, stmt.UserID) {
+		// deleting a missing statement is not an error
+		return nil
+	}
+	return r.StatementRepository.DeleteStatement(ctx, id)
+}
+
+func (r *ScopedRepo) GetTransactions(ctx context.Context, statementID string) ([]Transaction, error) {
+	txs, err := r.StatementRepository.GetTransactions(ctx, statementID)
+	if err != nil || OwnerFrom(ctx) == "" {
+		return txs, err
+	}
+	owned := make([]Transaction, 0, len(txs))
+	for _, tx := range txs {
+		if Owns(ctx, tx.TenantID, tx.UserID) {
+			owned = append(owned, tx)
+		}
+	}
+	return owned, nil
+}
+
+func (r *ScopedRepo) ListTransactions(ctx context.Context, filter TransactionFilter, page Page) ([]Transaction, error) {
+	filter.TenantID, filter.UserID = Stamp(ctx, filter.TenantID, filter.UserID)
+	return r.StatementRepository.ListTransactions(ctx, filter, page)
+}
+
+func (r *ScopedRepo) FindTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error) {
+	filter.TenantID, filter.UserID = Stamp(ctx, filter.TenantID, filter.UserID)
+	return r.StatementRepository.FindTransactions(ctx, filter)
+}
+
+func (r *ScopedRepo) UpsertTransaction(ctx context.Context, tx *Transaction) error {
+	txs := []Transaction{*tx}
+	if err := r.ownTransactions(ctx, txs); err != nil {
+		return err
+	}
+	tx.TenantID, tx.UserID = txs[0].TenantID, txs[0].UserID
+	return r.StatementRepository.UpsertTransaction(ctx, tx)
+}
+
+func (r *ScopedRepo) BulkUpsertTransactions(ctx context.Context, transactions []Transaction) error {
+	if err := r.ownTransactions(ctx, transactions); err != nil {
+		return err
+	}
+	return r.StatementRepository.BulkUpsertTransactions(ctx, transactions)
+}
+
+func (r *ScopedRepo) DeleteTransaction(ctx context.Context, id string) error {
+	ids, err := r.ownedIDs(ctx, []string{id})
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return r.StatementRepository.DeleteTransaction(ctx, id)
+}
+
+func (r *ScopedRepo) BulkDeleteTransactions(ctx context.Context, ids []string) error {
+	ids, err := r.ownedIDs(ctx, ids)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return r.StatementRepository.BulkDeleteTransactions(ctx, ids)
+}
+
+func (r *ScopedRepo) SaveStatementWithDelta(ctx context.Context, statement *Statement, delta TransactionDelta) error {
+	if err := r.own(ctx, statement); err != nil {
+		return err
+	}
+	if err := r.ownTransactions(ctx, delta.Upserts); err != nil {
+		return err
+	}
+	deletes, err := r.ownedIDs(ctx, delta.Deletes)
+	if err != nil {
+		return err
+	}
+	delta.Deletes = deletes
+	return r.StatementRepository.SaveStatementWithDelta(ctx, statement, delta)
+}
+
+// own stamps the statement and its embedded transactions with the tenant and
+// user, ErrNotOwned when the statement is stored for another one.
+func (r *ScopedRepo) own(ctx context.Context, statement *Statement) error {
+	if OwnerFrom(ctx) == "" {
+		return nil
+	}
+	existing, err := r.StatementRepository.GetStatement(ctx, statement.ID)
+	if err != nil {
+		return err
+	}
+	if existing != nil && !Owns(ctx, existing.TenantID, existing.UserID) {
+		return ErrNotOwned
+	}
+	statement.TenantID, statement.UserID = Stamp(ctx, statement.TenantID, statement.UserID)
+	if statement.Transactions != nil {
+		for i := range *statement.Transactions {
+			tx := &(*statement.Transactions)[i]
+			tx.TenantID, tx.UserID = statement.TenantID, statement.UserID
+		}
+	}
+	return nil
+}
+
+// ownTransactions stamps the transactions with the tenant and user,
+// ErrNotOwned when one of them is stored for another one.
+func (r *ScopedRepo) ownTransactions(ctx context.Context, transactions []Transaction) error {
+	if OwnerFrom(ctx) == "" || len(transactions) == 0 {
+		return nil
+	}
+	stored, err := r.storedTransactions(ctx, transactionIDs(transactions))
+	if err != nil {
+		return err
+	}
+	for _, tx := range stored {
+		if !Owns(ctx, tx.TenantID, tx.UserID) {
+			return ErrNotOwned
+		}
+	}
+	for i := range transactions {
+		transactions[i].TenantID, transactions[i].UserID = Stamp(ctx, transactions[i].TenantID, transactions[i].UserID)
+	}
+	return nil
+}
+
+// ownedIDs keeps the IDs of the transactions the scope owns or that are not
+// stored, the others are left alone as if they were missing.
+func (r *ScopedRepo) ownedIDs(ctx context.Context, ids []string) ([]string, error) {
+	if OwnerFrom(ctx) == "" || len(ids) == 0 {
+		return ids, nil
+	}
+	stored, err := r.storedTransactions(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	foreign := map[string]bool{}
+	for _, tx := range stored {
+		if !Owns(ctx, tx.TenantID, tx.UserID) {
+			foreign[tx.ID] = true
+		}
+	}
+	owned := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !foreign[id] {
+			owned = append(owned, id)
+		}
+	}
+	return owned, nil
+}
+
+func (r *ScopedRepo) storedTransactions(ctx context.Context, ids []string) ([]Transaction, error) {
+	return transactionsByID(ctx, r.StatementRepository, ids)
+}
+
+// transactionsByID reads the transactions through the first layer of repo
+// resolving them by ID, whoever owns them, errOwnershipUnknown without one.
+func transactionsByID(ctx context.Context, repo StatementRepository, ids []string) ([]Transaction, error) {
+	for _, layer := range Layers(repo) {
+		if byID, ok := layer.(interface {
+			TransactionsByID(ctx context.Context, ids []string) ([]Transaction, error)
+		}); ok {
+			return byID.TransactionsByID(ctx, ids)
+		}
+	}
+	return nil, errOwnershipUnknown
+}
+
+// Stamp returns the tenant and user of ctx in place of the given ones, for
+// the filters and what is stored; those ctx is not scoped to are kept.
+func Stamp(ctx context.Context, tenantID, userID string) (string, string) {
+	if tenant := TenantFrom(ctx); tenant != "" {
+		tenantID = tenant
+	}
+	if user := UserFrom(ctx); user != "" {
+		userID = user
+	}
+	return tenantID, userID
+}
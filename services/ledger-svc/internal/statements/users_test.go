@@ -0,0 +1,189 @@
+package statements
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ownershipDrivers opens an empty repository of every driver. MongoDB and
+// PostgreSQL are only tested against MONGO_TEST_URI and POSTGRES_TEST_URL, in
+// a database or schema of their own dropped afterwards.
+var ownershipDrivers = map[string]func(t *testing.T) StatementRepository{
+	memoryDriver: func(t *testing.T) StatementRepository {
+		return NewInMemoryRepo()
+	},
+	dynamoDriver: func(t *testing.T) StatementRepository {
+		return NewDynamoRepo(newFakeDynamo(), "finchie", time.Second)
+	},
+	mongoDriver: func(t *testing.T) StatementRepository {
+		uri := os.Getenv("MONGO_TEST_URI")
+		if uri == "" {
+			t.Skip("MONGO_TEST_URI is not set")
+		}
+		db, err := connectMongo(uri, fmt.Sprintf("finchie_test_%d", time.Now().UnixNano()), 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = db.Drop(context.Background())
+			_ = db.Client().Disconnect(context.Background())
+		})
+		return NewMongoRepo(db, "", MongoQueryConfig{Timeout: 5 * time.Second})
+	},
+	postgresDriver: func(t *testing.T) StatementRepository {
+		url := os.Getenv("POSTGRES_TEST_URL")
+		if url == "" {
+			t.Skip("POSTGRES_TEST_URL is not set")
+		}
+		ctx := t.Context()
+		schema := fmt.Sprintf("finchie_test_%d", time.Now().UnixNano())
+		admin, err := pgxpool.New(ctx, url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(admin.Close)
+		if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _, _ = admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE") })
+
+		cfg, err := pgxpool.ParseConfig(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.ConnConfig.RuntimeParams["search_path"] = schema
+		pool, err := pgxpool.NewWithConfig(ctx, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(pool.Close)
+		if _, err := pool.Exec(ctx, postgresSchema); err != nil {
+			t.Fatal(err)
+		}
+		return NewPostgresRepo(pool, 5*time.Second)
+	},
+}
+
+func TestTenantsImportingTheSameFileKeepTheirTransactions(t *testing.T) {
+	for name, open := range ownershipDrivers {
+		t.Run(name, func(t *testing.T) {
+			repo := NewScopedRepo(open(t))
+			service := NewService(repo)
+			acme := WithTenant(WithUser(t.Context(), "alice"), "acme")
+			umbrella := WithTenant(WithUser(t.Context(), "bob"), "umbrella")
+
+			// the importers derive the same transaction ID from the same file
+			for i, ctx := range []context.Context{acme, umbrella} {
+				stmt := &Statement{
+					SourceName:     "TSIB",
+					SourceID:       ptr("2025_01"),
+					Currency:       "TWD",
+					TotalAmount:    float64(100 * (i + 1)),
+					PaymentDueDate: ptr(time.Date(2025, 1, 24, 0, 0, 0, 0, time.UTC)),
+					Transactions: &[]Transaction{{
+						ID: "csv_0123456789abcdef", Description: "Coffee", Amount: float64(100 * (i + 1)),
+						Date: time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC),
+					}},
+				}
+				if err := service.SaveStatementWithTransactions(ctx, stmt); err != nil {
+					t.Fatalf("SaveStatementWithTransactions(%s) error = %v", TenantFrom(ctx), err)
+				}
+			}
+
+			for i, ctx := range []context.Context{acme, umbrella} {
+				txs, err := repo.FindTransactions(ctx, TransactionFilter{})
+				if err != nil {
+					t.Fatalf("FindTransactions(%s) error = %v", TenantFrom(ctx), err)
+				}
+				want := OwnedID(OwnerFrom(ctx), "csv_0123456789abcdef")
+				if len(txs) != 1 || txs[0].ID != want || txs[0].Amount != float64(100*(i+1)) {
+					t.Errorf("FindTransactions(%s) = %+v, want %s of its own import", TenantFrom(ctx), txs, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTenantsCannotWriteEachOthersTransactions(t *testing.T) {
+	for name, open := range ownershipDrivers {
+		t.Run(name, func(t *testing.T) {
+			repo := NewScopedRepo(open(t))
+			acme := WithTenant(WithUser(t.Context(), "alice"), "acme")
+			umbrella := WithTenant(WithUser(t.Context(), "bob"), "umbrella")
+			date := time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)
+
+			if err := repo.UpsertStatement(acme, &Statement{ID: "acme_stmt", SourceName: "TSIB", Currency: "TWD"}); err != nil {
+				t.Fatalf("UpsertStatement() error = %v", err)
+			}
+			if err := repo.BulkUpsertTransactions(acme, []Transaction{{ID: "coffee", StatementID: "acme_stmt", Amount: 100, Date: date}}); err != nil {
+				t.Fatalf("BulkUpsertTransactions() error = %v", err)
+			}
+			if err := repo.UpsertStatement(umbrella, &Statement{ID: "umbrella_stmt", SourceName: "TSIB", Currency: "TWD"}); err != nil {
+				t.Fatalf("UpsertStatement() error = %v", err)
+			}
+
+			takeover := Transaction{ID: "coffee", StatementID: "umbrella_stmt", Amount: 1, Date: date}
+			if err := repo.UpsertTransaction(umbrella, &takeover); !errors.Is(err, ErrNotOwned) {
+				t.Errorf("UpsertTransaction(other tenant) error = %v, want ErrNotOwned", err)
+			}
+			if err := repo.BulkUpsertTransactions(umbrella, []Transaction{takeover}); !errors.Is(err, ErrNotOwned) {
+				t.Errorf("BulkUpsertTransactions(other tenant) error = %v, want ErrNotOwned", err)
+			}
+			if err := repo.DeleteTransaction(umbrella, "coffee"); err != nil {
+				t.Errorf("DeleteTransaction(other tenant) error = %v", err)
+			}
+			if err := repo.BulkDeleteTransactions(umbrella, []string{"coffee"}); err != nil {
+				t.Errorf("BulkDeleteTransactions(other tenant) error = %v", err)
+			}
+
+			txs, err := repo.GetTransactions(acme, "acme_stmt")
+			if err != nil || len(txs) != 1 || txs[0].Amount != 100 {
+				t.Errorf("GetTransactions() = %+v, %v, want the untouched transaction of acme", txs, err)
+			}
+		})
+	}
+}
+
+// opaqueRepo hides every method outside StatementRepository, TransactionsByID
+// included, like a driver that cannot resolve transactions by ID.
+type opaqueRepo struct {
+	StatementRepository
+}
+
+func TestScopedTransactionWritesNeedTheOwnerOfStoredOnes(t *testing.T) {
+	t.Parallel()
+
+	repo := NewScopedRepo(opaqueRepo{NewInMemoryRepo()})
+	acme := WithTenant(WithUser(t.Context(), "alice"), "acme")
+	tx := &Transaction{ID: "coffee", StatementID: "stmt", Amount: 100, Date: time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)}
+
+	if err := repo.UpsertTransaction(acme, tx); !errors.Is(err, errOwnershipUnknown) {
+		t.Errorf("UpsertTransaction(scoped) error = %v, want errOwnershipUnknown", err)
+	}
+	if err := repo.BulkDeleteTransactions(acme, []string{"coffee"}); !errors.Is(err, errOwnershipUnknown) {
+		t.Errorf("BulkDeleteTransactions(scoped) error = %v, want errOwnershipUnknown", err)
+	}
+	// the workers and commands of a deployment without authentication
+	if err := repo.UpsertTransaction(t.Context(), tx); err != nil {
+		t.Errorf("UpsertTransaction(unscoped) error = %v", err)
+	}
+}
+
+func TestCheckSideStores(t *testing.T) {
+	t.Parallel()
+
+	if err := CheckSideStores(NewScopedRepo(NewInMemoryRepo())); err != nil {
+		t.Errorf("CheckSideStores(memory) error = %v", err)
+	}
+	err := CheckSideStores(NewScopedRepo(NewDynamoRepo(newFakeDynamo(), "finchie", time.Second)))
+	if err == nil || !strings.Contains(err.Error(), "API keys") {
+		t.Errorf("CheckSideStores(dynamo) error = %v, want the unsupported stores", err)
+	}
+}
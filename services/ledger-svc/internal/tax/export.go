@@ -0,0 +1,239 @@
+package tax
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/categories"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const totalLabel = "Total"
+
+// Line is the deductible total of one Finchie category under a tax category.
+type Line struct {
+	TaxCategory  string  `json:"tax_category"`
+	Category     string  `json:"category"`
+	Transactions int     `json:"transactions"`
+	Total        float64 `json:"total"`
+}
+
+// Item is a transaction counted in the export.
+type Item struct {
+	TaxCategory string
+	// MappedCategory is the category the mapping was found on, the
+	// transaction category or one of its ancestors.
+	MappedCategory string
+	Transaction    statements.Transaction
+}
+
+// Export is the deductible spend of a calendar year, in UTC like the other
+// reports.
+type Export struct {
+	Year  int
+	Lines []Line
+	Items []Item
+	Total float64
+}
+
+// Build collects the transactions of the year whose category, or its closest
+// mapped ancestor along the taxonomy, has a deductible mapping. Transfers are
+// never deductible; refunds reduce the totals.
+func Build(ctx context.Context, repo statements.StatementRepository, mappings []Mapping, taxonomy *categories.Taxonomy, year int) (*Export, error) {
+	from := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	txs, err := repo.FindTransactions(ctx, statements.TransactionFilter{From: from, To: from.AddDate(1, 0, 0)})
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Export{Year: year}
+	lines := map[[2]string]*Line{}
+	for i := range txs {
+		tx := &txs[i]
+		if tx.Category == "" || statements.ClassifySpend(tx) == statements.SpendTransfer {
+			continue
+		}
+		path := taxonomy.Path(tx.Category)
+		m := resolve(mappings, path)
+		if m == nil || !m.Deductible {
+			continue
+		}
+		e.Items = append(e.Items, Item{TaxCategory: m.TaxCategory, MappedCategory: m.Category, Transaction: *tx})
+		// the taxonomy spelling, categories are matched case insensitively
+		category := path[len(path)-1]
+		key := [2]string{m.TaxCategory, strings.ToLower(category)}
+		line, ok := lines[key]
+		if !ok {
+			line = &Line{TaxCategory: m.TaxCategory, Category: category}
+			lines[key] = line
+		}
+		line.Transactions++
+		line.Total += tx.Amount
+		e.Total += tx.Amount
+	}
+
+	for _, line := range lines {
+		line.Total = money.Round(line.Total)
+		e.Lines = append(e.Lines, *line)
+	}
+	sort.Slice(e.Lines, func(i, j int) bool {
+		if e.Lines[i].TaxCategory != e.Lines[j].TaxCategory {
+			return e.Lines[i].TaxCategory < e.Lines[j].TaxCategory
+		}
+		return e.Lines[i].Category < e.Lines[j].Category
+	})
+	sort.SliceStable(e.Items, func(i, j int) bool {
+		if e.Items[i].TaxCategory != e.Items[j].TaxCategory {
+			return e.Items[i].TaxCategory < e.Items[j].TaxCategory
+		}
+		return e.Items[i].Transaction.Date.Before(e.Items[j].Transaction.Date)
+	})
+	e.Total = money.Round(e.Total)
+	return e, nil
+}
+
+// resolve returns the mapping of the deepest category of the path that has
+// one, nil when none has.
+func resolve(mappings []Mapping, path []string) *Mapping {
+	for i := len(path) - 1; i >= 0; i-- {
+		for j := range mappings {
+			if strings.EqualFold(mappings[j].Category, path[i]) {
+				return &mappings[j]
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	summaryHeader     = []string{"tax_category", "category", "transactions", "total"}
+	transactionHeader = []string{"tax_category", "mapped_category", "date", "description", "category", "amount", "currency", "id", "statement_id"}
+)
+
+func (e *Export) summaryRows() [][]string {
+	rows := [][]string{summaryHeader}
+	for _, line := range e.Lines {
+		rows = append(rows, []string{line.TaxCategory, line.Category, strconv.Itoa(line.Transactions), money.FormatPlain(line.Total)})
+	}
+	return append(rows, []string{totalLabel, "", strconv.Itoa(len(e.Items)), money.FormatPlain(e.Total)})
+}
+
+func (e *Export) transactionRows() [][]string {
+	rows := [][]string{transactionHeader}
+	for _, item := range e.Items {
+		tx := &item.Transaction
+		rows = append(rows, []string{
+			item.TaxCategory,
+			item.MappedCategory,
+			tx.Date.UTC().Format(time.DateOnly),
+			tx.Description,
+			tx.Category,
+			money.FormatPlain(tx.Amount),
+			tx.Currency,
+			tx.ID,
+			tx.StatementID,
+		})
+	}
+	return rows
+}
+
+// WriteSummaryCSV writes the totals by tax and Finchie category and the
+// grand total.
+func (e *Export) WriteSummaryCSV(w io.Writer) error {
+	return writeCSV(w, e.summaryRows())
+}
+
+// WriteTransactionsCSV writes the transactions behind the totals.
+func (e *Export) WriteTransactionsCSV(w io.Writer) error {
+	return writeCSV(w, e.transactionRows())
+}
+
+func writeCSV(w io.Writer, rows [][]string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// WriteXLSX writes a workbook with the summary and the transactions on two
+// sheets, the amounts as numbers and the dates as dates.
+func (e *Export) WriteXLSX(w io.Writer) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	const summary, transactions = "Summary", "Transactions"
+	if err := f.SetSheetName("Sheet1", summary); err != nil {
+		return err
+	}
+	if _, err := f.NewSheet(transactions); err != nil {
+		return err
+	}
+	dateFormat := "yyyy-mm-dd"
+	dateStyle, err := f.NewStyle(&excelize.Style{CustomNumFmt: &dateFormat})
+	if err != nil {
+		return err
+	}
+	amountStyle, err := f.NewStyle(&excelize.Style{NumFmt: 4})
+	if err != nil {
+		return err
+	}
+
+	if err := setRow(f, summary, 1, summaryHeader); err != nil {
+		return err
+	}
+	row := 2
+	for _, line := range e.Lines {
+		if err := setRow(f, summary, row, []any{line.TaxCategory, line.Category, line.Transactions, line.Total}); err != nil {
+			return err
+		}
+		row++
+	}
+	if err := setRow(f, summary, row, []any{totalLabel, "", len(e.Items), e.Total}); err != nil {
+		return err
+	}
+	if err := f.SetCellStyle(summary, "D2", cell("D", row), amountStyle); err != nil {
+		return err
+	}
+
+	if err := setRow(f, transactions, 1, transactionHeader); err != nil {
+		return err
+	}
+	for i, item := range e.Items {
+		tx := &item.Transaction
+		date := tx.Date.UTC().Truncate(24 * time.Hour)
+		values := []any{item.TaxCategory, item.MappedCategory, date, tx.Description, tx.Category, tx.Amount, tx.Currency, tx.ID, tx.StatementID}
+		if err := setRow(f, transactions, i+2, values); err != nil {
+			return err
+		}
+	}
+	if last := len(e.Items) + 1; last > 1 {
+		if err := f.SetCellStyle(transactions, "C2", cell("C", last), dateStyle); err != nil {
+			return err
+		}
+		if err := f.SetCellStyle(transactions, "F2", cell("F", last), amountStyle); err != nil {
+			return err
+		}
+	}
+	return f.Write(w)
+}
+
+func setRow[T any](f *excelize.File, sheet string, row int, values []T) error {
+	cells := make([]any, len(values))
+	for i, v := range values {
+		cells[i] = v
+	}
+	return f.SetSheetRow(sheet, cell("A", row), &cells)
+}
+
+func cell(column string, row int) string {
+	return column + strconv.Itoa(row)
+}
@@ -0,0 +1,148 @@
+package tax
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/categories"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/jsonbody"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+type Handler struct {
+	Repo       statements.StatementRepository
+	Store      Store
+	Categories categories.Store
+}
+
+// MappingsHandler serves GET /api/tax/mappings.
+func (h *Handler) MappingsHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Store.List(r.Context())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list tax mappings", "error", err)
+		apierror.Reply(w, "Failed to list tax mappings", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// SaveMappingHandler serves PUT /api/tax/mappings/{category} with
+// {"tax_category": ..., "deductible": ..., "note": ...}.
+func (h *Handler) SaveMappingHandler(w http.ResponseWriter, r *http.Request) {
+	var mapping Mapping
+	if err := jsonbody.Decode(w, r, &mapping); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	mapping.Category = r.PathValue("category")
+	if err := mapping.Normalize(); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	mapping.UpdatedAt = time.Now().UTC()
+	if err := h.Store.Save(r.Context(), &mapping); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to save the tax mapping", "category", mapping.Category, "error", err)
+		apierror.Reply(w, "Failed to save the tax mapping", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, mapping)
+}
+
+// DeleteMappingHandler serves DELETE /api/tax/mappings/{category}.
+func (h *Handler) DeleteMappingHandler(w http.ResponseWriter, r *http.Request) {
+	category := r.PathValue("category")
+	err := h.Store.Delete(r.Context(), category)
+	if errors.Is(err, ErrNotFound) {
+		apierror.Write(w, err)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to delete the tax mapping", "category", category, "error", err)
+		apierror.Reply(w, "Failed to delete the tax mapping", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExportHandler serves GET /api/reports/tax?year=2024, the deductible spend of
+// the year along the current mappings and taxonomy. format=xlsx returns a
+// workbook with the totals and the transactions; the default CSV holds the
+// totals, or the transactions with sheet=transactions.
+func (h *Handler) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	year, err := strconv.Atoi(query.Get("year"))
+	if err != nil || year < 1900 || year > 9999 {
+		apierror.Reply(w, "Invalid year parameter", http.StatusBadRequest)
+		return
+	}
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "xlsx" {
+		apierror.Reply(w, "Invalid format parameter, expected csv or xlsx", http.StatusBadRequest)
+		return
+	}
+	sheet := query.Get("sheet")
+	if sheet == "" {
+		sheet = "summary"
+	}
+	if sheet != "summary" && sheet != "transactions" {
+		apierror.Reply(w, "Invalid sheet parameter, expected summary or transactions", http.StatusBadRequest)
+		return
+	}
+
+	mappings, err := h.Store.List(r.Context())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list tax mappings", "error", err)
+		apierror.Reply(w, "Failed to list tax mappings", http.StatusInternalServerError)
+		return
+	}
+	taxonomy := &categories.Taxonomy{}
+	if h.Categories != nil {
+		if taxonomy, err = categories.Resolve(r.Context(), h.Categories, ""); err != nil {
+			accesslog.Logger(r.Context()).Error("Failed to read the category taxonomy", "error", err)
+			apierror.Reply(w, "Failed to read the category taxonomy", http.StatusInternalServerError)
+			return
+		}
+	}
+	export, err := Build(r.Context(), h.Repo, mappings, taxonomy, year)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to build the tax export", "year", year, "error", err)
+		apierror.Reply(w, "Failed to build the tax export", http.StatusInternalServerError)
+		return
+	}
+
+	if format == "xlsx" {
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("finchie_tax_%d.xlsx", year)))
+		if err := export.WriteXLSX(w); err != nil {
+			accesslog.Logger(r.Context()).Error("Failed to write the tax workbook", "year", year, "error", err)
+		}
+		return
+	}
+	write := export.WriteSummaryCSV
+	if sheet == "transactions" {
+		write = export.WriteTransactionsCSV
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("finchie_tax_%d_%s.csv", year, sheet)))
+	if err := write(w); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to write the tax CSV", "year", year, "error", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
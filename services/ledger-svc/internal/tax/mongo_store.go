@@ -0,0 +1,50 @@
+package tax
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps the mappings in the <namespace>tax_mappings collection,
+// keyed by the category.
+type MongoStore struct {
+	col *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database, namespace string) *MongoStore {
+	return &MongoStore{col: db.Collection(namespace + "tax_mappings")}
+}
+
+func (s *MongoStore) List(ctx context.Context) ([]Mapping, error) {
+	cursor, err := s.col.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	list := []Mapping{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	sortMappings(list)
+	return list, nil
+}
+
+func (s *MongoStore) Save(ctx context.Context, mapping *Mapping) error {
+	_, err := s.col.ReplaceOne(ctx, bson.M{"_id": mapping.Category}, mapping, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoStore) Delete(ctx context.Context, category string) error {
+	result, err := s.col.DeleteOne(ctx, bson.M{"_id": category})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+// Package tax exports the deductible spend of a tax year. Finchie categories
+// are mapped to the categories of the tax return; a mapping on a category
+// covers its subcategories unless they are mapped themselves.
+package tax
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+var (
+	ErrNotFound       = apierror.New(apierror.KindNotFound, "tax_mapping_not_found", "tax mapping not found")
+	ErrNoTaxCategory  = apierror.New(apierror.KindInvalid, "invalid_tax_mapping", "tax_category is required")
+	ErrNoCategoryName = apierror.New(apierror.KindInvalid, "invalid_tax_mapping", "category is required")
+)
+
+// Mapping maps a Finchie category to a tax category. Only the deductible
+// mappings are exported; a non-deductible one keeps a subcategory out of the
+// deductible mapping of its parent.
+type Mapping struct {
+	Category    string    `bson:"_id" json:"category"`
+	TaxCategory string    `bson:"tax_category" json:"tax_category"`
+	Deductible  bool      `bson:"deductible" json:"deductible"`
+	Note        string    `bson:"note,omitempty" json:"note,omitempty"`
+	UpdatedAt   time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+func (m *Mapping) Normalize() error {
+	m.Category = strings.TrimSpace(m.Category)
+	m.TaxCategory = strings.TrimSpace(m.TaxCategory)
+	if m.Category == "" {
+		return ErrNoCategoryName
+	}
+	if m.TaxCategory == "" && m.Deductible {
+		return ErrNoTaxCategory
+	}
+	return nil
+}
+
+// Store keeps the mappings, one per category.
+type Store interface {
+	List(ctx context.Context) ([]Mapping, error)
+	// Save creates or replaces the mapping of the category.
+	Save(ctx context.Context, mapping *Mapping) error
+	// Delete returns ErrNotFound when the category has no mapping.
+	Delete(ctx context.Context, category string) error
+}
+
+// NewStore keeps the mappings next to the statements in MongoDB, or in memory
+// for the memory driver.
+func NewStore(repo statements.StatementRepository) Store {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryStore()
+}
+
+type MemoryStore struct {
+	mu       sync.RWMutex
+	mappings map[string]Mapping
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{mappings: make(map[string]Mapping)}
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Mapping, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Mapping, 0, len(s.mappings))
+	for _, m := range s.mappings {
+		list = append(list, m)
+	}
+	sortMappings(list)
+	return list, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, mapping *Mapping) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mappings[mapping.Category] = *mapping
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, category string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.mappings[category]; !ok {
+		return ErrNotFound
+	}
+	delete(s.mappings, category)
+	return nil
+}
+
+func sortMappings(list []Mapping) {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Category < list[j].Category
+	})
+}
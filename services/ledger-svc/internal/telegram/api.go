@@ -0,0 +1,113 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// pollTimeout is how long getUpdates waits for an update before answering
+// with none.
+const pollTimeout = 30 * time.Second
+
+// maxText is the longest text sendMessage accepts.
+const maxText = 4096
+
+// Update is what getUpdates returns, only the messages are asked for.
+type Update struct {
+	ID      int64    `json:"update_id"`
+	Message *Message `json:"message"`
+}
+
+type Message struct {
+	ID   int64  `json:"message_id"`
+	Date int64  `json:"date"`
+	Text string `json:"text"`
+	Chat struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	From *struct {
+		Username string `json:"username"`
+	} `json:"from"`
+}
+
+// API calls the Bot API with the token.
+type API struct {
+	Token   string
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewAPI(token string) *API {
+	return &API{
+		Token:   token,
+		BaseURL: "https://api.telegram.org",
+		// long enough for a long poll
+		Client: &http.Client{Timeout: pollTimeout + 10*time.Second},
+	}
+}
+
+// Updates waits for the updates after offset, the ID of the last one handled
+// plus one, which confirms the ones before.
+func (a *API) Updates(ctx context.Context, offset int64) ([]Update, error) {
+	var updates []Update
+	err := a.call(ctx, "getUpdates", map[string]any{
+		"offset":          offset,
+		"timeout":         int(pollTimeout.Seconds()),
+		"allowed_updates": []string{"message"},
+	}, &updates)
+	return updates, err
+}
+
+// Send posts the text to the chat, cut to the longest text Telegram takes.
+func (a *API) Send(ctx context.Context, chatID int64, text string) error {
+	if runes := []rune(text); len(runes) > maxText {
+		text = string(runes[:maxText-1]) + "…"
+	}
+	return a.call(ctx, "sendMessage", map[string]any{"chat_id": chatID, "text": text}, nil)
+}
+
+func (a *API) call(ctx context.Context, method string, params map[string]any, result any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/bot%s/%s", a.BaseURL, a.Token, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		// the URL holds the bot token, keep it out of the logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("telegram %s returned %s", method, resp.Status)
+	}
+	if !envelope.OK {
+		return fmt.Errorf("telegram %s: %s", method, envelope.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Result, result)
+}
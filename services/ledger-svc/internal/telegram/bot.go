@@ -0,0 +1,214 @@
+// Package telegram is a Telegram bot over the ledger: the chats it knows can
+// ask for the spend of the month and the statements due, and record an
+// expense by sending it, e.g. "coffee 120".
+//
+// The bot long polls getUpdates, so it needs no public URL; Telegram allows a
+// single poller per bot. Updates are confirmed after they were handled and
+// recorded expenses are keyed by the message, so an update handled again
+// after a restart records nothing twice.
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/authn"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Bot answers the messages of the chats it knows and ignores the others.
+type Bot struct {
+	API     *API
+	Service *statements.StatementService
+	// Chats maps the chat IDs allowed to the actor their expenses are paid
+	// by, as the X-Actor identity names the users; empty for a shared chat.
+	Chats map[int64]string
+	// SourceName is the source of the monthly statements the expenses are
+	// recorded in, Currency their currency.
+	SourceName string
+	Currency   string
+	// ScopeUsers records and answers for the actor of the chat as the user,
+	// as the API does for the user of a token when it authenticates.
+	ScopeUsers bool
+	// Tenant is the family the chats are of when tokens carry tenants.
+	Tenant string
+	Now    func() time.Time
+
+	// mu serializes the recording, the month's statement is read and saved
+	// whole.
+	mu sync.Mutex
+}
+
+// NewBotFromEnv returns nil when TELEGRAM_BOT_TOKEN is unset. TELEGRAM_CHATS
+// lists the chats allowed as id[:actor], comma separated, and defaults to the
+// TELEGRAM_CHAT_ID reminders are sent to. Expenses are recorded as
+// TELEGRAM_SOURCE_NAME, "telegram" by default, in TELEGRAM_CURRENCY, TWD by
+// default. When the API authenticates, every chat needs the user it is of,
+// and the chats are of the tenant TELEGRAM_TENANT_ID.
+func NewBotFromEnv(service *statements.StatementService) (*Bot, error) {
+	token := os.Getenv("TELEGRAM_BOT_TOKEN")
+	if token == "" {
+		return nil, nil
+	}
+	raw := os.Getenv("TELEGRAM_CHATS")
+	if raw == "" {
+		raw = os.Getenv("TELEGRAM_CHAT_ID")
+	}
+	chats, err := ParseChats(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(chats) == 0 {
+		return nil, fmt.Errorf("no chats allowed, set TELEGRAM_CHATS")
+	}
+	scopeUsers := authn.Enabled()
+	for id, actor := range chats {
+		if scopeUsers && actor == "" {
+			return nil, fmt.Errorf("chat %d has no user, TELEGRAM_CHATS needs id:user for every chat when authentication is on", id)
+		}
+	}
+	return &Bot{
+		API:        NewAPI(token),
+		Service:    service,
+		Chats:      chats,
+		SourceName: envOr("TELEGRAM_SOURCE_NAME", "telegram"),
+		Currency:   strings.ToUpper(envOr("TELEGRAM_CURRENCY", "TWD")),
+		ScopeUsers: scopeUsers,
+		Tenant:     os.Getenv("TELEGRAM_TENANT_ID"),
+		Now:        time.Now,
+	}, nil
+}
+
+// ParseChats reads "12345:alice,-67890", chat IDs with the optional actor.
+func ParseChats(raw string) (map[int64]string, error) {
+	chats := map[int64]string{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, actor, _ := strings.Cut(entry, ":")
+		chatID, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chat %q, expected id[:actor]", entry)
+		}
+		chats[chatID] = strings.TrimSpace(actor)
+	}
+	return chats, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// Run polls and answers until the context is done.
+func (b *Bot) Run(ctx context.Context) {
+	var offset int64
+	for ctx.Err() == nil {
+		updates, err := b.API.Updates(ctx, offset)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("Failed to poll Telegram", "error", err)
+			sleep(ctx, 5*time.Second)
+			continue
+		}
+		for _, u := range updates {
+			if u.Message != nil {
+				b.Handle(ctx, u.Message)
+			}
+			offset = u.ID + 1
+		}
+	}
+}
+
+// Handle answers the message when its chat is allowed.
+func (b *Bot) Handle(ctx context.Context, msg *Message) {
+	actor, ok := b.Chats[msg.Chat.ID]
+	if !ok {
+		// the ID is logged so it can be allowed
+		slog.Warn("Ignored a message from an unknown Telegram chat", "chat_id", msg.Chat.ID)
+		return
+	}
+	if b.ScopeUsers {
+		ctx = statements.WithTenant(statements.WithUser(ctx, actor), b.Tenant)
+	}
+	reply := b.answer(ctx, msg, actor)
+	if reply == "" {
+		return
+	}
+	if err := b.API.Send(ctx, msg.Chat.ID, reply); err != nil {
+		slog.Warn("Failed to answer on Telegram", "chat_id", msg.Chat.ID, "error", err)
+	}
+}
+
+func (b *Bot) answer(ctx context.Context, msg *Message, actor string) string {
+	text := strings.TrimSpace(msg.Text)
+	if text == "" {
+		return ""
+	}
+	now := b.Now().UTC()
+	command, args := parseCommand(text)
+	switch command {
+	case "start", "help":
+		return helpText
+	case "spend":
+		return b.spend(ctx, now, args)
+	case "due":
+		return b.due(ctx, now)
+	}
+
+	expense, ok := parseExpense(text)
+	if !ok {
+		return "Sorry, I did not get that.\n\n" + helpText
+	}
+	date := time.Unix(msg.Date, 0).UTC()
+	if msg.Date == 0 {
+		date = now
+	}
+	return b.capture(ctx, msg, actor, expense, date)
+}
+
+const helpText = `Send an expense to record it, e.g. "coffee 120" or "lunch 250 #food".
+
+/spend - the spend this month, /spend last for last month
+/due - the statements due
+`
+
+// parseCommand reads "/spend last", "/spend@finchie_bot" and the questions
+// "spend this month?" and "what's due?", returning the command and the rest.
+func parseCommand(text string) (string, string) {
+	lower := strings.ToLower(strings.TrimRight(text, "?？ "))
+	if rest, ok := strings.CutPrefix(lower, "/"); ok {
+		command, args, _ := strings.Cut(rest, " ")
+		command, _, _ = strings.Cut(command, "@")
+		return command, strings.TrimSpace(args)
+	}
+	words := strings.Fields(lower)
+	switch {
+	case len(words) > 0 && words[0] == "spend" && !hasAmount(words):
+		return "spend", strings.Join(words[1:], " ")
+	case lower == "due" || lower == "what's due" || lower == "whats due" || lower == "what is due":
+		return "due", ""
+	}
+	return "", ""
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,211 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/analytics"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/importers"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const (
+	// spendTop is how many categories the spend lists.
+	spendTop = 5
+	// dueDays is how far ahead the statements due are listed, the overdue
+	// ones always are.
+	dueDays = 30
+)
+
+// spend answers with the spend of this month, or of last month when asked
+// for "last", by category.
+func (b *Bot) spend(ctx context.Context, now time.Time, args string) string {
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if strings.HasPrefix(args, "last") {
+		from = from.AddDate(0, -1, 0)
+	}
+	spend, err := analytics.SpendBy(ctx, b.Service.Repo, analytics.ByCategory, "", from, from.AddDate(0, 1, 0))
+	if err != nil {
+		slog.Error("Failed to compute the spend for Telegram", "error", err)
+		return "Sorry, the spend could not be computed, try again later."
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "Spend in %s: %s", from.Format("January 2006"), money.Format(spend.Total, b.Currency, money.Dot))
+	if spend.DeltaPct != nil {
+		fmt.Fprintf(&out, " (%+.0f%% on %s)", *spend.DeltaPct, from.AddDate(0, -1, 0).Format("January"))
+	}
+	out.WriteString("\n")
+	for i, g := range spend.Groups {
+		if i == spendTop {
+			fmt.Fprintf(&out, "and %d more\n", len(spend.Groups)-spendTop)
+			break
+		}
+		fmt.Fprintf(&out, "%s: %s\n", g.Key, money.Format(g.Total, b.Currency, money.Dot))
+	}
+	return out.String()
+}
+
+// due answers with the statements to pay by hand in the next dueDays, and the
+// overdue ones.
+func (b *Bot) due(ctx context.Context, now time.Time) string {
+	list, err := b.Service.Repo.ListStatements(ctx, statements.StatementFilter{})
+	if err != nil {
+		slog.Error("Failed to list the statements due for Telegram", "error", err)
+		return "Sorry, the statements could not be read, try again later."
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	until := today.AddDate(0, 0, dueDays)
+	var due []*statements.Statement
+	for i := range list {
+		stmt := &list[i]
+		if stmt.PaymentDueDate == nil || !stmt.PaymentDueDate.Before(until) || !stmt.NeedsManualPayment() {
+			continue
+		}
+		due = append(due, stmt)
+	}
+	if len(due) == 0 {
+		return fmt.Sprintf("Nothing due in the next %d days.", dueDays)
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].PaymentDueDate.Before(*due[j].PaymentDueDate) })
+
+	var out strings.Builder
+	for _, stmt := range due {
+		fmt.Fprintf(&out, "%s %s: %s", stmt.PaymentDueDate.Format("2006-01-02"), stmt.SourceName,
+			money.Format(stmt.AmountToPay(), stmt.Currency, money.Dot))
+		if stmt.PaymentDueDate.Before(today) {
+			out.WriteString(" (overdue)")
+		}
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+type expense struct {
+	Description string
+	Category    string
+	Amount      float64
+}
+
+// parseExpense reads "coffee 120", "120 coffee" or "lunch 250 #food": the
+// amount is the first or the last word, a #word is the category.
+func parseExpense(text string) (expense, bool) {
+	var e expense
+	var words []string
+	for _, w := range strings.Fields(text) {
+		if tag, ok := strings.CutPrefix(w, "#"); ok && tag != "" {
+			e.Category = tag
+			continue
+		}
+		words = append(words, w)
+	}
+	if len(words) < 2 {
+		return e, false
+	}
+	switch {
+	case isAmount(words[len(words)-1]):
+		e.Amount, _ = money.Parse(words[len(words)-1])
+		words = words[:len(words)-1]
+	case isAmount(words[0]):
+		e.Amount, _ = money.Parse(words[0])
+		words = words[1:]
+	default:
+		return e, false
+	}
+	e.Amount = importers.RoundCents(e.Amount)
+	e.Description = strings.Join(words, " ")
+	return e, e.Amount != 0
+}
+
+// isAmount tells amounts from words money.Parse reads too, like 一.
+func isAmount(word string) bool {
+	if !strings.ContainsAny(word, "0123456789０１２３４５６７８９") {
+		return false
+	}
+	_, err := money.Parse(word)
+	return err == nil
+}
+
+func hasAmount(words []string) bool {
+	for _, w := range words {
+		if isAmount(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// capture records the expense in the month's statement of the bot's source,
+// a bank account statement listing the expenses as positive amounts. The
+// transaction ID is of the chat and the message.
+func (b *Bot) capture(ctx context.Context, msg *Message, actor string, e expense, date time.Time) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	start := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	sourceID := start.Format("200601")
+	id := statements.OwnedID(statements.OwnerFrom(ctx), b.SourceName+"_"+sourceID)
+	stored, err := b.Service.Repo.GetTransactions(ctx, id)
+	if err != nil {
+		slog.Error("Failed to read the Telegram statement", "id", id, "error", err)
+		return "Sorry, the expense could not be recorded, try again later."
+	}
+
+	ref := strconv.FormatInt(msg.Chat.ID, 10) + ":" + strconv.FormatInt(msg.ID, 10)
+	tx := statements.Transaction{
+		ID:           importers.StableID("telegram", ref),
+		Description:  e.Description,
+		Category:     e.Category,
+		Currency:     b.Currency,
+		Amount:       e.Amount,
+		Date:         date,
+		PaidBy:       actor,
+		ExternalRefs: []statements.ExternalRef{{Type: "telegram", Value: ref}},
+	}
+	txs := []statements.Transaction{tx}
+	total := tx.Amount
+	for _, t := range stored {
+		if t.ID != tx.ID {
+			txs = append(txs, t)
+			total += t.Amount
+		}
+	}
+	sort.Slice(txs, func(i, j int) bool {
+		if !txs[i].Date.Equal(txs[j].Date) {
+			return txs[i].Date.Before(txs[j].Date)
+		}
+		return txs[i].ID < txs[j].ID
+	})
+
+	stmt := &statements.Statement{
+		ID:           id,
+		Type:         statements.BankStatement,
+		SourceType:   statements.BankAccount,
+		SourceName:   b.SourceName,
+		SourceID:     &sourceID,
+		Currency:     b.Currency,
+		TotalAmount:  importers.RoundCents(total),
+		Transactions: &txs,
+	}
+	err = b.Service.SaveStatementWithTransactions(ctx, stmt)
+	switch {
+	case errors.Is(err, statements.ErrQueued):
+		slog.Info("Telegram expense queued for replay", "id", tx.ID)
+	case err != nil:
+		slog.Error("Failed to record the Telegram expense", "id", tx.ID, "error", err)
+		return "Sorry, the expense could not be recorded, try again later."
+	}
+
+	reply := fmt.Sprintf("Recorded %s %s on %s", e.Description, money.Format(e.Amount, b.Currency, money.Dot), date.Format("2006-01-02"))
+	if e.Category != "" {
+		reply += " in " + e.Category
+	}
+	return reply + "."
+}
@@ -0,0 +1,125 @@
+package trends
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/categories"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const monthLayout = "2006-01"
+
+type Handler struct {
+	Store      Store
+	Categories categories.Store
+}
+
+// TrendsHandler serves GET /api/trends: monthly points with from/to as
+// YYYY-MM, or daily points (granularity=day) with from/to as YYYY-MM-DD, both
+// bounds inclusive, optionally filtered by source_name, spend_type and
+// category. A category includes its subcategories, and depth=N rolls the
+// points up to the categories N levels below the top, along the latest
+// taxonomy or the one of taxonomy_version.
+func (h *Handler) TrendsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := Query{
+		Granularity: Granularity(query.Get("granularity")),
+		SourceName:  query.Get("source_name"),
+	}
+	spendType, err := statements.ParseSpendType(query.Get("spend_type"))
+	if err != nil {
+		apierror.Reply(w, "Invalid spend_type parameter, expected merchant, fee, interest, transfer or refund", http.StatusBadRequest)
+		return
+	}
+	q.SpendType = spendType
+
+	layout, step := monthLayout, func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	switch q.Granularity {
+	case "", Monthly:
+		q.Granularity = Monthly
+	case Daily:
+		layout, step = time.DateOnly, func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	default:
+		apierror.Reply(w, "Invalid granularity parameter, expected month or day", http.StatusBadRequest)
+		return
+	}
+
+	from, err := time.Parse(layout, query.Get("from"))
+	if err != nil {
+		apierror.Reply(w, fmt.Sprintf("Invalid from parameter, expected %s", layout), http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse(layout, query.Get("to"))
+	if err != nil || to.Before(from) {
+		apierror.Reply(w, fmt.Sprintf("Invalid to parameter, expected %s not before from", layout), http.StatusBadRequest)
+		return
+	}
+	q.From, q.To = from, step(to)
+
+	depth := 0
+	if v := query.Get("depth"); v != "" {
+		if depth, err = strconv.Atoi(v); err != nil || depth < 0 {
+			apierror.Reply(w, "Invalid depth parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	taxonomy := &categories.Taxonomy{}
+	if h.Categories != nil {
+		taxonomy, err = categories.Resolve(r.Context(), h.Categories, query.Get("taxonomy_version"))
+		if errors.Is(err, categories.ErrUnknownVersion) {
+			apierror.Reply(w, "Invalid taxonomy_version parameter", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			accesslog.Logger(r.Context()).Error("Failed to read the category taxonomy", "error", err)
+			apierror.Reply(w, "Failed to read the category taxonomy", http.StatusInternalServerError)
+			return
+		}
+	}
+	if category := query.Get("category"); category != "" {
+		q.Categories = taxonomy.Descendants(category)
+	}
+
+	points, err := h.Store.Points(r.Context(), q)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to read trend metrics", "query", q, "error", err)
+		apierror.Reply(w, "Failed to read trend metrics", http.StatusInternalServerError)
+		return
+	}
+	if depth > 0 {
+		points = rollUp(points, taxonomy, depth)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(points); err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to encode JSON response", "error", err)
+		apierror.Reply(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// rollUp merges the points of the categories below depth into their ancestor,
+// keeping the order of the points.
+func rollUp(points []Point, taxonomy *categories.Taxonomy, depth int) []Point {
+	merged := make([]Point, 0, len(points))
+	index := map[string]int{}
+	for _, p := range points {
+		p.Category = taxonomy.RollUp(p.Category, depth)
+		p.ID = pointID(p.Granularity, p.Period, p.SourceName, p.SpendType, p.Category)
+		if i, ok := index[p.ID]; ok {
+			merged[i].Amount += p.Amount
+			merged[i].Count += p.Count
+			continue
+		}
+		index[p.ID] = len(merged)
+		merged = append(merged, p)
+	}
+	return merged
+}
@@ -0,0 +1,74 @@
+package trends
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps the points in the <namespace>metrics collection.
+type MongoStore struct {
+	col *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database, namespace string) *MongoStore {
+	return &MongoStore{col: db.Collection(namespace + "metrics")}
+}
+
+// Replace deletes before inserting; a reader in between sees the range empty
+// for a moment, which the trend charts tolerate.
+func (s *MongoStore) Replace(ctx context.Context, g Granularity, from, to time.Time, points []Point) error {
+	_, err := s.col.DeleteMany(ctx, bson.M{
+		"granularity": g,
+		"period":      bson.M{"$gte": from, "$lt": to},
+	})
+	if err != nil || len(points) == 0 {
+		return err
+	}
+
+	models := make([]mongo.WriteModel, len(points))
+	for i := range points {
+		models[i] = mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": points[i].ID}).
+			SetReplacement(points[i]).
+			SetUpsert(true)
+	}
+	_, err = s.col.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (s *MongoStore) Points(ctx context.Context, q Query) ([]Point, error) {
+	filter := bson.M{
+		"granularity": q.Granularity,
+		"period":      bson.M{"$gte": q.From, "$lt": q.To},
+	}
+	if q.SourceName != "" {
+		filter["source_name"] = q.SourceName
+	}
+	if q.SpendType != "" {
+		filter["spend_type"] = q.SpendType
+	}
+	if len(q.Categories) > 0 {
+		filter["category"] = bson.M{"$in": q.Categories}
+	}
+
+	cursor, err := s.col.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "period", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	points := []Point{}
+	if err := cursor.All(ctx, &points); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+func (s *MongoStore) Prune(ctx context.Context, g Granularity, before time.Time) error {
+	_, err := s.col.DeleteMany(ctx, bson.M{"granularity": g, "period": bson.M{"$lt": before}})
+	return err
+}
@@ -0,0 +1,195 @@
+package trends
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const (
+	uncategorizedLabel = "Uncategorized"
+	projectPageSize    = 1000
+	// rebuildHorizon bounds a rebuild, far enough for post-dated transactions.
+	rebuildHorizon = 10 * 365 * 24 * time.Hour
+)
+
+// Projector maintains the downsampled points from the change events: a
+// statement event recomputes the months its transactions fall into. Monthly
+// points are kept forever, daily points for DailyRetention. A periodic rebuild
+// catches what the events cannot tell, e.g. the month of a deleted transaction.
+type Projector struct {
+	Repo           statements.StatementRepository
+	Store          Store
+	DailyRetention time.Duration
+
+	mu sync.Mutex
+}
+
+// NewProjectorFromEnv stores the points next to the statements in MongoDB, or
+// in memory for the memory driver. TRENDS_DAILY_RETENTION_DAYS defaults to two
+// years.
+func NewProjectorFromEnv(repo statements.StatementRepository) *Projector {
+	var store Store = NewMemoryStore()
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		store = NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+
+	days, err := strconv.Atoi(os.Getenv("TRENDS_DAILY_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		days = 730
+	}
+	return &Projector{Repo: repo, Store: store, DailyRetention: time.Duration(days) * 24 * time.Hour}
+}
+
+// Run rebuilds all points now and then every interval.
+func (p *Projector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Rebuild(ctx, time.Now().UTC()); err != nil {
+			slog.Warn("Failed to rebuild trend metrics", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Publish makes the projector an events sink.
+func (p *Projector) Publish(ctx context.Context, event statements.ChangeEvent) error {
+	switch event.Type {
+	case statements.EventStatementCreated, statements.EventStatementUpdated, statements.EventStatementPaid:
+	default:
+		return nil
+	}
+
+	txs, err := p.Repo.GetTransactions(ctx, event.StatementID)
+	if err != nil || len(txs) == 0 {
+		return err
+	}
+	from, to := txs[0].Date, txs[0].Date
+	for i := range txs {
+		from = minTime(from, txs[i].Date)
+		to = maxTime(to, txs[i].Date)
+	}
+	return p.Recompute(ctx, monthOf(from), monthOf(to).AddDate(0, 1, 0), time.Now().UTC())
+}
+
+// Rebuild recomputes every point and prunes the expired daily points.
+func (p *Projector) Rebuild(ctx context.Context, now time.Time) error {
+	if err := p.Recompute(ctx, time.Time{}, monthOf(now.Add(rebuildHorizon)), now); err != nil {
+		return err
+	}
+	return p.Store.Prune(ctx, Daily, p.dailyCutoff(now))
+}
+
+// Recompute aggregates the transactions dated in [from, to), which must be
+// month boundaries, and replaces the points of that range.
+func (p *Projector) Recompute(ctx context.Context, from, to, now time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sources, err := p.statementSources(ctx)
+	if err != nil {
+		return err
+	}
+
+	cutoff := p.dailyCutoff(now)
+	monthly := map[string]*Point{}
+	daily := map[string]*Point{}
+	filter := statements.TransactionFilter{From: from, To: to}
+	for after := ""; ; {
+		page, err := p.Repo.ListTransactions(ctx, filter, statements.Page{Limit: projectPageSize, After: after})
+		if err != nil {
+			return err
+		}
+		for i := range page {
+			tx := &page[i]
+			source := sources[tx.StatementID]
+			add(monthly, Monthly, monthOf(tx.Date), source, tx)
+			if !tx.Date.Before(cutoff) {
+				add(daily, Daily, dayOf(tx.Date), source, tx)
+			}
+		}
+		if len(page) < projectPageSize {
+			break
+		}
+		after = page[len(page)-1].ID
+	}
+
+	if err := p.Store.Replace(ctx, Monthly, from, to, values(monthly)); err != nil {
+		return err
+	}
+	return p.Store.Replace(ctx, Daily, maxTime(from, cutoff), to, values(daily))
+}
+
+func (p *Projector) dailyCutoff(now time.Time) time.Time {
+	return dayOf(now.Add(-p.DailyRetention))
+}
+
+func (p *Projector) statementSources(ctx context.Context) (map[string]string, error) {
+	stmts, err := p.Repo.ListStatements(ctx, statements.StatementFilter{})
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string]string, len(stmts))
+	for i := range stmts {
+		sources[stmts[i].ID] = stmts[i].SourceName
+	}
+	return sources, nil
+}
+
+func add(points map[string]*Point, g Granularity, period time.Time, source string, tx *statements.Transaction) {
+	category := tx.Category
+	if category == "" {
+		category = uncategorizedLabel
+	}
+	spendType := statements.ClassifySpend(tx)
+	id := pointID(g, period, source, spendType, category)
+	point, ok := points[id]
+	if !ok {
+		point = &Point{ID: id, Granularity: g, Period: period, SourceName: source, SpendType: spendType, Category: category}
+		points[id] = point
+	}
+	point.Amount += tx.Amount
+	point.Count++
+}
+
+func values(points map[string]*Point) []Point {
+	result := make([]Point, 0, len(points))
+	for _, p := range points {
+		result = append(result, *p)
+	}
+	return result
+}
+
+func monthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func dayOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
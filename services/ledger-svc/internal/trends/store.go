@@ -0,0 +1,122 @@
+package trends
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+type Granularity string
+
+const (
+	Daily   Granularity = "day"
+	Monthly Granularity = "month"
+)
+
+// Point is the total of one source, spend type and category over a day or a
+// month.
+type Point struct {
+	ID          string               `bson:"_id" json:"-"`
+	Granularity Granularity          `bson:"granularity" json:"granularity"`
+	Period      time.Time            `bson:"period" json:"period"`
+	SourceName  string               `bson:"source_name" json:"source_name"`
+	SpendType   statements.SpendType `bson:"spend_type" json:"spend_type"`
+	Category    string               `bson:"category" json:"category"`
+	Amount      float64              `bson:"amount" json:"amount"`
+	Count       int                  `bson:"count" json:"count"`
+}
+
+func pointID(g Granularity, period time.Time, sourceName string, spendType statements.SpendType, category string) string {
+	return fmt.Sprintf("%s|%s|%s|%s|%s", g, period.Format(time.DateOnly), sourceName, spendType, category)
+}
+
+type Query struct {
+	Granularity Granularity
+	// From is inclusive, To exclusive.
+	From       time.Time
+	To         time.Time
+	SourceName string
+	SpendType  statements.SpendType
+	// Categories matches any of the categories, all when empty.
+	Categories []string
+}
+
+func (q Query) match(p *Point) bool {
+	return p.Granularity == q.Granularity &&
+		!p.Period.Before(q.From) && p.Period.Before(q.To) &&
+		(q.SourceName == "" || p.SourceName == q.SourceName) &&
+		(q.SpendType == "" || p.SpendType == q.SpendType) &&
+		(len(q.Categories) == 0 || slices.Contains(q.Categories, p.Category))
+}
+
+// Store keeps the downsampled points.
+type Store interface {
+	// Replace swaps the points of granularity g with periods in [from, to)
+	// for points, so a recomputed range also drops emptied buckets.
+	Replace(ctx context.Context, g Granularity, from, to time.Time, points []Point) error
+	// Points returns the points matching q, oldest period first.
+	Points(ctx context.Context, q Query) ([]Point, error)
+	// Prune deletes the points of granularity g older than before.
+	Prune(ctx context.Context, g Granularity, before time.Time) error
+}
+
+type MemoryStore struct {
+	mu     sync.RWMutex
+	points map[string]Point
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{points: make(map[string]Point)}
+}
+
+func (s *MemoryStore) Replace(ctx context.Context, g Granularity, from, to time.Time, points []Point) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stale := Query{Granularity: g, From: from, To: to}
+	for id, p := range s.points {
+		if stale.match(&p) {
+			delete(s.points, id)
+		}
+	}
+	for _, p := range points {
+		s.points[p.ID] = p
+	}
+	return nil
+}
+
+func (s *MemoryStore) Points(ctx context.Context, q Query) ([]Point, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []Point{}
+	for _, p := range s.points {
+		if q.match(&p) {
+			result = append(result, p)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Period.Before(result[j].Period)
+	})
+	return result, nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, g Granularity, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, p := range s.points {
+		if p.Granularity == g && p.Period.Before(before) {
+			delete(s.points, id)
+		}
+	}
+	return nil
+}
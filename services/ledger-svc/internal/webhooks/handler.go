@@ -0,0 +1,199 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/jsonbody"
+)
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+type Handler struct {
+	Hub *Hub
+}
+
+// ListHandler serves GET /api/webhooks, without the secrets.
+func (h *Handler) ListHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := h.Hub.Store.List(r.Context())
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list webhooks", "error", err)
+		apierror.Reply(w, "Failed to list webhooks", http.StatusInternalServerError)
+		return
+	}
+	for i := range list {
+		list[i].Secret = ""
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// GetHandler serves GET /api/webhooks/{id}, without the secret.
+func (h *Handler) GetHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.find(w, r)
+	if !ok {
+		return
+	}
+	sub.Secret = ""
+	writeJSON(w, http.StatusOK, sub)
+}
+
+// CreateHandler serves POST /api/webhooks with {"url": ..., "events": [...],
+// "secret": ...}. Without a secret one is generated; the response is the only
+// place it is shown.
+func (h *Handler) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	var sub Subscription
+	if err := jsonbody.Decode(w, r, &sub); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	if sub.Secret == "" {
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		sub.Secret = hex.EncodeToString(secret)
+	}
+	sub.ID = uuid.NewString()
+	sub.CreatedAt = time.Now().UTC()
+	h.save(w, r, &sub, http.StatusCreated)
+}
+
+// UpdateHandler serves PUT /api/webhooks/{id}, replacing the URL, events and
+// disabled flag; the secret is kept unless a new one is given.
+func (h *Handler) UpdateHandler(w http.ResponseWriter, r *http.Request) {
+	existing, ok := h.find(w, r)
+	if !ok {
+		return
+	}
+	var sub Subscription
+	if err := jsonbody.Decode(w, r, &sub); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	sub.ID, sub.CreatedAt = existing.ID, existing.CreatedAt
+	sub.TenantID, sub.UserID = existing.TenantID, existing.UserID
+	if sub.Secret == "" {
+		sub.Secret = existing.Secret
+	}
+	h.save(w, r, &sub, http.StatusOK)
+}
+
+func (h *Handler) save(w http.ResponseWriter, r *http.Request, sub *Subscription, status int) {
+	if err := sub.Normalize(); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	sub.UpdatedAt = time.Now().UTC()
+	if err := h.Hub.Store.Save(r.Context(), sub); err != nil {
+		slog.Error("Failed to save the webhook", "id", sub.ID, "error", err)
+		apierror.Reply(w, "Failed to save the webhook", http.StatusInternalServerError)
+		return
+	}
+	resp := *sub
+	if status != http.StatusCreated {
+		resp.Secret = ""
+	}
+	writeJSON(w, status, resp)
+}
+
+// DeleteHandler serves DELETE /api/webhooks/{id}, dropping its delivery log.
+func (h *Handler) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := h.Hub.Store.Delete(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		apierror.Write(w, err)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to delete the webhook", "id", id, "error", err)
+		apierror.Reply(w, "Failed to delete the webhook", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeliveriesHandler serves GET /api/webhooks/{id}/deliveries?limit=, the
+// latest deliveries with their attempts.
+func (h *Handler) DeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.find(w, r)
+	if !ok {
+		return
+	}
+	limit := defaultDeliveryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxDeliveryLimit {
+			apierror.Reply(w, "Invalid limit, expected 1 to 500", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	list, err := h.Hub.Store.Deliveries(r.Context(), sub.ID, limit)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to list webhook deliveries", "id", sub.ID, "error", err)
+		apierror.Reply(w, "Failed to list webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// RedeliverHandler serves POST /api/webhooks/{id}/deliveries/{delivery}/redeliver,
+// attempting the delivery again right away and returning its log.
+func (h *Handler) RedeliverHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.find(w, r)
+	if !ok {
+		return
+	}
+	id := r.PathValue("delivery")
+	d, err := h.Hub.Store.Delivery(r.Context(), id)
+	if err == nil && (d == nil || d.SubscriptionID != sub.ID) {
+		err = ErrDeliveryNotFound
+	}
+	if err == nil {
+		d, err = h.Hub.Redeliver(r.Context(), id)
+	}
+	if errors.Is(err, ErrDeliveryNotFound) {
+		apierror.Write(w, err)
+		return
+	}
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to redeliver the webhook", "delivery_id", id, "error", err)
+		apierror.Reply(w, "Failed to redeliver the webhook", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+func (h *Handler) find(w http.ResponseWriter, r *http.Request) (*Subscription, bool) {
+	id := r.PathValue("id")
+	sub, err := h.Hub.Store.Get(r.Context(), id)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to read the webhook", "id", id, "error", err)
+		apierror.Reply(w, "Failed to read the webhook", http.StatusInternalServerError)
+		return nil, false
+	}
+	if sub == nil {
+		apierror.Reply(w, ErrNotFound.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return sub, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode JSON response", "error", err)
+	}
+}
@@ -0,0 +1,268 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/budgets"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const (
+	deliverBatchSize = 100
+	maxBackoff       = 6 * time.Hour
+)
+
+// Hub turns the change events into deliveries and attempts them. It is an
+// events sink: publishing only queues the deliveries, a slow subscriber never
+// holds up the outbox.
+type Hub struct {
+	Store  Store
+	Client *http.Client
+	// Budgets, when set, is checked after every change for the budgets gone
+	// over, which are sent as budget.exceeded.
+	Budgets *budgets.Tracker
+	// MaxAttempts is how often a delivery is tried before it is failed, the
+	// wait doubling from Backoff after every attempt.
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+// NewHubFromEnv reads WEBHOOKS_MAX_ATTEMPTS, 8 by default, and
+// WEBHOOKS_BACKOFF_SECONDS, the first wait, 30 by default.
+func NewHubFromEnv(repo statements.StatementRepository, tracker *budgets.Tracker) *Hub {
+	return &Hub{
+		Store:       NewStore(repo),
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		Budgets:     tracker,
+		MaxAttempts: envInt("WEBHOOKS_MAX_ATTEMPTS", 8),
+		Backoff:     time.Duration(envInt("WEBHOOKS_BACKOFF_SECONDS", 30)) * time.Second,
+	}
+}
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+// Run attempts the deliveries due every interval.
+func (h *Hub) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := h.Deliver(ctx, time.Now().UTC()); err != nil {
+				slog.Warn("Failed to deliver webhooks", "error", err)
+			}
+		}
+	}
+}
+
+// Publish queues the event for the subscriptions that want it.
+func (h *Hub) Publish(ctx context.Context, event statements.ChangeEvent) error {
+	subs, err := h.Store.List(ctx)
+	if err != nil {
+		return err
+	}
+	if err := h.enqueue(ctx, subs, event.TenantID, event.UserID, Event{ID: event.ID, Type: event.Type, OccurredAt: event.OccurredAt, Data: event}); err != nil {
+		return err
+	}
+	if h.Budgets == nil || !wantsAny(subs, EventBudgetExceeded) {
+		return nil
+	}
+	// a failed check is not worth publishing the event again, the next
+	// change checks again
+	// the budgets and the spend of the owner of the change only
+	scoped := statements.WithUser(statements.WithTenant(ctx, event.TenantID), event.UserID)
+	if err := h.checkBudgets(scoped, subs, event.OccurredAt); err != nil {
+		slog.Warn("Failed to check the budgets for webhooks", "event_id", event.ID, "error", err)
+	}
+	return nil
+}
+
+// checkBudgets sends budget.exceeded for the budgets over in the period of
+// now. The event ID names the budget and the period, so each subscription
+// gets it once per period.
+func (h *Hub) checkBudgets(ctx context.Context, subs []Subscription, now time.Time) error {
+	status, err := h.Budgets.Status(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, s := range status {
+		if !s.Over {
+			continue
+		}
+		event := Event{
+			ID:         fmt.Sprintf("%s:%s:%s", EventBudgetExceeded, s.Budget.ID, s.PeriodStart.Format("20060102")),
+			Type:       EventBudgetExceeded,
+			OccurredAt: now,
+			Data:       s,
+		}
+		if err := h.enqueue(ctx, subs, s.Budget.TenantID, s.Budget.UserID, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueue queues the event for the subscriptions that want it and see its
+// owner, see Subscription.Sees.
+func (h *Hub) enqueue(ctx context.Context, subs []Subscription, tenantID, userID string, event Event) error {
+	owner := statements.Owner(tenantID, userID)
+	var deliveries []Delivery
+	var payload []byte
+	for _, sub := range subs {
+		if !sub.Wants(event.Type) || !sub.Sees(owner) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			if payload, err = json.Marshal(event); err != nil {
+				return err
+			}
+		}
+		now := time.Now().UTC()
+		deliveries = append(deliveries, Delivery{
+			ID:             deliveryID(sub.ID, event.ID),
+			SubscriptionID: sub.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        payload,
+			Status:         DeliveryPending,
+			Attempts:       []Attempt{},
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+			TenantID:       tenantID,
+			UserID:         userID,
+		})
+	}
+	return h.Store.Enqueue(ctx, deliveries)
+}
+
+func wantsAny(subs []Subscription, eventType string) bool {
+	for i := range subs {
+		if subs[i].Wants(eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Deliver attempts the deliveries due by now. A failed attempt is logged on
+// the delivery, the others are still attempted.
+func (h *Hub) Deliver(ctx context.Context, now time.Time) error {
+	for {
+		due, err := h.Store.Due(ctx, now, deliverBatchSize)
+		if err != nil || len(due) == 0 {
+			return err
+		}
+		for i := range due {
+			if err := h.attempt(ctx, &due[i], now); err != nil {
+				return err
+			}
+		}
+		if len(due) < deliverBatchSize {
+			return nil
+		}
+	}
+}
+
+// Redeliver attempts the delivery right away with a fresh set of attempts,
+// whatever its status.
+func (h *Hub) Redeliver(ctx context.Context, id string) (*Delivery, error) {
+	d, err := h.Store.Delivery(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, ErrDeliveryNotFound
+	}
+	now := time.Now().UTC()
+	d.Status, d.Tries, d.NextAttemptAt, d.DeliveredAt = DeliveryPending, 0, now, nil
+	return d, h.attempt(ctx, d, now)
+}
+
+// attempt POSTs the delivery and records the outcome; the error is only
+// about saving it.
+func (h *Hub) attempt(ctx context.Context, d *Delivery, now time.Time) error {
+	sub, err := h.Store.Get(ctx, d.SubscriptionID)
+	if err != nil {
+		return err
+	}
+	if sub == nil || sub.Disabled {
+		d.Status = DeliveryFailed
+		d.Attempts = append(d.Attempts, Attempt{At: now, Error: "subscription removed or disabled"})
+		return h.Store.SaveDelivery(ctx, d)
+	}
+
+	start := time.Now()
+	status, postErr := h.post(ctx, sub, d)
+	a := Attempt{At: now, StatusCode: status, DurationMS: time.Since(start).Milliseconds()}
+	if postErr != nil {
+		a.Error = postErr.Error()
+	}
+	d.Attempts = append(d.Attempts, a)
+	d.Tries++
+
+	switch {
+	case postErr == nil:
+		d.Status, d.DeliveredAt = DeliveryDelivered, &now
+	case d.Tries >= h.MaxAttempts:
+		d.Status = DeliveryFailed
+		slog.Warn("Webhook delivery failed", "delivery_id", d.ID, "url", sub.URL, "attempts", d.Tries, "error", postErr)
+	default:
+		d.NextAttemptAt = now.Add(h.backoff(d.Tries))
+	}
+	return h.Store.SaveDelivery(ctx, d)
+}
+
+// backoff is the wait after the attempt-th failed attempt.
+func (h *Hub) backoff(attempt int) time.Duration {
+	wait := h.Backoff
+	for i := 1; i < attempt && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxBackoff)
+}
+
+func (h *Hub) post(ctx context.Context, sub *Subscription, d *Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Finchie-Event", d.EventType)
+	req.Header.Set("X-Finchie-Delivery", d.ID)
+	if sub.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(sub.Secret))
+		mac.Write(d.Payload)
+		req.Header.Set("X-Finchie-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
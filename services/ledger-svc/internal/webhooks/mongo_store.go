@@ -0,0 +1,175 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// MongoStore keeps the subscriptions in the <namespace>webhooks collection and
+// the deliveries in <namespace>webhook_deliveries.
+type MongoStore struct {
+	subscriptions *mongo.Collection
+	deliveries    *mongo.Collection
+}
+
+func NewMongoStore(db *mongo.Database, namespace string) *MongoStore {
+	return &MongoStore{
+		subscriptions: db.Collection(namespace + "webhooks"),
+		deliveries:    db.Collection(namespace + "webhook_deliveries"),
+	}
+}
+
+func (s *MongoStore) List(ctx context.Context) ([]Subscription, error) {
+	cursor, err := s.subscriptions.Find(ctx, statements.OwnerFilter(ctx, bson.M{}), options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	list := []Subscription{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *MongoStore) Get(ctx context.Context, id string) (*Subscription, error) {
+	var sub Subscription
+	err := s.subscriptions.FindOne(ctx, statements.OwnerFilter(ctx, bson.M{"_id": id})).Decode(&sub)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (s *MongoStore) Save(ctx context.Context, sub *Subscription) error {
+	sub.TenantID, sub.UserID = statements.Stamp(ctx, sub.TenantID, sub.UserID)
+	_, err := s.subscriptions.ReplaceOne(ctx, statements.OwnerFilter(ctx, bson.M{"_id": sub.ID}), sub, options.Replace().SetUpsert(true))
+	// the document of another owner does not match, the upsert inserts its
+	// ID a second time
+	if mongo.IsDuplicateKeyError(err) {
+		return statements.ErrNotOwned
+	}
+	return err
+}
+
+func (s *MongoStore) Delete(ctx context.Context, id string) error {
+	res, err := s.subscriptions.DeleteOne(ctx, statements.OwnerFilter(ctx, bson.M{"_id": id}))
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	_, err = s.deliveries.DeleteMany(ctx, bson.M{"subscription_id": id})
+	return err
+}
+
+// Enqueue inserts on upsert only, so a delivery already attempted is left as
+// it is.
+func (s *MongoStore) Enqueue(ctx context.Context, deliveries []Delivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, len(deliveries))
+	for i := range deliveries {
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": deliveries[i].ID}).
+			SetUpdate(bson.M{"$setOnInsert": deliveries[i]}).
+			SetUpsert(true)
+	}
+	_, err := s.deliveries.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (s *MongoStore) Due(ctx context.Context, now time.Time, limit int) ([]Delivery, error) {
+	cursor, err := s.deliveries.Find(ctx,
+		bson.M{"status": DeliveryPending, "next_attempt_at": bson.M{"$lte": now}},
+		options.Find().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	due := []Delivery{}
+	if err := cursor.All(ctx, &due); err != nil {
+		return nil, err
+	}
+	return due, nil
+}
+
+func (s *MongoStore) Delivery(ctx context.Context, id string) (*Delivery, error) {
+	var d Delivery
+	err := s.deliveries.FindOne(ctx, bson.M{"_id": id}).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (s *MongoStore) SaveDelivery(ctx context.Context, d *Delivery) error {
+	_, err := s.deliveries.ReplaceOne(ctx, bson.M{"_id": d.ID}, d, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoStore) Deliveries(ctx context.Context, subscriptionID string, limit int) ([]Delivery, error) {
+	cursor, err := s.deliveries.Find(ctx, bson.M{"subscription_id": subscriptionID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	list := []Delivery{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *MongoStore) EraseOwned(ctx context.Context) (int, error) {
+	if statements.UserFrom(ctx) == "" {
+		return 0, statements.ErrUnscopedErasure
+	}
+	cursor, err := s.subscriptions.Find(ctx, statements.OwnerFilter(ctx, bson.M{}), options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var subs []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &subs); err != nil {
+		return 0, err
+	}
+	ids := make([]string, len(subs))
+	for i := range subs {
+		ids[i] = subs[i].ID
+	}
+
+	res, err := s.deliveries.DeleteMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"subscription_id": bson.M{"$in": ids}},
+		statements.OwnerFilter(ctx, bson.M{}),
+	}})
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) > 0 {
+		if _, err := s.subscriptions.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+			return int(res.DeletedCount), err
+		}
+	}
+	return int(res.DeletedCount), nil
+}
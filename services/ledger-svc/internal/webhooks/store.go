@@ -0,0 +1,192 @@
+package webhooks
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+// Store keeps the subscriptions and their deliveries. The subscriptions are
+// scoped to the tenant and user of the context like the statements.
+type Store interface {
+	List(ctx context.Context) ([]Subscription, error)
+	// Get returns nil when the subscription does not exist.
+	Get(ctx context.Context, id string) (*Subscription, error)
+	Save(ctx context.Context, sub *Subscription) error
+	// Delete removes the subscription and its deliveries, ErrNotFound when
+	// it does not exist.
+	Delete(ctx context.Context, id string) error
+
+	// Enqueue adds the deliveries, skipping the IDs already there.
+	Enqueue(ctx context.Context, deliveries []Delivery) error
+	// Due returns the pending deliveries to attempt by now, oldest first.
+	Due(ctx context.Context, now time.Time, limit int) ([]Delivery, error)
+	// Delivery returns nil when the delivery does not exist.
+	Delivery(ctx context.Context, id string) (*Delivery, error)
+	SaveDelivery(ctx context.Context, d *Delivery) error
+	// Deliveries returns the log of the subscription, newest first.
+	Deliveries(ctx context.Context, subscriptionID string, limit int) ([]Delivery, error)
+
+	// EraseOwned deletes the subscriptions of the user ctx is scoped to with
+	// their deliveries, and the deliveries of the events about the user to
+	// other subscriptions, returning how many deliveries it deleted.
+	EraseOwned(ctx context.Context) (int, error)
+}
+
+// NewStore keeps the subscriptions next to the statements in MongoDB, or in
+// memory for the memory driver.
+func NewStore(repo statements.StatementRepository) Store {
+	if mongoRepo, ok := statements.AsMongoRepo(repo); ok {
+		return NewMongoStore(mongoRepo.Database(), mongoRepo.Namespace())
+	}
+	return NewMemoryStore()
+}
+
+type MemoryStore struct {
+	mu            sync.RWMutex
+	subscriptions map[string]Subscription
+	deliveries    map[string]Delivery
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{subscriptions: make(map[string]Subscription), deliveries: make(map[string]Delivery)}
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Subscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		if statements.Owns(ctx, sub.TenantID, sub.UserID) {
+			list = append(list, sub)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Subscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sub, ok := s.subscriptions[id]
+	if !ok || !statements.Owns(ctx, sub.TenantID, sub.UserID) {
+		return nil, nil
+	}
+	return &sub, nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, sub *Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.subscriptions[sub.ID]; ok && !statements.Owns(ctx, existing.TenantID, existing.UserID) {
+		return statements.ErrNotOwned
+	}
+	sub.TenantID, sub.UserID = statements.Stamp(ctx, sub.TenantID, sub.UserID)
+	s.subscriptions[sub.ID] = *sub
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sub, ok := s.subscriptions[id]; !ok || !statements.Owns(ctx, sub.TenantID, sub.UserID) {
+		return ErrNotFound
+	}
+	delete(s.subscriptions, id)
+	for key, d := range s.deliveries {
+		if d.SubscriptionID == id {
+			delete(s.deliveries, key)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Enqueue(ctx context.Context, deliveries []Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range deliveries {
+		if _, ok := s.deliveries[d.ID]; !ok {
+			s.deliveries[d.ID] = d
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Due(ctx context.Context, now time.Time, limit int) ([]Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	due := []Delivery{}
+	for _, d := range s.deliveries {
+		if d.Status == DeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	return due[:min(limit, len(due))], nil
+}
+
+func (s *MemoryStore) Delivery(ctx context.Context, id string) (*Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d, ok := s.deliveries[id]
+	if !ok {
+		return nil, nil
+	}
+	return &d, nil
+}
+
+func (s *MemoryStore) SaveDelivery(ctx context.Context, d *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deliveries[d.ID] = *d
+	return nil
+}
+
+func (s *MemoryStore) Deliveries(ctx context.Context, subscriptionID string, limit int) ([]Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []Delivery{}
+	for _, d := range s.deliveries {
+		if d.SubscriptionID == subscriptionID {
+			list = append(list, d)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list[:min(limit, len(list))], nil
+}
+
+func (s *MemoryStore) EraseOwned(ctx context.Context) (int, error) {
+	if statements.UserFrom(ctx) == "" {
+		return 0, statements.ErrUnscopedErasure
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	erased := map[string]bool{}
+	for id, sub := range s.subscriptions {
+		if sub.UserID != "" && statements.Owns(ctx, sub.TenantID, sub.UserID) {
+			erased[id] = true
+			delete(s.subscriptions, id)
+		}
+	}
+	deleted := 0
+	for id, d := range s.deliveries {
+		if erased[d.SubscriptionID] || d.UserID != "" && statements.Owns(ctx, d.TenantID, d.UserID) {
+			delete(s.deliveries, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,139 @@
+// Package webhooks delivers the data changes to the URLs clients subscribe,
+// signed, retried with backoff and logged per delivery.
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+var (
+	ErrInvalidSubscription = apierror.New(apierror.KindInvalid, "invalid_webhook_subscription", "invalid webhook subscription")
+	ErrNotFound            = apierror.New(apierror.KindNotFound, "webhook_not_found", "webhook subscription not found")
+	ErrDeliveryNotFound    = apierror.New(apierror.KindNotFound, "webhook_delivery_not_found", "webhook delivery not found")
+)
+
+// EventBudgetExceeded is sent once per budget and period, when the spend goes
+// over what the period has available.
+const EventBudgetExceeded = "budget.exceeded"
+
+// Events are the event types a subscription can filter on.
+var Events = []string{
+	statements.EventStatementCreated,
+	statements.EventStatementUpdated,
+	statements.EventStatementPaid,
+	statements.EventStatementDeleted,
+	statements.EventTransactionUpdated,
+	statements.EventTransactionDeleted,
+	EventBudgetExceeded,
+}
+
+// Subscription sends the events of the listed types to URL, every event
+// without a filter. The payloads are signed with Secret like the event
+// webhook, HMAC-SHA256 in the X-Finchie-Signature header. A subscription
+// made by an authenticated user is owned by them and their tenant and only
+// gets the events of what they own; one made without authentication gets
+// the events of every owner.
+type Subscription struct {
+	ID       string   `bson:"_id" json:"id"`
+	URL      string   `bson:"url" json:"url"`
+	Events   []string `bson:"events" json:"events"`
+	TenantID string   `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+	UserID   string   `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	// Secret is only shown when the subscription is created.
+	Secret    string    `bson:"secret" json:"secret,omitempty"`
+	Disabled  bool      `bson:"disabled" json:"disabled"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Normalize validates the URL and the event filter.
+func (s *Subscription) Normalize() error {
+	s.URL = strings.TrimSpace(s.URL)
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidSubscription)
+	}
+	events := make([]string, 0, len(s.Events))
+	for _, e := range s.Events {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if !slices.Contains(Events, e) {
+			return fmt.Errorf("%w: event %q, expected one of %s", ErrInvalidSubscription, e, strings.Join(Events, ", "))
+		}
+		if !slices.Contains(events, e) {
+			events = append(events, e)
+		}
+	}
+	s.Events = events
+	return nil
+}
+
+// Wants reports whether the subscription sends events of the type.
+func (s *Subscription) Wants(eventType string) bool {
+	return !s.Disabled && (len(s.Events) == 0 || slices.Contains(s.Events, eventType))
+}
+
+// Sees reports whether the subscription gets the events of owner, see
+// statements.Owner.
+func (s *Subscription) Sees(owner string) bool {
+	o := statements.Owner(s.TenantID, s.UserID)
+	return o == "" || o == owner
+}
+
+// Event is the body of a delivery.
+type Event struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryFailed is a delivery that ran out of attempts, until redelivered.
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// Delivery is one event for one subscription and the log of its attempts. Its
+// ID derives from both, so an event published again is not delivered twice.
+// Tries counts the attempts since it was queued or redelivered.
+type Delivery struct {
+	ID             string          `bson:"_id" json:"id"`
+	SubscriptionID string          `bson:"subscription_id" json:"subscription_id"`
+	EventID        string          `bson:"event_id" json:"event_id"`
+	EventType      string          `bson:"event_type" json:"event_type"`
+	Payload        json.RawMessage `bson:"payload" json:"payload"`
+	Status         DeliveryStatus  `bson:"status" json:"status"`
+	Attempts       []Attempt       `bson:"attempts" json:"attempts"`
+	Tries          int             `bson:"tries" json:"tries"`
+	NextAttemptAt  time.Time       `bson:"next_attempt_at" json:"next_attempt_at"`
+	CreatedAt      time.Time       `bson:"created_at" json:"created_at"`
+	DeliveredAt    *time.Time      `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+	// TenantID and UserID are the owner of what the event is about, whose
+	// erasure deletes the delivery.
+	TenantID string `bson:"tenant_id,omitempty" json:"-"`
+	UserID   string `bson:"user_id,omitempty" json:"-"`
+}
+
+// Attempt is one POST of a delivery: the response status, or the error when
+// there was no response.
+type Attempt struct {
+	At         time.Time `bson:"at" json:"at"`
+	StatusCode int       `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+	DurationMS int64     `bson:"duration_ms" json:"duration_ms"`
+}
+
+func deliveryID(subscriptionID, eventID string) string {
+	return subscriptionID + ":" + eventID
+}
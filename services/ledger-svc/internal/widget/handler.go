@@ -0,0 +1,102 @@
+package widget
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/accesslog"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/apierror"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/budgets"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const (
+	// cacheTTL is how long a summary is served before it is computed again,
+	// so widgets polling every minute cost one computation per TTL at most.
+	cacheTTL = 30 * time.Second
+
+	cacheControl = "private, max-age=60, stale-while-revalidate=300, stale-if-error=86400"
+)
+
+type Handler struct {
+	Repo    statements.StatementRepository
+	Tracker *budgets.Tracker
+
+	mu sync.Mutex
+	// cache holds the summary of each owner, of the whole deployment under ""
+	// when the API does not authenticate.
+	cache map[string]cachedSummary
+}
+
+type cachedSummary struct {
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// BudgetHandler serves GET /api/widget/budget, the Summary with a strong
+// ETag. A request with a matching If-None-Match gets a 304 without a body.
+func (h *Handler) BudgetHandler(w http.ResponseWriter, r *http.Request) {
+	body, etag, err := h.summary(r)
+	if err != nil {
+		accesslog.Logger(r.Context()).Error("Failed to compute the widget summary", "error", err)
+		apierror.Reply(w, "Failed to compute the widget summary", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Vary", "Authorization")
+	if matches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// summary returns the cached summary and its ETag, computing them again once
+// they expire. Concurrent polls wait for a single computation.
+func (h *Handler) summary(r *http.Request) ([]byte, string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	owner := statements.OwnerFrom(r.Context())
+	if cached, ok := h.cache[owner]; ok && now.Before(cached.expires) {
+		return cached.body, cached.etag, nil
+	}
+	s, err := Summarize(r.Context(), h.Repo, h.Tracker, now)
+	if err != nil {
+		return nil, "", err
+	}
+	body, err := json.Marshal(s)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(body)
+	cached := cachedSummary{body: body, etag: `"` + hex.EncodeToString(sum[:16]) + `"`, expires: now.Add(cacheTTL)}
+	if h.cache == nil {
+		h.cache = map[string]cachedSummary{}
+	}
+	maps.DeleteFunc(h.cache, func(_ string, c cachedSummary) bool { return !now.Before(c.expires) })
+	h.cache[owner] = cached
+	return cached.body, cached.etag, nil
+}
+
+// matches reports whether an If-None-Match header lists the ETag.
+func matches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
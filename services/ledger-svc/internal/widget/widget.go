@@ -0,0 +1,105 @@
+// Package widget serves the compact summary phone widgets poll: what is left
+// of this month's budget and the next payment due.
+package widget
+
+import (
+	"context"
+	"time"
+
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/budgets"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/money"
+	"github.com/hsin19/Finchie/services/ledger-svc/internal/statements"
+)
+
+const (
+	monthLayout = "2006-01"
+	dayLayout   = "2006-01-02"
+)
+
+// Budget is the overall monthly budget, or the monthly category budgets added
+// up when there is no overall one.
+type Budget struct {
+	Limit     float64 `json:"limit"`
+	Spent     float64 `json:"spent"`
+	Remaining float64 `json:"remaining"`
+	Over      bool    `json:"over"`
+}
+
+// Due is the next statement the user has to pay by hand.
+type Due struct {
+	Source string  `json:"source"`
+	Date   string  `json:"date"`
+	Days   int     `json:"days"`
+	Amount float64 `json:"amount"`
+}
+
+// Summary holds nothing that changes between two polls unless the data does,
+// so that its ETag stays put.
+type Summary struct {
+	Month   string  `json:"month"`
+	Budget  *Budget `json:"budget"`
+	NextDue *Due    `json:"next_due"`
+}
+
+// Summarize returns the summary as of now. Tracker may be nil, the budget is
+// then left out.
+func Summarize(ctx context.Context, repo statements.StatementRepository, tracker *budgets.Tracker, now time.Time) (*Summary, error) {
+	now = now.UTC()
+	s := &Summary{Month: now.Format(monthLayout)}
+
+	if tracker != nil {
+		list, err := tracker.Status(ctx, now)
+		if err != nil {
+			return nil, err
+		}
+		var overall, total *Budget
+		for _, status := range list {
+			if status.Budget.Period != budgets.Monthly {
+				continue
+			}
+			if status.Budget.Category == "" {
+				overall = &Budget{Limit: status.Available, Spent: status.Spent}
+				break
+			}
+			if total == nil {
+				total = &Budget{}
+			}
+			total.Limit += status.Available
+			total.Spent += status.Spent
+		}
+		if s.Budget = overall; s.Budget == nil {
+			s.Budget = total
+		}
+		if b := s.Budget; b != nil {
+			b.Limit, b.Spent = money.Round(b.Limit), money.Round(b.Spent)
+			b.Remaining = money.Round(b.Limit - b.Spent)
+			b.Over = b.Remaining < 0
+		}
+	}
+
+	stmts, err := repo.ListStatements(ctx, statements.StatementFilter{})
+	if err != nil {
+		return nil, err
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var next *statements.Statement
+	for i := range stmts {
+		stmt := &stmts[i]
+		if stmt.PaymentDueDate == nil || stmt.PaymentDueDate.Before(today) || !stmt.NeedsManualPayment() {
+			continue
+		}
+		if next == nil || stmt.PaymentDueDate.Before(*next.PaymentDueDate) {
+			next = stmt
+		}
+	}
+	if next != nil {
+		due := next.PaymentDueDate.UTC()
+		s.NextDue = &Due{
+			Source: next.SourceName,
+			Date:   due.Format(dayLayout),
+			Days:   int(due.Sub(today).Hours() / 24),
+			Amount: money.Round(next.AmountToPay()),
+		}
+	}
+	return s, nil
+}
@@ -1,16 +1,22 @@
 # Import all models for easy access
 from .api_models import (
+    AutopayAmountType,
+    Rewards,
     SourceType,
     Statement,
     StatementType,
     Transaction,
+    TransactionRewards,
 )
 
 __all__ = [
+    "AutopayAmountType",
+    "Rewards",
     "SourceType",
     "SourceType",
     "Statement",
     "StatementType",
     "StatementType",
     "Transaction",
+    "TransactionRewards",
 ]
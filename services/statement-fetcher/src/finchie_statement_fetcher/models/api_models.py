@@ -12,15 +12,41 @@ class SourceType(IntEnum):
     CREDIT_CARD = 1
 
 
+class AutopayAmountType(IntEnum):
+    FULL_BALANCE = 1
+    MINIMUM_PAYMENT = 2
+
+
+@dataclass
+class TransactionRewards:
+    points: float = 0.0
+    cashback: float = 0.0
+
+
 @dataclass
 class Transaction:
     id: str | None
     description: str
     amount: float
     date: datetime
+    currency: str | None = None
+    merchant_city: str | None = None
+    merchant_country: str | None = None
+    is_foreign: bool | None = None
+    rewards: TransactionRewards | None = None
     extra: Any | None = None
 
 
+@dataclass
+class Rewards:
+    points_earned: float = 0.0
+    points_redeemed: float = 0.0
+    points_balance: float | None = None
+    points_expiring: float = 0.0
+    points_expiry_date: datetime | None = None
+    cashback: float = 0.0
+
+
 @dataclass
 class Statement:
     type: StatementType = StatementType.CREDIT_CARD_BILL
@@ -34,5 +60,9 @@ class Statement:
     current_amount: float | None = None
     currency: str = ""
     payment_due_date: datetime | None = None
+    minimum_payment_due: float | None = None
+    autopay_enabled: bool = False
+    autopay_amount_type: AutopayAmountType | None = None
+    rewards: Rewards | None = None
     transactions: list[Transaction] = field(default_factory=list)
     extra: Any | None = None
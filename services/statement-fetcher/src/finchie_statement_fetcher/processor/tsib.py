@@ -8,7 +8,7 @@ from pathlib import Path
 from typing import Any
 
 from finchie_statement_fetcher.models import Statement
-from finchie_statement_fetcher.models.api_models import SourceType, StatementType, Transaction
+from finchie_statement_fetcher.models.api_models import Rewards, SourceType, StatementType, Transaction
 from finchie_statement_fetcher.processor.base import BaseProcessor
 from finchie_statement_fetcher.processor.tsib_estatement_extractor import extract_credit_card_statement
 from finchie_statement_fetcher.utils import parse_taiwanese_date
@@ -57,6 +57,9 @@ class TsibProcessor(BaseProcessor):
                         description=transaction.description,
                         amount=to_float(transaction.new_taiwan_dollar_amount)[0],
                         date=parse_taiwanese_date(transaction.transaction_date) or datetime.min,
+                        currency=transaction.currency or None,
+                        merchant_country=transaction.location or None,
+                        is_foreign=_is_foreign(transaction.location, transaction.currency),
                     )
                 )
 
@@ -72,10 +75,41 @@ class TsibProcessor(BaseProcessor):
             current_amount=to_float(raw_statement.bill_info.get("本期新增款項", "0"))[0],
             currency="TWD",
             payment_due_date=parse_taiwanese_date(raw_statement.bill_info.get("繳款截止日", "")),
+            minimum_payment_due=to_float(raw_statement.bill_info.get("本期最低應繳金額", "0"))[0],
+            rewards=_extract_rewards(raw_statement.bill_info),
             transactions=transactions,
         )
 
 
+def _is_foreign(location: str | None, currency: str | None) -> bool | None:
+    if currency:
+        return currency != "TWD"
+    if location:
+        return location != "TW"
+    return None
+
+
+def _extract_rewards(bill_info: dict[str, str]) -> Rewards | None:
+    if "新增回饋" not in bill_info and "本期結餘回饋" not in bill_info:
+        return None
+
+    expiry_date = bill_info.get("點數到期日")
+    return Rewards(
+        points_earned=_to_points(bill_info.get("新增回饋")) + _to_points(bill_info.get("活動回饋/調整")),
+        points_redeemed=_to_points(bill_info.get("本期使用點數/里數")),
+        points_balance=_to_points(bill_info.get("本期結餘回饋")) if "本期結餘回饋" in bill_info else None,
+        points_expiring=_to_points(bill_info.get("到期點數")),
+        points_expiry_date=parse_taiwanese_date(expiry_date) if expiry_date else None,
+    )
+
+
+def _to_points(value: str | None) -> float:
+    # point values are printed with trailing markers, e.g. "8,888 **"
+    if value is None:
+        return 0.0
+    return to_float(value.replace("*", "").strip())[0]
+
+
 def _is_tsib_main_folder(folder_path):
     # Check if the folder contains the expected TSB_Creditcard_Estatement*.pdf files
     search_pattern = os.path.join(folder_path, "TSB_Creditcard_Estatement*.pdf")
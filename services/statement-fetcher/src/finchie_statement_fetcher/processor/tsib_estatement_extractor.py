@@ -90,6 +90,8 @@ def _extract_bill_info(text: str) -> dict[str, str]:
         "活動回饋/調整": r"活動回饋/調整\s+(-?[ \d,\*]+)",
         "本期使用點數/里數": r"本期使用點數/里數\s+(-?[ \d,\*]+)",
         "本期結餘回饋": r"本期結餘回饋\s+(-?[ \d,\*]+)",
+        "到期點數": r"您有\s*(\d+(?:,\d+)*)點將於",
+        "點數到期日": r"點將於\s*(\d+/\d+/\d+)\s*到期",
     }
 
     bill_data = {}
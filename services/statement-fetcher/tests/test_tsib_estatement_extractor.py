@@ -34,6 +34,8 @@ def test_extract_bill_info():
     assert bill_info["國外預借現金額度"] == "66,666"
     assert bill_info["分期吉時金額度"] == "77,777"
     assert bill_info["循環信用利率"] == "6.75"
+    assert bill_info["到期點數"] == "1,111"
+    assert bill_info["點數到期日"] == "116/01/31"
 
 
 def test_extract_transactions():